@@ -0,0 +1,201 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Command gopickle inspects pickle and PyTorch files, without writing any Go
+code.
+
+Usage:
+
+	gopickle dump [-pickle] [-compact] FILE
+	gopickle tensors [-pickle] FILE
+	gopickle dis [-entry NAME] FILE
+
+The dump command prints the object loaded from a PyTorch file, or from a
+plain pickle with -pickle, as JSON (see pytorch.StructureToJSON): tensors
+are summarized by their data type and shape. The tensors command lists the
+name, data type and shape of each tensor of the file. The classes which
+cannot be resolved are loaded as placeholders, and the tensors which
+cannot be rebuilt are reported, rather than failing.
+
+The dis command prints the opcodes of a pickle, as the Python
+"pickletools.dis" (see pickletools.Dis). For a zip-based PyTorch file, it
+disassembles the "data.pkl" record, or the one named by -entry, such as
+"constants.pkl".
+*/
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickletools"
+	"github.com/nlpodyssey/gopickle/pytorch"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"text/tabwriter"
+)
+
+const usage = `usage:
+  gopickle dump [-pickle] [-compact] FILE
+  gopickle tensors [-pickle] FILE
+  gopickle dis [-entry NAME] FILE
+`
+
+// errUsage is returned by run for invalid command lines.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, errUsage) {
+		if err != errUsage {
+			fmt.Fprintf(os.Stderr, "gopickle: %v\n", err)
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopickle: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command of the given arguments, without the program name,
+// writing its output to w.
+func run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var plainPickle, compact *bool
+	var entry *string
+	switch args[0] {
+	case "dump", "tensors":
+		plainPickle = fs.Bool("pickle", false, "load a plain pickle, rather than a PyTorch file")
+		if args[0] == "dump" {
+			compact = fs.Bool("compact", false, "print the JSON without indentation")
+		}
+	case "dis":
+		entry = fs.String("entry", "data.pkl", "the record of a zip-based PyTorch file to disassemble")
+	default:
+		return errUsage
+	}
+	if err := fs.Parse(args[1:]); err == flag.ErrHelp {
+		return errUsage
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	filename := fs.Arg(0)
+
+	if args[0] == "dis" {
+		return dis(filename, *entry, w)
+	}
+	obj, err := load(filename, *plainPickle)
+	if err != nil {
+		return err
+	}
+	if args[0] == "dump" {
+		return dump(obj, w, *compact)
+	}
+	return listTensors(obj, w)
+}
+
+// load loads a PyTorch file, or a plain pickle, tolerating the unknown
+// classes and the tensors which cannot be rebuilt.
+func load(filename string, plainPickle bool) (interface{}, error) {
+	opts := pytorch.LoadOptions{
+		AllowUnknownClasses:   true,
+		ContinueOnTensorError: true,
+	}
+	if !plainPickle {
+		return pytorch.LoadWithOptions(filename, opts)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return pytorch.LoadPickle(f, opts)
+}
+
+// dump prints the JSON representation of obj, indented unless compact.
+func dump(obj interface{}, w io.Writer, compact bool) error {
+	data, err := pytorch.StructureToJSON(obj, pytorch.JSONOptions{})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if compact {
+		buf.Write(data)
+	} else if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// listTensors prints a table of the tensors found in obj, followed by
+// their total number of elements.
+func listTensors(obj interface{}, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDTYPE\tSHAPE")
+	tensors := pytorch.FindTensors(obj)
+	elements := 0
+	for _, entry := range tensors {
+		t := entry.Tensor
+		if t.Err != nil {
+			fmt.Fprintf(tw, "%s\terror: %v\t\n", entry.Name, t.Err)
+			continue
+		}
+		dtype := "unknown"
+		if d := t.Dtype(); d != nil {
+			dtype = d.Name
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\n", entry.Name, dtype, t.Size)
+		elements += t.Numel()
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d tensors, %d elements\n", len(tensors), elements)
+	return err
+}
+
+// dis disassembles a pickle file, or a record of a zip-based PyTorch file,
+// whose name is entry, in any directory of the archive.
+func dis(filename, entry string, w io.Writer) error {
+	z, err := zip.OpenReader(filename)
+	if err != nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return pickletools.Dis(bufio.NewReader(f), w)
+	}
+	defer z.Close()
+	for _, file := range z.File {
+		if path.Base(file.Name) != entry {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return pickletools.Dis(bufio.NewReader(rc), w)
+	}
+	return fmt.Errorf("%s: no %s record found", filename, entry)
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+const testdata = "../../pytorch/testdata"
+
+func TestTensors(t *testing.T) {
+	var out strings.Builder
+	if err := run([]string{"tensors", path.Join(testdata, "synthetic_whole_module.pt")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "NAME                    DTYPE    SHAPE\n" +
+		"fc.weight               float32  [2 2]\n" +
+		"bn.weight               float32  [2]\n" +
+		"bn.bias                 float32  [2]\n" +
+		"bn.running_mean         float32  [2]\n" +
+		"bn.running_var          float32  [2]\n" +
+		"bn.num_batches_tracked  int64    []\n" +
+		"6 tensors, 13 elements\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, out.String())
+	}
+}
+
+func TestDump(t *testing.T) {
+	// pickle.dumps({'a': [1, 2.5], 'b': None}, protocol=2)
+	filename := path.Join(t.TempDir(), "data.pkl")
+	data := "\x80\x02}q\x00(X\x01\x00\x00\x00aq\x01]q\x02(K\x01G@\x04\x00\x00\x00\x00\x00\x00eX\x01\x00\x00\x00bq\x03Nu."
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := run([]string{"dump", "-pickle", "-compact", filename}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{\"a\":[1,2.5],\"b\":null}\n"; out.String() != expected {
+		t.Errorf("expected %q, actual %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"dump", "-pickle", filename}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{\n  \"a\": [\n    1,\n    2.5\n  ],\n  \"b\": null\n}\n"; out.String() != expected {
+		t.Errorf("expected %q, actual %q", expected, out.String())
+	}
+}
+
+func TestDis(t *testing.T) {
+	var out strings.Builder
+	if err := run([]string{"dis", path.Join(testdata, "synthetic_ordered_state_dict.pt")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if lines[1] != "    2: c    GLOBAL     'collections OrderedDict'" {
+		t.Errorf("unexpected second line %q", lines[1])
+	}
+	if !strings.HasSuffix(out.String(), "highest protocol among opcodes = 2\n") {
+		t.Errorf("unexpected end of output %q", out.String())
+	}
+
+	err := run([]string{"dis", "-entry", "missing.pkl", path.Join(testdata, "synthetic_ordered_state_dict.pt")}, &out)
+	if err == nil || !strings.Contains(err.Error(), "no missing.pkl record found") {
+		t.Errorf("expected missing record error, actual %v", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"unknown", "file"},
+		{"dump"},
+		{"dis", "-pickle", "file"},
+	} {
+		if err := run(args, ioutil.Discard); !errors.Is(err, errUsage) {
+			t.Errorf("%v: expected usage error, actual %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package numpy
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"strconv"
+)
+
+// Dtype represents a NumPy data type ("numpy.dtype") of a fixed-size
+// numeric or boolean value.
+type Dtype struct {
+	// Kind is the character code of the general kind of data: 'b' for
+	// booleans, 'i' for signed integers, 'u' for unsigned integers, 'f' for
+	// floating point numbers and 'c' for complex numbers.
+	Kind byte
+	// ItemSize is the size in bytes of a single value.
+	ItemSize int
+	// ByteOrder is '<' for little-endian, '>' for big-endian, or '|' when
+	// not applicable, as for single-byte values.
+	ByteOrder byte
+}
+
+var _ types.PyStateSettable = &Dtype{}
+
+// String returns the NumPy string representation of the data type, such
+// as "<f8".
+func (d *Dtype) String() string {
+	return fmt.Sprintf("%c%c%d", d.ByteOrder, d.Kind, d.ItemSize)
+}
+
+// PySetState sets the byte order of the data type from the pickled state
+// tuple, whose second element is the byte order character.
+func (d *Dtype) PySetState(state interface{}) error {
+	t, ok := state.(*types.Tuple)
+	if !ok || t.Len() < 2 {
+		return fmt.Errorf("Dtype: unexpected state %#v", state)
+	}
+	order, ok := t.Get(1).(string)
+	if !ok || len(order) != 1 {
+		return fmt.Errorf("Dtype: unexpected byte order %#v", t.Get(1))
+	}
+	switch order[0] {
+	case '<', '>', '|':
+		d.ByteOrder = order[0]
+	case '=':
+		d.ByteOrder = '<'
+	default:
+		return fmt.Errorf("Dtype: unexpected byte order %q", order)
+	}
+	return nil
+}
+
+// DtypeClass represents the "numpy.dtype" class.
+type DtypeClass struct{}
+
+var _ types.Callable = &DtypeClass{}
+
+// Call returns a new Dtype from its string representation, such as "f8"
+// or "<i4". The "align" and "copy" arguments are ignored.
+func (*DtypeClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, fmt.Errorf("DtypeClass: invalid arguments: %#v", args)
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("DtypeClass: invalid arguments: %#v", args)
+	}
+	return parseDtype(s)
+}
+
+func parseDtype(s string) (*Dtype, error) {
+	d := &Dtype{ByteOrder: '<'}
+	rest := s
+	if len(rest) > 0 {
+		switch rest[0] {
+		case '<', '>', '|':
+			d.ByteOrder = rest[0]
+			rest = rest[1:]
+		case '=':
+			rest = rest[1:]
+		}
+	}
+	if len(rest) < 2 {
+		return nil, fmt.Errorf("unsupported NumPy dtype %q", s)
+	}
+	d.Kind = rest[0]
+	size, err := strconv.Atoi(rest[1:])
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("unsupported NumPy dtype %q", s)
+	}
+	d.ItemSize = size
+	if size == 1 {
+		d.ByteOrder = '|'
+	}
+	return d, nil
+}
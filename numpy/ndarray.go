@@ -0,0 +1,250 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package numpy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"reflect"
+)
+
+// Ndarray represents a NumPy array ("numpy.ndarray") of fixed-size values,
+// holding their raw bytes.
+type Ndarray struct {
+	// Shape is the size of each dimension. It is empty for a
+	// zero-dimensional array, holding a single value.
+	Shape []int
+	Dtype *Dtype
+	// FortranOrder is true if Data holds the values in column-major
+	// (Fortran) order, rather than in row-major (C) order.
+	FortranOrder bool
+	// Data is the raw bytes of the values, in the byte order of the Dtype.
+	Data []byte
+}
+
+var _ types.PyStateSettable = &Ndarray{}
+
+// Size returns the number of values of the array.
+func (a *Ndarray) Size() int {
+	n := 1
+	for _, s := range a.Shape {
+		n *= s
+	}
+	return n
+}
+
+// PySetState sets the shape, data type and data of the array from the
+// pickled state tuple (version, shape, dtype, is_fortran, data), where
+// the version is omitted by older releases of NumPy. The arrays of
+// Python objects, whose data is a list, are not supported.
+func (a *Ndarray) PySetState(state interface{}) error {
+	t, ok := state.(*types.Tuple)
+	if !ok || (t.Len() != 4 && t.Len() != 5) {
+		return fmt.Errorf("Ndarray: unexpected state %#v", state)
+	}
+	items := []interface{}(*t)
+	if len(items) == 5 {
+		items = items[1:]
+	}
+
+	shape, ok := parseShape(items[0])
+	if !ok {
+		return fmt.Errorf("Ndarray: unexpected shape %#v", items[0])
+	}
+	dtype, ok := items[1].(*Dtype)
+	if !ok {
+		return fmt.Errorf("Ndarray: unexpected dtype %#v", items[1])
+	}
+	fortranOrder, ok := items[2].(bool)
+	if !ok {
+		return fmt.Errorf("Ndarray: unexpected Fortran order flag %#v", items[2])
+	}
+	if dtype.Kind == 'O' {
+		return fmt.Errorf("Ndarray: arrays of Python objects (dtype %v) are not supported", dtype)
+	}
+	var data []byte
+	switch v := items[3].(type) {
+	case types.Bytes:
+		data = v.Bytes()
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("Ndarray: invalid data: %#v", items[3])
+	}
+
+	a.Shape = shape
+	a.Dtype = dtype
+	a.FortranOrder = fortranOrder
+	a.Data = data
+	return a.checkSize()
+}
+
+// checkSize returns an error if the length of the data is not the size of
+// the values of the array.
+func (a *Ndarray) checkSize() error {
+	if required := a.Size() * a.Dtype.ItemSize; len(a.Data) != required {
+		return fmt.Errorf("Ndarray: %d bytes of data for %d values of dtype %v",
+			len(a.Data), a.Size(), a.Dtype)
+	}
+	return nil
+}
+
+// parseShape returns the sizes of a pickled shape tuple.
+func parseShape(v interface{}) ([]int, bool) {
+	t, ok := v.(*types.Tuple)
+	if !ok {
+		return nil, false
+	}
+	shape := make([]int, t.Len())
+	for i := range shape {
+		s, ok := toInt(t.Get(i))
+		if !ok || s < 0 {
+			return nil, false
+		}
+		shape[i] = s
+	}
+	return shape, true
+}
+
+// Values returns the values of the array as a slice of the Go type of its
+// scalars (see Scalar), such as []float32 or []int64, in row-major (C)
+// order, even when the data is in Fortran order. The values of float16
+// arrays are returned as []float32.
+func (a *Ndarray) Values() (interface{}, error) {
+	zero, err := decodeScalar(a.Dtype, make([]byte, a.Dtype.ItemSize))
+	if err != nil {
+		return nil, fmt.Errorf("Ndarray: unsupported dtype %v", a.Dtype)
+	}
+	n := a.Size()
+	var order binary.ByteOrder = binary.LittleEndian
+	if a.Dtype.ByteOrder == '>' {
+		order = binary.BigEndian
+	}
+	var values reflect.Value
+	if a.Dtype.Kind == 'f' && a.Dtype.ItemSize == 2 {
+		if len(a.Data) < 2*n {
+			return nil, fmt.Errorf("Ndarray: %d bytes of data for %d values of dtype %v",
+				len(a.Data), n, a.Dtype)
+		}
+		halves := make([]float32, n)
+		for i := range halves {
+			halves[i] = halfToFloat32(order.Uint16(a.Data[2*i:]))
+		}
+		values = reflect.ValueOf(halves)
+	} else {
+		values = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(zero)), n, n)
+		if err := binary.Read(bytes.NewReader(a.Data), order, values.Interface()); err != nil {
+			return nil, fmt.Errorf("Ndarray: %w", err)
+		}
+	}
+	if !a.FortranOrder || len(a.Shape) < 2 {
+		return values.Interface(), nil
+	}
+
+	// The values are copied to the row-major positions of their indices,
+	// which are counted with the first index changing fastest.
+	cValues := reflect.MakeSlice(values.Type(), n, n)
+	cStrides := make([]int, len(a.Shape))
+	stride := 1
+	for d := len(a.Shape) - 1; d >= 0; d-- {
+		cStrides[d] = stride
+		stride *= a.Shape[d]
+	}
+	index := make([]int, len(a.Shape))
+	for i := 0; i < n; i++ {
+		pos := 0
+		for d, idx := range index {
+			pos += idx * cStrides[d]
+		}
+		cValues.Index(pos).Set(values.Index(i))
+		for d := range index {
+			index[d]++
+			if index[d] < a.Shape[d] {
+				break
+			}
+			index[d] = 0
+		}
+	}
+	return cValues.Interface(), nil
+}
+
+// toInt returns the value of an unpickled integer, which is an int64 when
+// the pickle.Unpickler normalizes the integers.
+func toInt(v interface{}) (int, bool) {
+	switch i := v.(type) {
+	case int:
+		return i, true
+	case int64:
+		return int(i), true
+	default:
+		return 0, false
+	}
+}
+
+// NdarrayClass represents the "numpy.ndarray" class, which is only
+// referenced as the type of the arrays made by Reconstruct.
+type NdarrayClass struct{}
+
+// Reconstruct represents the "numpy.core.multiarray._reconstruct"
+// function, which NumPy uses for pickling arrays: it makes an empty
+// Ndarray, whose content is then set by Ndarray.PySetState.
+type Reconstruct struct{}
+
+var _ types.Callable = &Reconstruct{}
+
+// Call returns a new empty Ndarray, given the array type, which is
+// ignored, the initial shape and the data type code.
+func (*Reconstruct) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("Reconstruct: invalid arguments: %#v", args)
+	}
+	return &Ndarray{}, nil
+}
+
+// FromBuffer represents the "numpy.core.numeric._frombuffer" function,
+// which NumPy uses instead of Reconstruct for pickling the contiguous
+// arrays with protocol 5, so that their data can be out-of-band (see
+// pickle.Unpickler.SetBuffers).
+type FromBuffer struct{}
+
+var _ types.Callable = &FromBuffer{}
+
+// Call returns a new Ndarray, given its data buffer, data type, shape and
+// order: "C" for row-major, or "F" for column-major (Fortran) order. For
+// a writable buffer, usually an out-of-band *types.ByteArray, the array
+// shares its bytes.
+func (*FromBuffer) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("FromBuffer: invalid arguments: %#v", args)
+	}
+	var data []byte
+	switch v := args[0].(type) {
+	case *types.ByteArray:
+		data = *v
+	case types.Bytes:
+		data = v.Bytes()
+	default:
+		return nil, fmt.Errorf("FromBuffer: invalid data: %#v", args[0])
+	}
+	dtype, ok := args[1].(*Dtype)
+	if !ok {
+		return nil, fmt.Errorf("FromBuffer: unexpected dtype %#v", args[1])
+	}
+	shape, ok := parseShape(args[2])
+	if !ok {
+		return nil, fmt.Errorf("FromBuffer: unexpected shape %#v", args[2])
+	}
+	order, ok := args[3].(string)
+	if !ok || (order != "C" && order != "F") {
+		return nil, fmt.Errorf("FromBuffer: unexpected order %#v", args[3])
+	}
+	a := &Ndarray{Shape: shape, Dtype: dtype, FortranOrder: order == "F", Data: data}
+	if err := a.checkSize(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
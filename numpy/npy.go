@@ -0,0 +1,375 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package numpy
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// npyMagic is the magic string which starts a ".npy" file, followed by
+// the major and minor version of the format.
+const npyMagic = "\x93NUMPY"
+
+// npyAlignment is the alignment of the data of a ".npy" file, the same
+// used by NumPy.
+const npyAlignment = 64
+
+// ReadNpy reads an array in the ".npy" format of NumPy, as written by
+// "numpy.save", from r. The versions 1.0, 2.0 and 3.0 of the format are
+// supported, holding arrays of any data type but Python objects, which
+// require a pickle, and structured types.
+func ReadNpy(r io.Reader) (*Ndarray, error) {
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("ReadNpy: %w", err)
+	}
+	if string(prefix[:6]) != npyMagic {
+		return nil, errors.New("ReadNpy: invalid magic string")
+	}
+	var headerLen int
+	switch major := prefix[6]; major {
+	case 1:
+		var hl [2]byte
+		if _, err := io.ReadFull(r, hl[:]); err != nil {
+			return nil, fmt.Errorf("ReadNpy: %w", err)
+		}
+		headerLen = int(binary.LittleEndian.Uint16(hl[:]))
+	case 2, 3:
+		var hl [4]byte
+		if _, err := io.ReadFull(r, hl[:]); err != nil {
+			return nil, fmt.Errorf("ReadNpy: %w", err)
+		}
+		headerLen = int(binary.LittleEndian.Uint32(hl[:]))
+	default:
+		return nil, fmt.Errorf("ReadNpy: unsupported format version %d.%d", major, prefix[7])
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("ReadNpy: %w", err)
+	}
+
+	a, err := parseNpyHeader(string(header))
+	if err != nil {
+		return nil, fmt.Errorf("ReadNpy: %w", err)
+	}
+	// The data is read as it comes, rather than allocated upfront, so that
+	// a corrupted shape fails without exhausting the memory.
+	size := int64(a.Dtype.ItemSize)
+	for _, s := range a.Shape {
+		if s != 0 && size > math.MaxInt64/int64(s) {
+			return nil, fmt.Errorf("ReadNpy: shape %v too large", a.Shape)
+		}
+		size *= int64(s)
+	}
+	if a.Data, err = ioutil.ReadAll(io.LimitReader(r, size)); err != nil {
+		return nil, fmt.Errorf("ReadNpy: reading data: %w", err)
+	}
+	if int64(len(a.Data)) != size {
+		return nil, fmt.Errorf("ReadNpy: reading data: %w", io.ErrUnexpectedEOF)
+	}
+	return a, nil
+}
+
+// LoadNpy reads the ".npy" file with the given name (see ReadNpy).
+func LoadNpy(filename string) (*Ndarray, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadNpy(bufio.NewReader(f))
+}
+
+// LoadNpz reads the arrays of a ".npz" archive, as written by
+// "numpy.savez" or "numpy.savez_compressed", by name: the name of each
+// ".npy" record, without the extension, which is also the key of the
+// array in the result of "numpy.load".
+func LoadNpz(filename string) (map[string]*Ndarray, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	arrays := make(map[string]*Ndarray, len(r.File))
+	for _, f := range r.File {
+		name := strings.TrimSuffix(f.Name, ".npy")
+		a, err := readNpzRecord(f)
+		if err != nil {
+			return nil, fmt.Errorf("LoadNpz: %q: %w", name, err)
+		}
+		arrays[name] = a
+	}
+	return arrays, nil
+}
+
+func readNpzRecord(f *zip.File) (*Ndarray, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ReadNpy(bufio.NewReader(rc))
+}
+
+// WriteNpy writes the array to w in the ".npy" format, with the same data
+// type, shape and order, so that "numpy.load" reads it back even with
+// allow_pickle=False. The version 1.0 of the format is used, or 2.0 if
+// the header is too long for it.
+func WriteNpy(w io.Writer, a *Ndarray) error {
+	if a.Dtype == nil {
+		return errors.New("WriteNpy: missing dtype")
+	}
+	if err := a.checkSize(); err != nil {
+		return fmt.Errorf("WriteNpy: %w", err)
+	}
+	if _, err := io.WriteString(w, npyHeader(a)); err != nil {
+		return err
+	}
+	_, err := w.Write(a.Data)
+	return err
+}
+
+// SaveNpy writes the array to the named file (see WriteNpy).
+func SaveNpy(filename string, a *Ndarray) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := WriteNpy(f, a); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SaveNpz writes the given arrays to the named file, as an uncompressed
+// ".npz" archive, like "numpy.savez": each array is a ".npy" record named
+// after its key. The records are written in sorted order.
+func SaveNpz(filename string, arrays map[string]*Ndarray) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeNpz(f, arrays); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeNpz(w io.Writer, arrays map[string]*Ndarray) error {
+	keys := make([]string, 0, len(arrays))
+	for key := range arrays {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	zw := zip.NewWriter(w)
+	for _, key := range keys {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:   key + ".npy",
+			Method: zip.Store,
+		})
+		if err != nil {
+			return err
+		}
+		if err := WriteNpy(fw, arrays[key]); err != nil {
+			return fmt.Errorf("SaveNpz: %q: %w", key, err)
+		}
+	}
+	return zw.Close()
+}
+
+// npyHeader returns the magic string, the version and the header of a
+// ".npy" file holding the array, padded so that the data which follows is
+// aligned.
+func npyHeader(a *Ndarray) string {
+	dims := make([]string, len(a.Shape))
+	for i, s := range a.Shape {
+		dims[i] = strconv.Itoa(s)
+	}
+	shape := strings.Join(dims, ", ")
+	if len(dims) == 1 {
+		shape += ","
+	}
+	fortranOrder := "False"
+	if a.FortranOrder {
+		fortranOrder = "True"
+	}
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': %s, 'shape': (%s), }",
+		a.Dtype, fortranOrder, shape)
+
+	// The header is terminated by a newline, and padded with spaces.
+	version, lenSize := "\x01\x00", 2
+	headerLen := len(dict) + 1
+	headerLen += npyAlignment - (len(npyMagic)+2+lenSize+headerLen)%npyAlignment
+	if headerLen > 0xffff {
+		version, lenSize = "\x02\x00", 4
+		headerLen = len(dict) + 1
+		headerLen += npyAlignment - (len(npyMagic)+2+lenSize+headerLen)%npyAlignment
+	}
+	var b strings.Builder
+	b.WriteString(npyMagic)
+	b.WriteString(version)
+	var hl [4]byte
+	binary.LittleEndian.PutUint32(hl[:], uint32(headerLen))
+	b.Write(hl[:lenSize])
+	b.WriteString(dict)
+	b.WriteString(strings.Repeat(" ", headerLen-len(dict)-1))
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// parseNpyHeader returns an array without data, described by the header
+// of a ".npy" file, the literal of a Python dictionary with the "descr",
+// "fortran_order" and "shape" keys.
+func parseNpyHeader(header string) (*Ndarray, error) {
+	p := &npyHeaderParser{s: header}
+	a := &Ndarray{}
+	var hasDescr, hasOrder, hasShape bool
+	if !p.consume('{') {
+		return nil, fmt.Errorf("invalid header %q", header)
+	}
+	for !p.consume('}') {
+		key, ok := p.parseString()
+		if !ok || !p.consume(':') {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+		switch key {
+		case "descr":
+			descr, ok := p.parseString()
+			if !ok {
+				return nil, fmt.Errorf("unsupported descr in header %q", header)
+			}
+			dtype, err := parseDtype(descr)
+			if err != nil {
+				return nil, err
+			}
+			if dtype.Kind == 'O' {
+				return nil, fmt.Errorf("arrays of Python objects (dtype %v) are not supported", dtype)
+			}
+			a.Dtype, hasDescr = dtype, true
+		case "fortran_order":
+			switch {
+			case p.consumeWord("True"):
+				a.FortranOrder = true
+			case p.consumeWord("False"):
+				a.FortranOrder = false
+			default:
+				return nil, fmt.Errorf("invalid fortran_order in header %q", header)
+			}
+			hasOrder = true
+		case "shape":
+			shape, ok := p.parseShape()
+			if !ok {
+				return nil, fmt.Errorf("invalid shape in header %q", header)
+			}
+			a.Shape, hasShape = shape, true
+		default:
+			return nil, fmt.Errorf("unexpected key %q in header", key)
+		}
+		if !p.consume(',') && !p.peek('}') {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+	}
+	if !hasDescr || !hasOrder || !hasShape {
+		return nil, fmt.Errorf("incomplete header %q", header)
+	}
+	return a, nil
+}
+
+// npyHeaderParser reads the few Python literals of a ".npy" header.
+type npyHeaderParser struct {
+	s   string
+	pos int
+}
+
+func (p *npyHeaderParser) skipSpaces() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek reports whether the next character, after any space, is c.
+func (p *npyHeaderParser) peek(c byte) bool {
+	p.skipSpaces()
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+// consume skips the next character, after any space, if it is c.
+func (p *npyHeaderParser) consume(c byte) bool {
+	if !p.peek(c) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// consumeWord skips the next word, after any space, if it is w.
+func (p *npyHeaderParser) consumeWord(w string) bool {
+	p.skipSpaces()
+	if !strings.HasPrefix(p.s[p.pos:], w) {
+		return false
+	}
+	p.pos += len(w)
+	return true
+}
+
+// parseString returns the value of a quoted string without escapes, as
+// the keys and the data types of the headers.
+func (p *npyHeaderParser) parseString() (string, bool) {
+	p.skipSpaces()
+	if p.pos >= len(p.s) || (p.s[p.pos] != '\'' && p.s[p.pos] != '"') {
+		return "", false
+	}
+	quote := p.s[p.pos]
+	end := strings.IndexByte(p.s[p.pos+1:], quote)
+	if end < 0 {
+		return "", false
+	}
+	value := p.s[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return value, true
+}
+
+// parseShape returns the sizes of a tuple of integers, such as "(2, 3)",
+// "(4,)" or "()". The "L" suffix of the long integers of Python 2 is
+// accepted.
+func (p *npyHeaderParser) parseShape() ([]int, bool) {
+	if !p.consume('(') {
+		return nil, false
+	}
+	shape := []int{}
+	for !p.consume(')') {
+		p.skipSpaces()
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		s, err := strconv.Atoi(p.s[start:p.pos])
+		if err != nil {
+			return nil, false
+		}
+		if p.pos < len(p.s) && p.s[p.pos] == 'L' {
+			p.pos++
+		}
+		shape = append(shape, s)
+		if !p.consume(',') && !p.peek(')') {
+			return nil, false
+		}
+	}
+	return shape, true
+}
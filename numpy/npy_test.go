@@ -0,0 +1,184 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package numpy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// npyFile returns the content of a ".npy" file of version 1.0 with the
+// given header dictionary and data.
+func npyFile(dict string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x93NUMPY\x01\x00")
+	var hl [2]byte
+	binary.LittleEndian.PutUint16(hl[:], uint16(len(dict)+1))
+	b.Write(hl[:])
+	b.WriteString(dict)
+	b.WriteByte('\n')
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestReadNpy(t *testing.T) {
+	a, err := ReadNpy(bytes.NewReader(npyFile(
+		"{'descr': '>i2', 'fortran_order': True, 'shape': (2, 2), }",
+		[]byte{0, 1, 0, 2, 0, 3, 0, 4})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Ndarray{
+		Shape:        []int{2, 2},
+		Dtype:        &Dtype{Kind: 'i', ItemSize: 2, ByteOrder: '>'},
+		FortranOrder: true,
+		Data:         []byte{0, 1, 0, 2, 0, 3, 0, 4},
+	}
+	if !reflect.DeepEqual(a, expected) {
+		t.Errorf("expected %#v, actual %#v", expected, a)
+	}
+	values, err := a.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []int16{1, 3, 2, 4}) {
+		t.Errorf("unexpected values %v", values)
+	}
+
+	// the headers of Python 2, and zero-dimensional arrays
+	a, err = ReadNpy(bytes.NewReader(npyFile(
+		`{"shape": (), "fortran_order": False, "descr": "|b1"}`, []byte{1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Shape) != 0 || a.Dtype.String() != "|b1" || !bytes.Equal(a.Data, []byte{1}) {
+		t.Errorf("unexpected array %#v", a)
+	}
+	a, err = ReadNpy(bytes.NewReader(npyFile(
+		"{'descr': '<f4', 'fortran_order': False, 'shape': (3L,), }", make([]byte, 12))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a.Shape, []int{3}) {
+		t.Errorf("expected shape [3], actual %v", a.Shape)
+	}
+}
+
+func TestReadNpyErrors(t *testing.T) {
+	for _, tc := range []struct {
+		content []byte
+		err     string
+	}{
+		{[]byte("\x93NUMPX\x01\x00\x00\x00"), "invalid magic string"},
+		{[]byte("\x93NUMPY\x04\x00\x00\x00"), "unsupported format version 4.0"},
+		{npyFile("{'descr': '|O', 'fortran_order': False, 'shape': (1,), }", nil), "unsupported NumPy dtype"},
+		{npyFile("{'descr': [('a', '<f4')], 'fortran_order': False, 'shape': (1,), }", nil), "unsupported descr"},
+		{npyFile("{'descr': '<f4', 'shape': (1,), }", nil), "incomplete header"},
+		{npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2,), }", make([]byte, 7)), "unexpected EOF"},
+	} {
+		_, err := ReadNpy(bytes.NewReader(tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %q, actual %v", tc.err, err)
+		}
+	}
+}
+
+func TestNpyRoundTrip(t *testing.T) {
+	arrays := map[string]*Ndarray{
+		"x": {
+			Shape: []int{2, 3},
+			Dtype: &Dtype{Kind: 'f', ItemSize: 4, ByteOrder: '<'},
+			Data:  make([]byte, 24),
+		},
+		"y": {
+			Shape:        []int{2, 1},
+			Dtype:        &Dtype{Kind: 'u', ItemSize: 1, ByteOrder: '|'},
+			FortranOrder: true,
+			Data:         []byte{7, 8},
+		},
+	}
+	dir := t.TempDir()
+	for key, a := range arrays {
+		var buf bytes.Buffer
+		if err := WriteNpy(&buf, a); err != nil {
+			t.Fatal(err)
+		}
+		if offset := buf.Len() - len(a.Data); offset%npyAlignment != 0 {
+			t.Errorf("%s: unaligned data at %d", key, offset)
+		}
+		filename := path.Join(dir, key+".npy")
+		if err := SaveNpy(filename, a); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadNpy(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, a) {
+			t.Errorf("%s: expected %#v, actual %#v", key, a, loaded)
+		}
+	}
+
+	filename := path.Join(dir, "arrays.npz")
+	if err := SaveNpz(filename, arrays); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadNpz(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, arrays) {
+		t.Errorf("expected %#v, actual %#v", arrays, loaded)
+	}
+
+	_, err = LoadNpz(path.Join(dir, "x.npy"))
+	if err == nil {
+		t.Error("expected an error loading a .npy file as .npz")
+	}
+}
+
+func TestLoadNpzCompressed(t *testing.T) {
+	// as written by "numpy.savez_compressed"
+	filename := path.Join(t.TempDir(), "compressed.npz")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "arr_0.npy", Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := npyFile("{'descr': '<i8', 'fortran_order': False, 'shape': (1,), }",
+		[]byte{42, 0, 0, 0, 0, 0, 0, 0})
+	if _, err := io.Copy(fw, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	arrays, err := LoadNpz(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := arrays["arr_0"].Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []int64{42}) {
+		t.Errorf("unexpected values %v", values)
+	}
+}
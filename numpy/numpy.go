@@ -0,0 +1,45 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package numpy provides a minimal implementation of the NumPy classes and
+functions which are commonly found in pickle data, such as the scalar
+values (numpy.float64, numpy.int64, ...) often stored in PyTorch
+checkpoints alongside the tensors, and the arrays (numpy.ndarray) of the
+pickles of NumPy and scikit-learn.
+
+The same Ndarray type is read from, and written to, the ".npy" and ".npz"
+files of "numpy.save" and "numpy.savez" (see LoadNpy and LoadNpz).
+*/
+package numpy
+
+// FindClass resolves the NumPy classes and functions supported by this
+// package. It reports false for any other module and name, so that it can
+// be easily combined with other class resolvers, for example the FindClass
+// function of a pickle.Unpickler.
+func FindClass(module, name string) (interface{}, bool) {
+	switch module {
+	case "numpy":
+		switch name {
+		case "dtype":
+			return &DtypeClass{}, true
+		case "ndarray":
+			return &NdarrayClass{}, true
+		}
+
+	case "numpy.core.multiarray", "numpy._core.multiarray":
+		switch name {
+		case "scalar":
+			return &Scalar{}, true
+		case "_reconstruct":
+			return &Reconstruct{}, true
+		}
+
+	case "numpy.core.numeric", "numpy._core.numeric":
+		if name == "_frombuffer" {
+			return &FromBuffer{}, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,394 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package numpy
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScalar(t *testing.T) {
+	const dtypeF8 = "cnumpy.core.multiarray\nscalar\nq\x00cnumpy\ndtype\nq\x01" +
+		"X\x02\x00\x00\x00f8q\x02\x89\x88\x87q\x03Rq\x04(K\x03X\x01\x00\x00\x00<q\x05" +
+		"NNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tq\x06b"
+	const dtypeI8 = "cnumpy.core.multiarray\nscalar\nq\x00cnumpy\ndtype\nq\x01" +
+		"X\x02\x00\x00\x00i8q\x02\x89\x88\x87q\x03Rq\x04(K\x03X\x01\x00\x00\x00<q\x05" +
+		"NNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tq\x06b"
+	const dtypeBigEndianF4 = "cnumpy.core.multiarray\nscalar\nq\x00cnumpy\ndtype\nq\x01" +
+		"X\x02\x00\x00\x00f4q\x02\x89\x88\x87q\x03Rq\x04(K\x03X\x01\x00\x00\x00>q\x05" +
+		"NNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tq\x06b"
+
+	testCases := []struct {
+		name     string
+		pickled  string
+		expected interface{}
+	}{
+		// pickle.dumps(numpy.float64(0.5), protocol=2)
+		{"float64 proto 2", "\x80\x02" + dtypeF8 +
+			"c_codecs\nencode\nq\x07X\t\x00\x00\x00\x00\x00\x00\x00\x00\x00\xc3\xa0?q\x08" +
+			"X\x06\x00\x00\x00latin1q\t\x86q\nRq\x0b\x86q\x0cRq\r.", 0.5},
+		// pickle.dumps(numpy.float64(0.5), protocol=3)
+		{"float64 proto 3", "\x80\x03" + dtypeF8 +
+			"C\x08\x00\x00\x00\x00\x00\x00\xe0?q\x07\x86q\x08Rq\t.", 0.5},
+		// pickle.dumps(numpy.int64(42), protocol=2)
+		{"int64 proto 2", "\x80\x02" + dtypeI8 +
+			"c_codecs\nencode\nq\x07X\x08\x00\x00\x00*\x00\x00\x00\x00\x00\x00\x00q\x08" +
+			"X\x06\x00\x00\x00latin1q\t\x86q\nRq\x0b\x86q\x0cRq\r.", int64(42)},
+		// pickle.dumps(numpy.int64(42), protocol=3)
+		{"int64 proto 3", "\x80\x03" + dtypeI8 +
+			"C\x08*\x00\x00\x00\x00\x00\x00\x00q\x07\x86q\x08Rq\t.", int64(42)},
+		// pickle.dumps(numpy.dtype('>f4').type(-1.5), protocol=2)
+		{"big-endian float32", "\x80\x02" + dtypeBigEndianF4 +
+			"c_codecs\nencode\nq\x07X\x06\x00\x00\x00\xc2\xbf\xc3\x80\x00\x00q\x08" +
+			"X\x06\x00\x00\x00latin1q\t\x86q\nRq\x0b\x86q\x0cRq\r.", float32(-1.5)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := loadsNoErr(t, tc.pickled)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %#v, actual %#v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestScalarDataTypes(t *testing.T) {
+	testCases := []struct {
+		dtype    string
+		data     string
+		expected interface{}
+	}{
+		{"|b1", "\x01", true},
+		{"|i1", "\xff", int8(-1)},
+		{"<i2", "\xfe\xff", int16(-2)},
+		{">i4", "\xff\xff\xff\xfd", int32(-3)},
+		{"|u1", "\xc8", uint8(200)},
+		{"<u2", "\x01\x02", uint16(0x0201)},
+		{"<u4", "\x01\x00\x00\x00", uint32(1)},
+		{"<u8", "\xff\xff\xff\xff\xff\xff\xff\xff", uint64(1<<64 - 1)},
+		{"<f2", "\x00<", float32(1)},
+		{">f2", "\xc1\x00", float32(-2.5)},
+		{"<f2", "\x01\x00", float32(1.0 / (1 << 24))}, // smallest subnormal
+		{"<f2", "\x00\xfc", float32(math.Inf(-1))},
+		{"<f4", "\x00\x00\xc0?", float32(1.5)},
+		{"<c8", "\x00\x00\x80?\x00\x00\x00\xc0", complex64(complex(1, -2))},
+		{"<c16", "\x00\x00\x00\x00\x00\x00\xf0?\x00\x00\x00\x00\x00\x00\x00@",
+			complex(1, 2)},
+	}
+	for _, tc := range testCases {
+		dtype, err := parseDtype(tc.dtype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := (&Scalar{}).Call(dtype, types.Bytes(tc.data))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.dtype, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %#v, actual %#v", tc.dtype, tc.expected, actual)
+		}
+	}
+}
+
+func TestScalarErrors(t *testing.T) {
+	f16, _ := parseDtype("<f16")
+	f8, _ := parseDtype("<f8")
+	testCases := []struct {
+		args     []interface{}
+		expected string
+	}{
+		{[]interface{}{f16, types.Bytes(strings.Repeat("\x00", 16))}, "unsupported dtype"},
+		{[]interface{}{f8, types.Bytes("\x00\x00")}, "2 bytes of data"},
+		{[]interface{}{"f8", types.Bytes("")}, "invalid dtype"},
+		{[]interface{}{f8}, "invalid arguments"},
+	}
+	for _, tc := range testCases {
+		_, err := (&Scalar{}).Call(tc.args...)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%#v: expected error containing %q, actual %v",
+				tc.args, tc.expected, err)
+		}
+	}
+}
+
+func loadsNoErr(t *testing.T, s string) interface{} {
+	t.Helper()
+	u := pickle.NewUnpickler(strings.NewReader(s))
+	u.FindClass = func(module, name string) (interface{}, error) {
+		if class, ok := FindClass(module, name); ok {
+			return class, nil
+		}
+		return nil, fmt.Errorf("class not found: %s %s", module, name)
+	}
+	result, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestNdarray(t *testing.T) {
+	const reconstruct = "cnumpy.core.multiarray\n_reconstruct\nq\x00cnumpy\nndarray\nq\x01K\x00\x85q\x02"
+	testCases := []struct {
+		name     string
+		pickled  string
+		shape    []int
+		dtype    string
+		fortran  bool
+		expected interface{}
+	}{
+		// pickle.dumps(numpy.arange(6, dtype='<f4').reshape(2, 3), protocol=2)
+		{"float32 proto 2", "\x80\x02" + reconstruct +
+			"c_codecs\nencode\nq\x03X\x01\x00\x00\x00bq\x04X\x06\x00\x00\x00latin1q\x05\x86q\x06Rq\x07" +
+			"\x87q\x08Rq\x09(K\x01K\x02K\x03\x86q\ncnumpy\ndtype\nq\x0bX\x02\x00\x00\x00f4q\x0c" +
+			"\x89\x88\x87q\x0dRq\x0e(K\x03X\x01\x00\x00\x00<q\x0fNNNJ\xff\xff\xff\xffJ\xff\xff\xff\xff" +
+			"K\x00tq\x10b\x89h\x03X\x1b\x00\x00\x00\x00\x00\x00\x00\x00\x00\xc2\x80?\x00\x00\x00@\x00\x00@@" +
+			"\x00\x00\xc2\x80@\x00\x00\xc2\xa0@q\x11h\x05\x86q\x12Rq\x13tq\x14b.",
+			[]int{2, 3}, "<f4", false, []float32{0, 1, 2, 3, 4, 5}},
+		// pickle.dumps(numpy.arange(6, dtype='<f4').reshape(2, 3), protocol=3)
+		{"float32 proto 3", "\x80\x03" + reconstruct +
+			"C\x01bq\x03\x87q\x04Rq\x05(K\x01K\x02K\x03\x86q\x06cnumpy\ndtype\nq\x07X\x02\x00\x00\x00f4q\x08" +
+			"\x89\x88\x87q\x09Rq\n(K\x03X\x01\x00\x00\x00<q\x0bNNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tq\x0cb" +
+			"\x89C\x18\x00\x00\x00\x00\x00\x00\x80?\x00\x00\x00@\x00\x00@@\x00\x00\x80@\x00\x00\xa0@q\x0dtq\x0eb.",
+			[]int{2, 3}, "<f4", false, []float32{0, 1, 2, 3, 4, 5}},
+		// pickle.dumps(numpy.asfortranarray(numpy.arange(6).reshape(2, 3)), protocol=3)
+		{"Fortran order", "\x80\x03" + reconstruct +
+			"C\x01bq\x03\x87q\x04Rq\x05(K\x01K\x02K\x03\x86q\x06cnumpy\ndtype\nq\x07X\x02\x00\x00\x00i8q\x08" +
+			"\x89\x88\x87q\x09Rq\n(K\x03X\x01\x00\x00\x00<q\x0bNNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tq\x0cb" +
+			"\x88C0\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00" +
+			"\x04\x00\x00\x00\x00\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00\x00\x00\x00\x00q\x0dtq\x0eb.",
+			[]int{2, 3}, "<i8", true, []int64{0, 1, 2, 3, 4, 5}},
+		// pickle.dumps(numpy.array([-1, 2, -3], dtype='>i2'), protocol=3)
+		{"big-endian int16", "\x80\x03" + reconstruct +
+			"C\x01bq\x03\x87q\x04Rq\x05(K\x01K\x03\x85q\x06cnumpy\ndtype\nq\x07X\x02\x00\x00\x00i2q\x08" +
+			"\x89\x88\x87q\x09Rq\n(K\x03X\x01\x00\x00\x00>q\x0bNNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tq\x0cb" +
+			"\x89C\x06\xff\xff\x00\x02\xff\xfdq\x0dtq\x0eb.",
+			[]int{3}, ">i2", false, []int16{-1, 2, -3}},
+		// pickle.dumps(numpy.array(0.5), protocol=3)
+		{"zero-dimensional", "\x80\x03" + reconstruct +
+			"C\x01bq\x03\x87q\x04Rq\x05(K\x01)cnumpy\ndtype\nq\x06X\x02\x00\x00\x00f8q\x07" +
+			"\x89\x88\x87q\x08Rq\x09(K\x03X\x01\x00\x00\x00<q\nNNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00tq\x0bb" +
+			"\x89C\x08\x00\x00\x00\x00\x00\x00\xe0?q\x0ctq\x0db.",
+			[]int{}, "<f8", false, []float64{0.5}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			array, ok := loadsNoErr(t, tc.pickled).(*Ndarray)
+			if !ok {
+				t.Fatalf("expected *Ndarray")
+			}
+			if !reflect.DeepEqual(array.Shape, tc.shape) {
+				t.Errorf("expected shape %v, actual %v", tc.shape, array.Shape)
+			}
+			if array.Dtype.String() != tc.dtype {
+				t.Errorf("expected dtype %s, actual %s", tc.dtype, array.Dtype)
+			}
+			if array.FortranOrder != tc.fortran {
+				t.Errorf("expected Fortran order %v, actual %v", tc.fortran, array.FortranOrder)
+			}
+			values, err := array.Values()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, tc.expected) {
+				t.Errorf("expected values %#v, actual %#v", tc.expected, values)
+			}
+		})
+	}
+}
+
+func TestNdarrayFloat16Values(t *testing.T) {
+	for _, order := range []string{"<", ">"} {
+		f2, _ := parseDtype(order + "f2")
+		halves := []uint16{0x3c00, 0xb800, 0x7bff, 0x0200, 0x7e00}
+		data := make([]byte, 0, 2*len(halves))
+		for _, h := range halves {
+			if order == "<" {
+				data = append(data, byte(h), byte(h>>8))
+			} else {
+				data = append(data, byte(h>>8), byte(h))
+			}
+		}
+		array := &Ndarray{Shape: []int{5}, Dtype: f2, Data: data}
+		values, err := array.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := values.([]float32)
+		expected := []float32{1, -0.5, 65504, 1.0 / (1 << 15)}
+		if !reflect.DeepEqual(actual[:4], expected) {
+			t.Errorf("%s: expected %v, actual %v", order, expected, actual[:4])
+		}
+		if !math.IsNaN(float64(actual[4])) {
+			t.Errorf("%s: expected NaN, actual %v", order, actual[4])
+		}
+	}
+}
+
+func TestNdarrayErrors(t *testing.T) {
+	// pickle.dumps(numpy.array([1, 'a'], dtype=object), protocol=3)
+	const objectArray = "\x80\x03cnumpy.core.multiarray\n_reconstruct\nq\x00cnumpy\nndarray\nq\x01K\x00\x85q\x02" +
+		"C\x01bq\x03\x87q\x04Rq\x05(K\x01K\x02\x85q\x06cnumpy\ndtype\nq\x07X\x02\x00\x00\x00O8q\x08" +
+		"\x89\x88\x87q\x09Rq\n(K\x03X\x01\x00\x00\x00|q\x0bNNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK?tq\x0cb" +
+		"\x89]q\x0d(K\x01X\x01\x00\x00\x00aq\x0eetq\x0fb."
+	u := pickle.NewUnpickler(strings.NewReader(objectArray))
+	u.FindClass = func(module, name string) (interface{}, error) {
+		if class, ok := FindClass(module, name); ok {
+			return class, nil
+		}
+		return nil, fmt.Errorf("class not found: %s %s", module, name)
+	}
+	_, err := u.Load()
+	if err == nil || !strings.Contains(err.Error(), "arrays of Python objects (dtype |O8) are not supported") {
+		t.Errorf("expected object array error, actual %v", err)
+	}
+
+	f4, _ := parseDtype("<f4")
+	shape := &types.Tuple{2, 3}
+	testCases := []struct {
+		state    *types.Tuple
+		expected string
+	}{
+		{&types.Tuple{1, shape, f4, false, types.Bytes("\x00\x00\x00\x00")}, "4 bytes of data for 6 values"},
+		{&types.Tuple{1, &types.Tuple{-1}, f4, false, types.Bytes("")}, "unexpected shape"},
+		{&types.Tuple{1, shape, "f4", false, types.Bytes("")}, "unexpected dtype"},
+		{&types.Tuple{1, shape}, "unexpected state"},
+	}
+	for _, tc := range testCases {
+		err := (&Ndarray{}).PySetState(tc.state)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%#v: expected error containing %q, actual %v",
+				tc.state, tc.expected, err)
+		}
+	}
+
+	u2, _ := parseDtype("<U2")
+	_, err = (&Ndarray{Shape: []int{1}, Dtype: u2, Data: make([]byte, 2)}).Values()
+	if err == nil || !strings.Contains(err.Error(), "unsupported dtype <U2") {
+		t.Errorf("expected unsupported dtype error, actual %v", err)
+	}
+}
+
+func TestFromBuffer(t *testing.T) {
+	const frombuffer = "\x8c\x12numpy.core.numeric\x94\x8c\x0b_frombuffer\x94\x93\x94("
+	const f4 = "\x8c\x05numpy\x94\x8c\x05dtype\x94\x93\x94\x8c\x02f4\x94\x89\x88\x87\x94R\x94" +
+		"(K\x03\x8c\x01<\x94NNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00t\x94b"
+	float32Data := "\x00\x00\x00\x00\x00\x00\x80?\x00\x00\x00@\x00\x00@@\x00\x00\x80@\x00\x00\xa0@"
+	testCases := []struct {
+		name     string
+		pickled  string
+		buffers  [][]byte
+		shape    []int
+		dtype    string
+		fortran  bool
+		expected interface{}
+	}{
+		// pickle.dumps(numpy.arange(6, dtype='<f4').reshape(2, 3), protocol=5)
+		{"in-band", "\x80\x05\x95\x8d\x00\x00\x00\x00\x00\x00\x00" + frombuffer +
+			"\x96\x18\x00\x00\x00\x00\x00\x00\x00" + float32Data + "\x94" + f4 +
+			"K\x02K\x03\x86\x94\x8c\x01C\x94t\x94R\x94.",
+			nil, []int{2, 3}, "<f4", false, []float32{0, 1, 2, 3, 4, 5}},
+		// pickle.dumps(numpy.asfortranarray(numpy.arange(6).reshape(2, 3)), protocol=5)
+		{"Fortran order", "\x80\x05\x95\xa5\x00\x00\x00\x00\x00\x00\x00" + frombuffer +
+			"\x960\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00" +
+			"\x01\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00" +
+			"\x05\x00\x00\x00\x00\x00\x00\x00\x94\x8c\x05numpy\x94\x8c\x05dtype\x94\x93\x94\x8c\x02i8\x94" +
+			"\x89\x88\x87\x94R\x94(K\x03\x8c\x01<\x94NNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00t\x94b" +
+			"K\x02K\x03\x86\x94\x8c\x01F\x94t\x94R\x94.",
+			nil, []int{2, 3}, "<i8", true, []int64{0, 1, 2, 3, 4, 5}},
+		// pickle.dumps(numpy.arange(6, dtype='<f4').reshape(2, 3), protocol=5,
+		//              buffer_callback=buffers.append)
+		{"out-of-band", "\x80\x05\x95l\x00\x00\x00\x00\x00\x00\x00" + frombuffer + "\x97" + f4 +
+			"K\x02K\x03\x86\x94\x8c\x01C\x94t\x94R\x94.",
+			[][]byte{[]byte(float32Data)}, []int{2, 3}, "<f4", false, []float32{0, 1, 2, 3, 4, 5}},
+		// a = numpy.array([-1, 2, -3], dtype='>i2'); a.flags.writeable = False
+		// pickle.dumps(a, protocol=5, buffer_callback=buffers.append)
+		{"read-only out-of-band", "\x80\x05\x95k\x00\x00\x00\x00\x00\x00\x00" + frombuffer +
+			"\x97\x98\x8c\x05numpy\x94\x8c\x05dtype\x94\x93\x94\x8c\x02i2\x94\x89\x88\x87\x94R\x94" +
+			"(K\x03\x8c\x01>\x94NNNJ\xff\xff\xff\xffJ\xff\xff\xff\xffK\x00t\x94bK\x03\x85\x94\x8c\x01C\x94t\x94R\x94.",
+			[][]byte{[]byte("\xff\xff\x00\x02\xff\xfd")}, []int{3}, ">i2", false, []int16{-1, 2, -3}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := pickle.NewUnpickler(strings.NewReader(tc.pickled))
+			u.FindClass = func(module, name string) (interface{}, error) {
+				if class, ok := FindClass(module, name); ok {
+					return class, nil
+				}
+				return nil, fmt.Errorf("class not found: %s %s", module, name)
+			}
+			u.SetBuffers(tc.buffers)
+			result, err := u.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			array, ok := result.(*Ndarray)
+			if !ok {
+				t.Fatalf("expected *Ndarray, actual %#v", result)
+			}
+			if !reflect.DeepEqual(array.Shape, tc.shape) {
+				t.Errorf("expected shape %v, actual %v", tc.shape, array.Shape)
+			}
+			if array.Dtype.String() != tc.dtype {
+				t.Errorf("expected dtype %s, actual %s", tc.dtype, array.Dtype)
+			}
+			if array.FortranOrder != tc.fortran {
+				t.Errorf("expected Fortran order %v, actual %v", tc.fortran, array.FortranOrder)
+			}
+			values, err := array.Values()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, tc.expected) {
+				t.Errorf("expected values %#v, actual %#v", tc.expected, values)
+			}
+		})
+	}
+
+	t.Run("shared buffer", func(t *testing.T) {
+		buf := types.ByteArray(float32Data)
+		f4Type, _ := parseDtype("<f4")
+		result, err := (&FromBuffer{}).Call(&buf, f4Type, &types.Tuple{6}, "C")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf[0] = 0xff
+		if data := result.(*Ndarray).Data; data[0] != 0xff {
+			t.Error("expected the array to share the bytes of the buffer")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		buf := types.ByteArray(float32Data)
+		f4Type, _ := parseDtype("<f4")
+		testCases := []struct {
+			args     []interface{}
+			expected string
+		}{
+			{[]interface{}{&buf, f4Type, &types.Tuple{6}}, "invalid arguments"},
+			{[]interface{}{"data", f4Type, &types.Tuple{6}, "C"}, "invalid data"},
+			{[]interface{}{&buf, "f4", &types.Tuple{6}, "C"}, "unexpected dtype"},
+			{[]interface{}{&buf, f4Type, 6, "C"}, "unexpected shape"},
+			{[]interface{}{&buf, f4Type, &types.Tuple{6}, "A"}, "unexpected order"},
+			{[]interface{}{&buf, f4Type, &types.Tuple{5}, "C"}, "24 bytes of data for 5 values"},
+		}
+		for _, tc := range testCases {
+			_, err := (&FromBuffer{}).Call(tc.args...)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("%#v: expected error containing %q, actual %v",
+					tc.args, tc.expected, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package numpy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"math"
+)
+
+// Scalar represents the "numpy.core.multiarray.scalar" function, which
+// NumPy uses for pickling scalar values, such as numpy.float64(0.5), as
+// the pair of their data type and raw bytes.
+//
+// The result is the corresponding Go scalar: float32 or float64 for
+// floating point numbers, int8 to int64 and uint8 to uint64 for integers,
+// bool for booleans, and complex64 or complex128 for complex numbers.
+// Half precision numbers (numpy.float16), which have no Go type, are
+// converted to float32, exactly.
+type Scalar struct{}
+
+var _ types.Callable = &Scalar{}
+
+// Call decodes a scalar value given its *Dtype and data, which can be a
+// types.Bytes or, as pickled by Python 2, a string.
+func (*Scalar) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("Scalar: invalid arguments: %#v", args)
+	}
+	dtype, ok := args[0].(*Dtype)
+	if !ok {
+		return nil, fmt.Errorf("Scalar: invalid dtype: %#v", args[0])
+	}
+	var data []byte
+	switch v := args[1].(type) {
+	case types.Bytes:
+		data = v.Bytes()
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("Scalar: invalid data: %#v", args[1])
+	}
+	if len(data) != dtype.ItemSize {
+		return nil, fmt.Errorf("Scalar: %d bytes of data for dtype %v",
+			len(data), dtype)
+	}
+	return decodeScalar(dtype, data)
+}
+
+func decodeScalar(dtype *Dtype, data []byte) (interface{}, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if dtype.ByteOrder == '>' {
+		order = binary.BigEndian
+	}
+
+	switch dtype.Kind {
+	case 'b':
+		if dtype.ItemSize == 1 {
+			return data[0] != 0, nil
+		}
+	case 'i':
+		switch dtype.ItemSize {
+		case 1:
+			return int8(data[0]), nil
+		case 2:
+			return int16(order.Uint16(data)), nil
+		case 4:
+			return int32(order.Uint32(data)), nil
+		case 8:
+			return int64(order.Uint64(data)), nil
+		}
+	case 'u':
+		switch dtype.ItemSize {
+		case 1:
+			return data[0], nil
+		case 2:
+			return order.Uint16(data), nil
+		case 4:
+			return order.Uint32(data), nil
+		case 8:
+			return order.Uint64(data), nil
+		}
+	case 'f':
+		switch dtype.ItemSize {
+		case 2:
+			return halfToFloat32(order.Uint16(data)), nil
+		case 4:
+			return math.Float32frombits(order.Uint32(data)), nil
+		case 8:
+			return math.Float64frombits(order.Uint64(data)), nil
+		}
+	case 'c':
+		switch dtype.ItemSize {
+		case 8:
+			return complex(
+				math.Float32frombits(order.Uint32(data)),
+				math.Float32frombits(order.Uint32(data[4:]))), nil
+		case 16:
+			return complex(
+				math.Float64frombits(order.Uint64(data)),
+				math.Float64frombits(order.Uint64(data[8:]))), nil
+		}
+	}
+	return nil, fmt.Errorf("Scalar: unsupported dtype %v", dtype)
+}
+
+// halfToFloat32 converts the bits of an IEEE 754 half precision number to
+// the float32 of the same value.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mantissa := uint32(h & 0x3ff)
+	switch exp {
+	case 0: // zero or subnormal: mantissa * 2^-24
+		f := float32(mantissa) / (1 << 24)
+		return math.Float32frombits(math.Float32bits(f) | sign)
+	case 0x1f: // Inf or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mantissa<<13)
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mantissa<<13)
+	}
+}
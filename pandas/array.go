@@ -0,0 +1,188 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pandas
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/numpy"
+	"github.com/nlpodyssey/gopickle/types"
+	"strings"
+)
+
+// Array is a NumPy array made by "numpy.core.multiarray._reconstruct",
+// which, unlike a numpy.Ndarray, may hold Python objects (dtype "O"), as
+// the columns of strings of a DataFrame.
+type Array struct {
+	numpy.Ndarray
+	// Objects are the values of an array of Python objects, in row-major
+	// (C) order, for which the Data is nil.
+	Objects []interface{}
+}
+
+var _ types.PyStateSettable = &Array{}
+
+// PySetState sets the shape, data type and values of the array from its
+// pickled state, as numpy.Ndarray.PySetState, which, for the arrays of
+// Python objects, has the list of the objects in place of the data.
+func (a *Array) PySetState(state interface{}) error {
+	t, ok := state.(*types.Tuple)
+	if !ok || (t.Len() != 4 && t.Len() != 5) {
+		return a.Ndarray.PySetState(state)
+	}
+	items := []interface{}(*t)
+	if len(items) == 5 {
+		items = items[1:]
+	}
+	dtype, ok := items[1].(*numpy.Dtype)
+	if !ok || dtype.Kind != 'O' {
+		return a.Ndarray.PySetState(state)
+	}
+
+	shape, ok := parseShape(items[0])
+	if !ok {
+		return fmt.Errorf("Array: unexpected shape %#v", items[0])
+	}
+	fortranOrder, ok := items[2].(bool)
+	if !ok {
+		return fmt.Errorf("Array: unexpected Fortran order flag %#v", items[2])
+	}
+	list, ok := items[3].(*types.List)
+	if !ok {
+		return fmt.Errorf("Array: invalid objects: %#v", items[3])
+	}
+	a.Shape = shape
+	a.Dtype = dtype
+	if list.Len() != a.Size() {
+		return fmt.Errorf("Array: %d objects for %d values", list.Len(), a.Size())
+	}
+	a.Objects = []interface{}(*list)
+	if fortranOrder {
+		a.Objects = fortranToC(a.Objects, shape)
+	}
+	return nil
+}
+
+// Values returns the values of the array as numpy.Ndarray.Values, except
+// for the arrays of Python objects, whose values are the Objects, and for
+// the datetime64 and timedelta64 arrays, whose values are returned as
+// []int64.
+func (a *Array) Values() (interface{}, error) {
+	if a.Dtype != nil && a.Dtype.Kind == 'O' {
+		return a.Objects, nil
+	}
+	return ndarrayValues(&a.Ndarray)
+}
+
+// ndarrayValues returns the values of a numpy.Ndarray, reading those of
+// the datetime64 and timedelta64 arrays as integers.
+func ndarrayValues(a *numpy.Ndarray) (interface{}, error) {
+	if a.Dtype != nil && (a.Dtype.Kind == 'M' || a.Dtype.Kind == 'm') {
+		ints := *a
+		ints.Dtype = &numpy.Dtype{Kind: 'i', ItemSize: a.Dtype.ItemSize, ByteOrder: a.Dtype.ByteOrder}
+		return ints.Values()
+	}
+	return a.Values()
+}
+
+// arrayValues returns the values and the shape of an unpickled NumPy
+// array, or false if v is not an array, or its dtype is not supported.
+func arrayValues(v interface{}) (interface{}, []int, bool) {
+	var values interface{}
+	var shape []int
+	var err error
+	switch a := v.(type) {
+	case *Array:
+		values, err = a.Values()
+		shape = a.Shape
+	case *numpy.Ndarray:
+		values, err = ndarrayValues(a)
+		shape = a.Shape
+	default:
+		return nil, nil, false
+	}
+	if err != nil {
+		return nil, nil, false
+	}
+	return values, shape, true
+}
+
+// fortranToC reorders in row-major (C) order the values of an array of the
+// given shape, which are in column-major (Fortran) order.
+func fortranToC(values []interface{}, shape []int) []interface{} {
+	if len(shape) < 2 {
+		return values
+	}
+	cValues := make([]interface{}, len(values))
+	cStrides := make([]int, len(shape))
+	stride := 1
+	for d := len(shape) - 1; d >= 0; d-- {
+		cStrides[d] = stride
+		stride *= shape[d]
+	}
+	index := make([]int, len(shape))
+	for _, v := range values {
+		pos := 0
+		for d, idx := range index {
+			pos += idx * cStrides[d]
+		}
+		cValues[pos] = v
+		for d := range index {
+			index[d]++
+			if index[d] < shape[d] {
+				break
+			}
+			index[d] = 0
+		}
+	}
+	return cValues
+}
+
+// parseShape returns the sizes of a pickled shape tuple.
+func parseShape(v interface{}) ([]int, bool) {
+	t, ok := v.(*types.Tuple)
+	if !ok {
+		return nil, false
+	}
+	shape := make([]int, t.Len())
+	for i := range shape {
+		s, ok := toInt64(t.Get(i))
+		if !ok || s < 0 {
+			return nil, false
+		}
+		shape[i] = int(s)
+	}
+	return shape, true
+}
+
+// reconstruct represents the "numpy.core.multiarray._reconstruct"
+// function, as numpy.Reconstruct, but making an empty Array.
+type reconstruct struct{}
+
+var _ types.Callable = &reconstruct{}
+
+func (*reconstruct) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("Reconstruct: invalid arguments: %#v", args)
+	}
+	return &Array{}, nil
+}
+
+// dtypeClass represents the "numpy.dtype" class, as numpy.DtypeClass, but
+// also accepting the datetime64 and timedelta64 types, such as "M8[ns]",
+// whose unit is dropped.
+type dtypeClass struct {
+	numpy.DtypeClass
+}
+
+func (c *dtypeClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) > 0 {
+		if s, ok := args[0].(string); ok {
+			if i := strings.IndexByte(s, '['); i > 0 && strings.HasSuffix(s, "]") {
+				args = append([]interface{}{s[:i]}, args[1:]...)
+			}
+		}
+	}
+	return c.DtypeClass.Call(args...)
+}
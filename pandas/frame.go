@@ -0,0 +1,179 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pandas
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// DataFrame represents a pandas DataFrame ("pandas.DataFrame"), with the
+// values of each column in a typed slice.
+type DataFrame struct {
+	// Columns is the index of the labels of the columns.
+	Columns *Index
+	// Index is the index of the labels of the rows.
+	Index *Index
+	// Data are the values of the columns, in the order of the Columns.
+	// Each of them is a typed slice, such as []float64 or []interface{},
+	// with a value for each row, or the unpickled values of a column which
+	// could not be converted (see the package documentation).
+	Data []interface{}
+	// Attrs are the global attributes of the DataFrame ("DataFrame.attrs"),
+	// or nil.
+	Attrs *types.Dict
+	// Manager is the block manager the Data comes from.
+	Manager *BlockManager
+}
+
+var _ types.PyStateSettable = &DataFrame{}
+
+// PySetState sets the columns, index and data of the DataFrame from the
+// block manager of its pickled state dict.
+func (df *DataFrame) PySetState(state interface{}) error {
+	mgr, attrs, _, err := parseFrameState(state)
+	if err != nil {
+		return fmt.Errorf("DataFrame: %w", err)
+	}
+	if len(mgr.Axes) != 2 {
+		return fmt.Errorf("DataFrame: expected 2 axes, actual %d", len(mgr.Axes))
+	}
+	data, err := mgr.columns()
+	if err != nil {
+		return fmt.Errorf("DataFrame: %w", err)
+	}
+	if n := mgr.Axes[0].Len(); n >= 0 && n != len(data) {
+		return fmt.Errorf("DataFrame: %d columns for %d labels", len(data), n)
+	}
+	df.Columns = mgr.Axes[0]
+	df.Index = mgr.Axes[1]
+	df.Data = data
+	df.Attrs = attrs
+	df.Manager = mgr
+	return nil
+}
+
+// Len returns the number of rows of the DataFrame, or -1 if unknown.
+func (df *DataFrame) Len() int {
+	return df.Index.Len()
+}
+
+// Column returns the values of the column with the given label, and
+// whether it was found.
+func (df *DataFrame) Column(label interface{}) (interface{}, bool) {
+	for i, l := range df.Columns.Labels() {
+		if l == label && i < len(df.Data) {
+			return df.Data[i], true
+		}
+	}
+	return nil, false
+}
+
+// ColumnMap returns the values of the columns by their labels, formatted
+// with fmt.Sprint, unless they are strings.
+func (df *DataFrame) ColumnMap() map[string]interface{} {
+	labels := df.Columns.Labels()
+	m := make(map[string]interface{}, len(labels))
+	for i, l := range labels {
+		if i >= len(df.Data) {
+			break
+		}
+		name, ok := l.(string)
+		if !ok {
+			name = fmt.Sprint(l)
+		}
+		m[name] = df.Data[i]
+	}
+	return m
+}
+
+// DataFrameClass represents the "pandas.core.frame.DataFrame" class.
+type DataFrameClass struct{}
+
+var _ types.PyNewable = &DataFrameClass{}
+
+// PyNew returns a new empty *DataFrame, whose content is then set by
+// DataFrame.PySetState.
+func (*DataFrameClass) PyNew(args ...interface{}) (interface{}, error) {
+	return &DataFrame{}, nil
+}
+
+// Series represents a pandas Series ("pandas.Series").
+type Series struct {
+	// Name is the name of the Series, or nil.
+	Name interface{}
+	// Index is the index of the labels of the values.
+	Index *Index
+	// Values are the values, converted as the columns of a DataFrame.
+	Values interface{}
+	// Attrs are the global attributes of the Series ("Series.attrs"), or
+	// nil.
+	Attrs *types.Dict
+}
+
+var _ types.PyStateSettable = &Series{}
+
+// PySetState sets the name, index and values of the Series from the
+// single block manager of its pickled state dict.
+func (s *Series) PySetState(state interface{}) error {
+	mgr, attrs, d, err := parseFrameState(state)
+	if err != nil {
+		return fmt.Errorf("Series: %w", err)
+	}
+	if len(mgr.Axes) != 1 || len(mgr.Blocks) != 1 {
+		return fmt.Errorf("Series: expected 1 axis and 1 block, actual %d and %d",
+			len(mgr.Axes), len(mgr.Blocks))
+	}
+	block := mgr.Blocks[0]
+	values, _, ok := arrayValues(block.Values)
+	if !ok {
+		values = block.Values
+	}
+	s.Name, _ = d.Get("_name")
+	if s.Name == nil {
+		s.Name, _ = d.Get("name")
+	}
+	s.Index = mgr.Axes[0]
+	s.Values = values
+	s.Attrs = attrs
+	return nil
+}
+
+// Len returns the number of values of the Series, or -1 if unknown.
+func (s *Series) Len() int {
+	return s.Index.Len()
+}
+
+// SeriesClass represents the "pandas.core.series.Series" class.
+type SeriesClass struct{}
+
+var _ types.PyNewable = &SeriesClass{}
+
+// PyNew returns a new empty *Series, whose content is then set by
+// Series.PySetState.
+func (*SeriesClass) PyNew(args ...interface{}) (interface{}, error) {
+	return &Series{}, nil
+}
+
+// parseFrameState returns the block manager and the attrs of the pickled
+// state dict of a DataFrame or a Series, along with the dict itself. The
+// block manager is "_data", rather than "_mgr", before pandas 1.1.
+func parseFrameState(state interface{}) (*BlockManager, *types.Dict, *types.Dict, error) {
+	d, ok := state.(*types.Dict)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported state %#v", state)
+	}
+	v, ok := d.Get("_mgr")
+	if !ok {
+		v, _ = d.Get("_data")
+	}
+	mgr, ok := v.(*BlockManager)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unexpected block manager %#v", v)
+	}
+	attrs, _ := d.Get("attrs")
+	attrsDict, _ := attrs.(*types.Dict)
+	return mgr, attrsDict, d, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pandas
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"reflect"
+)
+
+// Index represents a pandas index ("pandas.Index"), or any of its
+// subclasses, holding the labels of the rows or of the columns of a
+// DataFrame, or of the values of a Series.
+type Index struct {
+	// Class is the name of the class of the index, such as "Index",
+	// "RangeIndex" or "DatetimeIndex".
+	Class string
+	// Name is the name of the index, or nil.
+	Name interface{}
+	// Values are the labels, converted as the columns of a DataFrame:
+	// []int64 for a RangeIndex, []interface{} for the strings. They are
+	// nil if they could not be converted, as for a MultiIndex, whose
+	// levels and codes are left in the Attributes.
+	Values interface{}
+	// Attributes are the pickled attributes of the index, such as "data"
+	// and "name".
+	Attributes *types.Dict
+}
+
+// Len returns the number of labels of the index, or -1 if unknown.
+func (i *Index) Len() int {
+	if i.Values == nil {
+		return -1
+	}
+	v := reflect.ValueOf(i.Values)
+	if v.Kind() != reflect.Slice {
+		return -1
+	}
+	return v.Len()
+}
+
+// Labels returns the labels of the index, one per value, or nil if
+// unknown.
+func (i *Index) Labels() []interface{} {
+	if i.Values == nil {
+		return nil
+	}
+	if labels, ok := i.Values.([]interface{}); ok {
+		return labels
+	}
+	v := reflect.ValueOf(i.Values)
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+	labels := make([]interface{}, v.Len())
+	for j := range labels {
+		labels[j] = v.Index(j).Interface()
+	}
+	return labels
+}
+
+// IndexClass represents any of the pandas index classes, such as
+// "pandas.core.indexes.base.Index" or
+// "pandas.core.indexes.range.RangeIndex", which are given to NewIndex.
+type IndexClass struct {
+	Name string
+}
+
+// NewIndex represents the "pandas.core.indexes.base._new_Index" function,
+// which pandas uses for pickling the indices, and
+// "pandas.core.indexes.datetimes._new_DatetimeIndex", which works the same.
+type NewIndex struct{}
+
+var _ types.Callable = &NewIndex{}
+
+// Call returns a new *Index, given the index class and the dict of its
+// attributes.
+func (*NewIndex) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("NewIndex: invalid arguments: %#v", args)
+	}
+	var class string
+	switch c := args[0].(type) {
+	case *IndexClass:
+		class = c.Name
+	case *types.GenericClass:
+		class = c.Name
+	default:
+		return nil, fmt.Errorf("NewIndex: unexpected class %#v", args[0])
+	}
+	d, ok := args[1].(*types.Dict)
+	if !ok {
+		return nil, fmt.Errorf("NewIndex: unexpected attributes %#v", args[1])
+	}
+	index := &Index{Class: class, Attributes: d}
+	index.Name, _ = d.Get("name")
+
+	if data, ok := d.Get("data"); ok {
+		if values, _, ok := arrayValues(data); ok {
+			index.Values = values
+		}
+		return index, nil
+	}
+	if class == "RangeIndex" {
+		values, err := rangeValues(d)
+		if err != nil {
+			return nil, err
+		}
+		index.Values = values
+	}
+	return index, nil
+}
+
+// rangeValues returns the labels of a RangeIndex, from the start, stop and
+// step of its attributes.
+func rangeValues(d *types.Dict) ([]int64, error) {
+	var r [3]int64
+	for i, key := range []string{"start", "stop", "step"} {
+		v, _ := d.Get(key)
+		n, ok := toInt64(v)
+		if !ok {
+			return nil, fmt.Errorf("NewIndex: unexpected RangeIndex %s %#v", key, v)
+		}
+		r[i] = n
+	}
+	start, stop, step := r[0], r[1], r[2]
+	if step == 0 {
+		return nil, fmt.Errorf("NewIndex: RangeIndex step must not be zero")
+	}
+	values := make([]int64, 0)
+	for v := start; (step > 0 && v < stop) || (step < 0 && v > stop); v += step {
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// toInt64 returns the value of an unpickled integer.
+func toInt64(v interface{}) (int64, bool) {
+	switch i := v.(type) {
+	case int:
+		return int64(i), true
+	case int64:
+		return i, true
+	default:
+		return 0, false
+	}
+}
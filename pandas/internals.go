@@ -0,0 +1,266 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pandas
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"reflect"
+)
+
+// Block represents a block of a pandas block manager, which holds the
+// values of some columns of a DataFrame, of the same dtype, or the values
+// of a Series.
+type Block struct {
+	// Values are the unpickled values of the block: usually a 2-D array,
+	// with a row for each of its columns, or a 1-D array, or an extension
+	// array, for a single column.
+	Values interface{}
+	// Placement are the positions of the columns of the block, among the
+	// items of the block manager.
+	Placement []int
+}
+
+// UnpickleBlock represents the "pandas._libs.internals._unpickle_block"
+// function, which pandas uses for pickling the blocks of the managers
+// reduced to their blocks and axes.
+type UnpickleBlock struct{}
+
+var _ types.Callable = &UnpickleBlock{}
+
+// Call returns a new *Block, given its values, its placement indexer and
+// its number of dimensions.
+func (*UnpickleBlock) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("UnpickleBlock: invalid arguments: %#v", args)
+	}
+	return newBlock(args[0], args[1])
+}
+
+// newBlock returns a new Block, given its values and its placement
+// indexer, which is either a slice or an array of integers.
+func newBlock(values, indexer interface{}) (*Block, error) {
+	var placement []int
+	switch p := indexer.(type) {
+	case *types.Slice:
+		start, ok1 := optionalInt(p.Start, 0)
+		stop, ok2 := toInt64(p.Stop)
+		step, ok3 := optionalInt(p.Step, 1)
+		if !ok1 || !ok2 || !ok3 || step <= 0 {
+			return nil, fmt.Errorf("pandas: unsupported block placement %v", p)
+		}
+		for i := start; i < stop; i += step {
+			placement = append(placement, int(i))
+		}
+	default:
+		ints, _, ok := arrayValues(indexer)
+		if !ok {
+			return nil, fmt.Errorf("pandas: unsupported block placement %#v", indexer)
+		}
+		iv := reflect.ValueOf(ints)
+		if iv.Kind() != reflect.Slice || iv.Type().Elem().Kind() != reflect.Int64 {
+			return nil, fmt.Errorf("pandas: unsupported block placement %#v", indexer)
+		}
+		placement = make([]int, iv.Len())
+		for i := range placement {
+			placement[i] = int(iv.Index(i).Int())
+		}
+	}
+	return &Block{Values: values, Placement: placement}, nil
+}
+
+// optionalInt returns the value of an unpickled integer, or the default
+// value for None.
+func optionalInt(v interface{}, defaultValue int64) (int64, bool) {
+	if v == nil {
+		return defaultValue, true
+	}
+	return toInt64(v)
+}
+
+// BlockManager represents a pandas block manager
+// ("pandas.core.internals.managers.BlockManager"), which holds the blocks
+// of values of a DataFrame, or, as a "SingleBlockManager", the single
+// block of a Series.
+type BlockManager struct {
+	// Axes are the indices of the manager: the columns and the index of
+	// the rows for a DataFrame, only the index for a Series.
+	Axes   []*Index
+	Blocks []*Block
+}
+
+var _ types.PyStateSettable = &BlockManager{}
+
+// PySetState sets the axes and the blocks of the manager from its pickled
+// state, as written by pandas 1.2 and earlier, whose fourth element is a
+// dict with the state of version "0.14.1" of pandas.
+func (m *BlockManager) PySetState(state interface{}) error {
+	t, ok := state.(*types.Tuple)
+	if !ok || t.Len() < 4 {
+		return fmt.Errorf("BlockManager: unsupported state %#v", state)
+	}
+	extra, ok := t.Get(3).(*types.Dict)
+	if !ok {
+		return fmt.Errorf("BlockManager: unsupported state %#v", state)
+	}
+	v, _ := extra.Get("0.14.1")
+	d, ok := v.(*types.Dict)
+	if !ok {
+		return fmt.Errorf("BlockManager: unsupported state %#v", state)
+	}
+	axes, _ := d.Get("axes")
+	if err := m.setAxes(axes); err != nil {
+		return err
+	}
+	v, _ = d.Get("blocks")
+	blocks, ok := v.(*types.List)
+	if !ok {
+		return fmt.Errorf("BlockManager: unexpected blocks %#v", v)
+	}
+	for _, b := range *blocks {
+		bd, ok := b.(*types.Dict)
+		if !ok {
+			return fmt.Errorf("BlockManager: unexpected block %#v", b)
+		}
+		values, _ := bd.Get("values")
+		locs, _ := bd.Get("mgr_locs")
+		block, err := newBlock(values, locs)
+		if err != nil {
+			return err
+		}
+		m.Blocks = append(m.Blocks, block)
+	}
+	return nil
+}
+
+// setAxes sets the axes of the manager from a list of indices.
+func (m *BlockManager) setAxes(v interface{}) error {
+	var axes []interface{}
+	switch a := v.(type) {
+	case *types.List:
+		axes = *a
+	case *types.Tuple:
+		axes = *a
+	default:
+		return fmt.Errorf("BlockManager: unexpected axes %#v", v)
+	}
+	m.Axes = make([]*Index, len(axes))
+	for i, axis := range axes {
+		index, ok := axis.(*Index)
+		if !ok {
+			return fmt.Errorf("BlockManager: unexpected axis %#v", axis)
+		}
+		m.Axes[i] = index
+	}
+	return nil
+}
+
+// columns returns the values of the columns held by the blocks of the
+// manager, in their order, converted as described in the package
+// documentation.
+func (m *BlockManager) columns() ([]interface{}, error) {
+	n := 0
+	for _, b := range m.Blocks {
+		n += len(b.Placement)
+	}
+	columns := make([]interface{}, n)
+	filled := make([]bool, n)
+	for _, b := range m.Blocks {
+		values, err := blockColumns(b)
+		if err != nil {
+			return nil, err
+		}
+		for i, pos := range b.Placement {
+			if pos < 0 || pos >= n || filled[pos] {
+				return nil, fmt.Errorf("pandas: invalid block placement %v", b.Placement)
+			}
+			columns[pos] = values[i]
+			filled[pos] = true
+		}
+	}
+	return columns, nil
+}
+
+// blockColumns returns the values of each of the columns of a block: a
+// row of its 2-D array, or its whole values, for a single column.
+func blockColumns(b *Block) ([]interface{}, error) {
+	values, shape, ok := arrayValues(b.Values)
+	if !ok || len(shape) < 2 {
+		if len(b.Placement) != 1 {
+			return nil, fmt.Errorf("pandas: invalid values for the %d columns of a block: %T",
+				len(b.Placement), b.Values)
+		}
+		if !ok {
+			values = b.Values
+		}
+		return []interface{}{values}, nil
+	}
+	if len(shape) != 2 || shape[0] != len(b.Placement) {
+		return nil, fmt.Errorf("pandas: invalid shape %v for the %d columns of a block",
+			shape, len(b.Placement))
+	}
+	rows := reflect.ValueOf(values)
+	n := shape[1]
+	columns := make([]interface{}, shape[0])
+	for i := range columns {
+		columns[i] = rows.Slice3(i*n, (i+1)*n, (i+1)*n).Interface()
+	}
+	return columns, nil
+}
+
+// BlockManagerClass represents the "BlockManager" and "SingleBlockManager"
+// classes of pandas.
+type BlockManagerClass struct {
+	// Single is true for the "SingleBlockManager" class.
+	Single bool
+}
+
+var _ types.Callable = &BlockManagerClass{}
+var _ types.PyNewable = &BlockManagerClass{}
+
+// Call returns a new *BlockManager, given its blocks and axes, as pickled
+// by pandas 1.3 and later: a tuple of blocks and a list of axes, or the
+// single block and the index of a "SingleBlockManager".
+func (c *BlockManagerClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("BlockManagerClass: invalid arguments: %#v", args)
+	}
+	m := &BlockManager{}
+	if block, ok := args[0].(*Block); ok {
+		index, ok := args[1].(*Index)
+		if !ok {
+			return nil, fmt.Errorf("BlockManagerClass: unexpected axis %#v", args[1])
+		}
+		m.Axes = []*Index{index}
+		m.Blocks = []*Block{block}
+		return m, nil
+	}
+	var blocks []interface{}
+	switch b := args[0].(type) {
+	case *types.Tuple:
+		blocks = *b
+	case *types.List:
+		blocks = *b
+	default:
+		return nil, fmt.Errorf("BlockManagerClass: unexpected blocks %#v", args[0])
+	}
+	for _, b := range blocks {
+		block, ok := b.(*Block)
+		if !ok {
+			return nil, fmt.Errorf("BlockManagerClass: unexpected block %#v", b)
+		}
+		m.Blocks = append(m.Blocks, block)
+	}
+	if err := m.setAxes(args[1]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PyNew returns a new empty *BlockManager, whose axes and blocks are then
+// set by BlockManager.PySetState.
+func (c *BlockManagerClass) PyNew(args ...interface{}) (interface{}, error) {
+	return &BlockManager{}, nil
+}
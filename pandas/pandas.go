@@ -0,0 +1,170 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package pandas provides a best-effort reconstruction of the pandas
+DataFrame and Series objects pickled by "DataFrame.to_pickle" and
+"Series.to_pickle", building on the NumPy arrays of the numpy package.
+
+The columns are turned into typed slices, such as []float64, []int64 or
+[]bool, with []interface{} for the columns of Python objects, like the
+strings, and []int64 for the datetime64 and timedelta64 values, in the
+unit of their dtype. The arrays which cannot be converted, such as the
+pandas extension arrays of categorical or nullable values, are kept as
+they are unpickled.
+
+Both the layout of pandas 1.3 and later, whose block managers are reduced
+to their blocks and axes, and the older one, whose block managers have a
+state, are supported.
+*/
+package pandas
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/numpy"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// FindClass resolves the pandas classes and functions supported by this
+// package, and the NumPy ones of the numpy package, except for the arrays
+// made by "numpy.core.multiarray._reconstruct", which are resolved as
+// Array values, so that they can hold Python objects. As numpy.FindClass,
+// it reports false for any other module and name.
+func FindClass(module, name string) (interface{}, bool) {
+	switch module {
+	case "pandas.core.frame":
+		if name == "DataFrame" {
+			return &DataFrameClass{}, true
+		}
+
+	case "pandas.core.series":
+		if name == "Series" {
+			return &SeriesClass{}, true
+		}
+
+	case "pandas.core.internals.managers", "pandas.core.internals":
+		switch name {
+		case "BlockManager":
+			return &BlockManagerClass{}, true
+		case "SingleBlockManager":
+			return &BlockManagerClass{Single: true}, true
+		}
+
+	case "pandas._libs.internals":
+		if name == "_unpickle_block" {
+			return &UnpickleBlock{}, true
+		}
+
+	case "pandas.core.indexes.base":
+		if name == "_new_Index" {
+			return &NewIndex{}, true
+		}
+
+	case "pandas.core.indexes.datetimes":
+		if name == "_new_DatetimeIndex" {
+			return &NewIndex{}, true
+		}
+
+	case "numpy":
+		if name == "dtype" {
+			return &dtypeClass{}, true
+		}
+
+	case "numpy.core.multiarray", "numpy._core.multiarray":
+		if name == "_reconstruct" {
+			return &reconstruct{}, true
+		}
+	}
+	if strings.HasPrefix(module, "pandas.core.indexes.") && strings.HasSuffix(name, "Index") {
+		return &IndexClass{Name: name}, true
+	}
+	return numpy.FindClass(module, name)
+}
+
+// ReadPickle unpickles a DataFrame, a Series, or any other object, from a
+// pickle written by "pandas.to_pickle", or by the "to_pickle" method of a
+// DataFrame or a Series, without compression. The globals not resolved by
+// FindClass are loaded as types.GenericClass values.
+func ReadPickle(r io.Reader) (interface{}, error) {
+	u := pickle.NewUnpickler(r)
+	u.FindClass = func(module, name string) (interface{}, error) {
+		if class, ok := FindClass(module, name); ok {
+			return class, nil
+		}
+		return types.NewGenericClass(module, name), nil
+	}
+	return u.Load()
+}
+
+// LoadPickle unpickles the named file as ReadPickle, decompressing it
+// according to its extension, as the default "infer" compression of
+// pandas: ".gz" for gzip, ".bz2" for bzip2 and ".zip" for a zip archive
+// of a single file. Any other extension means no compression.
+func LoadPickle(filename string) (interface{}, error) {
+	if path.Ext(filename) == ".zip" {
+		return loadZipPickle(filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	switch path.Ext(filename) {
+	case ".gz":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = bufio.NewReader(gr)
+	case ".bz2":
+		r = bufio.NewReader(bzip2.NewReader(r))
+	case ".xz", ".zst", ".tar":
+		return nil, fmt.Errorf("pandas: unsupported compression of %q", filename)
+	}
+	return ReadPickle(r)
+}
+
+// LoadDataFrame unpickles the DataFrame of the named file, as LoadPickle.
+func LoadDataFrame(filename string) (*DataFrame, error) {
+	v, err := LoadPickle(filename)
+	if err != nil {
+		return nil, err
+	}
+	df, ok := v.(*DataFrame)
+	if !ok {
+		return nil, fmt.Errorf("pandas: expected a DataFrame, actual %T", v)
+	}
+	return df, nil
+}
+
+// loadZipPickle unpickles the only file of the named zip archive.
+func loadZipPickle(filename string) (interface{}, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	if len(zr.File) != 1 {
+		return nil, fmt.Errorf("pandas: expected 1 file in zip archive %q, actual %d",
+			filename, len(zr.File))
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ReadPickle(bufio.NewReader(rc))
+}
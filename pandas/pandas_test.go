@@ -0,0 +1,106 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pandas
+
+import (
+	"github.com/nlpodyssey/gopickle/numpy"
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The fixtures are made by testdata/generate_fixtures.py.
+
+func TestLoadDataFrame(t *testing.T) {
+	for _, filename := range []string{"dataframe.pkl", "dataframe.pkl.gz"} {
+		t.Run(filename, func(t *testing.T) {
+			df, err := LoadDataFrame(path.Join("testdata", filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if df.Len() != 3 {
+				t.Errorf("expected 3 rows, actual %d", df.Len())
+			}
+			if df.Index.Class != "RangeIndex" || !reflect.DeepEqual(df.Index.Values, []int64{0, 1, 2}) {
+				t.Errorf("unexpected index %#v", df.Index)
+			}
+			expectedLabels := []interface{}{"a", "b", "c", "d", "e"}
+			if labels := df.Columns.Labels(); !reflect.DeepEqual(labels, expectedLabels) {
+				t.Errorf("expected columns %v, actual %v", expectedLabels, labels)
+			}
+
+			expected := map[string]interface{}{
+				"a": []int64{10, 20, 30},
+				"b": []float64{0.5, 1.5, 2.5},
+				"c": []interface{}{"x", nil, "z"},
+				"d": []float64{-1, -2, -3},
+				"e": []int64{0, 86400e9, -1},
+			}
+			if m := df.ColumnMap(); !reflect.DeepEqual(m, expected) {
+				t.Errorf("expected columns %#v, actual %#v", expected, m)
+			}
+			if c, ok := df.Column("d"); !ok || !reflect.DeepEqual(c, expected["d"]) {
+				t.Errorf("unexpected column d %#v", c)
+			}
+			if _, ok := df.Column("z"); ok {
+				t.Error("unexpected column z")
+			}
+			if df.Attrs == nil || df.Attrs.Len() != 0 {
+				t.Errorf("unexpected attrs %#v", df.Attrs)
+			}
+		})
+	}
+}
+
+func TestLoadLegacySeries(t *testing.T) {
+	v, err := LoadPickle(path.Join("testdata", "legacy_series.pkl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := v.(*Series)
+	if !ok {
+		t.Fatalf("expected *Series, actual %T", v)
+	}
+	if s.Name != "flag" || s.Len() != 2 {
+		t.Errorf("unexpected name %#v or length %d", s.Name, s.Len())
+	}
+	if s.Index.Class != "Int64Index" || s.Index.Name != "id" ||
+		!reflect.DeepEqual(s.Index.Values, []int64{7, 8}) {
+		t.Errorf("unexpected index %#v", s.Index)
+	}
+	if !reflect.DeepEqual(s.Values, []bool{true, false}) {
+		t.Errorf("unexpected values %#v", s.Values)
+	}
+
+	_, err = LoadDataFrame(path.Join("testdata", "legacy_series.pkl"))
+	if err == nil || !strings.Contains(err.Error(), "expected a DataFrame") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestArrayObjectsFortranOrder(t *testing.T) {
+	a := &Array{}
+	objects := types.List{"a", "d", "b", "e", "c", "f"}
+	state := types.NewTupleFromSlice([]interface{}{
+		1,
+		types.NewTupleFromSlice([]interface{}{2, 3}),
+		&numpy.Dtype{Kind: 'O', ItemSize: 8, ByteOrder: '|'},
+		true,
+		&objects,
+	})
+	if err := a.PySetState(state); err != nil {
+		t.Fatal(err)
+	}
+	values, err := a.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"a", "b", "c", "d", "e", "f"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, actual %v", expected, values)
+	}
+}
@@ -0,0 +1,200 @@
+#!/usr/bin/env python3
+
+# Copyright 2020 NLP Odyssey Authors. All rights reserved.
+# Use of this source code is governed by a BSD-style
+# license that can be found in the LICENSE file.
+
+# Generates pandas-like fixtures without requiring pandas nor NumPy.
+#
+# Minimal stand-ins for the relevant "pandas" and "numpy" modules, classes
+# and functions are registered in sys.modules, so that the standard pickle
+# module emits exactly the same globals, arguments and states that
+# DataFrame.to_pickle and Series.to_pickle would produce.
+
+import copyreg
+import gzip
+import pickle
+import struct
+import sys
+import types
+
+
+def make_module(name):
+    module = types.ModuleType(name)
+    sys.modules[name] = module
+    parent, _, child = name.rpartition('.')
+    if parent:
+        setattr(sys.modules[parent], child, module)
+    return module
+
+
+for _name in ['numpy', 'numpy.core', 'numpy.core.multiarray',
+              'numpy.core.numeric', 'pandas', 'pandas.core',
+              'pandas.core.frame', 'pandas.core.series',
+              'pandas.core.internals', 'pandas.core.internals.managers',
+              'pandas.core.indexes', 'pandas.core.indexes.base',
+              'pandas.core.indexes.range', 'pandas.core.indexes.numeric',
+              'pandas._libs', 'pandas._libs.internals']:
+    make_module(_name)
+
+
+def register(module_name, obj, name=None):
+    name = name or obj.__name__
+    obj.__module__ = module_name
+    obj.__qualname__ = name
+    obj.__name__ = name
+    setattr(sys.modules[module_name], name, obj)
+    return obj
+
+
+def function(module_name, name):
+    def f(*args):
+        raise NotImplementedError
+    return register(module_name, f, name)
+
+
+# NumPy
+
+ndarray = register('numpy', type('ndarray', (), {}))
+_reconstruct = function('numpy.core.multiarray', '_reconstruct')
+_frombuffer = function('numpy.core.numeric', '_frombuffer')
+
+
+class dtype:
+    def __init__(self, code, state):
+        self.code = code
+        self.state = state
+
+    def __reduce__(self):
+        return dtype, (self.code, False, True), self.state
+
+
+register('numpy', dtype)
+
+INT64 = dtype('i8', (3, '<', None, None, None, -1, -1, 0))
+FLOAT64 = dtype('f8', (3, '<', None, None, None, -1, -1, 0))
+BOOL = dtype('b1', (3, '|', None, None, None, -1, -1, 0))
+OBJECT = dtype('O8', (3, '|', None, None, None, -1, -1, 63))
+DATETIME64 = dtype('M8[ns]', (4, '<', None, None, None, -1, -1, 0,
+                             {}))
+
+FORMATS = {INT64: '<q', FLOAT64: '<d', BOOL: '?', DATETIME64: '<q'}
+
+
+class Array:
+    """A NumPy array of the given dtype, with its values in C order."""
+
+    def __init__(self, dt, shape, values):
+        self.dtype = dt
+        self.shape = shape
+        self.values = values
+
+    def __reduce_ex__(self, protocol):
+        if self.dtype is OBJECT:
+            return (_reconstruct, (ndarray, (0,), b'b'),
+                    (1, self.shape, self.dtype, False, list(self.values)))
+        data = b''.join(struct.pack(FORMATS[self.dtype], v)
+                        for v in self.values)
+        if protocol >= 5:
+            return (_frombuffer, (pickle.PickleBuffer(bytearray(data)),
+                                  self.dtype, self.shape, 'C'))
+        return (_reconstruct, (ndarray, (0,), b'b'),
+                (1, self.shape, self.dtype, False, data))
+
+
+# pandas
+
+class Pickled:
+    """An object pickled by reference to its class, with a state."""
+
+    def __init__(self, state):
+        self.state = state
+
+    def __reduce_ex__(self, protocol):
+        return copyreg.__newobj__, (type(self),), self.state
+
+
+DataFrame = register('pandas.core.frame', type('DataFrame', (Pickled,), {}))
+Series = register('pandas.core.series', type('Series', (Pickled,), {}))
+BlockManager = register('pandas.core.internals.managers',
+                        type('BlockManager', (), {}))
+SingleBlockManager = register('pandas.core.internals.managers',
+                              type('SingleBlockManager', (Pickled,), {}))
+Index = register('pandas.core.indexes.base', type('Index', (), {}))
+RangeIndex = register('pandas.core.indexes.range', type('RangeIndex', (), {}))
+Int64Index = register('pandas.core.indexes.numeric', type('Int64Index', (), {}))
+_new_Index = function('pandas.core.indexes.base', '_new_Index')
+_unpickle_block = function('pandas._libs.internals', '_unpickle_block')
+
+
+class Reduced:
+    """An object reduced to a call to a function."""
+
+    def __init__(self, func, args):
+        self.func = func
+        self.args = args
+
+    def __reduce__(self):
+        return self.func, self.args
+
+
+def new_index(cls, **d):
+    return Reduced(_new_Index, (cls, d))
+
+
+def frame_state(mgr, typ, **meta):
+    state = {
+        '_mgr': mgr,
+        '_typ': typ,
+        '_metadata': list(meta),
+        'attrs': {},
+        '_flags': {'allows_duplicate_labels': True},
+    }
+    state.update(meta)
+    return state
+
+
+def dataframe():
+    """A DataFrame as pickled by pandas 1.3 and later, whose block manager
+    is reduced to its blocks and axes."""
+    columns = new_index(Index, data=Array(OBJECT, (5,), ['a', 'b', 'c', 'd', 'e']),
+                        name=None)
+    index = new_index(RangeIndex, name=None, start=0, stop=3, step=1)
+    blocks = (
+        Reduced(_unpickle_block, (
+            Array(FLOAT64, (2, 3), [0.5, 1.5, 2.5, -1, -2, -3]),
+            Array(INT64, (2,), [1, 3]), 2)),
+        Reduced(_unpickle_block, (
+            Array(INT64, (1, 3), [10, 20, 30]), slice(0, 1, 1), 2)),
+        Reduced(_unpickle_block, (
+            Array(OBJECT, (1, 3), ['x', None, 'z']), slice(2, 3, 1), 2)),
+        Reduced(_unpickle_block, (
+            Array(DATETIME64, (1, 3), [0, 86400 * 10**9, -1]),
+            slice(4, 5, 1), 2)),
+    )
+    mgr = Reduced(BlockManager, (blocks, [columns, index]))
+    df = DataFrame(frame_state(mgr, 'dataframe'))
+    with open('dataframe.pkl', 'wb') as f:
+        pickle.dump(df, f, protocol=5)
+    with gzip.GzipFile('dataframe.pkl.gz', 'wb', mtime=0) as f:
+        pickle.dump(df, f, protocol=5)
+
+
+def legacy_series():
+    """A Series as pickled by pandas 1.2 and earlier, whose block manager
+    has the state of its axes and blocks."""
+    index = new_index(Int64Index, data=Array(INT64, (2,), [7, 8]), name='id')
+    values = Array(BOOL, (2,), [True, False])
+    axes = [index]
+    state = (axes, [values], [index], {'0.14.1': {
+        'axes': axes,
+        'blocks': [{'values': values, 'mgr_locs': slice(0, 2, 1)}],
+    }})
+    mgr = SingleBlockManager(state)
+    s = Series(frame_state(mgr, 'series', name='flag'))
+    with open('legacy_series.pkl', 'wb') as f:
+        pickle.dump(s, f, protocol=2)
+
+
+dataframe()
+legacy_series()
@@ -0,0 +1,80 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownOpcode is returned when the pickle data has a byte which is
+// not the opcode of any protocol where an opcode is expected.
+var ErrUnknownOpcode = errors.New("unknown opcode")
+
+// ErrCorruptData is returned when the pickle data is malformed, rather
+// than just truncated (see io.ErrUnexpectedEOF): an invalid argument of an
+// opcode, a reference to a missing memo value, an opcode finding too few
+// values on the stack, and so on.
+var ErrCorruptData = errors.New("corrupt pickle data")
+
+// ErrClassNotFound is matched by errors.Is for any ClassNotFoundError.
+var ErrClassNotFound = errors.New("class not found")
+
+// ClassNotFoundError is the error of a FindClass function which cannot
+// resolve a global of the pickle data. Its Error method formats it as
+// "class not found: <module> <name>", followed by the Reason, if any.
+type ClassNotFoundError struct {
+	Module string
+	Name   string
+	// Reason, if not empty, explains why the class cannot be resolved, or
+	// what to do about it.
+	Reason string
+}
+
+func (e *ClassNotFoundError) Error() string {
+	msg := fmt.Sprintf("%v: %s %s", ErrClassNotFound, e.Module, e.Name)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Is reports whether target is ErrClassNotFound.
+func (e *ClassNotFoundError) Is(target error) bool {
+	return target == ErrClassNotFound
+}
+
+// OpError is the error returned by Unpickler.Load when it fails within a
+// pickle, reporting where: the opcode which failed, and its offset. It
+// wraps the cause, which can be inspected with errors.Is and errors.As:
+// one of the errors of this package, such as ErrCorruptData or a
+// *ClassNotFoundError, io.ErrUnexpectedEOF for truncated data, or any
+// error of the reader, of the FindClass function or of the Callable
+// values of the Unpickler.
+type OpError struct {
+	// Offset is the position of the opcode, in bytes from the beginning of
+	// the pickle.
+	Offset int64
+	// Opcode is the opcode which failed, or zero, which is not an opcode,
+	// when the data ended, or could not be read, where the next opcode
+	// was expected.
+	Opcode byte
+	Err    error
+}
+
+func (e *OpError) Error() string {
+	if e.Opcode == 0 {
+		return fmt.Sprintf("pickle: at offset %d: %v", e.Offset, e.Err)
+	}
+	if e.Opcode >= ' ' && e.Opcode <= '~' {
+		return fmt.Sprintf("pickle: opcode 0x%02x '%c' at offset %d: %v",
+			e.Opcode, e.Opcode, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("pickle: opcode 0x%02x at offset %d: %v", e.Opcode, e.Offset, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,25 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+// Persister keeps some of the values pickled by a Pickler out of the
+// pickle, writing in their place the persistent IDs (BINPERSID opcode)
+// which refer to them, such as the keys of the records holding the data
+// of the tensors in a PyTorch archive. It is the counterpart of overriding
+// "persistent_id" of a Python "pickle.Pickler". See Pickler.Persister.
+type Persister interface {
+	// PersistentId returns the persistent ID of obj, and true, if obj is
+	// stored out of the pickle, or false for the values to be pickled as
+	// usual. The ID is pickled as a regular value, but without asking for
+	// its own persistent ID.
+	PersistentId(obj interface{}) (pid interface{}, ok bool, err error)
+}
+
+// PersistentLoader resolves the persistent IDs written by a Persister,
+// as the "persistent_load" of a Python "pickle.Unpickler". Its method can
+// be set as the PersistentLoad function of an Unpickler.
+type PersistentLoader interface {
+	PersistentLoad(pid interface{}) (interface{}, error)
+}
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -15,12 +16,73 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/nlpodyssey/gopickle/types"
 )
 
 const HighestProtocol byte = 5
 
+// ErrUnsupportedProtocol is returned when the PROTO opcode declares a
+// pickle protocol higher than HighestProtocol.
+var ErrUnsupportedProtocol = errors.New("unsupported pickle protocol")
+
+// ErrDangerousGlobal is returned when the pickle data references one of
+// the DenyGlobals of the Unpickler.
+var ErrDangerousGlobal = errors.New("dangerous global")
+
+// ErrGlobalNotAllowed is returned when the pickle data references a global
+// which is not one of the AllowGlobals of the Unpickler.
+var ErrGlobalNotAllowed = errors.New("global not allowed")
+
+// ErrLimitExceeded is returned when the pickle data exceeds one of the
+// limits of the Unpickler, such as MaxBytesPerObject, before the memory
+// for it is allocated.
+var ErrLimitExceeded = errors.New("pickle limit exceeded")
+
+// ErrPanic is returned by Load when a panic occurs while executing an
+// opcode, for example in a Callable or FindClass function given bad
+// arguments by malformed data. The error also reports the opcode and the
+// value of the panic.
+var ErrPanic = errors.New("panic while unpickling")
+
+// Default limits set by NewUnpickler. They are far beyond what the pickles
+// of ordinary data and checkpoints need, while preventing a few bytes of
+// malicious data from making an Unpickler allocate an unbounded amount of
+// memory.
+const (
+	DefaultMaxBytesPerObject int64 = 1 << 30 // 1 GiB
+	DefaultMaxTotalAlloc     int64 = 1 << 32 // 4 GiB
+	DefaultMaxDepth                = 10000
+)
+
+// DefaultDenyGlobals are the globals which NewUnpickler denies by default.
+// They allow to run arbitrary code or commands, and should never appear
+// in legitimate data: they are the usual sign of a malicious file.
+var DefaultDenyGlobals = []string{
+	"os",
+	"posix",
+	"nt",
+	"subprocess",
+	"pty",
+	"socket",
+	"shutil",
+	"runpy",
+	"webbrowser",
+	"builtins.eval",
+	"builtins.exec",
+	"builtins.compile",
+	"builtins.open",
+	"builtins.breakpoint",
+	"builtins.__import__",
+	"__builtin__.eval",
+	"__builtin__.execfile",
+	"__builtin__.compile",
+	"__builtin__.open",
+	"__builtin__.file",
+	"__builtin__.__import__",
+}
+
 func Load(filename string) (interface{}, error) {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -48,20 +110,18 @@ type bytereader struct {
 }
 
 func (r *bytereader) ReadByte() (byte, error) {
-	n, err := r.Read(r.bytebuf[:])
-	if n == 1 {
-		return r.bytebuf[0], nil
-	}
-	if err == nil {
-		err = io.EOF
+	// A reader may return no data and no error, which io.ReadFull handles.
+	if _, err := io.ReadFull(r.Reader, r.bytebuf[:]); err != nil {
+		return 0, err
 	}
-	return 0, err
+	return r.bytebuf[0], nil
 }
 
 type Unpickler struct {
 	r              reader
 	proto          byte
 	currentFrame   *bytes.Reader
+	frame          bytes.Reader
 	stack          []interface{}
 	metaStack      [][]interface{}
 	memo           map[int]interface{}
@@ -70,6 +130,135 @@ type Unpickler struct {
 	GetExtension   func(code int) (interface{}, error)
 	NextBuffer     func() (interface{}, error)
 	MakeReadOnly   func(interface{}) (interface{}, error)
+	// ExtensionRegistry maps the codes of the EXT1, EXT2 and EXT4 opcodes
+	// to the globals they stand for, as registered in Python with
+	// "copyreg.add_extension". The globals are resolved as those of the
+	// GLOBAL opcode, through DenyGlobals, AllowGlobals, the reducers and
+	// FindClass. GetExtension, if set, is called for the codes which are
+	// not in the registry.
+	ExtensionRegistry map[int]Extension
+	// NormalizeInts, if true, makes all decoded integers int64 values,
+	// instead of int, so that callers only need to handle a single integer
+	// type in the common case. *big.Int is still used for values out of
+	// the int64 range.
+	NormalizeInts bool
+	// DenyGlobals are the globals which make Load fail with
+	// ErrDangerousGlobal as soon as they are referenced, before they are
+	// resolved, without calling FindClass. Each entry is either the
+	// qualified name of a global, such as "os.system", or the name of a
+	// module, denying all its globals. NewUnpickler sets it to a copy of
+	// DefaultDenyGlobals, which can be changed without changing the
+	// default; it can be set to nil to allow any global.
+	DenyGlobals []string
+	// AllowGlobals, if not nil, are the only globals which can be
+	// referenced, as an allow-list for restricting the data accepted from
+	// untrusted sources: any other global makes Load fail with
+	// ErrGlobalNotAllowed, before it is resolved. The entries are qualified
+	// names or modules, as for DenyGlobals, which is checked first. It
+	// applies to all the globals, including the built-in ones such as
+	// "collections.OrderedDict".
+	AllowGlobals []string
+	// CollectStats, if true, makes Load collect the statistics returned by
+	// Stats. When false, no statistics are collected, at no cost.
+	CollectStats bool
+	// Encoding tells how the 8-bit strings of Python 2 pickles, pushed by
+	// the STRING, BINSTRING and SHORT_BINSTRING opcodes, are loaded, like
+	// the encoding argument of Python "pickle.load":
+	//
+	//   - "" (the default) keeps their bytes unchanged, in a string;
+	//   - "ascii", "utf-8" and "latin1" decode them into a string, failing
+	//     for the bytes which are not valid in the encoding (any byte is
+	//     valid latin-1, and maps to the rune with the same value);
+	//   - "bytes" loads them as types.Bytes values.
+	//
+	// Any other value makes Load fail as soon as such a string is found.
+	Encoding string
+	// MaxBytesPerObject, if positive, is the maximum size in bytes of the
+	// argument of a single opcode, such as the data of a BINBYTES8 value,
+	// a frame or a text line, checked before it is allocated.
+	// MaxTotalAlloc, if positive, is the maximum total size of all such
+	// arguments read by a call to Load. MaxDepth, if positive, is the
+	// maximum number of nested MARK opcodes. MaxMemoSize, if positive, is
+	// the maximum number of entries of the memo. Load fails with
+	// ErrLimitExceeded as soon as any of them is exceeded. NewUnpickler
+	// sets the first three to DefaultMaxBytesPerObject, DefaultMaxTotalAlloc
+	// and DefaultMaxDepth; zero means no limit.
+	MaxBytesPerObject int64
+	MaxTotalAlloc     int64
+	MaxDepth          int
+	MaxMemoSize       int
+	// Visitor, if set, receives the events of the lists, dicts and objects
+	// as they are built, and tells which items to keep (see Visitor). The
+	// lists, tuples and dicts of the items it discards in a batch, that is
+	// in a single APPENDS or SETITEMS opcode, are also dropped from the
+	// memo, so that they can be garbage collected: a pickle referring to
+	// them again, which is only possible if they are shared, then fails to
+	// load with a "memo value not found" error.
+	Visitor Visitor
+	// Strings, if set, is the pool which interns the strings loaded by the
+	// Unpickler, to save the memory of the pickles holding many equal
+	// strings which are not memoized.
+	Strings *StringPool
+	// SizeHint, if positive, is the expected size in bytes of the pickle
+	// read by Load, used to allocate the memo upfront for the number of
+	// values it is likely to hold, rather than growing it many times.
+	SizeHint int64
+	// memoJournal are the indices of the memo, in the order they were set,
+	// when Visitor is set, and markJournal the length of memoJournal at
+	// each MARK on the meta stack. lastMark is the one of the MARK popped
+	// last.
+	memoJournal []int
+	markJournal []int
+	lastMark    int
+	// memoLen is the number of indices set in the memo, including those
+	// forgotten because of Visitor, and so the index of the next MEMOIZE.
+	memoLen int
+	// tempBuf and frameBuf are the buffers reused by readTemp, and for the
+	// data of the frames.
+	tempBuf  []byte
+	frameBuf []byte
+	// reducers are the functions registered by RegisterReducer, by
+	// qualified name.
+	reducers map[string]reducerFunc
+	// allocated is the total size of the opcode arguments read by Load.
+	allocated int64
+	// offset is the number of bytes of the pickle consumed by Load.
+	offset int64
+	// nextBuffer, set by SetBuffers, is the index of the next out-of-band
+	// buffer, which Load resets. It is shared by the copies of the
+	// Unpickler, as the NextBuffer function using it.
+	nextBuffer *int
+	stats      Stats
+	counter    *countingReader
+}
+
+// Stats holds the statistics collected by an Unpickler with CollectStats
+// set, during the last call to Load.
+type Stats struct {
+	// Opcodes counts the executed opcodes, by opcode.
+	Opcodes map[byte]int
+	// BytesRead is the total number of bytes of pickle data consumed.
+	BytesRead int64
+}
+
+// countingReader is a reader which counts the bytes read through it.
+type countingReader struct {
+	r reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
 }
 
 func NewUnpickler(ior io.Reader) Unpickler {
@@ -78,25 +267,71 @@ func NewUnpickler(ior io.Reader) Unpickler {
 		r = &bytereader{Reader: ior}
 	}
 	return Unpickler{
-		r:    r,
-		memo: make(map[int]interface{}, 256+128),
-	}
-}
-
-func (u *Unpickler) Load() (interface{}, error) {
+		r:                 r,
+		memo:              make(map[int]interface{}, 256+128),
+		DenyGlobals:       append([]string(nil), DefaultDenyGlobals...),
+		MaxBytesPerObject: DefaultMaxBytesPerObject,
+		MaxTotalAlloc:     DefaultMaxTotalAlloc,
+		MaxDepth:          DefaultMaxDepth,
+	}
+}
+
+// Load reads the next pickle and returns the unpickled value. It can be
+// called repeatedly, to read a sequence of pickles from the same reader,
+// such as the ones written back to back by the legacy PyTorch format or
+// the frames of a stream: the reader is never read past the STOP opcode
+// of each pickle, and the memo is emptied at the beginning of each call.
+// Load returns io.EOF if the reader is at its end before the first opcode.
+// Any other error is an *OpError, reporting the failed opcode and its
+// offset, which wraps io.ErrUnexpectedEOF if the data ends within the
+// pickle.
+func (u *Unpickler) Load() (result interface{}, err error) {
+	var opcode byte
+	var offset int64
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = &OpError{Offset: offset, Opcode: opcode, Err: fmt.Errorf("%w: %v", ErrPanic, r)}
+		}
+	}()
 	u.metaStack = make([][]interface{}, 0, 16)
 	u.stack = make([]interface{}, 0, 16)
+	if u.memo == nil || len(u.memo) > 0 || u.SizeHint > 0 {
+		u.memo = make(map[int]interface{}, u.memoCapacity())
+	}
+	u.memoLen = 0
+	u.memoJournal = u.memoJournal[:0]
+	u.markJournal = u.markJournal[:0]
+	u.currentFrame = nil
 	u.proto = 0
+	u.allocated = 0
+	u.offset = 0
+	if u.nextBuffer != nil {
+		*u.nextBuffer = 0
+	}
+	if u.CollectStats {
+		u.resetStats()
+	}
 
-	for {
-		opcode, err := u.readOne()
-		if err != nil {
+	for started := false; ; started = true {
+		offset = u.offset
+		opcode, err = u.readOne()
+		if err == io.EOF && !started {
 			return nil, err
 		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, &OpError{Offset: offset, Err: err}
+		}
+		if u.CollectStats {
+			u.stats.Opcodes[opcode]++
+		}
 
 		opFunc := dispatch[opcode]
 		if opFunc == nil {
-			return nil, fmt.Errorf("unknown opcode: 0x%x '%c'", opcode, opcode)
+			return nil, &OpError{Offset: offset, Opcode: opcode, Err: ErrUnknownOpcode}
 		}
 
 		err = opFunc(u)
@@ -104,9 +339,61 @@ func (u *Unpickler) Load() (interface{}, error) {
 			if p, ok := err.(pickleStop); ok {
 				return p.value, nil
 			}
-			return nil, err
+			return nil, &OpError{Offset: offset, Opcode: opcode, Err: err}
+		}
+	}
+}
+
+// bytesPerMemoEntry is the least size in bytes of pickle data which
+// memoizes a value, assumed by memoCapacity: the memo opcode and the
+// opcode of a small value, such as a short string, with their arguments.
+const bytesPerMemoEntry = 16
+
+// maxMemoCapacity is the maximum initial capacity of the memo.
+const maxMemoCapacity = 1 << 22
+
+// memoCapacity returns the initial capacity of the memo, according to the
+// SizeHint and the MaxMemoSize.
+func (u *Unpickler) memoCapacity() int {
+	capacity := 256 + 128
+	if hint := u.SizeHint / bytesPerMemoEntry; hint > int64(capacity) {
+		capacity = maxMemoCapacity
+		if hint < maxMemoCapacity {
+			capacity = int(hint)
 		}
 	}
+	if u.MaxMemoSize > 0 && capacity > u.MaxMemoSize {
+		capacity = u.MaxMemoSize
+	}
+	return capacity
+}
+
+// Stats returns the statistics collected during the last call to Load, if
+// CollectStats was set. The returned value must not be modified.
+func (u *Unpickler) Stats() Stats {
+	stats := u.stats
+	if u.counter != nil {
+		stats.BytesRead = u.counter.n
+	}
+	return stats
+}
+
+// resetStats clears the statistics, making sure that all the data is
+// read through a countingReader.
+func (u *Unpickler) resetStats() {
+	if u.counter == nil {
+		u.counter = &countingReader{r: u.r}
+		u.r = u.counter
+	}
+	u.counter.n = 0
+	u.stats = Stats{Opcodes: make(map[byte]int)}
+}
+
+// Extension is the global of an extension code: see
+// Unpickler.ExtensionRegistry.
+type Extension struct {
+	Module string
+	Name   string
 }
 
 type pickleStop struct{ value interface{} }
@@ -115,24 +402,156 @@ func (p pickleStop) Error() string { return "STOP" }
 
 var _ error = pickleStop{}
 
+// RegisterReducer makes the global module.name resolve to a Callable which
+// calls fn with the arguments it is called with, usually by the REDUCE
+// opcode, as Python does with the callable returned by "__reduce__", such
+// as "copyreg.__newobj__". It allows implementing the reconstruction of
+// custom objects in Go without writing a FindClass function.
+//
+// The global can also be instantiated by the NEWOBJ and NEWOBJ_EX opcodes,
+// calling fn with their arguments, as for the classes of Python objects
+// reduced with "copyreg.__newobj__". The returned value can implement
+// types.PyStateSettable, to handle the state pickled for "__setstate__",
+// or types.PyDictSettable, for the attributes of the object.
+//
+// The registered reducers take precedence over FindClass and the built-in
+// globals, but not over DenyGlobals. Registering a nil fn removes the
+// reducer of the global.
+func (u *Unpickler) RegisterReducer(module, name string, fn func(args *types.Tuple) (interface{}, error)) {
+	qualifiedName := module + "." + name
+	if fn == nil {
+		delete(u.reducers, qualifiedName)
+		return
+	}
+	if u.reducers == nil {
+		u.reducers = make(map[string]reducerFunc)
+	}
+	u.reducers[qualifiedName] = fn
+}
+
+// reducerFunc is a function registered by RegisterReducer.
+type reducerFunc func(args *types.Tuple) (interface{}, error)
+
+var _ types.Callable = reducerFunc(nil)
+var _ types.PyNewable = reducerFunc(nil)
+
+func (f reducerFunc) Call(args ...interface{}) (interface{}, error) {
+	return f(types.NewTupleFromSlice(args))
+}
+
+// PyNew calls the function with the arguments of NEWOBJ, or NEWOBJ_EX
+// followed by its dict of keyword arguments.
+func (f reducerFunc) PyNew(args ...interface{}) (interface{}, error) {
+	return f(types.NewTupleFromSlice(args))
+}
+
+// globalListed reports whether list holds the qualified name of a global,
+// or the name of its module.
+func globalListed(list []string, module, qualifiedName string) bool {
+	for _, entry := range list {
+		if entry == qualifiedName || entry == module {
+			return true
+		}
+	}
+	return false
+}
+
 func (u *Unpickler) findClass(module, name string) (interface{}, error) {
+	qualifiedName := module + "." + name
+	if globalListed(u.DenyGlobals, module, qualifiedName) {
+		return nil, fmt.Errorf("%w: %s", ErrDangerousGlobal, qualifiedName)
+	}
+	if u.AllowGlobals != nil && !globalListed(u.AllowGlobals, module, qualifiedName) {
+		return nil, fmt.Errorf("%w: %s", ErrGlobalNotAllowed, qualifiedName)
+	}
+	if reducer, ok := u.reducers[qualifiedName]; ok {
+		return reducer, nil
+	}
+
 	switch module {
 	case "collections":
 		switch name {
 		case "OrderedDict":
 			return &types.OrderedDictClass{}, nil
+		case "defaultdict":
+			return &types.DefaultDictClass{}, nil
+		case "Counter":
+			return &types.CounterClass{}, nil
+		case "deque":
+			return &types.DequeClass{}, nil
 		}
 
-	case "__builtin__":
+	case "__builtin__", "builtins":
 		switch name {
 		case "object":
 			return &types.ObjectClass{}, nil
+		case "bytes":
+			return &types.BytesClass{}, nil
+		case "set":
+			return &types.SetClass{}, nil
+		case "frozenset":
+			return &types.FrozenSetClass{}, nil
+		case "bytearray":
+			return &types.ByteArrayClass{}, nil
+		case "complex":
+			return &types.ComplexClass{}, nil
+		case "slice":
+			return &types.SliceClass{}, nil
+		case "range", "xrange":
+			return &types.RangeClass{}, nil
+		case "getattr":
+			return &types.GetAttr{}, nil
+		}
+
+	case "_codecs":
+		switch name {
+		case "encode":
+			return &types.CodecsEncode{}, nil
 		}
+
+	case "functools":
+		switch name {
+		case "partial":
+			return &types.PartialClass{}, nil
+		}
+
 	case "copy_reg":
 		switch name {
 		case "_reconstructor":
 			return &types.Reconstructor{}, nil
 		}
+
+	case "datetime":
+		switch name {
+		case "datetime":
+			return &types.DatetimeClass{}, nil
+		case "date":
+			return &types.DateClass{}, nil
+		case "timedelta":
+			return &types.TimedeltaClass{}, nil
+		case "timezone":
+			return &types.TimezoneClass{}, nil
+		}
+
+	case "decimal", "_pydecimal":
+		switch name {
+		case "Decimal":
+			return &types.DecimalClass{}, nil
+		}
+
+	case "uuid":
+		switch name {
+		case "UUID":
+			return &types.UUIDClass{}, nil
+		}
+
+	case "pathlib":
+		switch name {
+		case "PosixPath", "PurePosixPath":
+			return &types.PathClass{}, nil
+		case "WindowsPath", "PureWindowsPath":
+			return &types.PathClass{Windows: true}, nil
+		}
 	}
 	if u.FindClass != nil {
 		return u.FindClass(module, name)
@@ -140,9 +559,62 @@ func (u *Unpickler) findClass(module, name string) (interface{}, error) {
 	return types.NewGenericClass(module, name), nil
 }
 
+// checkObjectSize fails if an opcode argument of n bytes exceeds
+// MaxBytesPerObject.
+func (u *Unpickler) checkObjectSize(n int64) error {
+	if n < 0 || (u.MaxBytesPerObject > 0 && n > u.MaxBytesPerObject) {
+		return fmt.Errorf("%w: %d bytes for a single object, MaxBytesPerObject is %d",
+			ErrLimitExceeded, n, u.MaxBytesPerObject)
+	}
+	return nil
+}
+
+// checkAlloc accounts for an opcode argument of n bytes, failing if it
+// exceeds MaxBytesPerObject, or if the total exceeds MaxTotalAlloc.
+func (u *Unpickler) checkAlloc(n int64) error {
+	if err := u.checkObjectSize(n); err != nil {
+		return err
+	}
+	u.allocated += n
+	if u.MaxTotalAlloc > 0 && u.allocated > u.MaxTotalAlloc {
+		return fmt.Errorf("%w: more than %d bytes allocated, MaxTotalAlloc is %d",
+			ErrLimitExceeded, u.allocated-n, u.MaxTotalAlloc)
+	}
+	return nil
+}
+
 func (u *Unpickler) read(n int) ([]byte, error) {
-	buf := make([]byte, n)
+	if err := u.checkAlloc(int64(n)); err != nil {
+		return nil, err
+	}
+	return u.readInto(make([]byte, n))
+}
+
+// maxReusedBufferSize is the maximum size in bytes of the buffers kept by
+// an Unpickler for reuse, by readTemp and for the frames.
+const maxReusedBufferSize = 1 << 20
+
+// readTemp is like read, but the returned bytes are only valid until the
+// next call to readTemp: it reuses the same buffer for the arguments which
+// are decoded at once, such as the integers, the lengths and the text of
+// the strings, rather than kept.
+func (u *Unpickler) readTemp(n int) ([]byte, error) {
+	if err := u.checkAlloc(int64(n)); err != nil {
+		return nil, err
+	}
+	if n > maxReusedBufferSize {
+		return u.readInto(make([]byte, n))
+	}
+	if cap(u.tempBuf) < n {
+		u.tempBuf = make([]byte, n, n+n/2)
+	}
+	return u.readInto(u.tempBuf[:n])
+}
 
+// readInto fills buf from the current frame, if any, or from the reader.
+func (u *Unpickler) readInto(buf []byte) (data []byte, err error) {
+	defer func() { u.offset += int64(len(data)) }()
+	n := len(buf)
 	if u.currentFrame != nil {
 		m, err := io.ReadFull(u.currentFrame, buf)
 		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
@@ -150,60 +622,81 @@ func (u *Unpickler) read(n int) ([]byte, error) {
 		}
 		if m == 0 && n != 0 {
 			u.currentFrame = nil
-			m, err := io.ReadFull(u.r, buf)
-			return buf[0:m], err
+			return readFull(u.r, buf)
 		}
 		if m < n {
-			return nil, fmt.Errorf("pickle exhausted before end of frame")
+			return nil, fmt.Errorf("%w: pickle exhausted before end of frame", ErrCorruptData)
 		}
 		return buf[0:m], nil
 	}
 
-	m, err := io.ReadFull(u.r, buf)
+	return readFull(u.r, buf)
+}
+
+// readFull reads exactly len(buf) bytes from r, even if it returns them in
+// small chunks, as network-backed readers may do. Unlike io.ReadFull, it
+// returns io.ErrUnexpectedEOF even when no byte at all can be read, since
+// the data is always the argument of an opcode which was already read.
+func readFull(r io.Reader, buf []byte) ([]byte, error) {
+	m, err := io.ReadFull(r, buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
 	return buf[0:m], err
 }
 
+// readOne reads a single byte, such as an opcode. Unlike read, it returns
+// io.EOF at the end of the data.
 func (u *Unpickler) readOne() (byte, error) {
-	var err error
-	var b byte
 	if u.currentFrame != nil {
-		b, err = u.currentFrame.ReadByte()
-	} else {
-		b, err = u.r.ReadByte()
+		if b, err := u.currentFrame.ReadByte(); err == nil {
+			u.offset++
+			return b, nil
+		}
+		u.currentFrame = nil
 	}
+	b, err := u.r.ReadByte()
 	if err == nil {
-		return b, nil
+		u.offset++
 	}
+	return b, err
+}
 
-	buf, err := u.read(1)
+func (u *Unpickler) readLine() ([]byte, error) {
+	line, err := u.readFrameLine()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if err := u.checkAlloc(int64(len(line))); err != nil {
+		return nil, err
 	}
-	return buf[0], nil
+	return line, nil
 }
 
-func (u *Unpickler) readLine() ([]byte, error) {
+func (u *Unpickler) readFrameLine() ([]byte, error) {
 	if u.currentFrame != nil {
-		line, err := readLine(u.currentFrame)
+		line, err := u.readLineFrom(u.currentFrame)
 		if err != nil {
 			if err == io.EOF && len(line) == 0 {
 				u.currentFrame = nil
-				return readLine(u.r)
+				return u.readLineFrom(u.r)
 			}
 			return nil, err
 		}
 		if len(line) == 0 {
-			return nil, fmt.Errorf("readLine no data")
+			return nil, fmt.Errorf("%w: readLine no data", ErrCorruptData)
 		}
 		if line[len(line)-1] != '\n' {
-			return nil, fmt.Errorf("pickle exhausted before end of frame")
+			return nil, fmt.Errorf("%w: pickle exhausted before end of frame", ErrCorruptData)
 		}
 		return line, nil
 	}
-	return readLine(u.r)
+	return u.readLineFrom(u.r)
 }
 
-func readLine(r reader) (line []byte, err error) {
+// readLineFrom reads a line from r, failing as soon as it gets longer than
+// MaxBytesPerObject.
+func (u *Unpickler) readLineFrom(r reader) (line []byte, err error) {
 	line = make([]byte, 0, 32)
 
 	var b byte
@@ -212,6 +705,11 @@ func readLine(r reader) (line []byte, err error) {
 		if err != nil {
 			return
 		}
+		if u.MaxBytesPerObject > 0 && int64(len(line)) == u.MaxBytesPerObject {
+			return nil, fmt.Errorf("%w: text line longer than MaxBytesPerObject (%d bytes)",
+				ErrLimitExceeded, u.MaxBytesPerObject)
+		}
+		u.offset++
 		line = append(line, b)
 		if b == '\n' {
 			return
@@ -220,19 +718,30 @@ func readLine(r reader) (line []byte, err error) {
 }
 
 func (u *Unpickler) loadFrame(frameSize int) error {
-	buf := make([]byte, frameSize)
-	if u.currentFrame != nil {
-		n, err := (*u.currentFrame).Read(buf)
-		if n > 0 || err == nil {
-			return fmt.Errorf(
-				"beginning of a new frame before end of current frame")
+	// The data read from the frame is accounted for by read and readLine.
+	if err := u.checkObjectSize(int64(frameSize)); err != nil {
+		return err
+	}
+	if u.currentFrame != nil && u.currentFrame.Len() > 0 {
+		return fmt.Errorf(
+			"%w: beginning of a new frame before end of current frame", ErrCorruptData)
+	}
+	// The data of the opcodes is always copied out of the frames, so the
+	// buffer of the last one can be reused.
+	buf := u.frameBuf
+	if cap(buf) < frameSize {
+		buf = make([]byte, frameSize)
+		if frameSize <= maxReusedBufferSize {
+			u.frameBuf = buf
 		}
 	}
+	buf = buf[:frameSize]
 	_, err := io.ReadFull(u.r, buf)
 	if err != nil {
 		return err
 	}
-	u.currentFrame = bytes.NewReader(buf)
+	u.frame.Reset(buf)
+	u.currentFrame = &u.frame
 	return nil
 }
 
@@ -240,9 +749,36 @@ func (u *Unpickler) append(element interface{}) {
 	u.stack = append(u.stack, element)
 }
 
+// appendInt pushes an integer onto the stack, as int, or as int64 if
+// NormalizeInts is set.
+func (u *Unpickler) appendInt(i int64) {
+	if u.NormalizeInts {
+		u.append(i)
+	} else {
+		u.append(int(i))
+	}
+}
+
+// appendLong pushes onto the stack a value returned by decodeLong. If
+// NormalizeInts is set, a *big.Int within the int64 range becomes int64.
+func (u *Unpickler) appendLong(v interface{}) {
+	switch i := v.(type) {
+	case int:
+		u.appendInt(int64(i))
+	case *big.Int:
+		if u.NormalizeInts && i.IsInt64() {
+			u.append(i.Int64())
+		} else {
+			u.append(i)
+		}
+	default:
+		u.append(v)
+	}
+}
+
 func (u *Unpickler) stackLast() (interface{}, error) {
 	if len(u.stack) == 0 {
-		return nil, fmt.Errorf("the stack is empty")
+		return nil, fmt.Errorf("%w: the stack is empty", ErrCorruptData)
 	}
 	return u.stack[len(u.stack)-1], nil
 }
@@ -258,7 +794,7 @@ func (u *Unpickler) stackPop() (interface{}, error) {
 
 func (u *Unpickler) metaStackLast() ([]interface{}, error) {
 	if len(u.metaStack) == 0 {
-		return nil, fmt.Errorf("the meta stack is empty")
+		return nil, fmt.Errorf("%w: the meta stack is empty", ErrCorruptData)
 	}
 	return u.metaStack[len(u.metaStack)-1], nil
 }
@@ -280,10 +816,14 @@ func (u *Unpickler) popMark() ([]interface{}, error) {
 		return nil, err
 	}
 	u.stack = newStack
+	if n := len(u.markJournal); n > 0 {
+		u.lastMark = u.markJournal[n-1]
+		u.markJournal = u.markJournal[:n-1]
+	}
 	return items, nil
 }
 
-var dispatch [math.MaxUint8]func(*Unpickler) error
+var dispatch [math.MaxUint8 + 1]func(*Unpickler) error
 
 func init() {
 	// Initialize `dispatch` assigning functions to opcodes
@@ -379,7 +919,8 @@ func loadProto(u *Unpickler) error {
 		return err
 	}
 	if proto > HighestProtocol {
-		return fmt.Errorf("unsupported pickle protocol: %d", proto)
+		return fmt.Errorf("%w %d, the highest supported is %d",
+			ErrUnsupportedProtocol, proto, HighestProtocol)
 	}
 	u.proto = proto
 	return nil
@@ -387,13 +928,13 @@ func loadProto(u *Unpickler) error {
 
 // indicate the beginning of a new frame
 func loadFrame(u *Unpickler) error {
-	buf, err := u.read(8)
+	buf, err := u.readTemp(8)
 	if err != nil {
 		return err
 	}
 	frameSize := binary.LittleEndian.Uint64(buf)
 	if frameSize > math.MaxInt64 {
-		return fmt.Errorf("frame size > max int64: %d", frameSize)
+		return fmt.Errorf("%w: frame size > max int64: %d", ErrCorruptData, frameSize)
 	}
 	return u.loadFrame(int(frameSize))
 }
@@ -470,17 +1011,17 @@ func loadInt(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(i)
+	u.appendInt(int64(i))
 	return nil
 }
 
 // push four-byte signed int
 func loadBinInt(u *Unpickler) error {
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
-	u.append(decodeInt32(buf))
+	u.appendInt(int64(decodeInt32(buf)))
 	return nil
 }
 
@@ -490,17 +1031,17 @@ func loadBinInt1(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(int(i))
+	u.appendInt(int64(i))
 	return nil
 }
 
 // push 2-byte unsigned int
 func loadBinInt2(u *Unpickler) error {
-	buf, err := u.read(2)
+	buf, err := u.readTemp(2)
 	if err != nil {
 		return err
 	}
-	u.append(int(binary.LittleEndian.Uint16(buf)))
+	u.appendInt(int64(binary.LittleEndian.Uint16(buf)))
 	return nil
 }
 
@@ -512,7 +1053,7 @@ func loadLong(u *Unpickler) error {
 	}
 	sub := line[:len(line)-1]
 	if len(sub) == 0 {
-		return fmt.Errorf("invalid long data")
+		return fmt.Errorf("%w: invalid long data", ErrCorruptData)
 	}
 	if sub[len(sub)-1] == 'L' {
 		sub = sub[0 : len(sub)-1]
@@ -524,14 +1065,14 @@ func loadLong(u *Unpickler) error {
 		if ne, isNe := err.(*strconv.NumError); isNe && ne.Err == strconv.ErrRange {
 			bi, ok := new(big.Int).SetString(str, 10)
 			if !ok {
-				return fmt.Errorf("invalid long data")
+				return fmt.Errorf("%w: invalid long data", ErrCorruptData)
 			}
 			u.append(bi)
 			return nil
 		}
 		return err
 	}
-	u.append(int(i))
+	u.appendInt(i)
 	return nil
 }
 
@@ -541,31 +1082,31 @@ func loadLong1(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	data, err := u.read(int(length))
+	data, err := u.readTemp(int(length))
 	if err != nil {
 		return err
 	}
 
-	u.append(decodeLong(data))
+	u.appendLong(decodeLong(data))
 	return nil
 }
 
 // push really big long
 func loadLong4(u *Unpickler) error {
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
 	length := decodeInt32(buf)
 	if length < 0 {
-		return fmt.Errorf("LONG pickle has negative byte count")
+		return fmt.Errorf("%w: LONG pickle has negative byte count", ErrCorruptData)
 	}
-	data, err := u.read(length)
+	data, err := u.readTemp(length)
 	if err != nil {
 		return err
 	}
 
-	u.append(decodeLong(data))
+	u.appendLong(decodeLong(data))
 	return nil
 }
 
@@ -596,10 +1137,15 @@ func decodeLong(bytes []byte) interface{} {
 		ux = (ux << 8) | uint64(bytes[i])
 		bitMask = (bitMask << 8) | 0xFF
 	}
+	x := int64(ux)
 	if msBitSet {
-		return -(int(^ux&bitMask) + 1)
+		x = -int64(^ux&bitMask) - 1
+	}
+	if int64(int(x)) != x {
+		// the value does not fit in an int on 32-bit platforms
+		return big.NewInt(x)
 	}
-	return int(ux)
+	return int(x)
 }
 
 // push float object; decimal string argument
@@ -618,7 +1164,7 @@ func loadFloat(u *Unpickler) error {
 
 // push float; arg is 8-byte float encoding
 func loadBinFloat(u *Unpickler) error {
-	buf, err := u.read(8)
+	buf, err := u.readTemp(8)
 	if err != nil {
 		return err
 	}
@@ -635,12 +1181,10 @@ func loadString(u *Unpickler) error {
 	data := line[:len(line)-1]
 	// Strip outermost quotes
 	if !isQuotedString(data) {
-		return fmt.Errorf("the STRING opcode argument must be quoted")
+		return fmt.Errorf("%w: the STRING opcode argument must be quoted", ErrCorruptData)
 	}
 	data = data[1 : len(data)-1]
-	// TODO: decode to string with the desired decoder
-	u.append(string(data))
-	return nil
+	return u.appendString(data)
 }
 
 func isQuotedString(b []byte) bool {
@@ -650,26 +1194,57 @@ func isQuotedString(b []byte) bool {
 // push string; counted binary string argument
 func loadBinString(u *Unpickler) error {
 	// Deprecated BINSTRING uses signed 32-bit length
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
 	length := decodeInt32(buf)
 	if length < 0 {
-		return fmt.Errorf("BINSTRING pickle has negative byte count")
+		return fmt.Errorf("%w: BINSTRING pickle has negative byte count", ErrCorruptData)
 	}
-	data, err := u.read(length)
+	data, err := u.readTemp(length)
 	if err != nil {
 		return err
 	}
-	// TODO: decode to string with the desired decoder
-	u.append(string(data))
+	return u.appendString(data)
+}
+
+// appendString pushes an 8-bit string of a Python 2 pickle, decoded
+// according to the Encoding. The data is not retained.
+func (u *Unpickler) appendString(data []byte) error {
+	switch strings.ToLower(strings.Replace(u.Encoding, "_", "-", -1)) {
+	case "":
+		u.append(u.newString(data))
+	case "bytes":
+		u.append(types.Bytes(append([]byte(nil), data...)))
+	case "latin1", "latin-1", "iso-8859-1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		u.append(string(runes))
+	case "ascii":
+		for i, b := range data {
+			if b >= 0x80 {
+				return fmt.Errorf("cannot decode string as ascii: "+
+					"byte 0x%x at position %d out of range", b, i)
+			}
+		}
+		u.append(u.newString(data))
+	case "utf-8", "utf8":
+		if !utf8.Valid(data) {
+			return fmt.Errorf("cannot decode string as utf-8: %q", data)
+		}
+		u.append(u.newString(data))
+	default:
+		return fmt.Errorf("unsupported string encoding %q", u.Encoding)
+	}
 	return nil
 }
 
 // push bytes; counted binary string argument
 func loadBinBytes(u *Unpickler) error {
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
@@ -678,7 +1253,7 @@ func loadBinBytes(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(buf)
+	u.append(types.Bytes(buf))
 	return nil
 }
 
@@ -688,28 +1263,28 @@ func loadUnicode(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(string(line[:len(line)-1]))
+	u.append(u.newString(line[:len(line)-1]))
 	return nil
 }
 
 // push Unicode string; counted UTF-8 string argument
 func loadBinUnicode(u *Unpickler) error {
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
 	length := int(binary.LittleEndian.Uint32(buf))
-	buf, err = u.read(length)
+	buf, err = u.readTemp(length)
 	if err != nil {
 		return err
 	}
-	u.append(string(buf))
+	u.append(u.newString(buf))
 	return nil
 }
 
 // push very long string
 func loadBinUnicode8(u *Unpickler) error {
-	buf, err := u.read(8)
+	buf, err := u.readTemp(8)
 	if err != nil {
 		return err
 	}
@@ -717,17 +1292,17 @@ func loadBinUnicode8(u *Unpickler) error {
 	if length > math.MaxInt64 {
 		return fmt.Errorf("BINUNICODE8 exceeds system's maximum size")
 	}
-	buf, err = u.read(int(length))
+	buf, err = u.readTemp(int(length))
 	if err != nil {
 		return err
 	}
-	u.append(string(buf)) // TODO: decode UTF-8?
+	u.append(u.newString(buf)) // TODO: decode UTF-8?
 	return nil
 }
 
 // push very long bytes string
 func loadBinBytes8(u *Unpickler) error {
-	buf, err := u.read(8)
+	buf, err := u.readTemp(8)
 	if err != nil {
 		return err
 	}
@@ -739,13 +1314,13 @@ func loadBinBytes8(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(buf)
+	u.append(types.Bytes(buf))
 	return nil
 }
 
 // push bytearray
 func loadByteArray8(u *Unpickler) error {
-	buf, err := u.read(8)
+	buf, err := u.readTemp(8)
 	if err != nil {
 		return err
 	}
@@ -761,6 +1336,31 @@ func loadByteArray8(u *Unpickler) error {
 	return nil
 }
 
+// SetBuffers provides the out-of-band buffers of a pickle of protocol 5,
+// as the buffers argument of Python "pickle.loads", setting NextBuffer and
+// MakeReadOnly. Each NEXT_BUFFER opcode loads the next buffer, in order, as
+// a *types.ByteArray sharing its bytes, which READONLY_BUFFER turns into a
+// types.Bytes copy. Load fails if the pickle refers to more buffers than
+// given. Each call to Load starts again from the first buffer.
+func (u *Unpickler) SetBuffers(buffers [][]byte) {
+	next := new(int)
+	u.nextBuffer = next
+	u.NextBuffer = func() (interface{}, error) {
+		if *next >= len(buffers) {
+			return nil, fmt.Errorf("not enough out-of-band buffers: %d given", len(buffers))
+		}
+		buf := types.NewByteArrayFromSlice(buffers[*next])
+		*next++
+		return buf, nil
+	}
+	u.MakeReadOnly = func(obj interface{}) (interface{}, error) {
+		if buf, ok := obj.(*types.ByteArray); ok {
+			return types.NewBytes(*buf), nil
+		}
+		return obj, nil
+	}
+}
+
 // push next out-of-band buffer
 func loadNextBuffer(u *Unpickler) error {
 	if u.NextBuffer == nil {
@@ -797,13 +1397,11 @@ func loadShortBinString(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	data, err := u.read(int(length))
+	data, err := u.readTemp(int(length))
 	if err != nil {
 		return err
 	}
-	// TODO: decode to string with the desired decoder
-	u.append(string(data))
-	return nil
+	return u.appendString(data)
 }
 
 // push bytes; counted binary string argument < 256 bytes
@@ -816,7 +1414,7 @@ func loadShortBinBytes(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(buf)
+	u.append(types.Bytes(buf))
 	return nil
 }
 
@@ -826,11 +1424,11 @@ func loadShortBinUnicode(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	buf, err := u.read(int(length))
+	buf, err := u.readTemp(int(length))
 	if err != nil {
 		return err
 	}
-	u.append(string(buf))
+	u.append(u.newString(buf))
 	return nil
 }
 
@@ -894,13 +1492,25 @@ func loadTuple3(u *Unpickler) error {
 
 // push empty list
 func loadEmptyList(u *Unpickler) error {
-	u.append(types.NewList())
+	list := types.NewList()
+	if u.Visitor != nil {
+		if err := u.Visitor.BeginList(list); err != nil {
+			return err
+		}
+	}
+	u.append(list)
 	return nil
 }
 
 // push empty dict
 func loadEmptyDict(u *Unpickler) error {
-	u.append(types.NewDict())
+	dict := types.NewDict()
+	if u.Visitor != nil {
+		if err := u.Visitor.BeginDict(dict); err != nil {
+			return err
+		}
+	}
+	u.append(dict)
 	return nil
 }
 
@@ -926,7 +1536,19 @@ func loadList(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(types.NewListFromSlice(items))
+	if u.Visitor == nil {
+		u.append(types.NewListFromSlice(items))
+		return nil
+	}
+	list := types.NewList()
+	if err := u.Visitor.BeginList(list); err != nil {
+		return err
+	}
+	if items, err = u.visitItems(list, items, u.lastMark); err != nil {
+		return err
+	}
+	*list = items
+	u.append(list)
 	return nil
 }
 
@@ -937,6 +1559,14 @@ func loadDict(u *Unpickler) error {
 		return err
 	}
 	d := types.NewDict()
+	if u.Visitor != nil {
+		if err := u.Visitor.BeginDict(d); err != nil {
+			return err
+		}
+		if items, err = u.visitKeyValues(d, items, u.lastMark); err != nil {
+			return err
+		}
+	}
 	itemsLen := len(items)
 	for i := 0; i < itemsLen; i += 2 {
 		d.Set(items[i], items[i+1])
@@ -980,7 +1610,7 @@ func loadObj(u *Unpickler) error {
 		return err
 	}
 	if len(args) == 0 {
-		return fmt.Errorf("OBJ class missing")
+		return fmt.Errorf("%w: OBJ class missing", ErrCorruptData)
 	}
 	class := args[0]
 	args = args[1:]
@@ -1002,6 +1632,9 @@ func (u *Unpickler) instantiate(class interface{}, args []interface{}) error {
 	if err != nil {
 		return err
 	}
+	if err := u.visitObject(value); err != nil {
+		return err
+	}
 	u.append(value)
 	return nil
 }
@@ -1014,7 +1647,7 @@ func loadNewObj(u *Unpickler) error {
 	}
 	argsTuple, argsOk := args.(*types.Tuple)
 	if !argsOk {
-		return fmt.Errorf("NEWOBJ args must be *Tuple")
+		return fmt.Errorf("%w: NEWOBJ args must be *Tuple", ErrCorruptData)
 	}
 
 	rawClass, err := u.stackPop()
@@ -1030,6 +1663,9 @@ func loadNewObj(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
+	if err := u.visitObject(result); err != nil {
+		return err
+	}
 	u.append(result)
 	return nil
 }
@@ -1047,7 +1683,7 @@ func loadNewObjEx(u *Unpickler) error {
 	}
 	argsTuple, argsOk := args.(*types.Tuple)
 	if !argsOk {
-		return fmt.Errorf("NEWOBJ_EX args must be *Tuple")
+		return fmt.Errorf("%w: NEWOBJ_EX args must be *Tuple", ErrCorruptData)
 	}
 
 	rawClass, err := u.stackPop()
@@ -1066,6 +1702,9 @@ func loadNewObjEx(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
+	if err := u.visitObject(result); err != nil {
+		return err
+	}
 	u.append(result)
 	return nil
 }
@@ -1100,7 +1739,7 @@ func loadStackGlobal(u *Unpickler) error {
 	}
 	name, nameOk := rawName.(string)
 	if !nameOk {
-		return fmt.Errorf("STACK_GLOBAL requires str name: %#v", rawName)
+		return fmt.Errorf("%w: STACK_GLOBAL requires str name: %#v", ErrCorruptData, rawName)
 	}
 
 	rawModule, err := u.stackPop()
@@ -1109,7 +1748,7 @@ func loadStackGlobal(u *Unpickler) error {
 	}
 	module, moduleOk := rawModule.(string)
 	if !moduleOk {
-		return fmt.Errorf("STACK_GLOBAL requires str module: %#v", rawModule)
+		return fmt.Errorf("%w: STACK_GLOBAL requires str module: %#v", ErrCorruptData, rawModule)
 	}
 
 	class, err := u.findClass(module, name)
@@ -1122,50 +1761,50 @@ func loadStackGlobal(u *Unpickler) error {
 
 // push object from extension registry; 1-byte index
 func opExt1(u *Unpickler) error {
-	if u.GetExtension == nil {
-		return fmt.Errorf("unsupported extension code encountered")
-	}
 	i, err := u.readOne()
 	if err != nil {
 		return err
 	}
-	obj, err := u.GetExtension(int(i))
-	if err != nil {
-		return err
-	}
-	u.append(obj)
-	return nil
+	return u.loadExtension(int(i))
 }
 
 // ditto, but 2-byte index
 func opExt2(u *Unpickler) error {
-	if u.GetExtension == nil {
-		return fmt.Errorf("unsupported extension code encountered")
-	}
-	buf, err := u.read(2)
+	buf, err := u.readTemp(2)
 	if err != nil {
 		return err
 	}
-	code := int(binary.LittleEndian.Uint16(buf))
-	obj, err := u.GetExtension(code)
-	if err != nil {
-		return err
-	}
-	u.append(obj)
-	return nil
+	return u.loadExtension(int(binary.LittleEndian.Uint16(buf)))
 }
 
 // ditto, but 4-byte index
 func opExt4(u *Unpickler) error {
-	if u.GetExtension == nil {
-		return fmt.Errorf("unsupported extension code encountered")
-	}
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
-	code := int(binary.LittleEndian.Uint32(buf))
-	obj, err := u.GetExtension(code)
+	code := binary.LittleEndian.Uint32(buf)
+	if code > math.MaxInt32 {
+		return fmt.Errorf("%w: EXT specifies code <= 0", ErrCorruptData)
+	}
+	return u.loadExtension(int(code))
+}
+
+// loadExtension pushes the object of an extension code, from the
+// ExtensionRegistry or GetExtension.
+func (u *Unpickler) loadExtension(code int) error {
+	if code <= 0 {
+		return fmt.Errorf("%w: EXT specifies code <= 0", ErrCorruptData)
+	}
+	var obj interface{}
+	var err error
+	if ext, ok := u.ExtensionRegistry[code]; ok {
+		obj, err = u.findClass(ext.Module, ext.Name)
+	} else if u.GetExtension != nil {
+		obj, err = u.GetExtension(code)
+	} else {
+		err = fmt.Errorf("unregistered extension code %d", code)
+	}
 	if err != nil {
 		return err
 	}
@@ -1179,11 +1818,18 @@ func loadReduce(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
+	// Old pickles of objects reduced to a bare callable, with no arguments,
+	// may hold None in place of an empty tuple.
+	if args == nil {
+		args = types.NewTupleFromSlice(nil)
+	}
 	argsTuple, argsOk := args.(*types.Tuple)
 	if !argsOk {
-		return fmt.Errorf("REDUCE args must be *Tuple")
+		return fmt.Errorf("%w: REDUCE args must be *Tuple", ErrCorruptData)
 	}
 
+	// The function may be any Callable, including the result of a previous
+	// REDUCE, such as a functools.partial object.
 	function, err := u.stackPop()
 	if err != nil {
 		return err
@@ -1197,6 +1843,9 @@ func loadReduce(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
+	if err := u.visitObject(result); err != nil {
+		return err
+	}
 	u.append(result)
 	return nil
 }
@@ -1237,8 +1886,7 @@ func loadGet(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(u.memo[i])
-	return nil
+	return u.memoGet(i)
 }
 
 // push item from memo on stack; index is 1-byte arg
@@ -1247,18 +1895,27 @@ func loadBinGet(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.append(u.memo[int(i)])
-	return nil
+	return u.memoGet(int(i))
 }
 
 // push item from memo on stack; index is 4-byte arg
 func loadLongBinGet(u *Unpickler) error {
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
 	i := int(binary.LittleEndian.Uint32(buf))
-	u.append(u.memo[i])
+	return u.memoGet(i)
+}
+
+// memoGet pushes the value stored in the memo at index i, which must have
+// been stored by the same pickle.
+func (u *Unpickler) memoGet(i int) error {
+	value, ok := u.memo[i]
+	if !ok {
+		return fmt.Errorf("%w: memo value not found at index %d", ErrCorruptData, i)
+	}
+	u.append(value)
 	return nil
 }
 
@@ -1273,10 +1930,9 @@ func loadPut(u *Unpickler) error {
 		return err
 	}
 	if i < 0 {
-		return fmt.Errorf("negative PUT argument")
+		return fmt.Errorf("%w: negative PUT argument", ErrCorruptData)
 	}
-	u.memo[i], err = u.stackLast()
-	return err
+	return u.memoPut(i)
 }
 
 // store stack top in memo; index is 1-byte arg
@@ -1285,28 +1941,42 @@ func loadBinPut(u *Unpickler) error {
 	if err != nil {
 		return err
 	}
-	u.memo[int(i)], err = u.stackLast()
-	return err
+	return u.memoPut(int(i))
 }
 
 // store stack top in memo; index is 4-byte arg
 func loadLongBinPut(u *Unpickler) error {
-	buf, err := u.read(4)
+	buf, err := u.readTemp(4)
 	if err != nil {
 		return err
 	}
 	i := int(binary.LittleEndian.Uint32(buf))
-	u.memo[i], err = u.stackLast()
-	return err
+	return u.memoPut(i)
 }
 
 // store top of the stack in memo
 func loadMemoize(u *Unpickler) error {
+	return u.memoPut(u.memoLen)
+}
+
+// memoPut stores the top of the stack in the memo at index i, checking the
+// MaxMemoSize limit for a new entry.
+func (u *Unpickler) memoPut(i int) error {
 	value, err := u.stackLast()
 	if err != nil {
 		return err
 	}
-	u.memo[len(u.memo)] = value
+	_, exists := u.memo[i]
+	if !exists && u.MaxMemoSize > 0 && len(u.memo) >= u.MaxMemoSize {
+		return fmt.Errorf("%w: memo exceeds %d entries", ErrLimitExceeded, u.MaxMemoSize)
+	}
+	if !exists {
+		u.memoLen++
+		if u.Visitor != nil {
+			u.memoJournal = append(u.memoJournal, i)
+		}
+	}
+	u.memo[i] = value
 	return nil
 }
 
@@ -1324,6 +1994,16 @@ func loadAppend(u *Unpickler) error {
 	if !listOk {
 		return fmt.Errorf("APPEND requires ListAppender")
 	}
+	if u.Visitor != nil {
+		keep, err := u.Visitor.Item(list, value)
+		if err != nil {
+			return err
+		}
+		if !keep {
+			u.append(list)
+			return nil
+		}
+	}
 	list.Append(value)
 	u.append(list)
 	return nil
@@ -1341,10 +2021,22 @@ func loadAppends(u *Unpickler) error {
 	}
 	list, listOk := obj.(types.ListAppender)
 	if !listOk {
-		return fmt.Errorf("APPEND requires List")
+		return fmt.Errorf("APPENDS requires ListAppender")
 	}
-	for _, item := range items {
-		list.Append(item)
+	if items, err = u.visitItems(list, items, u.lastMark); err != nil {
+		return err
+	}
+	if l, ok := list.(*types.List); ok {
+		// the items are no longer on the stack, and can be taken as they are
+		if len(*l) == 0 {
+			*l = items
+		} else {
+			*l = append(*l, items...)
+		}
+	} else {
+		for _, item := range items {
+			list.Append(item)
+		}
 	}
 	u.append(list)
 	return nil
@@ -1368,6 +2060,12 @@ func loadSetItem(u *Unpickler) error {
 	if !dictOk {
 		return fmt.Errorf("SETITEM requires DictSetter")
 	}
+	if u.Visitor != nil {
+		keep, err := u.Visitor.KeyValue(dict, key, value)
+		if err != nil || !keep {
+			return err
+		}
+	}
 	dict.Set(key, value)
 	return nil
 }
@@ -1386,6 +2084,9 @@ func loadSetItems(u *Unpickler) error {
 	if !dictOk {
 		return fmt.Errorf("SETITEMS requires DictSetter")
 	}
+	if items, err = u.visitKeyValues(dict, items, u.lastMark); err != nil {
+		return err
+	}
 	itemsLen := len(items)
 	for i := 0; i < itemsLen; i += 2 {
 		dict.Set(items[i], items[i+1])
@@ -1428,6 +2129,10 @@ func loadBuild(u *Unpickler) error {
 	if obj, ok := inst.(types.PyStateSettable); ok {
 		return obj.PySetState(state)
 	}
+	if obj, ok := inst.(*types.GenericObject); ok && !isAttributesState(state) {
+		obj.State = state
+		return nil
+	}
 
 	var slotState interface{}
 	if tuple, ok := state.(*types.Tuple); ok && tuple.Len() == 2 {
@@ -1440,7 +2145,7 @@ func loadBuild(u *Unpickler) error {
 		if !instPdsOk {
 			return fmt.Errorf("BUILD requires a PyDictSettable instance: %#v", inst)
 		}
-		for _, entry := range *stateDict {
+		for _, entry := range stateDict.Entries() {
 			err := instPds.PyDictSet(entry.Key, entry.Value)
 			if err != nil {
 				return err
@@ -1454,7 +2159,7 @@ func loadBuild(u *Unpickler) error {
 			return fmt.Errorf(
 				"BUILD requires a PyAttrSettable instance: %#v", inst)
 		}
-		for _, entry := range *slotStateDict {
+		for _, entry := range slotStateDict.Entries() {
 			sk, keyOk := entry.Key.(string)
 			if !keyOk {
 				return fmt.Errorf("BUILD requires string slot state keys")
@@ -1469,10 +2174,34 @@ func loadBuild(u *Unpickler) error {
 	return nil
 }
 
+// isAttributesState reports whether the state of BUILD sets the
+// attributes of the instance, as the Python default "__setstate__":
+// a dict, or a pair of dicts of the "__dict__" and the slots, either of
+// which may be None.
+func isAttributesState(state interface{}) bool {
+	if tuple, ok := state.(*types.Tuple); ok && tuple.Len() == 2 {
+		for _, item := range *tuple {
+			if _, ok := item.(*types.Dict); !ok && item != nil {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := state.(*types.Dict)
+	return ok || state == nil
+}
+
 // push special markobject on stack
 func loadMark(u *Unpickler) error {
+	if u.MaxDepth > 0 && len(u.metaStack) >= u.MaxDepth {
+		return fmt.Errorf("%w: more than %d nested MARK opcodes (MaxDepth)",
+			ErrLimitExceeded, u.MaxDepth)
+	}
 	u.metaStack = append(u.metaStack, u.stack)
 	u.stack = make([]interface{}, 0, 16)
+	if u.Visitor != nil {
+		u.markJournal = append(u.markJournal, len(u.memoJournal))
+	}
 	return nil
 }
 
@@ -5,10 +5,21 @@
 package pickle
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"io/ioutil"
+	"math"
 	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestNoneP1(t *testing.T) {
@@ -209,6 +220,75 @@ func TestEmptyDictP2(t *testing.T) {
 	}
 }
 
+func TestDictKeysP2(t *testing.T) {
+	// pickle.dumps({(1, 'a'): 'tuple', 2 ** 70: 'big', None: 'none', 'k': 1}, protocol=2)
+	actual := loadsNoErr(t, "\x80\x02}q\x00(K\x01X\x01\x00\x00\x00aq\x01\x86q\x02X\x05\x00\x00\x00tupleq\x03"+
+		"\x8a\x09\x00\x00\x00\x00\x00\x00\x00\x00@X\x03\x00\x00\x00bigq\x04NX\x04\x00\x00\x00noneq\x05"+
+		"X\x01\x00\x00\x00kq\x06K\x01u.")
+	d, ok := actual.(*types.Dict)
+	if !ok {
+		t.Fatal("expected Dict, actual:", actual)
+	}
+	big70 := new(big.Int).Lsh(big.NewInt(1), 70)
+	for _, tc := range []struct {
+		key      interface{}
+		expected interface{}
+	}{
+		{&types.Tuple{1, "a"}, "tuple"},
+		{big70, "big"},
+		{nil, "none"},
+		{"k", 1},
+	} {
+		if value, ok := d.Get(tc.key); !ok || value != tc.expected {
+			t.Errorf("key %v: expected %v, actual %v", tc.key, tc.expected, value)
+		}
+	}
+	for _, key := range []interface{}{&types.Tuple{1, "b"}, &types.Tuple{1}, int64(1) << 62, "K"} {
+		if value, ok := d.Get(key); ok {
+			t.Errorf("key %v: unexpected value %v", key, value)
+		}
+	}
+}
+
+func TestDictRepeatedKeysP0(t *testing.T) {
+	// {'a': 1, 'b': 2}, then 'a' set to 3, as by pickle.loads
+	actual := loadsNoErr(t, "(dp0\nVa\nI1\nsVb\nI2\nsVa\nI3\ns.")
+	d := actual.(*types.Dict)
+	keys := d.Keys()
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("expected keys [a b], actual %v", keys)
+	}
+	if value := d.MustGet("a"); value != 3 {
+		t.Errorf("expected a = 3, actual %v", value)
+	}
+}
+
+func TestDictUnhashableKeys(t *testing.T) {
+	d := types.NewDict()
+	const n = 100000
+	for i := 0; i < n; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	d.Set(&types.List{1}, "list")
+	d.Set(&types.Tuple{&types.List{2}}, "tuple of list")
+	d.Set(&types.List{1}, "list again")
+	if d.Len() != n+2 {
+		t.Errorf("expected %d entries, actual %d", n+2, d.Len())
+	}
+	if value := d.MustGet("99999"); value != 99999 {
+		t.Errorf("expected 99999, actual %v", value)
+	}
+	if value := d.MustGet(&types.List{1}); value != "list again" {
+		t.Errorf("expected the last value of [1], actual %v", value)
+	}
+	if value := d.MustGet(&types.Tuple{&types.List{2}}); value != "tuple of list" {
+		t.Errorf("expected the value of ([2],), actual %v", value)
+	}
+	if last := d.Entries()[d.Len()-1]; last.Value != "tuple of list" {
+		t.Errorf("expected the entries in insertion order, actual last %v", last)
+	}
+}
+
 func TestTupleP0EmptyTuple(t *testing.T) {
 	// pickle.dumps(tuple(), protocol=0)
 	actual := loadsNoErr(t, "(t.")
@@ -396,13 +476,13 @@ func TestBinBytesP3(t *testing.T) {
 			"123456789012345678901234567890123456789012345678901234567890"+
 			"1234567890123456789012345678901234567890q\x00.")
 	switch v := actual.(type) {
-	case []byte:
+	case types.Bytes:
 		expected := []byte(strings.Repeat("1234567890", 26))
-		if string(v) != string(expected) {
+		if !bytes.Equal(v.Bytes(), expected) {
 			t.Errorf("expected %v actual: %v", expected, actual)
 		}
 	default:
-		t.Error("expected []byte, actual:", actual)
+		t.Errorf("expected types.Bytes, actual: %#v", actual)
 	}
 }
 
@@ -410,13 +490,54 @@ func TestShortBinBytesP3(t *testing.T) {
 	// pickle.dumps(b'ab', protocol=3)
 	actual := loadsNoErr(t, "\x80\x03C\x02abq\x00.")
 	switch v := actual.(type) {
-	case []byte:
+	case types.Bytes:
 		expected := []byte{'a', 'b'}
-		if string(v) != string(expected) {
+		if !bytes.Equal(v.Bytes(), expected) {
 			t.Errorf("expected %v actual: %v", expected, actual)
 		}
 	default:
-		t.Error("expected []byte, actual:", actual)
+		t.Errorf("expected types.Bytes, actual: %#v", actual)
+	}
+}
+
+func TestEmptyBytesP2(t *testing.T) {
+	// pickle.dumps(b'', protocol=2)
+	actual := loadsNoErr(t, "\x80\x02c__builtin__\nbytes\nq\x00)Rq\x01.")
+	switch v := actual.(type) {
+	case types.Bytes:
+		if len(v) != 0 {
+			t.Errorf("expected empty types.Bytes, actual: %v", v)
+		}
+	default:
+		t.Errorf("expected types.Bytes, actual: %#v", actual)
+	}
+}
+
+func TestBytesP2(t *testing.T) {
+	// pickle.dumps(b'\x00\xff', protocol=2)
+	actual := loadsNoErr(t, "\x80\x02c_codecs\nencode\nq\x00"+
+		"X\x03\x00\x00\x00\x00\xc3\xbfq\x01X\x06\x00\x00\x00latin1q\x02\x86q\x03Rq\x04.")
+	switch v := actual.(type) {
+	case types.Bytes:
+		expected := []byte{0x00, 0xff}
+		if !bytes.Equal(v.Bytes(), expected) {
+			t.Errorf("expected %v actual: %v", expected, actual)
+		}
+	default:
+		t.Errorf("expected types.Bytes, actual: %#v", actual)
+	}
+}
+
+func TestSetP2(t *testing.T) {
+	// pickle.dumps({1, 2}, protocol=2)
+	actual := loadsNoErr(t, "\x80\x02c__builtin__\nset\nq\x00]q\x01(K\x01K\x02e\x85q\x02Rq\x03.")
+	switch v := actual.(type) {
+	case *types.Set:
+		if v.Len() != 2 || !v.Has(1) || !v.Has(2) {
+			t.Error("expected {1, 2}, actual:", v)
+		}
+	default:
+		t.Error("expected Set, actual:", actual)
 	}
 }
 
@@ -637,6 +758,43 @@ func TestByteArrayP5(t *testing.T) {
 	}
 }
 
+func TestBytesTypes(t *testing.T) {
+	// pickle.dumps(b'ab', protocol=4), with the BINBYTES8 opcode in place
+	// of SHORT_BINBYTES
+	actual := loadsNoErr(t, "\x8e\x02\x00\x00\x00\x00\x00\x00\x00ab.")
+	if _, isSlice := actual.([]byte); isSlice {
+		t.Fatal("expected types.Bytes, actual []byte")
+	}
+	b, ok := actual.(types.Bytes)
+	if !ok || b != "ab" || b.Len() != 2 {
+		t.Fatalf("expected types.Bytes b'ab', actual %#v", actual)
+	}
+	b.Bytes()[0] = 'x'
+	if b != "ab" {
+		t.Errorf("expected types.Bytes to be immutable, actual %#v", b)
+	}
+
+	// pickle.dumps({b'k': bytearray(b'v')}, protocol=5)
+	actual = loadsNoErr(t, "\x80\x05\x95\x13\x00\x00\x00\x00\x00\x00\x00}\x94"+
+		"C\x01k\x94\x96\x01\x00\x00\x00\x00\x00\x00\x00v\x94s.")
+	d, ok := actual.(*types.Dict)
+	if !ok {
+		t.Fatalf("expected *types.Dict, actual %#v", actual)
+	}
+	value, ok := d.Get(types.Bytes("k"))
+	if !ok {
+		t.Fatalf("expected key b'k', actual %#v", d)
+	}
+	ba, ok := value.(*types.ByteArray)
+	if !ok {
+		t.Fatalf("expected *types.ByteArray, actual %#v", value)
+	}
+	ba.Bytes()[0] = 'w'
+	if ba.Get(0) != 'w' {
+		t.Errorf("expected types.ByteArray to be mutable, actual %#v", ba)
+	}
+}
+
 // TODO: test BinPersId
 // TODO: test Get
 // TODO: test BinGet
@@ -652,13 +810,685 @@ func TestByteArrayP5(t *testing.T) {
 // TODO: test Long4
 // TODO: test BinUnicode8
 // TODO: test BinBytes8
-// TODO: test Ext1
-// TODO: test Ext2
-// TODO: test Ext4
-// TODO: test NextBuffer
-// TODO: test ReadOnlyBuffer
 // TODO: test NewObjEx
 
+func TestNormalizeInts(t *testing.T) {
+	testCases := []struct {
+		pickled  string // pickle.dumps(value, protocol)
+		expected interface{}
+	}{
+		{"\x80\x02K*.", int64(42)},
+		{"\x80\x02M\xe8\x03.", int64(1000)},
+		{"\x80\x02J\xff\xff\xff\x7f.", int64(math.MaxInt32)},
+		{"\x80\x02J\x00\x00\x00\x80.", int64(math.MinInt32)},
+		{"\x80\x02\x8a\x05\x00\x00\x00\x80\x00.", int64(math.MaxInt32 + 1)},
+		{"\x80\x02\x8a\x05\xff\xff\xff\x7f\xff.", int64(math.MinInt32 - 1)},
+		{"\x80\x02\x8a\x08\xff\xff\xff\xff\xff\xff\xff\x7f.", int64(math.MaxInt64)},
+		{"\x80\x02\x8a\x08\x00\x00\x00\x00\x00\x00\x00\x80.", int64(math.MinInt64)},
+		// non-minimal LONG1 encoding of 1, within the int64 range
+		{"\x80\x02\x8a\x09\x01\x00\x00\x00\x00\x00\x00\x00\x00.", int64(1)},
+		// protocol 0
+		{"I42\n.", int64(42)},
+		{"I-2147483648\n.", int64(math.MinInt32)},
+		{"L2147483648L\n.", int64(math.MaxInt32 + 1)},
+		{"L-9223372036854775808L\n.", int64(math.MinInt64)},
+	}
+	for _, tc := range testCases {
+		actual := loadsNormalizedNoErr(t, tc.pickled)
+		if actual != tc.expected {
+			t.Errorf("%q: expected %#v, actual %#v", tc.pickled, tc.expected, actual)
+		}
+	}
+
+	t.Run("big integers", func(t *testing.T) {
+		for _, pickled := range []string{
+			"\x80\x02\x8a\x09\x00\x00\x00\x00\x00\x00\x00\x80\x00.", // 2**63
+			"\x80\x02\x8a\x09\xff\xff\xff\xff\xff\xff\xff\x7f\xff.", // -2**63-1
+			"L9223372036854775808L\n.",                              // 2**63
+		} {
+			actual, ok := loadsNormalizedNoErr(t, pickled).(*big.Int)
+			if !ok || actual.IsInt64() {
+				t.Errorf("%q: expected *big.Int out of int64 range, actual %#v", pickled, actual)
+			}
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		// pickle.dumps([1, 1000], protocol=2)
+		actual := loadsNormalizedNoErr(t, "\x80\x02]q\x00(K\x01M\xe8\x03e.")
+		expected := &types.List{int64(1), int64(1000)}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %#v, actual %#v", expected, actual)
+		}
+	})
+}
+
+type addFunction struct{}
+
+func (addFunction) Call(args ...interface{}) (interface{}, error) {
+	sum := 0
+	for _, arg := range args {
+		sum += arg.(int)
+	}
+	return sum, nil
+}
+
+func TestDenyGlobals(t *testing.T) {
+	testCases := []struct {
+		pickled string
+		global  string
+	}{
+		// pickle.dumps of a value whose __reduce__ is (os.system, ('id',)),
+		// with protocols 0 and 4, referencing it as posix.system
+		{"cposix\nsystem\np0\n(Vid\np1\ntp2\nRp3\n.", "posix.system"},
+		{"\x80\x04\x95\x1d\x00\x00\x00\x00\x00\x00\x00\x8c\x05posix\x94" +
+			"\x8c\x06system\x94\x93\x94\x8c\x02id\x94\x85\x94R\x94.", "posix.system"},
+		{"cos\nsystem\n(S'id'\ntR.", "os.system"},
+		{"csubprocess\nPopen\n(S'id'\ntR.", "subprocess.Popen"},
+		{"cbuiltins\neval\n(S'1'\ntR.", "builtins.eval"},
+	}
+	for _, tc := range testCases {
+		u := NewUnpickler(strings.NewReader(tc.pickled))
+		u.FindClass = func(module, name string) (interface{}, error) {
+			t.Errorf("%s: FindClass called for %s.%s", tc.global, module, name)
+			return nil, fmt.Errorf("class not found: %s %s", module, name)
+		}
+		_, err := u.Load()
+		if !errors.Is(err, ErrDangerousGlobal) {
+			t.Errorf("%s: expected ErrDangerousGlobal, actual %v", tc.global, err)
+		} else if !strings.Contains(err.Error(), tc.global) {
+			t.Errorf("%s: expected the global in the error, actual %q", tc.global, err.Error())
+		}
+	}
+
+	t.Run("custom", func(t *testing.T) {
+		u := NewUnpickler(strings.NewReader("cfoo\nBar\n."))
+		u.DenyGlobals = []string{"foo.Bar"}
+		if _, err := u.Load(); !errors.Is(err, ErrDangerousGlobal) {
+			t.Errorf("expected ErrDangerousGlobal, actual %v", err)
+		}
+	})
+
+	t.Run("copied", func(t *testing.T) {
+		defaults := append([]string(nil), DefaultDenyGlobals...)
+		u := NewUnpickler(strings.NewReader("cos\nsystem\n."))
+		u.DenyGlobals[0] = "foo"
+		u.DenyGlobals = append(u.DenyGlobals, "bar")
+		if !reflect.DeepEqual(DefaultDenyGlobals, defaults) {
+			t.Errorf("expected DefaultDenyGlobals %q, actual %q", defaults, DefaultDenyGlobals)
+		}
+		if v := NewUnpickler(strings.NewReader("")); !reflect.DeepEqual(v.DenyGlobals, defaults) {
+			t.Errorf("expected DenyGlobals %q, actual %q", defaults, v.DenyGlobals)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		u := NewUnpickler(strings.NewReader("cos\nsystem\n."))
+		u.DenyGlobals = nil
+		result, err := u.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := types.NewGenericClass("os", "system")
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("expected %#v, actual %#v", expected, result)
+		}
+	})
+}
+
+func TestReducePartial(t *testing.T) {
+	// A value whose __reduce__ is (functools.partial(operator.add, 1), (2,)):
+	// the partial object is rebuilt, then called by a second REDUCE.
+	pickled := "\x80\x02cfunctools\npartial\nq\x00c_operator\nadd\nq\x01\x85q\x02Rq\x03" +
+		"(h\x01K\x01\x85q\x04}q\x05Ntq\x06bK\x02\x85q\x07Rq\x08."
+	u := NewUnpickler(strings.NewReader(pickled))
+	u.FindClass = func(module, name string) (interface{}, error) {
+		if module == "_operator" && name == "add" {
+			return addFunction{}, nil
+		}
+		return nil, fmt.Errorf("class not found: %s %s", module, name)
+	}
+	actual, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != 3 {
+		t.Errorf("expected 3, actual %#v", actual)
+	}
+
+	t.Run("keywords", func(t *testing.T) {
+		// pickle.dumps(functools.partial(operator.add, 1, x=3), protocol=2)
+		pickled := "\x80\x02cfunctools\npartial\nq\x00c_operator\nadd\nq\x01\x85q\x02Rq\x03" +
+			"(h\x01K\x01\x85q\x04}q\x05X\x01\x00\x00\x00xq\x06K\x03sNtq\x07b."
+		partial, ok := loadsNoErr(t, pickled).(*types.Partial)
+		if !ok {
+			t.Fatalf("expected *types.Partial, actual %#v", partial)
+		}
+		if !reflect.DeepEqual(partial.Args, []interface{}{1}) {
+			t.Errorf("unexpected args %#v", partial.Args)
+		}
+		if x, _ := partial.Keywords.Get("x"); x != 3 {
+			t.Errorf("expected keyword x=3, actual %#v", partial.Keywords)
+		}
+	})
+}
+
+// recordingFunction records the arguments of each of its calls.
+type recordingFunction struct {
+	calls [][]interface{}
+}
+
+func (f *recordingFunction) Call(args ...interface{}) (interface{}, error) {
+	f.calls = append(f.calls, args)
+	return len(f.calls), nil
+}
+
+func TestReduceWithoutArgs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pickled string
+	}{
+		// __reduce__: (foo.bar, ())
+		{"empty tuple", "\x80\x02cfoo\nbar\n)R."},
+		{"None", "cfoo\nbar\nNR."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &recordingFunction{}
+			u := NewUnpickler(strings.NewReader(tc.pickled))
+			u.FindClass = func(module, name string) (interface{}, error) {
+				if module == "foo" && name == "bar" {
+					return f, nil
+				}
+				return nil, fmt.Errorf("class not found: %s %s", module, name)
+			}
+			actual, err := u.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != 1 {
+				t.Errorf("expected 1, actual %#v", actual)
+			}
+			if len(f.calls) != 1 || len(f.calls[0]) != 0 {
+				t.Errorf("expected one call without arguments, actual %#v", f.calls)
+			}
+		})
+	}
+
+	_, err := Loads("cfoo\nbar\nK\x01R.")
+	if err == nil || !strings.Contains(err.Error(), "REDUCE args must be *Tuple") {
+		t.Errorf("expected REDUCE args error, actual %v", err)
+	}
+}
+
+func TestLoadRecoversPanics(t *testing.T) {
+	// (foo.bar, (1, 2)) as returned by __reduce__, with protocol 2
+	u := NewUnpickler(strings.NewReader("\x80\x02cfoo\nbar\nK\x01K\x02\x86R."))
+	u.RegisterReducer("foo", "bar", func(args *types.Tuple) (interface{}, error) {
+		return args.Get(0).(string), nil
+	})
+	actual, err := u.Load()
+	if !errors.Is(err, ErrPanic) {
+		t.Fatalf("expected ErrPanic, actual %v", err)
+	}
+	if actual != nil {
+		t.Errorf("expected nil result, actual %#v", actual)
+	}
+	if !strings.Contains(err.Error(), "opcode 0x52 'R' at offset 16: panic while unpickling: interface conversion") {
+		t.Errorf("expected the opcode and the panic in the error, actual %q", err.Error())
+	}
+}
+
+func TestRegisterReducer(t *testing.T) {
+	// (foo.bar, (1, 2)) as returned by __reduce__, with protocol 2
+	pickled := "\x80\x02cfoo\nbar\nK\x01K\x02\x86R."
+	u := NewUnpickler(strings.NewReader(pickled))
+	u.FindClass = func(module, name string) (interface{}, error) {
+		return nil, fmt.Errorf("unexpected FindClass call: %s %s", module, name)
+	}
+	var calls []*types.Tuple
+	u.RegisterReducer("foo", "bar", func(args *types.Tuple) (interface{}, error) {
+		calls = append(calls, args)
+		return args.Get(0).(int) + args.Get(1).(int), nil
+	})
+	actual, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != 3 {
+		t.Errorf("expected 3, actual %#v", actual)
+	}
+	if expected := []*types.Tuple{{1, 2}}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, actual %v", expected, calls)
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		u := NewUnpickler(strings.NewReader(pickled))
+		errBar := errors.New("bar failed")
+		u.RegisterReducer("foo", "bar", func(args *types.Tuple) (interface{}, error) {
+			return nil, errBar
+		})
+		if _, err := u.Load(); !errors.Is(err, errBar) {
+			t.Errorf("expected the reducer error, actual %v", err)
+		}
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		u := NewUnpickler(strings.NewReader(pickled))
+		u.RegisterReducer("foo", "bar", func(args *types.Tuple) (interface{}, error) {
+			return nil, nil
+		})
+		u.RegisterReducer("foo", "bar", nil)
+		actual, err := u.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, ok := actual.(*types.GenericObject)
+		if !ok || obj.Class.Name != "bar" || !reflect.DeepEqual(obj.ConstructorArgs, []interface{}{1, 2}) {
+			t.Errorf("expected a generic object, actual %#v", actual)
+		}
+	})
+
+	t.Run("NEWOBJ", func(t *testing.T) {
+		// class P:
+		//     def __init__(self, x): self.x = x
+		//     def __getnewargs__(self): return (self.x,)
+		//     def __getstate__(self): return [self.x, 'y']
+		// pickle.dumps(foo.P(7), protocol=2)
+		u := NewUnpickler(strings.NewReader("\x80\x02cfoo\nP\nq\x00K\x07\x85q\x01\x81q\x02]q\x03(K\x07X\x01\x00\x00\x00yq\x04eb."))
+		u.RegisterReducer("foo", "P", func(args *types.Tuple) (interface{}, error) {
+			return &testState{args: args}, nil
+		})
+		actual, err := u.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &testState{
+			args:  types.NewTupleFromSlice([]interface{}{7}),
+			state: types.NewListFromSlice([]interface{}{7, "y"}),
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %#v, actual %#v", expected, actual)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		u := NewUnpickler(strings.NewReader("cos\nsystem\n(S'ls'\ntR."))
+		u.RegisterReducer("os", "system", func(args *types.Tuple) (interface{}, error) {
+			return nil, nil
+		})
+		if _, err := u.Load(); !errors.Is(err, ErrDangerousGlobal) {
+			t.Errorf("expected ErrDangerousGlobal, actual %v", err)
+		}
+	})
+}
+
+func TestOutOfBandBuffers(t *testing.T) {
+	// pickle.dumps([bytearray(b'abc'), pickle.PickleBuffer(b'xyz')],
+	//     protocol=5, buffer_callback=buffers.append)
+	// holds the first one in-band, and the second one out-of-band.
+	pickled := "\x80\x05\x95\x14\x00\x00\x00\x00\x00\x00\x00]\x94(" +
+		"\x96\x03\x00\x00\x00\x00\x00\x00\x00abc\x94\x97\x98e."
+	xyz := []byte("xyz")
+	u := NewUnpickler(strings.NewReader(pickled))
+	u.SetBuffers([][]byte{xyz})
+	actual, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &types.List{types.NewByteArrayFromSlice([]byte("abc")), types.Bytes("xyz")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, actual %#v", expected, actual)
+	}
+
+	t.Run("reused", func(t *testing.T) {
+		// the buffers are given again to each load of the same Unpickler
+		u := NewUnpickler(strings.NewReader(pickled + pickled))
+		u.SetBuffers([][]byte{xyz})
+		for i := 0; i < 2; i++ {
+			actual, err := u.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("expected %#v, actual %#v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("writable", func(t *testing.T) {
+		// the same, with pickle.PickleBuffer(bytearray(b'xyz')), without the
+		// READONLY_BUFFER opcode
+		pickled := "\x80\x05\x95\x13\x00\x00\x00\x00\x00\x00\x00]\x94(" +
+			"\x96\x03\x00\x00\x00\x00\x00\x00\x00abc\x94\x97e."
+		u := NewUnpickler(strings.NewReader(pickled))
+		u.SetBuffers([][]byte{xyz})
+		actual, err := u.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := (*actual.(*types.List))[1].(*types.ByteArray)
+		if &(*buf)[0] != &xyz[0] {
+			t.Errorf("expected a ByteArray sharing the buffer, actual %#v", buf)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := Loads(pickled)
+		if err == nil || !strings.Contains(err.Error(), "NextBuffer was not given") {
+			t.Errorf("expected missing NextBuffer error, actual %v", err)
+		}
+		u := NewUnpickler(strings.NewReader(pickled))
+		u.SetBuffers(nil)
+		_, err = u.Load()
+		if err == nil || !strings.Contains(err.Error(), "not enough out-of-band buffers: 0 given") {
+			t.Errorf("expected not enough buffers error, actual %v", err)
+		}
+	})
+}
+
+func TestEncoding(t *testing.T) {
+	// pickle.dumps('\xe9t\xe9', protocol=2) in Python 2, with SHORT_BINSTRING,
+	// and the same string as a BINSTRING
+	pickles := []string{
+		"\x80\x02U\x03\xe9t\xe9q\x00.",
+		"T\x03\x00\x00\x00\xe9t\xe9.",
+	}
+	testCases := []struct {
+		encoding string
+		expected interface{}
+		err      string
+	}{
+		{"", "\xe9t\xe9", ""},
+		{"latin1", "été", ""},
+		{"latin-1", "été", ""},
+		{"bytes", types.Bytes("\xe9t\xe9"), ""},
+		{"ascii", nil, "cannot decode string as ascii"},
+		{"utf-8", nil, "cannot decode string as utf-8"},
+		{"koi8-r", nil, `unsupported string encoding "koi8-r"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.encoding, func(t *testing.T) {
+			for _, pickled := range pickles {
+				u := NewUnpickler(strings.NewReader(pickled))
+				u.Encoding = tc.encoding
+				actual, err := u.Load()
+				if tc.err != "" {
+					if err == nil || !strings.Contains(err.Error(), tc.err) {
+						t.Errorf("%q: expected error %q, actual %v", pickled, tc.err, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%q: %v", pickled, err)
+				}
+				if !reflect.DeepEqual(actual, tc.expected) {
+					t.Errorf("%q: expected %#v, actual %#v", pickled, tc.expected, actual)
+				}
+			}
+		})
+	}
+
+	// ASCII strings are loaded as strings by any text encoding.
+	for _, encoding := range []string{"ascii", "utf-8", "latin1"} {
+		// pickle.dumps('abc', protocol=0) in Python 2
+		u := NewUnpickler(strings.NewReader("S'abc'\np0\n."))
+		u.Encoding = encoding
+		actual, err := u.Load()
+		if err != nil || actual != "abc" {
+			t.Errorf("%s: expected \"abc\", actual %#v, %v", encoding, actual, err)
+		}
+	}
+}
+
+func TestLoadSequence(t *testing.T) {
+	stream := "I42\n." + // pickle.dumps(42, protocol=0)
+		// pickle.dumps(['a', 'a'], protocol=2)
+		"\x80\x02]q\x00(X\x01\x00\x00\x00aq\x01h\x01e." +
+		// pickle.dumps("hello", protocol=4), with a frame
+		"\x80\x04\x95\t\x00\x00\x00\x00\x00\x00\x00\x8c\x05hello\x94." +
+		"tail"
+	expected := []interface{}{42, &types.List{"a", "a"}, "hello"}
+
+	for name, wrap := range map[string]func(io.Reader) io.Reader{
+		"reader":          func(r io.Reader) io.Reader { return r },
+		"one byte reader": iotest.OneByteReader,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := strings.NewReader(stream)
+			u := NewUnpickler(wrap(r))
+			for _, e := range expected {
+				actual, err := u.Load()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(actual, e) {
+					t.Errorf("expected %#v, actual %#v", e, actual)
+				}
+			}
+			if rest, _ := ioutil.ReadAll(r); string(rest) != "tail" {
+				t.Errorf("expected the rest of the stream unread, actual %q", rest)
+			}
+			if _, err := u.Load(); err != io.EOF {
+				t.Errorf("expected io.EOF at the end, actual %v", err)
+			}
+		})
+	}
+
+	t.Run("memo", func(t *testing.T) {
+		// the second pickle gets the memo index 0 stored by the first one
+		u := NewUnpickler(strings.NewReader("\x80\x02K\x01q\x00.\x80\x02h\x00."))
+		if _, err := u.Load(); err != nil {
+			t.Fatal(err)
+		}
+		_, err := u.Load()
+		if !errors.Is(err, ErrCorruptData) || !strings.HasSuffix(err.Error(), "memo value not found at index 0") {
+			t.Errorf("expected a missing memo value, actual %v", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		u := NewUnpickler(strings.NewReader("I1\n.I2\n"))
+		if _, err := u.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.Load(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected io.ErrUnexpectedEOF, actual %v", err)
+		}
+	})
+}
+
+func TestLimits(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pickled string
+		setup   func(u *Unpickler)
+	}{
+		// BINBYTES8 of 2^56 bytes
+		{"huge BINBYTES8", "\x80\x04\x8e\x00\x00\x00\x00\x00\x00\x00\x01", nil},
+		// a FRAME of 2^56 bytes
+		{"huge FRAME", "\x80\x04\x95\x00\x00\x00\x00\x00\x00\x00\x01", nil},
+		{"MaxBytesPerObject", "\x80\x03C\x05abcde.", func(u *Unpickler) {
+			u.MaxBytesPerObject = 4
+		}},
+		{"long text line", "I123456789\n.", func(u *Unpickler) {
+			u.MaxBytesPerObject = 4
+		}},
+		// pickle.dumps([b'abcde', b'fghij'], protocol=3)
+		{"MaxTotalAlloc", "\x80\x03]q\x00(C\x05abcdeq\x01C\x05fghijq\x02e.",
+			func(u *Unpickler) {
+				u.MaxTotalAlloc = 8
+			}},
+		{"MaxDepth", strings.Repeat("(", DefaultMaxDepth+1), nil},
+		{"custom MaxDepth", "\x80\x02(((K\x01ttt.", func(u *Unpickler) {
+			u.MaxDepth = 2
+		}},
+		// pickle.dumps([[], [], []], protocol=2)
+		{"MaxMemoSize", "\x80\x02]q\x00(]q\x01]q\x02]q\x03e.", func(u *Unpickler) {
+			u.MaxMemoSize = 3
+		}},
+		{"MaxMemoSize with MEMOIZE", "\x80\x04]\x94]\x94\x94.", func(u *Unpickler) {
+			u.MaxMemoSize = 1
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := NewUnpickler(strings.NewReader(tc.pickled))
+			if tc.setup != nil {
+				tc.setup(&u)
+			}
+			_, err := u.Load()
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("expected ErrLimitExceeded, actual %v", err)
+			}
+		})
+	}
+
+	// The limits are reset by each call to Load, and off when zero.
+	pickled := "\x80\x03C\x05abcde."
+	u := NewUnpickler(strings.NewReader(pickled + pickled))
+	u.MaxTotalAlloc = 8
+	for i := 0; i < 2; i++ {
+		if _, err := u.Load(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u = NewUnpickler(strings.NewReader(strings.Repeat("(", DefaultMaxDepth+1) + "N."))
+	u.MaxDepth = 0
+	if _, err := u.Load(); err != nil {
+		t.Error(err)
+	}
+
+	// Replacing an entry of the memo does not add to its size.
+	u = NewUnpickler(strings.NewReader("\x80\x02]q\x00q\x00."))
+	u.MaxMemoSize = 1
+	if _, err := u.Load(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAllowGlobals(t *testing.T) {
+	// pickle.dumps(collections.OrderedDict(a=1), protocol=2)
+	pickled := "\x80\x02ccollections\nOrderedDict\nq\x00)Rq\x01X\x01\x00\x00\x00aq\x02K\x01s."
+	for _, allow := range [][]string{{"collections.OrderedDict"}, {"collections"}} {
+		u := NewUnpickler(strings.NewReader(pickled))
+		u.AllowGlobals = allow
+		if _, err := u.Load(); err != nil {
+			t.Errorf("%v: %v", allow, err)
+		}
+	}
+
+	u := NewUnpickler(strings.NewReader(pickled))
+	u.AllowGlobals = []string{"collections.deque"}
+	_, err := u.Load()
+	if !errors.Is(err, ErrGlobalNotAllowed) {
+		t.Errorf("expected ErrGlobalNotAllowed, actual %v", err)
+	} else if !strings.Contains(err.Error(), "collections.OrderedDict") {
+		t.Errorf("expected the global in the error, actual %q", err.Error())
+	}
+
+	// DenyGlobals is checked first
+	u = NewUnpickler(strings.NewReader("cos\nsystem\n(S'id'\ntR."))
+	u.AllowGlobals = []string{"os"}
+	if _, err := u.Load(); !errors.Is(err, ErrDangerousGlobal) {
+		t.Errorf("expected ErrDangerousGlobal, actual %v", err)
+	}
+
+	// an empty, non-nil list denies all the globals
+	u = NewUnpickler(strings.NewReader(pickled))
+	u.AllowGlobals = []string{}
+	if _, err := u.Load(); !errors.Is(err, ErrGlobalNotAllowed) {
+		t.Errorf("expected ErrGlobalNotAllowed, actual %v", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	// pickle.dumps([1, 2, 3], protocol=2)
+	pickled := "\x80\x02]q\x00(K\x01K\x02K\x03e."
+
+	u := NewUnpickler(strings.NewReader(pickled + pickled))
+	u.CollectStats = true
+	for i := 0; i < 2; i++ {
+		if _, err := u.Load(); err != nil {
+			t.Fatal(err)
+		}
+		stats := u.Stats()
+		expected := map[byte]int{
+			'\x80': 1, // PROTO
+			']':    1, // EMPTY_LIST
+			'q':    1, // BINPUT
+			'(':    1, // MARK
+			'K':    3, // BININT1
+			'e':    1, // APPENDS
+			'.':    1, // STOP
+		}
+		if !reflect.DeepEqual(stats.Opcodes, expected) {
+			t.Errorf("load %d: expected opcodes %v, actual %v", i, expected, stats.Opcodes)
+		}
+		if stats.BytesRead != int64(len(pickled)) {
+			t.Errorf("load %d: expected %d bytes read, actual %d",
+				i, len(pickled), stats.BytesRead)
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		u := NewUnpickler(strings.NewReader(pickled))
+		if _, err := u.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if stats := u.Stats(); stats.Opcodes != nil || stats.BytesRead != 0 {
+			t.Errorf("expected no stats, actual %#v", stats)
+		}
+	})
+}
+
+func TestShortReads(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		pickled  string
+		expected interface{}
+	}{
+		{"BINUNICODE", "\x80\x03X\x05\x00\x00\x00hello.", "hello"},
+		{"BINBYTES", "\x80\x03B\x03\x00\x00\x00abc.", types.Bytes("abc")},
+		{"BINSTRING", "T\x03\x00\x00\x00abc.", "abc"},
+		// pickle.dumps("hello", protocol=4), with a frame
+		{"FRAME", "\x80\x04\x95\t\x00\x00\x00\x00\x00\x00\x00\x8c\x05hello\x94.", "hello"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u := NewUnpickler(iotest.OneByteReader(strings.NewReader(tc.pickled)))
+			actual, err := u.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %#v, actual %#v", tc.expected, actual)
+			}
+		})
+	}
+
+	for _, truncated := range []string{
+		"X\x05\x00\x00\x00hel",
+		"X\x05\x00\x00\x00",
+		"B\x05\x00",
+	} {
+		u := NewUnpickler(iotest.OneByteReader(strings.NewReader(truncated)))
+		if _, err := u.Load(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%q: expected io.ErrUnexpectedEOF, actual %v", truncated, err)
+		}
+	}
+}
+
+func loadsNormalizedNoErr(t *testing.T, s string) interface{} {
+	t.Helper()
+	u := NewUnpickler(strings.NewReader(s))
+	u.NormalizeInts = true
+	result, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
 func loadsNoErrEqual(t *testing.T, s string, expected interface{}) {
 	actual := loadsNoErr(t, s)
 	if actual != expected {
@@ -673,3 +1503,638 @@ func loadsNoErr(t *testing.T, s string) interface{} {
 	}
 	return result
 }
+
+func TestStdlibClasses(t *testing.T) {
+	// pickle.dumps([
+	//     datetime.datetime(2020, 1, 2, 3, 4, 5, 678901),
+	//     datetime.datetime(2020, 1, 2, tzinfo=datetime.timezone(datetime.timedelta(hours=2), 'X')),
+	//     datetime.datetime(2020, 1, 2, tzinfo=datetime.timezone(datetime.timedelta(hours=-5, minutes=-30))),
+	//     datetime.date(2020, 1, 2),
+	//     datetime.timedelta(days=-1, seconds=5, microseconds=7),
+	//     decimal.Decimal('1.50'),
+	//     uuid.UUID('12345678-1234-5678-1234-567812345678'),
+	//     pathlib.PosixPath('/usr/lib'),
+	//     pathlib.PureWindowsPath('C:/a/b'),
+	// ], protocol=2)
+	pickled := "\x80\x02]q\x00(cdatetime\ndatetime\nq\x01c_codecs\nencode\nq\x02X\x0c\x00\x00\x00\x07\xc3\xa4\x01\x02" +
+		"\x03\x04\x05\n[\xc3\xb5q\x03X\x06\x00\x00\x00latin1q\x04\x86q\x05Rq\x06\x85q\x07Rq\x08h\x01h\x02X\x0b" +
+		"\x00\x00\x00\x07\xc3\xa4\x01\x02\x00\x00\x00\x00\x00\x00q\x09h\x04\x86q\nRq\x0bcdatetime\ntimezone\n" +
+		"q\x0ccdatetime\ntimedelta\nq\x0dK\x00M \x1cK\x00\x87q\x0eRq\x0fX\x01\x00\x00\x00Xq\x10\x86q\x11Rq\x12" +
+		"\x86q\x13Rq\x14h\x01h\x02X\x0b\x00\x00\x00\x07\xc3\xa4\x01\x02\x00\x00\x00\x00\x00\x00q\x15h\x04\x86" +
+		"q\x16Rq\x17h\x0ch\x0dJ\xff\xff\xff\xffJ(\x04\x01\x00K\x00\x87q\x18Rq\x19\x85q\x1aRq\x1b\x86q\x1cRq\x1d" +
+		"cdatetime\ndate\nq\x1eh\x02X\x05\x00\x00\x00\x07\xc3\xa4\x01\x02q\x1fh\x04\x86q Rq!\x85q\"Rq#h\x0dJ\xff" +
+		"\xff\xff\xffK\x05K\x07\x87q$Rq%cdecimal\nDecimal\nq&X\x04\x00\x00\x001.50q'\x85q(Rq)cuuid\nUUID\nq*)" +
+		"\x81q+}q,X\x03\x00\x00\x00intq-\x8a\x10xV4\x12xV4\x12xV4\x12xV4\x12sbcpathlib\nPosixPath\nq.X\x01\x00" +
+		"\x00\x00/q/X\x03\x00\x00\x00usrq0X\x03\x00\x00\x00libq1\x87q2Rq3cpathlib\nPureWindowsPath\nq4X\x03\x00" +
+		"\x00\x00C:\\q5X\x01\x00\x00\x00aq6X\x01\x00\x00\x00bq7\x87q8Rq9e."
+	list, ok := loadsNoErr(t, pickled).(*types.List)
+	if !ok || list.Len() != 9 {
+		t.Fatalf("expected a list of 9 items, actual %#v", list)
+	}
+
+	expectedTimes := []string{
+		"2020-01-02T03:04:05.678901Z",
+		"2020-01-02T00:00:00+02:00",
+		"2020-01-02T00:00:00-05:30",
+		"2020-01-02T00:00:00Z",
+	}
+	for i, expected := range expectedTimes {
+		actual, ok := list.Get(i).(time.Time)
+		if !ok || actual.Format(time.RFC3339Nano) != expected {
+			t.Errorf("%d: expected time %s, actual %#v", i, expected, list.Get(i))
+		}
+	}
+	if name, _ := list.Get(1).(time.Time).Zone(); name != "X" {
+		t.Errorf("expected timezone X, actual %s", name)
+	}
+	if name, _ := list.Get(2).(time.Time).Zone(); name != "UTC-05:30" {
+		t.Errorf("expected timezone UTC-05:30, actual %s", name)
+	}
+
+	expectedDuration := -24*time.Hour + 5*time.Second + 7*time.Microsecond
+	if actual := list.Get(4); actual != expectedDuration {
+		t.Errorf("expected duration %v, actual %#v", expectedDuration, actual)
+	}
+
+	decimal, ok := list.Get(5).(types.Decimal)
+	if !ok || decimal != "1.50" {
+		t.Errorf("expected decimal 1.50, actual %#v", list.Get(5))
+	} else if r, ok := decimal.Rat(); !ok || r.RatString() != "3/2" {
+		t.Errorf("expected rational 3/2, actual %v", r)
+	}
+
+	uuid, ok := list.Get(6).(*types.UUID)
+	if !ok || uuid.String() != "12345678-1234-5678-1234-567812345678" {
+		t.Errorf("expected UUID 12345678-1234-5678-1234-567812345678, actual %#v", list.Get(6))
+	}
+
+	if actual := list.Get(7); actual != "/usr/lib" {
+		t.Errorf("expected path /usr/lib, actual %#v", actual)
+	}
+	if actual := list.Get(8); actual != `C:\a\b` {
+		t.Errorf(`expected path C:\a\b, actual %#v`, actual)
+	}
+
+	// pickle.dumps(datetime.date(2020, 1, 2), protocol=2)  # Python 2.7
+	date := loadsNoErr(t, "\x80\x02cdatetime\ndate\nq\x00U\x04\x07\xe4\x01\x02\x85Rq\x01.")
+	if actual, ok := date.(time.Time); !ok || !actual.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected date 2020-01-02, actual %#v", date)
+	}
+
+	if _, err := Loads("\x80\x02cdatetime\ndate\nq\x00U\x04\x07\xe4\x0d\x02\x85Rq\x01."); err == nil {
+		t.Errorf("expected error for month 13")
+	}
+}
+
+func TestCollections(t *testing.T) {
+	// pickle.dumps(collections.defaultdict(list, {'a': [1]}), protocol=2)
+	obj := loadsNoErr(t, "\x80\x02ccollections\ndefaultdict\nq\x00c__builtin__\nlist\nq\x01\x85q\x02Rq\x03X\x01\x00\x00\x00aq\x04]q\x05K\x01as.")
+	dd, ok := obj.(*types.DefaultDict)
+	if !ok {
+		t.Fatalf("expected *types.DefaultDict, actual %#v", obj)
+	}
+	if class, ok := dd.DefaultFactory.(*types.GenericClass); !ok || class.Name != "list" {
+		t.Errorf("expected list default factory, actual %#v", dd.DefaultFactory)
+	}
+	if v, ok := dd.Get("a"); !ok || !reflect.DeepEqual(v, types.NewListFromSlice([]interface{}{1})) {
+		t.Errorf("expected a: [1], actual %#v", v)
+	}
+
+	// pickle.dumps(collections.defaultdict(), protocol=2)
+	obj = loadsNoErr(t, "\x80\x02ccollections\ndefaultdict\nq\x00)Rq\x01.")
+	if dd, ok := obj.(*types.DefaultDict); !ok || dd.DefaultFactory != nil || dd.Len() != 0 {
+		t.Errorf("expected empty defaultdict, actual %#v", obj)
+	}
+
+	// pickle.dumps(collections.Counter('aab'), protocol=2)
+	obj = loadsNoErr(t, "\x80\x02ccollections\nCounter\nq\x00}q\x01(X\x01\x00\x00\x00aq\x02K\x02X\x01\x00\x00\x00bq\x03K\x01u\x85q\x04Rq\x05.")
+	counter, ok := obj.(*types.Counter)
+	if !ok {
+		t.Fatalf("expected *types.Counter, actual %#v", obj)
+	}
+	expected := []types.DictEntry{{Key: "a", Value: 2}, {Key: "b", Value: 1}}
+	if actual := counter.Entries(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+
+	// pickle.dumps(collections.deque([1, 2], maxlen=5), protocol=2)
+	obj = loadsNoErr(t, "\x80\x02ccollections\ndeque\nq\x00)K\x05\x86q\x01Rq\x02(K\x01K\x02e.")
+	deque, ok := obj.(*types.Deque)
+	if !ok || deque.MaxLen != 5 || !reflect.DeepEqual(deque.Items, types.List{1, 2}) {
+		t.Errorf("expected deque([1, 2], maxlen=5), actual %#v", obj)
+	}
+	obj = loadsNormalizedNoErr(t, "\x80\x02ccollections\ndeque\nq\x00)K\x05\x86q\x01Rq\x02(K\x01K\x02e.")
+	deque, ok = obj.(*types.Deque)
+	if !ok || deque.MaxLen != 5 || !reflect.DeepEqual(deque.Items, types.List{int64(1), int64(2)}) {
+		t.Errorf("expected deque([1, 2], maxlen=5) with normalized ints, actual %#v", obj)
+	}
+
+	// pickle.dumps(collections.deque([3]), protocol=2)
+	obj = loadsNoErr(t, "\x80\x02ccollections\ndeque\nq\x00)Rq\x01K\x03a.")
+	deque, ok = obj.(*types.Deque)
+	if !ok || deque.MaxLen != -1 || !reflect.DeepEqual(deque.Items, types.List{3}) {
+		t.Errorf("expected deque([3]), actual %#v", obj)
+	}
+
+	d := &types.Deque{MaxLen: 2}
+	for i := 0; i < 3; i++ {
+		d.Append(i)
+	}
+	if !reflect.DeepEqual(d.Items, types.List{1, 2}) {
+		t.Errorf("expected bounded deque [1, 2], actual %v", d.Items)
+	}
+
+	// Point = collections.namedtuple('Point', 'x y')
+	// pickle.dumps(Point(1, 2), protocol=2)
+	obj = loadsNoErr(t, "\x80\x02c__main__\nPoint\nq\x00K\x01K\x02\x86q\x01\x81q\x02.")
+	point, ok := obj.(*types.GenericObject)
+	if !ok || point.Class.Name != "Point" || !reflect.DeepEqual(point.ConstructorArgs, []interface{}{1, 2}) {
+		t.Errorf("expected Point(1, 2), actual %#v", obj)
+	}
+}
+
+func TestOpError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pickled  string
+		offset   int64
+		opcode   byte
+		expected error
+	}{
+		{"unknown opcode", "\x80\x02K\x01\xff.", 4, 0xff, ErrUnknownOpcode},
+		{"truncated", "\x80\x02X\x05\x00\x00\x00hel", 2, 'X', io.ErrUnexpectedEOF},
+		{"no STOP", "\x80\x02K\x01", 4, 0, io.ErrUnexpectedEOF},
+		{"empty stack", "\x80\x02K\x01a.", 4, 'a', ErrCorruptData},
+		{"missing memo", "\x80\x02K\x01h\x03.", 4, 'h', ErrCorruptData},
+		// the offsets within a frame are those of the whole pickle
+		{"framed", "\x80\x04\x95\x04\x00\x00\x00\x00\x00\x00\x00K\x01h\x03.", 13, 'h', ErrCorruptData},
+		{"class not found", "\x80\x02N\x8c\x03foo\x8c\x03bar\x93.", 13, 0x93, ErrClassNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := NewUnpickler(strings.NewReader(tc.pickled))
+			u.FindClass = func(module, name string) (interface{}, error) {
+				return nil, &ClassNotFoundError{Module: module, Name: name}
+			}
+			_, err := u.Load()
+			var opErr *OpError
+			if !errors.As(err, &opErr) {
+				t.Fatalf("expected an *OpError, actual %#v", err)
+			}
+			if opErr.Offset != tc.offset || opErr.Opcode != tc.opcode {
+				t.Errorf("expected opcode 0x%02x at offset %d, actual %v", tc.opcode, tc.offset, err)
+			}
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v, actual %v", tc.expected, err)
+			}
+		})
+	}
+
+	u := NewUnpickler(strings.NewReader("\x80\x02cfoo\nbar\n."))
+	u.FindClass = func(module, name string) (interface{}, error) {
+		return nil, &ClassNotFoundError{Module: module, Name: name, Reason: "not a builtin"}
+	}
+	_, err := u.Load()
+	var notFound *ClassNotFoundError
+	if !errors.As(err, &notFound) || notFound.Module != "foo" || notFound.Name != "bar" {
+		t.Fatalf("expected a *ClassNotFoundError, actual %#v", err)
+	}
+	expected := "pickle: opcode 0x63 'c' at offset 2: class not found: foo bar: not a builtin"
+	if err.Error() != expected {
+		t.Errorf("expected %q, actual %q", expected, err.Error())
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	// copyreg.add_extension('collections', 'OrderedDict', 0xab)
+	// copyreg.add_extension('collections', 'Counter', 0x1234)
+	// copyreg.add_extension('collections', 'deque', 0x12345678)
+	registry := map[int]Extension{
+		0xab:       {Module: "collections", Name: "OrderedDict"},
+		0x1234:     {Module: "collections", Name: "Counter"},
+		0x12345678: {Module: "collections", Name: "deque"},
+	}
+	testCases := []struct {
+		pickled  string // pickle.dumps(value, protocol=2)
+		expected interface{}
+	}{
+		{"\x80\x02\x82\xab.", &types.OrderedDictClass{}},
+		{"\x80\x02\x834\x12.", &types.CounterClass{}},
+		{"\x80\x02\x84xV4\x12.", &types.DequeClass{}},
+	}
+	for _, tc := range testCases {
+		u := NewUnpickler(strings.NewReader(tc.pickled))
+		u.ExtensionRegistry = registry
+		actual, err := u.Load()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.pickled, err)
+		} else if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%q: expected %#v, actual %#v", tc.pickled, tc.expected, actual)
+		}
+	}
+
+	// pickle.dumps([collections.OrderedDict(a=1)], protocol=2)
+	u := NewUnpickler(strings.NewReader("\x80\x02]q\x00\x82\xab)Rq\x01X\x01\x00\x00\x00aq\x02K\x01sa."))
+	u.ExtensionRegistry = registry
+	obj, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := obj.(*types.List)
+	if od, ok := list.Get(0).(*types.OrderedDict); !ok || od.Len() != 1 {
+		t.Errorf("expected OrderedDict(a=1), actual %#v", list.Get(0))
+	}
+
+	// the codes not in the registry are passed to GetExtension
+	u = NewUnpickler(strings.NewReader("\x80\x02\x82\x07."))
+	u.ExtensionRegistry = registry
+	u.GetExtension = func(code int) (interface{}, error) {
+		return code, nil
+	}
+	if obj, err := u.Load(); err != nil || obj != 7 {
+		t.Errorf("expected 7 from GetExtension, actual %#v, %v", obj, err)
+	}
+
+	u = NewUnpickler(strings.NewReader("\x80\x02\x82\x07."))
+	if _, err := u.Load(); err == nil || !strings.HasSuffix(err.Error(), "unregistered extension code 7") {
+		t.Errorf("expected unregistered extension code error, actual %v", err)
+	}
+	u = NewUnpickler(strings.NewReader("\x80\x02\x82\x00."))
+	u.ExtensionRegistry = registry
+	if _, err := u.Load(); err == nil {
+		t.Errorf("expected error for extension code 0")
+	}
+
+	// the globals of the registry are checked against DenyGlobals
+	u = NewUnpickler(strings.NewReader("\x80\x02\x82\x01."))
+	u.ExtensionRegistry = map[int]Extension{1: {Module: "os", Name: "system"}}
+	if _, err := u.Load(); !errors.Is(err, ErrDangerousGlobal) {
+		t.Errorf("expected ErrDangerousGlobal, actual %v", err)
+	}
+}
+
+// testState is an object which keeps its arguments and its state.
+type testState struct {
+	args  *types.Tuple
+	state interface{}
+}
+
+func (s *testState) PySetState(state interface{}) error {
+	s.state = state
+	return nil
+}
+
+func TestGenericObjectState(t *testing.T) {
+	// class Q:
+	//     def __reduce__(self): return (Q, (1, 2), {'a': 3})
+	// pickle.dumps(foo.Q(), protocol=2)
+	actual := loadsNoErr(t, "\x80\x02cfoo\nQ\nq\x00K\x01K\x02\x86q\x01Rq\x02}q\x03X\x01\x00\x00\x00aq\x04K\x03sb.")
+	obj, ok := actual.(*types.GenericObject)
+	if !ok {
+		t.Fatalf("expected *types.GenericObject, actual %#v", actual)
+	}
+	if !reflect.DeepEqual(obj.ConstructorArgs, []interface{}{1, 2}) {
+		t.Errorf("expected constructor args [1 2], actual %v", obj.ConstructorArgs)
+	}
+	if v, _ := obj.Dict.Get("a"); v != 3 || obj.State != nil {
+		t.Errorf("expected attribute a=3 without state, actual %#v", obj)
+	}
+
+	// the state of foo.P(7), as above, without a reducer
+	actual = loadsNoErr(t, "\x80\x02cfoo\nP\nq\x00K\x07\x85q\x01\x81q\x02]q\x03(K\x07X\x01\x00\x00\x00yq\x04eb.")
+	obj, ok = actual.(*types.GenericObject)
+	if !ok {
+		t.Fatalf("expected *types.GenericObject, actual %#v", actual)
+	}
+	if expected := types.NewListFromSlice([]interface{}{7, "y"}); !reflect.DeepEqual(obj.State, expected) || obj.Dict != nil {
+		t.Errorf("expected state %v, actual %#v", expected, obj)
+	}
+}
+
+func TestGenericObjectItems(t *testing.T) {
+	// class Cfg(dict): pass
+	// cfg = foo.Cfg(lr=0.5); cfg.name = 'x'
+	// pickle.dumps(cfg, protocol=2)
+	actual := loadsNoErr(t, "\x80\x02cfoo\nCfg\nq\x00)\x81q\x01X\x02\x00\x00\x00lrq\x02G?\xe0\x00\x00\x00\x00\x00\x00s}q\x03X\x04\x00\x00\x00nameq\x04X\x01\x00\x00\x00xq\x05sb.")
+	cfg, ok := actual.(*types.GenericObject)
+	if !ok {
+		t.Fatalf("expected *types.GenericObject, actual %#v", actual)
+	}
+	if cfg.DictItems == nil || cfg.DictItems.MustGet("lr") != 0.5 {
+		t.Errorf("expected item lr=0.5, actual %#v", cfg.DictItems)
+	}
+	if cfg.Dict == nil || cfg.Dict.MustGet("name") != "x" {
+		t.Errorf("expected attribute name=x, actual %#v", cfg.Dict)
+	}
+	var m map[string]interface{}
+	if err := Decode(cfg, &m); err != nil || !reflect.DeepEqual(m, map[string]interface{}{"lr": 0.5}) {
+		t.Errorf("expected to decode the items, actual %v, %v", m, err)
+	}
+
+	// class Seq(list): pass
+	// pickle.dumps(foo.Seq([1, 2]), protocol=2)
+	actual = loadsNoErr(t, "\x80\x02cfoo\nSeq\nq\x00)\x81q\x01(K\x01K\x02e.")
+	seq, ok := actual.(*types.GenericObject)
+	if !ok || !reflect.DeepEqual(seq.ListItems, []interface{}{1, 2}) {
+		t.Errorf("expected list items [1 2], actual %#v", actual)
+	}
+	var items []int
+	if err := Decode(seq, &items); err != nil || !reflect.DeepEqual(items, []int{1, 2}) {
+		t.Errorf("expected to decode the items, actual %v, %v", items, err)
+	}
+}
+
+// recordingVisitor logs the events of an Unpickler, discarding the items
+// which are dicts.
+type recordingVisitor struct {
+	events []string
+}
+
+func (v *recordingVisitor) BeginList(*types.List) error {
+	v.events = append(v.events, "list")
+	return nil
+}
+
+func (v *recordingVisitor) Item(_ interface{}, item interface{}) (bool, error) {
+	_, isDict := item.(*types.Dict)
+	v.events = append(v.events, fmt.Sprintf("item %T", item))
+	return !isDict, nil
+}
+
+func (v *recordingVisitor) BeginDict(*types.Dict) error {
+	v.events = append(v.events, "dict")
+	return nil
+}
+
+func (v *recordingVisitor) KeyValue(_ interface{}, key, value interface{}) (bool, error) {
+	v.events = append(v.events, fmt.Sprintf("key %v", key))
+	return key != "skip", nil
+}
+
+func (v *recordingVisitor) Object(obj interface{}) error {
+	v.events = append(v.events, fmt.Sprintf("object %T", obj))
+	return nil
+}
+
+func TestVisitor(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		pickled string
+		events  []string
+		memo    []int
+	}{
+		{
+			// pickle.dumps([{'a': [i]} for i in range(3)], protocol=2)
+			name:    "batches",
+			pickled: "\x80\x02]q\x00(}q\x01X\x01\x00\x00\x00aq\x02]q\x03K\x00as}q\x04h\x02]q\x05K\x01as}q\x06h\x02]q\x07K\x02ase.",
+			events: []string{
+				"list",
+				"dict", "list", "item int", "key a",
+				"dict", "list", "item int", "key a",
+				"dict", "list", "item int", "key a",
+				"item *types.Dict", "item *types.Dict", "item *types.Dict",
+			},
+			// only the list and the shared key are left in the memo
+			memo: []int{0, 2},
+		},
+		{
+			// pickle.dumps([{'a': 1}, {'a': 2}], protocol=0)
+			name:    "protocol 0",
+			pickled: "(lp0\n(dp1\nVa\np2\nI1\nsa(dp3\ng2\nI2\nsa.",
+			events: []string{
+				"list", "dict", "key a", "item *types.Dict", "dict", "key a", "item *types.Dict",
+			},
+			memo: []int{0, 1, 2, 3},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &recordingVisitor{}
+			u := NewUnpickler(strings.NewReader(tc.pickled))
+			u.Visitor = v
+			result, err := u.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if list, ok := result.(*types.List); !ok || list.Len() != 0 {
+				t.Errorf("expected an empty list, actual %#v", result)
+			}
+			if !reflect.DeepEqual(v.events, tc.events) {
+				t.Errorf("expected events %q, actual %q", tc.events, v.events)
+			}
+			var memo []int
+			for i := range u.memo {
+				memo = append(memo, i)
+			}
+			sort.Ints(memo)
+			if !reflect.DeepEqual(memo, tc.memo) {
+				t.Errorf("expected memo indices %v, actual %v", tc.memo, memo)
+			}
+		})
+	}
+
+	t.Run("objects", func(t *testing.T) {
+		// pickle.dumps({'x': Foo(), 'skip': 1}, protocol=2), with Foo in __main__
+		pickled := "\x80\x02}q\x00(X\x01\x00\x00\x00xq\x01c__main__\nFoo\nq\x02)\x81q\x03X\x04\x00\x00\x00skipq\x04K\x01u."
+		v := &recordingVisitor{}
+		u := NewUnpickler(strings.NewReader(pickled))
+		u.Visitor = v
+		result, err := u.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"dict", "object *types.GenericObject", "key x", "key skip"}
+		if !reflect.DeepEqual(v.events, expected) {
+			t.Errorf("expected events %q, actual %q", expected, v.events)
+		}
+		if d := result.(*types.Dict); d.Len() != 1 {
+			t.Errorf("expected 1 entry, actual %d", d.Len())
+		}
+	})
+}
+
+func TestVisitorSharedContainer(t *testing.T) {
+	// s = [0]; pickle.dumps(([{'skip': s}, {'keep': s}], s), protocol=2)
+	pickled := "\x80\x02]q\x00(}q\x01X\x04\x00\x00\x00skipq\x02]q\x03K\x00as}q\x04X\x04\x00\x00\x00keepq\x05h\x03seh\x03\x86q\x06."
+	u := NewUnpickler(strings.NewReader(pickled))
+	u.Visitor = skipVisitor{}
+	result, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tuple := result.(*types.Tuple)
+	records := tuple.Get(0).(*types.List)
+	if records.Len() != 1 {
+		t.Fatalf("expected 1 record, actual %v", records)
+	}
+	shared := records.Get(0).(*types.Dict).MustGet("keep")
+	if shared != tuple.Get(1) || !reflect.DeepEqual(shared, types.NewListFromSlice([]interface{}{0})) {
+		t.Errorf("expected the same list [0] in the record and in the tuple, actual %#v", tuple)
+	}
+}
+
+func TestVisitorMemoizeAfterForget(t *testing.T) {
+	// pickle.dumps([[{'skip': [1]}, {'k': 2}], 'tail', 'tail'], protocol=4)
+	pickled := "\x80\x04\x95*\x00\x00\x00\x00\x00\x00\x00]\x94(]\x94(}\x94\x8c\x04skip\x94]\x94K\x01as}\x94\x8c\x01k\x94K\x02se\x8c\x04tail\x94h\x07e."
+	u := NewUnpickler(strings.NewReader(pickled))
+	u.Visitor = skipVisitor{}
+	result, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := types.NewDict()
+	record.Set("k", 2)
+	expected := types.NewListFromSlice([]interface{}{
+		types.NewListFromSlice([]interface{}{record}), "tail", "tail",
+	})
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %#v, actual %#v", expected, result)
+	}
+}
+
+// skipVisitor discards the dicts with a "skip" key.
+type skipVisitor struct {
+	NopVisitor
+}
+
+func (skipVisitor) Item(_ interface{}, item interface{}) (bool, error) {
+	if d, ok := item.(*types.Dict); ok {
+		_, skip := d.Get("skip")
+		return !skip, nil
+	}
+	return true, nil
+}
+
+func TestStringPool(t *testing.T) {
+	// pickle.dumps(['tok' + str(i % 3) for i in range(6)], protocol=4)
+	pickled := "\x80\x04\x95/\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x04tok0\x94\x8c\x04tok1\x94\x8c\x04tok2\x94\x8c\x04tok0\x94\x8c\x04tok1\x94\x8c\x04tok2\x94e."
+	expected := types.NewListFromSlice([]interface{}{"tok0", "tok1", "tok2", "tok0", "tok1", "tok2"})
+
+	pool := NewStringPool(0, 0)
+	for i := 0; i < 2; i++ {
+		u := NewUnpickler(strings.NewReader(pickled))
+		u.Strings = pool
+		result, err := u.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("expected %v, actual %v", expected, result)
+		}
+		if pool.Len() != 3 {
+			t.Errorf("expected 3 strings in the pool, actual %d", pool.Len())
+		}
+	}
+
+	t.Run("limits", func(t *testing.T) {
+		pool := NewStringPool(3, 2)
+		for _, s := range []string{"a", "abcd", "b", "c", "a"} {
+			if actual := pool.Intern([]byte(s)); actual != s {
+				t.Errorf("expected %q, actual %q", s, actual)
+			}
+		}
+		if pool.Len() != 2 {
+			t.Errorf("expected 2 strings in the pool, actual %d", pool.Len())
+		}
+	})
+}
+
+func TestSizeHint(t *testing.T) {
+	for _, tc := range []struct {
+		sizeHint    int64
+		maxMemoSize int
+		expected    int
+	}{
+		{0, 0, 256 + 128},
+		{1000, 0, 256 + 128},
+		{1 << 20, 0, 1 << 16},
+		{1 << 40, 0, maxMemoCapacity},
+		{1 << 20, 100, 100},
+	} {
+		u := NewUnpickler(strings.NewReader(""))
+		u.SizeHint = tc.sizeHint
+		u.MaxMemoSize = tc.maxMemoSize
+		if actual := u.memoCapacity(); actual != tc.expected {
+			t.Errorf("SizeHint %d, MaxMemoSize %d: expected %d, actual %d",
+				tc.sizeHint, tc.maxMemoSize, tc.expected, actual)
+		}
+	}
+}
+
+func BenchmarkLoadStrings(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString("\x80\x02]q\x00(")
+	for i := 0; i < 100000; i++ {
+		token := fmt.Sprintf("token%d", i%100)
+		buf.WriteString("X")
+		buf.Write([]byte{byte(len(token)), 0, 0, 0})
+		buf.WriteString(token)
+	}
+	buf.WriteString("e.")
+	pickled := buf.Bytes()
+
+	for _, pool := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pool=%v", pool), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				u := NewUnpickler(bytes.NewReader(pickled))
+				if pool {
+					u.Strings = NewStringPool(64, 0)
+				}
+				if _, err := u.Load(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	// pickle.dumps(bytearray(b'ab\xff'), protocol=2)
+	actual := loadsNoErr(t, "\x80\x02c__builtin__\nbytearray\nq\x00c_codecs\nencode\nq\x01X\x04\x00\x00\x00ab\xc3\xbfq\x02X\x06\x00\x00\x00latin1q\x03\x86q\x04Rq\x05\x85q\x06Rq\x07.")
+	if b, ok := actual.(*types.ByteArray); !ok || !bytes.Equal(b.Bytes(), []byte("ab\xff")) {
+		t.Errorf("expected bytearray ab\\xff, actual %#v", actual)
+	}
+	// pickle.dumps(bytearray(b'ab'), protocol=3)
+	actual = loadsNoErr(t, "\x80\x03cbuiltins\nbytearray\nq\x00C\x02abq\x01\x85q\x02Rq\x03.")
+	if b, ok := actual.(*types.ByteArray); !ok || !bytes.Equal(b.Bytes(), []byte("ab")) {
+		t.Errorf("expected bytearray ab, actual %#v", actual)
+	}
+	// pickle.dumps(frozenset([1]), protocol=2)
+	actual = loadsNoErr(t, "\x80\x02c__builtin__\nfrozenset\nq\x00]q\x01K\x01a\x85q\x02Rq\x03.")
+	if f, ok := actual.(*types.FrozenSet); !ok || f.Len() != 1 || !f.Has(1) {
+		t.Errorf("expected frozenset {1}, actual %#v", actual)
+	}
+	// pickle.dumps(complex(1, 2), protocol=2)
+	actual = loadsNoErr(t, "\x80\x02c__builtin__\ncomplex\nq\x00G?\xf0\x00\x00\x00\x00\x00\x00G@\x00\x00\x00\x00\x00\x00\x00\x86q\x01Rq\x02.")
+	if actual != complex(1, 2) {
+		t.Errorf("expected (1+2i), actual %#v", actual)
+	}
+	// pickle.dumps(slice(1, 5, None), protocol=2)
+	actual = loadsNoErr(t, "\x80\x02c__builtin__\nslice\nq\x00K\x01K\x05N\x87q\x01Rq\x02.")
+	if s, ok := actual.(*types.Slice); !ok || s.String() != "slice(1, 5, None)" {
+		t.Errorf("expected slice(1, 5, None), actual %#v", actual)
+	}
+	// pickle.dumps(range(1, 5, 2), protocol=2), in Python 2
+	actual = loadsNoErr(t, "\x80\x02c__builtin__\nxrange\nq\x00K\x01K\x05K\x02\x87q\x01Rq\x02.")
+	if r, ok := actual.(*types.Range); !ok || *r != (types.Range{Start: 1, Stop: 5, Step: 2}) || r.Len() != 2 {
+		t.Errorf("expected range(1, 5, 2), actual %#v", actual)
+	}
+
+	// pickle.dumps(A().f, protocol=2), with A in module m
+	actual = loadsNoErr(t, "\x80\x02c__builtin__\ngetattr\nq\x00cm\nA\nq\x01)\x81q\x02X\x01\x00\x00\x00fq\x03\x86q\x04Rq\x05.")
+	method, ok := actual.(*types.Attribute)
+	if !ok {
+		t.Fatalf("expected *types.Attribute, actual %#v", actual)
+	}
+	if obj, ok := method.Object.(*types.GenericObject); !ok || obj.Class.Name != "A" || method.Name != "f" {
+		t.Errorf("unexpected method %#v", method)
+	}
+	if s := method.String(); s != "<m.A object>.f" {
+		t.Errorf("expected <m.A object>.f, actual %s", s)
+	}
+	// pickle.dumps(''.join, protocol=4)
+	actual = loadsNoErr(t, "\x80\x04\x95&\x00\x00\x00\x00\x00\x00\x00\x8c\x08builtins\x94\x8c\x07getattr\x94\x93\x94\x8c\x00\x94\x8c\x04join\x94\x86\x94R\x94.")
+	if a, ok := actual.(*types.Attribute); !ok || a.Object != "" || a.Name != "join" {
+		t.Errorf("unexpected method %#v", actual)
+	}
+}
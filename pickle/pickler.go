@@ -0,0 +1,745 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// Opcodes emitted by the Pickler.
+const (
+	opMark            byte = '('
+	opStop            byte = '.'
+	opNone            byte = 'N'
+	opBinInt          byte = 'J'
+	opBinInt1         byte = 'K'
+	opBinInt2         byte = 'M'
+	opBinFloat        byte = 'G'
+	opBinPersId       byte = 'Q'
+	opPop             byte = '0'
+	opPopMark         byte = '1'
+	opBinGet          byte = 'h'
+	opLongBinGet      byte = 'j'
+	opBinPut          byte = 'q'
+	opLongBinPut      byte = 'r'
+	opBinBytes        byte = 'B'
+	opShortBinBytes   byte = 'C'
+	opReduce          byte = 'R'
+	opBinUnicode      byte = 'X'
+	opAppend          byte = 'a'
+	opBuild           byte = 'b'
+	opGlobal          byte = 'c'
+	opAppends         byte = 'e'
+	opSetItem         byte = 's'
+	opTuple           byte = 't'
+	opSetItems        byte = 'u'
+	opEmptyDict       byte = '}'
+	opEmptyList       byte = ']'
+	opEmptyTuple      byte = ')'
+	opProto           byte = '\x80'
+	opTuple1          byte = '\x85'
+	opTuple2          byte = '\x86'
+	opTuple3          byte = '\x87'
+	opNewTrue         byte = '\x88'
+	opNewFalse        byte = '\x89'
+	opLong1           byte = '\x8a'
+	opLong4           byte = '\x8b'
+	opShortBinUnicode byte = '\x8c'
+	opBinBytes8       byte = '\x8e'
+	opStackGlobal     byte = '\x93'
+	opMemoize         byte = '\x94'
+)
+
+// batchSize is the maximum number of items appended to a list, or set
+// into a dictionary, by a single APPENDS or SETITEMS opcode. It is the same
+// value used by Python.
+const batchSize = 1000
+
+// Pickler writes the pickled representation of Go values to an io.Writer,
+// in a format which can be read back by Python "pickle" module, as well
+// as by the Unpickler.
+//
+// The following Go values are supported: nil, bool, all signed and
+// unsigned integer types, *big.Int, float32, float64, string,
+// types.Bytes, *types.Tuple, *types.List, *types.Dict, *types.OrderedDict
+// and *types.GenericClass (pickled as a global reference). Go slices and
+// arrays are pickled as lists, except for []byte, pickled as bytes, and Go
+// maps as dictionaries, with their entries sorted by key. Any other value
+// can be pickled by implementing types.PyReducible, or
+// types.PyFullyReducible, or through ReducerOverride.
+//
+// The values referred to by pointers, such as lists, dictionaries and
+// reducible values, are memoized as Python does: a value referenced more
+// than once is pickled only the first time, and then referenced from the
+// memo, so that it is loaded back as a single shared value. Recursive
+// structures are supported too. As with "pickletools.optimize", only the
+// values which are actually referenced again are stored in the memo.
+type Pickler struct {
+	out *bufio.Writer
+	// w holds the pickle being written by Dump, which is only copied to
+	// out once the memo opcodes are known.
+	w *bytes.Buffer
+	// memo holds the values pickled so far by Dump, by identity.
+	memo    map[interface{}]*memoEntry
+	memoOps []memoOp
+	// Protocol is the pickle protocol version to use. It defaults to 2,
+	// which is also the default protocol used by "torch.save". Protocols
+	// from 2 to HighestProtocol are supported.
+	Protocol byte
+	// PersistentId, if set, is called for each value to be pickled. When
+	// it returns true, the value is not pickled, and the returned persistent
+	// ID is saved in its place, to be resolved by the Unpickler's
+	// PersistentLoad function. It mirrors Python "Pickler.persistent_id".
+	PersistentId func(obj interface{}) (interface{}, bool)
+	// Persister, if set, is asked for the persistent ID of each value to
+	// be pickled, after PersistentId, as the same function, which can also
+	// fail, stopping Dump with its error.
+	Persister Persister
+	// ReducerOverride, if set, is called for each value to be pickled which
+	// is not turned into a persistent ID. When it returns true, the value is
+	// pickled as the returned types.PyReducible, even if it is of a type
+	// otherwise supported. It mirrors Python "Pickler.reducer_override".
+	ReducerOverride func(obj interface{}) (types.PyReducible, bool)
+}
+
+// NewPickler returns a new Pickler writing to w.
+func NewPickler(w io.Writer) *Pickler {
+	return &Pickler{
+		out:      bufio.NewWriter(w),
+		w:        &bytes.Buffer{},
+		Protocol: 2,
+	}
+}
+
+// memoEntry is a value of the memo of a Pickler.
+type memoEntry struct {
+	// used is true if the value is referenced again after being pickled.
+	used  bool
+	index int
+}
+
+// memoOp is a memo opcode, to be placed at offset of the pickle. Its
+// argument, the index of the value in the pickled memo, is only known at
+// the end of Dump, since only the used entries are stored.
+type memoOp struct {
+	offset int
+	entry  *memoEntry
+	get    bool
+}
+
+// Dump writes the pickled representation of obj, including the protocol
+// header and the final STOP opcode.
+func (p *Pickler) Dump(obj interface{}) error {
+	if p.Protocol < 2 || p.Protocol > HighestProtocol {
+		return fmt.Errorf("unsupported pickle protocol: %d", p.Protocol)
+	}
+	p.w.Reset()
+	p.memo = make(map[interface{}]*memoEntry)
+	p.memoOps = nil
+	p.w.WriteByte(opProto)
+	p.w.WriteByte(p.Protocol)
+	if err := p.save(obj); err != nil {
+		return err
+	}
+	p.w.WriteByte(opStop)
+	return p.flush()
+}
+
+// flush writes the pickle to the underlying writer, along with the memo
+// opcodes of the used entries, numbered in order.
+func (p *Pickler) flush() error {
+	data := p.w.Bytes()
+	start, index := 0, 0
+	for _, op := range p.memoOps {
+		p.out.Write(data[start:op.offset])
+		start = op.offset
+		if !op.entry.used {
+			continue
+		}
+		if op.get {
+			p.writeMemoOp(opBinGet, opLongBinGet, op.entry.index)
+			continue
+		}
+		op.entry.index = index
+		index++
+		if p.Protocol >= 4 {
+			p.out.WriteByte(opMemoize)
+		} else {
+			p.writeMemoOp(opBinPut, opLongBinPut, op.entry.index)
+		}
+	}
+	p.out.Write(data[start:])
+	return p.out.Flush()
+}
+
+// writeMemoOp writes a memo opcode with its index argument, using the
+// short form when the index fits in a byte.
+func (p *Pickler) writeMemoOp(short, long byte, index int) {
+	if index < 256 {
+		p.out.WriteByte(short)
+		p.out.WriteByte(byte(index))
+		return
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(index))
+	p.out.WriteByte(long)
+	p.out.Write(buf[:])
+}
+
+// memoKey returns the key of obj in the memo. Only the values referred to
+// by non-nil pointers have an identity, and are memoized.
+func memoKey(obj interface{}) (interface{}, bool) {
+	if _, ok := obj.(*big.Int); ok {
+		return nil, false
+	}
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, false
+	}
+	return obj, true
+}
+
+// memoize stores obj, which is on top of the stack, in the memo.
+func (p *Pickler) memoize(obj interface{}) {
+	key, ok := memoKey(obj)
+	if !ok {
+		return
+	}
+	entry := &memoEntry{}
+	p.memo[key] = entry
+	p.memoOps = append(p.memoOps, memoOp{offset: p.w.Len(), entry: entry})
+}
+
+// saveMemoized writes a reference to obj, if it is in the memo.
+func (p *Pickler) saveMemoized(obj interface{}) bool {
+	key, ok := memoKey(obj)
+	if !ok {
+		return false
+	}
+	entry, ok := p.memo[key]
+	if !ok {
+		return false
+	}
+	entry.used = true
+	p.memoOps = append(p.memoOps, memoOp{offset: p.w.Len(), entry: entry, get: true})
+	return true
+}
+
+func (p *Pickler) save(obj interface{}) error {
+	if p.PersistentId != nil {
+		if pid, ok := p.PersistentId(obj); ok {
+			return p.savePersistentId(pid)
+		}
+	}
+	if p.Persister != nil {
+		pid, ok, err := p.Persister.PersistentId(obj)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return p.savePersistentId(pid)
+		}
+	}
+	if p.saveMemoized(obj) {
+		return nil
+	}
+	if p.ReducerOverride != nil {
+		if r, ok := p.ReducerOverride(obj); ok {
+			return p.saveReduce(obj, r)
+		}
+	}
+	return p.saveValue(obj)
+}
+
+func (p *Pickler) saveValue(obj interface{}) error {
+	switch v := obj.(type) {
+	case nil:
+		p.w.WriteByte(opNone)
+	case bool:
+		p.saveBool(v)
+	case int:
+		p.saveInt(int64(v))
+	case int8:
+		p.saveInt(int64(v))
+	case int16:
+		p.saveInt(int64(v))
+	case int32:
+		p.saveInt(int64(v))
+	case int64:
+		p.saveInt(v)
+	case uint:
+		p.saveUint(uint64(v))
+	case uint8:
+		p.saveInt(int64(v))
+	case uint16:
+		p.saveInt(int64(v))
+	case uint32:
+		p.saveInt(int64(v))
+	case uint64:
+		p.saveUint(v)
+	case *big.Int:
+		p.saveBigInt(v)
+	case float32:
+		p.saveFloat(float64(v))
+	case float64:
+		p.saveFloat(v)
+	case string:
+		p.saveString(v)
+	case types.Bytes:
+		return p.saveBytes(v)
+	case *types.Tuple:
+		return p.saveTuple(v)
+	case *types.List:
+		p.w.WriteByte(opEmptyList)
+		p.memoize(v)
+		return p.batchAppends(*v)
+	case *types.Dict:
+		p.w.WriteByte(opEmptyDict)
+		p.memoize(v)
+		return p.batchSetItems(v.Entries())
+	case *types.OrderedDict:
+		return p.saveOrderedDict(v)
+	case *types.GenericClass:
+		p.saveGlobal(v.Module, v.Name)
+		p.memoize(v)
+	case types.PyReducible:
+		return p.saveReduce(v, v)
+	default:
+		return p.saveReflected(obj)
+	}
+	return nil
+}
+
+// saveReflected pickles the Go slices, arrays and maps. Unlike the values
+// of the types package, they are not memoized, being no pointers. The
+// entries of a map are sorted by key, so that the pickle does not depend
+// on the iteration order of the map.
+func (p *Pickler) saveReflected(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			for i := range b {
+				b[i] = byte(v.Index(i).Uint())
+			}
+			return p.saveBytes(types.Bytes(b))
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).Interface()
+		}
+		p.w.WriteByte(opEmptyList)
+		return p.batchAppends(items)
+	case reflect.Map:
+		keys := v.MapKeys()
+		sortMapKeys(keys)
+		entries := make([]types.DictEntry, len(keys))
+		for i, key := range keys {
+			entries[i] = types.DictEntry{
+				Key:   key.Interface(),
+				Value: v.MapIndex(key).Interface(),
+			}
+		}
+		p.w.WriteByte(opEmptyDict)
+		return p.batchSetItems(entries)
+	default:
+		return fmt.Errorf("cannot pickle value of type %T", obj)
+	}
+}
+
+// sortMapKeys sorts the keys of a map, by value for strings and numbers,
+// or by their default format otherwise.
+func sortMapKeys(keys []reflect.Value) {
+	if len(keys) == 0 {
+		return
+	}
+	var less func(a, b reflect.Value) bool
+	switch keys[0].Kind() {
+	case reflect.String:
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	default:
+		less = func(a, b reflect.Value) bool {
+			return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
+}
+
+// savePersistentId writes a persistent ID. The ID itself is pickled as
+// a regular value, without any further call to PersistentId.
+func (p *Pickler) savePersistentId(pid interface{}) error {
+	if err := p.saveValue(pid); err != nil {
+		return err
+	}
+	p.w.WriteByte(opBinPersId)
+	return nil
+}
+
+func (p *Pickler) saveBool(v bool) {
+	if v {
+		p.w.WriteByte(opNewTrue)
+	} else {
+		p.w.WriteByte(opNewFalse)
+	}
+}
+
+// saveInt writes an integer with the most compact opcode, as Python does.
+func (p *Pickler) saveInt(v int64) {
+	switch {
+	case v >= 0 && v <= math.MaxUint8:
+		p.w.WriteByte(opBinInt1)
+		p.w.WriteByte(byte(v))
+	case v >= 0 && v <= math.MaxUint16:
+		var buf [2]byte
+		binary.LittleEndian.PutUint16(buf[:], uint16(v))
+		p.w.WriteByte(opBinInt2)
+		p.w.Write(buf[:])
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(int32(v)))
+		p.w.WriteByte(opBinInt)
+		p.w.Write(buf[:])
+	default:
+		p.saveBigInt(big.NewInt(v))
+	}
+}
+
+func (p *Pickler) saveUint(v uint64) {
+	if v <= math.MaxInt64 {
+		p.saveInt(int64(v))
+		return
+	}
+	p.saveBigInt(new(big.Int).SetUint64(v))
+}
+
+func (p *Pickler) saveBigInt(v *big.Int) {
+	if v.IsInt64() {
+		if i := v.Int64(); i >= math.MinInt32 && i <= math.MaxInt32 {
+			p.saveInt(i)
+			return
+		}
+	}
+	data := encodeLong(v)
+	if len(data) < 256 {
+		p.w.WriteByte(opLong1)
+		p.w.WriteByte(byte(len(data)))
+	} else {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(data)))
+		p.w.WriteByte(opLong4)
+		p.w.Write(buf[:])
+	}
+	p.w.Write(data)
+}
+
+func (p *Pickler) saveFloat(v float64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	p.w.WriteByte(opBinFloat)
+	p.w.Write(buf[:])
+}
+
+func (p *Pickler) saveString(v string) {
+	if p.Protocol >= 4 && len(v) < 256 {
+		p.w.WriteByte(opShortBinUnicode)
+		p.w.WriteByte(byte(len(v)))
+	} else {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(v)))
+		p.w.WriteByte(opBinUnicode)
+		p.w.Write(buf[:])
+	}
+	p.w.WriteString(v)
+}
+
+// saveBytes writes a bytes value as CPython does: before protocol 3, which
+// introduced the bytes opcodes, it is reduced to a call to "bytes", if
+// empty, or to "_codecs.encode" of the string made of one code point for
+// each byte. As in CPython, a value longer than 4 GiB cannot be pickled
+// before protocol 4, which introduced the opcode for it.
+func (p *Pickler) saveBytes(v types.Bytes) error {
+	if p.Protocol < 3 {
+		if len(v) == 0 {
+			p.saveGlobal("__builtin__", "bytes")
+			p.w.WriteByte(opEmptyTuple)
+			p.w.WriteByte(opReduce)
+			return nil
+		}
+		latin1 := make([]rune, len(v))
+		for i := 0; i < len(v); i++ {
+			latin1[i] = rune(v[i])
+		}
+		p.saveGlobal("_codecs", "encode")
+		p.saveString(string(latin1))
+		p.saveString("latin1")
+		p.w.WriteByte(opTuple2)
+		p.w.WriteByte(opReduce)
+		return nil
+	}
+	switch n := uint64(len(v)); {
+	case n < 256:
+		p.w.WriteByte(opShortBinBytes)
+		p.w.WriteByte(byte(n))
+	case n <= math.MaxUint32:
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(n))
+		p.w.WriteByte(opBinBytes)
+		p.w.Write(buf[:])
+	case p.Protocol >= 4:
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], n)
+		p.w.WriteByte(opBinBytes8)
+		p.w.Write(buf[:])
+	default:
+		return fmt.Errorf("cannot pickle a bytes value larger than 4 GiB with protocol %d", p.Protocol)
+	}
+	p.w.WriteString(string(v))
+	return nil
+}
+
+// saveTuple writes a tuple, which, unlike the other containers, can only
+// be memoized once all its items are pickled. If the tuple is reached
+// again while pickling its items, through a recursive reference, the
+// items are discarded and the memoized tuple is used instead, as Python
+// does.
+func (p *Pickler) saveTuple(tuple *types.Tuple) error {
+	t := *tuple
+	if len(t) == 0 {
+		p.w.WriteByte(opEmptyTuple)
+		return nil
+	}
+	if len(t) > 3 {
+		p.w.WriteByte(opMark)
+	}
+	for _, item := range t {
+		if err := p.save(item); err != nil {
+			return err
+		}
+	}
+	if key, ok := memoKey(tuple); ok && p.memo[key] != nil {
+		if len(t) > 3 {
+			p.w.WriteByte(opPopMark)
+		} else {
+			for range t {
+				p.w.WriteByte(opPop)
+			}
+		}
+		p.saveMemoized(tuple)
+		return nil
+	}
+	switch len(t) {
+	case 1:
+		p.w.WriteByte(opTuple1)
+	case 2:
+		p.w.WriteByte(opTuple2)
+	case 3:
+		p.w.WriteByte(opTuple3)
+	default:
+		p.w.WriteByte(opTuple)
+	}
+	p.memoize(tuple)
+	return nil
+}
+
+// batchAppends writes the items to be appended to the list which is on
+// top of the stack, in batches of batchSize items. A single item is
+// written with APPEND, as Python does.
+func (p *Pickler) batchAppends(items []interface{}) error {
+	if len(items) == 1 {
+		if err := p.save(items[0]); err != nil {
+			return err
+		}
+		p.w.WriteByte(opAppend)
+		return nil
+	}
+	for start := 0; start < len(items); start += batchSize {
+		end := start + batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		p.w.WriteByte(opMark)
+		for _, item := range items[start:end] {
+			if err := p.save(item); err != nil {
+				return err
+			}
+		}
+		p.w.WriteByte(opAppends)
+	}
+	return nil
+}
+
+// batchSetItems writes the key/value pairs to be set into the dictionary
+// which is on top of the stack, in batches of batchSize pairs. A single
+// pair is written with SETITEM, as Python does.
+func (p *Pickler) batchSetItems(entries []types.DictEntry) error {
+	if len(entries) == 1 {
+		if err := p.saveDictEntry(entries[0]); err != nil {
+			return err
+		}
+		p.w.WriteByte(opSetItem)
+		return nil
+	}
+	for start := 0; start < len(entries); start += batchSize {
+		end := start + batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		p.w.WriteByte(opMark)
+		for _, entry := range entries[start:end] {
+			if err := p.saveDictEntry(entry); err != nil {
+				return err
+			}
+		}
+		p.w.WriteByte(opSetItems)
+	}
+	return nil
+}
+
+func (p *Pickler) saveDictEntry(entry types.DictEntry) error {
+	if err := p.save(entry.Key); err != nil {
+		return err
+	}
+	return p.save(entry.Value)
+}
+
+// saveOrderedDict writes an OrderedDict the same way Python does, that is,
+// as a call to "collections.OrderedDict" followed by its items. The
+// attributes in PyDict, if any, are set with BUILD, sorted by name.
+func (p *Pickler) saveOrderedDict(o *types.OrderedDict) error {
+	p.saveGlobal("collections", "OrderedDict")
+	p.w.WriteByte(opEmptyTuple)
+	p.w.WriteByte(opReduce)
+	p.memoize(o)
+
+	entries := make([]types.DictEntry, 0, o.Len())
+	for e := o.List.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*types.OrderedDictEntry)
+		entries = append(entries, types.DictEntry{Key: entry.Key, Value: entry.Value})
+	}
+	if err := p.batchSetItems(entries); err != nil {
+		return err
+	}
+
+	if len(o.PyDict) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(o.PyDict))
+	for name := range o.PyDict {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	state := make([]types.DictEntry, len(names))
+	for i, name := range names {
+		state[i] = types.DictEntry{Key: name, Value: o.PyDict[name]}
+	}
+	p.w.WriteByte(opEmptyDict)
+	if err := p.batchSetItems(state); err != nil {
+		return err
+	}
+	p.w.WriteByte(opBuild)
+	return nil
+}
+
+// saveGlobal writes a reference to the attribute name of module, using
+// GLOBAL, or STACK_GLOBAL from protocol 4 onwards.
+func (p *Pickler) saveGlobal(module, name string) {
+	if p.Protocol >= 4 {
+		p.saveString(module)
+		p.saveString(name)
+		p.w.WriteByte(opStackGlobal)
+		return
+	}
+	p.w.WriteByte(opGlobal)
+	p.w.WriteString(module + "\n" + name + "\n")
+}
+
+// saveReduce writes obj as reduced by r, memoizing it right after the
+// call, so that its items and state can refer to it.
+func (p *Pickler) saveReduce(obj interface{}, r types.PyReducible) error {
+	callable, args, err := r.PyReduce()
+	if err != nil {
+		return err
+	}
+	if args == nil {
+		args = types.NewTupleFromSlice(nil)
+	}
+	if err := p.save(callable); err != nil {
+		return err
+	}
+	if err := p.saveTuple(args); err != nil {
+		return err
+	}
+	p.w.WriteByte(opReduce)
+	p.memoize(obj)
+
+	fr, ok := r.(types.PyFullyReducible)
+	if !ok {
+		return nil
+	}
+	state, listItems, dictItems, err := fr.PyReduceItems()
+	if err != nil {
+		return err
+	}
+	if len(listItems) > 0 {
+		if err := p.batchAppends(listItems); err != nil {
+			return err
+		}
+	}
+	if len(dictItems) > 0 {
+		if err := p.batchSetItems(dictItems); err != nil {
+			return err
+		}
+	}
+	if state != nil {
+		if err := p.save(state); err != nil {
+			return err
+		}
+		p.w.WriteByte(opBuild)
+	}
+	return nil
+}
+
+// encodeLong returns the minimal little-endian two's complement
+// representation of v, as expected by LONG1 and LONG4 opcodes. It is the
+// inverse of decodeLong, and mirrors Python "pickle.encode_long".
+func encodeLong(v *big.Int) []byte {
+	if v.Sign() == 0 {
+		return []byte{}
+	}
+	n := v.BitLen()/8 + 1
+	x := v
+	if v.Sign() < 0 {
+		// two's complement: 2^(8*n) + v
+		x = new(big.Int).Lsh(big.NewInt(1), uint(8*n))
+		x.Add(x, v)
+	}
+	be := x.Bytes()
+	data := make([]byte, n)
+	for i, b := range be {
+		data[len(be)-1-i] = b
+	}
+	if v.Sign() < 0 && n > 1 && data[n-1] == 0xff && data[n-2]&0x80 != 0 {
+		data = data[:n-1]
+	}
+	return data
+}
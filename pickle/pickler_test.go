@@ -0,0 +1,611 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPicklerScalarsP2(t *testing.T) {
+	testCases := []struct {
+		value    interface{}
+		expected string // pickle.dumps(value, protocol=2)
+		loaded   interface{}
+	}{
+		{nil, "\x80\x02N.", nil},
+		{true, "\x80\x02\x88.", true},
+		{false, "\x80\x02\x89.", false},
+		{0, "\x80\x02K\x00.", 0},
+		{42, "\x80\x02K*.", 42},
+		{255, "\x80\x02K\xff.", 255},
+		{256, "\x80\x02M\x00\x01.", 256},
+		{65535, "\x80\x02M\xff\xff.", 65535},
+		{65536, "\x80\x02J\x00\x00\x01\x00.", 65536},
+		{-1, "\x80\x02J\xff\xff\xff\xff.", -1},
+		{-256, "\x80\x02J\x00\xff\xff\xff.", -256},
+		{int32(math.MinInt32), "\x80\x02J\x00\x00\x00\x80.", math.MinInt32},
+		{int32(math.MaxInt32), "\x80\x02J\xff\xff\xff\x7f.", math.MaxInt32},
+		{int64(2147483648), "\x80\x02\x8a\x05\x00\x00\x00\x80\x00.", 2147483648},
+		{int64(-2147483649), "\x80\x02\x8a\x05\xff\xff\xff\x7f\xff.", -2147483649},
+		{int64(math.MaxInt64),
+			"\x80\x02\x8a\x08\xff\xff\xff\xff\xff\xff\xff\x7f.", math.MaxInt64},
+		{int64(math.MinInt64),
+			"\x80\x02\x8a\x08\x00\x00\x00\x00\x00\x00\x00\x80.", math.MinInt64},
+		{uint8(200), "\x80\x02K\xc8.", 200},
+		{uint64(math.MaxUint64),
+			"\x80\x02\x8a\x09\xff\xff\xff\xff\xff\xff\xff\xff\x00.",
+			new(big.Int).SetUint64(math.MaxUint64)},
+		{mustParseBigInt("18446744073709551616"),
+			"\x80\x02\x8a\x09\x00\x00\x00\x00\x00\x00\x00\x00\x01.",
+			mustParseBigInt("18446744073709551616")},
+		{mustParseBigInt("100200300400500600700"),
+			"\x80\x02\x8a\x09|\xefD\x8fT\xfa\x8en\x05.",
+			mustParseBigInt("100200300400500600700")},
+		{mustParseBigInt("-100200300400500600700"),
+			"\x80\x02\x8a\x09\x84\x10\xbbp\xab\x05q\x91\xfa.",
+			mustParseBigInt("-100200300400500600700")},
+		{big.NewInt(42), "\x80\x02K*.", 42},
+		{0.5, "\x80\x02G?\xe0\x00\x00\x00\x00\x00\x00.", 0.5},
+		{float32(0.5), "\x80\x02G?\xe0\x00\x00\x00\x00\x00\x00.", 0.5},
+		{-1.25e300, "\x80\x02G\xfe=\xddK\xaa\x00\x93\x03.", -1.25e300},
+		{math.Inf(1), "\x80\x02G\x7f\xf0\x00\x00\x00\x00\x00\x00.", math.Inf(1)},
+	}
+
+	for _, tc := range testCases {
+		actual := dumpsNoErr(t, tc.value)
+		if actual != tc.expected {
+			t.Errorf("%#v: expected %q, actual %q", tc.value, tc.expected, actual)
+		}
+		loaded := loadsNoErr(t, actual)
+		if !reflect.DeepEqual(loaded, tc.loaded) {
+			t.Errorf("%#v: expected to load %#v, actual %#v", tc.value, tc.loaded, loaded)
+		}
+	}
+}
+
+func TestPicklerContainersP2(t *testing.T) {
+	orderedDict := types.NewOrderedDict()
+	orderedDict.Set("b", 1)
+	orderedDict.Set("a", 2)
+	withAttrs := types.NewOrderedDict()
+	withAttrs.Set("a", 1)
+	withAttrs.PyDict["_metadata"] = types.NewDictFromEntries([]types.DictEntry{{Key: "x", Value: nil}})
+
+	testCases := []struct {
+		value    interface{}
+		expected string // pickletools.optimize(pickle.dumps(value, protocol=2))
+	}{
+		{"", "\x80\x02X\x00\x00\x00\x00."},
+		{"ciao", "\x80\x02X\x04\x00\x00\x00ciao."},
+		{"àè", "\x80\x02X\x04\x00\x00\x00\xc3\xa0\xc3\xa8."},
+		{&types.Tuple{}, "\x80\x02)."},
+		{&types.Tuple{1}, "\x80\x02K\x01\x85."},
+		{&types.Tuple{1, "a"}, "\x80\x02K\x01X\x01\x00\x00\x00a\x86."},
+		{&types.Tuple{1, 2, 3}, "\x80\x02K\x01K\x02K\x03\x87."},
+		{&types.Tuple{1, 2, 3, 4}, "\x80\x02(K\x01K\x02K\x03K\x04t."},
+		{&types.List{}, "\x80\x02]."},
+		{&types.List{1}, "\x80\x02]K\x01a."},
+		{&types.List{1, &types.List{2}}, "\x80\x02](K\x01]K\x02ae."},
+		{&types.Dict{}, "\x80\x02}."},
+		{types.NewDictFromEntries([]types.DictEntry{{Key: "a", Value: 1}}), "\x80\x02}X\x01\x00\x00\x00aK\x01s."},
+		{types.NewDictFromEntries([]types.DictEntry{{Key: "a", Value: 1}, {Key: 2, Value: &types.Tuple{3}}}),
+			"\x80\x02}(X\x01\x00\x00\x00aK\x01K\x02K\x03\x85u."},
+		{types.NewOrderedDict(), "\x80\x02ccollections\nOrderedDict\n)R."},
+		{orderedDict, "\x80\x02ccollections\nOrderedDict\n)R" +
+			"(X\x01\x00\x00\x00bK\x01X\x01\x00\x00\x00aK\x02u."},
+		{withAttrs, "\x80\x02ccollections\nOrderedDict\n)RX\x01\x00\x00\x00aK\x01s" +
+			"}X\x09\x00\x00\x00_metadata}X\x01\x00\x00\x00xNssb."},
+		{types.NewGenericClass("foo", "Bar"), "\x80\x02cfoo\nBar\n."},
+	}
+
+	for _, tc := range testCases {
+		actual := dumpsNoErr(t, tc.value)
+		if actual != tc.expected {
+			t.Errorf("%#v: expected %q, actual %q", tc.value, tc.expected, actual)
+		}
+		if _, ok := tc.value.(*types.GenericClass); ok {
+			continue
+		}
+		// The loaded value must be pickled in exactly the same way.
+		if reDumped := dumpsNoErr(t, loadsNoErr(t, actual)); reDumped != actual {
+			t.Errorf("%#v: expected to re-dump %q, actual %q", tc.value, actual, reDumped)
+		}
+	}
+}
+
+func TestPicklerGoValues(t *testing.T) {
+	testCases := []struct {
+		value    interface{}
+		expected string // pickletools.optimize(pickle.dumps(value, protocol=2))
+	}{
+		{[]interface{}{1, "a"}, "\x80\x02](K\x01X\x01\x00\x00\x00ae."},
+		{[]int{1, 2}, "\x80\x02](K\x01K\x02e."},
+		{[2]int{1, 2}, "\x80\x02](K\x01K\x02e."},
+		{[]string(nil), "\x80\x02]."},
+		{[]byte("xy"), "\x80\x02c_codecs\nencode\nX\x02\x00\x00\x00xyX\x06\x00\x00\x00latin1\x86R."},
+		{map[string]int{"b": 1, "a": 2}, "\x80\x02}(X\x01\x00\x00\x00aK\x02X\x01\x00\x00\x00bK\x01u."},
+		{map[int]string{10: "x", 9: "y"}, "\x80\x02}(K\tX\x01\x00\x00\x00yK\nX\x01\x00\x00\x00xu."},
+		{map[string]interface{}{"b": map[string]int{}, "a": []string{"x"}},
+			"\x80\x02}(X\x01\x00\x00\x00a]X\x01\x00\x00\x00xaX\x01\x00\x00\x00b}u."},
+	}
+	for _, tc := range testCases {
+		actual := dumpsNoErr(t, tc.value)
+		if actual != tc.expected {
+			t.Errorf("%#v: expected %q, actual %q", tc.value, tc.expected, actual)
+		}
+	}
+
+	err := NewPickler(&bytes.Buffer{}).Dump(make(chan int))
+	if err == nil || !strings.Contains(err.Error(), "cannot pickle value of type chan int") {
+		t.Errorf("expected unsupported type error, actual %v", err)
+	}
+}
+
+func TestPicklerBatches(t *testing.T) {
+	list := make(types.List, 1001)
+	for i := range list {
+		list[i] = i
+	}
+	actual := dumpsNoErr(t, &list)
+	// len(pickletools.optimize(pickle.dumps(list(range(1001)), protocol=2)))
+	if len(actual) != 2755 {
+		t.Errorf("expected length 2755, actual %d", len(actual))
+	}
+	if actual[len(actual)-7:] != "e(M\xe8\x03e." {
+		t.Errorf("expected a final single-item APPENDS, actual %q", actual[len(actual)-7:])
+	}
+	loaded := loadsNoErr(t, actual).(*types.List)
+	if !reflect.DeepEqual(*loaded, list) {
+		t.Error("unexpected loaded list")
+	}
+}
+
+func TestPicklerP4(t *testing.T) {
+	orderedDict := types.NewOrderedDict()
+	orderedDict.Set("a", 1)
+
+	testCases := []struct {
+		value    interface{}
+		expected string // pickle.dumps(value, protocol=4), without framing and memo
+	}{
+		{"ciao", "\x80\x04\x8c\x04ciao."},
+		{orderedDict,
+			"\x80\x04\x8c\x0bcollections\x8c\x0bOrderedDict\x93)R\x8c\x01aK\x01s."},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		p := NewPickler(&buf)
+		p.Protocol = 4
+		if err := p.Dump(tc.value); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != tc.expected {
+			t.Errorf("%#v: expected %q, actual %q", tc.value, tc.expected, actual)
+		}
+	}
+}
+
+type reducibleValue struct {
+	n int
+}
+
+func (r *reducibleValue) PyReduce() (interface{}, *types.Tuple, error) {
+	return types.NewGenericClass("foo", "Bar"), &types.Tuple{r.n}, nil
+}
+
+func TestPicklerReduce(t *testing.T) {
+	actual := dumpsNoErr(t, &types.List{&reducibleValue{n: 1}})
+	expected := "\x80\x02]cfoo\nBar\nK\x01\x85Ra."
+	if actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+}
+
+// bag is both pickled and unpickled as an instance of "foo.Bag", rebuilt
+// appending its items and setting its entries and its state.
+type bag struct {
+	items   []interface{}
+	entries []types.DictEntry
+	state   interface{}
+}
+
+var _ types.PyFullyReducible = &bag{}
+
+func (b *bag) PyReduce() (interface{}, *types.Tuple, error) {
+	return types.NewGenericClass("foo", "Bag"), nil, nil
+}
+
+func (b *bag) PyReduceItems() (interface{}, []interface{}, []types.DictEntry, error) {
+	return b.state, b.items, b.entries, nil
+}
+
+func (b *bag) Append(v interface{}) { b.items = append(b.items, v) }
+
+func (b *bag) Set(key, value interface{}) {
+	b.entries = append(b.entries, types.DictEntry{Key: key, Value: value})
+}
+
+func (b *bag) PySetState(state interface{}) error {
+	b.state = state
+	return nil
+}
+
+type bagClass struct{}
+
+func (bagClass) Call(args ...interface{}) (interface{}, error) { return &bag{}, nil }
+
+func TestPicklerFullReduce(t *testing.T) {
+	testCases := []struct {
+		value    *bag
+		expected string // pickletools.optimize(pickle.dumps(value, protocol=2))
+	}{
+		// __reduce__: (Bag, (), {'name': 'x'}, iter([1, 2]), iter([('k', 3)]))
+		{&bag{
+			items:   []interface{}{1, 2},
+			entries: []types.DictEntry{{Key: "k", Value: 3}},
+			state:   types.NewDictFromEntries([]types.DictEntry{{Key: "name", Value: "x"}}),
+		}, "\x80\x02cfoo\nBag\n)R(K\x01K\x02eX\x01\x00\x00\x00kK\x03s" +
+			"}X\x04\x00\x00\x00nameX\x01\x00\x00\x00xsb."},
+		// __reduce__: (Bag, (), None, iter([7]))
+		{&bag{items: []interface{}{7}}, "\x80\x02cfoo\nBag\n)RK\x07a."},
+	}
+	for _, tc := range testCases {
+		actual := dumpsNoErr(t, tc.value)
+		if actual != tc.expected {
+			t.Errorf("expected %q, actual %q", tc.expected, actual)
+		}
+
+		u := NewUnpickler(strings.NewReader(actual))
+		u.FindClass = func(module, name string) (interface{}, error) {
+			if module == "foo" && name == "Bag" {
+				return bagClass{}, nil
+			}
+			return nil, fmt.Errorf("class not found: %s %s", module, name)
+		}
+		loaded, err := u.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, tc.value) {
+			t.Errorf("expected to load %#v, actual %#v", tc.value, loaded)
+		}
+	}
+}
+
+func TestPicklerPersistentId(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPickler(&buf)
+	p.PersistentId = func(obj interface{}) (interface{}, bool) {
+		if r, ok := obj.(*reducibleValue); ok {
+			return &types.Tuple{"value", r.n}, true
+		}
+		return nil, false
+	}
+	if err := p.Dump(&types.Tuple{&reducibleValue{n: 7}}); err != nil {
+		t.Fatal(err)
+	}
+	actual := buf.String()
+	expected := "\x80\x02X\x05\x00\x00\x00valueK\x07\x86Q\x85."
+	if actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+
+	u := NewUnpickler(&buf)
+	u.PersistentLoad = func(pid interface{}) (interface{}, error) {
+		return pid.(*types.Tuple).Get(1), nil
+	}
+	buf.WriteString(actual)
+	loaded, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := loaded.(*types.Tuple).Get(0); n != 7 {
+		t.Errorf("expected 7, actual %#v", n)
+	}
+}
+
+// blobStore keeps the strings longer than limit out of the pickles, as
+// both the Persister and the PersistentLoader. Its IDs are short enough
+// not to be kept out of the pickles themselves.
+type blobStore struct {
+	limit int
+	blobs []string
+}
+
+var _ Persister = &blobStore{}
+var _ PersistentLoader = &blobStore{}
+
+func (s *blobStore) PersistentId(obj interface{}) (interface{}, bool, error) {
+	str, ok := obj.(string)
+	if !ok || len(str) <= s.limit {
+		return nil, false, nil
+	}
+	if strings.Contains(str, "secret") {
+		return nil, false, fmt.Errorf("cannot store %q", str)
+	}
+	s.blobs = append(s.blobs, str)
+	return &types.Tuple{"b", len(s.blobs) - 1}, true, nil
+}
+
+func (s *blobStore) PersistentLoad(pid interface{}) (interface{}, error) {
+	t, ok := pid.(*types.Tuple)
+	if !ok || t.Len() != 2 || t.Get(0) != "b" {
+		return nil, fmt.Errorf("unexpected persistent ID %#v", pid)
+	}
+	return s.blobs[t.Get(1).(int)], nil
+}
+
+func TestPicklerPersister(t *testing.T) {
+	store := &blobStore{limit: 3}
+	var buf bytes.Buffer
+	p := NewPickler(&buf)
+	p.Persister = store
+	if err := p.Dump(&types.List{"abc", "abcdef"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\x80\x02](X\x03\x00\x00\x00abcX\x01\x00\x00\x00bK\x00\x86Qe."
+	if actual := buf.String(); actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+
+	u := NewUnpickler(&buf)
+	u.PersistentLoad = store.PersistentLoad
+	loaded, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&types.List{"abc", "abcdef"}); !reflect.DeepEqual(loaded, expected) {
+		t.Errorf("expected %#v, actual %#v", expected, loaded)
+	}
+
+	p = NewPickler(&bytes.Buffer{})
+	p.Persister = store
+	if err := p.Dump(&types.List{"a secret"}); err == nil || err.Error() != `cannot store "a secret"` {
+		t.Errorf("expected the Persister error, actual %v", err)
+	}
+
+	// PersistentId comes first
+	buf.Reset()
+	p = NewPickler(&buf)
+	p.PersistentId = func(obj interface{}) (interface{}, bool) {
+		return "id", obj == "a secret"
+	}
+	p.Persister = store
+	if err := p.Dump("a secret"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\x80\x02X\x02\x00\x00\x00idQ."; buf.String() != expected {
+		t.Errorf("expected %q, actual %q", expected, buf.String())
+	}
+}
+
+func TestPicklerBytes(t *testing.T) {
+	testCases := []struct {
+		value    types.Bytes
+		protocol byte
+		expected string // pickle.dumps(value, protocol), without framing and memo
+	}{
+		{types.Bytes(""), 2, "\x80\x02c__builtin__\nbytes\n)R."},
+		{types.Bytes("\x00\xff"), 2,
+			"\x80\x02c_codecs\nencode\nX\x03\x00\x00\x00\x00\xc3\xbfX\x06\x00\x00\x00latin1\x86R."},
+		{types.Bytes("ab"), 3, "\x80\x03C\x02ab."},
+		{types.Bytes(strings.Repeat("x", 256)), 4,
+			"\x80\x04B\x00\x01\x00\x00" + strings.Repeat("x", 256) + "."},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		p := NewPickler(&buf)
+		p.Protocol = tc.protocol
+		if err := p.Dump(tc.value); err != nil {
+			t.Fatal(err)
+		}
+		actual := buf.String()
+		if actual != tc.expected {
+			t.Errorf("protocol %d: expected %q, actual %q", tc.protocol, tc.expected, actual)
+		}
+		if loaded := loadsNoErr(t, actual); loaded != tc.value {
+			t.Errorf("protocol %d: expected to load %q, actual %#v", tc.protocol, tc.value, loaded)
+		}
+	}
+}
+
+func TestPicklerReducerOverride(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPickler(&buf)
+	p.ReducerOverride = func(obj interface{}) (types.PyReducible, bool) {
+		if n, ok := obj.(int); ok && n < 0 {
+			return &reducibleValue{n: -n}, true
+		}
+		return nil, false
+	}
+	if err := p.Dump(&types.List{-1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	actual := buf.String()
+	expected := "\x80\x02](cfoo\nBar\nK\x01\x85RK\x02e."
+	if actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+}
+
+func TestPicklerLong4P2(t *testing.T) {
+	// pickle.dumps(1 << 2100, protocol=2)
+	value := new(big.Int).Lsh(big.NewInt(1), 2100)
+	actual := dumpsNoErr(t, value)
+	if len(actual) != 271 || actual[:8] != "\x80\x02\x8b\x07\x01\x00\x00\x00" {
+		t.Errorf("unexpected LONG4 pickle %q", actual)
+	}
+	loaded, ok := loadsNoErr(t, actual).(*big.Int)
+	if !ok || loaded.Cmp(value) != 0 {
+		t.Errorf("expected %v, actual %v", value, loaded)
+	}
+}
+
+func TestPicklerMemo(t *testing.T) {
+	list := &types.List{1}
+	tuple := &types.Tuple{1, 2}
+	dict := types.NewDictFromEntries([]types.DictEntry{{Key: "x", Value: 1}})
+	recursiveList := &types.List{}
+	*recursiveList = append(*recursiveList, recursiveList)
+	// l = []; t = (l,); l.append(t)
+	innerList := &types.List{}
+	recursiveTuple := &types.Tuple{innerList}
+	*innerList = append(*innerList, recursiveTuple)
+	// l = []; t = (l, l, l, l); l.append(t)
+	innerList4 := &types.List{}
+	recursiveTuple4 := &types.Tuple{innerList4, innerList4, innerList4, innerList4}
+	*innerList4 = append(*innerList4, recursiveTuple4)
+
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected string // pickletools.optimize(pickle.dumps(value, protocol=2))
+		check    func(t *testing.T, loaded interface{})
+	}{
+		{"shared list", &types.List{list, list}, "\x80\x02](]q\x00K\x01ah\x00e.",
+			func(t *testing.T, loaded interface{}) {
+				l := *loaded.(*types.List)
+				if l[0] != l[1] {
+					t.Error("expected the same list twice")
+				}
+			}},
+		{"shared tuple", &types.List{tuple, tuple}, "\x80\x02](K\x01K\x02\x86q\x00h\x00e.",
+			func(t *testing.T, loaded interface{}) {
+				l := *loaded.(*types.List)
+				if l[0] != l[1] {
+					t.Error("expected the same tuple twice")
+				}
+			}},
+		{"shared dict", types.NewDictFromEntries([]types.DictEntry{{Key: "a", Value: dict}, {Key: "b", Value: dict}}),
+			"\x80\x02}(X\x01\x00\x00\x00a}q\x00X\x01\x00\x00\x00xK\x01s" +
+				"X\x01\x00\x00\x00bh\x00u.",
+			func(t *testing.T, loaded interface{}) {
+				d := loaded.(*types.Dict)
+				a, _ := d.Get("a")
+				b, _ := d.Get("b")
+				if a != b {
+					t.Error("expected the same dict twice")
+				}
+			}},
+		{"recursive list", recursiveList, "\x80\x02]q\x00h\x00a.",
+			func(t *testing.T, loaded interface{}) {
+				l := loaded.(*types.List)
+				if (*l)[0] != l {
+					t.Error("expected the list to contain itself")
+				}
+			}},
+		{"recursive tuple", recursiveTuple, "\x80\x02]q\x00h\x00\x85q\x01a0h\x01.",
+			func(t *testing.T, loaded interface{}) {
+				tuple := loaded.(*types.Tuple)
+				l := tuple.Get(0).(*types.List)
+				if (*l)[0] != tuple {
+					t.Error("expected the list to contain the tuple")
+				}
+			}},
+		{"recursive long tuple", recursiveTuple4,
+			"\x80\x02(]q\x00(h\x00h\x00h\x00h\x00tq\x01ah\x00h\x00h\x001h\x01.",
+			func(t *testing.T, loaded interface{}) {
+				tuple := loaded.(*types.Tuple)
+				l := tuple.Get(3).(*types.List)
+				if (*l)[0] != tuple {
+					t.Error("expected the list to contain the tuple")
+				}
+			}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := dumpsNoErr(t, tc.value)
+			if actual != tc.expected {
+				t.Errorf("expected %q, actual %q", tc.expected, actual)
+			}
+			tc.check(t, loadsNoErr(t, actual))
+		})
+	}
+
+	t.Run("protocol 4", func(t *testing.T) {
+		var buf bytes.Buffer
+		p := NewPickler(&buf)
+		p.Protocol = 4
+		if err := p.Dump(&types.List{list, list}); err != nil {
+			t.Fatal(err)
+		}
+		// pickle.dumps([a, a], protocol=4), without framing
+		expected := "\x80\x04](]\x94K\x01ah\x00e."
+		if actual := buf.String(); actual != expected {
+			t.Errorf("expected %q, actual %q", expected, actual)
+		}
+	})
+
+	t.Run("long indices", func(t *testing.T) {
+		lists := make(types.List, 600)
+		for i := 0; i < 300; i++ {
+			lists[i] = &types.List{i}
+			lists[300+i] = lists[i]
+		}
+		actual := dumpsNoErr(t, &lists)
+		// x = [[i] for i in range(300)]
+		// len(pickletools.optimize(pickle.dumps(x + x, protocol=2)))
+		if len(actual) != 2714 {
+			t.Errorf("expected length 2714, actual %d", len(actual))
+		}
+		if !strings.HasSuffix(actual, "j+\x01\x00\x00e.") {
+			t.Errorf("expected a final LONG_BINGET, actual %q", actual[len(actual)-8:])
+		}
+		loaded := *loadsNoErr(t, actual).(*types.List)
+		for i := 0; i < 300; i++ {
+			if loaded[i] != loaded[300+i] {
+				t.Fatalf("expected the same list at %d and %d", i, 300+i)
+			}
+		}
+	})
+
+	t.Run("reduce", func(t *testing.T) {
+		r := &reducibleValue{n: 1}
+		actual := dumpsNoErr(t, &types.List{r, r})
+		expected := "\x80\x02](cfoo\nBar\nK\x01\x85Rq\x00h\x00e."
+		if actual != expected {
+			t.Errorf("expected %q, actual %q", expected, actual)
+		}
+	})
+}
+
+func TestPicklerUnsupportedProtocol(t *testing.T) {
+	p := NewPickler(&bytes.Buffer{})
+	p.Protocol = 1
+	if err := p.Dump(nil); err == nil {
+		t.Error("expected error, actual nil")
+	}
+}
+
+func TestPicklerUnsupportedType(t *testing.T) {
+	p := NewPickler(&bytes.Buffer{})
+	if err := p.Dump(struct{}{}); err == nil {
+		t.Error("expected error, actual nil")
+	}
+}
+
+func dumpsNoErr(t *testing.T, value interface{}) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewPickler(&buf).Dump(value); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func mustParseBigInt(s string) *big.Int {
+	bi, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big.Int " + s)
+	}
+	return bi
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+// StringPool interns the strings loaded by the Unpicklers which use it
+// (see Unpickler.Strings), so that the equal strings of a pickle, such as
+// the tokens of a tokenized corpus or the keys of millions of records, are
+// allocated only once, even when the pickle does not memoize them, as it
+// happens for the equal strings which are distinct objects in Python.
+//
+// A StringPool can be shared by the Unpicklers reading related pickles,
+// but it is not safe for concurrent use.
+type StringPool struct {
+	maxLen     int
+	maxStrings int
+	strings    map[string]string
+}
+
+// NewStringPool returns a new StringPool interning the strings of at most
+// maxLen bytes, since the longer ones are seldom repeated. Once the pool
+// holds maxStrings strings, the new ones are not added anymore, and only
+// those already in the pool are shared. Zero, or a negative value, means
+// no limit, for either.
+func NewStringPool(maxLen, maxStrings int) *StringPool {
+	return &StringPool{
+		maxLen:     maxLen,
+		maxStrings: maxStrings,
+		strings:    make(map[string]string),
+	}
+}
+
+// Intern returns the string with the given bytes, which is the same
+// string, sharing the same memory, for all the equal byte sequences. The
+// bytes are not retained.
+func (p *StringPool) Intern(b []byte) string {
+	if p.maxLen > 0 && len(b) > p.maxLen {
+		return string(b)
+	}
+	// the conversion of the key does not allocate
+	if s, ok := p.strings[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if p.maxStrings <= 0 || len(p.strings) < p.maxStrings {
+		p.strings[s] = s
+	}
+	return s
+}
+
+// Len returns the number of strings in the pool.
+func (p *StringPool) Len() int {
+	return len(p.strings)
+}
+
+// newString returns the string with the given bytes, interned in the
+// Strings pool, if any.
+func (u *Unpickler) newString(b []byte) string {
+	if u.Strings == nil {
+		return string(b)
+	}
+	return u.Strings.Intern(b)
+}
@@ -0,0 +1,441 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal unpickles data, with the defaults of NewUnpickler, and stores
+// the result in the value pointed to by v, as Decode does.
+func Unmarshal(data []byte, v interface{}) error {
+	u := NewUnpickler(bytes.NewReader(data))
+	obj, err := u.Load()
+	if err != nil {
+		return err
+	}
+	return Decode(obj, v)
+}
+
+// Decode stores an unpickled value in the value pointed to by v, in the
+// manner of "encoding/json".Unmarshal, converting it to the Go types of
+// v:
+//
+//   - dicts, ordered dicts and the objects of other classes, such as
+//     *types.GenericObject, whose attributes are their "__dict__", or
+//     whose items are set as for the subclasses of dict, are decoded into
+//     maps or structs;
+//   - lists, tuples, sets and frozensets are decoded into slices or
+//     arrays, as are the items of the subclasses of list, the constructor
+//     arguments of the objects without attributes, such as named tuples,
+//     and bytes and bytearrays also into []byte;
+//   - booleans, integers, floats and strings are decoded into Go values
+//     of the corresponding kinds, failing for the integers out of their
+//     range; integers are also decoded into floats, and bytes into
+//     strings;
+//   - any value is stored as it is into an empty interface, or into a
+//     value of its own type.
+//
+// The keys of a dict are matched to the exported fields of a struct by the
+// name given with a "pickle" tag, such as `pickle:"hidden_size"`, or else
+// by the name of the field, ignoring case and underscores. A field tagged
+// `pickle:"-"` is ignored, as are the keys without a field. The fields of
+// an embedded struct are matched as the fields of the outer one.
+//
+// Pointers are allocated as needed, and None sets pointers, interfaces,
+// maps and slices to nil, leaving any other value unchanged.
+func Decode(obj interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Decode: non-nil pointer expected, got %T", v)
+	}
+	return decodeValue(obj, rv.Elem(), "")
+}
+
+// decodeValue stores obj in v, which is settable. path locates v within
+// the value being decoded, for the error messages.
+func decodeValue(obj interface{}, v reflect.Value, path string) error {
+	if obj == nil {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	if ov := reflect.ValueOf(obj); ov.Type().AssignableTo(v.Type()) {
+		v.Set(ov)
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(obj, v.Elem(), path)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(bool); ok {
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := decodeInt(obj); ok {
+			if v.OverflowInt(i) {
+				return fmt.Errorf("Decode: %d overflows %v%s", i, v.Type(), pathSuffix(path))
+			}
+			v.SetInt(i)
+			return nil
+		}
+		if _, ok := obj.(*big.Int); ok {
+			return fmt.Errorf("Decode: %v overflows %v%s", obj, v.Type(), pathSuffix(path))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u, ok := decodeUint(obj); ok {
+			if v.OverflowUint(u) {
+				return fmt.Errorf("Decode: %d overflows %v%s", u, v.Type(), pathSuffix(path))
+			}
+			v.SetUint(u)
+			return nil
+		}
+		if isInteger(obj) {
+			return fmt.Errorf("Decode: %v overflows %v%s", obj, v.Type(), pathSuffix(path))
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := decodeFloat(obj); ok {
+			if v.OverflowFloat(f) && !math.IsInf(f, 0) {
+				return fmt.Errorf("Decode: %v overflows %v%s", obj, v.Type(), pathSuffix(path))
+			}
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.String:
+		switch s := obj.(type) {
+		case string:
+			v.SetString(s)
+			return nil
+		case types.Bytes:
+			v.SetString(string(s))
+			return nil
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			var b []byte
+			switch s := obj.(type) {
+			case types.Bytes:
+				b = s.Bytes()
+			case *types.ByteArray:
+				b = *s
+			}
+			if b != nil {
+				return decodeBytes(b, v)
+			}
+		}
+		if items, ok := sequenceItems(obj); ok {
+			return decodeSequence(items, v, path)
+		}
+	case reflect.Map:
+		if entries, ok := mappingEntries(obj); ok {
+			return decodeMap(entries, v, path)
+		}
+	case reflect.Struct:
+		if entries, ok := mappingEntries(obj); ok {
+			return decodeStruct(entries, v, path)
+		}
+	}
+	return fmt.Errorf("Decode: cannot decode %T into %v%s", obj, v.Type(), pathSuffix(path))
+}
+
+func pathSuffix(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " at " + path
+}
+
+func decodeInt(obj interface{}) (int64, bool) {
+	switch i := obj.(type) {
+	case int:
+		return int64(i), true
+	case int64:
+		return i, true
+	case *big.Int:
+		if i.IsInt64() {
+			return i.Int64(), true
+		}
+	}
+	return 0, false
+}
+
+func decodeUint(obj interface{}) (uint64, bool) {
+	if b, ok := obj.(*big.Int); ok {
+		if b.IsUint64() {
+			return b.Uint64(), true
+		}
+		return 0, false
+	}
+	if i, ok := decodeInt(obj); ok && i >= 0 {
+		return uint64(i), true
+	}
+	return 0, false
+}
+
+func isInteger(obj interface{}) bool {
+	switch obj.(type) {
+	case int, int64, *big.Int:
+		return true
+	default:
+		return false
+	}
+}
+
+func decodeFloat(obj interface{}) (float64, bool) {
+	switch f := obj.(type) {
+	case float64:
+		return f, true
+	case *big.Int:
+		value, _ := new(big.Float).SetInt(f).Float64()
+		return value, true
+	}
+	if i, ok := decodeInt(obj); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+func decodeBytes(b []byte, v reflect.Value) error {
+	if v.Kind() == reflect.Array {
+		reflect.Copy(v, reflect.ValueOf(b))
+		for i := len(b); i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+		return nil
+	}
+	s := reflect.MakeSlice(v.Type(), len(b), len(b))
+	reflect.Copy(s, reflect.ValueOf(b))
+	v.Set(s)
+	return nil
+}
+
+// sequenceItems returns the items of a list, a tuple, a set, a frozenset
+// or a deque, or the constructor arguments of a generic object, such as a
+// named tuple.
+func sequenceItems(obj interface{}) ([]interface{}, bool) {
+	switch s := obj.(type) {
+	case *types.List:
+		return *s, true
+	case *types.Tuple:
+		return *s, true
+	case *types.Set:
+		items := make([]interface{}, 0, len(*s))
+		for item := range *s {
+			items = append(items, item)
+		}
+		return items, true
+	case *types.FrozenSet:
+		items := make([]interface{}, 0, len(*s))
+		for item := range *s {
+			items = append(items, item)
+		}
+		return items, true
+	case *types.Deque:
+		return s.Items, true
+	case *types.GenericObject:
+		if s.ListItems != nil {
+			return s.ListItems, true
+		}
+		if s.Dict == nil && s.DictItems == nil {
+			return s.ConstructorArgs, true
+		}
+	}
+	return nil, false
+}
+
+// decodeSequence stores items in a slice, or in an array, whose extra
+// elements are set to zero, while the extra items are ignored.
+func decodeSequence(items []interface{}, v reflect.Value, path string) error {
+	n := len(items)
+	if v.Kind() == reflect.Array {
+		if n > v.Len() {
+			n = v.Len()
+		}
+		for i := n; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	} else {
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	}
+	for i := 0; i < n; i++ {
+		if err := decodeValue(items[i], v.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mappingEntries returns the entries of a dict, including the defaultdict
+// and Counter subclasses, or of an ordered dict, in order, or the
+// attributes of a generic object.
+func mappingEntries(obj interface{}) ([]types.DictEntry, bool) {
+	switch m := obj.(type) {
+	case *types.Dict:
+		return m.Entries(), true
+	case *types.DefaultDict:
+		return m.Entries(), true
+	case *types.Counter:
+		return m.Entries(), true
+	case *types.OrderedDict:
+		entries := make([]types.DictEntry, 0, m.Len())
+		m.Range(func(key, value interface{}) bool {
+			entries = append(entries, types.DictEntry{Key: key, Value: value})
+			return true
+		})
+		return entries, true
+	case *types.GenericObject:
+		if m.DictItems != nil {
+			return m.DictItems.Entries(), true
+		}
+		if m.Dict == nil {
+			return nil, true
+		}
+		return m.Dict.Entries(), true
+	}
+	return nil, false
+}
+
+func decodeMap(entries []types.DictEntry, v reflect.Value, path string) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(entries)))
+	}
+	keyType, elemType := v.Type().Key(), v.Type().Elem()
+	for _, entry := range entries {
+		key := reflect.New(keyType).Elem()
+		if err := decodeValue(entry.Key, key, path); err != nil {
+			return err
+		}
+		elem := reflect.New(elemType).Elem()
+		if err := decodeValue(entry.Value, elem, path+"["+fmt.Sprint(entry.Key)+"]"); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+func decodeStruct(entries []types.DictEntry, v reflect.Value, path string) error {
+	fields := structFields(v.Type())
+	for _, entry := range entries {
+		var name string
+		switch k := entry.Key.(type) {
+		case string:
+			name = k
+		case types.Bytes:
+			name = string(k)
+		default:
+			continue
+		}
+		field, ok := fields[name]
+		if !ok {
+			field, ok = fields[foldName(name)]
+		}
+		if !ok {
+			continue
+		}
+		fv, err := fieldByIndex(v, field.index)
+		if err != nil {
+			return fmt.Errorf("Decode: %v%s", err, pathSuffix(path+"."+name))
+		}
+		if err := decodeValue(entry.Value, fv, path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structField is an exported field of a struct, possibly of an embedded
+// struct, given by the index sequence of reflect.Value.FieldByIndex.
+type structField struct {
+	index []int
+	// tagged is true if the field is named by a "pickle" tag.
+	tagged bool
+}
+
+// structFields returns the fields of a struct type by the name given with
+// their tag, if any, and by their folded name (see foldName). The fields
+// of the outer struct win over the ones of the embedded structs with the
+// same name, and the tagged fields over the untagged ones.
+func structFields(t reflect.Type) map[string]structField {
+	fields := make(map[string]structField)
+	depths := make(map[string]int)
+	var visit func(t reflect.Type, index []int, depth int)
+	visit = func(t reflect.Type, index []int, depth int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("pickle")
+			if tag == "-" {
+				continue
+			}
+			if comma := strings.IndexByte(tag, ','); comma >= 0 {
+				tag = tag[:comma]
+			}
+			fieldIndex := append(append([]int(nil), index...), i)
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+				visit(ft, fieldIndex, depth+1)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+			name, tagged := tag, true
+			if name == "" {
+				name, tagged = foldName(f.Name), false
+			}
+			if d, ok := depths[name]; ok && (d < depth || (d == depth && fields[name].tagged && !tagged)) {
+				continue
+			}
+			depths[name] = depth
+			fields[name] = structField{index: fieldIndex, tagged: tagged}
+		}
+	}
+	visit(t, nil, 0)
+	return fields
+}
+
+// foldName returns a name in lower case, without underscores, so that the
+// names of Python attributes, such as "hidden_size", match the names of Go
+// fields, such as "HiddenSize".
+func foldName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+// fieldByIndex returns the field of a struct with the given index sequence,
+// allocating the pointers to the embedded structs as needed.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf(
+						"cannot set embedded pointer to unexported struct %v", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Layer = type('Layer', (), {})
+// Config = type('Config', (), {})
+// c = Config()
+// c.hidden_size = 768
+// c.vocab = collections.OrderedDict([('a', 1), ('b', 2)])
+// c.layers = [Layer(), Layer()], with the attributes name and units set
+// to 'fc1', 16 and 'fc2', 4
+// c.dropout = 0.5
+// c.tied = True
+// c.shape = (2, 3)
+// c.note = None
+// c.raw = b'\x00\x01'
+// pickle.dumps(c, protocol=2)
+const pickledConfig = "\x80\x02c__main__\nConfig\nq\x00)\x81q\x01}q\x02(X\x0b\x00\x00\x00hidden_sizeq\x03M\x00\x03" +
+	"X\x05\x00\x00\x00vocabq\x04ccollections\nOrderedDict\nq\x05)Rq\x06(X\x01\x00\x00\x00aq\x07K\x01" +
+	"X\x01\x00\x00\x00bq\x08K\x02uX\x06\x00\x00\x00layersq\x09]q\n(c__main__\nLayer\nq\x0b)\x81q\x0c}q\x0d" +
+	"(X\x04\x00\x00\x00nameq\x0eX\x03\x00\x00\x00fc1q\x0fX\x05\x00\x00\x00unitsq\x10K\x10ubh\x0b)\x81q\x11" +
+	"}q\x12(h\x0eX\x03\x00\x00\x00fc2q\x13h\x10K\x04ubeX\x07\x00\x00\x00dropoutq\x14G?\xe0\x00\x00\x00\x00\x00\x00" +
+	"X\x04\x00\x00\x00tiedq\x15\x88X\x05\x00\x00\x00shapeq\x16K\x02K\x03\x86q\x17X\x04\x00\x00\x00noteq\x18N" +
+	"X\x03\x00\x00\x00rawq\x19c_codecs\nencode\nq\x1aX\x02\x00\x00\x00\x00\x01q\x1bX\x06\x00\x00\x00latin1q\x1c" +
+	"\x86q\x1dRq\x1eub."
+
+type unmarshalLayer struct {
+	Name  string
+	Units int
+}
+
+type unmarshalConfig struct {
+	HiddenSize int
+	Vocab      map[string]int
+	Layers     []*unmarshalLayer
+	Dropout    float32
+	Tied       bool `pickle:"tied"`
+	Shape      [2]int
+	Note       *string
+	Raw        []byte
+	Ignored    string `pickle:"-"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	note := "to be reset"
+	config := unmarshalConfig{Note: &note, Ignored: "unchanged"}
+	if err := Unmarshal([]byte(pickledConfig), &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := unmarshalConfig{
+		HiddenSize: 768,
+		Vocab:      map[string]int{"a": 1, "b": 2},
+		Layers:     []*unmarshalLayer{{Name: "fc1", Units: 16}, {Name: "fc2", Units: 4}},
+		Dropout:    0.5,
+		Tied:       true,
+		Shape:      [2]int{2, 3},
+		Raw:        []byte{0, 1},
+		Ignored:    "unchanged",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, actual %+v", expected, config)
+	}
+
+	t.Run("embedded and tagged fields", func(t *testing.T) {
+		type Sizes struct {
+			Hidden int `pickle:"hidden_size"`
+		}
+		var v struct {
+			*Sizes
+			Count map[string]interface{} `pickle:"vocab"`
+		}
+		if err := Unmarshal([]byte(pickledConfig), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Sizes == nil || v.Hidden != 768 {
+			t.Errorf("expected hidden size 768, actual %+v", v.Sizes)
+		}
+		if len(v.Count) != 2 || v.Count["b"] != 2 {
+			t.Errorf("expected the vocabulary, actual %v", v.Count)
+		}
+	})
+
+	t.Run("empty interface", func(t *testing.T) {
+		var v interface{}
+		if err := Unmarshal([]byte(pickledConfig), &v); err != nil {
+			t.Fatal(err)
+		}
+		obj, ok := v.(*types.GenericObject)
+		if !ok || obj.Class.Name != "Config" || obj.Dict == nil {
+			t.Fatalf("expected a Config object, actual %#v", v)
+		}
+		if size := obj.Dict.MustGet("hidden_size"); size != 768 {
+			t.Errorf("expected hidden_size 768, actual %v", size)
+		}
+	})
+
+	t.Run("named tuple", func(t *testing.T) {
+		// Point = collections.namedtuple('Point', 'x y')
+		// pickle.dumps(Point(1, 2), protocol=2)
+		var point []int8
+		if err := Unmarshal([]byte("\x80\x02c__main__\nPoint\nq\x00K\x01K\x02\x86q\x01\x81q\x02."), &point); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(point, []int8{1, 2}) {
+			t.Errorf("expected [1 2], actual %v", point)
+		}
+	})
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	// pickle.dumps({'n': 2 ** 70, 'm': -1, 'k': 300}, protocol=2)
+	data := []byte("\x80\x02}q\x00(X\x01\x00\x00\x00nq\x01\x8a\x09\x00\x00\x00\x00\x00\x00\x00\x00@" +
+		"X\x01\x00\x00\x00mq\x02J\xff\xff\xff\xffX\x01\x00\x00\x00kq\x03M,\x01u.")
+
+	var floats map[string]float64
+	if err := Unmarshal(data, &floats); err != nil {
+		t.Fatal(err)
+	}
+	if floats["n"] != 1<<70 || floats["m"] != -1 || floats["k"] != 300 {
+		t.Errorf("unexpected values %v", floats)
+	}
+
+	testCases := []struct {
+		name     string
+		v        interface{}
+		expected string
+	}{
+		{"big int", &struct{ N int64 }{}, "Decode: 1180591620717411303424 overflows int64 at .n"},
+		{"negative uint", &struct{ M uint }{}, "Decode: -1 overflows uint at .m"},
+		{"small int", &struct{ K int8 }{}, "Decode: 300 overflows int8 at .k"},
+		{"type", &struct{ K string }{}, "Decode: cannot decode int into string at .k"},
+		{"map key", &map[int]int{}, "Decode: cannot decode string into int"},
+		{"non-pointer", struct{}{}, "Decode: non-nil pointer expected, got struct {}"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Unmarshal(data, tc.v)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, actual %v", tc.expected, err)
+			}
+		})
+	}
+}
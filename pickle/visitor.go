@@ -0,0 +1,188 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickle
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"reflect"
+)
+
+// Visitor receives the events of an Unpickler as the objects are built
+// (see Unpickler.Visitor), so that the elements of huge containers, such
+// as a list of millions of records, can be processed as soon as they are
+// unpickled, and discarded rather than kept in memory until Load returns.
+//
+// Returning an error from any method stops Load with that error.
+type Visitor interface {
+	// BeginList is called when a new list is created, before any of its
+	// items is added.
+	BeginList(list *types.List) error
+	// Item is called for each item about to be appended to a list, or to
+	// any other types.ListAppender, which is called the same for all
+	// the items of the same container. The item is complete, including the
+	// state set by BUILD. If keep is false, the item is not appended.
+	Item(list interface{}, item interface{}) (keep bool, err error)
+	// BeginDict is called when a new dict is created, before any of its
+	// entries is set.
+	BeginDict(dict *types.Dict) error
+	// KeyValue is called for each entry about to be set into a dict, or
+	// into any other types.DictSetter, as Item. If keep is false, the
+	// entry is not set.
+	KeyValue(dict interface{}, key, value interface{}) (keep bool, err error)
+	// Object is called for each object constructed by the REDUCE, NEWOBJ,
+	// NEWOBJ_EX, INST and OBJ opcodes, before its state, if any, is set by
+	// BUILD.
+	Object(obj interface{}) error
+}
+
+// NopVisitor is a Visitor which keeps all the items and does nothing
+// else. It can be embedded by the visitors interested only in some of the
+// events.
+type NopVisitor struct{}
+
+var _ Visitor = NopVisitor{}
+
+func (NopVisitor) BeginList(*types.List) error { return nil }
+
+func (NopVisitor) Item(interface{}, interface{}) (bool, error) { return true, nil }
+
+func (NopVisitor) BeginDict(*types.Dict) error { return nil }
+
+func (NopVisitor) KeyValue(interface{}, interface{}, interface{}) (bool, error) { return true, nil }
+
+func (NopVisitor) Object(interface{}) error { return nil }
+
+// visitItems calls the Item method of the Visitor, if any, for the items
+// to append to list, returning those to keep. The discarded items are
+// forgotten from the memo entries set since the given position of the
+// memoJournal.
+func (u *Unpickler) visitItems(list interface{}, items []interface{}, since int) ([]interface{}, error) {
+	if u.Visitor == nil {
+		return items, nil
+	}
+	kept := items[:0]
+	var discarded []interface{}
+	for _, item := range items {
+		keep, err := u.Visitor.Item(list, item)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			kept = append(kept, item)
+		} else {
+			discarded = append(discarded, item)
+		}
+	}
+	u.forget(list, kept, discarded, since)
+	return kept, nil
+}
+
+// visitKeyValues calls the KeyValue method of the Visitor, if any, for the
+// keys and values, alternated in items, to set into dict, returning those
+// to keep, forgetting the discarded values as visitItems.
+func (u *Unpickler) visitKeyValues(dict interface{}, items []interface{}, since int) ([]interface{}, error) {
+	if u.Visitor == nil {
+		return items, nil
+	}
+	kept := items[:0]
+	var discarded []interface{}
+	for i := 0; i+1 < len(items); i += 2 {
+		keep, err := u.Visitor.KeyValue(dict, items[i], items[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			kept = append(kept, items[i], items[i+1])
+		} else {
+			discarded = append(discarded, items[i+1])
+		}
+	}
+	u.forget(dict, kept, discarded, since)
+	return kept, nil
+}
+
+// visitObject calls the Object method of the Visitor, if any.
+func (u *Unpickler) visitObject(obj interface{}) error {
+	if u.Visitor == nil {
+		return nil
+	}
+	return u.Visitor.Object(obj)
+}
+
+// forget drops from the memo the discarded values, and the lists, tuples
+// and dicts they contain, which were memoized since the given position of
+// the memoJournal, that is since the MARK of the batch of items of the
+// target container, so that they can be garbage collected. The strings
+// and the other values which are not pointers are kept, since the later
+// items often refer to them, as the keys shared by records, and so are
+// the containers still reachable from the kept items or from the stack.
+func (u *Unpickler) forget(target interface{}, kept, discarded []interface{}, since int) {
+	if len(discarded) == 0 || since > len(u.memoJournal) {
+		return
+	}
+	containers := make(map[interface{}]bool)
+	for _, v := range discarded {
+		collectContainers(v, containers)
+	}
+	// The items already in the target were complete before the MARK, so
+	// they cannot refer to the values built since: it is not walked.
+	live := make(map[interface{}]bool)
+	if reflect.TypeOf(target).Kind() == reflect.Ptr {
+		live[target] = true
+	}
+	for _, v := range kept {
+		collectContainers(v, live)
+	}
+	for _, v := range u.stack {
+		collectContainers(v, live)
+	}
+	for _, stack := range u.metaStack {
+		for _, v := range stack {
+			collectContainers(v, live)
+		}
+	}
+	journal := u.memoJournal[:since]
+	for _, key := range u.memoJournal[since:] {
+		v := u.memo[key]
+		if v != nil && reflect.TypeOf(v).Kind() == reflect.Ptr && containers[v] && !live[v] {
+			delete(u.memo, key)
+			continue
+		}
+		journal = append(journal, key)
+	}
+	u.memoJournal = journal
+}
+
+// collectContainers adds v to containers, along with the lists, tuples
+// and dicts it contains, recursively, if it is one of them.
+func collectContainers(v interface{}, containers map[interface{}]bool) {
+	switch c := v.(type) {
+	case *types.List:
+		if containers[c] {
+			return
+		}
+		containers[c] = true
+		for _, item := range *c {
+			collectContainers(item, containers)
+		}
+	case *types.Tuple:
+		if containers[c] {
+			return
+		}
+		containers[c] = true
+		for _, item := range *c {
+			collectContainers(item, containers)
+		}
+	case *types.Dict:
+		if containers[c] {
+			return
+		}
+		containers[c] = true
+		for _, entry := range c.Entries() {
+			collectContainers(entry.Key, containers)
+			collectContainers(entry.Value, containers)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickletools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// reader reads a pickle exactly, without reading ahead, counting the
+// bytes read.
+type reader struct {
+	r   io.Reader
+	pos int64
+	buf [1]byte
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{r: r}
+}
+
+func (r *reader) ReadByte() (byte, error) {
+	if br, ok := r.r.(io.ByteReader); ok {
+		b, err := br.ReadByte()
+		if err == nil {
+			r.pos++
+		}
+		return b, err
+	}
+	if _, err := io.ReadFull(r.r, r.buf[:]); err != nil {
+		return 0, err
+	}
+	r.pos++
+	return r.buf[0], nil
+}
+
+// read reads up to n bytes, stopping at the end of the pickle, so that
+// a wrong length in a corrupted pickle does not make a large allocation.
+func (r *reader) read(n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	for uint64(buf.Len()) < n {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// readLine reads a line, ensuring that it ends with a newline, which is
+// removed. The format of the line is used by the error message.
+func (r *reader) readLine(format string) ([]byte, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no newline found when trying to read %s", format)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == '\n' {
+			return line, nil
+		}
+		line = append(line, b)
+	}
+}
+
+// readExactly reads n bytes, failing if the pickle is shorter.
+func (r *reader) readExactly(n uint64, format string) ([]byte, error) {
+	data, err := r.read(n)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != n {
+		return nil, fmt.Errorf("expected %d bytes in a %s, but only %d remain", n, format, len(data))
+	}
+	return data, nil
+}
+
+// argReaders holds the functions reading and decoding the arguments of
+// the opcodes, by the name of their format (see Opcode.Arg).
+var argReaders = map[string]func(r *reader) (interface{}, error){
+	"uint1":                  readUint1,
+	"uint2":                  readFixedUint(2),
+	"int4":                   readInt4,
+	"uint4":                  readFixedUint(4),
+	"uint8":                  readFixedUint(8),
+	"decimalnl_short":        readDecimalnlShort,
+	"decimalnl_long":         readDecimalnlLong,
+	"floatnl":                readFloatnl,
+	"float8":                 readFloat8,
+	"stringnl":               readStringnl,
+	"stringnl_noescape":      readStringnlNoescape,
+	"stringnl_noescape_pair": readStringnlNoescapePair,
+	"string1":                readString(1),
+	"string4":                readString(4),
+	"bytes1":                 readBytes(1),
+	"bytes4":                 readBytes(4),
+	"bytes8":                 readBytes(8),
+	"bytearray8":             readBytearray8,
+	"unicodestringnl":        readUnicodeStringnl,
+	"unicodestring1":         readUnicodeString(1),
+	"unicodestring4":         readUnicodeString(4),
+	"unicodestring8":         readUnicodeString(8),
+	"long1":                  readLong(1),
+	"long4":                  readLong(4),
+}
+
+// readUint reads a little-endian unsigned integer of the given size.
+func readUint(r *reader, size int) (uint64, error) {
+	data, err := r.read(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != size {
+		return 0, fmt.Errorf("not enough data in stream to read uint%d", size)
+	}
+	var v uint64
+	for i := size - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+	return v, nil
+}
+
+func readUint1(r *reader) (interface{}, error) {
+	v, err := readUint(r, 1)
+	return int(v), err
+}
+
+func readFixedUint(size int) func(r *reader) (interface{}, error) {
+	return func(r *reader) (interface{}, error) {
+		v, err := readUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return uintArg(v), nil
+	}
+}
+
+// uintArg returns an unsigned integer as an int, if it fits.
+func uintArg(v uint64) interface{} {
+	if v > uint64(math.MaxInt64) || int64(int(v)) != int64(v) {
+		return new(big.Int).SetUint64(v)
+	}
+	return int(v)
+}
+
+func readInt4(r *reader) (interface{}, error) {
+	data, err := r.read(4)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 4 {
+		return nil, fmt.Errorf("not enough data in stream to read int4")
+	}
+	return int(int32(binary.LittleEndian.Uint32(data))), nil
+}
+
+func readDecimalnlShort(r *reader) (interface{}, error) {
+	s, err := r.readLine("stringnl")
+	if err != nil {
+		return nil, err
+	}
+	// The protocol 0 spellings of True and False.
+	switch string(s) {
+	case "00":
+		return false, nil
+	case "01":
+		return true, nil
+	}
+	return parseInt(string(s))
+}
+
+func readDecimalnlLong(r *reader) (interface{}, error) {
+	s, err := r.readLine("stringnl")
+	if err != nil {
+		return nil, err
+	}
+	return parseInt(strings.TrimSuffix(string(s), "L"))
+}
+
+// parseInt parses a decimal integer, returning an int if it fits, or a
+// *big.Int.
+func parseInt(s string) (interface{}, error) {
+	if i, err := strconv.Atoi(s); err == nil {
+		return i, nil
+	}
+	bi, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid literal for int() with base 10: %s", reprString(s))
+	}
+	return bi, nil
+}
+
+func readFloatnl(r *reader) (interface{}, error) {
+	s, err := r.readLine("stringnl")
+	if err != nil {
+		return nil, err
+	}
+	f, err := strconv.ParseFloat(string(s), 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert string to float: %s", reprBytes(s))
+	}
+	return f, nil
+}
+
+func readFloat8(r *reader) (interface{}, error) {
+	data, err := r.read(8)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 8 {
+		return nil, fmt.Errorf("not enough data in stream to read float8")
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+}
+
+// readStringnl reads the quoted and escaped string of a STRING opcode.
+func readStringnl(r *reader) (interface{}, error) {
+	data, err := r.readLine("stringnl")
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || (data[0] != '"' && data[0] != '\'') {
+		return nil, fmt.Errorf("no string quotes around %s", reprBytes(data))
+	}
+	if data[len(data)-1] != data[0] {
+		return nil, fmt.Errorf("string quote %s not found at both ends of %s",
+			reprBytes(data[:1]), reprBytes(data))
+	}
+	return unescapeString(data[1 : len(data)-1])
+}
+
+// readStringnlNoescape reads an unquoted string, such as a module name. As
+// in Python, its escape sequences are decoded anyway.
+func readStringnlNoescape(r *reader) (interface{}, error) {
+	data, err := r.readLine("stringnl")
+	if err != nil {
+		return nil, err
+	}
+	return unescapeString(data)
+}
+
+func readStringnlNoescapePair(r *reader) (interface{}, error) {
+	module, err := readStringnlNoescape(r)
+	if err != nil {
+		return nil, err
+	}
+	name, err := readStringnlNoescape(r)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%s %s", module, name), nil
+}
+
+// readString returns a function reading a string of bytes, preceded by its
+// length of the given size, as a latin-1 string.
+func readString(size int) func(r *reader) (interface{}, error) {
+	format := fmt.Sprintf("string%d", size)
+	return func(r *reader) (interface{}, error) {
+		n, err := readUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.readExactly(n, format)
+		if err != nil {
+			return nil, err
+		}
+		return latin1String(data), nil
+	}
+}
+
+func readBytes(size int) func(r *reader) (interface{}, error) {
+	format := fmt.Sprintf("bytes%d", size)
+	return func(r *reader) (interface{}, error) {
+		n, err := readUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.readExactly(n, format)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewBytes(data), nil
+	}
+}
+
+func readBytearray8(r *reader) (interface{}, error) {
+	n, err := readUint(r, 8)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.readExactly(n, "bytearray8")
+	if err != nil {
+		return nil, err
+	}
+	return types.NewByteArrayFromSlice(data), nil
+}
+
+func readUnicodeStringnl(r *reader) (interface{}, error) {
+	data, err := r.readLine("unicodestringnl")
+	if err != nil {
+		return nil, err
+	}
+	return decodeRawUnicodeEscape(data)
+}
+
+func readUnicodeString(size int) func(r *reader) (interface{}, error) {
+	format := fmt.Sprintf("unicodestring%d", size)
+	return func(r *reader) (interface{}, error) {
+		n, err := readUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.readExactly(n, format)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("invalid UTF-8 data in a %s", format)
+		}
+		return string(data), nil
+	}
+}
+
+// readLong returns a function reading a little-endian two's complement
+// integer, preceded by its length in bytes of the given size.
+func readLong(size int) func(r *reader) (interface{}, error) {
+	format := fmt.Sprintf("long%d", size)
+	return func(r *reader) (interface{}, error) {
+		n, err := readUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		if size == 4 && int32(n) < 0 {
+			return nil, fmt.Errorf("long4 byte count < 0: %d", int32(n))
+		}
+		data, err := r.read(n)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(data)) != n {
+			return nil, fmt.Errorf("not enough data in stream to read %s", format)
+		}
+		return decodeLong(data), nil
+	}
+}
+
+// decodeLong decodes a little-endian two's complement integer, returning
+// an int if it fits, or a *big.Int.
+func decodeLong(data []byte) interface{} {
+	if len(data) == 0 {
+		return 0
+	}
+	be := make([]byte, len(data))
+	for i, b := range data {
+		be[len(data)-1-i] = b
+	}
+	v := new(big.Int).SetBytes(be)
+	if data[len(data)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*len(data))))
+	}
+	if v.IsInt64() && int64(int(v.Int64())) == v.Int64() {
+		return int(v.Int64())
+	}
+	return v
+}
+
+// latin1String decodes latin-1 data.
+func latin1String(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// unescapeString decodes the escape sequences of a Python string literal,
+// as the Python function "codecs.escape_decode", requiring the result to
+// be ASCII.
+func unescapeString(data []byte) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(data) {
+			return "", fmt.Errorf("trailing \\ in string")
+		}
+		switch c = data[i]; c {
+		case '\n':
+		case '\\', '\'', '"':
+			sb.WriteByte(c)
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case 'x':
+			if i+2 >= len(data) {
+				return "", fmt.Errorf("invalid \\x escape at position %d", i-1)
+			}
+			v, err := strconv.ParseUint(string(data[i+1:i+3]), 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid \\x escape at position %d", i-1)
+			}
+			sb.WriteByte(byte(v))
+			i += 2
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			v := int(c - '0')
+			for j := 0; j < 2 && i+1 < len(data) && data[i+1] >= '0' && data[i+1] <= '7'; j++ {
+				i++
+				v = v*8 + int(data[i]-'0')
+			}
+			sb.WriteByte(byte(v))
+		default:
+			// unknown escapes are kept as they are
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		}
+	}
+	s := sb.String()
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return "", fmt.Errorf("'ascii' codec can't decode byte 0x%02x in position %d", s[i], i)
+		}
+	}
+	return s, nil
+}
+
+// decodeRawUnicodeEscape decodes data with the Python "raw-unicode-escape"
+// codec: latin-1, with the escape sequences \uXXXX and \UXXXXXXXX.
+func decodeRawUnicodeEscape(data []byte) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c != '\\' || i+1 == len(data) || (data[i+1] != 'u' && data[i+1] != 'U') {
+			sb.WriteRune(rune(c))
+			continue
+		}
+		// an escaped backslash is a backslash preceded by an odd number of
+		// backslashes
+		backslashes := 0
+		for j := i - 1; j >= 0 && data[j] == '\\'; j-- {
+			backslashes++
+		}
+		if backslashes%2 != 0 {
+			sb.WriteRune(rune(c))
+			continue
+		}
+		n := 4
+		if data[i+1] == 'U' {
+			n = 8
+		}
+		if i+2+n > len(data) {
+			return "", fmt.Errorf("truncated \\%cXXXX escape at position %d", data[i+1], i)
+		}
+		v, err := strconv.ParseUint(string(data[i+2:i+2+n]), 16, 32)
+		if err != nil || v > unicode.MaxRune {
+			return "", fmt.Errorf("invalid \\%c escape at position %d", data[i+1], i)
+		}
+		sb.WriteRune(rune(v))
+		i += 1 + n
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,299 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickletools
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Dis reads a pickle from r, up to the first STOP opcode included, and
+// writes to w a symbolic disassembly of it, in the same format of the
+// Python function "pickletools.dis": one line for each opcode, with its
+// position, code, name and argument, indented by the MARK opcodes still
+// on the stack, and a last line with the highest protocol among the
+// opcodes.
+//
+// The stack and the memo of the pickle machine are emulated, so that an
+// error is returned, after the line of the offending opcode, if the pickle
+// pops more objects than those on the stack, refers to a missing MARK,
+// gets a memo key which was never stored into, or redefines one. Each
+// line is written as soon as its opcode is read.
+func Dis(r io.Reader, w io.Writer) error {
+	d := &disassembler{w: w, maxProto: -1, memo: make(map[interface{}]string)}
+	if err := genops(newReader(r), d.op); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "highest protocol among opcodes = %d\n", d.maxProto); err != nil {
+		return err
+	}
+	if len(d.stack) > 0 {
+		return fmt.Errorf("stack not empty after STOP: [%s]", strings.Join(d.stack, ", "))
+	}
+	return nil
+}
+
+// disassembler holds the state of Dis: the emulated stack, holding the
+// kinds of the objects, the memo and the positions of the MARK opcodes.
+type disassembler struct {
+	w         io.Writer
+	stack     []string
+	memo      map[interface{}]string
+	markStack []int64
+	maxProto  int
+}
+
+// markObject is the kind of the mark objects on the stack.
+const markObject = "mark"
+
+// op prints an opcode and emulates its effects.
+func (d *disassembler) op(op Op) error {
+	opcode := op.Opcode
+	line := fmt.Sprintf("%5d: %-4s %s%s", op.Pos, reprCode(opcode.Code),
+		strings.Repeat("    ", len(d.markStack)), opcode.Name)
+	if opcode.Proto > d.maxProto {
+		d.maxProto = opcode.Proto
+	}
+	before, after := opcode.StackBefore, opcode.StackAfter
+	numToPop := len(before)
+
+	var markMsg, errMsg string
+	markIndex := indexOf(before, markObject)
+	if markIndex >= 0 || (opcode.Name == "POP" && len(d.stack) > 0 && d.stack[len(d.stack)-1] == markObject) {
+		if len(d.markStack) > 0 {
+			markPos := d.markStack[len(d.markStack)-1]
+			d.markStack = d.markStack[:len(d.markStack)-1]
+			markMsg = fmt.Sprintf("(MARK at %d)", markPos)
+			// everything at and after the topmost mark is popped
+			for d.stack[len(d.stack)-1] != markObject {
+				d.stack = d.stack[:len(d.stack)-1]
+			}
+			d.stack = d.stack[:len(d.stack)-1]
+			numToPop = 0
+			if markIndex >= 0 {
+				numToPop = markIndex
+			}
+		} else {
+			markMsg = "no MARK exists on stack"
+			errMsg = markMsg
+		}
+	}
+
+	switch opcode.Name {
+	case "PUT", "BINPUT", "LONG_BINPUT", "MEMOIZE":
+		var key interface{}
+		if opcode.Name == "MEMOIZE" {
+			key = len(d.memo)
+			markMsg = fmt.Sprintf("(as %d)", key)
+		} else {
+			key = memoKey(op.Arg)
+		}
+		if _, ok := d.memo[key]; ok {
+			errMsg = fmt.Sprintf("memo key %s already defined", repr(op.Arg))
+		} else if len(d.stack) == 0 {
+			errMsg = "stack is empty -- can't store into memo"
+		} else if d.stack[len(d.stack)-1] == markObject {
+			errMsg = "can't store markobject in the memo"
+		} else {
+			d.memo[key] = d.stack[len(d.stack)-1]
+		}
+	case "GET", "BINGET", "LONG_BINGET":
+		if kind, ok := d.memo[memoKey(op.Arg)]; ok {
+			after = []string{kind}
+		} else {
+			errMsg = fmt.Sprintf("memo key %s has never been stored into", repr(op.Arg))
+		}
+	}
+
+	if op.Arg != nil || markMsg != "" {
+		// the arguments are roughly aligned
+		if n := 10 - len(opcode.Name); n > 0 {
+			line += strings.Repeat(" ", n)
+		}
+		if op.Arg != nil {
+			line += " " + repr(op.Arg)
+		}
+		if markMsg != "" {
+			line += " " + markMsg
+		}
+	}
+	if _, err := fmt.Fprintln(d.w, line); err != nil {
+		return err
+	}
+	if errMsg != "" {
+		return fmt.Errorf("%s", errMsg)
+	}
+
+	if len(d.stack) < numToPop {
+		return fmt.Errorf("tries to pop %d items from stack with only %d items", numToPop, len(d.stack))
+	}
+	d.stack = d.stack[:len(d.stack)-numToPop]
+	if indexOf(after, markObject) >= 0 {
+		d.markStack = append(d.markStack, op.Pos)
+	}
+	d.stack = append(d.stack, after...)
+	return nil
+}
+
+func indexOf(s []string, v string) int {
+	for i, item := range s {
+		if item == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// memoKey returns the key of the memo for the argument of an opcode: the
+// booleans of the INT-like spellings of PUT and GET are the same as 0 and
+// 1, as in Python.
+func memoKey(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case *big.Int:
+		return v.String()
+	default:
+		return arg
+	}
+}
+
+// reprCode returns the code of an opcode as in the Python representation
+// of a string, without quotes.
+func reprCode(code byte) string {
+	if code >= 0x20 && code < 0x7f {
+		return string(rune(code))
+	}
+	return fmt.Sprintf("\\x%02x", code)
+}
+
+// repr returns the Python representation of an argument of an opcode.
+func repr(v interface{}) string {
+	switch a := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if a {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(a)
+	case *big.Int:
+		return a.String()
+	case float64:
+		return reprFloat(a)
+	case string:
+		return reprString(a)
+	case types.Bytes:
+		return reprBytes(a.Bytes())
+	case *types.ByteArray:
+		return "bytearray(" + reprBytes(a.Bytes()) + ")"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// reprFloat formats a float as the Python function "repr": the shortest
+// representation of the value, with a fractional part, in exponential
+// notation for the exponents below -4 or from 16.
+func reprFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+	if exp < -4 || exp >= 16 {
+		return e
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsRune(s, '.') {
+		s += ".0"
+	}
+	return s
+}
+
+// reprQuote returns the quote of the Python representation of a string
+// containing the given quotes.
+func reprQuote(hasSingle, hasDouble bool) byte {
+	if hasSingle && !hasDouble {
+		return '"'
+	}
+	return '\''
+}
+
+// reprString formats a string as the Python function "repr".
+func reprString(s string) string {
+	quote := reprQuote(strings.ContainsRune(s, '\''), strings.ContainsRune(s, '"'))
+	var sb strings.Builder
+	sb.WriteByte(quote)
+	for _, c := range s {
+		switch {
+		case c == rune(quote) || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(c)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\r':
+			sb.WriteString(`\r`)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&sb, "\\x%02x", c)
+		case c < 0x7f || unicode.IsPrint(c):
+			sb.WriteRune(c)
+		case c <= 0xff:
+			fmt.Fprintf(&sb, "\\x%02x", c)
+		case c <= 0xffff:
+			fmt.Fprintf(&sb, "\\u%04x", c)
+		default:
+			fmt.Fprintf(&sb, "\\U%08x", c)
+		}
+	}
+	sb.WriteByte(quote)
+	return sb.String()
+}
+
+// reprBytes formats bytes as the Python function "repr".
+func reprBytes(b []byte) string {
+	s := string(b)
+	quote := reprQuote(strings.ContainsRune(s, '\''), strings.ContainsRune(s, '"'))
+	var sb strings.Builder
+	sb.WriteString("b")
+	sb.WriteByte(quote)
+	for _, c := range b {
+		switch {
+		case c == quote || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\r':
+			sb.WriteString(`\r`)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&sb, "\\x%02x", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte(quote)
+	return sb.String()
+}
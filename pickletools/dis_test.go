@@ -0,0 +1,115 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickletools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDis(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pickle   string
+		expected string
+	}{
+		{
+			// pickle.dumps({'a': [1, 2.5, 'x'], 'b': (True, None)}, protocol=0)
+			"protocol 0",
+			"(dp0\nVa\np1\n(lp2\nI1\naF2.5\naVx\np3\nasVb\np4\n(I01\nNtp5\ns.",
+			"    0: (    MARK\n" +
+				"    1: d        DICT       (MARK at 0)\n" +
+				"    2: p    PUT        0\n" +
+				"    5: V    UNICODE    'a'\n" +
+				"    8: p    PUT        1\n" +
+				"   11: (    MARK\n" +
+				"   12: l        LIST       (MARK at 11)\n" +
+				"   13: p    PUT        2\n" +
+				"   16: I    INT        1\n" +
+				"   19: a    APPEND\n" +
+				"   20: F    FLOAT      2.5\n" +
+				"   25: a    APPEND\n" +
+				"   26: V    UNICODE    'x'\n" +
+				"   29: p    PUT        3\n" +
+				"   32: a    APPEND\n" +
+				"   33: s    SETITEM\n" +
+				"   34: V    UNICODE    'b'\n" +
+				"   37: p    PUT        4\n" +
+				"   40: (    MARK\n" +
+				"   41: I        INT        True\n" +
+				"   45: N        NONE\n" +
+				"   46: t        TUPLE      (MARK at 40)\n" +
+				"   47: p    PUT        5\n" +
+				"   50: s    SETITEM\n" +
+				"   51: .    STOP\n" +
+				"highest protocol among opcodes = 0\n",
+		},
+		{
+			// pickle.dumps([b'\x00\xff', 2 ** 70, -1, 'é', frozenset([3])], protocol=4)
+			"protocol 4",
+			"\x80\x04\x95$\x00\x00\x00\x00\x00\x00\x00]\x94(C\x02\x00\xff\x94\x8a\x09\x00\x00\x00\x00" +
+				"\x00\x00\x00\x00@J\xff\xff\xff\xff\x8c\x02\xc3\xa9\x94(K\x03\x91\x94e.",
+			"    0: \\x80 PROTO      4\n" +
+				"    2: \\x95 FRAME      36\n" +
+				"   11: ]    EMPTY_LIST\n" +
+				"   12: \\x94 MEMOIZE    (as 0)\n" +
+				"   13: (    MARK\n" +
+				"   14: C        SHORT_BINBYTES b'\\x00\\xff'\n" +
+				"   18: \\x94     MEMOIZE    (as 1)\n" +
+				"   19: \\x8a     LONG1      1180591620717411303424\n" +
+				"   30: J        BININT     -1\n" +
+				"   35: \\x8c     SHORT_BINUNICODE 'é'\n" +
+				"   39: \\x94     MEMOIZE    (as 2)\n" +
+				"   40: (        MARK\n" +
+				"   41: K            BININT1    3\n" +
+				"   43: \\x91         FROZENSET  (MARK at 40)\n" +
+				"   44: \\x94     MEMOIZE    (as 3)\n" +
+				"   45: e        APPENDS    (MARK at 13)\n" +
+				"   46: .    STOP\n" +
+				"highest protocol among opcodes = 4\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := Dis(strings.NewReader(tc.pickle), &sb); err != nil {
+				t.Fatal(err)
+			}
+			if sb.String() != tc.expected {
+				t.Errorf("expected:\n%s\nactual:\n%s", tc.expected, sb.String())
+			}
+		})
+	}
+}
+
+func TestDisErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pickle   string
+		expected string
+		lastLine string
+	}{
+		{"missing memo key", "h\x00.", "memo key 0 has never been stored into", "    0: h    BINGET     0"},
+		{"redefined memo key", "Nq\x00q\x00.", "memo key 0 already defined", "    3: q    BINPUT     0"},
+		{"missing mark", "t.", "no MARK exists on stack", "    0: t    TUPLE      no MARK exists on stack"},
+		{"empty stack", "0.", "tries to pop 1 items from stack with only 0 items", "    0: 0    POP"},
+		{"stack not empty", "NN.", "stack not empty after STOP: [None]", "highest protocol among opcodes = 0"},
+		{"unknown opcode", "N\xff", "at position 1, opcode b'\\xff' unknown", "    0: N    NONE"},
+		{"missing stop", "N", "pickle exhausted before seeing STOP", "    0: N    NONE"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			err := Dis(strings.NewReader(tc.pickle), &sb)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected error %q, actual %v", tc.expected, err)
+			}
+			lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+			if lastLine := lines[len(lines)-1]; lastLine != tc.lastLine {
+				t.Errorf("expected last line %q, actual %q", tc.lastLine, lastLine)
+			}
+		})
+	}
+}
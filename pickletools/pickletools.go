@@ -0,0 +1,215 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package pickletools provides tools for inspecting pickle data, as the Python
+"pickletools" module: Genops reads the opcodes of a pickle, along with their
+arguments and positions, and Dis prints them in the same format of the
+Python function "pickletools.dis".
+
+Unlike the unpickler of package pickle, these tools never make any object,
+so that they are useful for debugging the pickles which fail to load, for
+example because of an unknown class.
+*/
+package pickletools
+
+import (
+	"fmt"
+	"io"
+)
+
+// Opcode describes an opcode of the pickle machine.
+type Opcode struct {
+	// Code is the byte of the opcode.
+	Code byte
+	// Name is the symbolic name of the opcode, such as "BININT1".
+	Name string
+	// Arg is the name of the format of the argument of the opcode, which
+	// follows it in the pickle, as in Python (for example "uint1" for a
+	// 1-byte unsigned integer), or the empty string if the opcode has no
+	// argument.
+	Arg string
+	// Proto is the pickle protocol which introduced the opcode.
+	Proto int
+	// StackBefore and StackAfter describe the top of the stack of the
+	// pickle machine before and after the opcode, with the names of the
+	// kinds of objects used by Python, such as "any", "list" and "mark".
+	// The special name "stackslice" stands for all the objects above the
+	// topmost mark.
+	StackBefore []string
+	StackAfter  []string
+}
+
+// Opcodes is the list of all the known opcodes, in the order of the Python
+// "pickletools.opcodes".
+var Opcodes = []*Opcode{
+	// Integers.
+	{Code: 'I', Name: "INT", Arg: "decimalnl_short", Proto: 0, StackBefore: nil, StackAfter: []string{"int_or_bool"}},
+	{Code: 'J', Name: "BININT", Arg: "int4", Proto: 1, StackBefore: nil, StackAfter: []string{"int"}},
+	{Code: 'K', Name: "BININT1", Arg: "uint1", Proto: 1, StackBefore: nil, StackAfter: []string{"int"}},
+	{Code: 'M', Name: "BININT2", Arg: "uint2", Proto: 1, StackBefore: nil, StackAfter: []string{"int"}},
+	{Code: 'L', Name: "LONG", Arg: "decimalnl_long", Proto: 0, StackBefore: nil, StackAfter: []string{"int"}},
+	{Code: 0x8a, Name: "LONG1", Arg: "long1", Proto: 2, StackBefore: nil, StackAfter: []string{"int"}},
+	{Code: 0x8b, Name: "LONG4", Arg: "long4", Proto: 2, StackBefore: nil, StackAfter: []string{"int"}},
+
+	// Strings, made of bytes by protocol 2 and below, and bytes.
+	{Code: 'S', Name: "STRING", Arg: "stringnl", Proto: 0, StackBefore: nil, StackAfter: []string{"bytes_or_str"}},
+	{Code: 'T', Name: "BINSTRING", Arg: "string4", Proto: 1, StackBefore: nil, StackAfter: []string{"bytes_or_str"}},
+	{Code: 'U', Name: "SHORT_BINSTRING", Arg: "string1", Proto: 1, StackBefore: nil, StackAfter: []string{"bytes_or_str"}},
+	{Code: 'B', Name: "BINBYTES", Arg: "bytes4", Proto: 3, StackBefore: nil, StackAfter: []string{"bytes"}},
+	{Code: 'C', Name: "SHORT_BINBYTES", Arg: "bytes1", Proto: 3, StackBefore: nil, StackAfter: []string{"bytes"}},
+	{Code: 0x8e, Name: "BINBYTES8", Arg: "bytes8", Proto: 4, StackBefore: nil, StackAfter: []string{"bytes"}},
+
+	// Byte arrays and out-of-band buffers.
+	{Code: 0x96, Name: "BYTEARRAY8", Arg: "bytearray8", Proto: 5, StackBefore: nil, StackAfter: []string{"bytearray"}},
+	{Code: 0x97, Name: "NEXT_BUFFER", Arg: "", Proto: 5, StackBefore: nil, StackAfter: []string{"buffer"}},
+	{Code: 0x98, Name: "READONLY_BUFFER", Arg: "", Proto: 5, StackBefore: []string{"buffer"}, StackAfter: []string{"buffer"}},
+
+	// None and booleans.
+	{Code: 'N', Name: "NONE", Arg: "", Proto: 0, StackBefore: nil, StackAfter: []string{"None"}},
+	{Code: 0x88, Name: "NEWTRUE", Arg: "", Proto: 2, StackBefore: nil, StackAfter: []string{"bool"}},
+	{Code: 0x89, Name: "NEWFALSE", Arg: "", Proto: 2, StackBefore: nil, StackAfter: []string{"bool"}},
+
+	// Unicode strings.
+	{Code: 'V', Name: "UNICODE", Arg: "unicodestringnl", Proto: 0, StackBefore: nil, StackAfter: []string{"str"}},
+	{Code: 0x8c, Name: "SHORT_BINUNICODE", Arg: "unicodestring1", Proto: 4, StackBefore: nil, StackAfter: []string{"str"}},
+	{Code: 'X', Name: "BINUNICODE", Arg: "unicodestring4", Proto: 1, StackBefore: nil, StackAfter: []string{"str"}},
+	{Code: 0x8d, Name: "BINUNICODE8", Arg: "unicodestring8", Proto: 4, StackBefore: nil, StackAfter: []string{"str"}},
+
+	// Floats.
+	{Code: 'F', Name: "FLOAT", Arg: "floatnl", Proto: 0, StackBefore: nil, StackAfter: []string{"float"}},
+	{Code: 'G', Name: "BINFLOAT", Arg: "float8", Proto: 1, StackBefore: nil, StackAfter: []string{"float"}},
+
+	// Lists.
+	{Code: ']', Name: "EMPTY_LIST", Arg: "", Proto: 1, StackBefore: nil, StackAfter: []string{"list"}},
+	{Code: 'a', Name: "APPEND", Arg: "", Proto: 0, StackBefore: []string{"list", "any"}, StackAfter: []string{"list"}},
+	{Code: 'e', Name: "APPENDS", Arg: "", Proto: 1, StackBefore: []string{"list", "mark", "stackslice"}, StackAfter: []string{"list"}},
+	{Code: 'l', Name: "LIST", Arg: "", Proto: 0, StackBefore: []string{"mark", "stackslice"}, StackAfter: []string{"list"}},
+
+	// Tuples.
+	{Code: ')', Name: "EMPTY_TUPLE", Arg: "", Proto: 1, StackBefore: nil, StackAfter: []string{"tuple"}},
+	{Code: 't', Name: "TUPLE", Arg: "", Proto: 0, StackBefore: []string{"mark", "stackslice"}, StackAfter: []string{"tuple"}},
+	{Code: 0x85, Name: "TUPLE1", Arg: "", Proto: 2, StackBefore: []string{"any"}, StackAfter: []string{"tuple"}},
+	{Code: 0x86, Name: "TUPLE2", Arg: "", Proto: 2, StackBefore: []string{"any", "any"}, StackAfter: []string{"tuple"}},
+	{Code: 0x87, Name: "TUPLE3", Arg: "", Proto: 2, StackBefore: []string{"any", "any", "any"}, StackAfter: []string{"tuple"}},
+
+	// Dicts.
+	{Code: '}', Name: "EMPTY_DICT", Arg: "", Proto: 1, StackBefore: nil, StackAfter: []string{"dict"}},
+	{Code: 'd', Name: "DICT", Arg: "", Proto: 0, StackBefore: []string{"mark", "stackslice"}, StackAfter: []string{"dict"}},
+	{Code: 's', Name: "SETITEM", Arg: "", Proto: 0, StackBefore: []string{"dict", "any", "any"}, StackAfter: []string{"dict"}},
+	{Code: 'u', Name: "SETITEMS", Arg: "", Proto: 1, StackBefore: []string{"dict", "mark", "stackslice"}, StackAfter: []string{"dict"}},
+
+	// Sets.
+	{Code: 0x8f, Name: "EMPTY_SET", Arg: "", Proto: 4, StackBefore: nil, StackAfter: []string{"set"}},
+	{Code: 0x90, Name: "ADDITEMS", Arg: "", Proto: 4, StackBefore: []string{"set", "mark", "stackslice"}, StackAfter: []string{"set"}},
+	{Code: 0x91, Name: "FROZENSET", Arg: "", Proto: 4, StackBefore: []string{"mark", "stackslice"}, StackAfter: []string{"frozenset"}},
+
+	// Stack manipulation.
+	{Code: '0', Name: "POP", Arg: "", Proto: 0, StackBefore: []string{"any"}, StackAfter: nil},
+	{Code: '2', Name: "DUP", Arg: "", Proto: 0, StackBefore: []string{"any"}, StackAfter: []string{"any", "any"}},
+	{Code: '(', Name: "MARK", Arg: "", Proto: 0, StackBefore: nil, StackAfter: []string{"mark"}},
+	{Code: '1', Name: "POP_MARK", Arg: "", Proto: 1, StackBefore: []string{"mark", "stackslice"}, StackAfter: nil},
+
+	// Memo manipulation.
+	{Code: 'g', Name: "GET", Arg: "decimalnl_short", Proto: 0, StackBefore: nil, StackAfter: []string{"any"}},
+	{Code: 'h', Name: "BINGET", Arg: "uint1", Proto: 1, StackBefore: nil, StackAfter: []string{"any"}},
+	{Code: 'j', Name: "LONG_BINGET", Arg: "uint4", Proto: 1, StackBefore: nil, StackAfter: []string{"any"}},
+	{Code: 'p', Name: "PUT", Arg: "decimalnl_short", Proto: 0, StackBefore: nil, StackAfter: nil},
+	{Code: 'q', Name: "BINPUT", Arg: "uint1", Proto: 1, StackBefore: nil, StackAfter: nil},
+	{Code: 'r', Name: "LONG_BINPUT", Arg: "uint4", Proto: 1, StackBefore: nil, StackAfter: nil},
+	{Code: 0x94, Name: "MEMOIZE", Arg: "", Proto: 4, StackBefore: []string{"any"}, StackAfter: []string{"any"}},
+
+	// Extension registry.
+	{Code: 0x82, Name: "EXT1", Arg: "uint1", Proto: 2, StackBefore: nil, StackAfter: []string{"any"}},
+	{Code: 0x83, Name: "EXT2", Arg: "uint2", Proto: 2, StackBefore: nil, StackAfter: []string{"any"}},
+	{Code: 0x84, Name: "EXT4", Arg: "int4", Proto: 2, StackBefore: nil, StackAfter: []string{"any"}},
+
+	// Classes and objects.
+	{Code: 'c', Name: "GLOBAL", Arg: "stringnl_noescape_pair", Proto: 0, StackBefore: nil, StackAfter: []string{"any"}},
+	{Code: 0x93, Name: "STACK_GLOBAL", Arg: "", Proto: 4, StackBefore: []string{"str", "str"}, StackAfter: []string{"any"}},
+	{Code: 'R', Name: "REDUCE", Arg: "", Proto: 0, StackBefore: []string{"any", "any"}, StackAfter: []string{"any"}},
+	{Code: 'b', Name: "BUILD", Arg: "", Proto: 0, StackBefore: []string{"any", "any"}, StackAfter: []string{"any"}},
+	{Code: 'i', Name: "INST", Arg: "stringnl_noescape_pair", Proto: 0, StackBefore: []string{"mark", "stackslice"}, StackAfter: []string{"any"}},
+	{Code: 'o', Name: "OBJ", Arg: "", Proto: 1, StackBefore: []string{"mark", "any", "stackslice"}, StackAfter: []string{"any"}},
+	{Code: 0x81, Name: "NEWOBJ", Arg: "", Proto: 2, StackBefore: []string{"any", "any"}, StackAfter: []string{"any"}},
+	{Code: 0x92, Name: "NEWOBJ_EX", Arg: "", Proto: 4, StackBefore: []string{"any", "any", "any"}, StackAfter: []string{"any"}},
+
+	// Machine control.
+	{Code: 0x80, Name: "PROTO", Arg: "uint1", Proto: 2, StackBefore: nil, StackAfter: nil},
+	{Code: '.', Name: "STOP", Arg: "", Proto: 0, StackBefore: []string{"any"}, StackAfter: nil},
+	{Code: 0x95, Name: "FRAME", Arg: "uint8", Proto: 4, StackBefore: nil, StackAfter: nil},
+
+	// Persistent IDs.
+	{Code: 'P', Name: "PERSID", Arg: "stringnl_noescape", Proto: 0, StackBefore: nil, StackAfter: []string{"any"}},
+	{Code: 'Q', Name: "BINPERSID", Arg: "", Proto: 1, StackBefore: []string{"any"}, StackAfter: []string{"any"}},
+}
+
+var opcodesByCode = makeOpcodesByCode()
+
+func makeOpcodesByCode() map[byte]*Opcode {
+	m := make(map[byte]*Opcode, len(Opcodes))
+	for _, op := range Opcodes {
+		m[op.Code] = op
+	}
+	return m
+}
+
+// Op is an opcode read from a pickle.
+type Op struct {
+	Opcode *Opcode
+	// Arg is the decoded argument of the opcode, or nil if it has none.
+	// The integers are int values, or *big.Int values if they are too
+	// large; the strings are Go strings, and the bytes are types.Bytes
+	// values, or *types.ByteArray for BYTEARRAY8. As in Python, the INT
+	// opcode has a bool argument for the spellings of True and False, and
+	// the argument of GLOBAL and INST is the module and the name of the
+	// class, separated by a space.
+	Arg interface{}
+	// Pos is the position of the opcode in the pickle, counting from the
+	// start of the reader.
+	Pos int64
+}
+
+// Genops reads the opcodes of a pickle from r, up to the first STOP opcode
+// included, which is the last byte read, so that a following pickle can
+// be read next. In case of error, it returns the opcodes read so far.
+func Genops(r io.Reader) ([]Op, error) {
+	var ops []Op
+	err := genops(newReader(r), func(op Op) error {
+		ops = append(ops, op)
+		return nil
+	})
+	return ops, err
+}
+
+// genops reads the opcodes of a pickle, calling f for each of them, as
+// soon as it is read.
+func genops(r *reader, f func(Op) error) error {
+	for {
+		pos := r.pos
+		code, err := r.ReadByte()
+		if err == io.EOF {
+			return fmt.Errorf("pickle exhausted before seeing STOP")
+		}
+		if err != nil {
+			return err
+		}
+		opcode, ok := opcodesByCode[code]
+		if !ok {
+			return fmt.Errorf("at position %d, opcode %s unknown", pos, reprBytes([]byte{code}))
+		}
+		var arg interface{}
+		if opcode.Arg != "" {
+			if arg, err = argReaders[opcode.Arg](r); err != nil {
+				return err
+			}
+		}
+		if err := f(Op{Opcode: opcode, Arg: arg, Pos: pos}); err != nil {
+			return err
+		}
+		if opcode.Name == "STOP" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pickletools
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestGenops(t *testing.T) {
+	// not a valid pickle, but a list of opcodes with arguments of many
+	// formats, followed by a second pickle
+	data := "S'it\\'s'\nJ\xff\xff\xff\xff\x8a\x09\x00\x00\x00\x00\x00\x00\x00\x00@B\x02\x00\x00\x00\x00\xff" +
+		"\x96\x01\x00\x00\x00\x00\x00\x00\x00xG?\xf8\x00\x00\x00\x00\x00\x00ccollections\nOrderedDict\n" +
+		"I00\n\x87\x87.N."
+	bigInt, _ := new(big.Int).SetString("1180591620717411303424", 10)
+	expected := []struct {
+		pos  int64
+		name string
+		arg  interface{}
+	}{
+		{0, "STRING", "it's"},
+		{9, "BININT", -1},
+		{14, "LONG1", bigInt},
+		{25, "BINBYTES", types.Bytes("\x00\xff")},
+		{32, "BYTEARRAY8", types.NewByteArrayFromSlice([]byte("x"))},
+		{42, "BINFLOAT", 1.5},
+		{51, "GLOBAL", "collections OrderedDict"},
+		{76, "INT", false},
+		{80, "TUPLE3", nil},
+		{81, "TUPLE3", nil},
+		{82, "STOP", nil},
+	}
+
+	r := strings.NewReader(data)
+	ops, err := Genops(iotest.OneByteReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("expected %d opcodes, actual %d", len(expected), len(ops))
+	}
+	for i, op := range ops {
+		e := expected[i]
+		if op.Pos != e.pos || op.Opcode.Name != e.name || !reflect.DeepEqual(op.Arg, e.arg) {
+			t.Errorf("expected %d %s %#v, actual %d %s %#v", e.pos, e.name, e.arg, op.Pos, op.Opcode.Name, op.Arg)
+		}
+	}
+	if r.Len() != 2 {
+		t.Errorf("expected the second pickle to be left unread, actual %d bytes left", r.Len())
+	}
+}
+
+func TestGenopsErrors(t *testing.T) {
+	ops, err := Genops(strings.NewReader("\x80\x02X\x05\x00\x00\x00abc"))
+	expected := "expected 5 bytes in a unicodestring4, but only 3 remain"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, actual %v", expected, err)
+	}
+	if len(ops) != 1 || ops[0].Opcode.Name != "PROTO" || ops[0].Arg != 2 {
+		t.Errorf("expected the PROTO opcode, actual %#v", ops)
+	}
+}
+
+func TestOpcodes(t *testing.T) {
+	codes := make(map[byte]bool)
+	names := make(map[string]bool)
+	for _, op := range Opcodes {
+		if codes[op.Code] || names[op.Name] {
+			t.Errorf("duplicate opcode %q %s", op.Code, op.Name)
+		}
+		codes[op.Code], names[op.Name] = true, true
+		if _, ok := argReaders[op.Arg]; op.Arg != "" && !ok {
+			t.Errorf("opcode %s: unknown argument format %q", op.Name, op.Arg)
+		}
+	}
+	if len(Opcodes) != 68 {
+		t.Errorf("expected 68 opcodes, actual %d", len(Opcodes))
+	}
+}
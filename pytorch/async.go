@@ -0,0 +1,296 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+)
+
+// LoadAsync is like Load, but it returns as soon as the structure of the
+// file has been unpickled, while the data of the storages is read in
+// background. The returned channel yields the first error occurred, if
+// any, and is closed when all the data has been read, or when loading
+// has failed.
+//
+// The tensors are returned immediately, but their data becomes available
+// only later: GetData and the other methods accessing the data of a
+// storage block until it is ready. Before accessing the Data field of a
+// storage directly, call its Wait method.
+//
+// Only zip-based files are read in background; legacy files are loaded
+// completely before returning, and the channel is closed right away.
+func LoadAsync(filename string) (interface{}, <-chan error) {
+	return LoadAsyncWithOptions(filename, LoadOptions{})
+}
+
+// LoadAsyncWithOptions is like LoadAsync, but it accepts LoadOptions. With
+// UseMmap, the storages are read in background from the memory mapping
+// of the file, which is released once they are all complete. Lazy,
+// Concurrency, TensorFilter and Progress are not supported: setting any
+// of them makes loading fail.
+func LoadAsyncWithOptions(filename string, opts LoadOptions) (interface{}, <-chan error) {
+	done := make(chan error, 1)
+	fail := func(err error) (interface{}, <-chan error) {
+		done <- err
+		close(done)
+		return nil, done
+	}
+	if opts.Lazy || opts.Concurrency > 1 || opts.TensorFilter != nil || opts.Progress != nil {
+		return fail(fmt.Errorf(
+			"LoadAsyncWithOptions: Lazy, Concurrency, TensorFilter and Progress are not supported"))
+	}
+	opts = opts.withDefaults()
+
+	if !isZipFile(filename) {
+		result, err := loadLegacyFile(filename, opts)
+		if err != nil {
+			return fail(err)
+		}
+		close(done)
+		return result, done
+	}
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return fail(err)
+	}
+	var m *fileMapping
+	if opts.UseMmap {
+		if m, err = openFileMapping(filename); err != nil {
+			r.Close()
+			return fail(err)
+		}
+	}
+	release := func() error {
+		err := r.Close()
+		if m != nil {
+			if mErr := m.Close(); mErr != nil && err == nil {
+				err = mErr
+			}
+		}
+		return err
+	}
+	var mapping []byte
+	if m != nil {
+		mapping = m.data
+	}
+	result, deferred, err := unpickleZipFile(&r.Reader, mapping, opts, true)
+	if errors.Is(err, ErrNotTorchArchive) {
+		release()
+		result, err = loadLegacyFallback(filename, opts, err)
+		if err != nil {
+			return fail(err)
+		}
+		close(done)
+		return result, done
+	}
+	if err != nil {
+		// Nothing will be read: release whoever is waiting for the data.
+		for _, d := range deferred {
+			d.pending.finish(err)
+		}
+		release()
+		return fail(err)
+	}
+	go loadDeferredStorages(&r.Reader, deferred, mapping, opts.StorageReadBufferSize, release, done)
+	return result, done
+}
+
+// pendingData tracks the data of a storage which is being read in
+// background, or which is read on first access when loaded lazily. It is
+// created in an incomplete state, and completed, only once, by finish.
+type pendingData struct {
+	done chan struct{}
+	err  error
+	// load, if not nil, reads the data on the first call to wait, and its
+	// result completes the pendingData (see newLazyData).
+	load func() error
+	once sync.Once
+	// derived are the storages whose data is derived by then, when p is
+	// not lazy, so that complete can wait for them too.
+	derived []*BaseStorage
+}
+
+func newPendingData() *pendingData {
+	return &pendingData{done: make(chan struct{})}
+}
+
+// newLazyData returns a pendingData completed by calling load, as soon as
+// the data is waited for.
+func newLazyData(load func() error) *pendingData {
+	return &pendingData{done: make(chan struct{}), load: load}
+}
+
+func (p *pendingData) finish(err error) {
+	p.err = err
+	close(p.done)
+}
+
+func (p *pendingData) wait() error {
+	if p.load != nil {
+		p.once.Do(func() {
+			p.finish(p.load())
+		})
+	}
+	<-p.done
+	return p.err
+}
+
+// then makes the data of the storage b pending, until it is derived by fn
+// from the data tracked by p, once it is available. fn is called in
+// background as soon as p is completed, or, if p is lazy, when the derived
+// data is waited for, so that it is not read before it is needed.
+func (p *pendingData) then(b *BaseStorage, fn func() error) {
+	derive := func() error {
+		if err := p.wait(); err != nil {
+			return err
+		}
+		return fn()
+	}
+	if p.load != nil {
+		b.pending = newLazyData(derive)
+		return
+	}
+	next := newPendingData()
+	b.pending = next
+	p.derived = append(p.derived, b)
+	go func() {
+		next.finish(derive())
+	}()
+}
+
+// complete waits for the data tracked by p, and for that of the storages
+// derived from it, which are then no longer pending, as if their data had
+// been set right away. It returns the first error.
+func (p *pendingData) complete() error {
+	err := p.wait()
+	for _, b := range p.derived {
+		if derivedErr := b.pending.complete(); err == nil {
+			err = derivedErr
+		}
+		b.pending = nil
+	}
+	return err
+}
+
+// deferredStorage is a storage whose data is still to be read from the
+// zip record with the given key, in the given byte order.
+type deferredStorage struct {
+	storage   StorageInterface
+	dataType  StorageClassInterface
+	size      int
+	key       string
+	byteOrder binary.ByteOrder
+	pending   *pendingData
+}
+
+func newDeferredStorage(
+	storage StorageInterface,
+	dataType StorageClassInterface,
+	size int,
+	key string,
+	byteOrder binary.ByteOrder,
+) (deferredStorage, error) {
+	bs, ok := storage.(baseStorager)
+	if !ok {
+		return deferredStorage{}, fmt.Errorf(
+			"storage %T cannot be loaded in background", storage)
+	}
+	pending := newPendingData()
+	bs.baseStorage().pending = pending
+	return deferredStorage{
+		storage:   storage,
+		dataType:  dataType,
+		size:      size,
+		key:       key,
+		byteOrder: byteOrder,
+		pending:   pending,
+	}, nil
+}
+
+// loadDeferredStorages reads the data of all the deferred storages, in
+// order, from the records of r, or from mapping, if not nil, as
+// readStorageRecord, then calls release, to close the zip archive. Each
+// storage is completed with its own error, if any; the first error is
+// sent to done, which is finally closed.
+func loadDeferredStorages(
+	r *zip.Reader,
+	deferred []deferredStorage,
+	mapping []byte,
+	bufferSize int,
+	release func() error,
+	done chan<- error,
+) {
+	fileRecords := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		_, recordName := path.Split(f.Name)
+		fileRecords[recordName] = f
+	}
+
+	var firstErr error
+	for _, d := range deferred {
+		err := readStorageRecord(d.storage, d.dataType, d.size, d.key,
+			d.byteOrder, fileRecords, mapping, bufferSize)
+		d.pending.finish(err)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := release(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if firstErr != nil {
+		done <- firstErr
+	}
+	close(done)
+}
+
+// loadStoragesConcurrently reads the data of the deferred storages of a
+// zip archive with the given number of goroutines, each opening the
+// records on its own, and waits for all of them, including the storages
+// derived from them, such as the typed views of an untyped storage. It
+// returns the first error, in the order of the storages.
+func loadStoragesConcurrently(
+	fileRecords map[string]*zip.File,
+	deferred []deferredStorage,
+	mapping []byte,
+	bufferSize int,
+	concurrency int,
+) error {
+	if concurrency > len(deferred) {
+		concurrency = len(deferred)
+	}
+	jobs := make(chan deferredStorage)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				d.pending.finish(readStorageRecord(d.storage, d.dataType, d.size,
+					d.key, d.byteOrder, fileRecords, mapping, bufferSize))
+			}
+		}()
+	}
+	for _, d := range deferred {
+		jobs <- d
+	}
+	close(jobs)
+	wg.Wait()
+
+	var firstErr error
+	for _, d := range deferred {
+		if err := d.pending.complete(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		d.storage.(baseStorager).baseStorage().pending = nil
+	}
+	return firstErr
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLoadAsync(t *testing.T) {
+	result, done := LoadAsync(path.Join("testdata", "synthetic_training_checkpoint.pt"))
+	model := result.(*types.Dict).MustGet("model").(*types.OrderedDict)
+
+	// blocks until the storage is loaded
+	embed := model.MustGet("embed.weight").(*Tensor)
+	assertTensorFloat32Data(t, embed, []float32{1, 2, 3, 4, 5, 6})
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	proj := model.MustGet("proj.weight").(*Tensor)
+	assertFloat64SliceEqual(t, proj.Source.(*DoubleStorage).Data,
+		[]float64{1, 2, 3, 4, 5, 6}, 0)
+}
+
+func TestLoadAsyncWithOptions(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+	result, done := LoadAsyncWithOptions(filename, LoadOptions{UseMmap: true})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	actual := tensorsOf(t, result)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d tensors, actual %d", len(expected), len(actual))
+	}
+	for name, tensor := range expected {
+		expectedData, err := tensor.GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actualData, err := actual[name].GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actualData, expectedData) {
+			t.Errorf("%s: expected %v, actual %v", name, expectedData, actualData)
+		}
+	}
+
+	result, done = LoadAsyncWithOptions(filename, LoadOptions{Lazy: true})
+	assertErrorContains(t, <-done, "not supported")
+	if result != nil {
+		t.Errorf("expected nil result, actual %#v", result)
+	}
+}
+
+func TestLoadAsyncUntypedStorage(t *testing.T) {
+	result, done := LoadAsync(path.Join("testdata", "synthetic_untyped_storage_v3.pt"))
+	tensor := result.(*Tensor)
+	assertTensorFloat32Data(t, tensor, []float32{1.5, -2.5, 3.5, -4.5})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAsyncStorageError(t *testing.T) {
+	result, done := LoadAsync(path.Join("testdata", "synthetic_truncated_storage.pt"))
+	tensor := result.(*Tensor)
+	_, err := tensor.GetData()
+	assertErrorContains(t, err, "requires 16 bytes")
+
+	err = <-done
+	assertErrorContains(t, err, "requires 16 bytes")
+	if _, open := <-done; open {
+		t.Error("expected done to be closed")
+	}
+}
+
+func TestLoadAsyncLegacyFile(t *testing.T) {
+	result, done := LoadAsync(path.Join("testdata", "tensor_float32_proto2.pt"))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	assertCommonTensorFields(t, result.(*Tensor))
+}
+
+func TestLoadAsyncMissingFile(t *testing.T) {
+	result, done := LoadAsync(path.Join("testdata", "missing.pt"))
+	if err := <-done; err == nil {
+		t.Error("expected error, actual nil")
+	}
+	if result != nil {
+		t.Errorf("expected nil result, actual %#v", result)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	for _, filename := range []string{
+		"synthetic_training_checkpoint.pt",
+		"synthetic_untyped_storage_v3.pt",
+		"synthetic_type_punned_views.pt",
+		"synthetic_big_endian.pt",
+		"tensor_float32_proto2_zip.pt",
+		"tensor_float32_proto2.pt", // legacy
+	} {
+		t.Run(filename, func(t *testing.T) {
+			filename := path.Join("testdata", filename)
+			expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+			actual := loadTensorsWithOptions(t, filename, LoadOptions{Concurrency: 4})
+			if len(actual) != len(expected) {
+				t.Fatalf("expected %d tensors, actual %d", len(expected), len(actual))
+			}
+			// the storages are complete, even the derived ones, and no
+			// longer pending
+			for name, tensor := range expected {
+				assertTensorsEqual(t, actual[name], tensor)
+			}
+		})
+	}
+
+	_, err := LoadWithOptions(path.Join("testdata", "synthetic_truncated_storage.pt"),
+		LoadOptions{Concurrency: 4})
+	assertErrorContains(t, err, "requires 16 bytes, but its zip record has only 12 bytes")
+}
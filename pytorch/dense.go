@@ -0,0 +1,191 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// DenseArray is the interface of the dense arrays which tensors are
+// converted to, such as DenseFloat32, for the code handling them
+// regardless of the type of their elements: most Go numerical libraries
+// make their own arrays from a backing slice and a shape.
+type DenseArray interface {
+	// Dims returns the size of each dimension, empty for a scalar.
+	Dims() []int
+	// Backing returns the slice of the elements, in contiguous row-major
+	// order, such as []float32.
+	Backing() interface{}
+}
+
+// DenseFloat32 holds the elements of a tensor as float32 values, in
+// contiguous row-major order, along with its shape.
+type DenseFloat32 struct {
+	// Data are the elements, which may share the memory of the storage of
+	// the tensor (see Tensor.ToDenseFloat32).
+	Data []float32
+	// Shape is the size of each dimension, empty for a scalar.
+	Shape []int
+}
+
+var _ DenseArray = &DenseFloat32{}
+
+// Dims returns the Shape.
+func (d *DenseFloat32) Dims() []int { return d.Shape }
+
+// Backing returns the Data.
+func (d *DenseFloat32) Backing() interface{} { return d.Data }
+
+// Strides returns the number of elements between two consecutive indices
+// of each dimension, in the row-major layout of the Data.
+func (d *DenseFloat32) Strides() []int { return contiguousStride(d.Shape) }
+
+// At returns the element at the given indices, one for each dimension. A
+// negative index counts from the end of its dimension, as for Tensor.At.
+// Unlike Tensor.At, it panics, as the At methods of Gonum matrices do, if
+// the number of indices is not the number of dimensions, or if any index
+// is out of range.
+func (d *DenseFloat32) At(indices ...int) float32 {
+	return d.Data[denseIndex(d.Shape, indices)]
+}
+
+// DenseFloat64 holds the elements of a tensor as float64 values, in
+// contiguous row-major order, along with its shape.
+type DenseFloat64 struct {
+	// Data are the elements, which may share the memory of the storage of
+	// the tensor (see Tensor.ToDenseFloat64).
+	Data []float64
+	// Shape is the size of each dimension, empty for a scalar.
+	Shape []int
+}
+
+var _ DenseArray = &DenseFloat64{}
+
+// Dims returns the Shape.
+func (d *DenseFloat64) Dims() []int { return d.Shape }
+
+// Backing returns the Data.
+func (d *DenseFloat64) Backing() interface{} { return d.Data }
+
+// Strides is the same as DenseFloat32.Strides.
+func (d *DenseFloat64) Strides() []int { return contiguousStride(d.Shape) }
+
+// At is the same as DenseFloat32.At.
+func (d *DenseFloat64) At(indices ...int) float64 {
+	return d.Data[denseIndex(d.Shape, indices)]
+}
+
+// denseIndex returns the position of the element at the given indices,
+// which may be negative, in the row-major layout of an array of the given
+// shape. It panics if the indices are invalid.
+func denseIndex(shape, indices []int) int {
+	if len(indices) != len(shape) {
+		panic(fmt.Sprintf("%d indices for an array of %d dimensions", len(indices), len(shape)))
+	}
+	pos := 0
+	for d, index := range indices {
+		i := index
+		if i < 0 {
+			i += shape[d]
+		}
+		if i < 0 || i >= shape[d] {
+			panic(fmt.Sprintf("index %d out of range for dimension %d of size %d", index, d, shape[d]))
+		}
+		pos = pos*shape[d] + i
+	}
+	return pos
+}
+
+// ToDenseFloat32 returns the elements of a tensor of type torch.float16,
+// torch.bfloat16 or torch.float32, whose storages hold float32 values, and
+// its shape. The elements of a contiguous tensor are not copied: the Data
+// aliases its storage, so that changing either one changes both. The
+// elements of the other tensors are copied, as by GetDataAsFloat32.
+func (t *Tensor) ToDenseFloat32() (*DenseFloat32, error) {
+	switch t.Source.(type) {
+	case *FloatStorage, *HalfStorage, *BFloat16Storage:
+	default:
+		return nil, fmt.Errorf("ToDenseFloat32: unsupported tensor of type %v", t.Dtype())
+	}
+	data, err := t.aliasData()
+	if err != nil {
+		return nil, fmt.Errorf("ToDenseFloat32: %w", err)
+	}
+	return &DenseFloat32{Data: data.([]float32), Shape: append([]int{}, t.Size...)}, nil
+}
+
+// ToDenseFloat64 returns the elements of a tensor of any floating point
+// type as float64 values, and its shape. As for ToDenseFloat32, the Data
+// of a contiguous torch.float64 tensor aliases its storage, while the
+// elements of the other tensors are copied, widened to float64 if needed.
+func (t *Tensor) ToDenseFloat64() (*DenseFloat64, error) {
+	switch t.Source.(type) {
+	case *DoubleStorage:
+		data, err := t.aliasData()
+		if err != nil {
+			return nil, fmt.Errorf("ToDenseFloat64: %w", err)
+		}
+		return &DenseFloat64{Data: data.([]float64), Shape: append([]int{}, t.Size...)}, nil
+	case *FloatStorage, *HalfStorage, *BFloat16Storage:
+		data, err := t.GetDataAsFloat64()
+		if err != nil {
+			return nil, fmt.Errorf("ToDenseFloat64: %w", err)
+		}
+		return &DenseFloat64{Data: data, Shape: append([]int{}, t.Size...)}, nil
+	default:
+		return nil, fmt.Errorf("ToDenseFloat64: unsupported tensor of type %v", t.Dtype())
+	}
+}
+
+// ToDense returns the elements of a floating point tensor as a dense
+// array of the same precision: a *DenseFloat64 for a torch.float64
+// tensor, a *DenseFloat32 for the others.
+func (t *Tensor) ToDense() (DenseArray, error) {
+	if _, ok := t.Source.(*DoubleStorage); ok {
+		return t.ToDenseFloat64()
+	}
+	return t.ToDenseFloat32()
+}
+
+// aliasData returns the elements of the tensor in row-major order: the
+// section of the data of its storage holding them, for a contiguous
+// tensor, or a copy, as GetData, for the others.
+func (t *Tensor) aliasData() (interface{}, error) {
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	if !t.IsContiguous() {
+		return t.GetData()
+	}
+	data, err := storageData(t.Source)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkBounds(data.Len()); err != nil {
+		return nil, err
+	}
+	end := t.StorageOffset + t.Numel()
+	return data.Slice3(t.StorageOffset, end, end).Interface(), nil
+}
+
+// storageFloat64s returns the data of a torch.float64 tensor, checking
+// that the tensor is within its bounds.
+func (t *Tensor) storageFloat64s() ([]float64, error) {
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	data, err := storageData(t.Source)
+	if err != nil {
+		return nil, err
+	}
+	if data.Type() != reflect.TypeOf([]float64(nil)) {
+		return nil, fmt.Errorf("unsupported tensor of type %v", t.Dtype())
+	}
+	if err := t.checkBounds(data.Len()); err != nil {
+		return nil, err
+	}
+	return data.Interface().([]float64), nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToDense(t *testing.T) {
+	data := []float32{1, 2, 3, 4, 5, 6}
+	weight := newFloatTensor(data, 2, 3)
+
+	d, err := weight.ToDenseFloat32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d.Data, data) || &d.Data[0] != &data[0] {
+		t.Errorf("expected the data to alias the storage, actual %v", d.Data)
+	}
+	assertIntSliceEqual(t, d.Shape, []int{2, 3})
+	assertIntSliceEqual(t, d.Strides(), []int{3, 1})
+	if v := d.At(1, 2); v != 6 {
+		t.Errorf("expected 6 at (1, 2), actual %v", v)
+	}
+	if v := d.At(-1, -3); v != 4 {
+		t.Errorf("expected 4 at (-1, -3), actual %v", v)
+	}
+	assertPanics(t, func() { d.At(2, 0) })
+	assertPanics(t, func() { d.At(0, -4) })
+	assertPanics(t, func() { d.At(0) })
+	// appending must not overwrite the rest of the storage
+	if cap(d.Data) != len(d.Data) {
+		t.Errorf("expected capacity %d, actual %d", len(d.Data), cap(d.Data))
+	}
+
+	transposed := &Tensor{Source: weight.Source, Size: []int{3, 2}, Stride: []int{1, 3}}
+	d, err = transposed.ToDenseFloat32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []float32{1, 4, 2, 5, 3, 6}; !reflect.DeepEqual(d.Data, expected) {
+		t.Errorf("expected %v, actual %v", expected, d.Data)
+	}
+
+	d64, err := weight.ToDenseFloat64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []float64{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(d64.Data, expected) {
+		t.Errorf("expected %v, actual %v", expected, d64.Data)
+	}
+
+	double := newDoubleTensor([]float64{0.5}, 1, 1)
+	dense, err := double.ToDense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dense.(*DenseFloat64); !ok {
+		t.Fatalf("expected *DenseFloat64, actual %T", dense)
+	}
+	if !reflect.DeepEqual(dense.Backing(), []float64{0.5}) {
+		t.Errorf("unexpected backing %v", dense.Backing())
+	}
+	assertIntSliceEqual(t, dense.Dims(), []int{1, 1})
+
+	ints := &Tensor{
+		Source: &LongStorage{BaseStorage: BaseStorage{Size: 1}, Data: []int64{1}},
+		Size:   []int{1},
+		Stride: []int{1},
+	}
+	_, err = ints.ToDense()
+	assertErrorContains(t, err, "ToDenseFloat32: unsupported tensor of type")
+	_, err = double.ToDenseFloat32()
+	assertErrorContains(t, err, "ToDenseFloat32: unsupported tensor of type")
+}
+
+func assertPanics(t *testing.T, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	f()
+}
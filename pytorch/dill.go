@@ -0,0 +1,113 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// dillModules are the names of the module providing the helper functions
+// of "dill", which can replace "pickle" as the pickle_module of torch.save.
+// The former was used by dill up to version 0.2.
+var dillModules = map[string]bool{"dill._dill": true, "dill.dill": true}
+
+// dillFindClass resolves the globals of dill. Only _load_type and
+// _create_namedtuple are actually implemented; the other most common
+// globals, which rebuild Python-specific constructs, are resolved as
+// UnknownClass placeholders:
+//
+//   - _create_function, _create_code, _create_cell, _create_type:
+//     functions (e.g. learning rate lambdas), their code and closures, and
+//     classes defined in __main__;
+//   - _import_module, _get_attr, _eval_repr: modules, module attributes
+//     and objects saved by their representation;
+//   - _create_array, _create_dtypemeta: NumPy arrays and data types.
+//
+// It reports false for any global not belonging to dill.
+func dillFindClass(module, name string) (interface{}, bool) {
+	if !dillModules[module] {
+		return nil, false
+	}
+	switch name {
+	case "_load_type":
+		return &dillLoadType{}, true
+	case "_create_namedtuple":
+		return &dillCreateNamedTuple{}, true
+	default:
+		return &UnknownClass{Module: module, Name: name}, true
+	}
+}
+
+// dillLoadType represents dill "_load_type", which returns a builtin type
+// by name, such as "dict" or "function". Types which are also supported by
+// the Unpickler are returned as such, while the others are UnknownClass
+// placeholders.
+type dillLoadType struct{}
+
+var _ types.Callable = &dillLoadType{}
+
+func (*dillLoadType) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("dill _load_type: invalid arguments: %#v", args)
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("dill _load_type: invalid arguments: %#v", args)
+	}
+	switch name {
+	case "bytes":
+		return &types.BytesClass{}, nil
+	case "set":
+		return &types.SetClass{}, nil
+	case "object":
+		return &types.ObjectClass{}, nil
+	default:
+		return &UnknownClass{Module: "builtins", Name: name}, nil
+	}
+}
+
+// dillCreateNamedTuple represents dill "_create_namedtuple", which
+// creates a "collections.namedtuple" class, whose instances are loaded as
+// plain tuples.
+type dillCreateNamedTuple struct{}
+
+var _ types.Callable = &dillCreateNamedTuple{}
+
+func (*dillCreateNamedTuple) Call(args ...interface{}) (interface{}, error) {
+	// args: name, fieldnames, modulename, and optional defaults
+	if len(args) < 2 {
+		return nil, fmt.Errorf("dill _create_namedtuple: invalid arguments: %#v", args)
+	}
+	name, nameOk := args[0].(string)
+	fields, fieldsOk := args[1].(*types.Tuple)
+	if !nameOk || !fieldsOk {
+		return nil, fmt.Errorf("dill _create_namedtuple: invalid arguments: %#v", args)
+	}
+	return &namedTupleClass{name: name, numFields: fields.Len()}, nil
+}
+
+// namedTupleClass is a "collections.namedtuple" class, created by dill.
+type namedTupleClass struct {
+	name      string
+	numFields int
+}
+
+var _ types.Callable = &namedTupleClass{}
+var _ types.PyNewable = &namedTupleClass{}
+
+// Call returns a new tuple with the given values.
+func (c *namedTupleClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != c.numFields {
+		return nil, fmt.Errorf("namedtuple %s: expected %d values, got %d",
+			c.name, c.numFields, len(args))
+	}
+	return types.NewTupleFromSlice(append([]interface{}(nil), args...)), nil
+}
+
+// PyNew is the same as Call.
+func (c *namedTupleClass) PyNew(args ...interface{}) (interface{}, error) {
+	return c.Call(args...)
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+// Dtype represents a PyTorch data type ("torch.dtype"), such as
+// "torch.float32".
+//
+// Dtype values are resolved from pickled globals like "torch.float32"; the
+// same few instances are always shared, so they can be compared by pointer.
+type Dtype struct {
+	// Name is the canonical PyTorch name of the data type, without the
+	// "torch." prefix (e.g. "float32").
+	Name string
+	// ElementSize is the size in bytes of a single element.
+	ElementSize int
+	// StorageClass is the storage class which holds elements of this type.
+	StorageClass StorageClassInterface
+}
+
+var (
+	Float16 = &Dtype{Name: "float16", ElementSize: 2, StorageClass: &HalfStorageClass{}}
+	// BFloat16 is the "brain floating point" type, with the same exponent
+	// range of float32 and fewer mantissa bits.
+	BFloat16 = &Dtype{Name: "bfloat16", ElementSize: 2, StorageClass: &BFloat16StorageClass{}}
+	Float32  = &Dtype{Name: "float32", ElementSize: 4, StorageClass: &FloatStorageClass{}}
+	Float64  = &Dtype{Name: "float64", ElementSize: 8, StorageClass: &DoubleStorageClass{}}
+	Int8     = &Dtype{Name: "int8", ElementSize: 1, StorageClass: &CharStorageClass{}}
+	Int16    = &Dtype{Name: "int16", ElementSize: 2, StorageClass: &ShortStorageClass{}}
+	Int32    = &Dtype{Name: "int32", ElementSize: 4, StorageClass: &IntStorageClass{}}
+	Int64    = &Dtype{Name: "int64", ElementSize: 8, StorageClass: &LongStorageClass{}}
+	Uint8    = &Dtype{Name: "uint8", ElementSize: 1, StorageClass: &ByteStorageClass{}}
+	Uint16   = &Dtype{Name: "uint16", ElementSize: 2, StorageClass: &Uint16StorageClass{}}
+	Uint32   = &Dtype{Name: "uint32", ElementSize: 4, StorageClass: &Uint32StorageClass{}}
+	Uint64   = &Dtype{Name: "uint64", ElementSize: 8, StorageClass: &Uint64StorageClass{}}
+	Bool     = &Dtype{Name: "bool", ElementSize: 1, StorageClass: &BoolStorageClass{}}
+
+	// Complex data types, whose elements are made of the real part
+	// followed by the imaginary one.
+	Complex64  = &Dtype{Name: "complex64", ElementSize: 8, StorageClass: &ComplexFloatStorageClass{}}
+	Complex128 = &Dtype{Name: "complex128", ElementSize: 16, StorageClass: &ComplexDoubleStorageClass{}}
+
+	// Quantized data types, whose values are integers to be dequantized
+	// according to the quantizer of their tensor.
+	QInt8  = &Dtype{Name: "qint8", ElementSize: 1, StorageClass: &QInt8StorageClass{}}
+	QUInt8 = &Dtype{Name: "quint8", ElementSize: 1, StorageClass: &QUInt8StorageClass{}}
+	QInt32 = &Dtype{Name: "qint32", ElementSize: 4, StorageClass: &QInt32StorageClass{}}
+)
+
+// dtypes maps the names of the "torch" module attributes which refer to
+// a data type, including aliases (e.g. "torch.float" is "torch.float32").
+var dtypes = map[string]*Dtype{
+	"float16":  Float16,
+	"half":     Float16,
+	"bfloat16": BFloat16,
+	"float32":  Float32,
+	"float":    Float32,
+	"float64":  Float64,
+	"double":   Float64,
+	"int8":     Int8,
+	"int16":    Int16,
+	"short":    Int16,
+	"int32":    Int32,
+	"int":      Int32,
+	"int64":    Int64,
+	"long":     Int64,
+	"uint8":    Uint8,
+	"uint16":   Uint16,
+	"uint32":   Uint32,
+	"uint64":   Uint64,
+	"bool":     Bool,
+	"qint8":    QInt8,
+	"quint8":   QUInt8,
+	"qint32":   QInt32,
+
+	"complex64":  Complex64,
+	"cfloat":     Complex64,
+	"complex128": Complex128,
+	"cdouble":    Complex128,
+}
+
+// String returns the Python representation of the data type, such as
+// "torch.float32".
+func (d *Dtype) String() string {
+	return "torch." + d.Name
+}
+
+// storageDtype returns the data type of the elements held by one of the
+// built-in typed storages, or nil if it is not known.
+func storageDtype(s StorageInterface) *Dtype {
+	switch s.(type) {
+	case *HalfStorage:
+		return Float16
+	case *BFloat16Storage:
+		return BFloat16
+	case *FloatStorage:
+		return Float32
+	case *DoubleStorage:
+		return Float64
+	case *CharStorage:
+		return Int8
+	case *ShortStorage:
+		return Int16
+	case *IntStorage:
+		return Int32
+	case *LongStorage:
+		return Int64
+	case *ByteStorage:
+		return Uint8
+	case *Uint16Storage:
+		return Uint16
+	case *Uint32Storage:
+		return Uint32
+	case *Uint64Storage:
+		return Uint64
+	case *BoolStorage:
+		return Bool
+	case *ComplexFloatStorage:
+		return Complex64
+	case *ComplexDoubleStorage:
+		return Complex128
+	case *QInt8Storage:
+		return QInt8
+	case *QUInt8Storage:
+		return QUInt8
+	case *QInt32Storage:
+		return QInt32
+	default:
+		return nil
+	}
+}
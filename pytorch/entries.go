@@ -0,0 +1,55 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// LoadFromEntries loads a zip-based PyTorch file from its records, stored
+// anywhere, such as the objects of a remote store, without the zip
+// archive itself. dataPkl holds the "data.pkl" record, of dataPklSize
+// bytes. openStorage opens the record of the storage with the given key,
+// that is "data/<key>" in the archive, returning a reader of its content
+// and its size in bytes, or -1 if it is not known in advance.
+//
+// Each storage is opened only once, even when it is shared by more
+// tensors, and its reader is closed as soon as its data has been read.
+func LoadFromEntries(
+	dataPkl io.ReaderAt,
+	dataPklSize int64,
+	openStorage func(key string) (io.ReadCloser, int64, error),
+) (interface{}, error) {
+	opts := LoadOptions{}.withDefaults()
+	u := opts.NewUnpickler(io.NewSectionReader(dataPkl, 0, dataPklSize))
+	u.FindClass = makePickleFindClass(u.FindClass, opts)
+	u.PersistentLoad = zipPersistentLoad(opts, func(
+		dataType StorageClassInterface,
+		size int,
+		location, key string,
+	) (StorageInterface, error) {
+		rc, recordSize, err := openStorage(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open storage '%s': %w", key, err)
+		}
+		defer rc.Close()
+		if elementSize, ok := storageClassElementSize(dataType); ok && recordSize >= 0 {
+			if required := uint64(size) * uint64(elementSize); uint64(recordSize) < required {
+				return nil, fmt.Errorf(
+					"storage '%s' of %d elements requires %d bytes, but its "+
+						"record has only %d bytes", key, size, required, recordSize)
+			}
+		}
+		storage := dataType.New(size, location)
+		r := bufio.NewReaderSize(rc, opts.StorageReadBufferSize)
+		if err := storage.SetFromFileWithSize(r, size); err != nil {
+			return nil, fmt.Errorf("cannot read storage '%s': %w", key, err)
+		}
+		return storage, nil
+	})
+	return u.Load()
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLoadFromEntries(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+	stateDict := types.NewOrderedDict()
+	stateDict.Set("embed.weight", weight)
+	stateDict.Set("decoder.weight", &Tensor{Source: weight.Source, Size: []int{2, 3}, Stride: []int{3, 1}})
+	stateDict.Set("fc.bias", newFloatTensor([]float32{0.5}, 1))
+
+	// The records of a saved file, by name within the archive, as an
+	// object store might hold them.
+	var archive bytes.Buffer
+	if err := saveZip(&archive, stateDict); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects[nameInArchive(f.Name)], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opened := make(map[string]int)
+	openStorage := func(key string) (io.ReadCloser, int64, error) {
+		data, ok := objects["data/"+key]
+		if !ok {
+			return nil, 0, errors.New("no such object")
+		}
+		opened[key]++
+		return ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+	}
+	dataPkl := objects["data.pkl"]
+	result, err := LoadFromEntries(bytes.NewReader(dataPkl), int64(len(dataPkl)), openStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := result.(*types.OrderedDict)
+	embed := loaded.MustGet("embed.weight").(*Tensor)
+	decoder := loaded.MustGet("decoder.weight").(*Tensor)
+	assertTensorsEqual(t, embed, weight)
+	assertTensorFloat32Data(t, loaded.MustGet("fc.bias").(*Tensor), []float32{0.5})
+	if embed.Source != decoder.Source {
+		t.Error("expected the tied tensors to share their storage")
+	}
+	if len(opened) != 2 {
+		t.Errorf("expected 2 storages to be opened, actual %v", opened)
+	}
+	for key, n := range opened {
+		if n != 1 {
+			t.Errorf("storage %s: expected to be opened once, actual %d times", key, n)
+		}
+	}
+
+	delete(objects, "data/1")
+	_, err = LoadFromEntries(bytes.NewReader(dataPkl), int64(len(dataPkl)), openStorage)
+	assertErrorContains(t, err, "cannot open storage '1': no such object")
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTensorFiltered is returned when accessing the data of a storage which
+// has not been read, because none of its tensors was selected by
+// LoadOptions.TensorFilter.
+var ErrTensorFiltered = errors.New("storage data not read: tensor excluded by TensorFilter")
+
+// LoadTensors loads only the tensors of a state dict with the given names,
+// as returned by LoadStateDict, reading the data of their storages alone
+// from a zip-based file (see LoadOptions.TensorFilter). An error is
+// returned if any of the names is missing.
+func LoadTensors(filename string, names []string) (map[string]*Tensor, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	tensors, err := LoadStateDictWithOptions(filename, LoadOptions{
+		TensorFilter: func(name string) bool { return wanted[name] },
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if _, ok := tensors[name]; !ok {
+			return nil, fmt.Errorf("LoadTensors: %s: tensor %q not found", filename, name)
+		}
+	}
+	return tensors, nil
+}
+
+// filterDeferredStorages splits the deferred storages of the unpickled
+// obj into those holding the data of the tensors selected by
+// opts.TensorFilter, and the others, which are not read. A storage is
+// held by a tensor if it is its source, or if the source is derived from
+// it, as the typed views of an untyped storage.
+func filterDeferredStorages(obj interface{}, deferred []deferredStorage, opts LoadOptions) (selected, skipped []deferredStorage) {
+	roots := make(map[*BaseStorage]int, len(deferred))
+	for i, d := range deferred {
+		addDerivedRoots(roots, d.storage.(baseStorager).baseStorage(), i)
+	}
+	keep := make([]bool, len(deferred))
+	for _, entry := range namedTensors(obj, opts.NormalizeKeys) {
+		if !opts.TensorFilter(entry.Name) {
+			continue
+		}
+		if bs, ok := entry.Tensor.Source.(baseStorager); ok {
+			if i, ok := roots[bs.baseStorage()]; ok {
+				keep[i] = true
+			}
+		}
+	}
+	for i, d := range deferred {
+		if keep[i] {
+			selected = append(selected, d)
+		} else {
+			skipped = append(skipped, d)
+		}
+	}
+	return selected, skipped
+}
+
+// addDerivedRoots maps b, and the storages derived from it, recursively,
+// to the index of their deferred storage.
+func addDerivedRoots(roots map[*BaseStorage]int, b *BaseStorage, i int) {
+	roots[b] = i
+	if b.pending == nil {
+		return
+	}
+	for _, derived := range b.pending.derived {
+		addDerivedRoots(roots, derived, i)
+	}
+}
+
+// namedTensors returns the tensors of the state dict found in obj, by
+// name, or, if there is none, all the tensors of obj by path.
+func namedTensors(obj interface{}, normalizeKeys bool) []StateDictEntry {
+	tensors, _, err := stateDictTensors(obj, normalizeKeys)
+	if err != nil {
+		return FindTensors(obj)
+	}
+	entries := make([]StateDictEntry, 0, len(tensors))
+	for name, tensor := range tensors {
+		entries = append(entries, StateDictEntry{Name: name, Tensor: tensor})
+	}
+	return entries
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestLoadTensors(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	tensors, err := LoadTensors(filename, []string{"embed.weight"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensors) != 1 {
+		t.Fatalf("expected 1 tensor, actual %d", len(tensors))
+	}
+	assertTensorFloat32Data(t, tensors["embed.weight"], []float32{1, 2, 3, 4, 5, 6})
+
+	_, err = LoadTensors(filename, []string{"embed.weight", "missing"})
+	assertErrorContains(t, err, `tensor "missing" not found`)
+}
+
+func TestTensorFilter(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	for _, concurrency := range []int{0, 4} {
+		result, err := LoadWithOptions(filename, LoadOptions{
+			TensorFilter: func(name string) bool { return name == "proj.weight" },
+			Concurrency:  concurrency,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tensors := tensorsOf(t, result)
+		if len(tensors) != 5 {
+			t.Fatalf("expected 5 tensors, actual %d", len(tensors))
+		}
+		proj := tensors["proj.weight"].Source.(*DoubleStorage)
+		if err := proj.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if len(proj.Data) != 6 {
+			t.Errorf("expected 6 elements, actual %d", len(proj.Data))
+		}
+		embed := tensors["embed.weight"].Source.(*FloatStorage)
+		if err := embed.Wait(); !errors.Is(err, ErrTensorFiltered) {
+			t.Errorf("expected ErrTensorFiltered, actual %v", err)
+		}
+		if embed.Data != nil {
+			t.Errorf("expected no data, actual %v", embed.Data)
+		}
+	}
+
+	// the typed views of an untyped storage select the whole storage
+	filename = path.Join("testdata", "synthetic_type_punned_views.pt")
+	expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+	actual, err := LoadStateDictWithOptions(filename, LoadOptions{
+		TensorFilter: func(name string) bool { return name == "floats" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 1 {
+		t.Fatalf("expected 1 tensor, actual %d", len(actual))
+	}
+	if err := actual["floats"].Source.(*FloatStorage).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, actual["floats"].Source.(*FloatStorage).Data,
+		expected["floats"].Source.(*FloatStorage).Data, 0)
+}
@@ -4,6 +4,8 @@
 
 package pytorch
 
+import "math"
+
 // Converts the bits representation of a Half Float (16 bits) number to
 // an IEEE 754 float representation (32 bits)
 // From http://www.fox-toolkit.org/ftp/fasthalffloatconversion.pdf
@@ -11,6 +13,89 @@ func FloatBits16to32(u16 uint16) uint32 {
 	return mantissaTable[offsetTable[u16>>10]+(uint32(u16)&0x3ff)] + exponentTable[u16>>10]
 }
 
+// Converts the bits representation of a bfloat16 ("brain floating point",
+// 16 bits) number to an IEEE 754 float representation (32 bits). A bfloat16
+// is the upper half of the corresponding float, so no precision is lost.
+func BFloatBits16to32(u16 uint16) uint32 {
+	return uint32(u16) << 16
+}
+
+// Converts the bits representation of an IEEE 754 float (32 bits) number
+// to a bfloat16 (16 bits) representation, rounding to the nearest even
+// value. NaNs stay NaNs.
+func BFloatBits32to16(u32 uint32) uint16 {
+	if u32&0x7fffffff > 0x7f800000 { // NaN
+		return uint16(u32>>16) | 0x40
+	}
+	return uint16((u32 + 0x7fff + (u32>>16)&1) >> 16)
+}
+
+// Converts the bits representation of an IEEE 754 float (32 bits) number
+// to a Half Float (16 bits) representation, rounding to the nearest even
+// value. Values out of range become infinities, and NaNs stay NaNs.
+func FloatBits32to16(u32 uint32) uint16 {
+	sign := uint16(u32>>16) & 0x8000
+	exp := int(u32>>23) & 0xff
+	mantissa := u32 & 0x7fffff
+
+	if exp == 0xff { // Inf or NaN
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+
+	e := exp - 127 + 15
+	if e >= 0x1f { // overflow
+		return sign | 0x7c00
+	}
+	if e <= 0 { // subnormal half, or zero
+		if e < -10 {
+			return sign
+		}
+		mantissa |= 0x800000 // restore the implicit leading 1 bit
+		shift := uint(14 - e)
+		rounded := mantissa + (1 << (shift - 1)) - 1 + ((mantissa >> shift) & 1)
+		// a carry into the exponent yields the smallest normal half
+		return sign | uint16(rounded>>shift)
+	}
+
+	rounded := mantissa + 0xfff + ((mantissa >> 13) & 1)
+	if rounded&0x800000 != 0 { // the mantissa overflowed
+		rounded = 0
+		e++
+		if e >= 0x1f {
+			return sign | 0x7c00
+		}
+	}
+	return sign | uint16(e)<<10 | uint16(rounded>>13)
+}
+
+// Float16ToFloat32 returns the float32 value of the bits of an IEEE 754
+// half-precision float, as stored by "torch.float16" tensors. The
+// conversion is exact.
+func Float16ToFloat32(bits uint16) float32 {
+	return math.Float32frombits(FloatBits16to32(bits))
+}
+
+// Float32ToFloat16 returns the bits of the half-precision float nearest to
+// f, as FloatBits32to16.
+func Float32ToFloat16(f float32) uint16 {
+	return FloatBits32to16(math.Float32bits(f))
+}
+
+// BFloat16ToFloat32 returns the float32 value of the bits of a bfloat16,
+// as stored by "torch.bfloat16" tensors. The conversion is exact.
+func BFloat16ToFloat32(bits uint16) float32 {
+	return math.Float32frombits(BFloatBits16to32(bits))
+}
+
+// Float32ToBFloat16 returns the bits of the bfloat16 nearest to f, as
+// BFloatBits32to16.
+func Float32ToBFloat16(f float32) uint16 {
+	return BFloatBits32to16(math.Float32bits(f))
+}
+
 var mantissaTable [2048]uint32
 var exponentTable [64]uint32
 var offsetTable [64]uint32
@@ -47,10 +132,10 @@ func initExponentTable() {
 func initOffsetTable() {
 	offsetTable[0] = 0
 	offsetTable[32] = 0
-	for i := uint32(1); i < 31; i++ {
+	for i := uint32(1); i < 32; i++ {
 		offsetTable[i] = 1024
 	}
-	for i := uint32(32); i < 64; i++ {
+	for i := uint32(33); i < 64; i++ {
 		offsetTable[i] = 1024
 	}
 }
@@ -58,7 +143,7 @@ func initOffsetTable() {
 func convertMantissa(i uint32) uint32 {
 	var m uint32 = i << 13  // zero pad mantissa bits
 	var e uint32 = 0        // zero exponent
-	for m&0x00800000 != 0 { // while not normalized
+	for m&0x00800000 == 0 { // while not normalized
 		e -= 0x00800000 // decrement exponent (1 << 23)
 		m <<= 1         // shift mantissa
 	}
@@ -0,0 +1,105 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloat16Conversion(t *testing.T) {
+	for _, tc := range []struct {
+		bits  uint16
+		value float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3555, 0.333251953125},
+		{0x7bff, 65504},
+		{0x0001, 5.960464477539063e-08}, // smallest subnormal
+		{0x7c00, float32(math.Inf(1))},
+	} {
+		if v := Float16ToFloat32(tc.bits); v != tc.value {
+			t.Errorf("Float16ToFloat32(%#04x): expected %v, actual %v", tc.bits, tc.value, v)
+		}
+		if bits := Float32ToFloat16(tc.value); bits != tc.bits {
+			t.Errorf("Float32ToFloat16(%v): expected %#04x, actual %#04x", tc.value, tc.bits, bits)
+		}
+	}
+	// every half, but the NaNs, is decoded exactly
+	for i := 0; i < 1<<16; i++ {
+		bits := uint16(i)
+		if bits&0x7c00 == 0x7c00 && bits&0x3ff != 0 {
+			continue
+		}
+		if actual := Float32ToFloat16(Float16ToFloat32(bits)); actual != bits {
+			t.Fatalf("expected %#04x after round trip, actual %#04x", bits, actual)
+		}
+	}
+	if v := Float16ToFloat32(0x8000); v != 0 || !math.Signbit(float64(v)) {
+		t.Errorf("expected -0, actual %v", v)
+	}
+	if bits := Float32ToFloat16(1e6); bits != 0x7c00 {
+		t.Errorf("expected overflow to infinity, actual %#04x", bits)
+	}
+	if v := Float16ToFloat32(Float32ToFloat16(float32(math.NaN()))); !math.IsNaN(float64(v)) {
+		t.Errorf("expected NaN, actual %v", v)
+	}
+}
+
+func TestBFloat16Conversion(t *testing.T) {
+	for _, tc := range []struct {
+		bits  uint16
+		value float32
+	}{
+		{0x0000, 0},
+		{0x3f80, 1},
+		{0xc000, -2},
+		{0x3eab, 0.333984375},
+		{0x7f80, float32(math.Inf(1))},
+	} {
+		if v := BFloat16ToFloat32(tc.bits); v != tc.value {
+			t.Errorf("BFloat16ToFloat32(%#04x): expected %v, actual %v", tc.bits, tc.value, v)
+		}
+		if bits := Float32ToBFloat16(tc.value); bits != tc.bits {
+			t.Errorf("Float32ToBFloat16(%v): expected %#04x, actual %#04x", tc.value, tc.bits, bits)
+		}
+	}
+	// 1/3 is rounded to the nearest bfloat16
+	if bits := Float32ToBFloat16(1.0 / 3); bits != 0x3eab {
+		t.Errorf("expected 0x3eab, actual %#04x", bits)
+	}
+}
+
+func TestHalfStorageFloat32s(t *testing.T) {
+	half := &HalfStorage{BaseStorage: BaseStorage{Size: 2}, Data: []float32{1, -2}}
+	data, err := half.Float32s()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, data, []float32{1, -2}, 0)
+	bits, err := half.Float16Bits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits[0] != 0x3c00 || bits[1] != 0xc000 {
+		t.Errorf("expected [0x3c00 0xc000], actual %#04x", bits)
+	}
+
+	bf16 := &BFloat16Storage{BaseStorage: BaseStorage{Size: 2}, Data: []float32{1, -2}}
+	data, err = bf16.Float32s()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, data, []float32{1, -2}, 0)
+	bits, err = bf16.BFloat16Bits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits[0] != 0x3f80 || bits[1] != 0xc000 {
+		t.Errorf("expected [0x3f80 0xc000], actual %#04x", bits)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import "fmt"
+
+// Mat64 holds the elements of a matrix in the layout of the general
+// matrices of Gonum, with the same fields of "blas64.General", so that it
+// can be converted to one, and made into a "mat.Dense", without depending
+// on Gonum here. The fields are only checked against a copy of the Gonum
+// type, in the tests, not against Gonum itself:
+//
+//	m, err := weight.ToMat64()
+//	if err != nil {
+//		return err
+//	}
+//	var dense mat.Dense
+//	dense.SetRawMatrix(blas64.General(*m))
+type Mat64 struct {
+	Rows, Cols int
+	// Data holds the element at row i and column j at index i*Stride+j.
+	Data   []float64
+	Stride int
+}
+
+// Vec64 holds the elements of a vector in the layout of the vectors of
+// Gonum, with the same fields of "blas64.Vector", so that it can be
+// converted to one, and made into a "mat.VecDense" with SetRawVector. As
+// for Mat64, the fields are only checked against a copy of the Gonum type.
+type Vec64 struct {
+	N int
+	// Data holds the element i at index i*Inc.
+	Data []float64
+	Inc  int
+}
+
+// ToMat64 returns the elements of a 2-D tensor of any floating point type,
+// such as the weight of a linear layer, as a Mat64. The elements of a
+// torch.float64 tensor whose rows are contiguous, even if spaced out in
+// its storage, as for the views made by slicing the columns of a matrix,
+// are not copied: the Data aliases the storage, so that changing either
+// one changes both. The other tensors, including the transposed views,
+// are copied, widening their elements to float64 if needed.
+func (t *Tensor) ToMat64() (*Mat64, error) {
+	if len(t.Size) != 2 {
+		return nil, fmt.Errorf("ToMat64: expected a 2-D tensor, actual size %v", t.Size)
+	}
+	rows, cols := t.Size[0], t.Size[1]
+	// the stride of a single column, or of a single row, is irrelevant
+	if _, ok := t.Source.(*DoubleStorage); ok && len(t.Stride) == 2 && rows > 0 && cols > 0 &&
+		(cols == 1 || t.Stride[1] == 1) && (rows == 1 || t.Stride[0] >= cols) {
+		data, err := t.storageFloat64s()
+		if err != nil {
+			return nil, fmt.Errorf("ToMat64: %w", err)
+		}
+		stride := cols
+		if rows > 1 {
+			stride = t.Stride[0]
+		}
+		end := t.StorageOffset + (rows-1)*stride + cols
+		return &Mat64{Rows: rows, Cols: cols, Data: data[t.StorageOffset:end:end], Stride: stride}, nil
+	}
+	data, err := t.GetDataAsFloat64()
+	if err != nil {
+		return nil, fmt.Errorf("ToMat64: %w", err)
+	}
+	return &Mat64{Rows: rows, Cols: cols, Data: data, Stride: cols}, nil
+}
+
+// ToVec64 returns the elements of a 1-D tensor of any floating point type,
+// such as the bias of a linear layer, as a Vec64. As for ToMat64, the Data
+// of a torch.float64 tensor with a positive stride aliases its storage,
+// while the elements of the others are copied.
+func (t *Tensor) ToVec64() (*Vec64, error) {
+	if len(t.Size) != 1 {
+		return nil, fmt.Errorf("ToVec64: expected a 1-D tensor, actual size %v", t.Size)
+	}
+	n := t.Size[0]
+	if _, ok := t.Source.(*DoubleStorage); ok && len(t.Stride) == 1 && n > 0 && t.Stride[0] > 0 {
+		data, err := t.storageFloat64s()
+		if err != nil {
+			return nil, fmt.Errorf("ToVec64: %w", err)
+		}
+		end := t.StorageOffset + (n-1)*t.Stride[0] + 1
+		return &Vec64{N: n, Data: data[t.StorageOffset:end:end], Inc: t.Stride[0]}, nil
+	}
+	data, err := t.GetDataAsFloat64()
+	if err != nil {
+		return nil, fmt.Errorf("ToVec64: %w", err)
+	}
+	return &Vec64{N: n, Data: data, Inc: 1}, nil
+}
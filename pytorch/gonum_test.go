@@ -0,0 +1,153 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"reflect"
+	"testing"
+)
+
+// blas64General and blas64Vector are copies of the "blas64.General" and
+// "blas64.Vector" types of gonum.org/v1/gonum, which Mat64 and Vec64 must
+// be convertible to.
+type blas64General struct {
+	Rows, Cols int
+	Data       []float64
+	Stride     int
+}
+
+type blas64Vector struct {
+	N    int
+	Data []float64
+	Inc  int
+}
+
+func TestGonumLayout(t *testing.T) {
+	// the conversions only compile if the fields are the same, in order
+	m := blas64General(Mat64{Rows: 1, Cols: 2, Data: []float64{1, 2}, Stride: 2})
+	v := blas64Vector(Vec64{N: 2, Data: []float64{1, 2}, Inc: 1})
+	if m.Stride != 2 || v.Inc != 1 {
+		t.Errorf("unexpected conversions %#v and %#v", m, v)
+	}
+	for _, pair := range [][2]reflect.Type{
+		{reflect.TypeOf(Mat64{}), reflect.TypeOf(blas64General{})},
+		{reflect.TypeOf(Vec64{}), reflect.TypeOf(blas64Vector{})},
+	} {
+		actual, expected := pair[0], pair[1]
+		if actual.NumField() != expected.NumField() {
+			t.Fatalf("%v: expected %d fields, actual %d", actual, expected.NumField(), actual.NumField())
+		}
+		for i := 0; i < expected.NumField(); i++ {
+			a, e := actual.Field(i), expected.Field(i)
+			if a.Name != e.Name || a.Type != e.Type {
+				t.Errorf("%v: expected field %d %s %v, actual %s %v", actual, i, e.Name, e.Type, a.Name, a.Type)
+			}
+		}
+	}
+}
+
+func newDoubleTensor(data []float64, size ...int) *Tensor {
+	return &Tensor{
+		Source: &DoubleStorage{
+			BaseStorage: BaseStorage{Size: len(data), Location: "cpu"},
+			Data:        data,
+		},
+		Size:   size,
+		Stride: contiguousStride(size),
+	}
+}
+
+func TestToMat64(t *testing.T) {
+	data := []float64{1, 2, 3, 4, 5, 6}
+	weight := newDoubleTensor(data, 2, 3)
+
+	t.Run("aliased", func(t *testing.T) {
+		m, err := weight.ToMat64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &Mat64{Rows: 2, Cols: 3, Data: data, Stride: 3}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("expected %v, actual %v", expected, m)
+		}
+		if &m.Data[0] != &data[0] {
+			t.Error("expected the data to alias the storage")
+		}
+	})
+
+	t.Run("column slice", func(t *testing.T) {
+		// weight[:, 1:]
+		sliced := &Tensor{Source: weight.Source, StorageOffset: 1, Size: []int{2, 2}, Stride: []int{3, 1}}
+		m, err := sliced.ToMat64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &Mat64{Rows: 2, Cols: 2, Data: []float64{2, 3, 4, 5, 6}, Stride: 3}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("expected %v, actual %v", expected, m)
+		}
+		if &m.Data[0] != &data[1] {
+			t.Error("expected the data to alias the storage")
+		}
+	})
+
+	t.Run("transposed", func(t *testing.T) {
+		transposed := &Tensor{Source: weight.Source, Size: []int{3, 2}, Stride: []int{1, 3}}
+		m, err := transposed.ToMat64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &Mat64{Rows: 3, Cols: 2, Data: []float64{1, 4, 2, 5, 3, 6}, Stride: 2}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("expected %v, actual %v", expected, m)
+		}
+	})
+
+	t.Run("float32", func(t *testing.T) {
+		m, err := newFloatTensor([]float32{0.5, -1}, 1, 2).ToMat64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &Mat64{Rows: 1, Cols: 2, Data: []float64{0.5, -1}, Stride: 2}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("expected %v, actual %v", expected, m)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := newDoubleTensor(data, 6).ToMat64()
+		assertErrorContains(t, err, "expected a 2-D tensor, actual size [6]")
+		out := &Tensor{Source: weight.Source, StorageOffset: 1, Size: []int{2, 3}, Stride: []int{3, 1}}
+		_, err = out.ToMat64()
+		assertErrorContains(t, err, "exceeds storage of length 6")
+	})
+}
+
+func TestToVec64(t *testing.T) {
+	data := []float64{1, 2, 3, 4}
+	// the first column of a 2x2 matrix
+	column := &Tensor{Source: newDoubleTensor(data, 4).Source, Size: []int{2}, Stride: []int{2}}
+	v, err := column.ToVec64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Vec64{N: 2, Data: []float64{1, 2, 3}, Inc: 2}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %v, actual %v", expected, v)
+	}
+	if &v.Data[0] != &data[0] {
+		t.Error("expected the data to alias the storage")
+	}
+
+	v, err = newFloatTensor([]float32{1.5, 2}, 2).ToVec64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&Vec64{N: 2, Data: []float64{1.5, 2}, Inc: 1}); !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %v, actual %v", expected, v)
+	}
+	_, err = newDoubleTensor(data, 2, 2).ToVec64()
+	assertErrorContains(t, err, "expected a 1-D tensor")
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import "fmt"
+
+// GorgoniaTensor holds the elements and the shape of a tensor in the
+// layout expected by Gorgonia, so that it can be made into a dense tensor
+// without depending on Gorgonia here:
+//
+//	g, err := pytorch.ToGorgoniaTensor(t)
+//	if err != nil {
+//		return err
+//	}
+//	dense := tensor.New(tensor.WithShape(g.Shape...), tensor.WithBacking(g.Backing))
+type GorgoniaTensor struct {
+	// Backing is a new slice with the elements of the tensor, in
+	// contiguous row-major order, such as []float32 or []float64.
+	Backing interface{}
+	// Shape is the size of each dimension, empty for a scalar.
+	Shape []int
+}
+
+// ToGorgoniaTensor returns the elements and the shape of t, ready to be
+// passed to "tensor.New" of Gorgonia with the options "tensor.WithBacking"
+// and "tensor.WithShape". Float16 and BFloat16 elements are held as float32 values.
+//
+// The tensors of all the data types which have a Gorgonia counterpart are
+// supported, that is all the floating point, integer and boolean ones.
+// Quantized tensors must be dequantized first.
+func ToGorgoniaTensor(t *Tensor) (*GorgoniaTensor, error) {
+	if t.Quantizer != nil {
+		return nil, fmt.Errorf("ToGorgoniaTensor: quantized tensor, call Dequantize first")
+	}
+	if _, ok := t.Source.(*UntypedStorage); ok {
+		return nil, fmt.Errorf("ToGorgoniaTensor: tensor of untyped storage")
+	}
+	data, err := t.GetData()
+	if err != nil {
+		return nil, fmt.Errorf("ToGorgoniaTensor: %w", err)
+	}
+	switch data.(type) {
+	case []float32, []float64,
+		[]int8, []int16, []int32, []int64,
+		[]uint8, []uint16, []uint32, []uint64,
+		[]bool:
+	default:
+		return nil, fmt.Errorf("ToGorgoniaTensor: unsupported tensor of type %v", t.Dtype())
+	}
+	return &GorgoniaTensor{
+		Backing: data,
+		Shape:   append([]int{}, t.Size...),
+	}, nil
+}
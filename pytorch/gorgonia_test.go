@@ -0,0 +1,66 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToGorgoniaTensor(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+
+	t.Run("weight matrix", func(t *testing.T) {
+		g, err := ToGorgoniaTensor(weight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, g.Shape, []int{2, 3})
+		expected := []float32{1, 2, 3, 4, 5, 6}
+		if !reflect.DeepEqual(g.Backing, expected) {
+			t.Errorf("expected backing %v, actual %v", expected, g.Backing)
+		}
+	})
+
+	t.Run("transposed weight matrix", func(t *testing.T) {
+		transposed := &Tensor{Source: weight.Source, Size: []int{3, 2}, Stride: []int{1, 3}}
+		g, err := ToGorgoniaTensor(transposed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, g.Shape, []int{3, 2})
+		expected := []float32{1, 4, 2, 5, 3, 6}
+		if !reflect.DeepEqual(g.Backing, expected) {
+			t.Errorf("expected backing %v, actual %v", expected, g.Backing)
+		}
+	})
+
+	t.Run("float64", func(t *testing.T) {
+		tensor := &Tensor{
+			Source: &DoubleStorage{BaseStorage: BaseStorage{Size: 2}, Data: []float64{0.5, -1}},
+			Size:   []int{2, 1},
+			Stride: []int{1, 1},
+		}
+		g, err := ToGorgoniaTensor(tensor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, g.Shape, []int{2, 1})
+		if expected := []float64{0.5, -1}; !reflect.DeepEqual(g.Backing, expected) {
+			t.Errorf("expected backing %v, actual %v", expected, g.Backing)
+		}
+	})
+
+	t.Run("quantized", func(t *testing.T) {
+		quantized := &Tensor{
+			Source:    &QInt8Storage{BaseStorage: BaseStorage{Size: 1}, Data: []int8{1}},
+			Size:      []int{1},
+			Stride:    []int{1},
+			Quantizer: &Quantizer{Scheme: PerTensorAffine, Scale: 0.5},
+		}
+		_, err := ToGorgoniaTensor(quantized)
+		assertErrorContains(t, err, "call Dequantize first")
+	})
+}
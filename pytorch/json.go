@@ -0,0 +1,251 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// NonFiniteFloats tells how StructureToJSON emits the NaN and infinite
+// floats, which JSON cannot represent as numbers.
+type NonFiniteFloats int
+
+const (
+	// NonFiniteAsStrings emits the strings "NaN", "Infinity" and
+	// "-Infinity", as Python "json.dumps" does without quotes.
+	NonFiniteAsStrings NonFiniteFloats = iota
+	// NonFiniteAsNull emits null.
+	NonFiniteAsNull
+	// NonFiniteAsError makes StructureToJSON fail.
+	NonFiniteAsError
+)
+
+// JSONOptions allows to customize StructureToJSON. The zero value is
+// valid.
+type JSONOptions struct {
+	// NonFiniteFloats is the handling of NaN and infinite floats. The
+	// default is NonFiniteAsStrings.
+	NonFiniteFloats NonFiniteFloats
+}
+
+// StructureToJSON returns a JSON representation of a loaded structure,
+// such as the metadata of a checkpoint, for inspection or export:
+//
+//   - dicts become objects, in their order, with keys which are not
+//     strings formatted as by fmt.Sprint;
+//   - lists, tuples and sets become arrays;
+//   - types.Bytes and types.ByteArray values become base64 strings, as
+//     []byte values do with encoding/json;
+//   - tensors are summarized as objects with their "dtype" and "shape",
+//     without data, or with their "error" (see Tensor.Err);
+//   - modules become objects with their "class" and "attributes";
+//   - data types, classes and any other fmt.Stringer become strings.
+//
+// Any other value makes it fail.
+func StructureToJSON(obj interface{}, opts JSONOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	e := &jsonEncoder{buf: &buf, opts: opts}
+	if err := e.encode(obj); err != nil {
+		return nil, fmt.Errorf("StructureToJSON: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+type jsonEncoder struct {
+	buf  *bytes.Buffer
+	opts JSONOptions
+}
+
+func (e *jsonEncoder) encode(obj interface{}) error {
+	switch v := obj.(type) {
+	case nil:
+		e.buf.WriteString("null")
+	case bool:
+		e.buf.WriteString(strconv.FormatBool(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		fmt.Fprint(e.buf, v)
+	case *big.Int:
+		e.buf.WriteString(v.String())
+	case float32:
+		return e.encodeFloat(v, float64(v))
+	case float64:
+		return e.encodeFloat(v, v)
+	case string:
+		return e.encodeMarshaled(v)
+	case types.Bytes:
+		return e.encodeMarshaled(v.Bytes())
+	case *types.ByteArray:
+		return e.encodeMarshaled(v.Bytes())
+	case *types.Dict, *types.OrderedDict, *types.DefaultDict, *types.Counter:
+		entries, _ := dictEntries(v)
+		return e.encodeObject(entries)
+	case *types.List:
+		return e.encodeArray(*v)
+	case *types.Tuple:
+		return e.encodeArray(*v)
+	case *types.Deque:
+		return e.encodeArray(v.Items)
+	case *types.Set:
+		return e.encodeSet(len(*v), func(add func(interface{})) {
+			for item := range *v {
+				add(item)
+			}
+		})
+	case *types.FrozenSet:
+		return e.encodeSet(len(*v), func(add func(interface{})) {
+			for item := range *v {
+				add(item)
+			}
+		})
+	case *Tensor:
+		if v.Err != nil {
+			return e.encodeObject([]types.DictEntry{{Key: "error", Value: v.Err.Error()}})
+		}
+		shape := make(types.List, len(v.Size))
+		for i, s := range v.Size {
+			shape[i] = s
+		}
+		var dtype interface{}
+		if d := v.Dtype(); d != nil {
+			dtype = d.Name
+		}
+		return e.encodeObject([]types.DictEntry{
+			{Key: "dtype", Value: dtype},
+			{Key: "shape", Value: &shape},
+		})
+	case *Module:
+		return e.encodeObject([]types.DictEntry{
+			{Key: "class", Value: v.Class.Module + "." + v.Class.Name},
+			{Key: "attributes", Value: v.Attributes},
+		})
+	case *UnknownObject:
+		entries := []types.DictEntry{
+			{Key: "class", Value: v.Class.String()},
+			{Key: "args", Value: (*types.List)(&v.Args)},
+			{Key: "state", Value: v.State},
+		}
+		if v.ListItems != nil {
+			entries = append(entries, types.DictEntry{Key: "list_items", Value: (*types.List)(&v.ListItems)})
+		}
+		if v.DictItems != nil {
+			entries = append(entries, types.DictEntry{Key: "dict_items", Value: v.DictItems})
+		}
+		return e.encodeObject(entries)
+	case *types.GenericClass:
+		return e.encodeMarshaled(v.Module + "." + v.Name)
+	case fmt.Stringer:
+		return e.encodeMarshaled(v.String())
+	default:
+		return fmt.Errorf("unsupported value %T", obj)
+	}
+	return nil
+}
+
+// encodeFloat writes a float32 or float64 value v, whose value is f.
+func (e *jsonEncoder) encodeFloat(v interface{}, f float64) error {
+	if !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return e.encodeMarshaled(v)
+	}
+	switch e.opts.NonFiniteFloats {
+	case NonFiniteAsNull:
+		e.buf.WriteString("null")
+	case NonFiniteAsError:
+		return fmt.Errorf("non-finite float %v", f)
+	default:
+		switch {
+		case math.IsNaN(f):
+			e.buf.WriteString(`"NaN"`)
+		case f > 0:
+			e.buf.WriteString(`"Infinity"`)
+		default:
+			e.buf.WriteString(`"-Infinity"`)
+		}
+	}
+	return nil
+}
+
+func (e *jsonEncoder) encodeMarshaled(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.buf.Write(data)
+	return nil
+}
+
+func (e *jsonEncoder) encodeObject(entries []types.DictEntry) error {
+	e.buf.WriteByte('{')
+	for i, entry := range entries {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		key, ok := entry.Key.(string)
+		if !ok {
+			if b, isBytes := entry.Key.(types.Bytes); isBytes {
+				key = string(b)
+			} else {
+				key = fmt.Sprint(entry.Key)
+			}
+		}
+		if err := e.encodeMarshaled(key); err != nil {
+			return err
+		}
+		e.buf.WriteByte(':')
+		if err := e.encode(entry.Value); err != nil {
+			return fmt.Errorf("%q: %w", key, err)
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+func (e *jsonEncoder) encodeArray(items []interface{}) error {
+	e.buf.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		if err := e.encode(item); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	e.buf.WriteByte(']')
+	return nil
+}
+
+// encodeSet writes the items of a set as an array, sorted by their JSON
+// representation, so that the output does not depend on the map order.
+func (e *jsonEncoder) encodeSet(n int, forEach func(add func(interface{}))) error {
+	encoded := make([]string, 0, n)
+	var err error
+	forEach(func(item interface{}) {
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		err = (&jsonEncoder{buf: &buf, opts: e.opts}).encode(item)
+		encoded = append(encoded, buf.String())
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(encoded)
+	e.buf.WriteByte('[')
+	for i, s := range encoded {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.buf.WriteString(s)
+	}
+	e.buf.WriteByte(']')
+	return nil
+}
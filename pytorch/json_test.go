@@ -0,0 +1,53 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"math"
+	"testing"
+)
+
+func TestStructureToJSON(t *testing.T) {
+	scheduler := types.NewOrderedDict()
+	scheduler.Set("min_lr", 0.0)
+	scheduler.Set("max_lr", math.Inf(1))
+	scheduler.Set("best", math.NaN())
+	scheduler.Set("factor", float32(0.1))
+	checkpoint := types.NewDict()
+	checkpoint.Set("epoch", 3)
+	checkpoint.Set(types.Bytes("name"), "run")
+	checkpoint.Set("scheduler", scheduler)
+	checkpoint.Set("weights", &types.Tuple{newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3), nil})
+	checkpoint.Set(7, &types.List{true, types.Bytes("\x00\x01"), Float16})
+
+	const common = `{"epoch":3,"name":"run","scheduler":{"min_lr":0,"max_lr":%s,"best":%s,"factor":0.1},` +
+		`"weights":[{"dtype":"float32","shape":[2,3]},null],"7":[true,"AAE=","torch.float16"]}`
+	testCases := []struct {
+		nonFinite   NonFiniteFloats
+		maxLR, best string
+	}{
+		{NonFiniteAsStrings, `"Infinity"`, `"NaN"`},
+		{NonFiniteAsNull, `null`, `null`},
+	}
+	for _, tc := range testCases {
+		actual, err := StructureToJSON(checkpoint, JSONOptions{NonFiniteFloats: tc.nonFinite})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(common, tc.maxLR, tc.best)
+		if string(actual) != expected {
+			t.Errorf("mode %d: expected %s, actual %s", tc.nonFinite, expected, actual)
+		}
+		if !json.Valid(actual) {
+			t.Errorf("mode %d: invalid JSON %s", tc.nonFinite, actual)
+		}
+	}
+
+	_, err := StructureToJSON(checkpoint, JSONOptions{NonFiniteFloats: NonFiniteAsError})
+	assertErrorContains(t, err, `"scheduler": "max_lr": non-finite float +Inf`)
+}
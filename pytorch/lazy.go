@@ -0,0 +1,189 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LoadLazy is like Load, but the data of each storage is only read when it
+// is first accessed, as with LoadOptions.Lazy, so that loading only a few
+// tensors of a large checkpoint reads only their data.
+func LoadLazy(filename string) (interface{}, error) {
+	return LoadWithOptions(filename, LoadOptions{Lazy: true})
+}
+
+// lazyRecord locates the data of a storage loaded with LoadOptions.Lazy
+// in the file it is read from, when it is first accessed. The file is
+// opened again for each storage, so that none is kept open meanwhile.
+type lazyRecord struct {
+	filename string
+	// offset and length delimit the data in the file.
+	offset, length int64
+	// method is the compression method of the zip record holding the
+	// data, which is zip.Store for legacy files.
+	method uint16
+	// dataType and byteOrder are the class of the storage and the byte
+	// order of its elements, as for setStorageData.
+	dataType   StorageClassInterface
+	byteOrder  binary.ByteOrder
+	bufferSize int
+}
+
+// setLazy makes a storage of size elements read its data from the given
+// record on first access.
+func setLazy(storage StorageInterface, size int, record lazyRecord) error {
+	return setLazyLoad(storage, func() error {
+		return record.read(storage, size)
+	})
+}
+
+// setLazyLoad makes the data of a storage be set by calling load, on
+// first access.
+func setLazyLoad(storage StorageInterface, load func() error) error {
+	bs, ok := storage.(baseStorager)
+	if !ok {
+		return fmt.Errorf("storage %T cannot be loaded lazily", storage)
+	}
+	bs.baseStorage().pending = newLazyData(load)
+	return nil
+}
+
+// read sets size elements of the storage from the record.
+func (l lazyRecord) read(storage StorageInterface, size int) error {
+	f, err := os.Open(l.filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = io.NewSectionReader(f, l.offset, l.length)
+	switch l.method {
+	case zip.Store:
+	case zip.Deflate:
+		fr := flate.NewReader(r)
+		defer fr.Close()
+		r = fr
+	default:
+		return zip.ErrAlgorithm
+	}
+	r = bufio.NewReaderSize(r, l.bufferSize)
+	if err := setStorageData(storage, l.dataType, r, size, l.byteOrder); err != nil {
+		return fmt.Errorf("cannot read lazy storage at offset %d of %s: %w",
+			l.offset, l.filename, err)
+	}
+	return nil
+}
+
+// loadLazyZipStorage returns a storage read lazily from its own record of
+// the zip-based file being loaded, which is checked as readStorageRecord
+// does.
+func loadLazyZipStorage(
+	dataType StorageClassInterface,
+	size int,
+	location, key string,
+	byteOrder binary.ByteOrder,
+	zipFileRecords map[string]*zip.File,
+	opts LoadOptions,
+) (StorageInterface, error) {
+	file, err := storageRecord(dataType, size, key, zipFileRecords)
+	if err != nil {
+		return nil, err
+	}
+	if file.Method != zip.Store && file.Method != zip.Deflate {
+		return nil, fmt.Errorf("zip record '%s': %w", key, zip.ErrAlgorithm)
+	}
+	offset, err := file.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	storage := dataType.New(size, location)
+	err = setLazy(storage, size, lazyRecord{
+		filename:   opts.lazyFile,
+		offset:     offset,
+		length:     int64(file.CompressedSize64),
+		method:     file.Method,
+		dataType:   dataType,
+		byteOrder:  byteOrder,
+		bufferSize: opts.StorageReadBufferSize,
+	})
+	return storage, err
+}
+
+// setLegacyLazyStorages makes the storages of a legacy file, whose data
+// follows in f, in the order of their keys, read it lazily from there.
+// Only the number of elements which precedes the data of each storage is
+// read, and the data is skipped with seeker, after checking that it is
+// within the file. The storages of custom classes, whose element size is
+// unknown, are read right away.
+func setLegacyLazyStorages(
+	f io.Reader,
+	seeker io.Seeker,
+	storageKeys []string,
+	storages map[string]StorageInterface,
+	opts LoadOptions,
+) error {
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	fileSize, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	for _, key := range storageKeys {
+		storage, ok := storages[key]
+		if !ok {
+			return fmt.Errorf("storage object not found for key '%s'", key)
+		}
+		elementSize, ok := storageElementSize(storage)
+		if !ok {
+			if err := storage.SetFromFile(f); err != nil {
+				return err
+			}
+			if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sizeBuf := make([]byte, 8)
+		if _, err := io.ReadFull(f, sizeBuf); err != nil {
+			return fmt.Errorf("storage '%s': %w", key, io.ErrUnexpectedEOF)
+		}
+		offset += 8
+		size := binary.LittleEndian.Uint64(sizeBuf)
+		length := size * uint64(elementSize)
+		if size > uint64(fileSize) || length > uint64(fileSize-offset) {
+			return fmt.Errorf("storage '%s' of %d elements requires %d bytes, "+
+				"but only %d bytes are left in the file", key, size,
+				length, fileSize-offset)
+		}
+		err := setLazy(storage, int(size), lazyRecord{
+			filename:   opts.lazyFile,
+			offset:     offset,
+			length:     int64(length),
+			method:     zip.Store,
+			bufferSize: opts.StorageReadBufferSize,
+		})
+		if err != nil {
+			return err
+		}
+		if offset, err = seeker.Seek(int64(length), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLoadLazy(t *testing.T) {
+	for _, filename := range []string{
+		"synthetic_training_checkpoint.pt",
+		"synthetic_untyped_storage_v3.pt",
+		"synthetic_type_punned_views.pt",
+		"synthetic_legacy_storage_views.pt",
+		"synthetic_legacy_tar.pt", // always read in full
+		"tensor_float16_proto2_zip.pt",
+		"tensor_float32_proto2.pt",
+	} {
+		t.Run(filename, func(t *testing.T) {
+			filename := path.Join("testdata", filename)
+			expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+			actual := loadTensorsWithOptions(t, filename, LoadOptions{Lazy: true})
+			assertTensorDataEqual(t, actual, expected)
+		})
+	}
+
+	t.Run("deflated records", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "deflated.pt")
+		deflateZipFile(t, path.Join("testdata", "synthetic_training_checkpoint.pt"), filename)
+		expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+		actual := loadTensorsWithOptions(t, filename, LoadOptions{Lazy: true})
+		assertTensorDataEqual(t, actual, expected)
+	})
+}
+
+func TestLoadLazyReadsOnAccess(t *testing.T) {
+	for _, name := range []string{"tensor_float32_proto2_zip.pt", "tensor_float32_proto2.pt"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(path.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			filename := path.Join(t.TempDir(), name)
+			if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			result, err := LoadWithOptions(filename, LoadOptions{Lazy: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tensor := result.(*Tensor)
+			storage := tensor.Source.(*FloatStorage)
+			assertIntSliceEqual(t, tensor.Size, []int{4})
+			if storage.Data != nil {
+				t.Fatal("expected the data to be read on first access")
+			}
+
+			if err := os.Remove(filename); err != nil {
+				t.Fatal(err)
+			}
+			_, err = tensor.GetData()
+			if !os.IsNotExist(err) {
+				t.Errorf("expected a missing file error, actual %v", err)
+			}
+		})
+	}
+
+	t.Run("truncated legacy file", func(t *testing.T) {
+		data, err := ioutil.ReadFile(path.Join("testdata", "tensor_float32_proto2.pt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := path.Join(t.TempDir(), "truncated.pt")
+		if err := ioutil.WriteFile(filename, data[:len(data)-4], 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadWithOptions(filename, LoadOptions{Lazy: true})
+		assertErrorContains(t, err, "requires 16 bytes, but only 12 bytes are left")
+	})
+}
+
+func TestLoadLazyReadsOnlyAccessedStorages(t *testing.T) {
+	for _, name := range []string{"synthetic_training_checkpoint.pt", "synthetic_legacy_storage_views.pt"} {
+		t.Run(name, func(t *testing.T) {
+			result, err := LoadLazy(path.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tensors := tensorsOf(t, result)
+			var first string
+			for name := range tensors {
+				if first == "" || name < first {
+					first = name
+				}
+			}
+			if _, err := tensors[first].GetData(); err != nil {
+				t.Fatal(err)
+			}
+			for name, tensor := range tensors {
+				data, err := storageDataField(tensor.Source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected := tensor.Source == tensors[first].Source
+				if read := !data.IsNil(); read != expected {
+					t.Errorf("%q: expected data read %v, actual %v", name, expected, read)
+				}
+			}
+		})
+	}
+}
+
+// assertTensorDataEqual checks that the tensors by name have the same
+// sizes and data, which is read from tensors loaded lazily.
+func assertTensorDataEqual(t *testing.T, actual, expected map[string]*Tensor) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d tensors, actual %d", len(expected), len(actual))
+	}
+	for name, e := range expected {
+		a := actual[name]
+		assertIntSliceEqual(t, a.Size, e.Size)
+		expectedData, err := e.GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actualData, err := a.GetData()
+		if err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		if !reflect.DeepEqual(actualData, expectedData) {
+			t.Errorf("%q: expected data %v, actual %v", name, expectedData, actualData)
+		}
+	}
+}
+
+// deflateZipFile writes a copy of a zip file, with all of its records
+// compressed.
+func deflateZipFile(t *testing.T, src, dst string) {
+	t.Helper()
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, f := range r.File {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// legacyTarMembers are the members of a legacy tar file needed to load
+// it, in the order they are processed.
+var legacyTarMembers = []string{"storages", "tensors", "pickle"}
+
+// loadLegacyTar loads a legacy file in the tar format written by the
+// oldest versions of PyTorch. header is the first header, already read
+// from tr.
+//
+// The "storages" member holds the data of all the storages, followed by
+// the views of other storages; the "tensors" member holds the metadata of
+// all the tensors, referring to the storages by key; the "pickle" member
+// is the object itself, referring to the tensors and storages by key
+// through persistent IDs. Any other member, such as "sys_info", is
+// ignored.
+func loadLegacyTar(tr *tar.Reader, header *tar.Header, opts LoadOptions) (interface{}, error) {
+	members := make(map[string][]byte, len(legacyTarMembers))
+	for {
+		switch header.Name {
+		case "storages", "tensors", "pickle":
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read tar member '%s': %w", header.Name, err)
+			}
+			members[header.Name] = data
+		}
+		var err error
+		header, err = tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range legacyTarMembers {
+		if _, ok := members[name]; !ok {
+			return nil, fmt.Errorf("tar member '%s' not found", name)
+		}
+	}
+
+	l := &legacyTarLoader{
+		opts:    opts,
+		objects: make(map[string]interface{}),
+		counter: newTensorCounter(opts.MaxTensors),
+	}
+	// The unpickler of the object is made first, to resolve the classes of
+	// all the members with its FindClass function, if any.
+	u := opts.NewUnpickler(bytes.NewReader(members["pickle"]))
+	l.findClass = makePickleFindClass(u.FindClass, opts)
+	if err := l.loadStorages(bytes.NewReader(members["storages"])); err != nil {
+		return nil, fmt.Errorf("tar member 'storages': %w", err)
+	}
+	if err := l.loadTensors(bytes.NewReader(members["tensors"])); err != nil {
+		return nil, fmt.Errorf("tar member 'tensors': %w", err)
+	}
+	u.FindClass = l.findClass
+	u.PersistentLoad = l.PersistentLoad
+	return u.Load()
+}
+
+// legacyTarLoader holds the state of the loading of a legacy tar file.
+type legacyTarLoader struct {
+	opts      LoadOptions
+	findClass func(module, name string) (interface{}, error)
+	// objects are the storages and the tensors loaded so far, by key,
+	// which is the Python ID of the original object.
+	objects map[string]interface{}
+	counter *tensorCounter
+}
+
+var _ pickle.PersistentLoader = &legacyTarLoader{}
+
+// unpickle reads the next of the small pickles of a member from r.
+func (l *legacyTarLoader) unpickle(r io.Reader) (interface{}, error) {
+	u := l.opts.NewUnpickler(r)
+	u.FindClass = func(module, name string) (interface{}, error) {
+		// the original type of the tensors, such as "torch.FloatTensor",
+		// which is not needed
+		if (module == "torch" || module == "torch.cuda") && strings.HasSuffix(name, "Tensor") {
+			return types.NewGenericClass(module, name), nil
+		}
+		return l.findClass(module, name)
+	}
+	return u.Load()
+}
+
+// loadStorages reads the "storages" member: the number of storages, then,
+// for each one, a (key, location, storage_type) tuple followed by the
+// number of its elements and their data, and finally a list of
+// (key, root_key, offset, numel) views of the storages.
+func (l *legacyTarLoader) loadStorages(r io.Reader) error {
+	n, err := l.unpickleCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		obj, err := l.unpickle(r)
+		if err != nil {
+			return err
+		}
+		tuple, ok := obj.(*types.Tuple)
+		if !ok || tuple.Len() != 3 {
+			return fmt.Errorf("unexpected storage header %#v", obj)
+		}
+		key, keyOk := persistentKey(tuple.Get(0))
+		location, locationOk := persistentString(tuple.Get(1))
+		storageClass, classOk := tuple.Get(2).(StorageClassInterface)
+		if !keyOk || !locationOk || !classOk {
+			return fmt.Errorf("unexpected storage header %#v", obj)
+		}
+		var sizeBuf [8]byte
+		if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+			return fmt.Errorf("storage %s: %w", key, err)
+		}
+		size := int(binary.LittleEndian.Uint64(sizeBuf[:]))
+		storage := l.opts.newStorage(storageClass, size, location)
+		if err := storage.SetFromFileWithSize(r, size); err != nil {
+			return fmt.Errorf("storage %s: %w", key, err)
+		}
+		l.objects[key] = storage
+	}
+
+	obj, err := l.unpickle(r)
+	if err != nil {
+		return err
+	}
+	var views []interface{}
+	switch v := obj.(type) {
+	case *types.List:
+		views = *v
+	case *types.Tuple:
+		views = *v
+	default:
+		return fmt.Errorf("unexpected storage views %#v", obj)
+	}
+	for _, view := range views {
+		if err := l.loadStorageView(view); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadStorageView makes a storage which is a view of numel elements of a
+// root storage, starting at offset. The view shares the data of the root.
+func (l *legacyTarLoader) loadStorageView(view interface{}) error {
+	tuple, ok := view.(*types.Tuple)
+	if !ok || tuple.Len() != 4 {
+		return fmt.Errorf("unexpected storage view %#v", view)
+	}
+	key, keyOk := persistentKey(tuple.Get(0))
+	rootKey, rootKeyOk := persistentKey(tuple.Get(1))
+	offset, offsetOk := toInt(tuple.Get(2))
+	numel, numelOk := toInt(tuple.Get(3))
+	if !keyOk || !rootKeyOk || !offsetOk || !numelOk {
+		return fmt.Errorf("unexpected storage view %#v", view)
+	}
+	root, ok := l.objects[rootKey].(StorageInterface)
+	if !ok {
+		return fmt.Errorf("storage view %s: root storage %s not found", key, rootKey)
+	}
+	data, err := storageData(root)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || numel < 0 || offset+numel > data.Len() {
+		return fmt.Errorf("storage view %s: elements %d to %d out of range "+
+			"for a storage of %d elements", key, offset, offset+numel, data.Len())
+	}
+	storage, err := newStorageWithData(root, data.Slice(offset, offset+numel).Interface())
+	if err != nil {
+		return err
+	}
+	l.objects[key] = storage
+	return nil
+}
+
+// loadTensors reads the "tensors" member: the number of tensors, then,
+// for each one, a (key, storage_key, tensor_type) tuple followed by the
+// number of dimensions, as a 4-byte integer padded to 8 bytes, the sizes,
+// the strides and the storage offset, as 8-byte integers.
+func (l *legacyTarLoader) loadTensors(r *bytes.Reader) error {
+	n, err := l.unpickleCount(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		obj, err := l.unpickle(r)
+		if err != nil {
+			return err
+		}
+		tuple, ok := obj.(*types.Tuple)
+		if !ok || tuple.Len() != 3 {
+			return fmt.Errorf("unexpected tensor header %#v", obj)
+		}
+		key, keyOk := persistentKey(tuple.Get(0))
+		if !keyOk {
+			return fmt.Errorf("unexpected tensor header %#v", obj)
+		}
+		var storage StorageInterface
+		if tuple.Get(1) != nil {
+			storageKey, _ := persistentKey(tuple.Get(1))
+			if storage, ok = l.objects[storageKey].(StorageInterface); !ok {
+				return fmt.Errorf("tensor %s: storage %v not found", key, tuple.Get(1))
+			}
+		}
+
+		var ndimBuf [8]byte
+		if _, err := io.ReadFull(r, ndimBuf[:]); err != nil {
+			return fmt.Errorf("tensor %s: %w", key, err)
+		}
+		ndim := int(int32(binary.LittleEndian.Uint32(ndimBuf[:4])))
+		if ndim < 0 || 2*ndim+1 > r.Len()/8 {
+			return fmt.Errorf("tensor %s: invalid number of dimensions %d", key, ndim)
+		}
+		values := make([]int64, 2*ndim+1)
+		if err := binary.Read(r, binary.LittleEndian, values); err != nil {
+			return fmt.Errorf("tensor %s: %w", key, err)
+		}
+		if err := l.counter.add(); err != nil {
+			return err
+		}
+		tensor := &Tensor{
+			Source:        storage,
+			StorageOffset: int(values[2*ndim]),
+			Size:          make([]int, ndim),
+			Stride:        make([]int, ndim),
+		}
+		for d := 0; d < ndim; d++ {
+			tensor.Size[d] = int(values[d])
+			tensor.Stride[d] = int(values[ndim+d])
+		}
+		l.objects[key] = tensor
+	}
+	return nil
+}
+
+func (l *legacyTarLoader) unpickleCount(r io.Reader) (int, error) {
+	obj, err := l.unpickle(r)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := toInt(obj)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("unexpected count %#v", obj)
+	}
+	return n, nil
+}
+
+// PersistentLoad resolves the persistent IDs of the "pickle" member: the
+// key of a tensor or a storage, or a tuple whose first item is the class
+// of a module, along with its source code.
+func (l *legacyTarLoader) PersistentLoad(savedId interface{}) (interface{}, error) {
+	if tuple, ok := savedId.(*types.Tuple); ok {
+		if tuple.Len() == 0 {
+			return nil, fmt.Errorf("PersistentLoad: unexpected empty tuple")
+		}
+		return tuple.Get(0), nil
+	}
+	key, ok := persistentKey(savedId)
+	if !ok {
+		return nil, fmt.Errorf("PersistentLoad: unexpected saved ID %#v", savedId)
+	}
+	obj, ok := l.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("PersistentLoad: object %s not found", key)
+	}
+	return obj, nil
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"io"
 	"testing"
+	"testing/iotest"
 )
 
 func TestLimitedBufferReader(t *testing.T) {
@@ -86,6 +87,19 @@ func TestLimitedBufferReader(t *testing.T) {
 		}
 		assertByteSliceEqual(t, rest, []byte{90, 91, 92})
 	})
+
+	t.Run("short reads", func(t *testing.T) {
+		input := []byte{11, 12, 21, 22, 31, 32, 41, 42, 51, 52}
+		r := iotest.OneByteReader(bytes.NewReader(input))
+		br := NewLimitedBufferReader(r, 5, 2, 3)
+		assertReadNextValue(t, br, []byte{11, 12})
+		assertReadNextValue(t, br, []byte{21, 22})
+		assertReadNextValue(t, br, []byte{31, 32})
+		assertReadNextValue(t, br, []byte{41, 42})
+		assertReadNextValue(t, br, []byte{51, 52})
+		assertNotHasNext(t, br)
+		assertReadNextEof(t, br)
+	})
 }
 
 func assertHasNext(t *testing.T, br *LimitedBufferReader) {
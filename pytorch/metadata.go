@@ -0,0 +1,93 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// maxMetadataRecordSize is the maximum size in bytes of the "version" and
+// "byteorder" records of a zip-based file which is read.
+const maxMetadataRecordSize = 64
+
+// Metadata describes how a file loaded by LoadWithMetadata was saved. Not
+// to be confused with the "_metadata" of a state dict.
+type Metadata struct {
+	// ProducerVersion is the content of the "version" record of a
+	// zip-based file, that is the version of the archive format written by
+	// torch.save, such as "3". It is empty for legacy files, and for the
+	// archives without that record.
+	ProducerVersion string
+	// ByteOrder is the byte order of the data of the storages. It is
+	// binary.BigEndian for the zip-based files whose "byteorder" record is
+	// "big", as written on big-endian hosts, whose data is converted while
+	// loading. It is binary.LittleEndian otherwise, including for the
+	// archives saved before the "byteorder" record was introduced, and for
+	// legacy files, which are always saved in little-endian order.
+	ByteOrder binary.ByteOrder
+}
+
+// LoadWithMetadata is like LoadWithOptions, but it also returns the
+// Metadata of the file.
+func LoadWithMetadata(filename string, opts LoadOptions) (interface{}, *Metadata, error) {
+	opts = opts.withDefaults()
+	metadata := &Metadata{ByteOrder: binary.LittleEndian}
+	opts.metadata = metadata
+	result, err := loadFile(filename, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, metadata, nil
+}
+
+// zipMetadata returns the Metadata of a zip-based file, from its records
+// by name.
+func zipMetadata(fileRecords map[string]*zip.File) (*Metadata, error) {
+	metadata := &Metadata{ByteOrder: binary.LittleEndian}
+	if file, ok := fileRecords["version"]; ok {
+		version, err := readMetadataRecord(file)
+		if err != nil {
+			return nil, err
+		}
+		metadata.ProducerVersion = version
+	}
+	if file, ok := fileRecords["byteorder"]; ok {
+		byteOrder, err := readMetadataRecord(file)
+		if err != nil {
+			return nil, err
+		}
+		switch byteOrder {
+		case "little":
+		case "big":
+			metadata.ByteOrder = binary.BigEndian
+		default:
+			return nil, fmt.Errorf("unsupported byte order %q", byteOrder)
+		}
+	}
+	return metadata, nil
+}
+
+// readMetadataRecord returns the content of a small text record of a zip
+// archive, without leading and trailing white space.
+func readMetadataRecord(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxMetadataRecordSize+1))
+	if err != nil {
+		return "", fmt.Errorf("zip record '%s': %w", file.Name, err)
+	}
+	if len(data) > maxMetadataRecordSize {
+		return "", fmt.Errorf("zip record '%s' is too large", file.Name)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"encoding/binary"
+	"path"
+	"testing"
+)
+
+func TestLoadWithMetadata(t *testing.T) {
+	for _, c := range []struct {
+		filename  string
+		version   string
+		byteOrder binary.ByteOrder
+	}{
+		{"synthetic_big_endian.pt", "3", binary.BigEndian},
+		{"synthetic_training_checkpoint.pt", "3", binary.LittleEndian},
+		{"tensor_float32_proto2_zip.pt", "2", binary.LittleEndian}, // no byteorder record
+		{"tensor_float32_proto2.pt", "", binary.LittleEndian},      // legacy
+	} {
+		t.Run(c.filename, func(t *testing.T) {
+			_, metadata, err := LoadWithMetadata(path.Join("testdata", c.filename), LoadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata.ProducerVersion != c.version {
+				t.Errorf("expected version %q, actual %q", c.version, metadata.ProducerVersion)
+			}
+			if metadata.ByteOrder != c.byteOrder {
+				t.Errorf("expected byte order %v, actual %v", c.byteOrder, metadata.ByteOrder)
+			}
+		})
+	}
+}
+
+func TestLoadBigEndian(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_big_endian.pt")
+	check := func(t *testing.T, tensors map[string]*Tensor) {
+		t.Helper()
+		assertTensorFloat32Data(t, tensors["weight"], []float32{1.5, -2, 3.25})
+		assertTensorFloat32Data(t, tensors["half"], []float32{0.5, -1})
+		steps, err := tensors["steps"].GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertInt64SliceEqual(t, steps.([]int64), []int64{1, -2})
+		mask, err := tensors["mask"].GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUInt8SliceEqual(t, mask.([]uint8), []uint8{1, 0, 1})
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		check(t, loadTensorsWithOptions(t, filename, LoadOptions{}))
+	})
+	t.Run("UseMmap", func(t *testing.T) {
+		check(t, loadTensorsWithOptions(t, filename, LoadOptions{UseMmap: true}))
+	})
+	t.Run("Lazy", func(t *testing.T) {
+		check(t, loadTensorsWithOptions(t, filename, LoadOptions{Lazy: true}))
+	})
+	t.Run("LoadAsync", func(t *testing.T) {
+		result, done := LoadAsync(filename)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		check(t, tensorsOf(t, result))
+	})
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// errMmapUnsupported is returned by mapFile on the platforms where memory
+// mapping is not supported.
+var errMmapUnsupported = errors.New("memory mapping not supported")
+
+// fileMapping is the content of a whole file, either mapped in memory,
+// privately, so that changing it does not change the file, or, where
+// mapping is not possible, read into it.
+type fileMapping struct {
+	data   []byte
+	mapped bool
+}
+
+// openFileMapping maps the named file in memory, falling back to reading
+// it, if mapping is not supported or fails.
+func openFileMapping(filename string) (*fileMapping, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("file %s too large to be mapped", filename)
+	}
+	if size > 0 {
+		if data, err := mapFile(f, int(size)); err == nil {
+			return &fileMapping{data: data, mapped: true}, nil
+		}
+	}
+	return readFileMapping(f, int(size))
+}
+
+// readFileMapping reads the whole content of f, of the given size, in
+// memory.
+func readFileMapping(f *os.File, size int) (*fileMapping, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return &fileMapping{data: data}, nil
+}
+
+// Close releases the mapping. Its data must not be accessed anymore.
+func (m *fileMapping) Close() error {
+	data := m.data
+	m.data = nil
+	if !m.mapped {
+		return nil
+	}
+	return unmapFile(data)
+}
+
+// MappedFile is an object loaded by LoadMapped, whose storages may be
+// views of the memory mapping of its file.
+type MappedFile struct {
+	// Object is the loaded object, as returned by Load.
+	Object  interface{}
+	mapping *fileMapping
+}
+
+// LoadMapped is like LoadWithOptions, but the data of the storages is not
+// copied from the file: it is a view of a memory mapping of the whole
+// file, which is released by Close. This halves the memory used for very
+// large files, and leaves to the operating system the reading of the file,
+// as the data is accessed.
+//
+// Only the uncompressed records of zip-based files, as saved by PyTorch,
+// and the data of legacy files, not in the tar format, can be used in
+// place, if aligned to the size of the elements, as PyTorch aligns the
+// records but not the legacy data. It is so for the storages whose Data
+// holds the elements as they are stored, in the byte order of the
+// machine: for example, the elements of
+// FloatStorage and UntypedStorage, but not those of HalfStorage, which
+// are converted to float32, nor those of BoolStorage. The other storages
+// are copied, as by Load. Changing the data of a view is allowed, and only
+// creates a private copy of the changed pages.
+//
+// Memory mapping is supported on Linux and, with Go 1.17 or later, on
+// Windows; elsewhere, the file is read in memory at once, and the
+// storages are views of that copy. opts.Lazy and opts.UseMmap have no
+// effect.
+func LoadMapped(filename string, opts LoadOptions) (*MappedFile, error) {
+	m, err := openFileMapping(filename)
+	if err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	opts.lazyFile = ""
+	opts.mapped = m.data
+
+	r := bytes.NewReader(m.data)
+	result, err := loadZipReader(r, int64(len(m.data)), m.data, opts)
+	if errors.Is(err, zip.ErrFormat) || errors.Is(err, ErrNotTorchArchive) {
+		result, err = loadLegacy(bytes.NewReader(m.data), opts)
+	}
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	return &MappedFile{Object: result, mapping: m}, nil
+}
+
+// Close releases the memory mapping of the file. The data of the storages
+// which are views of it must not be accessed anymore.
+func (f *MappedFile) Close() error {
+	if f.mapping == nil {
+		return nil
+	}
+	m := f.mapping
+	f.mapping = nil
+	return m.Close()
+}
+
+// hostByteOrder is the byte order of the machine, in which the storages
+// hold their elements.
+var hostByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// storageViewElementSize returns the size in bytes of the elements of a
+// storage whose Data can be a view of the stored elements, or false for
+// the storages whose data must be converted.
+func storageViewElementSize(s StorageInterface) (int, bool) {
+	switch s.(type) {
+	case *FloatStorage, *IntStorage, *Uint32Storage, *QInt32Storage:
+		return 4, true
+	case *DoubleStorage, *LongStorage, *Uint64Storage, *ComplexFloatStorage:
+		return 8, true
+	case *ComplexDoubleStorage:
+		return 16, true
+	case *ShortStorage, *Uint16Storage:
+		return 2, true
+	case *CharStorage, *ByteStorage, *QInt8Storage, *QUInt8Storage, *UntypedStorage:
+		return 1, true
+	default:
+		return 0, false
+	}
+}
+
+// setStorageView sets the Data of a storage of size elements to a view of
+// data, which holds them in the given byte order, without copying it. It
+// returns false, leaving the storage unchanged, if the elements cannot be
+// used in place: because of the storage type, the byte order, or the
+// alignment of data.
+func setStorageView(s StorageInterface, data []byte, size int, byteOrder binary.ByteOrder) bool {
+	elementSize, ok := storageViewElementSize(s)
+	if !ok || (elementSize > 1 && byteOrder != hostByteOrder) || len(data) < size*elementSize {
+		return false
+	}
+	field, err := storageDataField(s)
+	if err != nil {
+		return false
+	}
+	if size == 0 {
+		field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+		return true
+	}
+	ptr := unsafe.Pointer(&data[0])
+	if uintptr(ptr)%uintptr(field.Type().Elem().Align()) != 0 {
+		return false
+	}
+	view := reflect.New(field.Type())
+	header := (*reflect.SliceHeader)(unsafe.Pointer(view.Pointer()))
+	header.Data = uintptr(ptr)
+	header.Len = size
+	header.Cap = size
+	field.Set(view.Elem())
+	return true
+}
+
+// storageMemory returns a view of the memory of the elements of a storage
+// as the bytes they are stored as, without copying them, or false if the
+// elements are not held in memory as they are stored: because of the
+// storage type, or the byte order of the machine.
+func storageMemory(s StorageInterface) ([]byte, bool) {
+	elementSize, ok := storageViewElementSize(s)
+	if !ok || (elementSize > 1 && hostByteOrder != binary.LittleEndian) {
+		return nil, false
+	}
+	field, err := storageDataField(s)
+	if err != nil {
+		return nil, false
+	}
+	if field.Len() == 0 {
+		return []byte{}, true
+	}
+	var data []byte
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&data))
+	header.Data = field.Pointer()
+	header.Len = field.Len() * elementSize
+	header.Cap = field.Len() * elementSize
+	return data, true
+}
+
+// setLegacyStorageViews sets the data of the storages of a legacy file,
+// with the given keys, from r, which reads the mapped content of the file
+// right after the pickle of the keys: each storage is a view of the file,
+// when possible, or else is read as by SetFromFile.
+func setLegacyStorageViews(
+	r *bytes.Reader,
+	mapped []byte,
+	storageKeys []string,
+	storages map[string]StorageInterface,
+) error {
+	for _, key := range storageKeys {
+		storage, ok := storages[key]
+		if !ok {
+			return fmt.Errorf("storage object not found for key '%s'", key)
+		}
+		var sizeBuf [8]byte
+		if _, err := io.ReadFull(r, sizeBuf[:]); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		size := binary.LittleEndian.Uint64(sizeBuf[:])
+		offset := r.Size() - int64(r.Len())
+		elementSize, ok := storageViewElementSize(storage)
+		if !ok || size > uint64(r.Len()/elementSize) {
+			if err := storage.SetFromFileWithSize(r, int(size)); err != nil {
+				return err
+			}
+			continue
+		}
+		n := int64(size) * int64(elementSize)
+		if !setStorageView(storage, mapped[offset:offset+n], int(size), binary.LittleEndian) {
+			if err := storage.SetFromFileWithSize(r, int(size)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := r.Seek(n, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
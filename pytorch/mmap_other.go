@@ -0,0 +1,22 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !(windows && go1.17)
+// +build !linux
+// +build !windows !go1.17
+
+package pytorch
+
+import "os"
+
+// mapFile always fails: memory mapping is not supported on this platform,
+// nor on Windows before Go 1.17, and files are read in memory instead.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+// unmapFile is never called, since mapFile always fails.
+func unmapFile(data []byte) error {
+	return nil
+}
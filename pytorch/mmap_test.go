@@ -0,0 +1,157 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+	"testing"
+	"unsafe"
+)
+
+func TestUseMmap(t *testing.T) {
+	for _, filename := range []string{
+		"synthetic_training_checkpoint.pt",
+		"synthetic_untyped_storage_v3.pt",
+		"tensor_float16_proto2_zip.pt",
+		"tensor_float32_proto2.pt", // legacy, not mapped
+	} {
+		t.Run(filename, func(t *testing.T) {
+			filename := path.Join("testdata", filename)
+			expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+			actual := loadTensorsWithOptions(t, filename, LoadOptions{UseMmap: true})
+			if len(actual) != len(expected) {
+				t.Fatalf("expected %d tensors, actual %d", len(expected), len(actual))
+			}
+			for name, tensor := range expected {
+				assertTensorsEqual(t, actual[name], tensor)
+			}
+		})
+	}
+
+	_, err := LoadWithOptions(path.Join("testdata", "synthetic_truncated_storage.pt"),
+		LoadOptions{UseMmap: true})
+	assertErrorContains(t, err, "requires 16 bytes, but its zip record has only 12 bytes")
+}
+
+// TestUseMmapFallback loads the storages from the content of the file read
+// in memory, as done on the platforms without memory mapping.
+func TestUseMmapFallback(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	expected, err := LoadStateDict(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := readFileMapping(f, int(info.Size()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	result, _, err := unpickleZipFile(&r.Reader, m.data, LoadOptions{}.withDefaults(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, _, err := stateDictTensors(result, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tensor := range expected {
+		assertTensorsEqual(t, actual[name], tensor)
+	}
+}
+
+// loadTensorsWithOptions loads a file holding either a single tensor,
+// returned with an empty name, or a state dict.
+func loadTensorsWithOptions(t *testing.T, filename string, opts LoadOptions) map[string]*Tensor {
+	t.Helper()
+	result, err := LoadWithOptions(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tensorsOf(t, result)
+}
+
+// tensorsOf returns the tensors of a loaded state dict, or the loaded
+// tensor itself with the "" key.
+func tensorsOf(t *testing.T, result interface{}) map[string]*Tensor {
+	t.Helper()
+	if tensor, ok := result.(*Tensor); ok {
+		return map[string]*Tensor{"": tensor}
+	}
+	tensors, _, err := stateDictTensors(result, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tensors
+}
+
+func TestLoadMapped(t *testing.T) {
+	for _, filename := range []string{
+		"synthetic_training_checkpoint.pt",
+		"synthetic_untyped_storage_v3.pt",
+		"tensor_float16_proto2_zip.pt", // converted, not a view
+		"tensor_float32_proto2_zip.pt",
+		"tensor_float32_proto2.pt", // legacy
+		"tensor_int64_proto2.pt",
+	} {
+		t.Run(filename, func(t *testing.T) {
+			filename := path.Join("testdata", filename)
+			expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+			mf, err := LoadMapped(filename, LoadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mf.Close()
+			actual := tensorsOf(t, mf.Object)
+			if len(actual) != len(expected) {
+				t.Fatalf("expected %d tensors, actual %d", len(expected), len(actual))
+			}
+			for name, tensor := range expected {
+				assertTensorsEqual(t, actual[name], tensor)
+			}
+		})
+	}
+
+	filename := path.Join("testdata", "tensor_float32_proto2_zip.pt")
+	expected := loadTensorFromFile(t, "tensor_float32_proto2_zip.pt")
+	mf, err := LoadMapped(filename, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := mf.Object.(*Tensor).Source.(*FloatStorage)
+	start := uintptr(unsafe.Pointer(&mf.mapping.data[0]))
+	if p := uintptr(unsafe.Pointer(&storage.Data[0])); p < start || p >= start+uintptr(len(mf.mapping.data)) {
+		t.Error("expected the data of the storage to be a view of the file")
+	}
+	// the changes are not written to the file
+	storage.Data[0]++
+	if err := mf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mf.Close(); err != nil {
+		t.Errorf("expected no error closing again, actual %v", err)
+	}
+	assertTensorsEqual(t, loadTensorFromFile(t, "tensor_float32_proto2_zip.pt"), expected)
+
+	_, err = LoadMapped(path.Join("testdata", "synthetic_truncated_storage.pt"), LoadOptions{})
+	assertErrorContains(t, err, "requires 16 bytes, but its zip record has only 12 bytes")
+}
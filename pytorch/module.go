@@ -0,0 +1,122 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// ModuleClass represents a subclass of "torch.nn.Module", whose instances
+// are restored as *Module values, for example when loading a whole model
+// saved with "torch.save(model)".
+//
+// Classes of the "torch.nn.modules" package are resolved as ModuleClass
+// automatically. Custom module classes, which no loader can know about,
+// can be resolved likewise by a FindClass function of the Unpickler (see
+// LoadOptions.NewUnpickler).
+type ModuleClass struct {
+	Class *types.GenericClass
+}
+
+var _ types.PyNewable = &ModuleClass{}
+
+// NewModuleClass returns a new ModuleClass for the given Python module and
+// class name.
+func NewModuleClass(module, name string) *ModuleClass {
+	return &ModuleClass{Class: types.NewGenericClass(module, name)}
+}
+
+// PyNew returns a new empty Module of this class.
+func (c *ModuleClass) PyNew(_ ...interface{}) (interface{}, error) {
+	return &Module{Class: c.Class, Attributes: types.NewDict()}, nil
+}
+
+// Module represents an instance of "torch.nn.Module", or of any of its
+// subclasses.
+type Module struct {
+	// Class is the Python class of the module.
+	Class *types.GenericClass
+	// Attributes is the "__dict__" of the module, in serialized order. It
+	// includes, among others, its "_parameters", "_buffers" and
+	// "_modules" (the submodules).
+	Attributes *types.Dict
+}
+
+var _ types.PyDictSettable = &Module{}
+
+// PyDictSet sets an attribute of the module.
+func (m *Module) PyDictSet(key, value interface{}) error {
+	if _, ok := key.(string); !ok {
+		return fmt.Errorf("Module.PyDictSet() requires string key: %#v", key)
+	}
+	m.Attributes.Set(key, value)
+	return nil
+}
+
+// ParameterNames returns the names of all the parameters of the module and
+// of its submodules, in the same order of Python "named_parameters()". The
+// names of the parameters of submodules are prefixed with the names of the
+// submodules, as in "encoder.layer.weight".
+//
+// As in Python, a parameter shared by more modules is reported only once,
+// and parameters set to None are skipped.
+func (m *Module) ParameterNames() []string {
+	return m.memberNames("_parameters")
+}
+
+// BufferNames returns the names of all the buffers of the module and of
+// its submodules, in the same order of Python "named_buffers()", like
+// ParameterNames.
+func (m *Module) BufferNames() []string {
+	return m.memberNames("_buffers")
+}
+
+// memberNames returns the prefixed names of the members found in the given
+// dictionary attribute of the module and of its submodules, recursively.
+func (m *Module) memberNames(attr string) []string {
+	var names []string
+	seen := make(map[*Tensor]bool)
+	m.walk("", make(map[*Module]bool), func(prefix string, module *Module) {
+		members, _ := module.Attributes.Get(attr)
+		entries, _ := dictEntries(members)
+		for _, entry := range entries {
+			name, ok := entry.Key.(string)
+			if !ok || entry.Value == nil {
+				continue
+			}
+			// only the tensors are deduplicated: the other values may not
+			// even be comparable
+			if tensor, ok := entry.Value.(*Tensor); ok {
+				if seen[tensor] {
+					continue
+				}
+				seen[tensor] = true
+			}
+			names = append(names, prefix+name)
+		}
+	})
+	return names
+}
+
+// walk calls fn for the module and for each of its submodules, in
+// pre-order, with the prefix of their members' names. As in Python
+// "named_modules()", a module shared by more parents is visited only once.
+func (m *Module) walk(prefix string, visited map[*Module]bool, fn func(prefix string, module *Module)) {
+	if visited[m] {
+		return
+	}
+	visited[m] = true
+	fn(prefix, m)
+	modules, _ := m.Attributes.Get("_modules")
+	entries, _ := dictEntries(modules)
+	for _, entry := range entries {
+		name, nameOk := entry.Key.(string)
+		sub, subOk := entry.Value.(*Module)
+		if nameOk && subOk {
+			sub.walk(prefix+name+".", visited, fn)
+		}
+	}
+}
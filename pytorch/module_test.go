@@ -0,0 +1,134 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestModuleNames(t *testing.T) {
+	result, err := Load(path.Join("testdata", "synthetic_whole_module.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, ok := result.(*Module)
+	if !ok {
+		t.Fatalf("expected *Module, got %T", result)
+	}
+	if module.Class.Module != "torch.nn.modules.container" || module.Class.Name != "Sequential" {
+		t.Errorf("unexpected class %#v", module.Class)
+	}
+
+	// The bias of "fc" is None; the order is not alphabetical.
+	expectedParameters := []string{"fc.weight", "bn.weight", "bn.bias"}
+	if actual := module.ParameterNames(); !reflect.DeepEqual(actual, expectedParameters) {
+		t.Errorf("expected parameters %v, actual %v", expectedParameters, actual)
+	}
+	expectedBuffers := []string{"bn.running_mean", "bn.running_var", "bn.num_batches_tracked"}
+	if actual := module.BufferNames(); !reflect.DeepEqual(actual, expectedBuffers) {
+		t.Errorf("expected buffers %v, actual %v", expectedBuffers, actual)
+	}
+}
+
+func TestLegacyFullModel(t *testing.T) {
+	// The classes of the modules are saved as "module" persistent IDs,
+	// along with their source, which is not checked.
+	result, err := Load(path.Join("testdata", "synthetic_legacy_full_model.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, ok := result.(*Module)
+	if !ok {
+		t.Fatalf("expected *Module, got %T", result)
+	}
+	if module.Class.Module != "torch.nn.modules.container" || module.Class.Name != "Sequential" {
+		t.Errorf("unexpected class %#v", module.Class)
+	}
+	expected := []string{"0.weight", "0.bias", "1.weight"}
+	if actual := module.ParameterNames(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected parameters %v, actual %v", expected, actual)
+	}
+	for storage, paths := range StorageGroups(module) {
+		if reflect.DeepEqual(paths, []string{"1.weight"}) {
+			assertFloat32SliceEqual(t, storage.(*FloatStorage).Data, []float32{3}, 0)
+			return
+		}
+	}
+	t.Error("storage of 1.weight not found")
+}
+
+func TestParametrizedModule(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_parametrized_module.pt")
+
+	// The parametrization itself is a user defined module.
+	_, err := Load(filename)
+	assertErrorContains(t, err, "class not found: mymodels Symmetric")
+
+	result, err := LoadWithOptions(filename, LoadOptions{AllowUnknownClasses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, ok := result.(*Module)
+	if !ok {
+		t.Fatalf("expected *Module, got %T", result)
+	}
+	expected := []string{"fc.bias", "fc.parametrizations.weight.original"}
+	if actual := module.ParameterNames(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected parameters %v, actual %v", expected, actual)
+	}
+
+	var original *FloatStorage
+	for storage, paths := range StorageGroups(module) {
+		if reflect.DeepEqual(paths, []string{"fc.parametrizations.weight.original"}) {
+			original, _ = storage.(*FloatStorage)
+		}
+	}
+	if original == nil {
+		t.Fatal("original weight not found")
+	}
+	assertFloat32SliceEqual(t, original.Data, []float32{1, 2, 3, 4}, 0)
+}
+
+func TestModuleSharedParameter(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2}, 2)
+	newModule := func(parameters ...interface{}) *Module {
+		m, _ := (&ModuleClass{}).PyNew()
+		module := m.(*Module)
+		module.Attributes.Set("_parameters", dictOf(parameters...))
+		return module
+	}
+	embed := newModule("weight", weight)
+	decoder := newModule("weight", weight)
+	root := newModule()
+	root.Attributes.Set("_modules", dictOf("embed", embed, "decoder", decoder, "tied", embed))
+
+	expected := []string{"embed.weight"}
+	if actual := root.ParameterNames(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestModuleUnhashableMember(t *testing.T) {
+	m, _ := (&ModuleClass{}).PyNew()
+	module := m.(*Module)
+	module.Attributes.Set("_buffers", dictOf("steps", []interface{}{1, 2}, "mask", map[string]int{}))
+	expected := []string{"steps", "mask"}
+	if actual := module.BufferNames(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+}
+
+// dictOf returns a new *types.Dict with the given alternating keys and
+// values.
+func dictOf(keysAndValues ...interface{}) *types.Dict {
+	d := types.NewDict()
+	for i := 0; i < len(keysAndValues); i += 2 {
+		d.Set(keysAndValues[i], keysAndValues[i+1])
+	}
+	return d
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// npyMagic is the magic string of version 1.0 of the ".npy" format.
+const npyMagic = "\x93NUMPY\x01\x00"
+
+// npyAlignment is the alignment of the data of a ".npy" file, the same
+// used by NumPy.
+const npyAlignment = 64
+
+// npyDescrs maps each data type to the NumPy array-protocol type string
+// of its little-endian encoding.
+var npyDescrs = map[*Dtype]string{
+	Float16: "<f2",
+	Float32: "<f4",
+	Float64: "<f8",
+	Int8:    "|i1",
+	Int16:   "<i2",
+	Int32:   "<i4",
+	Int64:   "<i8",
+	Uint8:   "|u1",
+	Uint16:  "<u2",
+	Uint32:  "<u4",
+	Uint64:  "<u8",
+	Bool:    "|b1",
+
+	Complex64:  "<c8",
+	Complex128: "<c16",
+}
+
+// WriteNpy writes the tensor to w in the ".npy" format of NumPy (version
+// 1.0), as a C-contiguous array with the same data type and shape. The
+// output can be read by "numpy.load", even with allow_pickle=False.
+func WriteNpy(w io.Writer, t *Tensor) error {
+	header, err := npyHeader(t)
+	if err != nil {
+		return err
+	}
+	data, err := t.Bytes()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// SaveNpz writes the given tensors, such as a loaded state dict, to the
+// named file, as an uncompressed ".npz" archive, like "numpy.savez": each
+// tensor is a ".npy" record named after its key, which is therefore the
+// key of the array in the result of "numpy.load". The records are
+// written in sorted order.
+func SaveNpz(filename string, tensors map[string]*Tensor) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeNpz(f, tensors); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeNpz(w io.Writer, tensors map[string]*Tensor) error {
+	keys := make([]string, 0, len(tensors))
+	for key := range tensors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	zw := zip.NewWriter(w)
+	for _, key := range keys {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:   key + ".npy",
+			Method: zip.Store,
+		})
+		if err != nil {
+			return err
+		}
+		if err := WriteNpy(fw, tensors[key]); err != nil {
+			return fmt.Errorf("SaveNpz: %q: %w", key, err)
+		}
+	}
+	return zw.Close()
+}
+
+// npyHeader returns the magic string and the header of a ".npy" file
+// holding the tensor, padded so that the data which follows is aligned.
+func npyHeader(t *Tensor) (string, error) {
+	descr, ok := npyDescrs[t.Dtype()]
+	if !ok {
+		return "", fmt.Errorf("WriteNpy: unsupported storage %T", t.Source)
+	}
+	dims := make([]string, len(t.Size))
+	for i, s := range t.Size {
+		dims[i] = strconv.Itoa(s)
+	}
+	shape := strings.Join(dims, ", ")
+	if len(dims) == 1 {
+		shape += ","
+	}
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }",
+		descr, shape)
+
+	// The header is terminated by a newline, and padded with spaces.
+	headerLen := len(dict) + 1
+	headerLen += npyAlignment - (len(npyMagic)+2+headerLen)%npyAlignment
+	if headerLen > 0xffff {
+		return "", fmt.Errorf("WriteNpy: header too long for shape %v", t.Size)
+	}
+	var b strings.Builder
+	b.WriteString(npyMagic)
+	var hl [2]byte
+	binary.LittleEndian.PutUint16(hl[:], uint16(headerLen))
+	b.Write(hl[:])
+	b.WriteString(dict)
+	b.WriteString(strings.Repeat(" ", headerLen-len(dict)-1))
+	b.WriteByte('\n')
+	return b.String(), nil
+}
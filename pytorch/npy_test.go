@@ -0,0 +1,97 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestWriteNpy(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteNpy(&buf, newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)); err != nil {
+		t.Fatal(err)
+	}
+	// numpy.save of numpy.arange(1, 7, dtype='<f4').reshape(2, 3), without
+	// the extra spaces reserved by newer versions for growing the array
+	dict := "{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }"
+	expected := "\x93NUMPY\x01\x00\x76\x00" + dict + strings.Repeat(" ", 58) + "\n"
+	if actual := buf.String()[:128]; actual != expected {
+		t.Errorf("expected header %q, actual %q", expected, actual)
+	}
+	if buf.Len() != 128+24 {
+		t.Errorf("expected 152 bytes, actual %d", buf.Len())
+	}
+}
+
+func TestSaveNpz(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+	tensors := map[string]*Tensor{
+		// transposed view of weight
+		"fc.weight": {Source: weight.Source, Size: []int{3, 2}, Stride: []int{1, 3}},
+		"fc.bias": {
+			Source: &LongStorage{BaseStorage: BaseStorage{Size: 1}, Data: []int64{-7}},
+			Size:   []int{1},
+			Stride: []int{1},
+		},
+		"step": {
+			Source: &BoolStorage{BaseStorage: BaseStorage{Size: 1}, Data: []bool{true}},
+			Size:   []int{},
+			Stride: []int{},
+		},
+	}
+	filename := path.Join(t.TempDir(), "model.npz")
+	if err := SaveNpz(filename, tensors); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.File) != 3 {
+		t.Fatalf("expected 3 records, actual %d", len(r.File))
+	}
+	expectedHeaders := map[string]string{
+		"fc.bias.npy":   "{'descr': '<i8', 'fortran_order': False, 'shape': (1,), }",
+		"fc.weight.npy": "{'descr': '<f4', 'fortran_order': False, 'shape': (3, 2), }",
+		"step.npy":      "{'descr': '|b1', 'fortran_order': False, 'shape': (), }",
+	}
+	for _, f := range r.File {
+		if f.Method != zip.Store {
+			t.Errorf("%s: expected an uncompressed record", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		headerLen := int(content[8]) | int(content[9])<<8
+		if !strings.HasPrefix(string(content), npyMagic) || (10+headerLen)%64 != 0 {
+			t.Fatalf("%s: invalid header %q", f.Name, content)
+		}
+		header := strings.TrimRight(string(content[10:10+headerLen]), " \n")
+		if header != expectedHeaders[f.Name] {
+			t.Errorf("%s: expected header %q, actual %q", f.Name, expectedHeaders[f.Name], header)
+		}
+		expectedData, err := tensors[strings.TrimSuffix(f.Name, ".npy")].Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data := content[10+headerLen:]; !bytes.Equal(data, expectedData) {
+			t.Errorf("%s: expected data %v, actual %v", f.Name, expectedData, data)
+		}
+	}
+}
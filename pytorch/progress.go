@@ -0,0 +1,120 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// LoadWithContext is like LoadWithOptions, but loading fails with the
+// error of ctx as soon as it is done, for example to cancel the loading
+// of a large file, or to limit its duration. It is checked at each read
+// from the file, and before each storage is loaded.
+func LoadWithContext(ctx context.Context, filename string, opts LoadOptions) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	opts.ctx = ctx
+	return loadFile(filename, opts)
+}
+
+// loadFileReader reads a file being loaded, stopping once the context of
+// the options is done, and reporting the bytes read to their Progress
+// function.
+type loadFileReader struct {
+	f        *os.File
+	size     int64
+	ctx      context.Context
+	progress func(bytesRead, totalBytes int64)
+	// mu guards bytesRead and the calls to progress, since the file may
+	// be read concurrently (see LoadOptions.Concurrency).
+	mu        sync.Mutex
+	bytesRead int64
+}
+
+// openLoadFile opens the named file for loading it with opts, returning
+// its size too.
+func openLoadFile(filename string, opts LoadOptions) (*loadFileReader, int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	r := &loadFileReader{
+		f:        f,
+		size:     info.Size(),
+		ctx:      opts.ctx,
+		progress: opts.Progress,
+	}
+	return r, r.size, nil
+}
+
+func (r *loadFileReader) Read(p []byte) (int, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	n, err := r.f.Read(p)
+	r.add(n)
+	return n, err
+}
+
+func (r *loadFileReader) ReadAt(p []byte, off int64) (int, error) {
+	if err := r.check(); err != nil {
+		return 0, err
+	}
+	n, err := r.f.ReadAt(p, off)
+	r.add(n)
+	return n, err
+}
+
+func (r *loadFileReader) Seek(offset int64, whence int) (int64, error) {
+	return r.f.Seek(offset, whence)
+}
+
+func (r *loadFileReader) Close() error {
+	return r.f.Close()
+}
+
+// check returns the error of the context, if it is done.
+func (r *loadFileReader) check() error {
+	if r.ctx == nil {
+		return nil
+	}
+	return r.ctx.Err()
+}
+
+// add reports n more bytes read. The parts of the file read more than
+// once, such as the headers of the zip records, are counted again, so the
+// count is limited to the size of the file.
+func (r *loadFileReader) add(n int) {
+	if r.progress == nil || n == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytesRead += int64(n)
+	if r.bytesRead > r.size {
+		r.bytesRead = r.size
+	}
+	r.progress(r.bytesRead, r.size)
+}
+
+// done reports the whole file as read, once it is loaded.
+func (r *loadFileReader) done() {
+	if r.progress == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytesRead = r.size
+	r.progress(r.size, r.size)
+}
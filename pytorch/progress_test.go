@@ -0,0 +1,84 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	for _, filename := range []string{
+		"synthetic_training_checkpoint.pt",
+		"tensor_float32_proto2.pt", // legacy
+		"synthetic_legacy_tar.pt",
+	} {
+		for _, concurrency := range []int{0, 4} {
+			filename := path.Join("testdata", filename)
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var calls int
+			var last int64
+			opts := LoadOptions{
+				Concurrency: concurrency,
+				Progress: func(bytesRead, totalBytes int64) {
+					calls++
+					if bytesRead < last || bytesRead > totalBytes || totalBytes != info.Size() {
+						t.Errorf("%s: unexpected progress %d of %d, after %d", filename, bytesRead, totalBytes, last)
+					}
+					last = bytesRead
+				},
+			}
+			expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+			actual := loadTensorsWithOptions(t, filename, opts)
+			for name, tensor := range expected {
+				assertTensorsEqual(t, actual[name], tensor)
+			}
+			if calls < 2 || last != info.Size() {
+				t.Errorf("%s: expected the whole file to be read, actual %d bytes in %d calls", filename, last, calls)
+			}
+		}
+	}
+}
+
+func TestLoadWithContext(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	result, err := LoadWithContext(context.Background(), filename, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+	for name, tensor := range tensorsOf(t, result) {
+		assertTensorsEqual(t, tensor, expected[name])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := LoadWithContext(ctx, filename, LoadOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, actual %v", err)
+	}
+
+	// cancelled while loading
+	for _, filename := range []string{
+		"synthetic_training_checkpoint.pt",
+		"tensor_float32_proto2.pt",
+	} {
+		for _, opts := range []LoadOptions{{}, {Concurrency: 4}, {UseMmap: true}} {
+			ctx, cancel := context.WithCancel(context.Background())
+			opts.Progress = func(bytesRead, totalBytes int64) {
+				cancel()
+			}
+			_, err := LoadWithContext(ctx, path.Join("testdata", filename), opts)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: expected context.Canceled, actual %v", filename, err)
+			}
+		}
+	}
+}
@@ -7,71 +7,587 @@ package pytorch
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"github.com/nlpodyssey/gopickle/numpy"
 	"github.com/nlpodyssey/gopickle/pickle"
 	"github.com/nlpodyssey/gopickle/types"
 	"io"
 	"math/big"
-	"os"
 	"path"
+	"strconv"
+	"strings"
 )
 
 const hexMagicNumber = "1950a86a20f9469cfc6c"
 const protocolVersion = 1001
 
+// defaultStorageReadBufferSize is the default value of
+// LoadOptions.StorageReadBufferSize.
+const defaultStorageReadBufferSize = 1 << 20
+
 var ErrInvalidMagicNumber = errors.New("invalid pytorch magic number")
-var ErrInvalidProtocolVersion = errors.New("invalid pytorch protocol version")
+
+// ErrInvalidProtocolVersion is returned when the serialization protocol
+// version of a legacy file, which follows the magic number, is not the
+// one of PyTorch (1001). Not to be confused with ErrUnsupportedProtocol.
+var ErrInvalidProtocolVersion = errors.New("invalid pytorch serialization protocol version")
+
+// ErrUnsupportedProtocol is returned when any of the pickles of a file
+// uses a pickle protocol which is not supported by the pickle package.
+// It is the same as pickle.ErrUnsupportedProtocol.
+var ErrUnsupportedProtocol = pickle.ErrUnsupportedProtocol
+
+// ErrTooManyTensors is returned when loading a file which holds more
+// tensors than LoadOptions.MaxTensors.
+var ErrTooManyTensors = errors.New("too many tensors")
+
+// ErrNotTorchArchive is returned when loading a valid zip file which is
+// not a PyTorch archive, because it has no data.pkl record.
+var ErrNotTorchArchive = errors.New("zip file is not a PyTorch archive")
 
 func Load(filename string) (interface{}, error) {
-	newUnpickler := func(r io.Reader) pickle.Unpickler {
-		return pickle.NewUnpickler(r)
+	return LoadWithOptions(filename, LoadOptions{})
+}
+
+// LoadOptions allows to customize the loading of PyTorch files. The zero
+// value is valid, and provides the same behavior of Load.
+type LoadOptions struct {
+	// NewUnpickler, if not nil, is used to create new customized
+	// pickle.Unpickler instances, as in LoadWithUnpickler.
+	NewUnpickler func(r io.Reader) pickle.Unpickler
+	// NormalizeKeys, if true, makes LoadStateDict accept the keys of state
+	// dicts saved under Python 2, which may be loaded as types.Bytes
+	// values, or as strings decoded as latin-1, converting them to Go
+	// strings.
+	NormalizeKeys bool
+	// StorageReadBufferSize is the size in bytes of the buffer used when
+	// reading the data of the storages. A larger buffer may improve the
+	// throughput on fast devices, while a smaller one limits the memory
+	// usage. If zero, a default of 1 MiB is used.
+	StorageReadBufferSize int
+	// MaxTensors, if positive, is the maximum number of tensors which can
+	// be rebuilt while loading a file: loading fails with
+	// ErrTooManyTensors as soon as the limit is exceeded. It protects from
+	// malicious files declaring a huge number of tiny tensors. If zero,
+	// the number of tensors is not limited.
+	MaxTensors int
+	// UseMmap, if true, makes the storages of zip-based files be read from
+	// a private memory mapping of the whole file, instead of through the
+	// zip reader, avoiding a copy for each uncompressed record, as the
+	// records saved by PyTorch are. The data is still copied into the
+	// storages, so the mapping is released before returning: LoadMapped
+	// avoids this copy too. Memory mapping is supported on Linux and,
+	// with Go 1.17 or later, on Windows; elsewhere, the file is read in
+	// memory at once instead. It has no effect on legacy files. See also
+	// LoadAsyncWithOptions.
+	UseMmap bool
+	// Concurrency, if greater than 1, is the number of goroutines reading
+	// the data of the storages of zip-based files in parallel, each from
+	// its own record, which can make loading much faster on fast devices,
+	// such as NVMe drives. The storages are read once the whole file is
+	// unpickled, and all of them are complete when loading returns, as
+	// when they are read one after the other. It has no effect on legacy
+	// files, nor with Lazy.
+	Concurrency int
+	// AllowUnknownClasses, if true, makes the globals which cannot be
+	// resolved load as UnknownClass placeholders, instead of failing. It
+	// also enables the recognition of the globals of "dill", which may be
+	// used by torch.save in place of "pickle". Unknown classes are still
+	// resolved by the FindClass function of the Unpickler, if any, first:
+	// the placeholders are used for those it fails to resolve.
+	//
+	// This also allows loading the torch.Generator objects of training
+	// checkpoints, which cannot be restored in Go, as placeholders holding
+	// their RNG state.
+	AllowUnknownClasses bool
+	// Progress, if not nil, is called as the file is read, with the number
+	// of bytes read so far and the size of the file, for example to show
+	// the progress of loading a large file, and a last time with both set
+	// to the size, once it is loaded. The calls never overlap, even with
+	// Concurrency. The data read later by Lazy, or from the memory mapping
+	// of UseMmap, is not counted.
+	Progress func(bytesRead, totalBytes int64)
+	// TensorFilter, if not nil, selects by name the tensors whose data is
+	// read from zip-based files: the storages of the other ones are left
+	// empty, and accessing their data fails with ErrTensorFiltered. The
+	// name of a tensor is the one given by LoadStateDict, or its path as
+	// in FindTensors if the file holds no state dict. LoadStateDict also
+	// leaves out the tensors which are not selected. The storages of
+	// legacy files are all read anyway, and those of Lazy files only
+	// when accessed.
+	TensorFilter func(name string) bool
+	// ContinueOnTensorError, if true, makes a tensor which cannot be
+	// rebuilt, for example because of an unsupported data type, load as
+	// a Tensor with only its Err field set, instead of failing, so that
+	// the rest of the file can still be used. This includes the tensors
+	// of zip-based files whose storage class is not supported, or whose
+	// storage record is missing or cannot be read. LoadWithTensorErrors
+	// also returns all such errors. ErrTooManyTensors is never tolerated.
+	ContinueOnTensorError bool
+	// ExtraFindClass, if not nil, resolves the globals of the pickles
+	// before the built-in PyTorch classes, for example to map the classes
+	// of a project to Go values, or to stub out the ones which are not
+	// needed. It returns false for the globals it does not resolve, which
+	// are then resolved as usual.
+	ExtraFindClass func(module, name string) (interface{}, bool)
+	// MapLocation maps the location saved for each storage, such as
+	// "cuda:0", to the Location set on the loaded storage, as the
+	// map_location argument of "torch.load" given a function. The data is
+	// always loaded in memory, so, if nil, every location is mapped to
+	// "cpu". The saved location, if different, is kept as the
+	// SavedLocation of the storage, so the original devices are known.
+	MapLocation func(location string) string
+	// Encoding, if not empty, is the pickle.Unpickler Encoding of the 8-bit
+	// strings of the files saved under Python 2, as the encoding argument
+	// of "torch.load": "latin1" loads them as strings decoded as latin-1,
+	// and "bytes" as types.Bytes values, for example to restore the NumPy
+	// arrays they hold. It is set on the unpicklers made by NewUnpickler.
+	Encoding string
+	// Lazy, if true, makes the data of the storages be read only when it
+	// is first accessed, for example by Tensor.GetData, rather than while
+	// loading, so that the structure of a large file, with the names and
+	// sizes of its tensors, is loaded quickly and with little memory. Each
+	// storage reads its own data from the file, which must not change in
+	// the meantime; the errors reading it, such as for a missing file, are
+	// returned by the accessors. The Data field of a storage is nil until
+	// its Wait method is called. It has no effect on the legacy files in
+	// the tar format, and it overrides UseMmap.
+	Lazy bool
+
+	// lazyFile is the name of the file being loaded, when Lazy is set. It
+	// is set by loadFile, the only one supporting Lazy.
+	lazyFile string
+	// mapped is the content of the file being loaded by LoadMapped, of
+	// which the storages are views, whenever their data can be used in
+	// place.
+	mapped []byte
+	// metadata, if not nil, is set to the metadata of the file being
+	// loaded, by LoadWithMetadata.
+	metadata *Metadata
+	// tensorErrors collects the errors of the tensors which could not be
+	// rebuilt, when ContinueOnTensorError is set. It is created by
+	// withDefaults, and shared by all the copies of the options.
+	tensorErrors *tensorErrors
+	// ctx, if not nil, is the context of LoadWithContext, which stops
+	// loading once done.
+	ctx context.Context
+}
+
+// withDefaults returns a copy of the options, with default values in
+// place of the zero values.
+func (o LoadOptions) withDefaults() LoadOptions {
+	if o.NewUnpickler == nil {
+		o.NewUnpickler = func(r io.Reader) pickle.Unpickler {
+			return pickle.NewUnpickler(r)
+		}
+	}
+	if o.Encoding != "" {
+		newUnpickler, encoding := o.NewUnpickler, o.Encoding
+		o.NewUnpickler = func(r io.Reader) pickle.Unpickler {
+			u := newUnpickler(r)
+			u.Encoding = encoding
+			return u
+		}
+		// the unpicklers are only wrapped once
+		o.Encoding = ""
 	}
-	return LoadWithUnpickler(filename, newUnpickler)
+	if o.StorageReadBufferSize <= 0 {
+		o.StorageReadBufferSize = defaultStorageReadBufferSize
+	}
+	if o.MapLocation == nil {
+		o.MapLocation = mapToCPU
+	}
+	if o.ContinueOnTensorError && o.tensorErrors == nil {
+		o.tensorErrors = &tensorErrors{}
+	}
+	return o
+}
+
+// mapToCPU is the default LoadOptions.MapLocation, which loads all the
+// storages on the CPU.
+func mapToCPU(string) string {
+	return "cpu"
+}
+
+// newStorage returns a new storage of the given class, whose saved
+// location is mapped by MapLocation.
+func (o LoadOptions) newStorage(class StorageClassInterface, size int, location string) StorageInterface {
+	return setSavedLocation(class.New(size, o.MapLocation(location)), location)
+}
+
+// setSavedLocation sets the SavedLocation of a loaded storage, if it is
+// not its Location, returning the storage.
+func setSavedLocation(s StorageInterface, location string) StorageInterface {
+	if bs, ok := s.(baseStorager); ok && bs.baseStorage().Location != location {
+		bs.baseStorage().SavedLocation = location
+	}
+	return s
+}
+
+// LoadWithOptions is like Load, but it accepts LoadOptions.
+//
+// A file which is not a zip file is loaded in the legacy format. A zip
+// file which turns out not to be a PyTorch archive, as a legacy file
+// which happens to contain a zip signature may be, is then loaded in the
+// legacy format as well. If that fails too, the error wraps
+// ErrNotTorchArchive.
+func LoadWithOptions(filename string, opts LoadOptions) (interface{}, error) {
+	return loadFile(filename, opts.withDefaults())
+}
+
+// LoadWithTensorErrors is like LoadWithOptions, but it also returns the
+// errors of the tensors which could not be rebuilt, in the order they
+// were found, when opts.ContinueOnTensorError is set. Otherwise, the
+// first such error makes loading fail, as for LoadWithOptions.
+func LoadWithTensorErrors(filename string, opts LoadOptions) (interface{}, []error, error) {
+	opts = opts.withDefaults()
+	result, err := loadFile(filename, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.tensorErrors == nil {
+		return result, nil, nil
+	}
+	return result, opts.tensorErrors.errs, nil
+}
+
+// loadFile loads a file in either format, with options to which the
+// defaults are already applied.
+func loadFile(filename string, opts LoadOptions) (interface{}, error) {
+	if opts.Lazy {
+		opts.lazyFile = filename
+	}
+	if !isZipFile(filename) {
+		return loadLegacyFile(filename, opts)
+	}
+	result, err := loadZipFile(filename, opts)
+	if errors.Is(err, ErrNotTorchArchive) {
+		return loadLegacyFallback(filename, opts, err)
+	}
+	return result, err
+}
+
+// loadLegacyFallback loads a file in the legacy format, after it failed
+// to load as a zip archive with zipErr.
+func loadLegacyFallback(filename string, opts LoadOptions, zipErr error) (interface{}, error) {
+	result, err := loadLegacyFile(filename, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w; loading as legacy file: %v", zipErr, err)
+	}
+	return result, nil
 }
 
 // LoadWithUnpickler is like Load, but it accepts a newUnpickler function which
 // is used to create new customized pickle.Unpickler instances.
 func LoadWithUnpickler(filename string, newUnpickler func(r io.Reader) pickle.Unpickler) (interface{}, error) {
-	if !isZipFile(filename) {
-		return loadLegacyFile(filename, newUnpickler)
+	return LoadWithOptions(filename, LoadOptions{NewUnpickler: newUnpickler})
+}
+
+// LoadFromReader is like Load, but it reads the content of a file, of the
+// given size, from r, such as a downloaded checkpoint held in memory,
+// without a file on disk. Legacy content, not being a zip archive, is
+// detected and loaded as well.
+func LoadFromReader(r io.ReaderAt, size int64) (interface{}, error) {
+	return LoadFromReaderWithOptions(r, size, LoadOptions{})
+}
+
+// LoadFromReaderWithOptions is like LoadFromReader, but it accepts
+// LoadOptions. UseMmap and Lazy have no effect, since there is no file to
+// map or to read again.
+func LoadFromReaderWithOptions(r io.ReaderAt, size int64, opts LoadOptions) (interface{}, error) {
+	opts = opts.withDefaults()
+	result, err := loadZipReader(r, size, nil, opts)
+	if errors.Is(err, zip.ErrFormat) || errors.Is(err, ErrNotTorchArchive) {
+		result, err = loadLegacy(io.NewSectionReader(r, 0, size), opts)
+	}
+	return result, err
+}
+
+// LoadFromStream is like Load, but it reads the content of a legacy file,
+// not in a tar archive, sequentially from r, such as the body of a
+// network response. Zip-based files cannot be read from a stream: see
+// LoadFromReader.
+func LoadFromStream(r io.Reader) (interface{}, error) {
+	return loadLegacyNoTar(r, LoadOptions{}.withDefaults())
+}
+
+func loadZipFile(filename string, opts LoadOptions) (interface{}, error) {
+	f, size, err := openLoadFile(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mapping []byte
+	if opts.UseMmap && opts.lazyFile == "" {
+		m, err := openFileMapping(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer m.Close()
+		mapping = m.data
+	}
+	result, err := loadZipReader(f, size, mapping, opts)
+	if err != nil {
+		return nil, err
 	}
-	return loadZipFile(filename, newUnpickler)
+	f.done()
+	return result, nil
 }
 
-func loadZipFile(filename string, newUnpickler func(r io.Reader) pickle.Unpickler) (interface{}, error) {
-	// Open a zip archive for reading.
+// loadZipReader loads the zip archive of the given size read from r. The
+// mapping, if not nil, is the same content, as for unpickleZipFile.
+func loadZipReader(r io.ReaderAt, size int64, mapping []byte, opts LoadOptions) (interface{}, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if (opts.Concurrency > 1 || opts.TensorFilter != nil) && opts.lazyFile == "" && opts.mapped == nil {
+		return loadZipDeferred(zr, mapping, opts)
+	}
+	result, _, err := unpickleZipFile(zr, mapping, opts, false)
+	return result, err
+}
+
+// loadZipDeferred is like loadZipReader, but the data of the storages is
+// read after unpickling, by opts.Concurrency goroutines, and only for the
+// tensors selected by opts.TensorFilter, if any.
+func loadZipDeferred(zr *zip.Reader, mapping []byte, opts LoadOptions) (interface{}, error) {
+	result, deferred, err := unpickleZipFile(zr, mapping, opts, true)
+	if err != nil {
+		// Nothing will be read: complete the storages derived from them.
+		for _, d := range deferred {
+			d.pending.finish(err)
+		}
+		return nil, err
+	}
+	if opts.TensorFilter != nil {
+		var skipped []deferredStorage
+		deferred, skipped = filterDeferredStorages(result, deferred, opts)
+		for _, d := range skipped {
+			d.pending.finish(ErrTensorFiltered)
+		}
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	err = loadStoragesConcurrently(recordsByName(zr), deferred, mapping,
+		opts.StorageReadBufferSize, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnpickleZipEntry unpickles a single record of a zip-based file, such as
+// "data.pkl", "constants.pkl" or any custom pickle saved along with them,
+// with the same classes resolved by Load. The storages it references are
+// read from their own records, as Load does.
+//
+// entryName is either the full name of the record, or its name within the
+// top-level directory of the archive (e.g. "data.pkl" for
+// "archive/data.pkl").
+func UnpickleZipEntry(filename, entryName string) (interface{}, error) {
 	r, err := zip.OpenReader(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close()
 
-	fileRecords := make(map[string]*zip.File, len(r.File))
+	var record *zip.File
 	for _, f := range r.File {
-		_, recordName := path.Split(f.Name)
-		fileRecords[recordName] = f
+		if f.Name == entryName || nameInArchive(f.Name) == entryName {
+			record = f
+			break
+		}
+	}
+	if record == nil {
+		return nil, fmt.Errorf("UnpickleZipEntry: entry %q not found in %s",
+			entryName, filename)
+	}
+	result, _, err := unpickleZipRecord(record, entryRecords(&r.Reader, record), nil,
+		LoadOptions{}.withDefaults(), false)
+	if err != nil {
+		return nil, fmt.Errorf("UnpickleZipEntry: cannot unpickle entry %q "+
+			"of %s: %w", entryName, filename, err)
 	}
+	return result, nil
+}
+
+// nameInArchive returns the name of a record within the top-level
+// directory of the archive, or the whole name if it has no directory.
+func nameInArchive(name string) string {
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// unpickleZipFile unpickles the data.pkl record of a zip archive. The
+// storages are read from their own records as soon as they are found,
+// unless deferLoad is true: in this case they are returned, still empty,
+// along with their keys, to be read later by loadDeferredStorages. The
+// deferred storages are returned even on error.
+//
+// mapping, if not nil, is the whole content of the zip file, from which
+// the uncompressed records are read directly.
+func unpickleZipFile(
+	r *zip.Reader,
+	mapping []byte,
+	opts LoadOptions,
+	deferLoad bool,
+) (interface{}, []deferredStorage, error) {
+	fileRecords := recordsByName(r)
 
 	if _, isTorchScript := fileRecords["constants.pkl"]; isTorchScript {
-		return nil, fmt.Errorf("TorchScript is not supported")
+		return nil, nil, fmt.Errorf("TorchScript is not supported, see LoadScriptModule")
 	}
 
 	dataFile, hasDataFile := fileRecords["data.pkl"]
 	if !hasDataFile {
-		return nil, fmt.Errorf("data.pkl not found in zip file")
+		return nil, nil, fmt.Errorf("%w: data.pkl not found", ErrNotTorchArchive)
+	}
+	return unpickleZipRecord(dataFile, fileRecords, mapping, opts, deferLoad)
+}
+
+// recordsByName returns the records of a zip archive by name, without
+// the directories.
+func recordsByName(r *zip.Reader) map[string]*zip.File {
+	fileRecords := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		_, recordName := path.Split(f.Name)
+		fileRecords[recordName] = f
+	}
+	return fileRecords
+}
+
+// entryRecords returns the records of a zip archive by name, as
+// recordsByName, for unpickling the given pickle record: its storages are
+// the records of the directory with the same name, without the ".pkl"
+// extension, such as "archive/constants/0" for "archive/constants.pkl",
+// and the directories of the storages of the other pickles next to it
+// are left out.
+func entryRecords(r *zip.Reader, record *zip.File) map[string]*zip.File {
+	recordDir, _ := path.Split(record.Name)
+	pickles := make(map[string]bool)
+	for _, f := range r.File {
+		if dir, name := path.Split(f.Name); dir == recordDir && strings.HasSuffix(name, ".pkl") {
+			pickles[strings.TrimSuffix(f.Name, ".pkl")+"/"] = true
+		}
+	}
+	storageDir := strings.TrimSuffix(record.Name, ".pkl") + "/"
+	fileRecords := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		dir, name := path.Split(f.Name)
+		if pickles[dir] && dir != storageDir {
+			continue
+		}
+		fileRecords[name] = f
 	}
-	df, err := dataFile.Open()
+	return fileRecords
+}
+
+// unpickleZipRecord unpickles a record of a zip archive, whose storages
+// are read from the other fileRecords, as described by unpickleZipFile.
+func unpickleZipRecord(
+	record *zip.File,
+	fileRecords map[string]*zip.File,
+	mapping []byte,
+	opts LoadOptions,
+	deferLoad bool,
+) (interface{}, []deferredStorage, error) {
+	df, err := record.Open()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer df.Close()
 
-	loadedStorages := make(map[string]StorageInterface)
+	metadata, err := zipMetadata(fileRecords)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.metadata != nil {
+		*opts.metadata = *metadata
+	}
+	var deferred []deferredStorage
 
-	u := newUnpickler(df)
-	u.FindClass = makePickleFindClass(u.FindClass)
-	u.PersistentLoad = func(savedId interface{}) (interface{}, error) {
+	u := opts.NewUnpickler(df)
+	u.FindClass = makePickleFindClass(u.FindClass, opts)
+	loadStorage := func(
+		dataType StorageClassInterface,
+		size int,
+		location, key string,
+	) (StorageInterface, error) {
+		if opts.lazyFile != "" && !deferLoad {
+			return loadLazyZipStorage(dataType, size, location, key,
+				metadata.ByteOrder, fileRecords, opts)
+		}
+		if !deferLoad {
+			return loadTensor(dataType, size, location, key,
+				metadata.ByteOrder, fileRecords, mapping, opts.mapped != nil,
+				opts.StorageReadBufferSize)
+		}
+		storage := dataType.New(size, location)
+		d, err := newDeferredStorage(storage, dataType, size, key, metadata.ByteOrder)
+		if err != nil {
+			return nil, err
+		}
+		deferred = append(deferred, d)
+		return storage, nil
+	}
+	u.PersistentLoad = zipPersistentLoad(opts, func(
+		dataType StorageClassInterface,
+		size int,
+		location, key string,
+	) (StorageInterface, error) {
+		if opts.ctx != nil {
+			if err := opts.ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if opts.tensorErrors == nil {
+			return loadStorage(dataType, size, location, key)
+		}
+		if fc, ok := dataType.(*failedStorageClass); ok {
+			return fc.New(size, location), nil
+		}
+		// The deferred storages are read after unpickling, when the errors
+		// can no longer be tolerated: their records are checked here.
+		if _, err := storageRecord(dataType, size, key, fileRecords); err != nil {
+			return &failedStorage{err: fmt.Errorf("storage '%s': %w", key, err)}, nil
+		}
+		storage, err := loadStorage(dataType, size, location, key)
+		if err != nil {
+			return &failedStorage{err: fmt.Errorf("storage '%s': %w", key, err)}, nil
+		}
+		return storage, nil
+	})
+	result, err := u.Load()
+	if err != nil {
+		// the deferred storages are returned anyway, to be completed
+		return nil, deferred, err
+	}
+	return result, deferred, nil
+}
+
+// zipPersistentLoad returns the PersistentLoad function of the Unpickler
+// of the data.pkl record of a zip-based file, which resolves the
+// persistent IDs of the storages with loadStorage, given their locations
+// mapped by opts.MapLocation. It is called only once for each key, so
+// that the storages shared by more tensors are shared by the loaded ones
+// too.
+func zipPersistentLoad(
+	opts LoadOptions,
+	loadStorage func(dataType StorageClassInterface, size int, location, key string) (StorageInterface, error),
+) func(savedId interface{}) (interface{}, error) {
+	loadedStorages := make(map[string]StorageInterface)
+	return func(savedId interface{}) (interface{}, error) {
 		tuple, tupleOk := savedId.(*types.Tuple)
 		if !tupleOk || tuple.Len() == 0 {
 			return nil, fmt.Errorf("PersistentLoad: non-empty tuple expected, got %#v", savedId)
@@ -87,75 +603,211 @@ func loadZipFile(filename string, newUnpickler func(r io.Reader) pickle.Unpickle
 			return nil, fmt.Errorf("PersistentLoad: unexpected storage data length")
 		}
 		dataType, dataTypeOk := tuple.Get(1).(StorageClassInterface)
-		key, keyOk := tuple.Get(2).(string)
+		// the key is usually a string, but may be the integer index of
+		// the record in the "data" directory
+		key, keyOk := persistentKey(tuple.Get(2))
 		location, locationOk := tuple.Get(3).(string)
-		size, sizeOk := tuple.Get(4).(int)
+		size, sizeOk := toInt(tuple.Get(4))
 		if !dataTypeOk || !keyOk || !locationOk || !sizeOk {
 			return nil, fmt.Errorf("PersistentLoad: unexpected data types")
 		}
 		storage, storageExists := loadedStorages[key]
 		if !storageExists {
-			storage, err = loadTensor(dataType, size, location, key, fileRecords)
+			var err error
+			storage, err = loadStorage(dataType, size, opts.MapLocation(location), key)
 			if err != nil {
 				return nil, err
 			}
+			setSavedLocation(storage, location)
 			loadedStorages[key] = storage
 		}
 		return storage, nil
 	}
-	return u.Load()
 }
 
+// persistentKey returns the key of an object referred to by a persistent
+// ID, such as a storage, pickled either as a string, possibly loaded as
+// types.Bytes, or as an integer, in which case it is formatted in decimal.
+func persistentKey(v interface{}) (string, bool) {
+	switch k := v.(type) {
+	case string, types.Bytes:
+		return persistentString(k)
+	case *big.Int:
+		return k.String(), true
+	default:
+		i, ok := toInt(v)
+		return strconv.Itoa(i), ok
+	}
+}
+
+// persistentString returns the string held by a string of a persistent ID
+// of a legacy file, which is a types.Bytes value when the file was saved
+// under Python 2 and is loaded with the "bytes" Encoding.
+func persistentString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case types.Bytes:
+		return string(s), true
+	default:
+		return "", false
+	}
+}
+
+// loadTensor reads a storage from its own zip record, holding its elements
+// in the given byte order. The record must hold at least all the elements
+// of the storage: data split across multiple records is not supported here
+// (see SetFromReaders). When mapping is not nil, an uncompressed record is
+// read from there (see unpickleZipFile), or, if views is true, the data
+// of the storage is a view of it, when possible (see setStorageView).
 func loadTensor(
 	dataType StorageClassInterface,
 	size int,
 	location, key string,
+	byteOrder binary.ByteOrder,
 	zipFileRecords map[string]*zip.File,
+	mapping []byte,
+	views bool,
+	bufferSize int,
 ) (StorageInterface, error) {
-	file, fileOk := zipFileRecords[key]
-	if !fileOk {
-		return nil, fmt.Errorf("cannot find zip record '%s'", key)
+	storage := dataType.New(size, location)
+	if views && mapping != nil {
+		ok, err := viewStorageRecord(storage, dataType, size, key, byteOrder,
+			zipFileRecords, mapping)
+		if ok || err != nil {
+			return storage, err
+		}
+	}
+	err := readStorageRecord(storage, dataType, size, key, byteOrder,
+		zipFileRecords, mapping, bufferSize)
+	return storage, err
+}
+
+func readStorageRecord(
+	storage StorageInterface,
+	dataType StorageClassInterface,
+	size int,
+	key string,
+	byteOrder binary.ByteOrder,
+	zipFileRecords map[string]*zip.File,
+	mapping []byte,
+	bufferSize int,
+) error {
+	file, err := storageRecord(dataType, size, key, zipFileRecords)
+	if err != nil {
+		return err
+	}
+	if mapping != nil && file.Method == zip.Store {
+		data, err := mappedRecord(file, key, mapping)
+		if err != nil {
+			return err
+		}
+		return setStorageData(storage, dataType, bytes.NewReader(data), size, byteOrder)
 	}
 	f, err := file.Open()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer f.Close()
+	return setStorageData(storage, dataType, bufio.NewReaderSize(f, bufferSize),
+		size, byteOrder)
+}
 
-	storage := dataType.New(size, location)
-	err = storage.SetFromFileWithSize(f, size)
-	return storage, err
+// viewStorageRecord makes the data of a storage a view of its zip record
+// within mapping, the whole content of the zip file, if the record is not
+// compressed and the data can be used in place. It reports whether it did
+// so.
+func viewStorageRecord(
+	storage StorageInterface,
+	dataType StorageClassInterface,
+	size int,
+	key string,
+	byteOrder binary.ByteOrder,
+	zipFileRecords map[string]*zip.File,
+	mapping []byte,
+) (bool, error) {
+	file, err := storageRecord(dataType, size, key, zipFileRecords)
+	if err != nil || file.Method != zip.Store {
+		return false, err
+	}
+	data, err := mappedRecord(file, key, mapping)
+	if err != nil {
+		return false, err
+	}
+	return setStorageView(storage, data, size, byteOrder), nil
+}
+
+// mappedRecord returns the data of an uncompressed zip record within
+// mapping, the whole content of the zip file.
+func mappedRecord(file *zip.File, key string, mapping []byte) ([]byte, error) {
+	offset, err := file.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	end := offset + int64(file.UncompressedSize64)
+	if offset < 0 || end > int64(len(mapping)) {
+		return nil, fmt.Errorf("zip record '%s' exceeds the file size", key)
+	}
+	return mapping[offset:end], nil
+}
+
+// storageRecord returns the zip record of the storage with the given key,
+// checking that it is large enough for all of its elements.
+func storageRecord(
+	dataType StorageClassInterface,
+	size int,
+	key string,
+	zipFileRecords map[string]*zip.File,
+) (*zip.File, error) {
+	file, fileOk := zipFileRecords[key]
+	if !fileOk {
+		return nil, fmt.Errorf("cannot find zip record '%s'", key)
+	}
+	if elementSize, ok := storageClassElementSize(dataType); ok {
+		if required := uint64(size) * uint64(elementSize); file.UncompressedSize64 < required {
+			return nil, fmt.Errorf(
+				"storage '%s' of %d elements requires %d bytes, but its "+
+					"zip record has only %d bytes", key, size, required,
+				file.UncompressedSize64)
+		}
+	}
+	return file, nil
 }
 
-func loadLegacyFile(filename string, newUnpickler func(r io.Reader) pickle.Unpickler) (interface{}, error) {
-	f, err := os.Open(filename)
+func loadLegacyFile(filename string, opts LoadOptions) (interface{}, error) {
+	f, _, err := openLoadFile(filename, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+	result, err := loadLegacy(f, opts)
+	if err != nil {
+		return nil, err
+	}
+	f.done()
+	return result, nil
+}
 
-	tr := tar.NewReader(f)
-	for {
-		_, err := tr.Next()
-		switch err {
-		case nil:
-			// TODO: ...
-			panic("legacy load from tar not implemented")
-		case io.EOF:
-			break // End of archive
-		case tar.ErrHeader, io.ErrUnexpectedEOF:
-			_, err = f.Seek(0, io.SeekStart)
-			if err != nil {
-				return nil, err
-			}
-			return loadLegacyNoTar(f, newUnpickler)
-		default:
+// loadLegacy loads a legacy file read from rs, either in the tar format
+// of the oldest versions of PyTorch, or not.
+func loadLegacy(rs io.ReadSeeker, opts LoadOptions) (interface{}, error) {
+	tr := tar.NewReader(rs)
+	header, err := tr.Next()
+	switch err {
+	case nil:
+		return loadLegacyTar(tr, header, opts)
+	case io.EOF, tar.ErrHeader, io.ErrUnexpectedEOF:
+		// not a tar archive
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
 			return nil, err
 		}
+		return loadLegacyNoTar(rs, opts)
+	default:
+		return nil, err
 	}
 }
 
-func loadLegacyNoTar(f *os.File, newUnpickler func(r io.Reader) pickle.Unpickler) (interface{}, error) {
+func loadLegacyNoTar(f io.Reader, opts LoadOptions) (interface{}, error) {
 	if err := readAndCheckMagicNumber(f); err != nil {
 		return nil, err
 	}
@@ -167,15 +819,18 @@ func loadLegacyNoTar(f *os.File, newUnpickler func(r io.Reader) pickle.Unpickler
 	}
 
 	deserializedObjects := make(map[string]StorageInterface)
+	var views []legacyStorageView
+	// viewIndex is the position of each view in views, by key.
+	viewIndex := make(map[string]int)
 
-	u := newUnpickler(f)
-	u.FindClass = makePickleFindClass(u.FindClass)
+	u := opts.NewUnpickler(f)
+	u.FindClass = makePickleFindClass(u.FindClass, opts)
 	u.PersistentLoad = func(savedId interface{}) (interface{}, error) {
 		tuple, tupleOk := savedId.(*types.Tuple)
 		if !tupleOk || tuple.Len() == 0 {
 			return nil, fmt.Errorf("PersistentLoad: non-empty tuple expected, got %#v", savedId)
 		}
-		typename, typenameOk := tuple.Get(0).(string)
+		typename, typenameOk := persistentString(tuple.Get(0))
 		if !typenameOk {
 			return nil, fmt.Errorf("PersistentLoad: cannot get typename")
 		}
@@ -187,36 +842,69 @@ func loadLegacyNoTar(f *os.File, newUnpickler func(r io.Reader) pickle.Unpickler
 					"PersistentLoad: unexpected storage data length")
 			}
 			dataType, dataTypeOk := tuple.Get(1).(StorageClassInterface)
-			rootKey, rootKeyOk := tuple.Get(2).(string)
-			location, locationOk := tuple.Get(3).(string)
-			size, sizeOk := tuple.Get(4).(int)
+			rootKey, rootKeyOk := persistentString(tuple.Get(2))
+			location, locationOk := persistentString(tuple.Get(3))
+			size, sizeOk := toInt(tuple.Get(4))
 			viewMetadata := tuple.Get(5)
 			if !dataTypeOk || !rootKeyOk || !locationOk || !sizeOk {
 				return nil, fmt.Errorf("PersistentLoad: unexpected data types")
 			}
 			storage, storageExists := deserializedObjects[rootKey]
 			if !storageExists {
-				storage = dataType.New(size, location)
+				storage = opts.newStorage(dataType, size, location)
 				deserializedObjects[rootKey] = storage
 			}
 			switch vm := viewMetadata.(type) {
 			case nil:
 				return storage, nil
-			case []interface{}:
-				if len(vm) != 3 {
+			case *types.Tuple:
+				if vm.Len() != 3 {
 					return nil, fmt.Errorf(
 						"PersistentLoad: unexpected view metadata length")
 				}
-				panic("viewMetadata not implemented")
-				// TODO: ...
-				// view_key, offset, view_size = view_metadata
-				// if view_key not in deserialized_objects:
-				//     deserialized_objects[view_key] = storage[offset:offset + view_size]
-				// return deserialized_objects[view_key]
+				viewKey, viewKeyOk := persistentString(vm.Get(0))
+				offset, offsetOk := toInt(vm.Get(1))
+				viewSize, viewSizeOk := toInt(vm.Get(2))
+				if !viewKeyOk || !offsetOk || !viewSizeOk {
+					return nil, fmt.Errorf("PersistentLoad: unexpected view metadata %#v", vm)
+				}
+				if offset < 0 || viewSize < 0 || offset+viewSize > size {
+					return nil, fmt.Errorf("PersistentLoad: view %s: elements %d to %d "+
+						"out of range for a storage of %d elements",
+						viewKey, offset, offset+viewSize, size)
+				}
+				view, viewExists := deserializedObjects[viewKey]
+				if viewExists {
+					// every reference to a view must describe the same
+					// elements of the same root storage
+					i, isView := viewIndex[viewKey]
+					if !isView || views[i].root != storage ||
+						views[i].offset != offset || views[i].size != viewSize {
+						return nil, fmt.Errorf("PersistentLoad: view %s: "+
+							"inconsistent with its previous references", viewKey)
+					}
+				} else {
+					// The data of the root storage is only read after the
+					// main object, so the view is bound to it afterwards.
+					view = opts.newStorage(dataType, viewSize, location)
+					deserializedObjects[viewKey] = view
+					viewIndex[viewKey] = len(views)
+					views = append(views, legacyStorageView{
+						view:   view,
+						root:   storage,
+						offset: offset,
+						size:   viewSize,
+					})
+				}
+				return view, nil
 			default:
 				return nil, fmt.Errorf("PersistentLoad: unexpected view metadata type")
 			}
 		case "module":
+			// ("module", container_type, source_file, source): the class
+			// of a module of a model saved as a whole. Python only warns
+			// when its source differs from the current one, so the source
+			// is not checked.
 			if tuple.Len() < 2 {
 				return nil, fmt.Errorf("PersistentLoad: unexpected module data length")
 			}
@@ -230,41 +918,121 @@ func loadLegacyNoTar(f *os.File, newUnpickler func(r io.Reader) pickle.Unpickler
 		return nil, err
 	}
 
-	rawStorageKeys, err := unpickle(f)
+	// The storage keys are unpickled with the same resolvers of the main
+	// object, in case they reference any global.
+	ku := opts.NewUnpickler(f)
+	ku.FindClass = u.FindClass
+	ku.PersistentLoad = u.PersistentLoad
+	rawStorageKeys, err := ku.Load()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot unpickle storage keys: %w", err)
 	}
 	storageKeys, err := makeStorageKeys(rawStorageKeys)
 	if err != nil {
 		return nil, err
 	}
 
+	if seeker, ok := f.(io.Seeker); ok && opts.lazyFile != "" {
+		err = setLegacyLazyStorages(f, seeker, storageKeys, deserializedObjects, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range views {
+			if err := setLazyLoad(v.view, v.bind); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	// The data of all the storages follows, up to the end of the file.
+	if r, ok := f.(*bytes.Reader); ok && opts.mapped != nil {
+		err = setLegacyStorageViews(r, opts.mapped, storageKeys, deserializedObjects)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range views {
+			if err := v.bind(); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	br := bufio.NewReaderSize(f, opts.StorageReadBufferSize)
 	for _, key := range storageKeys {
 		storageObj, ok := deserializedObjects[key]
 		if !ok {
 			return nil, fmt.Errorf("storage object not found for key '%s'", key)
 		}
-		err = storageObj.SetFromFile(f)
+		err = storageObj.SetFromFile(br)
 		if err != nil {
 			return nil, err
 		}
 	}
+	for _, v := range views {
+		if err := v.bind(); err != nil {
+			return nil, err
+		}
+	}
 
 	return result, nil
 }
 
+// legacyStorageView is a storage of a legacy file which is a view of size
+// elements of a root storage, starting at offset.
+type legacyStorageView struct {
+	view   StorageInterface
+	root   StorageInterface
+	offset int
+	size   int
+}
+
+// bind makes the view share the data of the root storage, once it is
+// read.
+func (v legacyStorageView) bind() error {
+	rootData, err := storageData(v.root)
+	if err != nil {
+		return err
+	}
+	// the view itself may be pending, if it is bound lazily
+	viewData, err := storageDataField(v.view)
+	if err != nil {
+		return err
+	}
+	end := v.offset + v.size
+	if end > rootData.Len() {
+		return fmt.Errorf("storage view: elements %d to %d out of range "+
+			"for a storage of %d elements", v.offset, end, rootData.Len())
+	}
+	viewData.Set(rootData.Slice(v.offset, end))
+	return nil
+}
+
+// makeStorageKeys converts the storage keys of a legacy file, which are
+// usually a list of strings, into a slice. A tuple is accepted as well,
+// as are types.Bytes keys, such as Python 3 bytes pickled with protocol 2.
 func makeStorageKeys(obj interface{}) ([]string, error) {
-	list, ok := obj.(*types.List)
-	if !ok {
-		return nil, fmt.Errorf("invalid storage keys data")
+	var rawKeys []interface{}
+	switch v := obj.(type) {
+	case *types.List:
+		rawKeys = *v
+	case *types.Tuple:
+		rawKeys = *v
+	default:
+		return nil, fmt.Errorf(
+			"invalid storage keys: list of strings expected, got %#v", obj)
 	}
-	keys := make([]string, len(*list))
-	for i, rawKey := range *list {
-		key, keyOk := rawKey.(string)
-		if !keyOk {
-			return nil, fmt.Errorf("invalid storage key")
+	keys := make([]string, len(rawKeys))
+	for i, rawKey := range rawKeys {
+		switch key := rawKey.(type) {
+		case string:
+			keys[i] = key
+		case types.Bytes:
+			keys[i] = string(key)
+		default:
+			return nil, fmt.Errorf(
+				"invalid storage key at index %d: string expected, got %#v", i, rawKey)
 		}
-		keys[i] = key
 	}
 	return keys, nil
 }
@@ -286,7 +1054,8 @@ func readAndChecProtocolVersion(r io.Reader) error {
 		return err
 	}
 	if n, ok := obj.(int); !ok || n != protocolVersion {
-		return ErrInvalidProtocolVersion
+		return fmt.Errorf("%w %#v, expected %d",
+			ErrInvalidProtocolVersion, obj, protocolVersion)
 	}
 	return nil
 }
@@ -305,15 +1074,71 @@ func isZipFile(filename string) bool {
 	return true
 }
 
-func makePickleFindClass(fallback func(module, name string) (interface{}, error)) func(module, name string) (interface{}, error) {
+// parametrizeModule is the Python module of the classes of parametrized
+// modules, such as "ParametrizedLinear", and of their "ParametrizationList"
+// containers, holding the original tensors, as "original" or "original0",
+// "original1", and so on. They are all subclasses of "torch.nn.Module".
+const parametrizeModule = "torch.nn.utils.parametrize"
+
+// makePickleFindClass returns the FindClass function of the Unpickler of
+// a file loaded with the given options, resolving the PyTorch classes, and
+// delegating to fallback, if not nil, for the others.
+func makePickleFindClass(
+	fallback func(module, name string) (interface{}, error),
+	opts LoadOptions,
+) func(module, name string) (interface{}, error) {
+	counter := newTensorCounter(opts.MaxTensors)
+	// tolerant wraps the functions rebuilding tensors, when their failures
+	// can be tolerated.
+	tolerant := func(rebuild types.Callable) types.Callable {
+		if opts.tensorErrors == nil {
+			return rebuild
+		}
+		return &tolerantRebuild{rebuild: rebuild, errs: opts.tensorErrors}
+	}
 	return func(module, name string) (interface{}, error) {
-		switch module + "." + name {
+		if opts.ExtraFindClass != nil {
+			if class, ok := opts.ExtraFindClass(module, name); ok {
+				return class, nil
+			}
+		}
+		if class, ok := registeredClass(module, name); ok {
+			return class, nil
+		}
+		qualifiedName := module + "." + name
+		if module == "torch.cuda" && strings.HasSuffix(name, "Storage") {
+			// the storages saved from a GPU by the oldest versions of
+			// PyTorch, such as "torch.cuda.FloatStorage", are loaded in
+			// memory as the others
+			qualifiedName = "torch." + name
+		}
+		switch qualifiedName {
+		case "torch._utils._rebuild_tensor":
+			return tolerant(&RebuildTensor{counter: counter}), nil
 		case "torch._utils._rebuild_tensor_v2":
-			return &RebuildTensorV2{}, nil
+			return tolerant(&RebuildTensorV2{counter: counter}), nil
+		case "torch._utils._rebuild_tensor_v3":
+			return tolerant(&RebuildTensorV3{counter: counter}), nil
+		case "torch._utils._rebuild_qtensor":
+			return tolerant(&RebuildQTensor{counter: counter}), nil
+		case "torch._utils._rebuild_wrapper_subclass",
+			"torch._tensor._rebuild_wrapper_subclass":
+			return tolerant(&RebuildWrapperSubclass{counter: counter}), nil
+		case "torch._tensor._rebuild_from_type_v2":
+			return &RebuildFromTypeV2{}, nil
+		case "torch._utils._rebuild_sparse_tensor",
+			"torch._utils._rebuild_sparse_csr_tensor":
+			return &RebuildSparseTensor{}, nil
+		case "torch._utils._rebuild_parameter":
+			return &RebuildParameter{}, nil
+		case "torch._utils._rebuild_parameter_with_state":
+			return &RebuildParameterWithState{}, nil
 		case "torch.FloatStorage":
 			return &FloatStorageClass{}, nil
 		case "torch.HalfStorage":
 			return &HalfStorageClass{}, nil
+		case "torch.BFloat16Storage":
+			return &BFloat16StorageClass{}, nil
 		case "torch.DoubleStorage":
 			return &DoubleStorageClass{}, nil
 		case "torch.CharStorage":
@@ -328,14 +1153,74 @@ func makePickleFindClass(fallback func(module, name string) (interface{}, error)
 			return &ByteStorageClass{}, nil
 		case "torch.BoolStorage":
 			return &BoolStorageClass{}, nil
+		case "torch.ComplexFloatStorage":
+			return &ComplexFloatStorageClass{}, nil
+		case "torch.ComplexDoubleStorage":
+			return &ComplexDoubleStorageClass{}, nil
+		case "torch.UntypedStorage":
+			return &UntypedStorageClass{}, nil
+		case "torch.QInt8Storage":
+			return &QInt8StorageClass{}, nil
+		case "torch.QUInt8Storage":
+			return &QUInt8StorageClass{}, nil
+		case "torch.QInt32Storage":
+			return &QInt32StorageClass{}, nil
+		case "torch.storage._load_from_bytes":
+			return &LoadFromBytes{opts: opts}, nil
+		case "torch.Tensor":
+			return types.NewGenericClass(module, name), nil
+		case "torch.device":
+			return &DeviceClass{}, nil
+		case "torch.Size":
+			return &SizeClass{}, nil
 		case "torch.nn.backends.thnn._get_thnn_function_backend":
 			// this is for historical pickle deserilaization, it is not used otherwise
 			return getThnnFunctionBackend{}, nil
 		default:
-			if fallback == nil {
-				return nil, fmt.Errorf("class not found: %s %s", module, name)
+			if dtype, ok := dtypes[name]; ok && module == "torch" {
+				return dtype, nil
+			}
+			if qscheme, ok := qschemes[name]; ok && module == "torch" {
+				return qscheme, nil
+			}
+			if layout, ok := layouts[name]; ok && module == "torch" {
+				return layout, nil
+			}
+			if class, ok := numpy.FindClass(module, name); ok {
+				return class, nil
+			}
+			if module == returnTypesModule {
+				return NewReturnTypeClass(name), nil
+			}
+			if strings.HasPrefix(module, "torch.nn.modules.") || module == parametrizeModule {
+				return NewModuleClass(module, name), nil
+			}
+			if opts.tensorErrors != nil && module == "torch" && strings.HasSuffix(name, "Storage") {
+				return &failedStorageClass{err: &pickle.ClassNotFoundError{
+					Module: module, Name: name, Reason: "unsupported storage type"}}, nil
+			}
+			if fallback != nil {
+				class, err := fallback(module, name)
+				if err == nil || !opts.AllowUnknownClasses {
+					return class, err
+				}
+			}
+			if opts.AllowUnknownClasses {
+				if class, ok := dillFindClass(module, name); ok {
+					return class, nil
+				}
+				return &UnknownClass{Module: module, Name: name}, nil
+			}
+			notFound := &pickle.ClassNotFoundError{Module: module, Name: name}
+			if module+"."+name == "torch.Generator" {
+				notFound.Reason = "RNG generators cannot be restored, " +
+					"see LoadOptions.AllowUnknownClasses"
+			}
+			if dillModules[module] {
+				notFound.Reason = "the file was pickled with dill, " +
+					"see LoadOptions.AllowUnknownClasses"
 			}
-			return fallback(module, name)
+			return nil, notFound
 		}
 	}
 }
@@ -5,9 +5,23 @@
 package pytorch
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestFloat16Tensors(t *testing.T) { // Half
@@ -145,6 +159,651 @@ func TestBoolTensors(t *testing.T) {
 	}
 }
 
+func TestUntypedStorageWithDtype(t *testing.T) {
+	// 16 bytes of untyped storage, rebuilt as a float32 tensor
+	tensor := loadTensorFromFile(t, "synthetic_untyped_storage_v3.pt")
+	assertCommonTensorFields(t, tensor)
+	fs, fsOk := tensor.Source.(*FloatStorage)
+	if !fsOk {
+		t.Fatalf("expected *FloatStorage, got %#v", tensor.Source)
+	}
+	assertBaseStorageFields(t, fs.BaseStorage, 4, "cpu")
+	assertFloat32SliceEqual(t, fs.Data, []float32{1.5, -2.5, 3.5, -4.5}, 0.0)
+}
+
+func TestLoadTypePunnedViews(t *testing.T) {
+	// float32 1.5 and -2
+	raw := []uint8{0, 0, 0xc0, 0x3f, 0, 0, 0, 0xc0}
+	for _, async := range []bool{false, true} {
+		var result interface{}
+		if async {
+			var done <-chan error
+			result, done = LoadAsync(path.Join("testdata", "synthetic_type_punned_views.pt"))
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			var err error
+			result, err = Load(path.Join("testdata", "synthetic_type_punned_views.pt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		tensors := result.(*types.OrderedDict)
+		byteTensor := tensors.MustGet("bytes").(*Tensor)
+		data, err := byteTensor.GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUInt8SliceEqual(t, data.([]uint8), raw)
+
+		floatTensor := tensors.MustGet("floats").(*Tensor)
+		if dtype := floatTensor.Dtype(); dtype != Float32 {
+			t.Errorf("expected dtype float32, actual %v", dtype)
+		}
+		assertTensorFloat32Data(t, floatTensor, []float32{1.5, -2})
+		// the storage is left untouched
+		bytes := byteTensor.Source.(*ByteStorage).Data
+		assertUInt8SliceEqual(t, bytes, raw)
+
+		// both views share the same bytes
+		bytes[3] = 0x40 // 1.5 becomes 6
+		assertTensorFloat32Data(t, floatTensor, []float32{6, -2})
+		floatTensor.Source.(*FloatStorage).Data[1] = 2
+		assertUInt8SliceEqual(t, bytes, []uint8{0, 0, 0xc0, 0x40, 0, 0, 0, 0x40})
+	}
+}
+
+func TestLoadLegacyTar(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_legacy_tar.pt")
+	check := func(t *testing.T, result interface{}) {
+		tensors := result.(*types.OrderedDict)
+		weight := tensors.MustGet("weight").(*Tensor)
+		assertIntSliceEqual(t, weight.Size, []int{2, 3})
+		assertIntSliceEqual(t, weight.Stride, []int{3, 1})
+		assertTensorFloat32Data(t, weight, []float32{1, 2, 3, 4, 5, 6})
+
+		row := tensors.MustGet("row").(*Tensor)
+		if row.Source != weight.Source {
+			t.Error("expected row to share the storage of weight")
+		}
+		assertTensorFloat32Data(t, row, []float32{4, 5, 6})
+
+		mask := tensors.MustGet("mask").(*Tensor)
+		data, err := mask.GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUInt8SliceEqual(t, data.([]uint8), []uint8{1, 1})
+		if location := mask.Source.(*ByteStorage).Location; location != "cpu" {
+			t.Errorf("expected location cpu, actual %q", location)
+		}
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		result, err := Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, result)
+	})
+	t.Run("LoadFromReader", func(t *testing.T) {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := LoadFromReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, result)
+	})
+	t.Run("MaxTensors", func(t *testing.T) {
+		_, err := LoadWithOptions(filename, LoadOptions{MaxTensors: 2})
+		if !errors.Is(err, ErrTooManyTensors) {
+			t.Errorf("expected ErrTooManyTensors, actual %v", err)
+		}
+	})
+	t.Run("missing member", func(t *testing.T) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		err := tw.WriteHeader(&tar.Header{Name: "sys_info", Mode: 0644})
+		if err == nil {
+			err = tw.Close()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assertErrorContains(t, err, "tar member 'storages' not found")
+	})
+}
+
+func TestLoadLegacyCUDAStorages(t *testing.T) {
+	cuda := func(data []byte) []byte {
+		data = bytes.Replace(data, []byte("torch\nFloatStorage"), []byte("torch.cuda\nFloatStorage"), -1)
+		return bytes.Replace(data, []byte("torch\nByteStorage"), []byte("torch.cuda\nByteStorage"), -1)
+	}
+
+	t.Run("no tar", func(t *testing.T) {
+		data, err := ioutil.ReadFile(path.Join("testdata", "tensor_float32_proto2.pt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = cuda(data)
+		result, err := LoadFromReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := result.(*Tensor).Source.(*FloatStorage); !ok {
+			t.Errorf("expected *FloatStorage, actual %T", result.(*Tensor).Source)
+		}
+	})
+
+	t.Run("tar", func(t *testing.T) {
+		original, err := ioutil.ReadFile(path.Join("testdata", "synthetic_legacy_tar.pt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		tr := tar.NewReader(bytes.NewReader(original))
+		tw := tar.NewWriter(&buf)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = cuda(data)
+			header.Size = int64(len(data))
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(buf.Bytes(), []byte("torch.cuda\nFloatStorage")) {
+			t.Fatal("expected CUDA storage classes")
+		}
+		result, err := LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tensors := result.(*types.OrderedDict)
+		assertTensorFloat32Data(t, tensors.MustGet("weight").(*Tensor), []float32{1, 2, 3, 4, 5, 6})
+		if _, ok := tensors.MustGet("mask").(*Tensor).Source.(*ByteStorage); !ok {
+			t.Errorf("expected *ByteStorage, actual %T", tensors.MustGet("mask").(*Tensor).Source)
+		}
+	})
+}
+
+func TestBFloat16Tensors(t *testing.T) {
+	tensors := loadTensorsWithOptions(t, path.Join("testdata", "synthetic_bfloat16.pt"), LoadOptions{})
+	typed := tensors["typed"]
+	if dtype := typed.Dtype(); dtype != BFloat16 {
+		t.Errorf("expected dtype bfloat16, actual %v", dtype)
+	}
+	assertTensorFloat32Data(t, typed, []float32{1.5, -2, 3.140625})
+	untyped := tensors["untyped"]
+	if dtype := untyped.Dtype(); dtype != BFloat16 {
+		t.Errorf("expected dtype bfloat16, actual %v", dtype)
+	}
+	assertTensorFloat32Data(t, untyped, []float32{-0.5, 65536})
+
+	t.Run("round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := saveZip(&buf, typed); err != nil {
+			t.Fatal(err)
+		}
+		result, err := LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorFloat32Data(t, result.(*Tensor), []float32{1.5, -2, 3.140625})
+	})
+
+	t.Run("rounding", func(t *testing.T) {
+		// 1 + 2^-8 and 1 + 3 * 2^-8 are halfway between two bfloat16
+		// values, and are rounded to the even one
+		tensor := &Tensor{
+			Source: &BFloat16Storage{
+				BaseStorage: BaseStorage{Size: 3},
+				Data:        []float32{1.00390625, 1.01171875, float32(math.NaN())},
+			},
+			Size:   []int{3},
+			Stride: []int{1},
+		}
+		data, err := tensor.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertUInt8SliceEqual(t, data, []uint8{0x80, 0x3f, 0x82, 0x3f, 0xc0, 0x7f})
+	})
+}
+
+func TestComplexTensors(t *testing.T) {
+	tensors := loadTensorsWithOptions(t, path.Join("testdata", "synthetic_complex.pt"), LoadOptions{})
+	testCases := []struct {
+		name     string
+		dtype    *Dtype
+		expected interface{}
+	}{
+		{"typed", Complex64, []complex64{complex(1.5, -2), complex(0, 0.25)}},
+		{"untyped", Complex128, []complex128{complex(-1, 3), complex(0.5, -0.5)}},
+	}
+	for _, tc := range testCases {
+		tensor := tensors[tc.name]
+		if dtype := tensor.Dtype(); dtype != tc.dtype {
+			t.Errorf("%s: expected dtype %v, actual %v", tc.name, tc.dtype, dtype)
+		}
+		data, err := tensor.GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, tc.expected) {
+			t.Errorf("%s: expected %v, actual %v", tc.name, tc.expected, data)
+		}
+
+		var buf bytes.Buffer
+		if err := saveZip(&buf, tensor); err != nil {
+			t.Fatal(err)
+		}
+		result, err := LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := result.(*Tensor).GetData(); !reflect.DeepEqual(data, tc.expected) {
+			t.Errorf("%s: round trip: expected %v, actual %v", tc.name, tc.expected, data)
+		}
+	}
+
+	t.Run("big-endian", func(t *testing.T) {
+		// complex(1.5, -2) with each part in big-endian order
+		data := []byte{0x3f, 0xc0, 0, 0, 0xc0, 0, 0, 0}
+		storage := (&ComplexFloatStorageClass{}).New(1, "cpu")
+		err := setStorageData(storage, &ComplexFloatStorageClass{}, bytes.NewReader(data), 1, binary.BigEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := storage.(*ComplexFloatStorage).Data; !reflect.DeepEqual(actual, []complex64{complex(1.5, -2)}) {
+			t.Errorf("expected [(1.5-2i)], actual %v", actual)
+		}
+
+		// the bytes of an untyped storage are not swapped
+		untyped := (&UntypedStorageClass{}).New(4, "cpu")
+		err = setStorageData(untyped, &UntypedStorageClass{}, bytes.NewReader(data[:4]), 4, binary.BigEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := untyped.(*UntypedStorage).Data; !bytes.Equal(actual, data[:4]) {
+			t.Errorf("expected %v, actual %v", data[:4], actual)
+		}
+	})
+}
+
+func TestLoadIntegerStorageKeys(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_integer_storage_keys.pt")
+	for _, useMmap := range []bool{false, true} {
+		tensors := loadTensorsWithOptions(t, filename, LoadOptions{UseMmap: useMmap})
+		assertTensorFloat32Data(t, tensors["fc.weight"], []float32{1, 2, 3})
+		data, err := tensors["fc.bias"].GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, []int64{7}) {
+			t.Errorf("expected fc.bias [7], actual %v", data)
+		}
+		if tensors["fc.weight_copy"].Source != tensors["fc.weight"].Source {
+			t.Error("expected the tensors with the same key to share their storage")
+		}
+	}
+}
+
+func TestLoadLegacyStorageViews(t *testing.T) {
+	result, err := Load(path.Join("testdata", "synthetic_legacy_storage_views.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tensors := result.(*types.OrderedDict)
+	weightIH := tensors.MustGet("weight_ih_l0").(*Tensor)
+	assertTensorFloat32Data(t, weightIH, []float32{1, 2})
+	weightHH := tensors.MustGet("weight_hh_l0").(*Tensor)
+	assertIntSliceEqual(t, weightHH.Size, []int{2, 2})
+	assertTensorFloat32Data(t, weightHH, []float32{3, 4, 5, 6})
+
+	hhCopy := tensors.MustGet("weight_hh_l0_copy").(*Tensor)
+	if hhCopy.Source != weightHH.Source {
+		t.Error("expected the tensors of the same view to share their storage")
+	}
+	if weightIH.Source == weightHH.Source {
+		t.Error("expected distinct storages for distinct views")
+	}
+	// the views share the data of the root storage, which follows the
+	// elements of the first one
+	root := weightIH.Source.(*FloatStorage).Data[:6]
+	root[2] = 9
+	assertTensorFloat32Data(t, weightHH, []float32{9, 4, 5, 6})
+}
+
+func TestLoadLegacyInconsistentViews(t *testing.T) {
+	// writeViews makes a legacy file whose object is a list of the given
+	// views of the same root storage of 4 elements
+	type view struct {
+		key          string
+		offset, size int
+	}
+	writeViews := func(t *testing.T, views ...view) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		magic, _ := new(big.Int).SetString(hexMagicNumber, 16)
+		for _, obj := range []interface{}{magic, protocolVersion, types.NewDict()} {
+			if err := pickle.NewPickler(&buf).Dump(obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p := pickle.NewPickler(&buf)
+		p.PersistentId = func(obj interface{}) (interface{}, bool) {
+			v, ok := obj.(view)
+			if !ok {
+				return nil, false
+			}
+			return &types.Tuple{"storage", types.NewGenericClass("torch", "FloatStorage"),
+				"root", "cpu", 4, &types.Tuple{v.key, v.offset, v.size}}, true
+		}
+		list := make(types.List, len(views))
+		for i, v := range views {
+			list[i] = v
+		}
+		err := p.Dump(&list)
+		if err == nil {
+			err = pickle.NewPickler(&buf).Dump(&types.List{"root"})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write([]byte{4, 0, 0, 0, 0, 0, 0, 0})
+		buf.Write(make([]byte, 4*4))
+		return buf.Bytes()
+	}
+
+	data := writeViews(t, view{"v", 1, 2}, view{"v", 1, 2})
+	result, err := LoadFromReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := *result.(*types.List)
+	if list[0] != list[1] {
+		t.Error("expected the references to the same view to share it")
+	}
+
+	data = writeViews(t, view{"v", 1, 2}, view{"v", 0, 2})
+	_, err = LoadFromReader(bytes.NewReader(data), int64(len(data)))
+	assertErrorContains(t, err, "view v: inconsistent with its previous references")
+
+	data = writeViews(t, view{"root", 1, 2})
+	_, err = LoadFromReader(bytes.NewReader(data), int64(len(data)))
+	assertErrorContains(t, err, "view root: inconsistent")
+}
+
+// brokenTensor is pickled as a call to "_rebuild_tensor_v2" with invalid
+// arguments.
+type brokenTensor struct{}
+
+func (brokenTensor) PyReduce() (interface{}, *types.Tuple, error) {
+	class := types.NewGenericClass("torch._utils", "_rebuild_tensor_v2")
+	return class, &types.Tuple{"not a storage"}, nil
+}
+
+func TestContinueOnTensorError(t *testing.T) {
+	checkpoint := types.NewDict()
+	checkpoint.Set("good", newFloatTensor([]float32{1, 2}, 2))
+	checkpoint.Set("broken", brokenTensor{})
+	filename := path.Join(t.TempDir(), "checkpoint.pt")
+	if err := Save(checkpoint, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(filename)
+	assertErrorContains(t, err, "RebuildTensorV2 unexpected args")
+
+	result, tensorErrs, err := LoadWithTensorErrors(filename,
+		LoadOptions{ContinueOnTensorError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensorErrs) != 1 {
+		t.Fatalf("expected 1 tensor error, actual %v", tensorErrs)
+	}
+	assertErrorContains(t, tensorErrs[0], "RebuildTensorV2 unexpected args")
+	loaded := result.(*types.Dict)
+	assertTensorFloat32Data(t, loaded.MustGet("good").(*Tensor), []float32{1, 2})
+	broken := loaded.MustGet("broken").(*Tensor)
+	if broken.Err != tensorErrs[0] || broken.Source != nil {
+		t.Errorf("expected a tensor with only the error, actual %#v", broken)
+	}
+	if _, err := broken.GetData(); err != tensorErrs[0] {
+		t.Errorf("expected GetData to fail with %v, actual %v", tensorErrs[0], err)
+	}
+	if _, err := broken.GetDataAsFloat32(); err != tensorErrs[0] {
+		t.Errorf("expected GetDataAsFloat32 to fail with %v, actual %v", tensorErrs[0], err)
+	}
+	if _, err := broken.GetDataAsFloat64(); err != tensorErrs[0] {
+		t.Errorf("expected GetDataAsFloat64 to fail with %v, actual %v", tensorErrs[0], err)
+	}
+}
+
+func TestContinueOnStorageError(t *testing.T) {
+	checkpoint := types.NewDict()
+	checkpoint.Set("good", newFloatTensor([]float32{1, 2}, 2))
+	checkpoint.Set("odd", newDoubleTensor([]float64{3}, 1))
+	dir := t.TempDir()
+	src := path.Join(dir, "checkpoint.pt")
+	if err := Save(checkpoint, src); err != nil {
+		t.Fatal(err)
+	}
+	pickled := namedZipRecord(t, src, "archive/data.pkl")
+	// the storage of the "odd" tensor is "archive/data/1"
+	isOdd := func(name string) bool { return name == "archive/data/1" }
+
+	testCases := []struct {
+		name     string
+		keep     func(name string) bool
+		extra    map[string][]byte
+		expected string
+	}{
+		{
+			name: "unknown dtype",
+			keep: func(name string) bool { return name != "archive/data.pkl" },
+			extra: map[string][]byte{"archive/data.pkl": bytes.Replace(pickled,
+				[]byte("\nDoubleStorage\n"), []byte("\nFloat8_e4m3fnStorage\n"), 1)},
+			expected: "class not found: torch Float8_e4m3fnStorage",
+		},
+		{
+			name:     "missing storage record",
+			keep:     func(name string) bool { return !isOdd(name) },
+			expected: "cannot find zip record '1'",
+		},
+		{
+			name:     "truncated storage record",
+			keep:     func(name string) bool { return !isOdd(name) },
+			extra:    map[string][]byte{"archive/data/1": {0, 0, 0, 0}},
+			expected: "requires 8 bytes, but its zip record has only 4 bytes",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := path.Join(dir, strings.ReplaceAll(tc.name, " ", "_")+".pt")
+			copyZipRecords(t, src, filename, tc.keep, tc.extra)
+			_, err := Load(filename)
+			assertErrorContains(t, err, tc.expected)
+
+			for _, opts := range []LoadOptions{{}, {Concurrency: 2}, {Lazy: true}} {
+				opts.ContinueOnTensorError = true
+				result, tensorErrs, err := LoadWithTensorErrors(filename, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(tensorErrs) != 1 {
+					t.Fatalf("expected 1 tensor error, actual %v", tensorErrs)
+				}
+				assertErrorContains(t, tensorErrs[0], tc.expected)
+				loaded := result.(*types.Dict)
+				assertTensorFloat32Data(t, loaded.MustGet("good").(*Tensor), []float32{1, 2})
+				if odd := loaded.MustGet("odd").(*Tensor); odd.Err != tensorErrs[0] {
+					t.Errorf("expected a tensor with the error, actual %#v", odd)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFromReader(t *testing.T) {
+	for _, filename := range []string{
+		"synthetic_training_checkpoint.pt",
+		"tensor_float32_proto2_zip.pt",
+		"tensor_float32_proto2.pt", // legacy
+	} {
+		t.Run(filename, func(t *testing.T) {
+			filename := path.Join("testdata", filename)
+			expected := loadTensorsWithOptions(t, filename, LoadOptions{})
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := LoadFromReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := tensorsOf(t, result)
+			if len(actual) != len(expected) {
+				t.Fatalf("expected %d tensors, actual %d", len(expected), len(actual))
+			}
+			for name, tensor := range expected {
+				assertTensorsEqual(t, actual[name], tensor)
+			}
+		})
+	}
+}
+
+func TestLoadFromReaderWithOptions(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("testdata", "synthetic_rng_checkpoint.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadFromReader(bytes.NewReader(data), int64(len(data)))
+	assertErrorContains(t, err, "RNG generators cannot be restored")
+
+	result, err := LoadFromReaderWithOptions(bytes.NewReader(data), int64(len(data)),
+		LoadOptions{AllowUnknownClasses: true, Lazy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.(*types.Dict); !ok {
+		t.Errorf("expected *types.Dict, actual %T", result)
+	}
+}
+
+func TestLoadFromStream(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("testdata", "tensor_float32_proto2.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := LoadFromStream(iotest.HalfReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tensor, ok := result.(*Tensor)
+	if !ok {
+		t.Fatalf("expected *Tensor, got %#v", result)
+	}
+	assertCommonTensorFields(t, tensor)
+}
+
+func TestRequiresGrad(t *testing.T) {
+	tensors, err := LoadStateDict(path.Join("testdata", "synthetic_parameters.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{
+		"weight":       true,  // parameter
+		"frozen":       false, // parameter with requires_grad=False
+		"running_mean": false, // buffer
+		"grad":         true,  // tensor requiring grad
+		"legacy":       false, // _rebuild_tensor
+	}
+	check := func(t *testing.T, tensors map[string]*Tensor) {
+		for name, requiresGrad := range expected {
+			tensor, ok := tensors[name]
+			if !ok {
+				t.Errorf("%s: tensor not found", name)
+				continue
+			}
+			if tensor.RequiresGrad != requiresGrad {
+				t.Errorf("%s: expected RequiresGrad %v, actual %v",
+					name, requiresGrad, tensor.RequiresGrad)
+			}
+			assertTensorFloat32Data(t, tensor, []float32{1, 2})
+		}
+	}
+	check(t, tensors)
+
+	t.Run("round trip", func(t *testing.T) {
+		stateDict := types.NewOrderedDict()
+		for name, tensor := range tensors {
+			stateDict.Set(name, tensor)
+		}
+		var buf bytes.Buffer
+		if err := saveZip(&buf, stateDict); err != nil {
+			t.Fatal(err)
+		}
+		obj, err := LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reloaded, _, err := stateDictTensors(obj, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, reloaded)
+	})
+}
+
+func TestLoadWithNormalizedInts(t *testing.T) {
+	newUnpickler := func(r io.Reader) pickle.Unpickler {
+		u := pickle.NewUnpickler(r)
+		u.NormalizeInts = true
+		return u
+	}
+	for _, filename := range makeFilenames("tensor_float32") {
+		t.Run(filename, func(t *testing.T) {
+			result, err := LoadWithUnpickler(path.Join("testdata", filename), newUnpickler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tensor, ok := result.(*Tensor)
+			if !ok {
+				t.Fatalf("expected *Tensor, got %#v", result)
+			}
+			assertCommonTensorFields(t, tensor)
+		})
+	}
+}
+
+func TestStorageLargerThanRecord(t *testing.T) {
+	_, err := Load(path.Join("testdata", "synthetic_truncated_storage.pt"))
+	assertErrorContains(t, err, "requires 16 bytes, but its zip record has only 12 bytes")
+}
+
 func loadTensorFromFile(t *testing.T, filename string) *Tensor {
 	result, err := Load(path.Join("testdata", filename))
 	if err != nil {
@@ -309,3 +968,745 @@ func assertBaseStorageFields(t *testing.T, bs BaseStorage, size int, location st
 		t.Errorf("expected storage Location %#v, got %#v", location, bs.Location)
 	}
 }
+
+func TestLoadNumpyScalars(t *testing.T) {
+	result, err := Load(path.Join("testdata", "synthetic_numpy_scalars.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, ok := result.(*types.Dict)
+	if !ok {
+		t.Fatalf("expected *types.Dict, got %T", result)
+	}
+	if loss, _ := checkpoint.Get("best_loss"); loss != 0.5 {
+		t.Errorf("expected best_loss float64(0.5), actual %#v", loss)
+	}
+	if step, _ := checkpoint.Get("best_step"); step != int64(42) {
+		t.Errorf("expected best_step int64(42), actual %#v", step)
+	}
+}
+
+func TestStorageReadBufferSize(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	expected, err := LoadStateDict(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bufferSize := range []int{1, 16, 4096} {
+		actual, err := LoadStateDictWithOptions(filename,
+			LoadOptions{StorageReadBufferSize: bufferSize})
+		if err != nil {
+			t.Fatalf("buffer size %d: %v", bufferSize, err)
+		}
+		for name, tensor := range expected {
+			assertTensorsEqual(t, actual[name], tensor)
+		}
+	}
+}
+
+func BenchmarkStorageReadBufferSize(b *testing.B) {
+	const n = 1 << 22
+	filename := path.Join(b.TempDir(), "tensor.pt")
+	if err := Save(newFloatTensor(make([]float32, n), n), filename); err != nil {
+		b.Fatal(err)
+	}
+	for _, bufferSize := range []int{4 << 10, 64 << 10, 1 << 20, 16 << 20} {
+		b.Run(fmt.Sprintf("%dKiB", bufferSize>>10), func(b *testing.B) {
+			b.SetBytes(4 * n)
+			opts := LoadOptions{StorageReadBufferSize: bufferSize}
+			for i := 0; i < b.N; i++ {
+				if _, err := LoadWithOptions(filename, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxTensors(t *testing.T) {
+	testCases := []struct {
+		filename   string
+		numTensors int
+	}{
+		{"synthetic_training_checkpoint.pt", 6},
+		{"synthetic_python2_state_dict.pt", 2}, // legacy format
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			filename := path.Join("testdata", tc.filename)
+			_, err := LoadWithOptions(filename, LoadOptions{MaxTensors: tc.numTensors})
+			if err != nil {
+				t.Errorf("expected no error with MaxTensors %d, actual %v", tc.numTensors, err)
+			}
+			_, err = LoadWithOptions(filename, LoadOptions{MaxTensors: tc.numTensors - 1})
+			if !errors.Is(err, ErrTooManyTensors) {
+				t.Fatalf("expected ErrTooManyTensors, actual %v", err)
+			}
+			expected := fmt.Sprintf("more than %d", tc.numTensors-1)
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected error containing %q, actual %q", expected, err)
+			}
+		})
+	}
+}
+
+func TestUnsignedTensors(t *testing.T) {
+	tensors, err := LoadStateDict(path.Join("testdata", "synthetic_unsigned_tensors.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		dtype    *Dtype
+		expected []uint64
+	}{
+		{"uint16", Uint16, []uint64{1, 40000, 65535}},
+		{"uint32", Uint32, []uint64{1, 3000000000, 4294967295}},
+		{"uint64", Uint64, []uint64{1, 1<<63 + 5, 1<<64 - 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tensor, ok := tensors[tc.name]
+			if !ok {
+				t.Fatal("tensor not found")
+			}
+			if dtype := tensor.Dtype(); dtype != tc.dtype {
+				t.Errorf("expected dtype %v, actual %v", tc.dtype, dtype)
+			}
+			actual, err := tensor.GetDataAsUint64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v, actual %v", tc.expected, actual)
+			}
+		})
+	}
+
+	data, err := tensors["uint16"].GetData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []uint16{1, 40000, 65535}; !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %#v, actual %#v", expected, data)
+	}
+}
+
+// projectConfig is pickled as an instance of a class of a project, which
+// PyTorch knows nothing about.
+type projectConfig struct {
+	hiddenSize int
+}
+
+func (c projectConfig) PyReduce() (interface{}, *types.Tuple, error) {
+	return types.NewGenericClass("myproject.config", "Config"), &types.Tuple{c.hiddenSize}, nil
+}
+
+// cpuDevice is pickled as "torch.device('cpu')".
+type cpuDevice struct{}
+
+func (cpuDevice) PyReduce() (interface{}, *types.Tuple, error) {
+	return types.NewGenericClass("torch", "device"), &types.Tuple{"cpu"}, nil
+}
+
+func TestExtraFindClass(t *testing.T) {
+	checkpoint := types.NewDict()
+	checkpoint.Set("config", projectConfig{hiddenSize: 16})
+	checkpoint.Set("device", cpuDevice{})
+	checkpoint.Set("weight", newFloatTensor([]float32{1, 2}, 2))
+	filename := path.Join(t.TempDir(), "checkpoint.pt")
+	if err := Save(checkpoint, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(filename)
+	assertErrorContains(t, err, "class not found: myproject.config Config")
+
+	opts := LoadOptions{
+		ExtraFindClass: func(module, name string) (interface{}, bool) {
+			switch module + "." + name {
+			case "myproject.config.Config":
+				return callableFunc(func(args ...interface{}) (interface{}, error) {
+					return projectConfig{hiddenSize: args[0].(int)}, nil
+				}), true
+			case "torch.device":
+				// the built-in classes can be overridden too
+				return callableFunc(func(args ...interface{}) (interface{}, error) {
+					return "stubbed device", nil
+				}), true
+			}
+			return nil, false
+		},
+	}
+	result, err := LoadWithOptions(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := result.(*types.Dict)
+	if config := loaded.MustGet("config"); config != (projectConfig{hiddenSize: 16}) {
+		t.Errorf("unexpected config %#v", config)
+	}
+	if device := loaded.MustGet("device"); device != "stubbed device" {
+		t.Errorf("unexpected device %#v", device)
+	}
+	assertTensorFloat32Data(t, loaded.MustGet("weight").(*Tensor), []float32{1, 2})
+}
+
+func TestRegisterClass(t *testing.T) {
+	checkpoint := types.NewDict()
+	checkpoint.Set("config", projectConfig{hiddenSize: 16})
+	checkpoint.Set("device", cpuDevice{})
+	filename := path.Join(t.TempDir(), "checkpoint.pt")
+	if err := Save(checkpoint, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	newConfigClass := func() interface{} {
+		return callableFunc(func(args ...interface{}) (interface{}, error) {
+			return projectConfig{hiddenSize: args[0].(int)}, nil
+		})
+	}
+	RegisterClass("myproject.config", "Config", newConfigClass)
+	RegisterClass("torch", "device", func() interface{} {
+		return callableFunc(func(args ...interface{}) (interface{}, error) {
+			return "registered device", nil
+		})
+	})
+	defer RegisterClass("myproject.config", "Config", nil)
+	defer RegisterClass("torch", "device", nil)
+
+	result, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := result.(*types.Dict)
+	if config := loaded.MustGet("config"); config != (projectConfig{hiddenSize: 16}) {
+		t.Errorf("unexpected config %#v", config)
+	}
+	if device := loaded.MustGet("device"); device != "registered device" {
+		t.Errorf("unexpected device %#v", device)
+	}
+
+	t.Run("ExtraFindClass first", func(t *testing.T) {
+		opts := LoadOptions{
+			ExtraFindClass: func(module, name string) (interface{}, bool) {
+				if module == "torch" && name == "device" {
+					return &DeviceClass{}, true
+				}
+				return nil, false
+			},
+		}
+		result, err := LoadWithOptions(filename, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if device := result.(*types.Dict).MustGet("device"); device != "cpu" {
+			t.Errorf("unexpected device %#v", device)
+		}
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		RegisterClass("myproject.config", "Config", nil)
+		defer RegisterClass("myproject.config", "Config", newConfigClass)
+		_, err := Load(filename)
+		assertErrorContains(t, err, "class not found: myproject.config Config")
+	})
+}
+
+func TestMapLocation(t *testing.T) {
+	tensor := newFloatTensor([]float32{1, 2}, 2)
+	tensor.Source.(*FloatStorage).Location = "cuda:1"
+	filename := path.Join(t.TempDir(), "cuda.pt")
+	if err := Save(tensor, filename); err != nil {
+		t.Fatal(err)
+	}
+	location := func(obj interface{}) string {
+		return obj.(*Tensor).Source.(*FloatStorage).Location
+	}
+
+	// by default, the storages are loaded on the CPU
+	for _, lazy := range []bool{false, true} {
+		result, err := LoadWithOptions(filename, LoadOptions{Lazy: lazy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc := location(result); loc != "cpu" {
+			t.Errorf("expected location cpu, actual %q", loc)
+		}
+		if saved := result.(*Tensor).Source.(*FloatStorage).SavedLocation; saved != "cuda:1" {
+			t.Errorf("expected the saved location cuda:1, actual %q", saved)
+		}
+	}
+	result, err := LoadWithOptions(filename, LoadOptions{
+		MapLocation: func(location string) string { return location },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := location(result); loc != "cuda:1" {
+		t.Errorf("expected the original location cuda:1, actual %q", loc)
+	}
+	if saved := result.(*Tensor).Source.(*FloatStorage).SavedLocation; saved != "" {
+		t.Errorf("expected no saved location, actual %q", saved)
+	}
+
+	for _, name := range []string{filename, path.Join("testdata", "tensor_float32_proto2.pt")} {
+		for _, lazy := range []bool{false, true} {
+			var original []string
+			opts := LoadOptions{
+				Lazy: lazy,
+				MapLocation: func(location string) string {
+					original = append(original, location)
+					return "cpu"
+				},
+			}
+			result, err := LoadWithOptions(name, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc := location(result); loc != "cpu" {
+				t.Errorf("%s: expected location cpu, actual %q", name, loc)
+			}
+			if len(original) != 1 {
+				t.Errorf("%s: expected 1 location, actual %v", name, original)
+			}
+		}
+	}
+
+	t.Run("tar", func(t *testing.T) {
+		locations := make(map[string]bool)
+		_, err := LoadWithOptions(path.Join("testdata", "synthetic_legacy_tar.pt"), LoadOptions{
+			MapLocation: func(location string) string {
+				locations[location] = true
+				return location
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !locations["cpu"] {
+			t.Errorf("expected the location cpu, actual %v", locations)
+		}
+	})
+}
+
+func TestAllowUnknownClasses(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_dill_checkpoint.pt")
+
+	_, err := Load(filename)
+	assertErrorContains(t, err, "AllowUnknownClasses")
+
+	result, err := LoadWithOptions(filename, LoadOptions{AllowUnknownClasses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := result.(*types.Dict)
+
+	tensors, _, err := stateDictTensors(checkpoint, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTensorFloat32Data(t, tensors["fc.weight"], []float32{1, 2})
+
+	lrLambda, ok := checkpoint.MustGet("lr_lambda").(*UnknownObject)
+	if !ok || lrLambda.Class.String() != "dill._dill._create_function" {
+		t.Errorf("expected a _create_function placeholder, actual %#v", lrLambda)
+	} else if code, ok := lrLambda.Args[0].(*UnknownObject); !ok || code.Class.Name != "_create_code" {
+		t.Errorf("expected a _create_code placeholder, actual %#v", lrLambda.Args[0])
+	}
+
+	dtype, ok := checkpoint.MustGet("dtype").(*UnknownClass)
+	if !ok || dtype.String() != "builtins.float" {
+		t.Errorf("expected builtins.float placeholder, actual %#v", checkpoint.MustGet("dtype"))
+	}
+
+	expectedPoint := &types.Tuple{3, 4}
+	if point := checkpoint.MustGet("point"); !reflect.DeepEqual(point, expectedPoint) {
+		t.Errorf("expected namedtuple %#v, actual %#v", expectedPoint, point)
+	}
+
+	// class Cfg(dict): pass
+	// cfg = foo.Cfg(lr=0.5); cfg.name = 'x'
+	// pickle.dumps(cfg, protocol=2)
+	pickled := "\x80\x02cfoo\nCfg\nq\x00)\x81q\x01X\x02\x00\x00\x00lrq\x02G?\xe0\x00\x00\x00\x00\x00\x00s}q\x03X\x04\x00\x00\x00nameq\x04X\x01\x00\x00\x00xq\x05sb."
+	result, err = LoadPickle(strings.NewReader(pickled), LoadOptions{AllowUnknownClasses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, ok := result.(*UnknownObject)
+	if !ok || cfg.DictItems == nil || cfg.DictItems.MustGet("lr") != 0.5 {
+		t.Errorf("expected a dict subclass placeholder with lr=0.5, actual %#v", result)
+	} else if state, ok := cfg.State.(*types.Dict); !ok || state.MustGet("name") != "x" {
+		t.Errorf("expected state {name: x}, actual %#v", cfg.State)
+	}
+
+	// the placeholders are used even if the FindClass of the Unpickler
+	// fails
+	opts := LoadOptions{
+		AllowUnknownClasses: true,
+		NewUnpickler: func(r io.Reader) pickle.Unpickler {
+			u := pickle.NewUnpickler(r)
+			u.FindClass = func(module, name string) (interface{}, error) {
+				return nil, &pickle.ClassNotFoundError{Module: module, Name: name}
+			}
+			return u
+		},
+	}
+	result, err = LoadPickle(strings.NewReader(pickled), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.(*UnknownObject); !ok {
+		t.Errorf("expected a placeholder, actual %#v", result)
+	}
+	opts.AllowUnknownClasses = false
+	_, err = LoadPickle(strings.NewReader(pickled), opts)
+	assertErrorContains(t, err, "class not found: foo Cfg")
+}
+
+func TestLoadFallbackFromZipToLegacy(t *testing.T) {
+	dir := t.TempDir()
+	emptyZip := func(t *testing.T, w io.Writer) {
+		t.Helper()
+		zw := zip.NewWriter(w)
+		fw, err := zw.Create("archive/readme.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte("not a checkpoint")); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("legacy file with trailing zip", func(t *testing.T) {
+		legacy, err := ioutil.ReadFile(path.Join("testdata", "tensor_float32_proto2.pt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.Write(legacy)
+		emptyZip(t, &buf)
+		filename := path.Join(dir, "legacy_with_zip.pt")
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if !isZipFile(filename) {
+			t.Fatal("expected the file to be detected as a zip file")
+		}
+
+		for name, load := range map[string]func() (interface{}, error){
+			"Load": func() (interface{}, error) { return Load(filename) },
+			"LoadAsync": func() (interface{}, error) {
+				result, done := LoadAsync(filename)
+				return result, <-done
+			},
+		} {
+			result, err := load()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			tensor, ok := result.(*Tensor)
+			if !ok {
+				t.Fatalf("%s: expected *Tensor, got %#v", name, result)
+			}
+			assertTensorFloat32Data(t, tensor, []float32{1.2, -3.4, 5.6, -7.8})
+		}
+	})
+
+	t.Run("zip which is not a torch archive", func(t *testing.T) {
+		var buf bytes.Buffer
+		emptyZip(t, &buf)
+		filename := path.Join(dir, "not_torch.zip")
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(filename)
+		if !errors.Is(err, ErrNotTorchArchive) {
+			t.Errorf("expected ErrNotTorchArchive, actual %v", err)
+		}
+		assertErrorContains(t, err, "loading as legacy file")
+	})
+
+	t.Run("not a zip", func(t *testing.T) {
+		filename := path.Join(dir, "garbage.pt")
+		if err := ioutil.WriteFile(filename, []byte("garbage"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(filename)
+		if err == nil || errors.Is(err, ErrNotTorchArchive) {
+			t.Errorf("expected a legacy loading error, actual %v", err)
+		}
+	})
+}
+
+func TestLoadZipFileErrors(t *testing.T) {
+	src := path.Join("testdata", "tensor_float32_proto2_zip.pt")
+	dir := t.TempDir()
+
+	t.Run("missing storage record", func(t *testing.T) {
+		filename := path.Join(dir, "missing_storage.pt")
+		copyZipRecords(t, src, filename, func(name string) bool {
+			return !strings.Contains(name, "/data/")
+		}, nil)
+		for _, opts := range []LoadOptions{{}, {Lazy: true}} {
+			_, err := LoadWithOptions(filename, opts)
+			assertErrorContains(t, err, "cannot find zip record '94264067392672'")
+		}
+		_, done := LoadAsync(filename)
+		assertErrorContains(t, <-done, "cannot find zip record '94264067392672'")
+	})
+
+	t.Run("TorchScript", func(t *testing.T) {
+		filename := path.Join(dir, "torchscript.pt")
+		copyZipRecords(t, src, filename, nil, map[string][]byte{
+			"tensor_float32_proto2_zip/constants.pkl": []byte("\x80\x02).")})
+		_, err := Load(filename)
+		assertErrorContains(t, err, "TorchScript is not supported")
+	})
+}
+
+// copyZipRecords writes a copy of the zip file src to dst, with only the
+// records for which keep returns true, if it is not nil, followed by the
+// extra records.
+func copyZipRecords(t *testing.T, src, dst string, keep func(name string) bool, extra map[string][]byte) {
+	t.Helper()
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		if keep != nil && !keep(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method})
+		if err == nil {
+			_, err = io.Copy(w, rc)
+		}
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range extra {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// namedZipRecord returns the content of the named record of a zip file.
+func namedZipRecord(t *testing.T, filename, name string) []byte {
+	t.Helper()
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name == name {
+			return readZipRecord(t, f)
+		}
+	}
+	t.Fatalf("zip record %q not found", name)
+	return nil
+}
+
+func TestProtocolErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeLegacy := func(t *testing.T, name string, torchProtocol int, pickleData []byte) string {
+		t.Helper()
+		magic, _ := new(big.Int).SetString(hexMagicNumber, 16)
+		var buf bytes.Buffer
+		for _, obj := range []interface{}{magic, torchProtocol} {
+			if err := pickle.NewPickler(&buf).Dump(obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		buf.Write(pickleData)
+		filename := path.Join(dir, name)
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	t.Run("bad torch protocol", func(t *testing.T) {
+		filename := writeLegacy(t, "torch_protocol.pt", 1002, []byte("\x80\x02N."))
+		_, err := Load(filename)
+		if !errors.Is(err, ErrInvalidProtocolVersion) || errors.Is(err, ErrUnsupportedProtocol) {
+			t.Errorf("expected ErrInvalidProtocolVersion, actual %v", err)
+		}
+		assertErrorContains(t, err, "serialization protocol version 1002, expected 1001")
+	})
+
+	t.Run("unsupported pickle protocol", func(t *testing.T) {
+		// sys_info pickled with a protocol from the future
+		filename := writeLegacy(t, "pickle_protocol.pt", 1001, []byte("\x80\x06N."))
+		_, err := Load(filename)
+		if !errors.Is(err, ErrUnsupportedProtocol) || errors.Is(err, ErrInvalidProtocolVersion) {
+			t.Errorf("expected ErrUnsupportedProtocol, actual %v", err)
+		}
+		assertErrorContains(t, err, "unsupported pickle protocol 6, the highest supported is 5")
+	})
+}
+
+func TestLoadRNGStates(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_rng_checkpoint.pt")
+
+	_, err := Load(filename)
+	assertErrorContains(t, err, "torch Generator")
+
+	// the ints are normalized, since the Python RNG state does not fit in
+	// an int on 32-bit platforms
+	result, err := LoadWithOptions(filename, LoadOptions{
+		AllowUnknownClasses: true,
+		NewUnpickler: func(r io.Reader) pickle.Unpickler {
+			u := pickle.NewUnpickler(r)
+			u.NormalizeInts = true
+			return u
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := result.(*types.Dict)
+
+	tensors, err := LoadStateDictWithOptions(filename, LoadOptions{AllowUnknownClasses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTensorFloat32Data(t, tensors["fc.weight"], []float32{1, 2})
+
+	expectedPythonState := &types.Tuple{
+		int64(3), &types.Tuple{int64(2147483648), int64(1), int64(2), int64(3), int64(624)}, nil,
+	}
+	if state := checkpoint.MustGet("python_rng_state"); !reflect.DeepEqual(state, expectedPythonState) {
+		t.Errorf("expected Python RNG state %#v, actual %#v", expectedPythonState, state)
+	}
+
+	torchState := checkpoint.MustGet("torch_rng_state").(*Tensor)
+	if torchState.Dtype() != Uint8 {
+		t.Errorf("expected torch.uint8 RNG state, actual %v", torchState.Dtype())
+	}
+	data, err := torchState.GetData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertUInt8SliceEqual(t, data.([]uint8), []uint8{0, 1, 2, 3, 4, 5, 6, 7})
+
+	generator, ok := checkpoint.MustGet("generator").(*UnknownObject)
+	if !ok || generator.Class.String() != "torch.Generator" {
+		t.Fatalf("expected a torch.Generator placeholder, actual %#v", checkpoint.MustGet("generator"))
+	}
+	state, ok := generator.State.(*types.Tuple)
+	if !ok || state.Len() != 3 {
+		t.Fatalf("expected (state, seed, offset) generator state, actual %#v", generator.State)
+	}
+	genData, err := state.Get(0).(*Tensor).GetData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertUInt8SliceEqual(t, genData.([]uint8), []uint8{9, 8, 7, 6})
+	if seed := state.Get(1); seed != int64(42) {
+		t.Errorf("expected seed 42, actual %#v", seed)
+	}
+}
+
+func TestLegacyWrappedStorageKeys(t *testing.T) {
+	tensors, err := LoadStateDict(path.Join("testdata", "synthetic_legacy_wrapped_keys.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTensorFloat32Data(t, tensors["weight"], []float32{1, 2})
+	assertTensorFloat32Data(t, tensors["bias"], []float32{3})
+}
+
+func TestMakeStorageKeys(t *testing.T) {
+	keys, err := makeStorageKeys(&types.List{"0", types.Bytes("1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"0", "1"}) {
+		t.Errorf("expected keys [0 1], actual %v", keys)
+	}
+
+	_, err = makeStorageKeys(&types.List{"0", 1})
+	assertErrorContains(t, err, "invalid storage key at index 1")
+	_, err = makeStorageKeys(types.NewDict())
+	assertErrorContains(t, err, "list of strings expected")
+}
+
+func TestUnpickleZipEntry(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	expected, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entryName := range []string{"data.pkl", "archive/data.pkl"} {
+		result, err := UnpickleZipEntry(filename, entryName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedTensors, _, _ := stateDictTensors(expected, false)
+		actualTensors, _, err := stateDictTensors(result, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, tensor := range expectedTensors {
+			assertTensorsEqual(t, actualTensors[name], tensor)
+		}
+	}
+
+	_, err = UnpickleZipEntry(filename, "missing.pkl")
+	assertErrorContains(t, err, `entry "missing.pkl" not found`)
+	_, err = UnpickleZipEntry(filename, "version")
+	assertErrorContains(t, err, `cannot unpickle entry "version"`)
+}
+
+func TestUnpickleZipEntryStorageDirectory(t *testing.T) {
+	dir := t.TempDir()
+	src := path.Join(dir, "tensor.pt")
+	if err := Save(newFloatTensor([]float32{1, 2}, 2), src); err != nil {
+		t.Fatal(err)
+	}
+	// constants.pkl refers to its own storage "0", as data.pkl does
+	filename := path.Join(dir, "constants.pt")
+	var constant bytes.Buffer
+	if err := binary.Write(&constant, binary.LittleEndian, []float32{5, 6}); err != nil {
+		t.Fatal(err)
+	}
+	copyZipRecords(t, src, filename, nil, map[string][]byte{
+		"archive/constants.pkl": namedZipRecord(t, src, "archive/data.pkl"),
+		"archive/constants/0":   constant.Bytes(),
+	})
+	for entryName, expected := range map[string][]float32{
+		"data.pkl":      {1, 2},
+		"constants.pkl": {5, 6},
+	} {
+		result, err := UnpickleZipEntry(filename, entryName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorFloat32Data(t, result.(*Tensor), expected)
+	}
+}
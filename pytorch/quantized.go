@@ -0,0 +1,260 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// QScheme represents a PyTorch quantization scheme ("torch.qscheme"), such
+// as "torch.per_tensor_affine". As for Dtype, the same few instances are
+// always shared, so they can be compared by pointer.
+type QScheme struct {
+	// Name is the PyTorch name of the scheme, without the "torch." prefix.
+	Name string
+}
+
+var (
+	PerTensorAffine              = &QScheme{Name: "per_tensor_affine"}
+	PerChannelAffine             = &QScheme{Name: "per_channel_affine"}
+	PerTensorSymmetric           = &QScheme{Name: "per_tensor_symmetric"}
+	PerChannelSymmetric          = &QScheme{Name: "per_channel_symmetric"}
+	PerChannelAffineFloatQParams = &QScheme{Name: "per_channel_affine_float_qparams"}
+)
+
+// qschemes maps the names of the "torch" module attributes which refer to
+// a quantization scheme.
+var qschemes = map[string]*QScheme{
+	PerTensorAffine.Name:              PerTensorAffine,
+	PerChannelAffine.Name:             PerChannelAffine,
+	PerTensorSymmetric.Name:           PerTensorSymmetric,
+	PerChannelSymmetric.Name:          PerChannelSymmetric,
+	PerChannelAffineFloatQParams.Name: PerChannelAffineFloatQParams,
+}
+
+// String returns the Python representation of the scheme, such as
+// "torch.per_tensor_affine".
+func (q *QScheme) String() string {
+	return "torch." + q.Name
+}
+
+// Quantizer holds the parameters needed to dequantize the integer values
+// of a quantized tensor.
+type Quantizer struct {
+	Scheme *QScheme
+	// Scale and ZeroPoint are the parameters of the per-tensor schemes.
+	Scale     float64
+	ZeroPoint int64
+	// Scales and ZeroPoints are the 1-dimensional tensors holding the
+	// parameters of each channel along the dimension Axis, for the
+	// per-channel schemes.
+	Scales     *Tensor
+	ZeroPoints *Tensor
+	Axis       int
+}
+
+// RebuildQTensor represents "torch._utils._rebuild_qtensor", which makes
+// a quantized tensor. The resulting *Tensor has its Quantizer set.
+type RebuildQTensor struct {
+	counter *tensorCounter
+}
+
+var _ types.Callable = &RebuildQTensor{}
+
+func (r *RebuildQTensor) Call(args ...interface{}) (interface{}, error) {
+	// args: storage, storage_offset, size, stride, quantizer_params,
+	// requires_grad, backward_hooks
+	if len(args) != 7 {
+		return nil, fmt.Errorf("RebuildQTensor unexpected args: %#v", args)
+	}
+	// arg[6] "backward hooks" is unused
+	storage, storageOk := args[0].(StorageInterface)
+	params, paramsOk := args[4].(*types.Tuple)
+	if !storageOk || !paramsOk {
+		return nil, fmt.Errorf("RebuildQTensor unexpected args: %#v", args)
+	}
+	quantizer, err := makeQuantizer(params)
+	if err != nil {
+		return nil, fmt.Errorf("RebuildQTensor: %w", err)
+	}
+	tensor, err := rebuildTensor("RebuildQTensor", r.counter, storage,
+		[]interface{}{storage, args[1], args[2], args[3], args[5]})
+	if err != nil {
+		return nil, err
+	}
+	tensor.Quantizer = quantizer
+	return tensor, nil
+}
+
+// makeQuantizer returns a Quantizer from the quantizer_params of
+// "_rebuild_qtensor", that is (qscheme, scale, zero_point) for the
+// per-tensor schemes, and (qscheme, scales, zero_points, axis) for the
+// per-channel ones.
+func makeQuantizer(params *types.Tuple) (*Quantizer, error) {
+	if params.Len() == 0 {
+		return nil, fmt.Errorf("empty quantizer params")
+	}
+	scheme, ok := params.Get(0).(*QScheme)
+	if !ok {
+		return nil, fmt.Errorf("unexpected quantization scheme %#v", params.Get(0))
+	}
+	switch scheme {
+	case PerTensorAffine, PerTensorSymmetric:
+		if params.Len() != 3 {
+			return nil, fmt.Errorf("unexpected %v params: %#v", scheme, params)
+		}
+		scale, scaleOk := params.Get(1).(float64)
+		zeroPoint, zeroPointOk := toInt(params.Get(2))
+		if !scaleOk || !zeroPointOk {
+			return nil, fmt.Errorf("unexpected %v params: %#v", scheme, params)
+		}
+		return &Quantizer{Scheme: scheme, Scale: scale, ZeroPoint: int64(zeroPoint)}, nil
+	case PerChannelAffine, PerChannelSymmetric, PerChannelAffineFloatQParams:
+		if params.Len() != 4 {
+			return nil, fmt.Errorf("unexpected %v params: %#v", scheme, params)
+		}
+		scales, scalesOk := params.Get(1).(*Tensor)
+		zeroPoints, zeroPointsOk := params.Get(2).(*Tensor)
+		axis, axisOk := toInt(params.Get(3))
+		if !scalesOk || !zeroPointsOk || !axisOk {
+			return nil, fmt.Errorf("unexpected %v params: %#v", scheme, params)
+		}
+		return &Quantizer{
+			Scheme:     scheme,
+			Scales:     scales,
+			ZeroPoints: zeroPoints,
+			Axis:       axis,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported quantization scheme %v", scheme)
+	}
+}
+
+// Dequantize returns a new contiguous float32 tensor with the values of a
+// quantized tensor, like "Tensor.dequantize" in Python, that is
+// (q - zero_point) * scale for each integer value q, or q * scale +
+// zero_point for the per_channel_affine_float_qparams scheme.
+//
+// The values are interpreted according to the data type: torch.qint8 and
+// torch.qint32 values are signed, torch.quint8 values are unsigned.
+func (t *Tensor) Dequantize() (*Tensor, error) {
+	q := t.Quantizer
+	if q == nil {
+		return nil, fmt.Errorf("Dequantize: tensor is not quantized")
+	}
+	data, err := t.GetData()
+	if err != nil {
+		return nil, err
+	}
+	values, ok := quantizedValues(data)
+	if !ok {
+		return nil, fmt.Errorf("Dequantize: unsupported tensor of type %v", t.Dtype())
+	}
+
+	result := make([]float32, len(values))
+	if q.Scales == nil {
+		for i, v := range values {
+			result[i] = float32(float64(v-q.ZeroPoint) * q.Scale)
+		}
+	} else {
+		axis := q.Axis
+		if axis < 0 {
+			axis += len(t.Size)
+		}
+		if axis < 0 || axis >= len(t.Size) {
+			return nil, fmt.Errorf("Dequantize: axis %d out of range for %d-dimensional tensor",
+				q.Axis, len(t.Size))
+		}
+		scales, err := channelParams(q.Scales, t.Size[axis])
+		if err != nil {
+			return nil, fmt.Errorf("Dequantize: scales: %w", err)
+		}
+		zeroPoints, err := channelParams(q.ZeroPoints, t.Size[axis])
+		if err != nil {
+			return nil, fmt.Errorf("Dequantize: zero points: %w", err)
+		}
+		inner := numel(t.Size[axis+1:])
+		for i, v := range values {
+			c := (i / inner) % t.Size[axis]
+			if q.Scheme == PerChannelAffineFloatQParams {
+				result[i] = float32(float64(v)*scales[c] + zeroPoints[c])
+			} else {
+				result[i] = float32((float64(v) - zeroPoints[c]) * scales[c])
+			}
+		}
+	}
+
+	location := ""
+	if bs, ok := t.Source.(baseStorager); ok {
+		location = bs.baseStorage().Location
+	}
+	return &Tensor{
+		Source: &FloatStorage{
+			BaseStorage: BaseStorage{Size: len(result), Location: location},
+			Data:        result,
+		},
+		Size:   append([]int(nil), t.Size...),
+		Stride: contiguousStride(t.Size),
+	}, nil
+}
+
+// quantizedValues returns the elements of the Data slice of a quantized
+// storage as int64 values, honoring their signedness.
+func quantizedValues(data interface{}) ([]int64, bool) {
+	var values []int64
+	switch d := data.(type) {
+	case []int8:
+		values = make([]int64, len(d))
+		for i, v := range d {
+			values[i] = int64(v)
+		}
+	case []uint8:
+		values = make([]int64, len(d))
+		for i, v := range d {
+			values[i] = int64(v)
+		}
+	case []int32:
+		values = make([]int64, len(d))
+		for i, v := range d {
+			values[i] = int64(v)
+		}
+	default:
+		return nil, false
+	}
+	return values, true
+}
+
+// channelParams returns the elements of a tensor of per-channel quantizer
+// parameters as float64 values, checking that there is one per channel.
+func channelParams(t *Tensor, channels int) ([]float64, error) {
+	if t.Numel() != channels {
+		return nil, fmt.Errorf("%d values expected, got %d", channels, t.Numel())
+	}
+	data, err := t.GetData()
+	if err != nil {
+		return nil, err
+	}
+	params := make([]float64, channels)
+	switch d := data.(type) {
+	case []float64:
+		copy(params, d)
+	case []float32:
+		for i, v := range d {
+			params[i] = float64(v)
+		}
+	case []int64:
+		for i, v := range d {
+			params[i] = float64(v)
+		}
+	case []int32:
+		for i, v := range d {
+			params[i] = float64(v)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tensor of type %v", t.Dtype())
+	}
+	return params, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestQuantizedTensors(t *testing.T) {
+	tensors, err := LoadStateDict(path.Join("testdata", "synthetic_quantized_state_dict.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		dtype    *Dtype
+		scheme   *QScheme
+		expected []float32
+	}{
+		// the same bytes, 0, 128 and 255, with scale 0.5 and zero point 1
+		{"quint8", QUInt8, PerTensorAffine, []float32{-0.5, 63.5, 127}},
+		{"qint8", QInt8, PerTensorAffine, []float32{-0.5, -64.5, -1}},
+		// [[2, 4], [-2, 6]], with scales [0.5, 0.25] and zero points [0, 2]
+		{"per_channel", QInt8, PerChannelAffine, []float32{1, 2, -1, 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tensor, ok := tensors[tc.name]
+			if !ok {
+				t.Fatalf("%s not found", tc.name)
+			}
+			if tensor.Dtype() != tc.dtype {
+				t.Errorf("expected type %v, actual %v", tc.dtype, tensor.Dtype())
+			}
+			if tensor.Quantizer == nil || tensor.Quantizer.Scheme != tc.scheme {
+				t.Fatalf("expected %v quantizer, actual %#v", tc.scheme, tensor.Quantizer)
+			}
+			dequantized, err := tensor.Dequantize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertIntSliceEqual(t, dequantized.Size, tensor.Size)
+			assertTensorFloat32Data(t, dequantized, tc.expected)
+		})
+	}
+
+	t.Run("not quantized", func(t *testing.T) {
+		_, err := newFloatTensor([]float32{1}, 1).Dequantize()
+		assertErrorContains(t, err, "not quantized")
+	})
+}
+
+func TestQuantizedLinear(t *testing.T) {
+	result, err := Load(path.Join("testdata", "synthetic_quantized_linear.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDict := result.(*types.OrderedDict)
+	if dtype := stateDict.MustGet("fc._packed_params.dtype"); dtype != QInt8 {
+		t.Errorf("expected dtype torch.qint8, actual %v", dtype)
+	}
+	assertTensorFloat32Data(t, stateDict.MustGet("fc.scale").(*Tensor), []float32{0.25})
+
+	packed := stateDict.MustGet("fc._packed_params._packed_params").(*types.Tuple)
+	if packed.Len() != 2 {
+		t.Fatalf("expected (weight, bias), actual %#v", packed)
+	}
+	weight := packed.Get(0).(*Tensor)
+	assertIntSliceEqual(t, weight.Size, []int{2, 2})
+	data, err := weight.GetData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int8{10, -10, 20, 0}; !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected raw values %v, actual %v", expected, data)
+	}
+	q := weight.Quantizer
+	if q == nil || q.Scheme != PerTensorAffine || q.Scale != 0.1 || q.ZeroPoint != 0 {
+		t.Fatalf("unexpected quantizer %#v", q)
+	}
+	dequantized, err := weight.Dequantize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTensorFloat32Data(t, dequantized, []float32{1, -1, 2, 0})
+	assertTensorFloat32Data(t, packed.Get(1).(*Tensor), []float32{0.5, -0.5})
+}
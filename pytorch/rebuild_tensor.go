@@ -5,11 +5,40 @@
 package pytorch
 
 import (
+	"errors"
 	"fmt"
 	"github.com/nlpodyssey/gopickle/types"
+	"io"
 )
 
-type RebuildTensorV2 struct{}
+// RebuildTensor represents "torch._utils._rebuild_tensor", used by the
+// oldest versions of PyTorch, whose tensors never require grad.
+type RebuildTensor struct {
+	counter *tensorCounter
+}
+
+var _ types.Callable = &RebuildTensor{}
+
+func (r *RebuildTensor) Call(args ...interface{}) (interface{}, error) {
+	// args: storage, storage_offset, size, stride
+	if len(args) != 4 {
+		return nil, fmt.Errorf("RebuildTensor unexpected args: %#v", args)
+	}
+	storage, storageOk := args[0].(StorageInterface)
+	if !storageOk {
+		return nil, fmt.Errorf("RebuildTensor unexpected args: %#v", args)
+	}
+	// requires_grad is always false (the slice is copied, not to modify args)
+	tensor, err := rebuildTensor("RebuildTensor", r.counter, storage, append(args[:4:4], false))
+	if err != nil {
+		return nil, err
+	}
+	return tensor, nil
+}
+
+type RebuildTensorV2 struct {
+	counter *tensorCounter
+}
 
 var _ types.Callable = &RebuildTensorV2{}
 
@@ -18,14 +47,196 @@ func (r *RebuildTensorV2) Call(args ...interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("RebuildTensorV2 unexpected args: %#v", args)
 	}
 	storage, storageOk := args[0].(StorageInterface)
-	storageOffset, storageOffsetOk := args[1].(int)
+	// arg[5] "backward hooks" is unused
+	if !storageOk {
+		return nil, fmt.Errorf("RebuildTensorV2 unexpected args: %#v", args)
+	}
+	tensor, err := rebuildTensor("RebuildTensorV2", r.counter, storage, args)
+	if err != nil {
+		return nil, err
+	}
+	return tensor, nil
+}
+
+// RebuildTensorV3 represents "torch._utils._rebuild_tensor_v3". Unlike
+// RebuildTensorV2, the data type of the tensor is given explicitly, and
+// it is used to interpret untyped storages: the size of each element is
+// determined by the data type, not by the storage class.
+type RebuildTensorV3 struct {
+	counter *tensorCounter
+}
+
+var _ types.Callable = &RebuildTensorV3{}
+
+func (r *RebuildTensorV3) Call(args ...interface{}) (interface{}, error) {
+	// args: storage, storage_offset, size, stride, requires_grad,
+	// backward_hooks, dtype, and optional metadata
+	if len(args) != 7 && len(args) != 8 {
+		return nil, fmt.Errorf("RebuildTensorV3 unexpected args: %#v", args)
+	}
+	// arg[5] "backward hooks" and arg[7] "metadata" are unused
+	rawStorage, storageOk := args[0].(StorageInterface)
+	dtype, dtypeOk := args[6].(*Dtype)
+	if !storageOk || !dtypeOk {
+		return nil, fmt.Errorf("RebuildTensorV3 unexpected args: %#v", args)
+	}
+	storage, err := storageWithDtype(rawStorage, dtype)
+	if err != nil {
+		return nil, fmt.Errorf("RebuildTensorV3: %w", err)
+	}
+	tensor, err := rebuildTensor("RebuildTensorV3", r.counter, storage, args)
+	if err != nil {
+		return nil, err
+	}
+	return tensor, nil
+}
+
+// RebuildParameter represents "torch._utils._rebuild_parameter", which
+// makes a Parameter ("torch.nn.Parameter") out of a tensor. The resulting
+// value is the same *Tensor, with RequiresGrad set as given.
+type RebuildParameter struct{}
+
+var _ types.Callable = &RebuildParameter{}
+
+func (r *RebuildParameter) Call(args ...interface{}) (interface{}, error) {
+	// args: data, requires_grad, backward_hooks
+	if len(args) != 3 {
+		return nil, fmt.Errorf("RebuildParameter unexpected args: %#v", args)
+	}
+	return rebuildParameter("RebuildParameter", args)
+}
+
+// RebuildParameterWithState represents
+// "torch._utils._rebuild_parameter_with_state". It is like RebuildParameter,
+// but for Parameter subclasses, whose additional state is ignored.
+type RebuildParameterWithState struct{}
+
+var _ types.Callable = &RebuildParameterWithState{}
+
+func (r *RebuildParameterWithState) Call(args ...interface{}) (interface{}, error) {
+	// args: data, requires_grad, backward_hooks, state
+	if len(args) != 4 {
+		return nil, fmt.Errorf("RebuildParameterWithState unexpected args: %#v", args)
+	}
+	return rebuildParameter("RebuildParameterWithState", args)
+}
+
+func rebuildParameter(name string, args []interface{}) (interface{}, error) {
+	// arg[2] "backward hooks" is unused
+	tensor, tensorOk := args[0].(*Tensor)
+	requiresGrad, requiresGradOk := args[1].(bool)
+	if !tensorOk || !requiresGradOk {
+		return nil, fmt.Errorf("%s unexpected args: %#v", name, args)
+	}
+	tensor.RequiresGrad = requiresGrad
+	return tensor, nil
+}
+
+// storageWithDtype returns a storage whose elements have the given data
+// type, interpreting the bytes of an UntypedStorage if necessary.
+//
+// A typed storage of another data type is type-punned: a tensor viewing
+// it as a different type, such as float32 values over a uint8 storage,
+// gets a view of its raw bytes reinterpreted as that type (see
+// untypedView), shared by all the tensors with the same type.
+func storageWithDtype(storage StorageInterface, dtype *Dtype) (StorageInterface, error) {
+	if us, ok := storage.(*UntypedStorage); ok {
+		return us.Reinterpret(dtype)
+	}
+	if sd := storageDtype(storage); sd != nil && sd != dtype {
+		us, err := untypedView(storage)
+		if err != nil {
+			return nil, err
+		}
+		typed, err := us.Reinterpret(dtype)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"storage of type %s cannot hold a tensor of type %s: %w", sd, dtype, err)
+		}
+		return typed, nil
+	}
+	return storage, nil
+}
+
+// tensorErrors collects the errors of the tensors which could not be
+// rebuilt (see LoadOptions.ContinueOnTensorError).
+type tensorErrors struct {
+	errs []error
+}
+
+// tolerantRebuild wraps a function rebuilding a tensor, so that a failure
+// results in a Tensor holding the error, which is also collected by errs,
+// instead of aborting the load.
+type tolerantRebuild struct {
+	rebuild types.Callable
+	errs    *tensorErrors
+}
+
+var _ types.Callable = &tolerantRebuild{}
+
+func (r *tolerantRebuild) Call(args ...interface{}) (interface{}, error) {
+	result, err := r.rebuild.Call(args...)
+	if err == nil || errors.Is(err, ErrTooManyTensors) {
+		return result, err
+	}
+	r.errs.errs = append(r.errs.errs, err)
+	return &Tensor{Err: err}, nil
+}
+
+// failedStorageClass is the placeholder, resolved when tensor errors are
+// tolerated, of a storage class which is not supported, such as the one
+// of a data type unknown here. Its storages are failedStorage values
+// holding the same error.
+type failedStorageClass struct {
+	err error
+}
+
+var _ StorageClassInterface = &failedStorageClass{}
+
+func (c *failedStorageClass) New(_ int, _ string) StorageInterface {
+	return &failedStorage{err: c.err}
+}
+
+// failedStorage is a storage whose data could not be read, because its
+// class is not supported or because of an error reading its record. The
+// tensors viewing it are rebuilt as a Tensor holding the error (see
+// tolerantRebuild).
+type failedStorage struct {
+	err error
+}
+
+var _ StorageInterface = &failedStorage{}
+
+func (s *failedStorage) SetFromFile(_ io.Reader) error {
+	return s.err
+}
+
+func (s *failedStorage) SetFromFileWithSize(_ io.Reader, _ int) error {
+	return s.err
+}
+
+// rebuildTensor makes a new Tensor from the given storage and the
+// storage_offset, size, stride and requires_grad arguments, which are
+// shared by all tensor rebuild functions (args[1:5]). The tensor is
+// counted by counter, which may be nil.
+func rebuildTensor(
+	name string,
+	counter *tensorCounter,
+	storage StorageInterface,
+	args []interface{},
+) (*Tensor, error) {
+	if err := counter.add(); err != nil {
+		return nil, err
+	}
+	if fs, ok := storage.(*failedStorage); ok {
+		return nil, fmt.Errorf("%s: %w", name, fs.err)
+	}
+	storageOffset, storageOffsetOk := toInt(args[1])
 	size, sizeOk := args[2].(*types.Tuple)
 	stride, strideOk := args[3].(*types.Tuple)
 	requiresGrad, requiresGradOk := args[4].(bool)
-	// arg[5] "backward hooks" is unused
-	if !storageOk || !storageOffsetOk || !sizeOk || !strideOk ||
-		!requiresGradOk {
-		return nil, fmt.Errorf("RebuildTensorV2 unexpected args: %#v", args)
+	if !storageOffsetOk || !sizeOk || !strideOk || !requiresGradOk {
+		return nil, fmt.Errorf("%s unexpected args: %#v", name, args)
 	}
 
 	tensor := &Tensor{
@@ -45,11 +256,39 @@ func (r *RebuildTensorV2) Call(args ...interface{}) (interface{}, error) {
 	return tensor, nil
 }
 
+// tensorCounter counts the tensors rebuilt while loading a file, failing
+// as soon as they are more than max (see LoadOptions.MaxTensors).
+type tensorCounter struct {
+	count int
+	max   int
+}
+
+// newTensorCounter returns a new tensorCounter, or nil if max is not
+// positive, that is, when the tensors are not limited.
+func newTensorCounter(max int) *tensorCounter {
+	if max <= 0 {
+		return nil
+	}
+	return &tensorCounter{max: max}
+}
+
+// add counts one more tensor. It does nothing on a nil tensorCounter.
+func (c *tensorCounter) add() error {
+	if c == nil {
+		return nil
+	}
+	c.count++
+	if c.count > c.max {
+		return fmt.Errorf("%w: more than %d", ErrTooManyTensors, c.max)
+	}
+	return nil
+}
+
 func tupleToIntSlice(tuple *types.Tuple) ([]int, error) {
 	length := tuple.Len()
 	slice := make([]int, length)
 	for i := 0; i < length; i++ {
-		value, ok := tuple.Get(i).(int)
+		value, ok := toInt(tuple.Get(i))
 		if !ok {
 			return nil, fmt.Errorf("tuple of ints expected: %#v", tuple)
 		}
@@ -57,3 +296,16 @@ func tupleToIntSlice(tuple *types.Tuple) ([]int, error) {
 	}
 	return slice, nil
 }
+
+// toInt returns the value of an integer decoded by the Unpickler, which is
+// an int, or an int64 if the Unpickler NormalizeInts option is set.
+func toInt(v interface{}) (int, bool) {
+	switch i := v.(type) {
+	case int:
+		return i, true
+	case int64:
+		return int(i), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import "sync"
+
+var (
+	registryMu sync.RWMutex
+	// registeredClasses are the factories registered by RegisterClass, by
+	// qualified name.
+	registeredClasses = make(map[string]func() interface{})
+)
+
+// RegisterClass makes the global module.name of any file loaded by this
+// package resolve to the value returned by factory, which is called once
+// for each file referencing it. For example, the classes of a project
+// deriving from "torch.nn.Module" can be made to load as a *Module with:
+//
+//	pytorch.RegisterClass("myproject.model", "Encoder", func() interface{} {
+//		return pytorch.NewModuleClass("myproject.model", "Encoder")
+//	})
+//
+// The registered classes take precedence over the built-in PyTorch
+// classes and the FindClass function of the Unpickler, but not over
+// LoadOptions.ExtraFindClass, which is the way to resolve a class for a
+// single call. Registering a nil factory removes the class. RegisterClass
+// is safe for concurrent use, but it is usually called at initialization.
+func RegisterClass(module, name string, factory func() interface{}) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	qualifiedName := module + "." + name
+	if factory == nil {
+		delete(registeredClasses, qualifiedName)
+		return
+	}
+	registeredClasses[qualifiedName] = factory
+}
+
+// registeredClass returns a new instance of the class registered for the
+// global module.name, if any.
+func registeredClass(module, name string) (interface{}, bool) {
+	registryMu.RLock()
+	factory, ok := registeredClasses[module+"."+name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+)
+
+// Repickle writes obj, such as a structure returned by Load, to w as a
+// plain pickle of the given protocol, from 2 to pickle.HighestProtocol,
+// as Python "pickle.dump" of the same object would. The result can be
+// read back by LoadPickle, and by "pickle.load" in Python, with torch
+// installed.
+//
+// obj can be made of any value supported by pickle.Pickler. Tensors are
+// reduced as by Save, while their storages, which cannot be persistent
+// IDs outside of a PyTorch file, are reduced to calls to
+// "torch.storage._load_from_bytes", which holds their data in the legacy
+// format. A storage shared by more tensors is written only once, and
+// loaded back as a single storage.
+func Repickle(obj interface{}, w io.Writer, protocol int) error {
+	if protocol < 2 || protocol > int(pickle.HighestProtocol) {
+		return fmt.Errorf("Repickle: %w %d", ErrUnsupportedProtocol, protocol)
+	}
+	p := pickle.NewPickler(w)
+	p.Protocol = byte(protocol)
+	p.ReducerOverride = func(obj interface{}) (types.PyReducible, bool) {
+		if storage, ok := obj.(StorageInterface); ok {
+			return storageBytes{storage}, true
+		}
+		return nil, false
+	}
+	return p.Dump(obj)
+}
+
+// storageBytes reduces a storage in the same way of the "__reduce__"
+// method of PyTorch storages.
+type storageBytes struct {
+	storage StorageInterface
+}
+
+func (s storageBytes) PyReduce() (interface{}, *types.Tuple, error) {
+	var buf bytes.Buffer
+	if err := saveLegacy(&buf, s.storage); err != nil {
+		return nil, nil, err
+	}
+	class := types.NewGenericClass("torch.storage", "_load_from_bytes")
+	return class, &types.Tuple{types.Bytes(buf.String())}, nil
+}
+
+// LoadPickle reads a plain pickle of an object holding PyTorch values, as
+// written by Repickle or by "pickle.dump" in Python, resolving the
+// PyTorch classes as LoadWithOptions does.
+func LoadPickle(r io.Reader, opts LoadOptions) (interface{}, error) {
+	opts = opts.withDefaults()
+	u := opts.NewUnpickler(r)
+	u.FindClass = makePickleFindClass(u.FindClass, opts)
+	return u.Load()
+}
+
+// LoadFromBytes represents "torch.storage._load_from_bytes", which
+// restores a storage pickled by itself, rather than as a persistent ID,
+// from its serialization in the legacy format.
+type LoadFromBytes struct {
+	opts LoadOptions
+}
+
+var _ types.Callable = &LoadFromBytes{}
+
+func (l *LoadFromBytes) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("LoadFromBytes: unexpected args: %#v", args)
+	}
+	b, ok := args[0].(types.Bytes)
+	if !ok {
+		return nil, fmt.Errorf("LoadFromBytes: unexpected args: %#v", args)
+	}
+	obj, err := loadLegacyNoTar(bytes.NewReader(b.Bytes()), l.opts)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFromBytes: %w", err)
+	}
+	storage, ok := obj.(StorageInterface)
+	if !ok {
+		return nil, fmt.Errorf("LoadFromBytes: storage expected, got %T", obj)
+	}
+	return storage, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRepickle(t *testing.T) {
+	expected, err := Load(path.Join("testdata", "synthetic_training_checkpoint.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTensors, _, err := stateDictTensors(expected.(*types.Dict).MustGet("model"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, protocol := range []int{2, 3, 4, 5} {
+		var buf bytes.Buffer
+		if err := Repickle(expected, &buf, protocol); err != nil {
+			t.Fatalf("protocol %d: %v", protocol, err)
+		}
+		actual, err := LoadPickle(&buf, LoadOptions{})
+		if err != nil {
+			t.Fatalf("protocol %d: %v", protocol, err)
+		}
+		checkpoint, ok := actual.(*types.Dict)
+		if !ok {
+			t.Fatalf("protocol %d: expected *types.Dict, actual %T", protocol, actual)
+		}
+		if epoch := checkpoint.MustGet("epoch"); epoch != 3 {
+			t.Errorf("protocol %d: expected epoch 3, actual %#v", protocol, epoch)
+		}
+		actualTensors, metadata, err := stateDictTensors(checkpoint.MustGet("model"), false)
+		if err != nil {
+			t.Fatalf("protocol %d: %v", protocol, err)
+		}
+		if metadata == nil {
+			t.Errorf("protocol %d: expected state dict metadata", protocol)
+		}
+		if len(actualTensors) != len(expectedTensors) {
+			t.Fatalf("protocol %d: expected %d tensors, actual %d",
+				protocol, len(expectedTensors), len(actualTensors))
+		}
+		for name, tensor := range expectedTensors {
+			assertTensorsEqual(t, actualTensors[name], tensor)
+		}
+	}
+}
+
+func TestRepickleSharedStorage(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2, 3, 4}, 4)
+	view := &Tensor{Source: weight.Source, StorageOffset: 2, Size: []int{2}, Stride: []int{1}}
+	var buf bytes.Buffer
+	if err := Repickle(&types.List{weight, view}, &buf, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "_load_from_bytes"); n != 1 {
+		t.Errorf("expected the storage to be written once, actual %d times", n)
+	}
+	loaded, err := LoadPickle(&buf, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tensors := *loaded.(*types.List)
+	if tensors[0].(*Tensor).Source != tensors[1].(*Tensor).Source {
+		t.Error("expected the tensors to share their storage")
+	}
+	assertTensorFloat32Data(t, tensors[1].(*Tensor), []float32{3, 4})
+}
+
+func TestRepickleUnsupportedProtocol(t *testing.T) {
+	err := Repickle(newFloatTensor([]float32{1}, 1), &bytes.Buffer{}, 1)
+	assertErrorContains(t, err, "unsupported pickle protocol 1")
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// returnTypesModule is the module of the named tuples returned by the
+// PyTorch functions with more results, such as "torch.max" along a
+// dimension, which returns a "torch.return_types.max" of values and
+// indices.
+const returnTypesModule = "torch.return_types"
+
+// returnTypeFields lists the field names of the most common
+// "torch.return_types" classes.
+var returnTypeFields = map[string][]string{
+	"max":                {"values", "indices"},
+	"min":                {"values", "indices"},
+	"sort":               {"values", "indices"},
+	"topk":               {"values", "indices"},
+	"kthvalue":           {"values", "indices"},
+	"mode":               {"values", "indices"},
+	"median":             {"values", "indices"},
+	"nanmedian":          {"values", "indices"},
+	"cummax":             {"values", "indices"},
+	"cummin":             {"values", "indices"},
+	"aminmax":            {"min", "max"},
+	"frexp":              {"mantissa", "exponent"},
+	"histogram":          {"hist", "bin_edges"},
+	"slogdet":            {"sign", "logabsdet"},
+	"qr":                 {"Q", "R"},
+	"svd":                {"U", "S", "V"},
+	"geqrf":              {"a", "tau"},
+	"triangular_solve":   {"solution", "cloned_coefficient"},
+	"lu_unpack":          {"P", "L", "U"},
+	"linalg_eig":         {"eigenvalues", "eigenvectors"},
+	"linalg_eigh":        {"eigenvalues", "eigenvectors"},
+	"linalg_qr":          {"Q", "R"},
+	"linalg_svd":         {"U", "S", "Vh"},
+	"linalg_slogdet":     {"sign", "logabsdet"},
+	"linalg_inv_ex":      {"inverse", "info"},
+	"linalg_cholesky_ex": {"L", "info"},
+	"linalg_lstsq":       {"solution", "residuals", "rank", "singular_values"},
+	"linalg_lu_factor":   {"LU", "pivots"},
+	"linalg_lu":          {"P", "L", "U"},
+	"linalg_ldl_factor":  {"LD", "pivots"},
+}
+
+// ReturnTypeClass represents a "torch.return_types" class. Its instances
+// are loaded as plain tuples of their values, like the namedtuples of
+// dill.
+type ReturnTypeClass struct {
+	Name string
+	// Fields are the names of the fields of the class, or nil if they are
+	// not known, in which case any number of values is accepted.
+	Fields []string
+}
+
+var _ types.Callable = &ReturnTypeClass{}
+
+// NewReturnTypeClass returns the ReturnTypeClass with the given name,
+// with its fields, if known.
+func NewReturnTypeClass(name string) *ReturnTypeClass {
+	return &ReturnTypeClass{Name: name, Fields: returnTypeFields[name]}
+}
+
+// Call returns a tuple of the values, as reduced by Python: a sequence of
+// them, and a dict of the additional fields which are not part of the
+// sequence, usually empty, which is ignored.
+func (c *ReturnTypeClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("%s.%s: unexpected args: %#v", returnTypesModule, c.Name, args)
+	}
+	var values []interface{}
+	switch v := args[0].(type) {
+	case *types.Tuple:
+		values = *v
+	case *types.List:
+		values = *v
+	default:
+		return nil, fmt.Errorf("%s.%s: unexpected args: %#v", returnTypesModule, c.Name, args)
+	}
+	if c.Fields != nil && len(values) != len(c.Fields) {
+		return nil, fmt.Errorf("%s.%s: expected %d values, got %d",
+			returnTypesModule, c.Name, len(c.Fields), len(values))
+	}
+	return types.NewTupleFromSlice(append([]interface{}(nil), values...)), nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"testing"
+)
+
+// returnType is pickled as a "torch.return_types" structseq, reduced to
+// its class, the sequence of its values and a dict of extra fields.
+type returnType struct {
+	name   string
+	values []interface{}
+}
+
+func (r returnType) PyReduce() (interface{}, *types.Tuple, error) {
+	class := types.NewGenericClass("torch.return_types", r.name)
+	return class, &types.Tuple{types.NewTupleFromSlice(r.values), types.NewDict()}, nil
+}
+
+func TestReturnTypes(t *testing.T) {
+	values := newFloatTensor([]float32{3, 4}, 2)
+	indices := &Tensor{
+		Source: &LongStorage{BaseStorage: BaseStorage{Size: 2, Location: "cpu"}, Data: []int64{1, 0}},
+		Size:   []int{2},
+		Stride: []int{1},
+	}
+	obj := types.NewDict()
+	obj.Set("max", returnType{"max", []interface{}{values, indices}})
+	obj.Set("min", returnType{"min", []interface{}{values, indices}})
+	obj.Set("custom", returnType{"custom_op", []interface{}{1, 2, 3}})
+	filename := path.Join(t.TempDir(), "results.pt")
+	if err := Save(obj, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := result.(*types.Dict)
+	for _, name := range []string{"max", "min"} {
+		tuple, ok := loaded.MustGet(name).(*types.Tuple)
+		if !ok || tuple.Len() != 2 {
+			t.Fatalf("%s: expected a tuple of 2 values, actual %#v", name, loaded.MustGet(name))
+		}
+		assertTensorsEqual(t, tuple.Get(0).(*Tensor), values)
+		assertTensorsEqual(t, tuple.Get(1).(*Tensor), indices)
+	}
+	if custom := loaded.MustGet("custom").(*types.Tuple); custom.Len() != 3 {
+		t.Errorf("expected a tuple of 3 values, actual %#v", custom)
+	}
+
+	bad := types.NewDict()
+	bad.Set("max", returnType{"max", []interface{}{values}})
+	if err := Save(bad, filename); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(filename)
+	assertErrorContains(t, err, "torch.return_types.max: expected 2 values, got 1")
+}
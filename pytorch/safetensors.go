@@ -0,0 +1,121 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// safetensorsDtypes maps each data type to its name in the header of a
+// ".safetensors" file.
+var safetensorsDtypes = map[*Dtype]string{
+	Float16:  "F16",
+	BFloat16: "BF16",
+	Float32:  "F32",
+	Float64:  "F64",
+	Int8:     "I8",
+	Int16:    "I16",
+	Int32:    "I32",
+	Int64:    "I64",
+	Uint8:    "U8",
+	Uint16:   "U16",
+	Uint32:   "U32",
+	Uint64:   "U64",
+	Bool:     "BOOL",
+}
+
+// safetensorsAlignment is the alignment of the data of a ".safetensors"
+// file, to which its header is padded with spaces.
+const safetensorsAlignment = 8
+
+// SafetensorsEntry describes where the data of a tensor is placed in a
+// ".safetensors" file.
+type SafetensorsEntry struct {
+	Name   string
+	Tensor *Tensor
+	// Dtype is the name of the data type in the header, such as "F32".
+	Dtype string
+	Shape []int
+	// Begin and End are the offsets of the first byte of the data and of
+	// the byte after the last one, relative to the end of the header.
+	Begin, End int64
+}
+
+// ToSafetensorsHeader returns the header of a ".safetensors" file holding
+// the given tensors, such as a loaded state dict, and the layout of their
+// data. The header includes the 8-byte little-endian length which starts
+// the file, and is padded so that the data which follows is aligned.
+//
+// The tensors are laid out in order of name, as in the returned entries:
+// writing the header, followed by Tensor.Bytes of each entry, makes a
+// complete file, which can be read, for example, by
+// "safetensors.torch.load_file". The safetensors package writes and reads
+// such files.
+func ToSafetensorsHeader(tensors map[string]*Tensor) (header []byte, dataLayout []SafetensorsEntry, err error) {
+	names := make([]string, 0, len(tensors))
+	for name := range tensors {
+		if name == "__metadata__" {
+			return nil, nil, fmt.Errorf("ToSafetensorsHeader: reserved tensor name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dataLayout = make([]SafetensorsEntry, len(names))
+	var offset int64
+	for i, name := range names {
+		t := tensors[name]
+		dtype := t.Dtype()
+		dtypeName, ok := safetensorsDtypes[dtype]
+		if !ok {
+			return nil, nil, fmt.Errorf("ToSafetensorsHeader: %q: unsupported data type %v", name, dtype)
+		}
+		size := int64(t.Numel()) * int64(dtype.ElementSize)
+		dataLayout[i] = SafetensorsEntry{
+			Name:   name,
+			Tensor: t,
+			Dtype:  dtypeName,
+			Shape:  append([]int{}, t.Size...),
+			Begin:  offset,
+			End:    offset + size,
+		}
+		offset += size
+	}
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	buf.WriteByte('{')
+	for i, entry := range dataLayout {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(entry.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ToSafetensorsHeader: %w", err)
+		}
+		buf.Write(name)
+		fmt.Fprintf(&buf, `:{"dtype":"%s","shape":[`, entry.Dtype)
+		for d, s := range entry.Shape {
+			if d > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.Itoa(s))
+		}
+		fmt.Fprintf(&buf, `],"data_offsets":[%d,%d]}`, entry.Begin, entry.End)
+	}
+	buf.WriteByte('}')
+	for buf.Len()%safetensorsAlignment != 0 {
+		buf.WriteByte(' ')
+	}
+
+	header = buf.Bytes()
+	binary.LittleEndian.PutUint64(header[:8], uint64(len(header)-8))
+	return header, dataLayout, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToSafetensorsHeader(t *testing.T) {
+	tensors := map[string]*Tensor{
+		"fc.weight": newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3),
+		"fc.bias": {
+			Source: &LongStorage{BaseStorage: BaseStorage{Size: 1}, Data: []int64{-7}},
+			Size:   []int{1},
+			Stride: []int{1},
+		},
+	}
+	header, layout, err := ToSafetensorsHeader(tensors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json := `{"fc.bias":{"dtype":"I64","shape":[1],"data_offsets":[0,8]},` +
+		`"fc.weight":{"dtype":"F32","shape":[2,3],"data_offsets":[8,32]}}`
+	json += strings.Repeat(" ", 7-(len(json)+7)%8)
+	if actual := string(header[8:]); actual != json {
+		t.Errorf("expected header %q, actual %q", json, actual)
+	}
+	if n := binary.LittleEndian.Uint64(header[:8]); n != uint64(len(json)) {
+		t.Errorf("expected header length %d, actual %d", len(json), n)
+	}
+	if len(header)%8 != 0 {
+		t.Errorf("expected an aligned header, actual length %d", len(header))
+	}
+
+	expected := []SafetensorsEntry{
+		{Name: "fc.bias", Tensor: tensors["fc.bias"], Dtype: "I64", Shape: []int{1}, Begin: 0, End: 8},
+		{Name: "fc.weight", Tensor: tensors["fc.weight"], Dtype: "F32", Shape: []int{2, 3}, Begin: 8, End: 32},
+	}
+	if !reflect.DeepEqual(layout, expected) {
+		t.Errorf("expected layout %#v, actual %#v", expected, layout)
+	}
+
+	// the data of the entries fills the ranges of their offsets
+	var data bytes.Buffer
+	for _, entry := range layout {
+		b, err := entry.Tensor.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(data.Len()) != entry.Begin || int64(data.Len()+len(b)) != entry.End {
+			t.Errorf("%s: data at %d to %d, expected %d to %d", entry.Name,
+				data.Len(), data.Len()+len(b), entry.Begin, entry.End)
+		}
+		data.Write(b)
+	}
+}
+
+func TestToSafetensorsHeaderErrors(t *testing.T) {
+	quantized := &Tensor{
+		Source: &QInt8Storage{BaseStorage: BaseStorage{Size: 1}, Data: []int8{1}},
+		Size:   []int{1},
+		Stride: []int{1},
+	}
+	_, _, err := ToSafetensorsHeader(map[string]*Tensor{"q": quantized})
+	assertErrorContains(t, err, `"q": unsupported data type torch.qint8`)
+
+	_, _, err = ToSafetensorsHeader(map[string]*Tensor{"__metadata__": newFloatTensor([]float32{1}, 1)})
+	assertErrorContains(t, err, "reserved tensor name")
+}
@@ -0,0 +1,303 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+)
+
+// recordAlignment is the alignment of the data of each record of the zip
+// archive written by Save, the same used by PyTorch.
+const recordAlignment = 64
+
+// storageClassNames maps each data type to the name of the corresponding
+// "torch" storage class.
+var storageClassNames = map[*Dtype]string{
+	Float16:  "HalfStorage",
+	BFloat16: "BFloat16Storage",
+	Float32:  "FloatStorage",
+	Float64:  "DoubleStorage",
+	Int8:     "CharStorage",
+	Int16:    "ShortStorage",
+	Int32:    "IntStorage",
+	Int64:    "LongStorage",
+	Uint8:    "ByteStorage",
+	Bool:     "BoolStorage",
+
+	Complex64:  "ComplexFloatStorage",
+	Complex128: "ComplexDoubleStorage",
+}
+
+// Save writes obj to the named file, in the zip-based format used by
+// "torch.save" since PyTorch 1.6. The file can be read back both by Load
+// and by "torch.load".
+//
+// obj can be made of any value supported by pickle.Pickler, including
+// tensors. Each distinct storage is written once, even when it is shared
+// by more tensors.
+func Save(obj interface{}, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := saveZip(f, obj); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SaveToWriter writes obj to w in the same zip-based format of Save, for
+// example to send it over a network connection or into a memory buffer.
+// w needs not support seeking: the archive is written sequentially.
+func SaveToWriter(obj interface{}, w io.Writer) error {
+	return saveZip(w, obj)
+}
+
+func saveZip(w io.Writer, obj interface{}) error {
+	c := newStorageCollector(false)
+	var data bytes.Buffer
+	p := pickle.NewPickler(&data)
+	p.Persister = c
+	if err := p.Dump(obj); err != nil {
+		return err
+	}
+
+	rw := newRecordWriter(w)
+	if err := rw.write("archive/data.pkl", data.Bytes()); err != nil {
+		return err
+	}
+	if err := rw.write("archive/byteorder", []byte("little")); err != nil {
+		return err
+	}
+	for _, storage := range c.storages {
+		raw, err := encodeStorage(storage)
+		if err != nil {
+			return err
+		}
+		name := "archive/data/" + c.keys[storage]
+		if err := rw.write(name, raw); err != nil {
+			return err
+		}
+	}
+	if err := rw.write("archive/version", []byte("3\n")); err != nil {
+		return err
+	}
+	return rw.close()
+}
+
+// SaveLegacy writes obj to the named file, in the legacy format used by
+// "torch.save" before PyTorch 1.6, or with _use_new_zipfile_serialization
+// set to False. The file can be read back both by Load and by "torch.load",
+// including by very old versions of PyTorch.
+//
+// As for Save, obj can be made of any value supported by pickle.Pickler,
+// and each distinct storage is written once.
+func SaveLegacy(filename string, obj interface{}) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := saveLegacy(f, obj); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saveLegacy writes the same sequence of pickles and data read back by
+// loadLegacyNoTar: the magic number, the protocol version, the system
+// info, obj itself, the keys of its storages, and finally the data of each
+// storage, preceded by its number of elements.
+func saveLegacy(w io.Writer, obj interface{}) error {
+	magicNumber, _ := new(big.Int).SetString(hexMagicNumber, 16)
+	typeSizes := types.NewDict()
+	typeSizes.Set("short", 2)
+	typeSizes.Set("int", 4)
+	typeSizes.Set("long", 4)
+	sysInfo := types.NewDict()
+	sysInfo.Set("protocol_version", protocolVersion)
+	sysInfo.Set("little_endian", true)
+	sysInfo.Set("type_sizes", typeSizes)
+	for _, header := range []interface{}{magicNumber, protocolVersion, sysInfo} {
+		if err := pickle.NewPickler(w).Dump(header); err != nil {
+			return err
+		}
+	}
+
+	c := newStorageCollector(true)
+	p := pickle.NewPickler(w)
+	p.Persister = c
+	if err := p.Dump(obj); err != nil {
+		return err
+	}
+
+	storageKeys := make(types.List, len(c.storages))
+	for i, storage := range c.storages {
+		storageKeys[i] = c.keys[storage]
+	}
+	if err := pickle.NewPickler(w).Dump(&storageKeys); err != nil {
+		return err
+	}
+
+	for _, storage := range c.storages {
+		raw, err := encodeStorage(storage)
+		if err != nil {
+			return err
+		}
+		elementSize, _ := storageElementSize(storage)
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(raw)/elementSize))
+		if _, err := w.Write(size[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storageCollector assigns a key to each distinct storage found while
+// pickling, as the pickle.Persister of a pickle.Pickler.
+type storageCollector struct {
+	keys     map[StorageInterface]string
+	storages []StorageInterface
+	// legacy makes the persistent IDs include the view metadata, as
+	// expected by loadLegacyNoTar.
+	legacy bool
+}
+
+var _ pickle.Persister = &storageCollector{}
+
+func newStorageCollector(legacy bool) *storageCollector {
+	return &storageCollector{
+		keys:   make(map[StorageInterface]string),
+		legacy: legacy,
+	}
+}
+
+func (c *storageCollector) PersistentId(obj interface{}) (interface{}, bool, error) {
+	storage, ok := obj.(StorageInterface)
+	if !ok {
+		return nil, false, nil
+	}
+	key, ok := c.keys[storage]
+	if !ok {
+		key = strconv.Itoa(len(c.storages))
+		c.keys[storage] = key
+		c.storages = append(c.storages, storage)
+	}
+	pid, err := storagePersistentId(storage, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.legacy {
+		// no view metadata
+		*pid = append(*pid, nil)
+	}
+	return pid, true, nil
+}
+
+// storagePersistentId returns the persistent ID of a storage, in the same
+// form expected by loadZipFile.
+func storagePersistentId(s StorageInterface, key string) (*types.Tuple, error) {
+	var className string
+	if _, ok := s.(*UntypedStorage); ok {
+		className = "UntypedStorage"
+	} else if name, ok := storageClassNames[storageDtype(s)]; ok {
+		className = name
+	} else {
+		return nil, fmt.Errorf("cannot save unsupported storage %T", s)
+	}
+	bs, ok := s.(baseStorager)
+	if !ok {
+		return nil, fmt.Errorf("cannot save unsupported storage %T", s)
+	}
+	b := bs.baseStorage()
+	location := b.Location
+	if location == "" {
+		location = "cpu"
+	}
+	return &types.Tuple{
+		"storage",
+		types.NewGenericClass("torch", className),
+		key,
+		location,
+		b.Size,
+	}, nil
+}
+
+// recordWriter writes uncompressed records to a zip archive, padding each
+// local file header with an extra field, so that the data of each record
+// is aligned to recordAlignment bytes, as PyTorch does.
+type recordWriter struct {
+	zw *zip.Writer
+	cw *countingWriter
+	// pending is the size of the data descriptor of the last record, which
+	// is written by zip.Writer only when the next record is created.
+	pending int64
+}
+
+func newRecordWriter(w io.Writer) *recordWriter {
+	cw := &countingWriter{w: w}
+	return &recordWriter{zw: zip.NewWriter(cw), cw: cw}
+}
+
+func (rw *recordWriter) write(name string, data []byte) error {
+	if err := rw.zw.Flush(); err != nil {
+		return err
+	}
+	// The local file header is 30 bytes long, followed by the name and by
+	// the extra field, made of 2 bytes of ID, 2 bytes of size and padding.
+	offset := rw.cw.n + rw.pending + 30 + int64(len(name)) + 4
+	padding := (recordAlignment - offset%recordAlignment) % recordAlignment
+	extra := make([]byte, 4+padding)
+	binary.LittleEndian.PutUint16(extra, 0x4246) // "FB", as in PyTorch
+	binary.LittleEndian.PutUint16(extra[2:], uint16(padding))
+
+	fw, err := rw.zw.CreateHeader(&zip.FileHeader{
+		Name:   name,
+		Method: zip.Store,
+		Extra:  extra,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	rw.pending = 16
+	if int64(len(data)) >= math.MaxUint32 {
+		rw.pending = 24 // zip64 data descriptor
+	}
+	return nil
+}
+
+func (rw *recordWriter) close() error {
+	return rw.zw.Close()
+}
+
+// countingWriter wraps an io.Writer, counting the bytes written to it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
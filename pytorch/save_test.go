@@ -0,0 +1,191 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveRoundTrip(t *testing.T) {
+	for _, dtype := range []string{"float16", "float32", "float64", "int8",
+		"int16", "int32", "int64", "uint8", "bool"} {
+		t.Run(dtype, func(t *testing.T) {
+			tensor := loadTensorFromFile(t, "tensor_"+dtype+"_proto2_zip.pt")
+
+			filename := path.Join(t.TempDir(), "saved.pt")
+			if err := Save(tensor, filename); err != nil {
+				t.Fatal(err)
+			}
+			result, err := Load(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded, ok := result.(*Tensor)
+			if !ok {
+				t.Fatalf("expected *Tensor, got %#v", result)
+			}
+			assertTensorsEqual(t, loaded, tensor)
+		})
+	}
+
+	t.Run("shared storage", func(t *testing.T) {
+		weight := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+		row := &Tensor{Source: weight.Source, StorageOffset: 3, Size: []int{3}, Stride: []int{1}}
+		stateDict := types.NewOrderedDict()
+		stateDict.Set("weight", weight)
+		stateDict.Set("row", row)
+
+		filename := path.Join(t.TempDir(), "saved.pt")
+		if err := Save(stateDict, filename); err != nil {
+			t.Fatal(err)
+		}
+		tensors, err := LoadStateDict(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorsEqual(t, tensors["weight"], weight)
+		assertTensorsEqual(t, tensors["row"], row)
+		if tensors["weight"].Source != tensors["row"].Source {
+			t.Error("expected the tensors to share the same storage")
+		}
+	})
+
+	t.Run("writer", func(t *testing.T) {
+		tensor := newFloatTensor([]float32{1, 2, 3}, 3)
+		var buf bytes.Buffer
+		if err := SaveToWriter(tensor, &buf); err != nil {
+			t.Fatal(err)
+		}
+		result, err := LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, ok := result.(*Tensor)
+		if !ok {
+			t.Fatalf("expected *Tensor, got %#v", result)
+		}
+		assertTensorsEqual(t, loaded, tensor)
+	})
+}
+
+func TestSaveLegacyRoundTrip(t *testing.T) {
+	for _, dtype := range []string{"float16", "float32", "float64", "int8",
+		"int16", "int32", "int64", "uint8", "bool"} {
+		t.Run(dtype, func(t *testing.T) {
+			tensor := loadTensorFromFile(t, "tensor_"+dtype+"_proto2_zip.pt")
+
+			filename := path.Join(t.TempDir(), "saved.pt")
+			if err := SaveLegacy(filename, tensor); err != nil {
+				t.Fatal(err)
+			}
+			if isZipFile(filename) {
+				t.Fatal("expected a legacy file, not a zip file")
+			}
+			result, err := Load(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded, ok := result.(*Tensor)
+			if !ok {
+				t.Fatalf("expected *Tensor, got %#v", result)
+			}
+			assertTensorsEqual(t, loaded, tensor)
+		})
+	}
+
+	t.Run("shared storage", func(t *testing.T) {
+		weight := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+		row := &Tensor{Source: weight.Source, StorageOffset: 3, Size: []int{3}, Stride: []int{1}}
+		stateDict := types.NewOrderedDict()
+		stateDict.Set("weight", weight)
+		stateDict.Set("row", row)
+
+		filename := path.Join(t.TempDir(), "saved.pt")
+		if err := SaveLegacy(filename, stateDict); err != nil {
+			t.Fatal(err)
+		}
+		tensors, err := LoadStateDict(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorsEqual(t, tensors["weight"], weight)
+		assertTensorsEqual(t, tensors["row"], row)
+		if tensors["weight"].Source != tensors["row"].Source {
+			t.Error("expected the tensors to share the same storage")
+		}
+	})
+}
+
+func TestSaveAlignsRecords(t *testing.T) {
+	a := newFloatTensor([]float32{1, 2, 3}, 3)
+	b := newFloatTensor([]float32{4, 5}, 2)
+	filename := path.Join(t.TempDir(), "saved.pt")
+	if err := Save(&types.List{a, b, a}, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var storages []string
+	for _, f := range r.File {
+		offset, err := f.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset%recordAlignment != 0 {
+			t.Errorf("%s: data at offset %d is not aligned", f.Name, offset)
+		}
+		if strings.HasPrefix(f.Name, "archive/data/") {
+			storages = append(storages, f.Name)
+		}
+	}
+	// the storage of a is saved only once
+	expected := []string{"archive/data/0", "archive/data/1"}
+	if !reflect.DeepEqual(storages, expected) {
+		t.Errorf("expected storages %v, actual %v", expected, storages)
+	}
+}
+
+func TestSaveUnsupportedStorage(t *testing.T) {
+	tensor := &Tensor{Source: &unsupportedStorage{}, Size: []int{}, Stride: []int{}}
+	err := Save(tensor, path.Join(t.TempDir(), "saved.pt"))
+	assertErrorContains(t, err, "unsupported storage")
+}
+
+type unsupportedStorage struct {
+	BaseStorage
+}
+
+func (*unsupportedStorage) SetFromFile(r io.Reader) error                   { return nil }
+func (*unsupportedStorage) SetFromFileWithSize(r io.Reader, size int) error { return nil }
+
+// assertTensorsEqual checks that two tensors have the same layout and the
+// same storage type, size, location and data.
+func assertTensorsEqual(t *testing.T, actual, expected *Tensor) {
+	t.Helper()
+	if actual.StorageOffset != expected.StorageOffset {
+		t.Errorf("expected StorageOffset %d, actual %d",
+			expected.StorageOffset, actual.StorageOffset)
+	}
+	assertIntSliceEqual(t, actual.Size, expected.Size)
+	assertIntSliceEqual(t, actual.Stride, expected.Stride)
+	if actual.RequiresGrad != expected.RequiresGrad {
+		t.Errorf("expected RequiresGrad %v, actual %v",
+			expected.RequiresGrad, actual.RequiresGrad)
+	}
+	if !reflect.DeepEqual(actual.Source, expected.Source) {
+		t.Errorf("expected storage %#v, actual %#v", expected.Source, actual.Source)
+	}
+}
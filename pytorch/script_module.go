@@ -0,0 +1,174 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// ScriptModule is the content of a TorchScript archive, as written by
+// "torch.jit.save" for a scripted or traced model.
+type ScriptModule struct {
+	// Module is the root module, unpickled from the "data.pkl" record. The
+	// attributes of the modules of a TorchScript archive are flat: their
+	// parameters, buffers and submodules are all attributes, along with
+	// the others, such as "training". FindTensors names their tensors by
+	// path, as in "fc.weight".
+	Module *Module
+	// Constants are the values of the "constants.pkl" record, usually
+	// tensors, which the code refers to as "CONSTANTS.c0", "CONSTANTS.c1"
+	// and so on, in order.
+	Constants []interface{}
+	// Code is the TorchScript source of the classes of the archive, by
+	// name in the "code" directory, such as "__torch__.py" or
+	// "__torch__/torch/nn/modules/linear.py".
+	Code map[string]string
+}
+
+// scriptRecordDirs are the directories of a TorchScript archive holding
+// records with the same names, such as the storages "data/0" and
+// "constants/0", or the "version" of the archive and ".data/version".
+var scriptRecordDirs = map[string]bool{"data": true, "constants": true, ".data": true}
+
+// LoadScriptModule loads a TorchScript archive, written by
+// "torch.jit.save", of which Load only reports that it is not supported.
+// The classes of the archive, in the "__torch__" module, are restored as
+// *Module values, so that the whole tree of the attributes of the model,
+// including its tensors, is available, but their methods cannot be run.
+//
+// Only the zip-based archives of PyTorch 1.4 and later are supported; the
+// older ones, holding a "model.json" record, are not.
+func LoadScriptModule(filename string) (*ScriptModule, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	sm, err := loadScriptModule(&r.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("LoadScriptModule: %s: %w", filename, err)
+	}
+	return sm, nil
+}
+
+func loadScriptModule(r *zip.Reader) (*ScriptModule, error) {
+	for _, f := range r.File {
+		if path.Base(f.Name) == "model.json" {
+			return nil, fmt.Errorf("the legacy TorchScript format (model.json) is not supported")
+		}
+	}
+	opts := LoadOptions{ExtraFindClass: scriptFindClass}.withDefaults()
+
+	dataRecords := scriptRecords(r, "data")
+	dataFile, ok := dataRecords["data.pkl"]
+	if !ok {
+		return nil, fmt.Errorf("data.pkl not found")
+	}
+	if _, ok := dataRecords["constants.pkl"]; !ok {
+		return nil, fmt.Errorf("constants.pkl not found")
+	}
+	result, _, err := unpickleZipRecord(dataFile, dataRecords, nil, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	module, ok := result.(*Module)
+	if !ok {
+		return nil, fmt.Errorf("expected a module in data.pkl, got %T", result)
+	}
+	sm := &ScriptModule{Module: module, Code: make(map[string]string)}
+
+	constantRecords := scriptRecords(r, "constants")
+	constants, _, err := unpickleZipRecord(constantRecords["constants.pkl"],
+		constantRecords, nil, opts, false)
+	if err != nil {
+		return nil, fmt.Errorf("constants.pkl: %w", err)
+	}
+	tuple, ok := constants.(*types.Tuple)
+	if !ok {
+		return nil, fmt.Errorf("expected a tuple in constants.pkl, got %T", constants)
+	}
+	sm.Constants = []interface{}(*tuple)
+
+	for _, f := range r.File {
+		name := nameInArchive(f.Name)
+		if !strings.HasPrefix(name, "code/") || strings.HasSuffix(name, "/") ||
+			strings.HasSuffix(name, ".debug_pkl") {
+			continue
+		}
+		code, err := readScriptCode(f)
+		if err != nil {
+			return nil, err
+		}
+		sm.Code[strings.TrimPrefix(name, "code/")] = code
+	}
+	return sm, nil
+}
+
+// scriptRecords returns the records of a TorchScript archive by name, as
+// recordsByName, leaving out those of the scriptRecordDirs but dir, so
+// that the storages of the pickle of dir are found.
+func scriptRecords(r *zip.Reader, dir string) map[string]*zip.File {
+	fileRecords := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		recordDir, recordName := path.Split(f.Name)
+		recordDir = path.Base(recordDir)
+		if scriptRecordDirs[recordDir] && recordDir != dir {
+			continue
+		}
+		fileRecords[recordName] = f
+	}
+	return fileRecords
+}
+
+func readScriptCode(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", fmt.Errorf("zip record '%s': %w", f.Name, err)
+	}
+	return string(data), nil
+}
+
+// scriptFindClass resolves the classes of a TorchScript archive, which
+// are all in the "__torch__" module, or in its submodules, and the
+// functions of "torch.jit._pickle", with which the TorchScript pickler
+// tags the types of lists and dictionaries.
+func scriptFindClass(module, name string) (interface{}, bool) {
+	if module == "__torch__" || strings.HasPrefix(module, "__torch__.") {
+		return NewModuleClass(module, name), true
+	}
+	if module == "torch.jit._pickle" {
+		switch name {
+		case "restore_type_tag", "build_intlist", "build_doublelist",
+			"build_boollist", "build_tensorlist":
+			return &jitPickleFunction{name: name}, true
+		}
+	}
+	return nil, false
+}
+
+// jitPickleFunction represents one of the functions of "torch.jit._pickle"
+// which return their first argument, a list or a dictionary, as it is.
+type jitPickleFunction struct {
+	name string
+}
+
+var _ types.Callable = &jitPickleFunction{}
+
+func (f *jitPickleFunction) Call(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("torch.jit._pickle.%s: invalid arguments: %#v", f.name, args)
+	}
+	return args[0], nil
+}
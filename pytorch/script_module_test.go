@@ -0,0 +1,54 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLoadScriptModule(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_scripted_module.pt")
+	sm, err := LoadScriptModule(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := sm.Module.Class; c.Module != "__torch__" || c.Name != "Net" {
+		t.Errorf("unexpected class %s.%s", c.Module, c.Name)
+	}
+	fc, _ := sm.Module.Attributes.Get("fc")
+	if _, ok := fc.(*Module); !ok {
+		t.Fatalf("expected fc to be a *Module, actual %T", fc)
+	}
+
+	tensors := FindTensors(sm.Module)
+	if len(tensors) != 2 || tensors[0].Name != "fc.weight" || tensors[1].Name != "fc.bias" {
+		t.Fatalf("unexpected tensors %v", tensors)
+	}
+	assertTensorFloat32Data(t, tensors[0].Tensor, []float32{1, 2, 3, 4})
+	assertTensorFloat32Data(t, tensors[1].Tensor, []float32{0.5, -0.5})
+
+	// the constants have their own storages, with the same keys
+	if len(sm.Constants) != 1 {
+		t.Fatalf("expected 1 constant, actual %d", len(sm.Constants))
+	}
+	assertTensorFloat32Data(t, sm.Constants[0].(*Tensor), []float32{10, 20})
+
+	if len(sm.Code) != 2 {
+		t.Errorf("expected 2 code records, actual %d", len(sm.Code))
+	}
+	if !strings.Contains(sm.Code["__torch__.py"], "CONSTANTS.c0") {
+		t.Errorf("unexpected code %q", sm.Code["__torch__.py"])
+	}
+	if _, ok := sm.Code["__torch__/torch/nn/modules/linear.py"]; !ok {
+		t.Error("linear.py not found")
+	}
+
+	_, err = Load(filename)
+	assertErrorContains(t, err, "see LoadScriptModule")
+	_, err = LoadScriptModule(path.Join("testdata", "synthetic_training_checkpoint.pt"))
+	assertErrorContains(t, err, "constants.pkl not found")
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// shardedIndex is the content of an index file of a sharded checkpoint,
+// such as "pytorch_model.bin.index.json".
+type shardedIndex struct {
+	Metadata struct {
+		TotalSize *int64 `json:"total_size"`
+	} `json:"metadata"`
+	WeightMap map[string]string `json:"weight_map"`
+}
+
+// LoadSharded loads a state dict split in shards across multiple files,
+// as described by an index file in the format of the HuggingFace
+// "pytorch_model.bin.index.json", and returns all its tensors by name.
+//
+// The "weight_map" of the index maps the name of each tensor to the file
+// of its shard, relative to the directory of the index, which is loaded
+// with LoadStateDictWithOptions. Loading fails, listing the offending
+// keys, if a mapped tensor is missing from its shard, or if a shard holds
+// tensors not mapped to it. When the index declares the "total_size" of
+// its "metadata", it must match the total size in bytes of the tensors.
+func LoadSharded(indexFilename string, opts LoadOptions) (map[string]*Tensor, error) {
+	data, err := ioutil.ReadFile(indexFilename)
+	if err != nil {
+		return nil, err
+	}
+	var index shardedIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("LoadSharded: %s: %w", indexFilename, err)
+	}
+	if len(index.WeightMap) == 0 {
+		return nil, fmt.Errorf("LoadSharded: %s: no weight_map", indexFilename)
+	}
+
+	shardKeys := make(map[string][]string)
+	for key, shard := range index.WeightMap {
+		shardKeys[shard] = append(shardKeys[shard], key)
+	}
+	shards := make([]string, 0, len(shardKeys))
+	for shard := range shardKeys {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	dir := filepath.Dir(indexFilename)
+	tensors := make(map[string]*Tensor, len(index.WeightMap))
+	var missing, extra []string
+	for _, shard := range shards {
+		shardTensors, err := LoadStateDictWithOptions(filepath.Join(dir, shard), opts)
+		if err != nil {
+			return nil, fmt.Errorf("LoadSharded: %w", err)
+		}
+		for _, key := range shardKeys[shard] {
+			tensor, ok := shardTensors[key]
+			if !ok {
+				missing = append(missing, key)
+				continue
+			}
+			tensors[key] = tensor
+		}
+		for key := range shardTensors {
+			if index.WeightMap[key] != shard {
+				extra = append(extra, key)
+			}
+		}
+	}
+	if len(missing) > 0 || len(extra) > 0 {
+		sort.Strings(missing)
+		sort.Strings(extra)
+		return nil, fmt.Errorf(
+			"LoadSharded: index and shards disagree: missing keys [%s], extra keys [%s]",
+			strings.Join(missing, ", "), strings.Join(extra, ", "))
+	}
+
+	if index.Metadata.TotalSize != nil {
+		var totalSize int64
+		for key, tensor := range tensors {
+			dtype := tensor.Dtype()
+			if dtype == nil {
+				return nil, fmt.Errorf(
+					"LoadSharded: %q: unsupported storage %T", key, tensor.Source)
+			}
+			totalSize += int64(tensor.Numel() * dtype.ElementSize)
+		}
+		if totalSize != *index.Metadata.TotalSize {
+			return nil, fmt.Errorf(
+				"LoadSharded: index declares a total size of %d bytes, "+
+					"but the tensors take %d bytes",
+				*index.Metadata.TotalSize, totalSize)
+		}
+	}
+	return tensors, nil
+}
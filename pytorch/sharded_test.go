@@ -0,0 +1,94 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestLoadSharded(t *testing.T) {
+	dir := t.TempDir()
+	saveShard := func(t *testing.T, filename string, tensors map[string]*Tensor) {
+		t.Helper()
+		stateDict := types.NewOrderedDict()
+		for key, tensor := range tensors {
+			stateDict.Set(key, tensor)
+		}
+		if err := Save(stateDict, path.Join(dir, filename)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIndex := func(t *testing.T, index string) string {
+		t.Helper()
+		filename := path.Join(dir, "pytorch_model.bin.index.json")
+		if err := ioutil.WriteFile(filename, []byte(index), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	saveShard(t, "pytorch_model-00001-of-00002.bin", map[string]*Tensor{
+		"embed.weight": newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3),
+	})
+	saveShard(t, "pytorch_model-00002-of-00002.bin", map[string]*Tensor{
+		"fc.weight": newFloatTensor([]float32{7, 8, 9}, 1, 3),
+		"fc.bias":   newFloatTensor([]float32{0.5}, 1),
+	})
+
+	t.Run("valid index", func(t *testing.T) {
+		filename := writeIndex(t, `{
+			"metadata": {"total_size": 40},
+			"weight_map": {
+				"embed.weight": "pytorch_model-00001-of-00002.bin",
+				"fc.weight": "pytorch_model-00002-of-00002.bin",
+				"fc.bias": "pytorch_model-00002-of-00002.bin"
+			}
+		}`)
+		tensors, err := LoadSharded(filename, LoadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tensors) != 3 {
+			t.Errorf("expected 3 tensors, actual %d", len(tensors))
+		}
+		assertTensorFloat32Data(t, tensors["embed.weight"], []float32{1, 2, 3, 4, 5, 6})
+		assertTensorFloat32Data(t, tensors["fc.weight"], []float32{7, 8, 9})
+		assertTensorFloat32Data(t, tensors["fc.bias"], []float32{0.5})
+	})
+
+	t.Run("missing and extra keys", func(t *testing.T) {
+		filename := writeIndex(t, `{
+			"weight_map": {
+				"embed.weight": "pytorch_model-00001-of-00002.bin",
+				"embed.bias": "pytorch_model-00001-of-00002.bin",
+				"fc.weight": "pytorch_model-00002-of-00002.bin"
+			}
+		}`)
+		_, err := LoadSharded(filename, LoadOptions{})
+		assertErrorContains(t, err, "missing keys [embed.bias], extra keys [fc.bias]")
+	})
+
+	t.Run("total size mismatch", func(t *testing.T) {
+		filename := writeIndex(t, `{
+			"metadata": {"total_size": 36},
+			"weight_map": {
+				"embed.weight": "pytorch_model-00001-of-00002.bin",
+				"fc.weight": "pytorch_model-00002-of-00002.bin",
+				"fc.bias": "pytorch_model-00002-of-00002.bin"
+			}
+		}`)
+		_, err := LoadSharded(filename, LoadOptions{})
+		assertErrorContains(t, err, "total size of 36 bytes, but the tensors take 40 bytes")
+	})
+
+	t.Run("missing shard", func(t *testing.T) {
+		filename := writeIndex(t, `{"weight_map": {"a": "missing.bin"}}`)
+		_, err := LoadSharded(filename, LoadOptions{})
+		assertErrorContains(t, err, "missing.bin")
+	})
+}
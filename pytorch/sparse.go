@@ -0,0 +1,278 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"reflect"
+)
+
+// SizeClass represents "torch.Size", the type of the sizes of the tensors,
+// which is a subclass of tuple. Calling it returns the given tuple.
+type SizeClass struct{}
+
+var _ types.Callable = &SizeClass{}
+
+func (s *SizeClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return &types.Tuple{}, nil
+	}
+	if len(args) == 1 {
+		switch v := args[0].(type) {
+		case *types.Tuple:
+			return v, nil
+		case *types.List:
+			return types.NewTupleFromSlice(*v), nil
+		}
+	}
+	return nil, fmt.Errorf("SizeClass unexpected args: %#v", args)
+}
+
+// SparseTensor is a sparse tensor, made of the tensors of its indices and
+// of its non-zero values, along with its dense size.
+type SparseTensor struct {
+	layout       *Layout
+	indices      *Tensor
+	plainIndices *Tensor
+	values       *Tensor
+	size         []int
+}
+
+// Layout returns the layout of the tensor: SparseCOO, or one of the
+// compressed layouts SparseCSR, SparseCSC, SparseBSR and SparseBSC.
+func (s *SparseTensor) Layout() *Layout {
+	return s.layout
+}
+
+// Indices returns the indices of the non-zero values. For the COO layout,
+// it is the 2-dimensional tensor holding the indices of each value along
+// each sparse dimension, in its columns. For the compressed layouts, it is
+// the tensor of the compressed indices: the "crow_indices" of the CSR and
+// BSR layouts, or the "ccol_indices" of the CSC and BSC ones.
+func (s *SparseTensor) Indices() *Tensor {
+	return s.indices
+}
+
+// PlainIndices returns the plain indices of the compressed layouts: the
+// "col_indices" of the CSR and BSR layouts, or the "row_indices" of the
+// CSC and BSC ones. It returns nil for the COO layout.
+func (s *SparseTensor) PlainIndices() *Tensor {
+	return s.plainIndices
+}
+
+// Values returns the tensor of the non-zero values.
+func (s *SparseTensor) Values() *Tensor {
+	return s.values
+}
+
+// Size returns the size of the dense tensor represented by the sparse one.
+func (s *SparseTensor) Size() []int {
+	return s.size
+}
+
+// ToDense returns a new contiguous tensor with the elements of the sparse
+// one, like "torch.Tensor.to_dense", for the SparseCOO, SparseCSR and
+// SparseCSC layouts. The missing elements are zeros, and the duplicate
+// indices of an uncoalesced COO tensor have their values summed. The
+// values of a hybrid COO tensor, with dense dimensions after the sparse
+// ones, are blocks of elements, which are placed likewise.
+func (s *SparseTensor) ToDense() (*Tensor, error) {
+	coordinates, sparseDims, nnz, err := s.coordinates()
+	if err != nil {
+		return nil, err
+	}
+	if sparseDims > len(s.size) {
+		return nil, fmt.Errorf("ToDense: %d sparse dimensions for size %v", sparseDims, s.size)
+	}
+	values, err := s.values.GetData()
+	if err != nil {
+		return nil, err
+	}
+	data := reflect.ValueOf(values)
+	block := numel(s.size[sparseDims:])
+	if data.Len() != nnz*block {
+		return nil, fmt.Errorf("ToDense: %d values for %d indices of blocks of %d elements",
+			data.Len(), nnz, block)
+	}
+
+	n := numel(s.size)
+	result := reflect.MakeSlice(data.Type(), n, n)
+	stride := contiguousStride(s.size)
+	filled := make(map[int]bool, nnz)
+	for k := 0; k < nnz; k++ {
+		pos := 0
+		for d, c := range coordinates[k*sparseDims : (k+1)*sparseDims] {
+			if c < 0 || c >= int64(s.size[d]) {
+				return nil, fmt.Errorf("ToDense: index %d out of range for dimension %d of size %d",
+					c, d, s.size[d])
+			}
+			pos += int(c) * stride[d]
+		}
+		src := data.Slice(k*block, (k+1)*block)
+		dst := result.Slice(pos, pos+block)
+		if !filled[pos] {
+			reflect.Copy(dst, src)
+			filled[pos] = true
+		} else if err := addValues(dst, src); err != nil {
+			return nil, err
+		}
+	}
+
+	storage, err := newStorageWithData(s.values.Source, result.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return &Tensor{
+		Source: storage,
+		Size:   append([]int(nil), s.size...),
+		Stride: stride,
+	}, nil
+}
+
+// coordinates returns the indices along the sparse dimensions of each
+// value of the tensor, one value after the other, the number of sparse
+// dimensions and the number of values. The compressed indices of CSR and
+// CSC are expanded.
+func (s *SparseTensor) coordinates() (coordinates []int64, sparseDims, nnz int, err error) {
+	switch s.layout {
+	case SparseCOO:
+		if len(s.indices.Size) != 2 {
+			return nil, 0, 0, fmt.Errorf("ToDense: unexpected COO indices of size %v", s.indices.Size)
+		}
+		indices, err := s.indices.GetDataAsInt64()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		// the indices of each value are a column of the tensor
+		sparseDims, nnz = s.indices.Size[0], s.indices.Size[1]
+		coordinates = make([]int64, len(indices))
+		for d := 0; d < sparseDims; d++ {
+			for k := 0; k < nnz; k++ {
+				coordinates[k*sparseDims+d] = indices[d*nnz+k]
+			}
+		}
+		return coordinates, sparseDims, nnz, nil
+
+	case SparseCSR, SparseCSC:
+		if len(s.indices.Size) != 1 || len(s.plainIndices.Size) != 1 || len(s.size) != 2 {
+			return nil, 0, 0, fmt.Errorf("ToDense: batched or hybrid %v tensors are not supported", s.layout)
+		}
+		compressed, err := s.indices.GetDataAsInt64()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		plain, err := s.plainIndices.GetDataAsInt64()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		// the compressed dimension is the first one for CSR, the second for CSC
+		first, second := 0, 1
+		if s.layout == SparseCSC {
+			first, second = 1, 0
+		}
+		if len(compressed) != s.size[first]+1 || compressed[len(compressed)-1] != int64(len(plain)) {
+			return nil, 0, 0, fmt.Errorf("ToDense: invalid compressed indices %v", compressed)
+		}
+		coordinates = make([]int64, 2*len(plain))
+		for i := 0; i+1 < len(compressed); i++ {
+			begin, end := compressed[i], compressed[i+1]
+			if begin < 0 || begin > end || end > int64(len(plain)) {
+				return nil, 0, 0, fmt.Errorf("ToDense: invalid compressed indices %v", compressed)
+			}
+			for k := begin; k < end; k++ {
+				coordinates[2*k+int64(first)] = int64(i)
+				coordinates[2*k+int64(second)] = plain[k]
+			}
+		}
+		return coordinates, 2, len(plain), nil
+
+	default:
+		return nil, 0, 0, fmt.Errorf("ToDense: unsupported layout %v", s.layout)
+	}
+}
+
+// addValues adds the elements of src to the ones of dst, which are slices
+// of the same numeric or boolean type; booleans are or-ed, as in PyTorch.
+func addValues(dst, src reflect.Value) error {
+	for i := 0; i < dst.Len(); i++ {
+		a, b := dst.Index(i), src.Index(i)
+		switch a.Kind() {
+		case reflect.Float32, reflect.Float64:
+			a.SetFloat(a.Float() + b.Float())
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			a.SetInt(a.Int() + b.Int())
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			a.SetUint(a.Uint() + b.Uint())
+		case reflect.Complex64, reflect.Complex128:
+			a.SetComplex(a.Complex() + b.Complex())
+		case reflect.Bool:
+			a.SetBool(a.Bool() || b.Bool())
+		default:
+			return fmt.Errorf("ToDense: cannot sum duplicate values of type %v", a.Type())
+		}
+	}
+	return nil
+}
+
+// RebuildSparseTensor represents "torch._utils._rebuild_sparse_tensor",
+// which makes a *SparseTensor, and the older
+// "torch._utils._rebuild_sparse_csr_tensor".
+type RebuildSparseTensor struct{}
+
+var _ types.Callable = &RebuildSparseTensor{}
+
+func (r *RebuildSparseTensor) Call(args ...interface{}) (interface{}, error) {
+	// args: layout, data
+	if len(args) != 2 {
+		return nil, fmt.Errorf("RebuildSparseTensor unexpected args: %#v", args)
+	}
+	layout, layoutOk := args[0].(*Layout)
+	data, dataOk := args[1].(*types.Tuple)
+	if !layoutOk || !dataOk {
+		return nil, fmt.Errorf("RebuildSparseTensor unexpected args: %#v", args)
+	}
+
+	// data: (indices, values, size[, is_coalesced]) for the COO layout, or
+	// (compressed_indices, plain_indices, values, size) for the others
+	var indices, plainIndices, values *Tensor
+	var indicesOk, plainIndicesOk, valuesOk, sizeOk bool
+	var size *types.Tuple
+	switch layout {
+	case SparseCOO:
+		if data.Len() != 3 && data.Len() != 4 {
+			return nil, fmt.Errorf("RebuildSparseTensor unexpected %v data: %#v", layout, data)
+		}
+		// data[3] "is_coalesced" is unused
+		indices, indicesOk = data.Get(0).(*Tensor)
+		values, valuesOk = data.Get(1).(*Tensor)
+		size, sizeOk = data.Get(2).(*types.Tuple)
+		plainIndicesOk = true
+	case SparseCSR, SparseCSC, SparseBSR, SparseBSC:
+		if data.Len() != 4 {
+			return nil, fmt.Errorf("RebuildSparseTensor unexpected %v data: %#v", layout, data)
+		}
+		indices, indicesOk = data.Get(0).(*Tensor)
+		plainIndices, plainIndicesOk = data.Get(1).(*Tensor)
+		values, valuesOk = data.Get(2).(*Tensor)
+		size, sizeOk = data.Get(3).(*types.Tuple)
+	default:
+		return nil, fmt.Errorf("RebuildSparseTensor: unsupported layout %v", layout)
+	}
+	if !indicesOk || !plainIndicesOk || !valuesOk || !sizeOk {
+		return nil, fmt.Errorf("RebuildSparseTensor unexpected %v data: %#v", layout, data)
+	}
+	denseSize, err := tupleToIntSlice(size)
+	if err != nil {
+		return nil, err
+	}
+	return &SparseTensor{
+		layout:       layout,
+		indices:      indices,
+		plainIndices: plainIndices,
+		values:       values,
+		size:         denseSize,
+	}, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestSparseTensors(t *testing.T) {
+	result, err := Load(path.Join("testdata", "synthetic_sparse_tensors.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := result.(*types.OrderedDict)
+
+	assertInt64Data := func(t *testing.T, tensor *Tensor, expected []int64) {
+		t.Helper()
+		if tensor == nil {
+			t.Fatal("expected tensor, actual nil")
+		}
+		data, err := tensor.GetDataAsInt64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("expected %v, actual %v", expected, data)
+		}
+	}
+
+	coo, ok := obj.MustGet("coo").(*SparseTensor)
+	if !ok {
+		t.Fatalf("expected *SparseTensor, actual %T", obj.MustGet("coo"))
+	}
+	if coo.Layout() != SparseCOO {
+		t.Errorf("expected layout %v, actual %v", SparseCOO, coo.Layout())
+	}
+	assertIntSliceEqual(t, coo.Size(), []int{3, 3})
+	assertIntSliceEqual(t, coo.Indices().Size, []int{2, 3})
+	assertInt64Data(t, coo.Indices(), []int64{0, 1, 2, 1, 2, 0})
+	assertTensorFloat32Data(t, coo.Values(), []float32{1, 2, 3})
+	if coo.PlainIndices() != nil {
+		t.Errorf("expected no plain indices, actual %v", coo.PlainIndices())
+	}
+
+	for _, name := range []string{"csr", "old_csr"} {
+		csr, ok := obj.MustGet(name).(*SparseTensor)
+		if !ok {
+			t.Fatalf("%s: expected *SparseTensor, actual %T", name, obj.MustGet(name))
+		}
+		if csr.Layout() != SparseCSR {
+			t.Errorf("%s: expected layout %v, actual %v", name, SparseCSR, csr.Layout())
+		}
+		assertIntSliceEqual(t, csr.Size(), []int{3, 3})
+		assertInt64Data(t, csr.Indices(), []int64{0, 1, 2, 3})
+		assertInt64Data(t, csr.PlainIndices(), []int64{1, 2, 0})
+		assertTensorFloat32Data(t, csr.Values(), []float32{1, 2, 3})
+	}
+}
+
+func TestRebuildSparseTensorErrors(t *testing.T) {
+	tensor := newFloatTensor([]float32{1}, 1)
+	size := &types.Tuple{3}
+	testCases := []struct {
+		args     []interface{}
+		expected string
+	}{
+		{[]interface{}{SparseCOO}, "unexpected args"},
+		{[]interface{}{Strided, &types.Tuple{tensor, tensor, size}}, "unsupported layout torch.strided"},
+		{[]interface{}{SparseCOO, &types.Tuple{tensor, size}}, "unexpected torch.sparse_coo data"},
+		{[]interface{}{SparseCOO, &types.Tuple{tensor, tensor, &types.Tuple{"3"}}}, "tuple of ints expected"},
+		{[]interface{}{SparseCSR, &types.Tuple{tensor, nil, tensor, size}}, "unexpected torch.sparse_csr data"},
+	}
+	for _, tc := range testCases {
+		_, err := (&RebuildSparseTensor{}).Call(tc.args...)
+		assertErrorContains(t, err, tc.expected)
+	}
+}
+
+func TestSparseTensorToDense(t *testing.T) {
+	result, err := Load(path.Join("testdata", "synthetic_sparse_tensors.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := result.(*types.OrderedDict)
+	for _, name := range []string{"coo", "csr", "old_csr"} {
+		dense, err := obj.MustGet(name).(*SparseTensor).ToDense()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		assertIntSliceEqual(t, dense.Size, []int{3, 3})
+		assertTensorFloat32Data(t, dense, []float32{0, 1, 0, 0, 0, 2, 3, 0, 0})
+	}
+
+	longTensor := func(data []int64, size ...int) *Tensor {
+		return &Tensor{
+			Source: &LongStorage{BaseStorage: BaseStorage{Size: len(data)}, Data: data},
+			Size:   size,
+			Stride: contiguousStride(size),
+		}
+	}
+
+	t.Run("uncoalesced", func(t *testing.T) {
+		s := &SparseTensor{
+			layout:  SparseCOO,
+			indices: longTensor([]int64{1, 0, 1}, 1, 3),
+			values:  newFloatTensor([]float32{1, 2, 3}, 3),
+			size:    []int{3},
+		}
+		dense, err := s.ToDense()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorFloat32Data(t, dense, []float32{2, 4, 0})
+	})
+
+	t.Run("hybrid", func(t *testing.T) {
+		s := &SparseTensor{
+			layout:  SparseCOO,
+			indices: longTensor([]int64{2, 0}, 1, 2),
+			values:  newFloatTensor([]float32{1, 2, 3, 4}, 2, 2),
+			size:    []int{3, 2},
+		}
+		dense, err := s.ToDense()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorFloat32Data(t, dense, []float32{3, 4, 0, 0, 1, 2})
+	})
+
+	t.Run("CSC", func(t *testing.T) {
+		// [[0, 1, 0], [0, 0, 2]]
+		s := &SparseTensor{
+			layout:       SparseCSC,
+			indices:      longTensor([]int64{0, 0, 1, 2}, 4),
+			plainIndices: longTensor([]int64{0, 1}, 2),
+			values:       newFloatTensor([]float32{1, 2}, 2),
+			size:         []int{2, 3},
+		}
+		dense, err := s.ToDense()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorFloat32Data(t, dense, []float32{0, 1, 0, 0, 0, 2})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			tensor   *SparseTensor
+			expected string
+		}{
+			{&SparseTensor{
+				layout:  SparseCOO,
+				indices: longTensor([]int64{3}, 1, 1),
+				values:  newFloatTensor([]float32{1}, 1),
+				size:    []int{3},
+			}, "index 3 out of range for dimension 0 of size 3"},
+			{&SparseTensor{
+				layout:  SparseCOO,
+				indices: longTensor([]int64{0, 1}, 1, 2),
+				values:  newFloatTensor([]float32{1}, 1),
+				size:    []int{3},
+			}, "1 values for 2 indices"},
+			{&SparseTensor{
+				layout:       SparseCSR,
+				indices:      longTensor([]int64{0, 1, 3}, 3),
+				plainIndices: longTensor([]int64{0, 1}, 2),
+				values:       newFloatTensor([]float32{1, 2}, 2),
+				size:         []int{2, 2},
+			}, "invalid compressed indices"},
+			{&SparseTensor{
+				layout:       SparseBSR,
+				indices:      longTensor([]int64{0, 1}, 2),
+				plainIndices: longTensor([]int64{0}, 1),
+				values:       newFloatTensor([]float32{1, 2, 3, 4}, 1, 2, 2),
+				size:         []int{2, 2},
+			}, "unsupported layout torch.sparse_bsr"},
+		}
+		for _, tc := range testCases {
+			_, err := tc.tensor.ToDense()
+			assertErrorContains(t, err, tc.expected)
+		}
+	})
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// stateDictKeys are the checkpoint entries which usually hold the model
+// state dict, in order of preference.
+var stateDictKeys = []string{"state_dict", "model", "model_state_dict"}
+
+// metadataKey is the name of the state dict attribute where PyTorch keeps
+// the version of each submodule.
+const metadataKey = "_metadata"
+
+// LoadStateDict loads a file holding a state dict, that is a dictionary
+// of tensors, such as the one returned by Python "nn.Module.state_dict()",
+// and returns its tensors by name.
+//
+// If the file holds a checkpoint, with the state dict as its "state_dict"
+// or "model" entry (or "model_state_dict"), that entry is used. A 2-tuple
+// whose first element is a dictionary of tensors, and whose second one is
+// not, as saved by "torch.save((model.state_dict(), extra), path)", is
+// accepted as well: the first element is the state dict.
+//
+// The dictionaries nested in the state dict are flattened, as by
+// StateDict, so that the name of each tensor is its dotted path, as in
+// "encoder.layer.0.weight".
+func LoadStateDict(filename string) (map[string]*Tensor, error) {
+	return LoadStateDictWithOptions(filename, LoadOptions{})
+}
+
+// LoadStateDictWithOptions is like LoadStateDict, but it accepts
+// LoadOptions.
+func LoadStateDictWithOptions(filename string, opts LoadOptions) (map[string]*Tensor, error) {
+	tensors, _, err := LoadStateDictWithMetadata(filename, opts)
+	return tensors, err
+}
+
+// LoadStateDictWithMetadata is like LoadStateDictWithOptions, but it also
+// returns the "_metadata" of the state dict, holding the version of each
+// submodule, or nil if it is missing. It is usually a *types.OrderedDict.
+//
+// The metadata is never part of the returned tensors, whether it is an
+// attribute of the state dict, as saved by PyTorch, or one of its entries.
+// For a (state_dict, extra) tuple (see LoadStateDict), the metadata is the
+// extra element instead.
+func LoadStateDictWithMetadata(filename string, opts LoadOptions) (map[string]*Tensor, interface{}, error) {
+	obj, err := LoadWithOptions(filename, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	tensors, metadata, err := stateDictTensors(obj, opts.NormalizeKeys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LoadStateDict: %s: %w", filename, err)
+	}
+	if opts.TensorFilter != nil {
+		for name := range tensors {
+			if !opts.TensorFilter(name) {
+				delete(tensors, name)
+			}
+		}
+	}
+	return tensors, metadata, nil
+}
+
+// MergeStateDicts returns a new state dict with the tensors of both base
+// and overlay, for example to apply a delta or adapter checkpoint over a
+// base model. The given state dicts are not modified.
+//
+// For each key found in both of them, onConflict is called with the
+// tensors of base and overlay, in this order, and its result is used, or
+// the key is dropped if it is nil. Conflicting keys are processed in
+// sorted order, and the first error returned by onConflict stops the
+// merge. If onConflict is nil, the tensor of overlay is always used.
+func MergeStateDicts(
+	base, overlay map[string]*Tensor,
+	onConflict func(key string, a, b *Tensor) (*Tensor, error),
+) (map[string]*Tensor, error) {
+	merged := make(map[string]*Tensor, len(base)+len(overlay))
+	for key, tensor := range base {
+		merged[key] = tensor
+	}
+	keys := make([]string, 0, len(overlay))
+	for key := range overlay {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		tensor := overlay[key]
+		if a, exists := base[key]; exists && onConflict != nil {
+			var err error
+			if tensor, err = onConflict(key, a, tensor); err != nil {
+				return nil, fmt.Errorf("MergeStateDicts: %q: %w", key, err)
+			}
+			if tensor == nil {
+				delete(merged, key)
+				continue
+			}
+		}
+		merged[key] = tensor
+	}
+	return merged, nil
+}
+
+// StateDictEntry is a tensor of a state dict, along with its name.
+type StateDictEntry struct {
+	Name   string
+	Tensor *Tensor
+}
+
+// StateDict returns the tensors of a loaded state dict, that is a Dict or
+// OrderedDict of tensors by name, in order. The dictionaries nested in it
+// are flattened, by joining their keys to the one of their parent with a
+// dot, as in "encoder.layer.0.weight". As a state dict saved by PyTorch,
+// any "_metadata" entry is skipped.
+//
+// An error is returned if obj is not a dictionary, for example if it is a
+// whole pickled model (a *Module), or if it holds anything but string keys
+// and tensors. A checkpoint holding a state dict among other values is not
+// a state dict either: see LoadStateDict for that.
+func StateDict(obj interface{}) ([]StateDictEntry, error) {
+	if m, ok := obj.(*Module); ok {
+		return nil, fmt.Errorf("StateDict: expected a state dict, got a "+
+			"pickled model of class %s.%s", m.Class.Module, m.Class.Name)
+	}
+	if _, ok := dictEntries(obj); !ok {
+		return nil, fmt.Errorf("StateDict: expected a state dict, got %T", obj)
+	}
+	var result []StateDictEntry
+	err := flattenStateDict("", obj, make(map[interface{}]bool), false, &result)
+	if err != nil {
+		return nil, fmt.Errorf("StateDict: %w", err)
+	}
+	return result, nil
+}
+
+// flattenStateDict appends to result the tensors of the dictionary dict,
+// recursively, prefixing their names with prefix. The dictionaries being
+// visited are tracked to detect a dictionary which contains itself. The
+// keys are converted with normalizeKey if normalizeKeys is true.
+func flattenStateDict(prefix string, dict interface{}, visiting map[interface{}]bool, normalizeKeys bool, result *[]StateDictEntry) error {
+	if visiting[dict] {
+		return fmt.Errorf("recursive dictionary for key %q", strings.TrimSuffix(prefix, "."))
+	}
+	visiting[dict] = true
+	defer delete(visiting, dict)
+
+	entries, _ := dictEntries(dict)
+	for _, entry := range entries {
+		key, ok := stateDictKey(entry.Key, normalizeKeys)
+		if !ok {
+			return fmt.Errorf("expected string key, got %#v", entry.Key)
+		}
+		if key == metadataKey {
+			continue
+		}
+		name := prefix + key
+		if tensor, ok := entry.Value.(*Tensor); ok {
+			*result = append(*result, StateDictEntry{Name: name, Tensor: tensor})
+			continue
+		}
+		if _, ok := dictEntries(entry.Value); !ok {
+			return fmt.Errorf("expected tensor for key %q, got %T", name, entry.Value)
+		}
+		if err := flattenStateDict(name+".", entry.Value, visiting, normalizeKeys, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stateDictTensors returns the tensors of the state dict found in obj (see
+// findStateDict), by name, and its metadata.
+func stateDictTensors(obj interface{}, normalizeKeys bool) (map[string]*Tensor, interface{}, error) {
+	stateDict := findStateDict(obj)
+	entries, ok := dictEntries(stateDict)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected a dictionary, got %T", obj)
+	}
+	var metadata interface{}
+	if od, ok := stateDict.(*types.OrderedDict); ok {
+		metadata = od.PyDict[metadataKey]
+	}
+	_, extra, isTuple := splitStateDictTuple(obj)
+	tensors := make(map[string]*Tensor, len(entries))
+	visiting := map[interface{}]bool{stateDict: true}
+	for _, entry := range entries {
+		name, ok := stateDictKey(entry.Key, normalizeKeys)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected string key, got %#v", entry.Key)
+		}
+		if name == metadataKey {
+			if !isTuple {
+				metadata = entry.Value
+			}
+			continue
+		}
+		if tensor, ok := entry.Value.(*Tensor); ok {
+			if _, exists := tensors[name]; exists {
+				return nil, nil, fmt.Errorf("duplicate tensor name %q", name)
+			}
+			tensors[name] = tensor
+			continue
+		}
+		if _, ok := dictEntries(entry.Value); !ok {
+			return nil, nil, fmt.Errorf("expected tensor for key %q, got %T",
+				name, entry.Value)
+		}
+		var nested []StateDictEntry
+		err := flattenStateDict(name+".", entry.Value, visiting, normalizeKeys, &nested)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range nested {
+			if _, exists := tensors[e.Name]; exists {
+				return nil, nil, fmt.Errorf("duplicate tensor name %q", e.Name)
+			}
+			tensors[e.Name] = e.Tensor
+		}
+	}
+	if isTuple {
+		metadata = extra
+	}
+	return tensors, metadata, nil
+}
+
+// findStateDict returns the entry of a checkpoint which holds the state
+// dict, according to stateDictKeys, the first element of a
+// (state_dict, extra) tuple, or the checkpoint itself.
+func findStateDict(checkpoint interface{}) interface{} {
+	if stateDict, _, ok := splitStateDictTuple(checkpoint); ok {
+		return stateDict
+	}
+	for _, key := range stateDictKeys {
+		if value, ok := dictGet(checkpoint, key); ok {
+			if _, isDict := dictEntries(value); isDict {
+				return value
+			}
+		}
+	}
+	return checkpoint
+}
+
+// splitStateDictTuple returns the elements of a checkpoint which is a
+// (state_dict, extra) tuple, and whether it is one: the state dict must be
+// a dictionary of tensors only (besides "_metadata"), and extra must not,
+// otherwise the tuple could just as well be a pair of state dicts.
+func splitStateDictTuple(checkpoint interface{}) (stateDict, extra interface{}, ok bool) {
+	t, ok := checkpoint.(*types.Tuple)
+	if !ok || t.Len() != 2 || !isTensorDict(t.Get(0)) || isTensorDict(t.Get(1)) {
+		return nil, nil, false
+	}
+	return t.Get(0), t.Get(1), true
+}
+
+// isTensorDict reports whether obj is a dictionary whose values are all
+// tensors, except for a "_metadata" entry.
+func isTensorDict(obj interface{}) bool {
+	entries, ok := dictEntries(obj)
+	if !ok {
+		return false
+	}
+	for _, entry := range entries {
+		if _, isTensor := entry.Value.(*Tensor); !isTensor && entry.Key != metadataKey {
+			return false
+		}
+	}
+	return true
+}
+
+// stateDictKey returns a key of a state dict as a string, converted with
+// normalizeKey if normalizeKeys is true, and whether it is a valid key.
+func stateDictKey(key interface{}, normalizeKeys bool) (string, bool) {
+	if normalizeKeys {
+		return normalizeKey(key)
+	}
+	s, ok := key.(string)
+	return s, ok
+}
+
+// normalizeKey converts to a Go string a key loaded from a Python 2 "str",
+// that is a types.Bytes, or a string decoded as latin-1, whose bytes are
+// usually UTF-8 encoded text.
+func normalizeKey(key interface{}) (string, bool) {
+	switch k := key.(type) {
+	case types.Bytes:
+		return string(k), true
+	case string:
+		return latin1ToUTF8(k), true
+	default:
+		return "", false
+	}
+}
+
+// latin1ToUTF8 reverts the latin-1 decoding of a string, if the original
+// bytes are valid UTF-8. Otherwise, s is returned as it is.
+func latin1ToUTF8(s string) string {
+	raw := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return s
+		}
+		raw = append(raw, byte(r))
+	}
+	if !utf8.Valid(raw) {
+		return s
+	}
+	return string(raw)
+}
+
+// dictEntries returns the key/value pairs of a Dict or OrderedDict, in
+// order, and whether obj is one of them, or a DefaultDict or Counter.
+func dictEntries(obj interface{}) ([]types.DictEntry, bool) {
+	switch d := obj.(type) {
+	case *types.Dict:
+		return d.Entries(), true
+	case *types.DefaultDict:
+		return d.Entries(), true
+	case *types.Counter:
+		return d.Entries(), true
+	case *types.OrderedDict:
+		entries := make([]types.DictEntry, 0, d.Len())
+		for e := d.List.Front(); e != nil; e = e.Next() {
+			entry := e.Value.(*types.OrderedDictEntry)
+			entries = append(entries, types.DictEntry{Key: entry.Key, Value: entry.Value})
+		}
+		return entries, true
+	default:
+		return nil, false
+	}
+}
+
+func dictGet(obj interface{}, key string) (interface{}, bool) {
+	switch d := obj.(type) {
+	case *types.Dict:
+		return d.Get(key)
+	case *types.DefaultDict:
+		return d.Get(key)
+	case *types.Counter:
+		return d.Get(key)
+	case *types.OrderedDict:
+		return d.Get(key)
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLoadStateDict(t *testing.T) {
+	tensors, err := LoadStateDict(path.Join("testdata", "synthetic_training_checkpoint.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensors) != 5 {
+		t.Errorf("expected 5 tensors, actual %d", len(tensors))
+	}
+	embed, ok := tensors["embed.weight"]
+	if !ok {
+		t.Fatal("embed.weight not found")
+	}
+	assertIntSliceEqual(t, embed.Size, []int{2, 3})
+	assertTensorFloat32Data(t, embed, []float32{1, 2, 3, 4, 5, 6})
+}
+
+func TestLoadStateDictPython2(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_python2_state_dict.pt")
+	for _, normalizeKeys := range []bool{false, true} {
+		tensors, err := LoadStateDictWithOptions(filename,
+			LoadOptions{NormalizeKeys: normalizeKeys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tensors) != 2 {
+			t.Errorf("expected 2 tensors, actual %d", len(tensors))
+		}
+		weight, ok := tensors["fc.weight"]
+		if !ok {
+			t.Fatal("fc.weight not found")
+		}
+		assertTensorFloat32Data(t, weight, []float32{1, 2, 3})
+		bias, ok := tensors["fc.bias"]
+		if !ok {
+			t.Fatal("fc.bias not found")
+		}
+		assertTensorFloat32Data(t, bias, []float32{0.5})
+	}
+
+	// With NormalizeInts, the Python 2 ints are loaded as int64 values,
+	// which the tensors accept as well.
+	newUnpickler := func(r io.Reader) pickle.Unpickler {
+		u := pickle.NewUnpickler(r)
+		u.NormalizeInts = true
+		return u
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	if err := readAndCheckMagicNumber(r); err != nil {
+		t.Fatal(err)
+	}
+	u := newUnpickler(r)
+	version, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != int64(protocolVersion) {
+		t.Errorf("expected protocol version int64(%d), actual %#v", protocolVersion, version)
+	}
+	u = newUnpickler(r)
+	sysInfo, err := u.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeSizes := sysInfo.(*types.Dict).MustGet("type_sizes").(*types.Dict)
+	if size := typeSizes.MustGet("long"); size != int64(8) {
+		t.Errorf("expected long size int64(8), actual %#v", size)
+	}
+	tensors, err := LoadStateDictWithOptions(filename,
+		LoadOptions{NewUnpickler: newUnpickler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weight, ok := tensors["fc.weight"]
+	if !ok {
+		t.Fatal("fc.weight not found")
+	}
+	assertIntSliceEqual(t, weight.Size, []int{3})
+	assertTensorFloat32Data(t, weight, []float32{1, 2, 3})
+}
+
+func TestLoadPython2Encoding(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_python2_state_dict.pt")
+	for _, encoding := range []string{"ascii", "latin1", "bytes"} {
+		tensors, err := LoadStateDictWithOptions(filename,
+			LoadOptions{Encoding: encoding, NormalizeKeys: true})
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		weight, ok := tensors["fc.weight"]
+		if !ok {
+			t.Fatalf("%s: fc.weight not found", encoding)
+		}
+		assertTensorFloat32Data(t, weight, []float32{1, 2, 3})
+	}
+
+	result, err := LoadWithOptions(filename, LoadOptions{Encoding: "bytes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDict, ok := result.(*types.OrderedDict)
+	if !ok {
+		t.Fatalf("expected *types.OrderedDict, actual %T", result)
+	}
+	if _, ok := stateDict.Get(types.Bytes("fc.bias")); !ok {
+		t.Errorf("key types.Bytes(\"fc.bias\") not found")
+	}
+
+	_, err = LoadWithOptions(filename, LoadOptions{Encoding: "rot13"})
+	assertErrorContains(t, err, `unsupported string encoding "rot13"`)
+}
+
+func TestStateDictKeyOrder(t *testing.T) {
+	result, err := Load(path.Join("testdata", "synthetic_ordered_state_dict.pt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDict, ok := result.(*types.OrderedDict)
+	if !ok {
+		t.Fatalf("expected *types.OrderedDict, actual %T", result)
+	}
+	// list(sd.keys()) in Python
+	var expected []interface{}
+	for i := 0; i < 12; i++ {
+		for _, name := range []string{"weight", "bias"} {
+			expected = append(expected, fmt.Sprintf("layers.%d.%s", i, name))
+		}
+	}
+	if keys := stateDict.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, actual %v", expected, keys)
+	}
+
+	i := 0
+	stateDict.Range(func(key, value interface{}) bool {
+		if key != expected[i] {
+			t.Errorf("expected key %v at %d, actual %v", expected[i], i, key)
+		}
+		assertTensorFloat32Data(t, value.(*Tensor), []float32{float32(i)})
+		i++
+		return i < 5
+	})
+	if i != 5 {
+		t.Errorf("expected Range to stop after 5 entries, actual %d", i)
+	}
+}
+
+func TestStateDict(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2}, 2)
+	bias := newFloatTensor([]float32{3}, 1)
+	layer := types.NewOrderedDict()
+	layer.Set("weight", weight)
+	layer.Set("bias", bias)
+	layers := types.NewDict()
+	layers.Set("0", layer)
+	encoder := types.NewOrderedDict()
+	encoder.Set("layer", layers)
+	encoder.Set(metadataKey, types.NewOrderedDict())
+	stateDict := types.NewOrderedDict()
+	stateDict.Set("embeddings", weight)
+	stateDict.Set("encoder", encoder)
+	stateDict.Set("pooler", types.NewDict())
+
+	entries, err := StateDict(stateDict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []StateDictEntry{
+		{Name: "embeddings", Tensor: weight},
+		{Name: "encoder.layer.0.weight", Tensor: weight},
+		{Name: "encoder.layer.0.bias", Tensor: bias},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %v, actual %v", expected, entries)
+	}
+
+	layer.Set("step", 3)
+	_, err = StateDict(stateDict)
+	assertErrorContains(t, err, `expected tensor for key "encoder.layer.0.step", got int`)
+
+	layer.Set("step", layers)
+	_, err = StateDict(stateDict)
+	assertErrorContains(t, err, `recursive dictionary for key "encoder.layer.0.step"`)
+}
+
+func TestStateDictNotStateDict(t *testing.T) {
+	model := &Module{
+		Class:      types.NewGenericClass("torch.nn.modules.linear", "Linear"),
+		Attributes: types.NewDict(),
+	}
+	_, err := StateDict(model)
+	assertErrorContains(t, err, "got a pickled model of class torch.nn.modules.linear.Linear")
+
+	_, err = StateDict(&types.List{})
+	assertErrorContains(t, err, "expected a state dict, got *types.List")
+
+	stateDict := types.NewDict()
+	stateDict.Set(1, newFloatTensor([]float32{1}, 1))
+	_, err = StateDict(stateDict)
+	assertErrorContains(t, err, "expected string key, got 1")
+}
+
+func TestStateDictNormalizeKeys(t *testing.T) {
+	tensor := newFloatTensor([]float32{1}, 1)
+	stateDict := types.NewDict()
+	stateDict.Set(types.Bytes("fc.weight"), tensor)
+	stateDict.Set("cafÃ©.bias", tensor) // "café" decoded as latin-1
+	stateDict.Set("été", tensor)        // not UTF-8 once encoded as latin-1
+
+	tensors, _, err := stateDictTensors(stateDict, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"fc.weight", "café.bias", "été"} {
+		if _, ok := tensors[name]; !ok {
+			t.Errorf("%q not found", name)
+		}
+	}
+
+	_, _, err = stateDictTensors(stateDict, false)
+	assertErrorContains(t, err, "expected string key")
+}
+
+func TestStateDictNotTensor(t *testing.T) {
+	stateDict := types.NewOrderedDict()
+	stateDict.Set("epoch", 3)
+	_, _, err := stateDictTensors(stateDict, false)
+	assertErrorContains(t, err, `expected tensor for key "epoch"`)
+}
+
+func TestStateDictTensorsNested(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2}, 2)
+	bias := newFloatTensor([]float32{3}, 1)
+	layer := types.NewDict()
+	layer.Set(types.Bytes("weight"), weight)
+	layer.Set("bias", bias)
+	layer.Set(metadataKey, types.NewDict())
+	layers := types.NewOrderedDict()
+	layers.Set("0", layer)
+	stateDict := types.NewOrderedDict()
+	stateDict.Set("embeddings", weight)
+	stateDict.Set("layers", layers)
+
+	tensors, _, err := stateDictTensors(stateDict, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]*Tensor{
+		"embeddings":      weight,
+		"layers.0.weight": weight,
+		"layers.0.bias":   bias,
+	}
+	if !reflect.DeepEqual(tensors, expected) {
+		t.Errorf("expected %v, actual %v", expected, tensors)
+	}
+
+	stateDict.Set("layers.0.bias", bias)
+	_, _, err = stateDictTensors(stateDict, true)
+	assertErrorContains(t, err, `duplicate tensor name "layers.0.bias"`)
+
+	recursive := types.NewOrderedDict()
+	recursive.Set("layers", layers)
+	layer.Set("self", recursive)
+	_, _, err = stateDictTensors(recursive, true)
+	assertErrorContains(t, err, `recursive dictionary for key "layers.0.self"`)
+}
+
+func TestLoadStateDictWithMetadata(t *testing.T) {
+	tensors, metadata, err := LoadStateDictWithMetadata(
+		path.Join("testdata", "synthetic_state_dict_metadata.pt"), LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensors) != 2 {
+		t.Errorf("expected 2 tensors, actual %d", len(tensors))
+	}
+	if _, ok := tensors["bn.num_batches_tracked"]; !ok {
+		t.Error("bn.num_batches_tracked not found")
+	}
+	od, ok := metadata.(*types.OrderedDict)
+	if !ok {
+		t.Fatalf("expected *types.OrderedDict metadata, got %#v", metadata)
+	}
+	version := od.MustGet("bn").(*types.Dict).MustGet("version")
+	if version != 2 {
+		t.Errorf("expected bn version 2, actual %#v", version)
+	}
+}
+
+func TestStateDictMetadataEntry(t *testing.T) {
+	metadata := types.NewOrderedDict()
+	stateDict := types.NewOrderedDict()
+	stateDict.Set("fc.weight", newFloatTensor([]float32{1}, 1))
+	stateDict.Set("_metadata", metadata)
+
+	tensors, actual, err := stateDictTensors(stateDict, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensors) != 1 {
+		t.Errorf("expected 1 tensor, actual %d", len(tensors))
+	}
+	if actual != metadata {
+		t.Errorf("expected metadata %#v, actual %#v", metadata, actual)
+	}
+}
+
+func TestLoadStateDictFromTuple(t *testing.T) {
+	tensors, metadata, err := LoadStateDictWithMetadata(
+		path.Join("testdata", "synthetic_tuple_checkpoint.pt"), LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensors) != 2 {
+		t.Errorf("expected 2 tensors, actual %d", len(tensors))
+	}
+	assertTensorFloat32Data(t, tensors["fc.weight"], []float32{1, 2})
+	assertTensorFloat32Data(t, tensors["fc.bias"], []float32{3})
+	extra, ok := metadata.(*types.Dict)
+	if !ok {
+		t.Fatalf("expected *types.Dict metadata, got %#v", metadata)
+	}
+	if epoch := extra.MustGet("epoch"); epoch != 7 {
+		t.Errorf("expected epoch 7, actual %#v", epoch)
+	}
+
+	t.Run("pair of state dicts", func(t *testing.T) {
+		stateDict := types.NewOrderedDict()
+		stateDict.Set("fc.weight", newFloatTensor([]float32{1}, 1))
+		_, _, err := stateDictTensors(&types.Tuple{stateDict, stateDict}, false)
+		assertErrorContains(t, err, "expected a dictionary, got *types.Tuple")
+	})
+}
+
+func TestMergeStateDicts(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2}, 2)
+	bias := newFloatTensor([]float32{0}, 1)
+	delta := newFloatTensor([]float32{10, 20}, 2)
+	adapter := newFloatTensor([]float32{3}, 1)
+	base := map[string]*Tensor{"fc.weight": weight, "fc.bias": bias}
+
+	t.Run("without conflicts", func(t *testing.T) {
+		merged, err := MergeStateDicts(base, map[string]*Tensor{"lora.A": adapter}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]*Tensor{"fc.weight": weight, "fc.bias": bias, "lora.A": adapter}
+		if !reflect.DeepEqual(merged, expected) {
+			t.Errorf("expected %v, actual %v", expected, merged)
+		}
+	})
+
+	t.Run("overlay wins", func(t *testing.T) {
+		merged, err := MergeStateDicts(base, map[string]*Tensor{"fc.weight": delta}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged["fc.weight"] != delta || merged["fc.bias"] != bias {
+			t.Errorf("unexpected merge %v", merged)
+		}
+		if base["fc.weight"] != weight {
+			t.Error("expected base not to be modified")
+		}
+	})
+
+	t.Run("on conflict", func(t *testing.T) {
+		overlay := map[string]*Tensor{"fc.weight": delta, "fc.bias": adapter, "lora.A": adapter}
+		var conflicts []string
+		merged, err := MergeStateDicts(base, overlay, func(key string, a, b *Tensor) (*Tensor, error) {
+			conflicts = append(conflicts, key)
+			if key == "fc.bias" {
+				return nil, nil // dropped
+			}
+			return a, nil // base wins
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := []string{"fc.bias", "fc.weight"}; !reflect.DeepEqual(conflicts, expected) {
+			t.Errorf("expected conflicts %v, actual %v", expected, conflicts)
+		}
+		expected := map[string]*Tensor{"fc.weight": weight, "lora.A": adapter}
+		if !reflect.DeepEqual(merged, expected) {
+			t.Errorf("expected %v, actual %v", expected, merged)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		fail := errors.New("shape mismatch")
+		_, err := MergeStateDicts(base, map[string]*Tensor{"fc.weight": delta},
+			func(string, *Tensor, *Tensor) (*Tensor, error) { return nil, fail })
+		if !errors.Is(err, fail) {
+			t.Fatalf("expected error %v, actual %v", fail, err)
+		}
+		assertErrorContains(t, err, `"fc.weight"`)
+	})
+}
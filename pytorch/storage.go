@@ -5,9 +5,12 @@
 package pytorch
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
+	"reflect"
 )
 
 type StorageClassInterface interface {
@@ -22,6 +25,50 @@ type StorageInterface interface {
 type BaseStorage struct {
 	Size     int
 	Location string
+	// SavedLocation is the location saved in the file for a loaded
+	// storage, such as "cuda:0", when LoadOptions.MapLocation maps it to
+	// a different Location, such as "cpu". It is empty otherwise.
+	SavedLocation string
+	// pending is set for storages whose data is read in background by
+	// LoadAsync, or on first access for the ones loaded lazily.
+	pending *pendingData
+	// untyped caches the UntypedStorage holding the raw bytes of a typed
+	// storage, once it is viewed as another data type (see untypedView).
+	untyped *UntypedStorage
+	// viewOf is set for the views of a storage as another data type whose
+	// elements cannot share the memory of its bytes, such as float16
+	// values held as float32 ones: they are converted again from viewOf
+	// each time the data is accessed (see storageData).
+	viewOf StorageInterface
+}
+
+// Wait blocks until the data of the storage is available, returning the
+// error occurred reading it, if any. It is only needed for storages loaded
+// with LoadAsync, and for the ones loaded with LoadOptions.Lazy, whose
+// data is read by the first call: for all other storages, it returns nil
+// immediately.
+func (b *BaseStorage) Wait() error {
+	if b.pending == nil {
+		return nil
+	}
+	return b.pending.wait()
+}
+
+// baseStorager is implemented by all the storages embedding a BaseStorage.
+type baseStorager interface {
+	baseStorage() *BaseStorage
+}
+
+func (b *BaseStorage) baseStorage() *BaseStorage {
+	return b
+}
+
+// waitStorage calls Wait on the storages embedding a BaseStorage.
+func waitStorage(s StorageInterface) error {
+	if bs, ok := s.(baseStorager); ok {
+		return bs.baseStorage().Wait()
+	}
+	return nil
 }
 
 // ----- Half -----
@@ -63,6 +110,94 @@ func (f *HalfStorage) SetFromFileWithSize(r io.Reader, size int) error {
 	return nil
 }
 
+// Float32s returns the elements of the storage, which are decoded into
+// float32 values exactly while loading, once they are available (see
+// BaseStorage.Wait). The returned slice is the Data of the storage.
+func (f *HalfStorage) Float32s() ([]float32, error) {
+	if _, err := storageData(f); err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// Float16Bits returns a new slice with the elements of the storage encoded
+// as the bits of half-precision floats, as they are stored in the file.
+func (f *HalfStorage) Float16Bits() ([]uint16, error) {
+	if _, err := storageData(f); err != nil {
+		return nil, err
+	}
+	bits := make([]uint16, len(f.Data))
+	for i, v := range f.Data {
+		bits[i] = Float32ToFloat16(v)
+	}
+	return bits, nil
+}
+
+// ----- BFloat16 -----
+
+// BFloat16StorageClass is the storage class of the "torch.bfloat16" data
+// type. Its elements are held as float32 values, which represent all the
+// bfloat16 values exactly.
+type BFloat16StorageClass struct{}
+
+var _ StorageClassInterface = &BFloat16StorageClass{}
+
+func (f *BFloat16StorageClass) New(size int, location string) StorageInterface {
+	return &BFloat16Storage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type BFloat16Storage struct {
+	BaseStorage
+	Data []float32
+}
+
+var _ StorageInterface = &BFloat16Storage{}
+
+func (f *BFloat16Storage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *BFloat16Storage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]float32, size)
+	br := NewLimitedBufferReader(r, size, 2, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		u16 := binary.LittleEndian.Uint16(bytes)
+		data[i] = math.Float32frombits(BFloatBits16to32(u16))
+	}
+	f.Data = data
+	return nil
+}
+
+// Float32s returns the elements of the storage, which are decoded into
+// float32 values exactly while loading, once they are available (see
+// BaseStorage.Wait). The returned slice is the Data of the storage.
+func (f *BFloat16Storage) Float32s() ([]float32, error) {
+	if _, err := storageData(f); err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// BFloat16Bits returns a new slice with the elements of the storage
+// encoded as the bits of bfloat16 values, as they are stored in the file.
+func (f *BFloat16Storage) BFloat16Bits() ([]uint16, error) {
+	if _, err := storageData(f); err != nil {
+		return nil, err
+	}
+	bits := make([]uint16, len(f.Data))
+	for i, v := range f.Data {
+		bits[i] = Float32ToBFloat16(v)
+	}
+	return bits, nil
+}
+
 // ----- Float -----
 
 type FloatStorageClass struct{}
@@ -329,6 +464,331 @@ func (f *ByteStorage) SetFromFileWithSize(r io.Reader, size int) error {
 	return nil
 }
 
+// ----- Uint16 -----
+
+// Uint16StorageClass is the storage class of the "torch.uint16" data type.
+// PyTorch has no such legacy storage class: tensors of this type are saved
+// with untyped storages (see RebuildTensorV3).
+type Uint16StorageClass struct{}
+
+var _ StorageClassInterface = &Uint16StorageClass{}
+
+func (f *Uint16StorageClass) New(size int, location string) StorageInterface {
+	return &Uint16Storage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type Uint16Storage struct {
+	BaseStorage
+	Data []uint16
+}
+
+var _ StorageInterface = &Uint16Storage{}
+
+func (f *Uint16Storage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *Uint16Storage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]uint16, size)
+	br := NewLimitedBufferReader(r, size, 2, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = binary.LittleEndian.Uint16(bytes)
+	}
+	f.Data = data
+	return nil
+}
+
+// ----- Uint32 -----
+
+// Uint32StorageClass is the storage class of the "torch.uint32" data type,
+// like Uint16StorageClass.
+type Uint32StorageClass struct{}
+
+var _ StorageClassInterface = &Uint32StorageClass{}
+
+func (f *Uint32StorageClass) New(size int, location string) StorageInterface {
+	return &Uint32Storage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type Uint32Storage struct {
+	BaseStorage
+	Data []uint32
+}
+
+var _ StorageInterface = &Uint32Storage{}
+
+func (f *Uint32Storage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *Uint32Storage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]uint32, size)
+	br := NewLimitedBufferReader(r, size, 4, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = binary.LittleEndian.Uint32(bytes)
+	}
+	f.Data = data
+	return nil
+}
+
+// ----- Uint64 -----
+
+// Uint64StorageClass is the storage class of the "torch.uint64" data type,
+// like Uint16StorageClass.
+type Uint64StorageClass struct{}
+
+var _ StorageClassInterface = &Uint64StorageClass{}
+
+func (f *Uint64StorageClass) New(size int, location string) StorageInterface {
+	return &Uint64Storage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type Uint64Storage struct {
+	BaseStorage
+	Data []uint64
+}
+
+var _ StorageInterface = &Uint64Storage{}
+
+func (f *Uint64Storage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *Uint64Storage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]uint64, size)
+	br := NewLimitedBufferReader(r, size, 8, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = binary.LittleEndian.Uint64(bytes)
+	}
+	f.Data = data
+	return nil
+}
+
+// ----- ComplexFloat -----
+
+// ComplexFloatStorageClass is the storage class of the "torch.complex64"
+// data type, whose elements are pairs of float32 values.
+type ComplexFloatStorageClass struct{}
+
+var _ StorageClassInterface = &ComplexFloatStorageClass{}
+
+func (f *ComplexFloatStorageClass) New(size int, location string) StorageInterface {
+	return &ComplexFloatStorage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type ComplexFloatStorage struct {
+	BaseStorage
+	Data []complex64
+}
+
+var _ StorageInterface = &ComplexFloatStorage{}
+
+func (f *ComplexFloatStorage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *ComplexFloatStorage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]complex64, size)
+	br := NewLimitedBufferReader(r, size, 8, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = complex(
+			math.Float32frombits(binary.LittleEndian.Uint32(bytes)),
+			math.Float32frombits(binary.LittleEndian.Uint32(bytes[4:])))
+	}
+	f.Data = data
+	return nil
+}
+
+// ----- ComplexDouble -----
+
+// ComplexDoubleStorageClass is the storage class of the "torch.complex128"
+// data type, whose elements are pairs of float64 values.
+type ComplexDoubleStorageClass struct{}
+
+var _ StorageClassInterface = &ComplexDoubleStorageClass{}
+
+func (f *ComplexDoubleStorageClass) New(size int, location string) StorageInterface {
+	return &ComplexDoubleStorage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type ComplexDoubleStorage struct {
+	BaseStorage
+	Data []complex128
+}
+
+var _ StorageInterface = &ComplexDoubleStorage{}
+
+func (f *ComplexDoubleStorage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *ComplexDoubleStorage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]complex128, size)
+	br := NewLimitedBufferReader(r, size, 16, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = complex(
+			math.Float64frombits(binary.LittleEndian.Uint64(bytes)),
+			math.Float64frombits(binary.LittleEndian.Uint64(bytes[8:])))
+	}
+	f.Data = data
+	return nil
+}
+
+// ----- QInt8 -----
+
+// QInt8StorageClass is the storage class of the "torch.qint8" quantized
+// data type, whose elements are signed integers (see Tensor.Dequantize).
+type QInt8StorageClass struct{}
+
+var _ StorageClassInterface = &QInt8StorageClass{}
+
+func (f *QInt8StorageClass) New(size int, location string) StorageInterface {
+	return &QInt8Storage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type QInt8Storage struct {
+	BaseStorage
+	Data []int8
+}
+
+var _ StorageInterface = &QInt8Storage{}
+
+func (f *QInt8Storage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *QInt8Storage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]int8, size)
+	br := NewLimitedBufferReader(r, size, 1, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = int8(bytes[0])
+	}
+	f.Data = data
+	return nil
+}
+
+// ----- QUInt8 -----
+
+// QUInt8StorageClass is the storage class of the "torch.quint8" quantized
+// data type, like QInt8StorageClass, but with unsigned elements.
+type QUInt8StorageClass struct{}
+
+var _ StorageClassInterface = &QUInt8StorageClass{}
+
+func (f *QUInt8StorageClass) New(size int, location string) StorageInterface {
+	return &QUInt8Storage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type QUInt8Storage struct {
+	BaseStorage
+	Data []uint8
+}
+
+var _ StorageInterface = &QUInt8Storage{}
+
+func (f *QUInt8Storage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *QUInt8Storage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]uint8, size)
+	br := NewLimitedBufferReader(r, size, 1, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = bytes[0]
+	}
+	f.Data = data
+	return nil
+}
+
+// ----- QInt32 -----
+
+// QInt32StorageClass is the storage class of the "torch.qint32" quantized
+// data type, like QInt8StorageClass.
+type QInt32StorageClass struct{}
+
+var _ StorageClassInterface = &QInt32StorageClass{}
+
+func (f *QInt32StorageClass) New(size int, location string) StorageInterface {
+	return &QInt32Storage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type QInt32Storage struct {
+	BaseStorage
+	Data []int32
+}
+
+var _ StorageInterface = &QInt32Storage{}
+
+func (f *QInt32Storage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *QInt32Storage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]int32, size)
+	br := NewLimitedBufferReader(r, size, 4, 512)
+	for i := 0; i < size; i++ {
+		bytes, err := br.ReadNext()
+		if err != nil {
+			return err
+		}
+		data[i] = int32(binary.LittleEndian.Uint32(bytes))
+	}
+	f.Data = data
+	return nil
+}
+
 // ----- Bool -----
 
 type BoolStorageClass struct{}
@@ -367,12 +827,549 @@ func (f *BoolStorage) SetFromFileWithSize(r io.Reader, size int) error {
 	return nil
 }
 
+// ----- Untyped -----
+
+// UntypedStorageClass represents "torch.UntypedStorage", whose storages
+// are plain sequences of bytes. The actual data type of the elements is
+// only known from the tensors referring to it (see RebuildTensorV3).
+type UntypedStorageClass struct{}
+
+var _ StorageClassInterface = &UntypedStorageClass{}
+
+// New returns a new UntypedStorage. For untyped storages, size is the
+// amount of bytes.
+func (f *UntypedStorageClass) New(size int, location string) StorageInterface {
+	return &UntypedStorage{
+		BaseStorage: BaseStorage{Size: size, Location: location},
+		Data:        nil,
+	}
+}
+
+type UntypedStorage struct {
+	BaseStorage
+	Data []byte
+	// typed caches the typed storages built from Data by Reinterpret,
+	// so that tensors sharing this storage also share the typed ones.
+	typed map[*Dtype]StorageInterface
+}
+
+var _ StorageInterface = &UntypedStorage{}
+
+func (f *UntypedStorage) SetFromFile(r io.Reader) error {
+	return setFromFile(f, r)
+}
+
+func (f *UntypedStorage) SetFromFileWithSize(r io.Reader, size int) error {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	f.Data = data
+	return nil
+}
+
+// Reinterpret returns a typed storage holding the bytes of the UntypedStorage
+// interpreted as elements of the given data type.
+//
+// The element size comes from the data type, so the resulting storage has
+// Size / dtype.ElementSize elements. The same typed storage is returned for
+// repeated calls with the same data type. The bytes remain the only copy of
+// the data: the Data of the typed storage shares their memory, when its
+// elements are held as they are stored, or else it is decoded from them
+// again on each access, so that it reflects their changes.
+func (f *UntypedStorage) Reinterpret(dtype *Dtype) (StorageInterface, error) {
+	if typed, ok := f.typed[dtype]; ok {
+		return typed, nil
+	}
+	if f.Size%dtype.ElementSize != 0 {
+		return nil, fmt.Errorf(
+			"untyped storage of %d bytes cannot be interpreted as %s",
+			f.Size, dtype)
+	}
+	size := f.Size / dtype.ElementSize
+	typed := dtype.StorageClass.New(size, f.Location)
+	bs, ok := typed.(baseStorager)
+	if !ok {
+		return nil, fmt.Errorf("storage %T cannot be reinterpreted", typed)
+	}
+	fill := func() error {
+		if len(f.Data) != f.Size {
+			return fmt.Errorf(
+				"untyped storage data length %d does not match its size %d",
+				len(f.Data), f.Size)
+		}
+		if setStorageView(typed, f.Data, size, binary.LittleEndian) {
+			return nil
+		}
+		bs.baseStorage().viewOf = f
+		return f.fill(typed, size)
+	}
+	if f.pending == nil {
+		if err := fill(); err != nil {
+			return nil, err
+		}
+	} else {
+		// The data is still being read by LoadAsync, or is loaded lazily:
+		// the typed storage is filled as soon as it is available.
+		f.pending.then(bs.baseStorage(), fill)
+	}
+	if f.typed == nil {
+		f.typed = make(map[*Dtype]StorageInterface, 1)
+	}
+	f.typed[dtype] = typed
+	return typed, nil
+}
+
+// untypedView returns an UntypedStorage holding the raw bytes of the
+// elements of a typed storage, so that they can be reinterpreted as
+// another data type, as tensors of different types viewing the same
+// storage require. The same view is returned by repeated calls. Its Data
+// shares the memory of the elements of s, when they are held as they are
+// stored, or else it is encoded from them again on each access.
+func untypedView(s StorageInterface) (*UntypedStorage, error) {
+	bs, ok := s.(baseStorager)
+	elementSize, sizeOk := storageElementSize(s)
+	if !ok || !sizeOk {
+		return nil, fmt.Errorf("storage %T cannot be reinterpreted", s)
+	}
+	b := bs.baseStorage()
+	if b.untyped != nil {
+		return b.untyped, nil
+	}
+	untyped := &UntypedStorage{
+		BaseStorage: BaseStorage{Size: b.Size * elementSize, Location: b.Location},
+	}
+	fill := func() error {
+		if data, ok := storageMemory(s); ok {
+			untyped.Data = data
+			return nil
+		}
+		untyped.viewOf = s
+		return untyped.encode()
+	}
+	if b.pending == nil {
+		if err := fill(); err != nil {
+			return nil, err
+		}
+	} else {
+		b.pending.then(&untyped.BaseStorage, fill)
+	}
+	b.untyped = untyped
+	return untyped, nil
+}
+
+// encode sets the Data of an UntypedStorage which is a view of another
+// storage to the bytes of its current elements, reusing the Data slice,
+// since the typed views of the UntypedStorage may share its memory.
+func (f *UntypedStorage) encode() error {
+	data, err := storageData(f.viewOf)
+	if err != nil {
+		return err
+	}
+	if len(f.Data) != f.Size {
+		f.Data = make([]byte, f.Size)
+	}
+	return encodeData(f.Data, f.viewOf, data.Interface())
+}
+
+// fill sets the data of a typed storage of the given size from the bytes
+// of the UntypedStorage.
+func (f *UntypedStorage) fill(typed StorageInterface, size int) error {
+	if len(f.Data) != f.Size {
+		return fmt.Errorf(
+			"untyped storage data length %d does not match its size %d",
+			len(f.Data), f.Size)
+	}
+	return typed.SetFromFileWithSize(bytes.NewReader(f.Data), size)
+}
+
+// SetFromReaders reads size elements of the storage from the given
+// readers, which are logically concatenated in order, as if they were a
+// single source. An element may also span two consecutive readers.
+//
+// This is useful for the uncommon files, written by custom savers, where
+// the data of a single storage is split across multiple entries. An error
+// is returned if the readers, altogether, hold less than size elements.
+func SetFromReaders(s StorageInterface, size int, readers ...io.Reader) error {
+	return s.SetFromFileWithSize(io.MultiReader(readers...), size)
+}
+
 func setFromFile(s StorageInterface, r io.Reader) error {
 	sizeBuf := make([]byte, 8)
-	_, err := r.Read(sizeBuf)
-	if err != nil {
+	// The size is expected even at the end of the data, and may be
+	// returned in more chunks by readers which are not files.
+	if _, err := io.ReadFull(r, sizeBuf); err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
 		return err
 	}
 	size := int(binary.LittleEndian.Uint64(sizeBuf))
 	return s.SetFromFileWithSize(r, size)
 }
+
+// setStorageData sets size elements of a storage of the given class from
+// r, which holds them in the given byte order. The big-endian elements are
+// converted to little-endian, as SetFromFileWithSize expects them, which
+// requires the element size of a built-in typed storage class. The bytes
+// of an untyped storage are kept as they are, as PyTorch does, since they
+// have no data type to swap.
+func setStorageData(
+	storage StorageInterface,
+	dataType StorageClassInterface,
+	r io.Reader,
+	size int,
+	byteOrder binary.ByteOrder,
+) error {
+	_, isUntyped := dataType.(*UntypedStorageClass)
+	if byteOrder != binary.BigEndian || isUntyped {
+		return storage.SetFromFileWithSize(r, size)
+	}
+	elementSize, ok := storageClassElementSize(dataType)
+	if !ok {
+		return fmt.Errorf("big-endian data of storage %T is not supported", storage)
+	}
+	data := make([]byte, size*elementSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	// the real and imaginary parts of complex numbers are swapped apart
+	swapSize := elementSize
+	switch dataType.(type) {
+	case *ComplexFloatStorageClass, *ComplexDoubleStorageClass:
+		swapSize /= 2
+	}
+	for i := 0; i < len(data); i += swapSize {
+		element := data[i : i+swapSize]
+		for j, k := 0, swapSize-1; j < k; j, k = j+1, k-1 {
+			element[j], element[k] = element[k], element[j]
+		}
+	}
+	return storage.SetFromFileWithSize(bytes.NewReader(data), size)
+}
+
+// storageClassElementSize returns the size in bytes of a single element
+// of the storages created by one of the built-in storage classes.
+func storageClassElementSize(c StorageClassInterface) (int, bool) {
+	switch c.(type) {
+	case *UntypedStorageClass:
+		return 1, true
+	case *HalfStorageClass:
+		return Float16.ElementSize, true
+	case *BFloat16StorageClass:
+		return BFloat16.ElementSize, true
+	case *FloatStorageClass:
+		return Float32.ElementSize, true
+	case *DoubleStorageClass:
+		return Float64.ElementSize, true
+	case *CharStorageClass:
+		return Int8.ElementSize, true
+	case *ShortStorageClass:
+		return Int16.ElementSize, true
+	case *IntStorageClass:
+		return Int32.ElementSize, true
+	case *LongStorageClass:
+		return Int64.ElementSize, true
+	case *ByteStorageClass:
+		return Uint8.ElementSize, true
+	case *Uint16StorageClass:
+		return Uint16.ElementSize, true
+	case *Uint32StorageClass:
+		return Uint32.ElementSize, true
+	case *Uint64StorageClass:
+		return Uint64.ElementSize, true
+	case *ComplexFloatStorageClass:
+		return Complex64.ElementSize, true
+	case *ComplexDoubleStorageClass:
+		return Complex128.ElementSize, true
+	case *QInt8StorageClass:
+		return QInt8.ElementSize, true
+	case *QUInt8StorageClass:
+		return QUInt8.ElementSize, true
+	case *QInt32StorageClass:
+		return QInt32.ElementSize, true
+	case *BoolStorageClass:
+		return Bool.ElementSize, true
+	default:
+		return 0, false
+	}
+}
+
+// storageData returns the value of the Data slice of a storage, which is
+// provided by all the built-in storage types.
+func storageData(s StorageInterface) (reflect.Value, error) {
+	if err := waitStorage(s); err != nil {
+		return reflect.Value{}, err
+	}
+	if err := refreshView(s); err != nil {
+		return reflect.Value{}, err
+	}
+	return storageDataField(s)
+}
+
+// refreshView converts again the data of a view of a storage as another
+// data type from the current elements of that storage, if the view cannot
+// share their memory (see BaseStorage.viewOf).
+func refreshView(s StorageInterface) error {
+	bs, ok := s.(baseStorager)
+	if !ok || bs.baseStorage().viewOf == nil {
+		return nil
+	}
+	if us, ok := s.(*UntypedStorage); ok {
+		return us.encode()
+	}
+	us, ok := bs.baseStorage().viewOf.(*UntypedStorage)
+	if !ok {
+		return fmt.Errorf("storage %T cannot be reinterpreted", s)
+	}
+	if err := refreshView(us); err != nil {
+		return err
+	}
+	return us.fill(s, bs.baseStorage().Size)
+}
+
+// storageDataField is like storageData, but it does not wait for the data
+// of the storage, so that it can be set while the storage is pending.
+func storageDataField(s StorageInterface) (reflect.Value, error) {
+	v := reflect.ValueOf(s)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("Data"); f.IsValid() && f.Kind() == reflect.Slice {
+			return f, nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported storage %T", s)
+}
+
+// newStorageWithData returns a new storage of the same type and location
+// of the given one, holding the given data.
+func newStorageWithData(like StorageInterface, data interface{}) (StorageInterface, error) {
+	t := reflect.TypeOf(like)
+	if t.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("unsupported storage %T", like)
+	}
+	storage, ok := reflect.New(t.Elem()).Interface().(StorageInterface)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage %T", like)
+	}
+	field, err := storageData(storage)
+	if err != nil {
+		return nil, err
+	}
+	value := reflect.ValueOf(data)
+	if value.Type() != field.Type() {
+		return nil, fmt.Errorf("cannot set %T data on storage %T", data, like)
+	}
+	field.Set(value)
+	if bs, ok := storage.(baseStorager); ok {
+		b := bs.baseStorage()
+		b.Size = value.Len()
+		if lbs, ok := like.(baseStorager); ok {
+			b.Location = lbs.baseStorage().Location
+		}
+	}
+	return storage, nil
+}
+
+// gather returns a new slice of the same type of data, made of the
+// elements at the given indices.
+func gather(data interface{}, indices []int) (interface{}, error) {
+	switch d := data.(type) {
+	case []float32:
+		r := make([]float32, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []float64:
+		r := make([]float64, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []int8:
+		r := make([]int8, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []int16:
+		r := make([]int16, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []int32:
+		r := make([]int32, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []int64:
+		r := make([]int64, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []uint8:
+		r := make([]uint8, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []uint16:
+		r := make([]uint16, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []uint32:
+		r := make([]uint32, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []uint64:
+		r := make([]uint64, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	case []bool:
+		r := make([]bool, len(indices))
+		for i, index := range indices {
+			r[i] = d[index]
+		}
+		return r, nil
+	default:
+		// Slower, generic path for any other data type.
+		v := reflect.ValueOf(data)
+		if v.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("unsupported storage data %T", data)
+		}
+		r := reflect.MakeSlice(v.Type(), len(indices), len(indices))
+		for i, index := range indices {
+			r.Index(i).Set(v.Index(index))
+		}
+		return r.Interface(), nil
+	}
+}
+
+// encodeStorage returns the raw little-endian bytes of the elements of one
+// of the built-in storages, as they are stored in PyTorch files.
+func encodeStorage(s StorageInterface) ([]byte, error) {
+	data, err := storageData(s)
+	if err != nil {
+		return nil, err
+	}
+	elementSize, ok := storageElementSize(s)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage %T", s)
+	}
+	buf := make([]byte, elementSize*data.Len())
+	if err := encodeData(buf, s, data.Interface()); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// storageElementSize returns the size in bytes of a single element of one
+// of the built-in storages.
+func storageElementSize(s StorageInterface) (int, bool) {
+	if _, ok := s.(*UntypedStorage); ok {
+		return 1, true
+	}
+	if dtype := storageDtype(s); dtype != nil {
+		return dtype.ElementSize, true
+	}
+	return 0, false
+}
+
+// encodeData writes to buf, which must be large enough, the raw
+// little-endian bytes of data, which is the Data slice of the storage s,
+// or part of it.
+func encodeData(buf []byte, s StorageInterface, data interface{}) error {
+	if _, isHalf := s.(*HalfStorage); isHalf {
+		d, ok := data.([]float32)
+		if !ok {
+			return fmt.Errorf("unsupported storage data %T", data)
+		}
+		for i, v := range d {
+			binary.LittleEndian.PutUint16(buf[2*i:], FloatBits32to16(math.Float32bits(v)))
+		}
+		return nil
+	}
+	if _, isBFloat16 := s.(*BFloat16Storage); isBFloat16 {
+		d, ok := data.([]float32)
+		if !ok {
+			return fmt.Errorf("unsupported storage data %T", data)
+		}
+		for i, v := range d {
+			binary.LittleEndian.PutUint16(buf[2*i:], BFloatBits32to16(math.Float32bits(v)))
+		}
+		return nil
+	}
+
+	switch d := data.(type) {
+	case []float32:
+		for i, v := range d {
+			binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+		}
+	case []float64:
+		for i, v := range d {
+			binary.LittleEndian.PutUint64(buf[8*i:], math.Float64bits(v))
+		}
+	case []int8:
+		for i, v := range d {
+			buf[i] = byte(v)
+		}
+	case []int16:
+		for i, v := range d {
+			binary.LittleEndian.PutUint16(buf[2*i:], uint16(v))
+		}
+	case []int32:
+		for i, v := range d {
+			binary.LittleEndian.PutUint32(buf[4*i:], uint32(v))
+		}
+	case []int64:
+		for i, v := range d {
+			binary.LittleEndian.PutUint64(buf[8*i:], uint64(v))
+		}
+	case []uint8:
+		copy(buf, d)
+	case []uint16:
+		for i, v := range d {
+			binary.LittleEndian.PutUint16(buf[2*i:], v)
+		}
+	case []uint32:
+		for i, v := range d {
+			binary.LittleEndian.PutUint32(buf[4*i:], v)
+		}
+	case []uint64:
+		for i, v := range d {
+			binary.LittleEndian.PutUint64(buf[8*i:], v)
+		}
+	case []complex64:
+		for i, v := range d {
+			binary.LittleEndian.PutUint32(buf[8*i:], math.Float32bits(real(v)))
+			binary.LittleEndian.PutUint32(buf[8*i+4:], math.Float32bits(imag(v)))
+		}
+	case []complex128:
+		for i, v := range d {
+			binary.LittleEndian.PutUint64(buf[16*i:], math.Float64bits(real(v)))
+			binary.LittleEndian.PutUint64(buf[16*i+8:], math.Float64bits(imag(v)))
+		}
+	case []bool:
+		for i, v := range d {
+			if v {
+				buf[i] = 1
+			} else {
+				buf[i] = 0
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported storage data %T", data)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"sort"
+	"strconv"
+)
+
+// StorageGroups returns the storages of all the tensors found in obj, such
+// as a checkpoint returned by Load, each with the sorted paths of the
+// tensors which share it. A storage with more than one path is aliased by
+// views, such as slices of a larger tensor, so its memory should only be
+// counted once.
+//
+// A path is made of the keys of the dictionaries and of the indices of the
+// lists and tuples leading to the tensor, separated by dots, such as
+// "optimizer.state.0.exp_avg". The parameters and buffers of a Module are
+// named as in Module.ParameterNames, and the tensors of the modules of a
+// TorchScript archive (see LoadScriptModule) by their attribute names.
+func StorageGroups(obj interface{}) map[StorageInterface][]string {
+	groups := make(map[StorageInterface][]string)
+	collectTensors(obj, "", make(map[interface{}]bool), func(path string, t *Tensor) {
+		if t.Source != nil {
+			groups[t.Source] = append(groups[t.Source], path)
+		}
+	})
+	for _, paths := range groups {
+		sort.Strings(paths)
+	}
+	return groups
+}
+
+// FindTensors returns all the tensors found in obj, such as a checkpoint
+// or a whole model returned by Load, in the order of the dictionaries,
+// lists and tuples holding them, each named by its path as in
+// StorageGroups. A tensor reachable through more than one path, as a
+// shared parameter, is only returned once.
+func FindTensors(obj interface{}) []StateDictEntry {
+	var result []StateDictEntry
+	found := make(map[*Tensor]bool)
+	collectTensors(obj, "", make(map[interface{}]bool), func(path string, t *Tensor) {
+		if !found[t] {
+			found[t] = true
+			result = append(result, StateDictEntry{Name: path, Tensor: t})
+		}
+	})
+	return result
+}
+
+// collectTensors calls f for each tensor found in obj, recursively, along
+// with its path. Containers already visited are skipped, as they may even
+// contain themselves.
+func collectTensors(obj interface{}, path string, visited map[interface{}]bool, f func(path string, t *Tensor)) {
+	switch v := obj.(type) {
+	case *Tensor:
+		f(path, v)
+		return
+	case *types.Dict, *types.OrderedDict, *types.DefaultDict, *types.Counter, *types.List, *types.Tuple, *Module:
+		if visited[obj] {
+			return
+		}
+		visited[obj] = true
+	default:
+		return
+	}
+
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+	switch v := obj.(type) {
+	case *types.List:
+		for i, item := range *v {
+			collectTensors(item, prefix+strconv.Itoa(i), visited, f)
+		}
+	case *types.Tuple:
+		for i, item := range *v {
+			collectTensors(item, prefix+strconv.Itoa(i), visited, f)
+		}
+	case *Module:
+		if _, ok := v.Attributes.Get("_parameters"); !ok {
+			// the flat attributes of a module of a TorchScript archive
+			entries, _ := dictEntries(v.Attributes)
+			for _, entry := range entries {
+				collectTensors(entry.Value, prefix+fmt.Sprint(entry.Key), visited, f)
+			}
+			return
+		}
+		for _, attr := range []string{"_parameters", "_buffers", "_modules"} {
+			members, _ := v.Attributes.Get(attr)
+			entries, _ := dictEntries(members)
+			for _, entry := range entries {
+				collectTensors(entry.Value, prefix+fmt.Sprint(entry.Key), visited, f)
+			}
+		}
+	default:
+		entries, _ := dictEntries(obj)
+		for _, entry := range entries {
+			collectTensors(entry.Value, prefix+fmt.Sprint(entry.Key), visited, f)
+		}
+	}
+}
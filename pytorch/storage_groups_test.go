@@ -0,0 +1,87 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestStorageGroups(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+	stateDict := types.NewOrderedDict()
+	stateDict.Set("fc.weight", weight)
+	// weight[1], a view sharing the storage of weight
+	stateDict.Set("fc.row", &Tensor{Source: weight.Source, StorageOffset: 3, Size: []int{3}, Stride: []int{1}})
+	stateDict.Set("fc.bias", newFloatTensor([]float32{0.5, -0.5}, 2))
+	state := types.NewDict()
+	state.Set(0, &types.List{newFloatTensor([]float32{0}, 1), "not a tensor"})
+	checkpoint := types.NewDict()
+	checkpoint.Set("model", stateDict)
+	checkpoint.Set("optimizer", state)
+	checkpoint.Set("epoch", 3)
+
+	filename := path.Join(t.TempDir(), "checkpoint.pt")
+	if err := Save(checkpoint, filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := StorageGroups(loaded)
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 storages, actual %d: %v", len(groups), groups)
+	}
+	tensors, _, err := stateDictTensors(loaded, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"fc.weight": {"model.fc.row", "model.fc.weight"},
+		"fc.bias":   {"model.fc.bias"},
+	}
+	for key, paths := range expected {
+		if actual := groups[tensors[key].Source]; !reflect.DeepEqual(actual, paths) {
+			t.Errorf("%s: expected paths %v, actual %v", key, paths, actual)
+		}
+	}
+	found := false
+	for _, paths := range groups {
+		if reflect.DeepEqual(paths, []string{"optimizer.0.0"}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a group for optimizer.0.0, actual %v", groups)
+	}
+}
+
+func TestFindTensors(t *testing.T) {
+	weight := newFloatTensor([]float32{1, 2}, 2)
+	bias := newFloatTensor([]float32{3}, 1)
+	params := types.NewOrderedDict()
+	params.Set("weight", weight)
+	params.Set("bias", bias)
+	checkpoint := types.NewDict()
+	checkpoint.Set("model", params)
+	// the same tensor again, as a tied parameter
+	checkpoint.Set("tied", &types.Tuple{weight, "not a tensor"})
+	checkpoint.Set("epoch", 3)
+
+	entries := FindTensors(checkpoint)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 tensors, actual %d: %v", len(entries), entries)
+	}
+	if entries[0].Name != "model.weight" || entries[0].Tensor != weight {
+		t.Errorf("expected model.weight first, actual %v", entries[0])
+	}
+	if entries[1].Name != "model.bias" || entries[1].Tensor != bias {
+		t.Errorf("expected model.bias second, actual %v", entries[1])
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSetFromReaders(t *testing.T) {
+	data := []byte{
+		0x00, 0x00, 0x80, 0x3f, // 1.0
+		0x00, 0x00, 0x00, 0x40, // 2.0
+		0x00, 0x00, 0x40, 0x40, // 3.0
+	}
+
+	t.Run("element spanning two readers", func(t *testing.T) {
+		storage := (&FloatStorageClass{}).New(3, "cpu").(*FloatStorage)
+		err := SetFromReaders(storage, 3,
+			bytes.NewReader(data[:6]), bytes.NewReader(data[6:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFloat32SliceEqual(t, storage.Data, []float32{1, 2, 3}, 0)
+	})
+
+	t.Run("single reader", func(t *testing.T) {
+		storage := (&FloatStorageClass{}).New(3, "cpu").(*FloatStorage)
+		if err := SetFromReaders(storage, 3, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		assertFloat32SliceEqual(t, storage.Data, []float32{1, 2, 3}, 0)
+	})
+
+	t.Run("not enough data", func(t *testing.T) {
+		storage := (&FloatStorageClass{}).New(4, "cpu")
+		err := SetFromReaders(storage, 4,
+			bytes.NewReader(data[:4]), bytes.NewReader(data[4:]))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("expected io.ErrUnexpectedEOF, actual %#v", err)
+		}
+	})
+}
+
+func TestSetFromFileShortReads(t *testing.T) {
+	data := []byte{
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // size
+		0x00, 0x00, 0x80, 0x3f, // 1.0
+		0x00, 0x00, 0x00, 0x40, // 2.0
+	}
+	storage := (&FloatStorageClass{}).New(2, "cpu").(*FloatStorage)
+	if err := storage.SetFromFile(iotest.OneByteReader(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, storage.Data, []float32{1, 2}, 0)
+
+	for _, n := range []int{0, 4, 12} {
+		err := storage.SetFromFile(iotest.OneByteReader(bytes.NewReader(data[:n])))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("%d bytes: expected io.ErrUnexpectedEOF, actual %#v", n, err)
+		}
+	}
+}
+
+func TestReinterpretDecodedView(t *testing.T) {
+	// float16 1 and 2
+	untyped := &UntypedStorage{
+		BaseStorage: BaseStorage{Size: 4, Location: "cpu"},
+		Data:        []byte{0x00, 0x3c, 0x00, 0x40},
+	}
+	typed, err := untyped.Reinterpret(Float16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := typed.(*HalfStorage)
+	data, err := half.Float32s()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, data, []float32{1, 2}, 0)
+
+	// the float16 elements are decoded again from the changed bytes
+	untyped.Data[3] = 0x42 // 2 becomes 3
+	data, err = half.Float32s()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, data, []float32{1, 3}, 0)
+
+	// and the bytes of a view of the float16 storage are encoded again
+	view, err := untypedView(&HalfStorage{
+		BaseStorage: BaseStorage{Size: 1, Location: "cpu"},
+		Data:        []float32{1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view.viewOf.(*HalfStorage).Data[0] = 2
+	raw, err := storageData(view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw.Bytes(), []byte{0x00, 0x40}) {
+		t.Errorf("expected bytes [0 64], actual %v", raw.Bytes())
+	}
+}
+
+// BenchmarkFloatStorageDecoding compares the decoding of float32 elements
+// done by FloatStorage, straight from their bytes, with a decoding through
+// a float64 intermediate, which FloatStorage avoids.
+func BenchmarkFloatStorageDecoding(b *testing.B) {
+	const n = 1 << 20
+	raw := make([]byte, 4*n)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(float32(i)/3))
+	}
+
+	b.Run("direct", func(b *testing.B) {
+		b.SetBytes(int64(len(raw)))
+		storage := (&FloatStorageClass{}).New(n, "cpu")
+		for i := 0; i < b.N; i++ {
+			if err := storage.SetFromFileWithSize(bytes.NewReader(raw), n); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("float64 intermediate", func(b *testing.B) {
+		b.SetBytes(int64(len(raw)))
+		for i := 0; i < b.N; i++ {
+			br := NewLimitedBufferReader(bytes.NewReader(raw), n, 4, 512)
+			wide := make([]float64, n)
+			for j := range wide {
+				buf, err := br.ReadNext()
+				if err != nil {
+					b.Fatal(err)
+				}
+				wide[j] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf)))
+			}
+			data := make([]float32, n)
+			for j, v := range wide {
+				data[j] = float32(v)
+			}
+		}
+	})
+}
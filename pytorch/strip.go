@@ -0,0 +1,58 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// StripToWeights loads the checkpoint inFile and saves to outFile just the
+// model weights, dropping everything else, such as the optimizer state.
+//
+// The weights are taken from the "state_dict" or "model" entry of the
+// checkpoint (or "model_state_dict"), if any, otherwise from the checkpoint
+// itself. Only the entries whose values are tensors are kept, and they are
+// saved as a state dict. The tensors are saved as they are, so their data
+// types, sizes and strides are preserved, as well as the storages shared
+// among them.
+func StripToWeights(inFile, outFile string) error {
+	checkpoint, err := Load(inFile)
+	if err != nil {
+		return err
+	}
+	stateDict, err := extractStateDict(checkpoint)
+	if err != nil {
+		return fmt.Errorf("StripToWeights: %s: %w", inFile, err)
+	}
+	return Save(stateDict, outFile)
+}
+
+// extractStateDict returns a new OrderedDict with the tensors of the state
+// dict of a checkpoint. The attributes of the original state dict, such as
+// "_metadata", are kept.
+func extractStateDict(checkpoint interface{}) (*types.OrderedDict, error) {
+	checkpoint = findStateDict(checkpoint)
+	entries, ok := dictEntries(checkpoint)
+	if !ok {
+		return nil, fmt.Errorf("expected a dictionary, got %T", checkpoint)
+	}
+
+	stateDict := types.NewOrderedDict()
+	for _, entry := range entries {
+		if _, isTensor := entry.Value.(*Tensor); isTensor {
+			stateDict.Set(entry.Key, entry.Value)
+		}
+	}
+	if stateDict.Len() == 0 {
+		return nil, fmt.Errorf("no tensors found")
+	}
+	if od, ok := checkpoint.(*types.OrderedDict); ok {
+		for name, value := range od.PyDict {
+			stateDict.PyDict[name] = value
+		}
+	}
+	return stateDict, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"github.com/nlpodyssey/gopickle/types"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestStripToWeights(t *testing.T) {
+	inFile := path.Join("testdata", "synthetic_training_checkpoint.pt")
+	outFile := path.Join(t.TempDir(), "weights.pt")
+	if err := StripToWeights(inFile, outFile); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := Load(inFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := checkpoint.(*types.Dict).MustGet("model").(*types.OrderedDict)
+
+	result, err := Load(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weights, ok := result.(*types.OrderedDict)
+	if !ok {
+		t.Fatalf("expected *types.OrderedDict, got %#v", result)
+	}
+
+	var names []interface{}
+	for e := weights.List.Front(); e != nil; e = e.Next() {
+		names = append(names, e.Value.(*types.OrderedDictEntry).Key)
+	}
+	expectedNames := []interface{}{"embed.weight", "norm.weight",
+		"norm.num_batches_tracked", "proj.weight", "decoder.weight"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("expected keys %v, actual %v", expectedNames, names)
+	}
+	for _, name := range expectedNames {
+		assertTensorsEqual(t, weights.MustGet(name).(*Tensor), model.MustGet(name).(*Tensor))
+	}
+
+	embed := weights.MustGet("embed.weight").(*Tensor)
+	if decoder := weights.MustGet("decoder.weight").(*Tensor); decoder.Source != embed.Source {
+		t.Error("expected tied weights to share the same storage")
+	}
+	if dtype := weights.MustGet("norm.weight").(*Tensor).Dtype(); dtype != Float16 {
+		t.Errorf("expected torch.float16, actual %v", dtype)
+	}
+	if !reflect.DeepEqual(weights.PyDict["_metadata"], model.PyDict["_metadata"]) {
+		t.Errorf("expected _metadata %#v, actual %#v",
+			model.PyDict["_metadata"], weights.PyDict["_metadata"])
+	}
+
+	// the optimizer moments are dropped: only 4 storages are left
+	r, err := zip.OpenReader(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.File) != 7 {
+		t.Errorf("expected 7 records, actual %d", len(r.File))
+	}
+}
+
+func TestStripToWeightsWithoutTensors(t *testing.T) {
+	outFile := path.Join(t.TempDir(), "weights.pt")
+	err := StripToWeights(path.Join("testdata", "synthetic_untyped_storage_v3.pt"), outFile)
+	assertErrorContains(t, err, "expected a dictionary")
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// Layout represents a PyTorch memory layout ("torch.layout"), such as
+// "torch.strided". As for QScheme, the same few instances are always
+// shared, so they can be compared by pointer.
+type Layout struct {
+	// Name is the PyTorch name of the layout, without the "torch." prefix.
+	Name string
+}
+
+var (
+	Strided   = &Layout{Name: "strided"}
+	SparseCOO = &Layout{Name: "sparse_coo"}
+	SparseCSR = &Layout{Name: "sparse_csr"}
+	SparseCSC = &Layout{Name: "sparse_csc"}
+	SparseBSR = &Layout{Name: "sparse_bsr"}
+	SparseBSC = &Layout{Name: "sparse_bsc"}
+	Jagged    = &Layout{Name: "jagged"}
+)
+
+// layouts maps the names of the "torch" module attributes which refer to
+// a memory layout.
+var layouts = map[string]*Layout{
+	Strided.Name:   Strided,
+	SparseCOO.Name: SparseCOO,
+	SparseCSR.Name: SparseCSR,
+	SparseCSC.Name: SparseCSC,
+	SparseBSR.Name: SparseBSR,
+	SparseBSC.Name: SparseBSC,
+	Jagged.Name:    Jagged,
+}
+
+// String returns the Python representation of the layout, such as
+// "torch.strided".
+func (l *Layout) String() string {
+	return "torch." + l.Name
+}
+
+// DeviceClass represents "torch.device". Calling it returns the device as
+// a string, such as "cpu" or "cuda:0", in the same form of the Location of
+// the storages.
+type DeviceClass struct{}
+
+var _ types.Callable = &DeviceClass{}
+
+func (d *DeviceClass) Call(args ...interface{}) (interface{}, error) {
+	// args: type, and optional index
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("DeviceClass unexpected args: %#v", args)
+	}
+	device, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("DeviceClass unexpected args: %#v", args)
+	}
+	if len(args) == 2 && args[1] != nil {
+		index, ok := toInt(args[1])
+		if !ok {
+			return nil, fmt.Errorf("DeviceClass unexpected args: %#v", args)
+		}
+		device = fmt.Sprintf("%s:%d", device, index)
+	}
+	return device, nil
+}
+
+// RebuildWrapperSubclass represents "torch._utils._rebuild_wrapper_subclass",
+// which makes a tensor of a wrapper subclass of "torch.Tensor", such as the
+// ones of functorch. Such a tensor has no storage of its own: the resulting
+// *Tensor has a nil Source, which RebuildFromTypeV2 sets from the inner
+// tensor found in the state of the subclass.
+type RebuildWrapperSubclass struct {
+	counter *tensorCounter
+}
+
+var _ types.Callable = &RebuildWrapperSubclass{}
+
+func (r *RebuildWrapperSubclass) Call(args ...interface{}) (interface{}, error) {
+	// args: cls, dtype, size, stride, storage_offset, layout, device,
+	// requires_grad
+	if len(args) != 8 {
+		return nil, fmt.Errorf("RebuildWrapperSubclass unexpected args: %#v", args)
+	}
+	// arg[1] "dtype", arg[5] "layout" and arg[6] "device" are unused
+	if err := r.counter.add(); err != nil {
+		return nil, err
+	}
+	size, sizeOk := args[2].(*types.Tuple)
+	stride, strideOk := args[3].(*types.Tuple)
+	storageOffset, storageOffsetOk := toInt(args[4])
+	requiresGrad, requiresGradOk := args[7].(bool)
+	if !sizeOk || !strideOk || !storageOffsetOk || !requiresGradOk {
+		return nil, fmt.Errorf("RebuildWrapperSubclass unexpected args: %#v", args)
+	}
+	tensor := &Tensor{
+		StorageOffset: storageOffset,
+		RequiresGrad:  requiresGrad,
+		SubclassName:  className(args[0]),
+	}
+	var err error
+	tensor.Size, err = tupleToIntSlice(size)
+	if err != nil {
+		return nil, err
+	}
+	tensor.Stride, err = tupleToIntSlice(stride)
+	if err != nil {
+		return nil, err
+	}
+	return tensor, nil
+}
+
+// RebuildFromTypeV2 represents "torch._tensor._rebuild_from_type_v2", used
+// for the tensors of Python subclasses of "torch.Tensor", and for tensors
+// with Python attributes. It calls the given rebuild function, setting the
+// Tensor.SubclassName of the result to the name of the subclass.
+//
+// The state of the tensor is ignored, except that a tensor of a wrapper
+// subclass is unwrapped, taking the data of the first tensor found in the
+// state, such as its "_data" attribute.
+//
+// The subclass itself usually cannot be resolved, so loading such tensors
+// requires LoadOptions.AllowUnknownClasses, or a FindClass function which
+// resolves it.
+type RebuildFromTypeV2 struct{}
+
+var _ types.Callable = &RebuildFromTypeV2{}
+
+func (r *RebuildFromTypeV2) Call(args ...interface{}) (interface{}, error) {
+	// args: func, new_type, args, state
+	if len(args) != 4 {
+		return nil, fmt.Errorf("RebuildFromTypeV2 unexpected args: %#v", args)
+	}
+	rebuild, rebuildOk := args[0].(types.Callable)
+	rebuildArgs, rebuildArgsOk := args[2].(*types.Tuple)
+	if !rebuildOk || !rebuildArgsOk {
+		return nil, fmt.Errorf("RebuildFromTypeV2 unexpected args: %#v", args)
+	}
+	result, err := rebuild.Call(*rebuildArgs...)
+	if err != nil {
+		return nil, err
+	}
+	tensor, ok := result.(*Tensor)
+	if !ok {
+		return result, nil
+	}
+	if name := className(args[1]); name != "torch.Tensor" {
+		tensor.SubclassName = name
+	}
+	if tensor.Source == nil {
+		inner := stateTensor(args[3])
+		if inner == nil {
+			return nil, fmt.Errorf("RebuildFromTypeV2: no inner tensor "+
+				"found in the state of %s", tensor.SubclassName)
+		}
+		tensor.Source = inner.Source
+		tensor.StorageOffset = inner.StorageOffset
+		tensor.Size = inner.Size
+		tensor.Stride = inner.Stride
+		tensor.Quantizer = inner.Quantizer
+	}
+	return tensor, nil
+}
+
+// stateTensor returns the first tensor among the attributes of the state
+// of a tensor, which is a dictionary, optionally paired with the slots in
+// a tuple, or nil if there is none.
+func stateTensor(state interface{}) *Tensor {
+	if t, ok := state.(*types.Tuple); ok && t.Len() == 2 {
+		state = t.Get(0)
+	}
+	entries, _ := dictEntries(state)
+	for _, entry := range entries {
+		if tensor, ok := entry.Value.(*Tensor); ok {
+			return tensor
+		}
+	}
+	return nil
+}
+
+// className returns the qualified name of a resolved class, such as
+// "mylib.MyTensor".
+func className(class interface{}) string {
+	switch c := class.(type) {
+	case *types.GenericClass:
+		return c.Module + "." + c.Name
+	case fmt.Stringer:
+		return c.String()
+	default:
+		return fmt.Sprint(class)
+	}
+}
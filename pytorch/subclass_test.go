@@ -0,0 +1,106 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"io"
+	"path"
+	"testing"
+)
+
+func TestTensorSubclasses(t *testing.T) {
+	filename := path.Join("testdata", "synthetic_tensor_subclasses.pt")
+
+	_, err := Load(filename)
+	assertErrorContains(t, err, "class not found: mylib WrappedTensor")
+	var notFound *pickle.ClassNotFoundError
+	if !errors.As(err, &notFound) || notFound.Module != "mylib" || notFound.Name != "WrappedTensor" {
+		t.Errorf("expected a *pickle.ClassNotFoundError, actual %#v", err)
+	}
+
+	findMylib := LoadOptions{
+		NewUnpickler: func(r io.Reader) pickle.Unpickler {
+			u := pickle.NewUnpickler(r)
+			u.FindClass = func(module, name string) (interface{}, error) {
+				if module == "mylib" {
+					return types.NewGenericClass(module, name), nil
+				}
+				return nil, fmt.Errorf("class not found: %s %s", module, name)
+			}
+			return u
+		},
+	}
+	for name, opts := range map[string]LoadOptions{
+		"AllowUnknownClasses": {AllowUnknownClasses: true},
+		"FindClass":           findMylib,
+	} {
+		t.Run(name, func(t *testing.T) {
+			tensors, err := LoadStateDictWithOptions(filename, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, expected := range map[string]struct {
+				subclassName string
+				data         []float32
+			}{
+				"wrapped": {"mylib.WrappedTensor", []float32{1, 2}},
+				"tagged":  {"mylib.TaggedTensor", []float32{3, 4}},
+				"plain":   {"", []float32{5, 6}},
+			} {
+				tensor := tensors[key]
+				if tensor.SubclassName != expected.subclassName {
+					t.Errorf("%s: expected SubclassName %q, actual %q",
+						key, expected.subclassName, tensor.SubclassName)
+				}
+				assertTensorFloat32Data(t, tensor, expected.data)
+			}
+		})
+	}
+}
+
+func TestRebuildFromTypeV2WithoutInnerTensor(t *testing.T) {
+	wrapper, err := (&RebuildWrapperSubclass{}).Call(
+		types.NewGenericClass("mylib", "Empty"), Float32, &types.Tuple{2},
+		&types.Tuple{1}, 0, Strided, "cpu", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuild := callableFunc(func(args ...interface{}) (interface{}, error) {
+		return wrapper, nil
+	})
+	_, err = (&RebuildFromTypeV2{}).Call(rebuild,
+		types.NewGenericClass("mylib", "Empty"), &types.Tuple{}, types.NewDict())
+	assertErrorContains(t, err, "no inner tensor found in the state of mylib.Empty")
+}
+
+func TestDeviceClass(t *testing.T) {
+	for _, tc := range []struct {
+		args     []interface{}
+		expected string
+	}{
+		{[]interface{}{"cpu"}, "cpu"},
+		{[]interface{}{"cuda", 1}, "cuda:1"},
+		{[]interface{}{"cuda", nil}, "cuda"},
+	} {
+		actual, err := (&DeviceClass{}).Call(tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%v: expected %q, actual %q", tc.args, tc.expected, actual)
+		}
+	}
+}
+
+// callableFunc adapts a function to types.Callable.
+type callableFunc func(args ...interface{}) (interface{}, error)
+
+func (f callableFunc) Call(args ...interface{}) (interface{}, error) {
+	return f(args...)
+}
@@ -4,10 +4,652 @@
 
 package pytorch
 
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"reflect"
+)
+
 type Tensor struct {
 	Source        StorageInterface
 	StorageOffset int
 	Size          []int
 	Stride        []int
-	RequiresGrad  bool
+	// RequiresGrad is true for the tensors, such as trainable parameters,
+	// which were saved requiring gradient, and false otherwise.
+	RequiresGrad bool
+	// Quantizer is set for the quantized tensors only (see Dequantize).
+	Quantizer *Quantizer
+	// SubclassName is the qualified name of the Python subclass of
+	// "torch.Tensor" of the tensor, if any (see RebuildFromTypeV2).
+	SubclassName string
+	// Err is the error which prevented the tensor from being rebuilt. It
+	// is only set, with no other field, for the tensors loaded with
+	// LoadOptions.ContinueOnTensorError.
+	Err error
+}
+
+// Numel returns the total number of elements of the tensor, that is, the
+// product of its sizes.
+func (t *Tensor) Numel() int {
+	return numel(t.Size)
+}
+
+// Dtype returns the data type of the tensor elements, according to the
+// type of its storage. It returns nil if the storage type is unknown.
+func (t *Tensor) Dtype() *Dtype {
+	if _, ok := t.Source.(*UntypedStorage); ok {
+		return Uint8
+	}
+	return storageDtype(t.Source)
+}
+
+// IsContiguous reports whether the elements of the tensor are laid out
+// in its storage in row-major order, without gaps.
+func (t *Tensor) IsContiguous() bool {
+	expected := 1
+	for d := len(t.Size) - 1; d >= 0; d-- {
+		if t.Size[d] == 1 {
+			continue
+		}
+		if t.Stride[d] != expected {
+			return false
+		}
+		expected *= t.Size[d]
+	}
+	return true
+}
+
+// GetData returns a new slice with all the elements of the tensor, in
+// row-major order, honoring its storage offset and strides.
+//
+// The type of the slice is the same as the Data field of the storage,
+// for example []float32 for a FloatStorage. When the tensor is contiguous,
+// its elements are copied from the storage in bulk.
+func (t *Tensor) GetData() (interface{}, error) {
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	data, err := storageData(t.Source)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkBounds(data.Len()); err != nil {
+		return nil, err
+	}
+	if t.IsContiguous() {
+		n := t.Numel()
+		result := reflect.MakeSlice(data.Type(), n, n)
+		reflect.Copy(result, data.Slice(t.StorageOffset, t.StorageOffset+n))
+		return result.Interface(), nil
+	}
+	return gather(data.Interface(), t.storageIndices())
+}
+
+// GetDataAsUint64 is like GetData, but it returns the elements of a tensor
+// of any unsigned integer type (from torch.uint8 to torch.uint64) as
+// uint64 values.
+func (t *Tensor) GetDataAsUint64() ([]uint64, error) {
+	data, err := t.GetData()
+	if err != nil {
+		return nil, err
+	}
+	switch d := data.(type) {
+	case []uint64:
+		return d, nil
+	case []uint32:
+		r := make([]uint64, len(d))
+		for i, v := range d {
+			r[i] = uint64(v)
+		}
+		return r, nil
+	case []uint16:
+		r := make([]uint64, len(d))
+		for i, v := range d {
+			r[i] = uint64(v)
+		}
+		return r, nil
+	case []uint8:
+		r := make([]uint64, len(d))
+		for i, v := range d {
+			r[i] = uint64(v)
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf(
+			"GetDataAsUint64: unsupported tensor of type %v", t.Dtype())
+	}
+}
+
+// GetDataAsInt64 is like GetData, but it returns the elements of a tensor
+// of any signed integer type (from torch.int8 to torch.int64) as int64
+// values.
+func (t *Tensor) GetDataAsInt64() ([]int64, error) {
+	data, err := t.GetData()
+	if err != nil {
+		return nil, err
+	}
+	switch d := data.(type) {
+	case []int64:
+		return d, nil
+	case []int32:
+		r := make([]int64, len(d))
+		for i, v := range d {
+			r[i] = int64(v)
+		}
+		return r, nil
+	case []int16:
+		r := make([]int64, len(d))
+		for i, v := range d {
+			r[i] = int64(v)
+		}
+		return r, nil
+	case []int8:
+		r := make([]int64, len(d))
+		for i, v := range d {
+			r[i] = int64(v)
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf(
+			"GetDataAsInt64: unsupported tensor of type %v", t.Dtype())
+	}
+}
+
+// GetDataAsFloat32 is like GetData, but it returns the elements of a
+// tensor of type torch.float16, torch.bfloat16 or torch.float32 as float32
+// values.
+//
+// The elements of such storages are decoded from their bytes straight
+// into float32 values while loading, so the result is exact: no value is
+// ever widened to float64 and narrowed back. Tensors of type
+// torch.float64 are not accepted, since narrowing their values would lose
+// precision.
+func (t *Tensor) GetDataAsFloat32() ([]float32, error) {
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	switch t.Source.(type) {
+	case *FloatStorage, *HalfStorage, *BFloat16Storage:
+	default:
+		return nil, fmt.Errorf(
+			"GetDataAsFloat32: unsupported tensor of type %v", t.Dtype())
+	}
+	data, err := t.GetData()
+	if err != nil {
+		return nil, err
+	}
+	return data.([]float32), nil
+}
+
+// GetDataAsFloat64 is like GetData, but it returns the elements of a
+// tensor of any floating point type (torch.float16, torch.bfloat16,
+// torch.float32 or torch.float64) as float64 values. Widening them is
+// always exact.
+func (t *Tensor) GetDataAsFloat64() ([]float64, error) {
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	switch t.Source.(type) {
+	case *DoubleStorage:
+		data, err := t.GetData()
+		if err != nil {
+			return nil, err
+		}
+		return data.([]float64), nil
+	case *FloatStorage, *HalfStorage, *BFloat16Storage:
+		data, err := t.GetDataAsFloat32()
+		if err != nil {
+			return nil, err
+		}
+		r := make([]float64, len(data))
+		for i, v := range data {
+			r[i] = float64(v)
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf(
+			"GetDataAsFloat64: unsupported tensor of type %v", t.Dtype())
+	}
+}
+
+// Contiguous returns a new tensor with the same elements, laid out in
+// row-major order in a new storage, starting at offset 0. As for GetData,
+// the elements of a tensor which is already contiguous are copied in bulk.
+func (t *Tensor) Contiguous() (*Tensor, error) {
+	data, err := t.GetData()
+	if err != nil {
+		return nil, err
+	}
+	storage, err := newStorageWithData(t.Source, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Tensor{
+		Source:       storage,
+		Size:         append([]int(nil), t.Size...),
+		Stride:       contiguousStride(t.Size),
+		RequiresGrad: t.RequiresGrad,
+		Quantizer:    t.Quantizer,
+		SubclassName: t.SubclassName,
+	}, nil
+}
+
+// Bytes returns the elements of the tensor as contiguous little-endian
+// bytes, in row-major order, honoring its storage offset and strides. This
+// is the raw payload expected, for example, by the ".npy" and
+// ".safetensors" formats.
+//
+// Half-precision values are encoded in IEEE 754 binary16 format, bfloat16
+// values as the upper half of their float32 bits, and booleans as one byte
+// each, 0 or 1.
+func (t *Tensor) Bytes() ([]byte, error) {
+	c, err := t.Contiguous()
+	if err != nil {
+		return nil, err
+	}
+	return encodeStorage(c.Source)
+}
+
+// ReadBytesInto is like Bytes, but it writes the bytes into buf, which must
+// be at least Numel() * Dtype().ElementSize bytes long, so that large tensors
+// can be copied into preallocated memory, such as a memory-mapped file. It
+// returns the number of bytes written.
+//
+// The elements of a contiguous tensor are encoded straight from the
+// storage, without intermediate copies.
+func (t *Tensor) ReadBytesInto(buf []byte) (int, error) {
+	src := t
+	if !t.IsContiguous() {
+		c, err := t.Contiguous()
+		if err != nil {
+			return 0, err
+		}
+		src = c
+	}
+	data, err := storageData(src.Source)
+	if err != nil {
+		return 0, err
+	}
+	if err := src.checkBounds(data.Len()); err != nil {
+		return 0, err
+	}
+	elementSize, ok := storageElementSize(src.Source)
+	if !ok {
+		return 0, fmt.Errorf("ReadBytesInto: unsupported storage %T", src.Source)
+	}
+	n := src.Numel()
+	size := n * elementSize
+	if len(buf) < size {
+		return 0, fmt.Errorf(
+			"ReadBytesInto: buffer of %d bytes too small, %d bytes needed", len(buf), size)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	elements := data.Slice(src.StorageOffset, src.StorageOffset+n).Interface()
+	if err := encodeData(buf[:size], src.Source, elements); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// Select returns a view of the tensor at the given index along the
+// dimension dim, which is removed, like "torch.select" and integer indexing
+// in Python. For example, it can pull one batch element, or one attention
+// head, out of a tensor. The view shares the storage of the tensor.
+//
+// A negative dim counts from the last dimension, and a negative index from
+// the end of the dimension.
+func (t *Tensor) Select(dim, index int) (*Tensor, error) {
+	rank := len(t.Size)
+	if len(t.Stride) != rank {
+		return nil, fmt.Errorf("Select: tensor size %v and stride %v are inconsistent",
+			t.Size, t.Stride)
+	}
+	if dim < 0 {
+		dim += rank
+	}
+	if dim < 0 || dim >= rank {
+		return nil, fmt.Errorf(
+			"Select: dimension out of range for %d-dimensional tensor", rank)
+	}
+	size := t.Size[dim]
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return nil, fmt.Errorf(
+			"Select: index out of range for dimension %d of size %d", dim, size)
+	}
+	return &Tensor{
+		Source:        t.Source,
+		StorageOffset: t.StorageOffset + index*t.Stride[dim],
+		Size:          append(append([]int(nil), t.Size[:dim]...), t.Size[dim+1:]...),
+		Stride:        append(append([]int(nil), t.Stride[:dim]...), t.Stride[dim+1:]...),
+		RequiresGrad:  t.RequiresGrad,
+	}, nil
+}
+
+// At returns the element of the tensor at the given indices, one for each
+// dimension, honoring its storage offset and strides, without copying the
+// other elements. Its type is the element type of the Data field of the
+// storage, for example float32 for a FloatStorage. It is called with no
+// indices for a zero-dimensional tensor.
+//
+// A negative index counts from the end of its dimension.
+func (t *Tensor) At(indices ...int) (interface{}, error) {
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	rank := len(t.Size)
+	if len(t.Stride) != rank {
+		return nil, fmt.Errorf("At: tensor size %v and stride %v are inconsistent",
+			t.Size, t.Stride)
+	}
+	if len(indices) != rank {
+		return nil, fmt.Errorf("At: %d indices given for %d-dimensional tensor",
+			len(indices), rank)
+	}
+	pos := t.StorageOffset
+	for d, index := range indices {
+		size := t.Size[d]
+		if index < 0 {
+			index += size
+		}
+		if index < 0 || index >= size {
+			return nil, fmt.Errorf(
+				"At: index %d out of range for dimension %d of size %d",
+				indices[d], d, size)
+		}
+		pos += index * t.Stride[d]
+	}
+	data, err := storageData(t.Source)
+	if err != nil {
+		return nil, err
+	}
+	if pos < 0 || pos >= data.Len() {
+		return nil, fmt.Errorf("At: position %d exceeds storage of length %d",
+			pos, data.Len())
+	}
+	return data.Index(pos).Interface(), nil
+}
+
+// Split divides the tensor into chunks of chunkSize elements along the
+// dimension dim, like "torch.split" with an integer size: the last chunk
+// is smaller if the size of the dimension is not divisible by chunkSize.
+// It is the inverse of Cat, for example to re-shard a tensor. The chunks
+// are views sharing the storage of the tensor.
+//
+// A negative dim counts from the last dimension.
+func (t *Tensor) Split(dim, chunkSize int) ([]*Tensor, error) {
+	rank := len(t.Size)
+	if len(t.Stride) != rank {
+		return nil, fmt.Errorf("Split: tensor size %v and stride %v are inconsistent",
+			t.Size, t.Stride)
+	}
+	if dim < 0 {
+		dim += rank
+	}
+	if dim < 0 || dim >= rank {
+		return nil, fmt.Errorf(
+			"Split: dimension out of range for %d-dimensional tensor", rank)
+	}
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("Split: invalid chunk size %d", chunkSize)
+	}
+
+	size := t.Size[dim]
+	chunks := make([]*Tensor, 0, (size+chunkSize-1)/chunkSize)
+	for start := 0; start < size; start += chunkSize {
+		chunk := &Tensor{
+			Source:        t.Source,
+			StorageOffset: t.StorageOffset + start*t.Stride[dim],
+			Size:          append([]int(nil), t.Size...),
+			Stride:        append([]int(nil), t.Stride...),
+			RequiresGrad:  t.RequiresGrad,
+		}
+		if chunk.Size[dim] = size - start; chunk.Size[dim] > chunkSize {
+			chunk.Size[dim] = chunkSize
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// IndexSelect returns a new contiguous tensor made of the slices of the
+// tensor at the given indices along the dimension dim, in the given
+// order, like "torch.index_select". For example, it can extract the rows
+// of a custom vocabulary out of a large embedding matrix. Indices may be
+// repeated, and must be within the size of the dimension.
+//
+// A negative dim counts from the last dimension.
+func (t *Tensor) IndexSelect(dim int, indices []int) (*Tensor, error) {
+	rank := len(t.Size)
+	if dim < 0 {
+		dim += rank
+	}
+	if dim < 0 || dim >= rank {
+		return nil, fmt.Errorf(
+			"IndexSelect: dimension out of range for %d-dimensional tensor", rank)
+	}
+	size := t.Size[dim]
+	for _, index := range indices {
+		if index < 0 || index >= size {
+			return nil, fmt.Errorf(
+				"IndexSelect: index %d out of range for dimension %d of size %d",
+				index, dim, size)
+		}
+	}
+	d, err := t.GetData()
+	if err != nil {
+		return nil, err
+	}
+	data := reflect.ValueOf(d)
+
+	resultSize := append([]int(nil), t.Size...)
+	resultSize[dim] = len(indices)
+	inner := numel(t.Size[dim+1:])
+	outer := numel(t.Size[:dim])
+	n := numel(resultSize)
+	result := reflect.MakeSlice(data.Type(), n, n)
+	pos := 0
+	for o := 0; o < outer; o++ {
+		for _, index := range indices {
+			start := (o*size + index) * inner
+			reflect.Copy(result.Slice(pos, pos+inner), data.Slice(start, start+inner))
+			pos += inner
+		}
+	}
+
+	storage, err := newStorageWithData(t.Source, result.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return &Tensor{
+		Source:       storage,
+		Size:         resultSize,
+		Stride:       contiguousStride(resultSize),
+		RequiresGrad: t.RequiresGrad,
+	}, nil
+}
+
+// PyReduce implements types.PyReducible, reducing the tensor to a call to
+// "torch._utils._rebuild_tensor_v2", as PyTorch does. The storage is left
+// as it is: it must be turned into a persistent ID by the Pickler.
+func (t *Tensor) PyReduce() (interface{}, *types.Tuple, error) {
+	args := types.Tuple{
+		t.Source,
+		t.StorageOffset,
+		intsTuple(t.Size),
+		intsTuple(t.Stride),
+		t.RequiresGrad,
+		types.NewOrderedDict(), // backward hooks
+	}
+	return types.NewGenericClass("torch._utils", "_rebuild_tensor_v2"), &args, nil
+}
+
+// Cat concatenates the given tensors along the dimension dim, like
+// "torch.cat". It is useful, for example, to reassemble a tensor which
+// has been split in shards across multiple checkpoints.
+//
+// All tensors must have the same data type and the same size on all
+// dimensions except dim. A negative dim counts from the last dimension.
+// The result is a new contiguous tensor.
+func Cat(tensors []*Tensor, dim int) (*Tensor, error) {
+	if len(tensors) == 0 {
+		return nil, fmt.Errorf("Cat: no tensors given")
+	}
+	first := tensors[0]
+	rank := len(first.Size)
+	if dim < 0 {
+		dim += rank
+	}
+	if dim < 0 || dim >= rank {
+		return nil, fmt.Errorf(
+			"Cat: dimension out of range for %d-dimensional tensors", rank)
+	}
+	dtype := first.Dtype()
+	if dtype == nil {
+		return nil, fmt.Errorf("Cat: unsupported storage %T", first.Source)
+	}
+
+	size := append([]int(nil), first.Size...)
+	size[dim] = 0
+	for i, t := range tensors {
+		if td := t.Dtype(); td != dtype {
+			return nil, fmt.Errorf(
+				"Cat: tensor %d has type %v, expected %v", i, td, dtype)
+		}
+		if len(t.Size) != rank {
+			return nil, fmt.Errorf(
+				"Cat: tensor %d has %d dimensions, expected %d",
+				i, len(t.Size), rank)
+		}
+		for d, s := range t.Size {
+			if d != dim && s != first.Size[d] {
+				return nil, fmt.Errorf(
+					"Cat: tensor %d has size %v, incompatible with %v "+
+						"on dimension %d", i, t.Size, first.Size, d)
+			}
+		}
+		size[dim] += t.Size[dim]
+	}
+
+	data := make([]reflect.Value, len(tensors))
+	for i, t := range tensors {
+		d, err := t.GetData()
+		if err != nil {
+			return nil, err
+		}
+		data[i] = reflect.ValueOf(d)
+	}
+
+	inner := numel(size[dim+1:])
+	outer := numel(size[:dim])
+	result := reflect.MakeSlice(data[0].Type(), numel(size), numel(size))
+	pos := 0
+	for o := 0; o < outer; o++ {
+		for i, t := range tensors {
+			block := t.Size[dim] * inner
+			reflect.Copy(result.Slice(pos, pos+block),
+				data[i].Slice(o*block, (o+1)*block))
+			pos += block
+		}
+	}
+
+	storage, err := newStorageWithData(first.Source, result.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return &Tensor{
+		Source: storage,
+		Size:   size,
+		Stride: contiguousStride(size),
+	}, nil
+}
+
+// storageIndices returns the positions within the storage of all the
+// elements of the tensor, in row-major order.
+func (t *Tensor) storageIndices() []int {
+	n := t.Numel()
+	indices := make([]int, n)
+	rank := len(t.Size)
+	pos := make([]int, rank)
+	offset := t.StorageOffset
+	for i := 0; i < n; i++ {
+		indices[i] = offset
+		for d := rank - 1; d >= 0; d-- {
+			pos[d]++
+			offset += t.Stride[d]
+			if pos[d] < t.Size[d] {
+				break
+			}
+			offset -= pos[d] * t.Stride[d]
+			pos[d] = 0
+		}
+	}
+	return indices
+}
+
+// checkBounds returns an error if the size and stride of the tensor are
+// inconsistent, or if any element falls outside a storage of the given
+// length. The offset of an empty tensor may be at most the length.
+func (t *Tensor) checkBounds(length int) error {
+	if len(t.Size) != len(t.Stride) {
+		return fmt.Errorf("tensor size %v and stride %v are inconsistent",
+			t.Size, t.Stride)
+	}
+	if t.Numel() == 0 {
+		if t.StorageOffset < 0 || t.StorageOffset > length {
+			return fmt.Errorf("empty tensor with offset %d exceeds storage "+
+				"of length %d", t.StorageOffset, length)
+		}
+		return nil
+	}
+	min, max := t.StorageOffset, t.StorageOffset
+	for d, s := range t.Size {
+		if s < 0 {
+			return fmt.Errorf("invalid tensor size %v", t.Size)
+		}
+		if st := t.Stride[d]; st < 0 {
+			min += (s - 1) * st
+		} else {
+			max += (s - 1) * st
+		}
+	}
+	if min < 0 || max >= length {
+		return fmt.Errorf(
+			"tensor with offset %d, size %v and stride %v exceeds "+
+				"storage of length %d", t.StorageOffset, t.Size, t.Stride, length)
+	}
+	return nil
+}
+
+func intsTuple(values []int) *types.Tuple {
+	t := make(types.Tuple, len(values))
+	for i, v := range values {
+		t[i] = v
+	}
+	return &t
+}
+
+func numel(size []int) int {
+	n := 1
+	for _, s := range size {
+		n *= s
+	}
+	return n
+}
+
+// contiguousStride returns the strides of a contiguous row-major tensor
+// with the given size.
+func contiguousStride(size []int) []int {
+	stride := make([]int, len(size))
+	s := 1
+	for d := len(size) - 1; d >= 0; d-- {
+		stride[d] = s
+		s *= size[d]
+	}
+	return stride
 }
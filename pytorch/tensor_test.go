@@ -0,0 +1,653 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCat(t *testing.T) {
+	a := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+	b := newFloatTensor([]float32{7, 8, 9}, 1, 3)
+	c := newFloatTensor([]float32{10, 20, 30, 40}, 2, 2)
+
+	t.Run("dim 0", func(t *testing.T) {
+		r, err := Cat([]*Tensor{a, b}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, r.Size, []int{3, 3})
+		assertIntSliceEqual(t, r.Stride, []int{3, 1})
+		assertTensorFloat32Data(t, r, []float32{1, 2, 3, 4, 5, 6, 7, 8, 9})
+	})
+
+	t.Run("dim 1", func(t *testing.T) {
+		r, err := Cat([]*Tensor{a, c}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, r.Size, []int{2, 5})
+		assertIntSliceEqual(t, r.Stride, []int{5, 1})
+		assertTensorFloat32Data(t, r,
+			[]float32{1, 2, 3, 10, 20, 4, 5, 6, 30, 40})
+	})
+
+	t.Run("negative dim", func(t *testing.T) {
+		r, err := Cat([]*Tensor{c, a}, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, r.Size, []int{2, 5})
+		assertTensorFloat32Data(t, r,
+			[]float32{10, 20, 1, 2, 3, 30, 40, 4, 5, 6})
+	})
+
+	t.Run("non-contiguous input", func(t *testing.T) {
+		// transposed view of a: [[1, 4], [2, 5], [3, 6]]
+		at := &Tensor{Source: a.Source, Size: []int{3, 2}, Stride: []int{1, 3}}
+		r, err := Cat([]*Tensor{at, contiguousView(b, 3, 1)}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, r.Size, []int{3, 3})
+		assertTensorFloat32Data(t, r, []float32{1, 4, 7, 2, 5, 8, 3, 6, 9})
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		_, err := Cat([]*Tensor{a, c}, 0)
+		assertErrorContains(t, err, "incompatible")
+	})
+
+	t.Run("dtype mismatch", func(t *testing.T) {
+		d := &Tensor{
+			Source: &DoubleStorage{BaseStorage: BaseStorage{Size: 3}, Data: []float64{1, 2, 3}},
+			Size:   []int{1, 3},
+			Stride: []int{3, 1},
+		}
+		_, err := Cat([]*Tensor{a, d}, 0)
+		assertErrorContains(t, err, "torch.float64")
+	})
+
+	t.Run("dim out of range", func(t *testing.T) {
+		_, err := Cat([]*Tensor{a, b}, 2)
+		assertErrorContains(t, err, "out of range")
+	})
+
+	t.Run("no tensors", func(t *testing.T) {
+		_, err := Cat(nil, 0)
+		assertErrorContains(t, err, "no tensors")
+	})
+}
+
+func newFloatTensor(data []float32, size ...int) *Tensor {
+	return &Tensor{
+		Source: &FloatStorage{
+			BaseStorage: BaseStorage{Size: len(data), Location: "cpu"},
+			Data:        data,
+		},
+		Size:   size,
+		Stride: contiguousStride(size),
+	}
+}
+
+// contiguousView returns a contiguous view of the storage of t with
+// another size.
+func contiguousView(t *Tensor, size ...int) *Tensor {
+	return &Tensor{
+		Source:        t.Source,
+		StorageOffset: t.StorageOffset,
+		Size:          size,
+		Stride:        contiguousStride(size),
+	}
+}
+
+func assertTensorFloat32Data(t *testing.T, tensor *Tensor, expected []float32) {
+	t.Helper()
+	data, err := tensor.GetData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, ok := data.([]float32)
+	if !ok {
+		t.Fatalf("expected []float32, got %T", data)
+	}
+	assertFloat32SliceEqual(t, actual, expected, 0)
+}
+
+func assertErrorContains(t *testing.T, err error, substr string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error containing %#v, got nil", substr)
+	}
+	if !strings.Contains(err.Error(), substr) {
+		t.Errorf("expected error containing %#v, got %#v", substr, err.Error())
+	}
+}
+
+func TestGetDataContiguousWithOffset(t *testing.T) {
+	a := newFloatTensor([]float32{1, 2, 3, 4, 5, 6, 7}, 7)
+	view := &Tensor{Source: a.Source, StorageOffset: 1, Size: []int{2, 3}, Stride: []int{3, 1}}
+	assertTensorFloat32Data(t, view, []float32{2, 3, 4, 5, 6, 7})
+
+	data, _ := view.GetData()
+	data.([]float32)[0] = 42
+	if a.Source.(*FloatStorage).Data[1] != 2 {
+		t.Error("expected GetData to return a copy of the storage data")
+	}
+}
+
+func TestGetDataEmptyWithOffset(t *testing.T) {
+	a := newFloatTensor([]float32{1, 2, 3, 4}, 4)
+	empty := &Tensor{Source: a.Source, StorageOffset: 4, Size: []int{0}, Stride: []int{1}}
+	assertTensorFloat32Data(t, empty, []float32{})
+
+	empty.StorageOffset = 5
+	_, err := empty.GetData()
+	assertErrorContains(t, err, "empty tensor with offset 5 exceeds storage of length 4")
+	_, err = empty.ToDenseFloat32()
+	assertErrorContains(t, err, "empty tensor with offset 5 exceeds storage of length 4")
+}
+
+func BenchmarkGetData(b *testing.B) {
+	const n = 1024
+	tensor := newFloatTensor(make([]float32, n*n), n, n)
+	transposed := &Tensor{Source: tensor.Source, Size: []int{n, n}, Stride: []int{1, n}}
+
+	b.Run("contiguous", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := tensor.GetData(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("transposed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := transposed.GetData(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestTensorBytes(t *testing.T) {
+	t.Run("transposed", func(t *testing.T) {
+		// transposed view of [[1, 2, 3], [4, 5, 6]]
+		a := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+		at := &Tensor{Source: a.Source, Size: []int{3, 2}, Stride: []int{1, 3}}
+		actual, err := at.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := make([]byte, 0, 24)
+		for _, v := range []float32{1, 4, 2, 5, 3, 6} {
+			var b [4]byte
+			binary.LittleEndian.PutUint32(b[:], math.Float32bits(v))
+			expected = append(expected, b[:]...)
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+	})
+
+	t.Run("big-endian source", func(t *testing.T) {
+		// int32 values 1, 256 and -2, read from big-endian data
+		source := []byte{0, 0, 0, 1, 0, 0, 1, 0, 0xff, 0xff, 0xff, 0xfe}
+		data := make([]int32, 3)
+		if err := binary.Read(bytes.NewReader(source), binary.BigEndian, data); err != nil {
+			t.Fatal(err)
+		}
+		tensor := &Tensor{
+			Source:        &IntStorage{BaseStorage: BaseStorage{Size: 3}, Data: data},
+			StorageOffset: 1,
+			Size:          []int{2},
+			Stride:        []int{1},
+		}
+		actual, err := tensor.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []byte{0, 1, 0, 0, 0xfe, 0xff, 0xff, 0xff}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+	})
+
+	t.Run("half", func(t *testing.T) {
+		tensor := &Tensor{
+			Source: &HalfStorage{BaseStorage: BaseStorage{Size: 2}, Data: []float32{1, -2}},
+			Size:   []int{2},
+			Stride: []int{1},
+		}
+		actual, err := tensor.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// struct.pack('<2e', 1, -2)
+		expected := []byte{0x00, 0x3c, 0x00, 0xc0}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+	})
+}
+
+func TestGetDataAsFloat32(t *testing.T) {
+	// transposed view of [[1, 2], [3, 4]], with a value not representable
+	// as float16
+	a := newFloatTensor([]float32{1, 2, 3, 1.0000001}, 2, 2)
+	at := &Tensor{Source: a.Source, Size: []int{2, 2}, Stride: []int{1, 2}}
+	actual, err := at.GetDataAsFloat32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, actual, []float32{1, 3, 2, 1.0000001}, 0)
+
+	half := &Tensor{
+		Source: &HalfStorage{BaseStorage: BaseStorage{Size: 2}, Data: []float32{0.5, -2}},
+		Size:   []int{2},
+		Stride: []int{1},
+	}
+	actual, err = half.GetDataAsFloat32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFloat32SliceEqual(t, actual, []float32{0.5, -2}, 0)
+
+	double := &Tensor{
+		Source: &DoubleStorage{BaseStorage: BaseStorage{Size: 1}, Data: []float64{1}},
+		Size:   []int{1},
+		Stride: []int{1},
+	}
+	_, err = double.GetDataAsFloat32()
+	assertErrorContains(t, err, "unsupported tensor of type torch.float64")
+}
+
+func TestGetDataAsUint64Unsupported(t *testing.T) {
+	_, err := newFloatTensor([]float32{1}, 1).GetDataAsUint64()
+	assertErrorContains(t, err, "torch.float32")
+}
+
+func TestGetDataAsInt64(t *testing.T) {
+	// a strided view of the signed bytes, with an offset
+	chars := &Tensor{
+		Source:        &CharStorage{BaseStorage: BaseStorage{Size: 5}, Data: []int8{9, -1, 9, -128, 9}},
+		StorageOffset: 1,
+		Size:          []int{2},
+		Stride:        []int{2},
+	}
+	actual, err := chars.GetDataAsInt64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int64{-1, -128}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+
+	_, err = newFloatTensor([]float32{1}, 1).GetDataAsInt64()
+	assertErrorContains(t, err, "unsupported tensor of type torch.float32")
+}
+
+func TestGetDataAsFloat64(t *testing.T) {
+	// transposed view of [[1, 2], [3, 4]]
+	a := newFloatTensor([]float32{1, 2, 3, 1.0000001}, 2, 2)
+	at := &Tensor{Source: a.Source, Size: []int{2, 2}, Stride: []int{1, 2}}
+	actual, err := at.GetDataAsFloat64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{1, 3, 2, float64(float32(1.0000001))}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+
+	double := &Tensor{
+		Source: &DoubleStorage{BaseStorage: BaseStorage{Size: 1}, Data: []float64{0.1}},
+		Size:   []int{1},
+		Stride: []int{1},
+	}
+	actual, err = double.GetDataAsFloat64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, []float64{0.1}) {
+		t.Errorf("expected [0.1], actual %v", actual)
+	}
+
+	long := &Tensor{
+		Source: &LongStorage{BaseStorage: BaseStorage{Size: 1}, Data: []int64{1}},
+		Size:   []int{1},
+		Stride: []int{1},
+	}
+	_, err = long.GetDataAsFloat64()
+	assertErrorContains(t, err, "unsupported tensor of type torch.int64")
+}
+
+func TestSelect(t *testing.T) {
+	// [[[0, 1, 2], [3, 4, 5]], [[6, 7, 8], [9, 10, 11]]]
+	a := newFloatTensor([]float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, 2, 2, 3)
+
+	testCases := []struct {
+		dim, index int
+		size       []int
+		expected   []float32
+	}{
+		{0, 1, []int{2, 3}, []float32{6, 7, 8, 9, 10, 11}},
+		{1, 0, []int{2, 3}, []float32{0, 1, 2, 6, 7, 8}},
+		{2, 2, []int{2, 2}, []float32{2, 5, 8, 11}},
+		{-1, -3, []int{2, 2}, []float32{0, 3, 6, 9}},
+	}
+	for _, tc := range testCases {
+		r, err := a.Select(tc.dim, tc.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Source != a.Source {
+			t.Error("expected a view sharing the same storage")
+		}
+		assertIntSliceEqual(t, r.Size, tc.size)
+		assertTensorFloat32Data(t, r, tc.expected)
+	}
+
+	t.Run("chained", func(t *testing.T) {
+		row, err := a.Select(0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		elem, err := row.Select(0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorFloat32Data(t, elem, []float32{9, 10, 11})
+		scalar, err := elem.Select(0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, scalar.Size, []int{})
+		assertTensorFloat32Data(t, scalar, []float32{11})
+	})
+
+	t.Run("dim out of range", func(t *testing.T) {
+		_, err := a.Select(3, 0)
+		assertErrorContains(t, err, "dimension out of range")
+	})
+
+	t.Run("index out of range", func(t *testing.T) {
+		_, err := a.Select(1, 2)
+		assertErrorContains(t, err, "index out of range")
+		_, err = a.Select(1, -3)
+		assertErrorContains(t, err, "index out of range")
+	})
+}
+
+func TestAt(t *testing.T) {
+	// [[[0, 1, 2], [3, 4, 5]], [[6, 7, 8], [9, 10, 11]]]
+	a := newFloatTensor([]float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, 2, 2, 3)
+	// a.transpose(0, 2)[1:]: [[[1, 7], [4, 10]], [[2, 8], [5, 11]]]
+	transposed := &Tensor{
+		Source:        a.Source,
+		StorageOffset: 1,
+		Size:          []int{2, 2, 2},
+		Stride:        []int{1, 3, 6},
+	}
+
+	testCases := []struct {
+		tensor   *Tensor
+		indices  []int
+		expected float32
+	}{
+		{a, []int{0, 0, 0}, 0},
+		{a, []int{1, 0, 2}, 8},
+		{a, []int{-1, -1, -1}, 11},
+		{transposed, []int{0, 1, 1}, 10},
+		{transposed, []int{1, 0, 1}, 8},
+		{transposed, []int{-1, 1, 0}, 5},
+	}
+	for _, tc := range testCases {
+		v, err := tc.tensor.At(tc.indices...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tc.expected {
+			t.Errorf("At%v: expected %v, actual %#v", tc.indices, tc.expected, v)
+		}
+	}
+
+	t.Run("zero-dimensional", func(t *testing.T) {
+		scalar := &Tensor{Source: a.Source, StorageOffset: 4, Size: []int{}, Stride: []int{}}
+		v, err := scalar.At()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != float32(4) {
+			t.Errorf("expected 4, actual %#v", v)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := a.At(0, 0)
+		assertErrorContains(t, err, "2 indices given for 3-dimensional tensor")
+		_, err = a.At(0, 2, 0)
+		assertErrorContains(t, err, "index 2 out of range for dimension 1 of size 2")
+		_, err = a.At(0, 0, -4)
+		assertErrorContains(t, err, "index -4 out of range for dimension 2 of size 3")
+		outside := &Tensor{Source: a.Source, StorageOffset: 10, Size: []int{3}, Stride: []int{1}}
+		_, err = outside.At(2)
+		assertErrorContains(t, err, "position 12 exceeds storage of length 12")
+	})
+}
+
+func TestReadBytesInto(t *testing.T) {
+	t.Run("transposed", func(t *testing.T) {
+		a := newFloatTensor([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+		at := &Tensor{Source: a.Source, Size: []int{3, 2}, Stride: []int{1, 3}}
+		expected, err := at.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := bytes.Repeat([]byte{0xaa}, 28)
+		n, err := at.ReadBytesInto(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 24 {
+			t.Errorf("expected 24 bytes written, actual %d", n)
+		}
+		if !bytes.Equal(buf[:n], expected) {
+			t.Errorf("expected %v, actual %v", expected, buf[:n])
+		}
+		if !bytes.Equal(buf[n:], []byte{0xaa, 0xaa, 0xaa, 0xaa}) {
+			t.Errorf("expected the rest of the buffer untouched, actual %v", buf[n:])
+		}
+	})
+
+	t.Run("contiguous with offset", func(t *testing.T) {
+		tensor := &Tensor{
+			Source:        &LongStorage{BaseStorage: BaseStorage{Size: 3}, Data: []int64{1, 2, -1}},
+			StorageOffset: 1,
+			Size:          []int{2},
+			Stride:        []int{1},
+		}
+		buf := make([]byte, 16)
+		if _, err := tensor.ReadBytesInto(buf); err != nil {
+			t.Fatal(err)
+		}
+		expected := []byte{2, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		if !bytes.Equal(buf, expected) {
+			t.Errorf("expected %v, actual %v", expected, buf)
+		}
+	})
+
+	t.Run("half", func(t *testing.T) {
+		tensor := &Tensor{
+			Source: &HalfStorage{BaseStorage: BaseStorage{Size: 2}, Data: []float32{1, -2}},
+			Size:   []int{2},
+			Stride: []int{1},
+		}
+		buf := make([]byte, 4)
+		n, err := tensor.ReadBytesInto(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []byte{0x00, 0x3c, 0x00, 0xc0}
+		if n != 4 || !bytes.Equal(buf, expected) {
+			t.Errorf("expected %v, actual %v (%d bytes)", expected, buf, n)
+		}
+	})
+
+	t.Run("buffer too small", func(t *testing.T) {
+		a := newFloatTensor([]float32{1, 2, 3}, 3)
+		_, err := a.ReadBytesInto(make([]byte, 11))
+		assertErrorContains(t, err, "12 bytes needed")
+	})
+}
+
+func TestSplit(t *testing.T) {
+	// [[0, 1, 2, 3, 4], [5, 6, 7, 8, 9]]
+	a := newFloatTensor([]float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 2, 5)
+
+	t.Run("not evenly divisible", func(t *testing.T) {
+		chunks, err := a.Split(-1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) != 3 {
+			t.Fatalf("expected 3 chunks, actual %d", len(chunks))
+		}
+		expected := [][]float32{{0, 1, 5, 6}, {2, 3, 7, 8}, {4, 9}}
+		for i, chunk := range chunks {
+			if chunk.Source != a.Source {
+				t.Error("expected a view sharing the same storage")
+			}
+			assertTensorFloat32Data(t, chunk, expected[i])
+		}
+		assertIntSliceEqual(t, chunks[2].Size, []int{2, 1})
+
+		r, err := Cat(chunks, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTensorFloat32Data(t, r, []float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	})
+
+	t.Run("chunk larger than dimension", func(t *testing.T) {
+		chunks, err := a.Split(0, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) != 1 {
+			t.Fatalf("expected 1 chunk, actual %d", len(chunks))
+		}
+		assertIntSliceEqual(t, chunks[0].Size, []int{2, 5})
+	})
+
+	t.Run("dim out of range", func(t *testing.T) {
+		_, err := a.Split(2, 1)
+		assertErrorContains(t, err, "dimension out of range")
+		_, err = a.Split(-3, 1)
+		assertErrorContains(t, err, "dimension out of range")
+	})
+
+	t.Run("invalid chunk size", func(t *testing.T) {
+		_, err := a.Split(0, 0)
+		assertErrorContains(t, err, "invalid chunk size")
+	})
+}
+
+func TestIndexSelect(t *testing.T) {
+	// an embedding matrix of 5 tokens of 3 dimensions:
+	// [[0, 1, 2], [10, 11, 12], ..., [40, 41, 42]]
+	embeddings := newFloatTensor([]float32{
+		0, 1, 2, 10, 11, 12, 20, 21, 22, 30, 31, 32, 40, 41, 42}, 5, 3)
+
+	t.Run("rows", func(t *testing.T) {
+		r, err := embeddings.IndexSelect(0, []int{4, 1, 3, 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, r.Size, []int{4, 3})
+		assertIntSliceEqual(t, r.Stride, []int{3, 1})
+		assertTensorFloat32Data(t, r, []float32{
+			40, 41, 42, 10, 11, 12, 30, 31, 32, 10, 11, 12})
+		if r.Source == embeddings.Source {
+			t.Error("expected a new storage")
+		}
+	})
+
+	t.Run("columns of a transposed view", func(t *testing.T) {
+		transposed := &Tensor{Source: embeddings.Source, Size: []int{3, 5}, Stride: []int{1, 3}}
+		r, err := transposed.IndexSelect(-1, []int{2, 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIntSliceEqual(t, r.Size, []int{3, 2})
+		assertTensorFloat32Data(t, r, []float32{20, 0, 21, 1, 22, 2})
+	})
+
+	t.Run("index out of range", func(t *testing.T) {
+		_, err := embeddings.IndexSelect(0, []int{1, 5})
+		assertErrorContains(t, err, "index 5 out of range for dimension 0 of size 5")
+		_, err = embeddings.IndexSelect(0, []int{-1})
+		assertErrorContains(t, err, "index -1 out of range")
+	})
+
+	t.Run("dim out of range", func(t *testing.T) {
+		_, err := embeddings.IndexSelect(2, []int{0})
+		assertErrorContains(t, err, "dimension out of range")
+	})
+}
+
+func TestHighRankTensor(t *testing.T) {
+	size := []int{2, 1, 3, 1, 2, 1, 2, 1, 2, 2}
+	n := numel(size)
+	data := make([]float32, n)
+	for i := range data {
+		data[i] = float32(i)
+	}
+	a := newFloatTensor(data, size...)
+	if a.Numel() != 96 {
+		t.Errorf("expected 96 elements, actual %d", a.Numel())
+	}
+	assertTensorFloat32Data(t, a, data)
+
+	// All the dimensions in reverse order, like a.permute(9, 8, ..., 0).
+	rank := len(size)
+	reversed := &Tensor{Source: a.Source, Size: make([]int, rank), Stride: make([]int, rank)}
+	for d := 0; d < rank; d++ {
+		reversed.Size[d] = a.Size[rank-1-d]
+		reversed.Stride[d] = a.Stride[rank-1-d]
+	}
+	if reversed.IsContiguous() {
+		t.Fatal("expected a non-contiguous tensor")
+	}
+	expected := make([]float32, 0, n)
+	pos := make([]int, rank)
+	for i := 0; i < n; i++ {
+		offset := 0
+		for d := range pos {
+			offset += pos[d] * reversed.Stride[d]
+		}
+		expected = append(expected, data[offset])
+		for d := rank - 1; d >= 0; d-- {
+			if pos[d]++; pos[d] < reversed.Size[d] {
+				break
+			}
+			pos[d] = 0
+		}
+	}
+	assertTensorFloat32Data(t, reversed, expected)
+
+	filename := path.Join(t.TempDir(), "high_rank.pt")
+	if err := Save(reversed, filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadTensorsWithOptions(t, filename, LoadOptions{})[""]
+	assertIntSliceEqual(t, loaded.Size, reversed.Size)
+	assertTensorFloat32Data(t, loaded, expected)
+}
@@ -0,0 +1,1165 @@
+#!/usr/bin/env python3
+
+# Copyright 2020 NLP Odyssey Authors. All rights reserved.
+# Use of this source code is governed by a BSD-style
+# license that can be found in the LICENSE file.
+
+# Generates synthetic PyTorch-like fixtures without requiring PyTorch.
+#
+# Minimal stand-ins for the relevant "torch" modules, classes and functions
+# are registered in sys.modules, so that the standard pickle module emits
+# exactly the same globals and persistent IDs that torch.save would produce.
+# The resulting pickles are then packed in the same zip layout used by
+# torch.save.
+
+import collections
+import io
+import pickle
+import struct
+import sys
+import tarfile
+import types
+import zipfile
+
+
+def make_module(name):
+    module = types.ModuleType(name)
+    sys.modules[name] = module
+    parent, _, child = name.rpartition('.')
+    if parent:
+        setattr(sys.modules[parent], child, module)
+    return module
+
+
+torch = make_module('torch')
+torch_utils = make_module('torch._utils')
+
+
+def register(module, obj, name=None):
+    name = name or obj.__name__
+    obj.__module__ = module.__name__
+    obj.__qualname__ = name
+    obj.__name__ = name
+    setattr(module, name, obj)
+    return obj
+
+
+class dtype:
+    def __init__(self, name):
+        self.name = name
+
+    def __reduce__(self):
+        return self.name
+
+
+register(torch, dtype)
+
+for _name in ['float16', 'bfloat16', 'float32', 'float64', 'int8', 'int16',
+              'int32', 'int64', 'uint8', 'uint16', 'uint32', 'uint64', 'bool',
+              'qint8', 'complex128']:
+    setattr(torch, _name, dtype(_name))
+
+
+def _rebuild_tensor(*args):
+    raise NotImplementedError
+
+
+def _rebuild_tensor_v2(*args):
+    raise NotImplementedError
+
+
+def _rebuild_tensor_v3(*args):
+    raise NotImplementedError
+
+
+def _rebuild_parameter(*args):
+    raise NotImplementedError
+
+
+def _rebuild_qtensor(*args):
+    raise NotImplementedError
+
+
+register(torch_utils, _rebuild_tensor)
+register(torch_utils, _rebuild_tensor_v2)
+register(torch_utils, _rebuild_tensor_v3)
+register(torch_utils, _rebuild_parameter)
+register(torch_utils, _rebuild_qtensor)
+
+
+class qscheme:
+    def __init__(self, name):
+        self.name = name
+
+    def __reduce__(self):
+        return self.name
+
+
+register(torch, qscheme)
+
+for _name in ['per_tensor_affine', 'per_channel_affine']:
+    setattr(torch, _name, qscheme(_name))
+
+
+for _name in ['UntypedStorage', 'HalfStorage', 'BFloat16Storage',
+              'FloatStorage', 'DoubleStorage', 'LongStorage', 'ByteStorage',
+              'ComplexFloatStorage', 'device',
+              'QInt8Storage', 'QUInt8Storage', 'QInt32Storage',
+              'FloatTensor', 'ByteTensor']:
+    register(torch, type(_name, (), {}))
+
+
+class Storage:
+    """A storage: a storage class, its elements count and raw bytes."""
+
+    def __init__(self, storage_class, numel, data, location='cpu'):
+        self.storage_class = storage_class
+        self.numel = numel
+        self.data = data
+        self.location = location
+
+
+class Tensor:
+    """A tensor reduced through the given rebuild function and arguments."""
+
+    def __init__(self, rebuild, *args):
+        self.rebuild = rebuild
+        self.args = args
+
+    def __reduce__(self):
+        return self.rebuild, self.args
+
+
+class ZipPickler(pickle.Pickler):
+    def __init__(self, *args, key_type=str, **kwargs):
+        super().__init__(*args, **kwargs)
+        self.storages = []
+        self.key_type = key_type
+
+    def persistent_id(self, obj):
+        if not isinstance(obj, Storage):
+            return None
+        for i, storage in enumerate(self.storages):
+            if storage is obj:
+                key = self.key_type(i)
+                break
+        else:
+            key = self.key_type(len(self.storages))
+            self.storages.append(obj)
+        return 'storage', obj.storage_class, key, obj.location, obj.numel
+
+
+class Python2Pickler(pickle._Pickler):
+    """A pickler emitting each str as a Python 2 "str" (SHORT_BINSTRING or
+    BINSTRING, holding its UTF-8 bytes) rather than as unicode."""
+
+    dispatch = pickle._Pickler.dispatch.copy()
+
+    def save_str(self, obj):
+        data = obj.encode('utf-8')
+        if len(data) < 256:
+            self.write(pickle.SHORT_BINSTRING + bytes([len(data)]) + data)
+        else:
+            self.write(pickle.BINSTRING + struct.pack('<i', len(data)) + data)
+        self.memoize(obj)
+
+    dispatch[str] = save_str
+
+
+class LegacyPickler(Python2Pickler):
+    def __init__(self, *args, **kwargs):
+        super().__init__(*args, **kwargs)
+        self.storages = []
+        self.views = []
+        self.container_types = set()
+
+    def persistent_id(self, obj):
+        # As torch.save, the classes of the modules are saved once along
+        # with their source code, then as plain globals.
+        if isinstance(obj, type) and issubclass(obj, Module):
+            if obj in self.container_types:
+                return None
+            self.container_types.add(obj)
+            return ('module', obj, '/usr/lib/python2.7/site-packages/%s.py'
+                    % obj.__module__.replace('.', '/'),
+                    'class %s(Module):\n    pass\n' % obj.__name__)
+        view_metadata = None
+        if isinstance(obj, StorageView):
+            for i, view in enumerate(self.views):
+                if view is obj:
+                    break
+            else:
+                i = len(self.views)
+                self.views.append(obj)
+            view_metadata = ('view%d' % i, obj.offset, obj.numel)
+            obj = obj.root
+        if not isinstance(obj, Storage):
+            return None
+        for i, storage in enumerate(self.storages):
+            if storage is obj:
+                key = str(i)
+                break
+        else:
+            key = str(len(self.storages))
+            self.storages.append(obj)
+        return ('storage', obj.storage_class, key, obj.location, obj.numel,
+                view_metadata)
+
+
+def save_legacy_python2(obj, filename, wrap_keys=list):
+    # The legacy (non-zip) format, as written by torch.save under Python 2.
+    # wrap_keys makes the pickled storage keys from the list of strings.
+    buf = io.BytesIO()
+    for value in [0x1950a86a20f9469cfc6c, 1001,
+                  {'protocol_version': 1001, 'little_endian': True,
+                   'type_sizes': {'short': 2, 'int': 4, 'long': 8}}]:
+        Python2Pickler(buf, protocol=2).dump(value)
+    pickler = LegacyPickler(buf, protocol=2)
+    pickler.dump(obj)
+    Python2Pickler(buf, protocol=2).dump(
+        wrap_keys([str(i) for i in range(len(pickler.storages))]))
+    for storage in pickler.storages:
+        buf.write(struct.pack('<q', storage.numel))
+        buf.write(storage.data)
+    with open(filename, 'wb') as f:
+        f.write(buf.getvalue())
+
+
+class LegacyTensor:
+    """A tensor of the legacy tar format, of the given type ("torch.*Tensor"),
+    viewing a Storage or a StorageView."""
+
+    def __init__(self, tensor_type, storage, offset, size, stride):
+        self.tensor_type = tensor_type
+        self.storage = storage
+        self.offset = offset
+        self.size = size
+        self.stride = stride
+
+
+class StorageView:
+    """A view of numel elements of a root Storage, starting at offset."""
+
+    def __init__(self, root, offset, numel):
+        self.root = root
+        self.offset = offset
+        self.numel = numel
+
+
+def save_legacy_tar(obj, filename):
+    # The tar format of the oldest versions of torch.save, whose tensors and
+    # storages are keyed by the Python ID of the original objects, here
+    # replaced by sequential numbers for reproducibility.
+    keys = {}
+    tensors = []
+    storages = []
+
+    def key_of(o, objects):
+        if id(o) not in keys:
+            keys[id(o)] = 140000 + len(keys)
+            objects.append(o)
+        return keys[id(o)]
+
+    class TarPickler(pickle.Pickler):
+        def persistent_id(self, o):
+            if isinstance(o, LegacyTensor):
+                return str(key_of(o, tensors))
+            return None
+
+    pickle_buf = io.BytesIO()
+    TarPickler(pickle_buf, protocol=2).dump(obj)
+
+    tensors_buf = io.BytesIO()
+    pickle.dump(len(tensors), tensors_buf, protocol=2)
+    for tensor in tensors:
+        pickle.dump((keys[id(tensor)], key_of(tensor.storage, storages),
+                     tensor.tensor_type), tensors_buf, protocol=2)
+        ndim = len(tensor.size)
+        tensors_buf.write(struct.pack('<i', ndim) + bytes(4))
+        tensors_buf.write(pack('q', *tensor.size, *tensor.stride, tensor.offset))
+
+    views = [s for s in storages if isinstance(s, StorageView)]
+    for view in views:
+        key_of(view.root, storages)
+    roots = [s for s in storages if isinstance(s, Storage)]
+    storages_buf = io.BytesIO()
+    pickle.dump(len(roots), storages_buf, protocol=2)
+    for storage in roots:
+        pickle.dump((keys[id(storage)], storage.location,
+                     storage.storage_class), storages_buf, protocol=2)
+        storages_buf.write(struct.pack('<q', storage.numel) + storage.data)
+    pickle.dump([(keys[id(v)], keys[id(v.root)], v.offset, v.numel)
+                 for v in views], storages_buf, protocol=2)
+
+    sys_info = pickle.dumps({'protocol_version': 1001, 'little_endian': True,
+                             'type_sizes': {'short': 2, 'int': 4, 'long': 8}},
+                            protocol=2)
+    with tarfile.open(filename, 'w', format=tarfile.PAX_FORMAT) as tar:
+        for name, data in [('sys_info', sys_info),
+                           ('tensors', tensors_buf.getvalue()),
+                           ('storages', storages_buf.getvalue()),
+                           ('pickle', pickle_buf.getvalue())]:
+            info = tarfile.TarInfo(name)
+            info.size = len(data)
+            info.mode = 0o644
+            tar.addfile(info, io.BytesIO(data))
+
+
+def save_zip(obj, filename, proto=2, key_type=str, byteorder=b'little'):
+    # key_type makes the storage keys of the persistent IDs from their
+    # index. The data of the storages must be in the given byteorder.
+    buf = io.BytesIO()
+    pickler = ZipPickler(buf, protocol=proto, key_type=key_type)
+    pickler.dump(obj)
+    with zipfile.ZipFile(filename, 'w', zipfile.ZIP_STORED) as zf:
+        write_entry(zf, 'archive/data.pkl', buf.getvalue())
+        write_entry(zf, 'archive/byteorder', byteorder)
+        for key, storage in enumerate(pickler.storages):
+            write_entry(zf, f'archive/data/{key}', storage.data)
+        write_entry(zf, 'archive/version', b'3\n')
+
+
+def write_entry(zf, name, data):
+    # A fixed timestamp keeps the generated files reproducible.
+    zf.writestr(zipfile.ZipInfo(name, date_time=(1980, 1, 1, 0, 0, 0)), data)
+
+
+def floats(*values):
+    return struct.pack(f'<{len(values)}f', *values)
+
+
+def bfloat16s(*values):
+    # The upper half of each float32, which must be exactly representable.
+    data = floats(*values)
+    return b''.join(data[i + 2:i + 4] for i in range(0, len(data), 4))
+
+
+def pack(fmt, *values):
+    return struct.pack(f'<{len(values)}{fmt}', *values)
+
+
+def untyped_storage_v3():
+    # An untyped storage of 16 bytes, interpreted as 4 float32 values.
+    storage = Storage(torch.UntypedStorage, 16, floats(1.5, -2.5, 3.5, -4.5))
+    tensor = Tensor(torch._utils._rebuild_tensor_v3, storage, 0, (4,), (1,),
+                    False, collections.OrderedDict(), torch.float32)
+    save_zip(tensor, 'synthetic_untyped_storage_v3.pt')
+
+
+def truncated_storage():
+    # A storage declaring 4 float32 elements, whose record holds only 3.
+    storage = Storage(torch.FloatStorage, 4, floats(1, 2, 3))
+    tensor = Tensor(torch._utils._rebuild_tensor_v2, storage, 0, (4,), (1,),
+                    False, collections.OrderedDict())
+    save_zip(tensor, 'synthetic_truncated_storage.pt')
+
+
+make_module('torch.nn')
+make_module('torch.nn.modules')
+nn_modules = {name: make_module('torch.nn.modules.' + name)
+              for name in ['linear', 'batchnorm', 'activation', 'container']}
+
+
+class Module:
+    # Pickled as any torch.nn.Module: NEWOBJ of its class, then BUILD with
+    # its __dict__.
+    def __init__(self, parameters=(), buffers=(), modules=()):
+        self.training = True
+        self._parameters = collections.OrderedDict(parameters)
+        self._buffers = collections.OrderedDict(buffers)
+        self._non_persistent_buffers_set = set()
+        self._modules = collections.OrderedDict(modules)
+
+
+for _module, _name in [('linear', 'Linear'), ('batchnorm', 'BatchNorm1d'),
+                       ('activation', 'ReLU'), ('container', 'Sequential')]:
+    register(nn_modules[_module], type(_name, (Module,), {}))
+
+make_module('dill')
+dill = make_module('dill._dill')
+
+
+def _dill_stub(*args):
+    raise NotImplementedError
+
+
+for _name in ['_load_type', '_create_namedtuple', '_create_function',
+              '_create_code', '_create_cell']:
+    register(dill, types.FunctionType(_dill_stub.__code__, {}), _name)
+
+
+class Reduced:
+    """An object reduced to the given callable and arguments, as pickled by
+    dill for the values that pickle does not support."""
+
+    def __init__(self, func, *args):
+        self.func = func
+        self.args = args
+
+    def __reduce__(self):
+        return self.func, self.args
+
+    def __call__(self, *args):
+        # Only to be accepted as the callable of another Reduced.
+        raise NotImplementedError
+
+
+numpy = make_module('numpy')
+make_module('numpy.core')
+numpy_multiarray = make_module('numpy.core.multiarray')
+
+
+class NumpyDtype:
+    # Reduced exactly as numpy.dtype, with the byte order in the state.
+    def __init__(self, code):
+        self.code = code
+
+    def __reduce__(self):
+        return (numpy.dtype, (self.code[1:], False, True),
+                (3, self.code[0], None, None, None, -1, -1, 0))
+
+
+register(numpy, NumpyDtype, 'dtype')
+
+
+def scalar(*args):
+    raise NotImplementedError
+
+
+register(numpy_multiarray, scalar)
+
+
+class NumpyScalar:
+    # Reduced exactly as a NumPy scalar, such as numpy.float64(0.5).
+    def __init__(self, code, fmt, value):
+        self.code = code
+        self.data = struct.pack(fmt, value)
+
+    def __reduce__(self):
+        return (numpy_multiarray.scalar, (NumpyDtype(self.code), self.data))
+
+
+def training_checkpoint():
+    # A training checkpoint with model weights, optimizer state and other
+    # metadata. "embed.weight" and "decoder.weight" are tied, sharing the
+    # same storage, and "proj.weight" is a transposed (non-contiguous) view.
+    def tensor(storage, offset, size, stride):
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, offset, size,
+                      stride, False, collections.OrderedDict())
+
+    embed = Storage(torch.FloatStorage, 6, floats(1, 2, 3, 4, 5, 6))
+    norm = Storage(torch.HalfStorage, 3, pack('e', 1, 0.5, -2))
+    tracked = Storage(torch.LongStorage, 1, pack('q', 7))
+    proj = Storage(torch.DoubleStorage, 6, pack('d', 1, 2, 3, 4, 5, 6))
+    exp_avg = Storage(torch.FloatStorage, 6, floats(0.1, 0.2, 0.3, 0.4, 0.5, 0.6))
+
+    model = collections.OrderedDict([
+        ('embed.weight', tensor(embed, 0, (2, 3), (3, 1))),
+        ('norm.weight', tensor(norm, 0, (3,), (1,))),
+        ('norm.num_batches_tracked', tensor(tracked, 0, (), ())),
+        ('proj.weight', tensor(proj, 0, (3, 2), (1, 3))),
+        ('decoder.weight', tensor(embed, 0, (2, 3), (3, 1))),
+    ])
+    model._metadata = collections.OrderedDict([
+        ('', {'version': 1}),
+        ('norm', {'version': 2}),
+    ])
+    checkpoint = {
+        'epoch': 3,
+        'model': model,
+        'optimizer': {
+            'state': {0: {'step': 10,
+                          'exp_avg': tensor(exp_avg, 0, (2, 3), (3, 1))}},
+            'param_groups': [{'lr': 0.001, 'params': [0]}],
+        },
+    }
+    save_zip(checkpoint, 'synthetic_training_checkpoint.pt')
+
+
+def python2_state_dict():
+    # A state dict saved under Python 2, whose keys are "str" (bytes).
+    def tensor(storage, size):
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0, size,
+                      (1,), False, collections.OrderedDict())
+
+    weight = Storage(torch.FloatStorage, 3, floats(1, 2, 3))
+    bias = Storage(torch.FloatStorage, 1, floats(0.5))
+    state_dict = collections.OrderedDict([
+        ('fc.weight', tensor(weight, (3,))),
+        ('fc.bias', tensor(bias, (1,))),
+    ])
+    save_legacy_python2(state_dict, 'synthetic_python2_state_dict.pt')
+
+
+def state_dict_with_metadata():
+    # A bare state dict, as saved by torch.save(model.state_dict()), with
+    # the "_metadata" attribute holding the version of each submodule.
+    def tensor(storage, size):
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0, size,
+                      (1,), False, collections.OrderedDict())
+
+    state_dict = collections.OrderedDict([
+        ('bn.weight', tensor(Storage(torch.FloatStorage, 2, floats(1, 2)), (2,))),
+        ('bn.num_batches_tracked',
+         Tensor(torch._utils._rebuild_tensor_v2,
+                Storage(torch.LongStorage, 1, pack('q', 5)), 0, (), (),
+                False, collections.OrderedDict())),
+    ])
+    state_dict._metadata = collections.OrderedDict([
+        ('', {'version': 1}),
+        ('bn', {'version': 2}),
+    ])
+    save_zip(state_dict, 'synthetic_state_dict_metadata.pt')
+
+
+def parameters():
+    # A parameter (requiring grad), a buffer, a tensor requiring grad and a
+    # tensor rebuilt with the oldest _rebuild_tensor.
+    def tensor(storage, requires_grad=False):
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0, (2,), (1,),
+                      requires_grad, collections.OrderedDict())
+
+    def storage():
+        return Storage(torch.FloatStorage, 2, floats(1, 2))
+
+    obj = collections.OrderedDict([
+        ('weight', Tensor(torch._utils._rebuild_parameter, tensor(storage()),
+                          True, collections.OrderedDict())),
+        ('frozen', Tensor(torch._utils._rebuild_parameter, tensor(storage()),
+                          False, collections.OrderedDict())),
+        ('running_mean', tensor(storage())),
+        ('grad', tensor(storage(), requires_grad=True)),
+        ('legacy', Tensor(torch._utils._rebuild_tensor, storage(), 0, (2,),
+                          (1,))),
+    ])
+    save_zip(obj, 'synthetic_parameters.pt')
+
+
+def numpy_scalars():
+    # A checkpoint with metrics stored as NumPy scalars, as commonly done
+    # by training loops computing them with NumPy.
+    weight = Storage(torch.FloatStorage, 2, floats(1, 2))
+    checkpoint = {
+        'model': collections.OrderedDict([
+            ('fc.weight', Tensor(torch._utils._rebuild_tensor_v2, weight, 0,
+                                 (2,), (1,), False, collections.OrderedDict())),
+        ]),
+        'best_loss': NumpyScalar('<f8', '<d', 0.5),
+        'best_step': NumpyScalar('<i8', '<q', 42),
+    }
+    save_zip(checkpoint, 'synthetic_numpy_scalars.pt')
+
+
+def whole_module():
+    # A whole model, saved with torch.save(model): a Sequential of a Linear
+    # layer without bias, a BatchNorm1d and a ReLU, whose parameters and
+    # buffers are not in alphabetical order.
+    def tensor(storage, size, stride):
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0, size,
+                      stride, False, collections.OrderedDict())
+
+    def floats_tensor(*values):
+        storage = Storage(torch.FloatStorage, len(values), floats(*values))
+        return tensor(storage, (len(values),), (1,))
+
+    def parameter(t):
+        return Tensor(torch._utils._rebuild_parameter, t, True,
+                      collections.OrderedDict())
+
+    nn = torch.nn.modules
+    fc = nn.linear.Linear(parameters=[
+        ('weight', parameter(tensor(
+            Storage(torch.FloatStorage, 4, floats(1, 2, 3, 4)), (2, 2), (2, 1)))),
+        ('bias', None),
+    ])
+    bn = nn.batchnorm.BatchNorm1d(
+        parameters=[
+            ('weight', parameter(floats_tensor(1, 1))),
+            ('bias', parameter(floats_tensor(0, 0))),
+        ],
+        buffers=[
+            ('running_mean', floats_tensor(0, 0)),
+            ('running_var', floats_tensor(1, 1)),
+            ('num_batches_tracked',
+             tensor(Storage(torch.LongStorage, 1, pack('q', 0)), (), ())),
+        ])
+    bn.eps = 1e-05
+    model = nn.container.Sequential(modules=[
+        ('fc', fc),
+        ('bn', bn),
+        ('act', nn.activation.ReLU()),
+    ])
+    save_zip(model, 'synthetic_whole_module.pt')
+
+
+def unsigned_tensors():
+    # Tensors of the unsigned types added by PyTorch 2.3, which are saved
+    # with untyped storages and _rebuild_tensor_v3, holding values above
+    # the range of the signed types of the same size.
+    def tensor(fmt, dtype, *values):
+        data = pack(fmt, *values)
+        storage = Storage(torch.UntypedStorage, len(data), data)
+        return Tensor(torch._utils._rebuild_tensor_v3, storage, 0,
+                      (len(values),), (1,), False, collections.OrderedDict(),
+                      dtype)
+
+    tensors = collections.OrderedDict([
+        ('uint16', tensor('H', torch.uint16, 1, 40000, 65535)),
+        ('uint32', tensor('I', torch.uint32, 1, 3000000000, 4294967295)),
+        ('uint64', tensor('Q', torch.uint64, 1, 2**63 + 5, 2**64 - 1)),
+    ])
+    save_zip(tensors, 'synthetic_unsigned_tensors.pt')
+
+
+def dill_checkpoint():
+    # A checkpoint saved with pickle_module=dill, holding, along with the
+    # model weights, a learning rate lambda (a function, with its code and
+    # closure), a builtin type and a namedtuple.
+    weight = Storage(torch.FloatStorage, 2, floats(1, 2))
+    code = Reduced(dill._create_code, 1, 0, 0, 1, 2, 67, b'|\x00S\x00',
+                   (None,), (), ('epoch',), '<stdin>', '<lambda>', 1, b'',
+                   (), ())
+    lr_lambda = Reduced(dill._create_function, code, {}, '<lambda>', None,
+                        (Reduced(dill._create_cell, 0.95),))
+    point = Reduced(Reduced(dill._create_namedtuple, 'Point', ('x', 'y'),
+                            '__main__'), 3, 4)
+    checkpoint = {
+        'model': collections.OrderedDict([
+            ('fc.weight', Tensor(torch._utils._rebuild_tensor_v2, weight, 0,
+                                 (2,), (1,), False, collections.OrderedDict())),
+        ]),
+        'lr_lambda': lr_lambda,
+        'dtype': Reduced(dill._load_type, 'float'),
+        'point': point,
+    }
+    save_zip(checkpoint, 'synthetic_dill_checkpoint.pt')
+
+
+def legacy_wrapped_keys():
+    # A legacy file whose storage keys are pickled as a tuple of bytes,
+    # which protocol 2 turns into calls to _codecs.encode, rather than as a
+    # list of strings.
+    weight = Storage(torch.FloatStorage, 2, floats(1, 2))
+    bias = Storage(torch.FloatStorage, 1, floats(3))
+    state_dict = collections.OrderedDict([
+        ('weight', Tensor(torch._utils._rebuild_tensor_v2, weight, 0, (2,),
+                          (1,), False, collections.OrderedDict())),
+        ('bias', Tensor(torch._utils._rebuild_tensor_v2, bias, 0, (1,),
+                        (1,), False, collections.OrderedDict())),
+    ])
+    save_legacy_python2(state_dict, 'synthetic_legacy_wrapped_keys.pt',
+                        wrap_keys=lambda keys: tuple(k.encode() for k in keys))
+
+
+def quantized_state_dict():
+    # A state dict of a quantized model: the same bytes, with the same
+    # per-tensor parameters, as quint8 and as qint8, and a qint8 tensor
+    # quantized per channel along its first dimension.
+    data = bytes([0, 128, 255])
+    quint8 = Storage(torch.QUInt8Storage, 3, data)
+    qint8 = Storage(torch.QInt8Storage, 3, data)
+    per_channel = Storage(torch.QInt8Storage, 4, bytes([2, 4, 0xfe, 6]))
+    scales = Storage(torch.DoubleStorage, 2, pack('d', 0.5, 0.25))
+    zero_points = Storage(torch.LongStorage, 2, pack('q', 0, 2))
+    no_hooks = collections.OrderedDict()
+    state_dict = collections.OrderedDict([
+        ('quint8', Tensor(torch._utils._rebuild_qtensor, quint8, 0, (3,),
+                          (1,), (torch.per_tensor_affine, 0.5, 1), False,
+                          no_hooks)),
+        ('qint8', Tensor(torch._utils._rebuild_qtensor, qint8, 0, (3,),
+                         (1,), (torch.per_tensor_affine, 0.5, 1), False,
+                         no_hooks)),
+        ('per_channel', Tensor(
+            torch._utils._rebuild_qtensor, per_channel, 0, (2, 2), (2, 1),
+            (torch.per_channel_affine,
+             Tensor(torch._utils._rebuild_tensor_v2, scales, 0, (2,), (1,),
+                    False, no_hooks),
+             Tensor(torch._utils._rebuild_tensor_v2, zero_points, 0, (2,),
+                    (1,), False, no_hooks),
+             0),
+            False, no_hooks)),
+    ])
+    save_zip(state_dict, 'synthetic_quantized_state_dict.pt')
+
+
+class Generator:
+    # Reduced as torch.Generator: created on its device, then restored
+    # from its RNG state, seed and offset.
+    def __init__(self, device, state, seed, offset):
+        self.device = device
+        self.state = state
+        self.seed = seed
+        self.offset = offset
+
+    def __reduce__(self):
+        return Generator, (self.device,), (self.state, self.seed, self.offset)
+
+
+register(torch, Generator)
+
+
+def rng_checkpoint():
+    # A training checkpoint holding the RNG states needed to resume: the
+    # one of Python "random", as returned by random.getstate (shortened),
+    # the one of torch.get_rng_state, which is a ByteTensor, and a
+    # torch.Generator of a data loader.
+    weight = Storage(torch.FloatStorage, 2, floats(1, 2))
+    rng_state = Storage(torch.ByteStorage, 8, bytes(range(8)))
+    generator_state = Storage(torch.ByteStorage, 4, bytes([9, 8, 7, 6]))
+    checkpoint = {
+        'state_dict': collections.OrderedDict([
+            ('fc.weight', Tensor(torch._utils._rebuild_tensor_v2, weight, 0,
+                                 (2,), (1,), False, collections.OrderedDict())),
+        ]),
+        'python_rng_state': (3, (2147483648, 1, 2, 3, 624), None),
+        'torch_rng_state': Tensor(torch._utils._rebuild_tensor_v2, rng_state,
+                                  0, (8,), (1,), False,
+                                  collections.OrderedDict()),
+        'generator': Generator(
+            Reduced(torch.device, 'cpu'),
+            Tensor(torch._utils._rebuild_tensor_v2, generator_state, 0, (4,),
+                   (1,), False, collections.OrderedDict()),
+            42, 0),
+    }
+    save_zip(checkpoint, 'synthetic_rng_checkpoint.pt')
+
+
+torch_tensor = make_module('torch._tensor')
+
+
+def _rebuild_from_type_v2(*args):
+    raise NotImplementedError
+
+
+def _rebuild_wrapper_subclass(*args):
+    raise NotImplementedError
+
+
+register(torch_tensor, _rebuild_from_type_v2)
+register(torch_utils, _rebuild_wrapper_subclass)
+
+
+class layout:
+    def __init__(self, name):
+        self.name = name
+
+    def __reduce__(self):
+        return self.name
+
+
+register(torch, layout)
+torch.strided = layout('strided')
+register(torch, type('Tensor', (), {}))
+
+mylib = make_module('mylib')
+for _name in ['WrappedTensor', 'TaggedTensor']:
+    register(mylib, type(_name, (), {}))
+
+
+def tensor_subclasses():
+    # Tensors of Python subclasses of torch.Tensor, reduced through
+    # _rebuild_from_type_v2: a wrapper subclass, which has no storage of its
+    # own, holding its data as an inner tensor in its state, an ordinary
+    # subclass with an attribute, and a plain tensor with an attribute.
+    def tensor(*values):
+        storage = Storage(torch.FloatStorage, len(values), floats(*values))
+        return (storage, 0, (len(values),), (1,), False,
+                collections.OrderedDict())
+
+    wrapper_args = (mylib.WrappedTensor, torch.float32, (2,), (1,), 0,
+                    torch.strided, Reduced(torch.device, 'cpu'), False)
+    obj = collections.OrderedDict([
+        ('wrapped', Tensor(
+            torch._tensor._rebuild_from_type_v2,
+            torch._utils._rebuild_wrapper_subclass, mylib.WrappedTensor,
+            wrapper_args,
+            {'_data': Tensor(torch._utils._rebuild_tensor_v2, *tensor(1, 2))})),
+        ('tagged', Tensor(
+            torch._tensor._rebuild_from_type_v2,
+            torch._utils._rebuild_tensor_v2, mylib.TaggedTensor,
+            tensor(3, 4), {'tag': 'x'})),
+        ('plain', Tensor(
+            torch._tensor._rebuild_from_type_v2,
+            torch._utils._rebuild_tensor_v2, torch.Tensor, tensor(5, 6),
+            {'note': 'y'})),
+    ])
+    save_zip(obj, 'synthetic_tensor_subclasses.pt')
+
+
+def tuple_checkpoint():
+    # A checkpoint saved as torch.save((model.state_dict(), extra), path).
+    weight = Storage(torch.FloatStorage, 2, floats(1, 2))
+    bias = Storage(torch.FloatStorage, 1, floats(3))
+    state_dict = collections.OrderedDict([
+        ('fc.weight', Tensor(torch._utils._rebuild_tensor_v2, weight, 0,
+                             (2,), (1,), False, collections.OrderedDict())),
+        ('fc.bias', Tensor(torch._utils._rebuild_tensor_v2, bias, 0, (1,),
+                           (1,), False, collections.OrderedDict())),
+    ])
+    save_zip((state_dict, {'epoch': 7, 'arch': 'mlp'}),
+             'synthetic_tuple_checkpoint.pt')
+
+
+make_module('torch.nn.utils')
+nn_parametrize = make_module('torch.nn.utils.parametrize')
+for _name in ['ParametrizedLinear', 'ParametrizationList']:
+    register(nn_parametrize, type(_name, (Module,), {}))
+register(nn_modules['container'], type('ModuleDict', (Module,), {}))
+
+mymodels = make_module('mymodels')
+register(mymodels, type('Symmetric', (Module,), {}))
+
+
+def parametrized_module():
+    # A whole model whose Linear layer has its weight parametrized, with
+    # torch.nn.utils.parametrize.register_parametrization, by a user
+    # defined module: the original weight is kept in a ParametrizationList.
+    def tensor(*values):
+        storage = Storage(torch.FloatStorage, len(values), floats(*values))
+        return Tensor(torch._utils._rebuild_parameter,
+                      Tensor(torch._utils._rebuild_tensor_v2, storage, 0,
+                             (len(values),), (1,), False,
+                             collections.OrderedDict()),
+                      True, collections.OrderedDict())
+
+    nn = torch.nn.modules
+    weight = nn_parametrize.ParametrizationList(
+        parameters=[('original', tensor(1, 2, 3, 4))],
+        modules=[('0', mymodels.Symmetric())])
+    fc = nn_parametrize.ParametrizedLinear(
+        parameters=[('bias', tensor(0.5, -0.5))],
+        modules=[('parametrizations',
+                  nn.container.ModuleDict(modules=[('weight', weight)]))])
+    fc.in_features = 2
+    fc.out_features = 2
+    save_zip(nn.container.Sequential(modules=[('fc', fc)]),
+             'synthetic_parametrized_module.pt')
+
+
+def type_punned_views():
+    # A uint8 storage of 8 bytes, viewed both as its 8 uint8 values and,
+    # through _rebuild_tensor_v3, as 2 float32 values.
+    storage = Storage(torch.ByteStorage, 8, floats(1.5, -2))
+    obj = collections.OrderedDict([
+        ('bytes', Tensor(torch._utils._rebuild_tensor_v2, storage, 0, (8,),
+                         (1,), False, collections.OrderedDict())),
+        ('floats', Tensor(torch._utils._rebuild_tensor_v3, storage, 0, (2,),
+                          (1,), False, collections.OrderedDict(),
+                          torch.float32)),
+    ])
+    save_zip(obj, 'synthetic_type_punned_views.pt')
+
+
+def legacy_tar():
+    # A state dict in the legacy tar format. "weight" and "row" share the
+    # same storage, while "mask" views a storage which is itself a view of
+    # 2 elements of another one.
+    weight = Storage(torch.FloatStorage, 6, floats(1, 2, 3, 4, 5, 6))
+    mask = Storage(torch.ByteStorage, 4, bytes([0, 1, 1, 0]))
+    state_dict = collections.OrderedDict([
+        ('weight', LegacyTensor(torch.FloatTensor, weight, 0, (2, 3), (3, 1))),
+        ('row', LegacyTensor(torch.FloatTensor, weight, 3, (3,), (1,))),
+        ('mask', LegacyTensor(torch.ByteTensor, StorageView(mask, 1, 2), 0,
+                              (2,), (1,))),
+    ])
+    save_legacy_tar(state_dict, 'synthetic_legacy_tar.pt')
+
+
+def legacy_storage_views():
+    # A legacy state dict of an RNN whose weights view a single flat
+    # buffer, as left by "flatten_parameters". "weight_hh_l0" and
+    # "weight_hh_l0_copy" share the same view.
+    flat = Storage(torch.FloatStorage, 6, floats(1, 2, 3, 4, 5, 6))
+    weight_ih = StorageView(flat, 0, 2)
+    weight_hh = StorageView(flat, 2, 4)
+
+    def tensor(storage, size, stride):
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0, size,
+                      stride, False, collections.OrderedDict())
+
+    state_dict = collections.OrderedDict([
+        ('weight_ih_l0', tensor(weight_ih, (2,), (1,))),
+        ('weight_hh_l0', tensor(weight_hh, (2, 2), (2, 1))),
+        ('weight_hh_l0_copy', tensor(weight_hh, (4,), (1,))),
+    ])
+    save_legacy_python2(state_dict, 'synthetic_legacy_storage_views.pt')
+
+
+def integer_storage_keys():
+    # A state dict whose storages are referred to by integer keys, rather
+    # than by strings.
+    def tensor(storage, size):
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0, size,
+                      (1,), False, collections.OrderedDict())
+
+    fc = Storage(torch.FloatStorage, 3, floats(1, 2, 3))
+    state_dict = collections.OrderedDict([
+        ('fc.weight', tensor(fc, (3,))),
+        ('fc.bias', tensor(Storage(torch.LongStorage, 1, pack('q', 7)), (1,))),
+        ('fc.weight_copy', tensor(fc, (3,))),
+    ])
+    save_zip(state_dict, 'synthetic_integer_storage_keys.pt', key_type=int)
+
+
+def bfloat16_state_dict():
+    # A bfloat16 weight in a typed BFloat16Storage, as saved by PyTorch 1.x,
+    # and one in an untyped storage, as saved by PyTorch 2.x.
+    typed = Storage(torch.BFloat16Storage, 3, bfloat16s(1.5, -2, 3.140625))
+    untyped = Storage(torch.UntypedStorage, 4, bfloat16s(-0.5, 65536))
+    state_dict = collections.OrderedDict([
+        ('typed', Tensor(torch._utils._rebuild_tensor_v2, typed, 0, (3,),
+                         (1,), False, collections.OrderedDict())),
+        ('untyped', Tensor(torch._utils._rebuild_tensor_v3, untyped, 0, (2,),
+                           (1,), False, collections.OrderedDict(),
+                           torch.bfloat16)),
+    ])
+    save_zip(state_dict, 'synthetic_bfloat16.pt')
+
+
+def quantized_linear():
+    # The state dict of a "torch.nn.quantized.Linear" layer of 2 inputs and
+    # 2 outputs: its qint8 weight, quantized per tensor, and its float bias
+    # are packed in a tuple, along with the scale and zero point of the
+    # output.
+    no_hooks = collections.OrderedDict()
+    weight = Tensor(torch._utils._rebuild_qtensor,
+                    Storage(torch.QInt8Storage, 4, bytes([10, 0xf6, 20, 0])),
+                    0, (2, 2), (2, 1), (torch.per_tensor_affine, 0.1, 0),
+                    False, no_hooks)
+    bias = Tensor(torch._utils._rebuild_tensor_v2,
+                  Storage(torch.FloatStorage, 2, floats(0.5, -0.5)), 0, (2,),
+                  (1,), False, no_hooks)
+    state_dict = collections.OrderedDict([
+        ('fc.scale', Tensor(torch._utils._rebuild_tensor_v2,
+                            Storage(torch.FloatStorage, 1, floats(0.25)), 0,
+                            (), (), False, no_hooks)),
+        ('fc.zero_point', Tensor(torch._utils._rebuild_tensor_v2,
+                                 Storage(torch.LongStorage, 1, pack('q', 3)),
+                                 0, (), (), False, no_hooks)),
+        ('fc._packed_params.dtype', torch.qint8),
+        ('fc._packed_params._packed_params', (weight, bias)),
+    ])
+    save_zip(state_dict, 'synthetic_quantized_linear.pt')
+
+
+def legacy_full_model():
+    # A whole model, rather than its state dict, saved in the legacy
+    # format: the class of each module is referred to by a "module"
+    # persistent ID, holding its source.
+    def parameter(values):
+        storage = Storage(torch.FloatStorage, len(values), floats(*values))
+        return Tensor(torch._utils._rebuild_parameter,
+                      Tensor(torch._utils._rebuild_tensor_v2, storage, 0,
+                             (len(values),), (1,), False,
+                             collections.OrderedDict()),
+                      True, collections.OrderedDict())
+
+    nn = torch.nn.modules
+    model = nn.container.Sequential(modules=[
+        ('0', nn.linear.Linear(parameters=[('weight', parameter([1, 2])),
+                                           ('bias', parameter([0.5]))])),
+        ('1', nn.linear.Linear(parameters=[('weight', parameter([3])),
+                                           ('bias', None)])),
+    ])
+    save_legacy_python2(model, 'synthetic_legacy_full_model.pt')
+
+
+def _rebuild_sparse_tensor(*args):
+    raise NotImplementedError
+
+
+def _rebuild_sparse_csr_tensor(*args):
+    raise NotImplementedError
+
+
+register(torch_utils, _rebuild_sparse_tensor)
+register(torch_utils, _rebuild_sparse_csr_tensor)
+register(torch, type('Size', (), {}))
+torch.sparse_coo = layout('sparse_coo')
+torch.sparse_csr = layout('sparse_csr')
+
+
+def sparse_tensors():
+    # The adjacency matrix [[0, 1, 0], [0, 0, 2], [3, 0, 0]] as a sparse COO
+    # tensor, as a sparse CSR tensor, and as a CSR tensor of the older
+    # _rebuild_sparse_csr_tensor, with the sizes pickled as torch.Size.
+    def tensor(storage_class, fmt, *values):
+        storage = Storage(storage_class, len(values), pack(fmt, *values))
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0,
+                      (len(values),), (1,), False, collections.OrderedDict())
+
+    size = Reduced(torch.Size, (3, 3))
+    indices_storage = Storage(torch.LongStorage, 6, pack('q', 0, 1, 2,
+                                                         1, 2, 0))
+    indices = Tensor(torch._utils._rebuild_tensor_v2, indices_storage, 0,
+                     (2, 3), (3, 1), False, collections.OrderedDict())
+    values = tensor(torch.FloatStorage, 'f', 1, 2, 3)
+    crow_indices = tensor(torch.LongStorage, 'q', 0, 1, 2, 3)
+    col_indices = tensor(torch.LongStorage, 'q', 1, 2, 0)
+    obj = collections.OrderedDict([
+        ('coo', Tensor(torch._utils._rebuild_sparse_tensor, torch.sparse_coo,
+                       (indices, values, size, True))),
+        ('csr', Tensor(torch._utils._rebuild_sparse_tensor, torch.sparse_csr,
+                       (crow_indices, col_indices, values, size))),
+        ('old_csr', Tensor(torch._utils._rebuild_sparse_csr_tensor,
+                           torch.sparse_csr,
+                           (crow_indices, col_indices, values, size))),
+    ])
+    save_zip(obj, 'synthetic_sparse_tensors.pt')
+
+
+def ordered_state_dict():
+    # A state dict of 24 entries, whose order differs from the sorted one:
+    # list(sd.keys()) is [f'layers.{i}.{name}' for i in range(12)
+    # for name in ('weight', 'bias')].
+    entries = []
+    for i in range(12):
+        for j, name in enumerate(('weight', 'bias')):
+            storage = Storage(torch.FloatStorage, 1, floats(2 * i + j))
+            entries.append((f'layers.{i}.{name}', Tensor(
+                torch._utils._rebuild_tensor_v2, storage, 0, (1,), (1,),
+                False, collections.OrderedDict())))
+    save_zip(collections.OrderedDict(entries),
+             'synthetic_ordered_state_dict.pt')
+
+
+def big_endian_state_dict():
+    # A state dict saved on a big-endian host, whose storages hold their
+    # elements in big-endian order, as the "byteorder" record tells.
+    def tensor(storage_class, fmt, *values):
+        storage = Storage(storage_class, len(values),
+                          struct.pack(f'>{len(values)}{fmt}', *values))
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0,
+                      (len(values),), (1,), False, collections.OrderedDict())
+
+    state_dict = collections.OrderedDict([
+        ('weight', tensor(torch.FloatStorage, 'f', 1.5, -2, 3.25)),
+        ('half', tensor(torch.HalfStorage, 'e', 0.5, -1)),
+        ('steps', tensor(torch.LongStorage, 'q', 1, -2)),
+        ('mask', tensor(torch.ByteStorage, 'B', 1, 0, 1)),
+    ])
+    save_zip(state_dict, 'synthetic_big_endian.pt', byteorder=b'big')
+
+
+def complex_state_dict():
+    # A complex64 tensor in a typed ComplexFloatStorage, as saved by PyTorch
+    # 1.x, and a complex128 one in an untyped storage, as saved by PyTorch
+    # 2.x. Each element is the real part followed by the imaginary one.
+    typed = Storage(torch.ComplexFloatStorage, 2, pack('f', 1.5, -2, 0, 0.25))
+    untyped = Storage(torch.UntypedStorage, 32, pack('d', -1, 3, 0.5, -0.5))
+    state_dict = collections.OrderedDict([
+        ('typed', Tensor(torch._utils._rebuild_tensor_v2, typed, 0, (2,),
+                         (1,), False, collections.OrderedDict())),
+        ('untyped', Tensor(torch._utils._rebuild_tensor_v3, untyped, 0, (2,),
+                           (1,), False, collections.OrderedDict(),
+                           torch.complex128)),
+    ])
+    save_zip(state_dict, 'synthetic_complex.pt')
+
+
+make_module('__torch__')
+for _name in ['torch', 'torch.nn', 'torch.nn.modules']:
+    make_module('__torch__.' + _name)
+script_linear = make_module('__torch__.torch.nn.modules.linear')
+
+
+class ScriptObject:
+    # Pickled as torch.jit.save pickles the objects of TorchScript classes:
+    # NEWOBJ of their class, then BUILD with a dict of all their
+    # attributes.
+    def __init__(self, **attributes):
+        self.__dict__.update(attributes)
+
+
+register(sys.modules['__torch__'], type('Net', (ScriptObject,), {}))
+register(script_linear, type('Linear', (ScriptObject,), {}))
+
+
+def scripted_module():
+    # A model saved with torch.jit.save: a Net module with a Linear
+    # submodule, and a constant tensor used by its code. The storages of
+    # data.pkl and of constants.pkl have the same keys, in the "data" and
+    # "constants" directories.
+    def floats_tensor(size, *values):
+        storage = Storage(torch.FloatStorage, len(values), floats(*values))
+        stride = (size[1], 1) if len(size) == 2 else (1,)
+        return Tensor(torch._utils._rebuild_tensor_v2, storage, 0, size,
+                      stride, False, collections.OrderedDict())
+
+    fc = script_linear.Linear(
+        training=False, _is_full_backward_hook=None, in_features=2,
+        out_features=2, weight=floats_tensor((2, 2), 1, 2, 3, 4),
+        bias=floats_tensor((2,), 0.5, -0.5))
+    model = sys.modules['__torch__'].Net(
+        training=False, _is_full_backward_hook=None, fc=fc)
+    code = {
+        'code/__torch__.py':
+            b'class Net(Module):\n'
+            b'  __parameters__ = []\n'
+            b'  __buffers__ = []\n'
+            b'  training : bool\n'
+            b'  fc : __torch__.torch.nn.modules.linear.Linear\n'
+            b'  def forward(self: __torch__.Net, x: Tensor) -> Tensor:\n'
+            b'    return torch.add((self.fc).forward(x, ), CONSTANTS.c0)\n',
+        'code/__torch__.py.debug_pkl': b'\x80\x02).',
+        'code/__torch__/torch/nn/modules/linear.py':
+            b'class Linear(Module):\n'
+            b'  __parameters__ = ["weight", "bias", ]\n'
+            b'  __buffers__ = []\n'
+            b'  weight : Tensor\n'
+            b'  bias : Tensor\n',
+    }
+
+    data_buf = io.BytesIO()
+    data_pickler = ZipPickler(data_buf, protocol=2)
+    data_pickler.dump(model)
+    constants_buf = io.BytesIO()
+    constants_pickler = ZipPickler(constants_buf, protocol=2)
+    constants_pickler.dump((floats_tensor((2,), 10, 20),))
+    with zipfile.ZipFile('synthetic_scripted_module.pt', 'w',
+                         zipfile.ZIP_STORED) as zf:
+        write_entry(zf, 'archive/data.pkl', data_buf.getvalue())
+        for name, data in code.items():
+            write_entry(zf, f'archive/{name}', data)
+        write_entry(zf, 'archive/constants.pkl', constants_buf.getvalue())
+        for key, storage in enumerate(data_pickler.storages):
+            write_entry(zf, f'archive/data/{key}', storage.data)
+        for key, storage in enumerate(constants_pickler.storages):
+            write_entry(zf, f'archive/constants/{key}', storage.data)
+        write_entry(zf, 'archive/version', b'3\n')
+        write_entry(zf, 'archive/.data/version', b'6\n')
+
+
+def main():
+    untyped_storage_v3()
+    training_checkpoint()
+    truncated_storage()
+    python2_state_dict()
+    state_dict_with_metadata()
+    parameters()
+    numpy_scalars()
+    whole_module()
+    unsigned_tensors()
+    dill_checkpoint()
+    rng_checkpoint()
+    legacy_wrapped_keys()
+    quantized_state_dict()
+    tensor_subclasses()
+    tuple_checkpoint()
+    parametrized_module()
+    type_punned_views()
+    legacy_tar()
+    legacy_storage_views()
+    integer_storage_keys()
+    bfloat16_state_dict()
+    quantized_linear()
+    legacy_full_model()
+    sparse_tensors()
+    ordered_state_dict()
+    big_endian_state_dict()
+    complex_state_dict()
+    scripted_module()
+
+
+if __name__ == '__main__':
+    main()
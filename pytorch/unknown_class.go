@@ -0,0 +1,85 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+)
+
+// UnknownClass is a placeholder for a class, function or any other global
+// which cannot be resolved while loading a file with
+// LoadOptions.AllowUnknownClasses set.
+//
+// It can be both called and instantiated, producing UnknownObject values,
+// so that the rest of the file, such as the tensors, can still be loaded.
+type UnknownClass struct {
+	Module string
+	Name   string
+}
+
+var _ types.Callable = &UnknownClass{}
+var _ types.PyNewable = &UnknownClass{}
+
+// Call returns a new UnknownObject made with the given arguments.
+func (c *UnknownClass) Call(args ...interface{}) (interface{}, error) {
+	return &UnknownObject{Class: c, Args: args}, nil
+}
+
+// PyNew returns a new UnknownObject made with the given arguments.
+func (c *UnknownClass) PyNew(args ...interface{}) (interface{}, error) {
+	return &UnknownObject{Class: c, Args: args}, nil
+}
+
+// String returns the qualified name of the class.
+func (c *UnknownClass) String() string {
+	return fmt.Sprintf("%s.%s", c.Module, c.Name)
+}
+
+// UnknownObject is the result of calling or instantiating an UnknownClass.
+// It keeps the arguments, and the state eventually set on it, as found in
+// the pickle data.
+//
+// An UnknownObject can be called in turn, returning a new UnknownObject of
+// the same class, as when the result of a function is another function.
+type UnknownObject struct {
+	Class *UnknownClass
+	Args  []interface{}
+	State interface{}
+	// ListItems and DictItems hold the items appended or set by the pickle,
+	// when the class is a subclass of "list" or "dict", or nil otherwise.
+	ListItems []interface{}
+	DictItems *types.Dict
+}
+
+var _ types.Callable = &UnknownObject{}
+var _ types.PyStateSettable = &UnknownObject{}
+var _ types.ListAppender = &UnknownObject{}
+var _ types.DictSetter = &UnknownObject{}
+
+// Call returns a new UnknownObject of the same class, with the given
+// arguments.
+func (o *UnknownObject) Call(args ...interface{}) (interface{}, error) {
+	return &UnknownObject{Class: o.Class, Args: args}, nil
+}
+
+// PySetState stores the state of the object as it is.
+func (o *UnknownObject) PySetState(state interface{}) error {
+	o.State = state
+	return nil
+}
+
+// Append appends an item of the object, in its ListItems.
+func (o *UnknownObject) Append(v interface{}) {
+	o.ListItems = append(o.ListItems, v)
+}
+
+// Set sets an item of the object, in its DictItems.
+func (o *UnknownObject) Set(key, value interface{}) {
+	if o.DictItems == nil {
+		o.DictItems = types.NewDict()
+	}
+	o.DictItems.Set(key, value)
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// errDataDiscarded completes the storages whose data has been verified by
+// Verify, and then discarded.
+var errDataDiscarded = errors.New("storage data discarded by Verify")
+
+// Verify checks that the named file can be loaded by Load, returning the
+// error Load would return otherwise, such as for an unknown class or a
+// truncated storage.
+//
+// The structure of a zip-based file is unpickled as Load does, but the
+// data of each storage is only checked against the size it declares and
+// the checksum of its zip record, while being read and discarded, so that
+// even a large checkpoint is verified with little memory. Legacy files
+// are loaded in full, and then discarded.
+func Verify(filename string) error {
+	opts := LoadOptions{}.withDefaults()
+	if !isZipFile(filename) {
+		_, err := loadLegacyFile(filename, opts)
+		return err
+	}
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, deferred, err := unpickleZipFile(&r.Reader, nil, opts, true)
+	// Nothing is ever read into the storages: release any goroutine waiting
+	// for their data.
+	defer func() {
+		for _, d := range deferred {
+			d.pending.finish(errDataDiscarded)
+		}
+	}()
+	if errors.Is(err, ErrNotTorchArchive) {
+		_, err = loadLegacyFallback(filename, opts, err)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	fileRecords := recordsByName(&r.Reader)
+	for _, d := range deferred {
+		if err := verifyStorageRecord(d, fileRecords); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyStorageRecord checks that the zip record of a storage holds all
+// of its elements, reading the whole record so that its checksum is
+// verified too.
+func verifyStorageRecord(d deferredStorage, fileRecords map[string]*zip.File) error {
+	file, ok := fileRecords[d.key]
+	if !ok {
+		return fmt.Errorf("cannot find zip record '%s'", d.key)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	n, err := io.Copy(ioutil.Discard, rc)
+	if err != nil {
+		return fmt.Errorf("storage '%s': %w", d.key, err)
+	}
+	if elementSize, ok := storageClassElementSize(d.dataType); ok {
+		if required := int64(d.size) * int64(elementSize); n < required {
+			return fmt.Errorf(
+				"storage '%s' of %d elements requires %d bytes, but its "+
+					"zip record has only %d bytes", d.key, d.size, required, n)
+		}
+	}
+	return nil
+}
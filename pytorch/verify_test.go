@@ -0,0 +1,101 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pytorch
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	for _, name := range []string{
+		"synthetic_parameters.pt",
+		"synthetic_untyped_storage_v3.pt",
+		"synthetic_type_punned_views.pt",
+		"synthetic_python2_state_dict.pt",
+		"synthetic_legacy_tar.pt",
+	} {
+		if err := Verify(path.Join("testdata", name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("truncated storage", func(t *testing.T) {
+		r, err := zip.OpenReader(path.Join("testdata", "synthetic_parameters.pt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		filename := path.Join(dir, "truncated_storage.pt")
+		f, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for _, file := range r.File {
+			data := readZipRecord(t, file)
+			if strings.Contains(file.Name, "/data/") {
+				data = data[:len(data)/2]
+			}
+			w, err := zw.Create(file.Name)
+			if err == nil {
+				_, err = w.Write(data)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		assertErrorContains(t, Verify(filename), "requires 8 bytes, but its zip record has only 4 bytes")
+	})
+
+	t.Run("truncated file", func(t *testing.T) {
+		for _, name := range []string{"synthetic_parameters.pt", "synthetic_python2_state_dict.pt"} {
+			data, err := ioutil.ReadFile(path.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			filename := path.Join(dir, name)
+			if err := ioutil.WriteFile(filename, data[:len(data)-4], 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := Verify(filename); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+
+	t.Run("unknown class", func(t *testing.T) {
+		err := Verify(path.Join("testdata", "synthetic_dill_checkpoint.pt"))
+		assertErrorContains(t, err, "AllowUnknownClasses")
+	})
+}
+
+func readZipRecord(t *testing.T, file *zip.File) []byte {
+	t.Helper()
+	rc, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,269 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pytorch"
+	"io"
+	"os"
+	"sort"
+)
+
+// dtypes maps the names of the data types in the header of a
+// ".safetensors" file to the PyTorch ones.
+var dtypes = map[string]*pytorch.Dtype{
+	"F16":  pytorch.Float16,
+	"BF16": pytorch.BFloat16,
+	"F32":  pytorch.Float32,
+	"F64":  pytorch.Float64,
+	"I8":   pytorch.Int8,
+	"I16":  pytorch.Int16,
+	"I32":  pytorch.Int32,
+	"I64":  pytorch.Int64,
+	"U8":   pytorch.Uint8,
+	"U16":  pytorch.Uint16,
+	"U32":  pytorch.Uint32,
+	"U64":  pytorch.Uint64,
+	"BOOL": pytorch.Bool,
+}
+
+// metadataKey is the entry of the header holding the metadata of the
+// file, rather than a tensor.
+const metadataKey = "__metadata__"
+
+// maxHeaderSize is the largest header accepted, as by the Python library,
+// so that a corrupted length does not allocate huge amounts of memory.
+const maxHeaderSize = 100 << 20
+
+// maxInt is the largest int value.
+const maxInt = int(^uint(0) >> 1)
+
+// headerEntry is the description of a tensor in the header.
+type headerEntry struct {
+	Dtype       string   `json:"dtype"`
+	Shape       []int    `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// Load loads the tensors of a ".safetensors" file, by name, as the same
+// pytorch.Tensor values returned by pytorch.LoadStateDict: each tensor is
+// contiguous, with its own storage.
+func Load(filename string) (map[string]*pytorch.Tensor, error) {
+	tensors, _, err := LoadWithMetadata(filename)
+	return tensors, err
+}
+
+// LoadWithMetadata is like Load, but it also returns the string metadata
+// of the "__metadata__" entry of the header, or nil if it is missing.
+func LoadWithMetadata(filename string) (map[string]*pytorch.Tensor, map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	tensors, metadata, err := read(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("safetensors: %s: %w", filename, err)
+	}
+	return tensors, metadata, nil
+}
+
+// read reads the header and the tensors of a file.
+func read(f *os.File) (map[string]*pytorch.Tensor, map[string]string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	var lengthBytes [8]byte
+	if _, err := io.ReadFull(f, lengthBytes[:]); err != nil {
+		return nil, nil, fmt.Errorf("reading header length: %w", err)
+	}
+	length := binary.LittleEndian.Uint64(lengthBytes[:])
+	if length > maxHeaderSize || int64(length) > info.Size()-8 {
+		return nil, nil, fmt.Errorf("invalid header length %d", length)
+	}
+	header := make([]byte, length)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(header, &entries); err != nil {
+		return nil, nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	dataStart := 8 + int64(length)
+	dataSize := info.Size() - dataStart
+	var metadata map[string]string
+	tensors := make(map[string]*pytorch.Tensor, len(entries))
+	for name, raw := range entries {
+		if name == metadataKey {
+			if err := json.Unmarshal(raw, &metadata); err != nil {
+				return nil, nil, fmt.Errorf("invalid metadata: %w", err)
+			}
+			continue
+		}
+		var entry headerEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, nil, fmt.Errorf("%q: invalid header entry: %w", name, err)
+		}
+		tensor, err := readTensor(f, dataStart, dataSize, entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%q: %w", name, err)
+		}
+		tensors[name] = tensor
+	}
+	return tensors, metadata, nil
+}
+
+// readTensor reads the data of the tensor described by entry, from the
+// data of the file, of the given size, starting at dataStart.
+func readTensor(f *os.File, dataStart, dataSize int64, entry headerEntry) (*pytorch.Tensor, error) {
+	dtype, ok := dtypes[entry.Dtype]
+	if !ok {
+		return nil, fmt.Errorf("unsupported data type %q", entry.Dtype)
+	}
+	numel := 1
+	for _, s := range entry.Shape {
+		if s < 0 {
+			return nil, fmt.Errorf("invalid shape %v", entry.Shape)
+		}
+		// a malicious shape must not wrap around to a small size
+		if s > 0 && numel > maxInt/dtype.ElementSize/s {
+			return nil, fmt.Errorf("shape %v is too large", entry.Shape)
+		}
+		numel *= s
+	}
+	begin, end := entry.DataOffsets[0], entry.DataOffsets[1]
+	if begin < 0 || end < begin || end > dataSize {
+		return nil, fmt.Errorf("invalid data offsets [%d, %d] for %d bytes of data",
+			begin, end, dataSize)
+	}
+	if end-begin != int64(numel)*int64(dtype.ElementSize) {
+		return nil, fmt.Errorf("%d bytes of data for %d elements of type %s",
+			end-begin, numel, entry.Dtype)
+	}
+	storage := dtype.StorageClass.New(numel, "cpu")
+	r := bufio.NewReader(io.NewSectionReader(f, dataStart+begin, end-begin))
+	if err := storage.SetFromFileWithSize(r, numel); err != nil {
+		return nil, err
+	}
+	stride := make([]int, len(entry.Shape))
+	for i, acc := len(entry.Shape)-1, 1; i >= 0; i-- {
+		stride[i] = acc
+		acc *= entry.Shape[i]
+	}
+	return &pytorch.Tensor{
+		Source: storage,
+		Size:   append([]int{}, entry.Shape...),
+		Stride: stride,
+	}, nil
+}
+
+// Save writes the given tensors, such as a state dict loaded by
+// pytorch.LoadStateDict, in a new ".safetensors" file, laid out as by
+// pytorch.ToSafetensorsHeader. The file can be loaded by Load, and by
+// "safetensors.torch.load_file" in Python.
+func Save(filename string, tensors map[string]*pytorch.Tensor) error {
+	return SaveWithMetadata(filename, tensors, nil)
+}
+
+// SaveWithMetadata is like Save, but it also writes the given string
+// metadata in the "__metadata__" entry of the header, unless it is empty.
+func SaveWithMetadata(filename string, tensors map[string]*pytorch.Tensor, metadata map[string]string) error {
+	header, layout, err := pytorch.ToSafetensorsHeader(tensors)
+	if err != nil {
+		return err
+	}
+	if len(metadata) > 0 {
+		if header, err = withMetadata(header, metadata); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = write(w, header, layout)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("safetensors: %s: %w", filename, err)
+	}
+	return nil
+}
+
+// write writes the header, followed by the data of the tensors of layout.
+func write(w io.Writer, header []byte, layout []pytorch.SafetensorsEntry) error {
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, entry := range layout {
+		data, err := entry.Tensor.Bytes()
+		if err != nil {
+			return fmt.Errorf("%q: %w", entry.Name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withMetadata returns header, as returned by pytorch.ToSafetensorsHeader,
+// with the metadata entry added first, still padded to alignment.
+func withMetadata(header []byte, metadata map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	buf.WriteString(`{"` + metadataKey + `":{`)
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(metadata[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	tensors := bytes.TrimRight(header[8:], " ")
+	if len(tensors) > 2 {
+		// the entries of the tensors follow, without the opening brace
+		buf.WriteByte(',')
+		buf.Write(tensors[1:])
+	} else {
+		buf.WriteByte('}')
+	}
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(' ')
+	}
+
+	result := buf.Bytes()
+	binary.LittleEndian.PutUint64(result[:8], uint64(len(result)-8))
+	return result, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"encoding/binary"
+	"github.com/nlpodyssey/gopickle/pytorch"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a ".safetensors" file with the given header and data.
+func writeFile(t *testing.T, header string, data []byte) string {
+	t.Helper()
+	content := make([]byte, 8, 8+len(header)+len(data))
+	binary.LittleEndian.PutUint64(content, uint64(len(header)))
+	content = append(content, header...)
+	content = append(content, data...)
+	filename := path.Join(t.TempDir(), "model.safetensors")
+	if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoad(t *testing.T) {
+	// as written by "safetensors.torch.save_file"
+	header := `{"__metadata__":{"format":"pt"},` +
+		`"a":{"dtype":"F32","shape":[2,2],"data_offsets":[0,16]},` +
+		`"b":{"dtype":"BF16","shape":[2],"data_offsets":[16,20]},` +
+		`"c":{"dtype":"BOOL","shape":[],"data_offsets":[20,21]}}`
+	data := []byte{
+		0, 0, 0x80, 0x3f, 0, 0, 0, 0x40, 0, 0, 0x40, 0x40, 0, 0, 0x80, 0x40,
+		0x80, 0x3f, 0x00, 0xc0,
+		1,
+	}
+	tensors, metadata, err := LoadWithMetadata(writeFile(t, header, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(metadata, map[string]string{"format": "pt"}) {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+	if len(tensors) != 3 {
+		t.Fatalf("expected 3 tensors, actual %d", len(tensors))
+	}
+	a := tensors["a"]
+	if !reflect.DeepEqual(a.Size, []int{2, 2}) || !reflect.DeepEqual(a.Stride, []int{2, 1}) {
+		t.Errorf("unexpected size %v and stride %v", a.Size, a.Stride)
+	}
+	if d := a.Source.(*pytorch.FloatStorage).Data; !reflect.DeepEqual(d, []float32{1, 2, 3, 4}) {
+		t.Errorf("unexpected data %v", d)
+	}
+	if d := tensors["b"].Source.(*pytorch.BFloat16Storage).Data; !reflect.DeepEqual(d, []float32{1, -2}) {
+		t.Errorf("unexpected data %v", d)
+	}
+	c := tensors["c"]
+	if len(c.Size) != 0 || !reflect.DeepEqual(c.Source.(*pytorch.BoolStorage).Data, []bool{true}) {
+		t.Errorf("unexpected scalar %#v", c)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		err    string
+	}{
+		{`{"a":{"dtype":"F32","shape":[2],"data_offsets":[0,12]}}`, "invalid data offsets [0, 12] for 8 bytes"},
+		{`{"a":{"dtype":"F32","shape":[3],"data_offsets":[0,8]}}`, "8 bytes of data for 3 elements"},
+		{`{"a":{"dtype":"F8_E4M3","shape":[8],"data_offsets":[0,8]}}`, `unsupported data type "F8_E4M3"`},
+		{`{"a":{"dtype":"U8","shape":[65536,65536,65536,65536],"data_offsets":[0,0]}}`, "shape [65536 65536 65536 65536] is too large"},
+		{`{"a":`, "invalid header"},
+	} {
+		_, err := Load(writeFile(t, tc.header, make([]byte, 8)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error containing %q, actual %v", tc.err, err)
+		}
+	}
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	tensors := map[string]*pytorch.Tensor{
+		"weight": {
+			Source: &pytorch.HalfStorage{BaseStorage: pytorch.BaseStorage{Size: 3}, Data: []float32{0.5, -1, 2}},
+			Size:   []int{3},
+			Stride: []int{1},
+		},
+		"step": {
+			Source: &pytorch.LongStorage{BaseStorage: pytorch.BaseStorage{Size: 1}, Data: []int64{42}},
+			Size:   []int{},
+			Stride: []int{},
+		},
+	}
+	for _, metadata := range []map[string]string{nil, {"format": "pt", "note": `"quoted"`}} {
+		filename := path.Join(t.TempDir(), "model.safetensors")
+		if err := SaveWithMetadata(filename, tensors, metadata); err != nil {
+			t.Fatal(err)
+		}
+		loaded, loadedMetadata, err := LoadWithMetadata(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loadedMetadata, metadata) {
+			t.Errorf("expected metadata %v, actual %v", metadata, loadedMetadata)
+		}
+		if d := loaded["weight"].Source.(*pytorch.HalfStorage).Data; !reflect.DeepEqual(d, []float32{0.5, -1, 2}) {
+			t.Errorf("unexpected data %v", d)
+		}
+		if d := loaded["step"].Source.(*pytorch.LongStorage).Data; !reflect.DeepEqual(d, []int64{42}) {
+			t.Errorf("unexpected data %v", d)
+		}
+	}
+
+	// the metadata alone makes a valid file
+	filename := path.Join(t.TempDir(), "empty.safetensors")
+	if err := SaveWithMetadata(filename, nil, map[string]string{"format": "pt"}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 0 {
+		t.Errorf("expected no tensors, actual %d", len(loaded))
+	}
+}
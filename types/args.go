@@ -0,0 +1,32 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+// intArg returns the value of an integer argument, which is an int, or an
+// int64 if the Unpickler NormalizeInts option is set.
+func intArg(v interface{}) (int, bool) {
+	switch i := v.(type) {
+	case int:
+		return i, true
+	case int64:
+		return int(i), true
+	default:
+		return 0, false
+	}
+}
+
+// floatArg returns the value of a float, or integer, argument.
+func floatArg(v interface{}) (float64, bool) {
+	switch f := v.(type) {
+	case float64:
+		return f, true
+	case int:
+		return float64(f), true
+	case int64:
+		return float64(f), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import "fmt"
+
+// GetAttr represents Python "getattr" function (builtin). Pickles refer to
+// it to rebuild the methods bound to an object, such as "[].append", or
+// the callbacks of a model, and, since Python 3.11, the members of the
+// enums, as the attributes of their class.
+type GetAttr struct{}
+
+var _ Callable = &GetAttr{}
+
+// Call returns a new Attribute, with the object and the name given as
+// arguments. The default value, which may follow, is ignored, since the
+// attribute cannot be looked up.
+func (*GetAttr) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("GetAttr: invalid arguments: %#v", args)
+	}
+	name, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("GetAttr: invalid attribute name: %#v", args[1])
+	}
+	return &Attribute{Object: args[0], Name: name}, nil
+}
+
+// Attribute represents the value of the attribute of a Python object, or
+// class, returned by "getattr", as it is pickled: usually a bound method,
+// or a member of an enum class.
+type Attribute struct {
+	// Object is the object, or class, such as a *GenericObject or a
+	// *GenericClass, which has the attribute.
+	Object interface{}
+	// Name is the name of the attribute, such as the name of the method.
+	Name string
+}
+
+var _ fmt.Stringer = &Attribute{}
+
+// String returns the qualified name of the attribute of a class, or the
+// name of the attribute of an object, after the name of its class.
+func (a *Attribute) String() string {
+	switch o := a.Object.(type) {
+	case *GenericClass:
+		return o.Module + "." + o.Name + "." + a.Name
+	case *GenericObject:
+		return "<" + o.Class.Module + "." + o.Class.Name + " object>." + a.Name
+	default:
+		return fmt.Sprintf("<%T>.%s", a.Object, a.Name)
+	}
+}
+
+// ComplexClass represents Python "complex" class (builtin type). Pickles
+// represent a complex number as a call to the class, with its real and
+// imaginary parts.
+type ComplexClass struct{}
+
+var _ Callable = &ComplexClass{}
+
+// Call returns a new complex128, from the real and imaginary parts, if any.
+func (*ComplexClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) > 2 {
+		return nil, fmt.Errorf("ComplexClass.Call args not supported: %#v", args)
+	}
+	var parts [2]float64
+	for i, arg := range args {
+		v, ok := floatArg(arg)
+		if !ok {
+			return nil, fmt.Errorf("ComplexClass.Call args not supported: %#v", args)
+		}
+		parts[i] = v
+	}
+	return complex(parts[0], parts[1]), nil
+}
+
+// SliceClass represents Python "slice" class (builtin type).
+type SliceClass struct{}
+
+var _ Callable = &SliceClass{}
+
+// Call returns a new Slice, with the given start, stop and step. As in
+// Python, a single argument is the stop.
+func (*SliceClass) Call(args ...interface{}) (interface{}, error) {
+	switch len(args) {
+	case 1:
+		return &Slice{Stop: args[0]}, nil
+	case 2:
+		return &Slice{Start: args[0], Stop: args[1]}, nil
+	case 3:
+		return &Slice{Start: args[0], Stop: args[1], Step: args[2]}, nil
+	default:
+		return nil, fmt.Errorf("SliceClass.Call args not supported: %#v", args)
+	}
+}
+
+// Slice represents a Python "slice" object. Each of its values is an
+// integer, usually, or nil, for None.
+type Slice struct {
+	Start interface{}
+	Stop  interface{}
+	Step  interface{}
+}
+
+var _ fmt.Stringer = &Slice{}
+
+// String returns the representation of the Slice in Python.
+func (s *Slice) String() string {
+	values := []interface{}{s.Start, s.Stop, s.Step}
+	for i, v := range values {
+		if v == nil {
+			values[i] = "None"
+		}
+	}
+	return fmt.Sprintf("slice(%v, %v, %v)", values...)
+}
+
+// RangeClass represents Python "range" class (builtin type), which is
+// "xrange" in Python 2.
+type RangeClass struct{}
+
+var _ Callable = &RangeClass{}
+
+// Call returns a new Range, with the given start, stop and step. As in
+// Python, a single argument is the stop, and the step defaults to 1.
+func (*RangeClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, fmt.Errorf("RangeClass.Call args not supported: %#v", args)
+	}
+	values := []int{0, 0, 1}
+	for i, arg := range args {
+		v, ok := intArg(arg)
+		if !ok {
+			return nil, fmt.Errorf("RangeClass.Call args not supported: %#v", args)
+		}
+		values[i] = v
+	}
+	if len(args) == 1 {
+		values[0], values[1] = 0, values[0]
+	}
+	if values[2] == 0 {
+		return nil, fmt.Errorf("RangeClass.Call: step must not be zero")
+	}
+	return &Range{Start: values[0], Stop: values[1], Step: values[2]}, nil
+}
+
+// Range represents a Python "range" object.
+type Range struct {
+	Start int
+	Stop  int
+	Step  int
+}
+
+var _ fmt.Stringer = &Range{}
+
+// String returns the representation of the Range in Python.
+func (r *Range) String() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.Stop)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+
+// Len returns the number of values of the Range.
+func (r *Range) Len() int {
+	if r.Step > 0 && r.Start < r.Stop {
+		return (r.Stop - r.Start + r.Step - 1) / r.Step
+	}
+	if r.Step < 0 && r.Start > r.Stop {
+		return (r.Start - r.Stop - r.Step - 1) / -r.Step
+	}
+	return 0
+}
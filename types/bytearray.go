@@ -4,6 +4,8 @@
 
 package types
 
+import "fmt"
+
 // ByteArray represents a Python "bytearray" (builtin type).
 type ByteArray []byte
 
@@ -30,7 +32,42 @@ func (b *ByteArray) Get(i int) byte {
 	return (*b)[i]
 }
 
+// Bytes returns the underlying slice of the ByteArray, which, as the
+// ByteArray itself, can be modified.
+func (b *ByteArray) Bytes() []byte {
+	return *b
+}
+
 // Len returns the length of the ByteArray.
 func (b *ByteArray) Len() int {
 	return len(*b)
 }
+
+// ByteArrayClass represents Python "bytearray" class (builtin type).
+// Pickle protocols up to 4 represent a bytearray as a call to the class,
+// with its content either as bytes, or as a string and its encoding.
+type ByteArrayClass struct{}
+
+var _ Callable = &ByteArrayClass{}
+
+// Call returns a new ByteArray, holding a copy of the given Bytes, or the
+// given string encoded as by CodecsEncode, if any.
+func (*ByteArrayClass) Call(args ...interface{}) (interface{}, error) {
+	switch len(args) {
+	case 0:
+		return NewByteArray(), nil
+	case 1:
+		if b, ok := args[0].(Bytes); ok {
+			return NewByteArrayFromSlice(b.Bytes()), nil
+		}
+	case 2:
+		if _, ok := args[0].(string); ok {
+			encoded, err := (&CodecsEncode{}).Call(args...)
+			if err != nil {
+				return nil, err
+			}
+			return NewByteArrayFromSlice(encoded.(Bytes).Bytes()), nil
+		}
+	}
+	return nil, fmt.Errorf("ByteArrayClass.Call args not supported: %#v", args)
+}
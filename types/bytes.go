@@ -0,0 +1,99 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bytes represents a Python "bytes" value (builtin type). As in Python,
+// it is immutable; use ByteArray for "bytearray" values instead.
+//
+// Being a distinct type, it is never confused with a Python "str" (string)
+// nor with the raw data of tensors ([]byte). It is comparable, so, as in
+// Python, it can also be a dictionary key.
+type Bytes string
+
+// NewBytes returns a new Bytes value, holding a copy of the given slice.
+func NewBytes(b []byte) Bytes {
+	return Bytes(b)
+}
+
+// Bytes returns a new slice holding the bytes of the value.
+func (b Bytes) Bytes() []byte {
+	return []byte(b)
+}
+
+// Len returns the number of bytes.
+func (b Bytes) Len() int {
+	return len(b)
+}
+
+// BytesClass represents Python "bytes" class (builtin type). Pickle
+// protocols up to 2 represent an empty "bytes" value as a call to the
+// class, without arguments.
+type BytesClass struct{}
+
+var _ Callable = &BytesClass{}
+
+// Call returns a new empty Bytes.
+func (*BytesClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("BytesClass.Call args not supported: %#v", args)
+	}
+	return Bytes(""), nil
+}
+
+// CodecsEncode represents Python "_codecs.encode" function. Pickle
+// protocols up to 2 represent a non-empty "bytes" value as a call to this
+// function, encoding a string made of one code point for each byte with
+// the "latin1" codec.
+type CodecsEncode struct{}
+
+var _ Callable = &CodecsEncode{}
+
+// Call encodes a string with the given codec ("utf-8" by default), which
+// can be "latin1" (and its aliases), "utf-8" or "ascii", returning Bytes.
+func (*CodecsEncode) Call(args ...interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("CodecsEncode: invalid arguments: %#v", args)
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("CodecsEncode: invalid arguments: %#v", args)
+	}
+	encoding := "utf-8"
+	if len(args) == 2 {
+		if encoding, ok = args[1].(string); !ok {
+			return nil, fmt.Errorf("CodecsEncode: invalid arguments: %#v", args)
+		}
+	}
+
+	switch strings.Replace(strings.ToLower(encoding), "_", "-", -1) {
+	case "latin1", "latin-1", "iso-8859-1", "iso8859-1", "l1":
+		return encodeRunes(s, 0xff, encoding)
+	case "ascii", "us-ascii":
+		return encodeRunes(s, 0x7f, encoding)
+	case "utf-8", "utf8":
+		return Bytes(s), nil
+	default:
+		return nil, fmt.Errorf("CodecsEncode: unsupported encoding %q", encoding)
+	}
+}
+
+// encodeRunes encodes each code point of s as a single byte, as long as
+// it does not exceed max.
+func encodeRunes(s string, max rune, encoding string) (Bytes, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > max {
+			return "", fmt.Errorf(
+				"CodecsEncode: %q cannot encode character %q", encoding, r)
+		}
+		b = append(b, byte(r))
+	}
+	return Bytes(b), nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import "fmt"
+
+// CounterClass represents Python "collections.Counter" class.
+type CounterClass struct{}
+
+var _ Callable = &CounterClass{}
+
+// Call returns a new Counter, given the optional dict of its counts, as
+// pickled by Python.
+func (*CounterClass) Call(args ...interface{}) (interface{}, error) {
+	c := &Counter{Dict: NewDict()}
+	if len(args) == 0 {
+		return c, nil
+	}
+	if len(args) == 1 {
+		switch counts := args[0].(type) {
+		case *Dict:
+			for _, entry := range counts.Entries() {
+				c.Set(entry.Key, entry.Value)
+			}
+			return c, nil
+		case *OrderedDict:
+			counts.Range(func(key, value interface{}) bool {
+				c.Set(key, value)
+				return true
+			})
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("CounterClass: invalid arguments: %#v", args)
+}
+
+// Counter represents a Python "collections.Counter" object, that is a Dict
+// of the counts of its keys, usually integers.
+type Counter struct {
+	*Dict
+}
+
+var _ DictSetter = &Counter{}
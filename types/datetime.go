@@ -0,0 +1,205 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+	"unicode/utf8"
+)
+
+// DatetimeClass represents Python "datetime.datetime" class. Calling it
+// returns a time.Time, in the location of its "tzinfo" (see
+// TimezoneClass), or in UTC for the naive datetimes, which have none.
+type DatetimeClass struct{}
+
+var _ Callable = &DatetimeClass{}
+
+// Call returns a time.Time, given the pickled state of a datetime, that is
+// its 10 bytes followed by the optional tzinfo, or the arguments of the
+// Python constructor: year, month, day, and optionally hour, minute,
+// second, microsecond and tzinfo.
+func (*DatetimeClass) Call(args ...interface{}) (interface{}, error) {
+	var fields []int
+	var tzinfo interface{}
+	if state, ok := datetimeState(args, 10); ok {
+		fields = []int{
+			int(state[0])<<8 | int(state[1]),
+			// the high bit of the month is the "fold" of the time
+			int(state[2] & 0x7f),
+			int(state[3]), int(state[4]), int(state[5]), int(state[6]),
+			int(state[7])<<16 | int(state[8])<<8 | int(state[9]),
+		}
+		if len(args) == 2 {
+			tzinfo = args[1]
+		}
+	} else {
+		if len(args) < 3 || len(args) > 8 {
+			return nil, fmt.Errorf("DatetimeClass: invalid arguments: %#v", args)
+		}
+		fields = make([]int, 7)
+		for i, arg := range args {
+			if i == 7 {
+				tzinfo = arg
+				break
+			}
+			v, ok := intArg(arg)
+			if !ok {
+				return nil, fmt.Errorf("DatetimeClass: invalid arguments: %#v", args)
+			}
+			fields[i] = v
+		}
+	}
+
+	loc := time.UTC
+	switch tz := tzinfo.(type) {
+	case nil:
+	case *time.Location:
+		loc = tz
+	default:
+		return nil, fmt.Errorf("DatetimeClass: unsupported tzinfo: %#v", tzinfo)
+	}
+	t := time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5],
+		fields[6]*1000, loc)
+	if t.Year() != fields[0] || int(t.Month()) != fields[1] || t.Day() != fields[2] ||
+		t.Hour() != fields[3] || t.Minute() != fields[4] || t.Second() != fields[5] ||
+		fields[6] < 0 || fields[6] > 999999 {
+		return nil, fmt.Errorf("DatetimeClass: invalid datetime fields: %v", fields)
+	}
+	return t, nil
+}
+
+// DateClass represents Python "datetime.date" class. Calling it returns a
+// time.Time, at midnight UTC of the date.
+type DateClass struct{}
+
+var _ Callable = &DateClass{}
+
+// Call returns a time.Time, given the pickled state of a date, that is its
+// 4 bytes, or the arguments of the Python constructor: year, month, day.
+func (*DateClass) Call(args ...interface{}) (interface{}, error) {
+	var year, month, day int
+	if state, ok := datetimeState(args, 4); ok && len(args) == 1 {
+		year, month, day = int(state[0])<<8|int(state[1]), int(state[2]), int(state[3])
+	} else {
+		ok := len(args) == 3
+		if ok {
+			var yearOk, monthOk, dayOk bool
+			year, yearOk = intArg(args[0])
+			month, monthOk = intArg(args[1])
+			day, dayOk = intArg(args[2])
+			ok = yearOk && monthOk && dayOk
+		}
+		if !ok {
+			return nil, fmt.Errorf("DateClass: invalid arguments: %#v", args)
+		}
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return nil, fmt.Errorf("DateClass: invalid date %d-%d-%d", year, month, day)
+	}
+	return t, nil
+}
+
+// TimedeltaClass represents Python "datetime.timedelta" class. Calling it
+// returns a time.Duration.
+type TimedeltaClass struct{}
+
+var _ Callable = &TimedeltaClass{}
+
+// Call returns a time.Duration, given the days, seconds and microseconds
+// of a timedelta, as pickled by Python. It fails for the timedeltas longer
+// than about 292 years, which a time.Duration cannot represent.
+func (*TimedeltaClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) > 3 {
+		return nil, fmt.Errorf("TimedeltaClass: invalid arguments: %#v", args)
+	}
+	units := []int64{86400 * 1e6, 1e6, 1}
+	total := new(big.Int)
+	for i, arg := range args {
+		v, ok := intArg(arg)
+		if !ok {
+			return nil, fmt.Errorf("TimedeltaClass: invalid arguments: %#v", args)
+		}
+		total.Add(total, new(big.Int).Mul(big.NewInt(int64(v)), big.NewInt(units[i])))
+	}
+	total.Mul(total, big.NewInt(int64(time.Microsecond)))
+	if !total.IsInt64() {
+		return nil, fmt.Errorf("TimedeltaClass: %v overflows time.Duration", args)
+	}
+	return time.Duration(total.Int64()), nil
+}
+
+// TimezoneClass represents Python "datetime.timezone" class, the tzinfo of
+// the datetimes with a fixed offset from UTC. Calling it returns a
+// *time.Location.
+type TimezoneClass struct{}
+
+var _ Callable = &TimezoneClass{}
+
+// Call returns a *time.Location, given the offset of the timezone, as a
+// time.Duration (see TimedeltaClass), and its optional name. The zero
+// offset without a name, that is "datetime.timezone.utc", is time.UTC.
+func (*TimezoneClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("TimezoneClass: invalid arguments: %#v", args)
+	}
+	offset, ok := args[0].(time.Duration)
+	if !ok {
+		return nil, fmt.Errorf("TimezoneClass: invalid offset: %#v", args[0])
+	}
+	seconds := int(offset / time.Second)
+	if len(args) == 2 {
+		name, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("TimezoneClass: invalid name: %#v", args[1])
+		}
+		return time.FixedZone(name, seconds), nil
+	}
+	if seconds == 0 {
+		return time.UTC, nil
+	}
+	// the name of an unnamed timezone in Python, such as "UTC+02:00"
+	sign, abs := '+', seconds
+	if seconds < 0 {
+		sign, abs = '-', -seconds
+	}
+	name := fmt.Sprintf("UTC%c%02d:%02d", sign, abs/3600, abs/60%60)
+	if abs%60 != 0 {
+		name += fmt.Sprintf(":%02d", abs%60)
+	}
+	return time.FixedZone(name, seconds), nil
+}
+
+// datetimeState returns the bytes of the pickled state of a datetime
+// object, if the first argument is a state of the given size: Bytes, or
+// the string of a pickle written by Python 2.
+func datetimeState(args []interface{}, size int) ([]byte, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	var state []byte
+	switch v := args[0].(type) {
+	case Bytes:
+		state = v.Bytes()
+	case string:
+		// a string decoded as latin-1, or holding the raw bytes
+		if utf8.RuneCountInString(v) == size {
+			for _, r := range v {
+				if r > 0xff {
+					break
+				}
+				state = append(state, byte(r))
+			}
+		}
+		if len(state) != size {
+			state = []byte(v)
+		}
+	default:
+		return nil, false
+	}
+	return state, len(state) == size
+}
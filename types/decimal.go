@@ -0,0 +1,50 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DecimalClass represents Python "decimal.Decimal" class.
+type DecimalClass struct{}
+
+var _ Callable = &DecimalClass{}
+
+// Call returns a Decimal, given its string representation, as pickled by
+// Python.
+func (*DecimalClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("DecimalClass: invalid arguments: %#v", args)
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("DecimalClass: invalid arguments: %#v", args)
+	}
+	return Decimal(s), nil
+}
+
+// Decimal represents a Python "decimal.Decimal" value by its string
+// representation, such as "1.50", "-1E+3" or "NaN", which keeps the exact
+// digits of the value, including the trailing zeros.
+type Decimal string
+
+// String returns the string representation of the Decimal.
+func (d Decimal) String() string {
+	return string(d)
+}
+
+// Rat returns the exact value of the Decimal as a *big.Rat, and whether it
+// is a finite number: the infinities and the NaNs have no such value.
+func (d Decimal) Rat() (*big.Rat, bool) {
+	s := strings.TrimSpace(string(d))
+	lower := strings.ToLower(strings.TrimLeft(s, "+-"))
+	if strings.HasPrefix(lower, "inf") || strings.HasPrefix(lower, "nan") || strings.HasPrefix(lower, "snan") {
+		return nil, false
+	}
+	return new(big.Rat).SetString(strings.Replace(s, "_", "", -1))
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import "fmt"
+
+// DefaultDictClass represents Python "collections.defaultdict" class.
+type DefaultDictClass struct{}
+
+var _ Callable = &DefaultDictClass{}
+
+// Call returns a new empty DefaultDict, given its optional default
+// factory, whose items are then set by the pickle.
+func (*DefaultDictClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("DefaultDictClass: invalid arguments: %#v", args)
+	}
+	d := &DefaultDict{Dict: NewDict()}
+	if len(args) == 1 {
+		d.DefaultFactory = args[0]
+	}
+	return d, nil
+}
+
+// DefaultDict represents a Python "collections.defaultdict" object: a Dict
+// along with the function which makes the values of the missing keys in
+// Python, which is not called in Go.
+type DefaultDict struct {
+	*Dict
+	// DefaultFactory is the class or function making the default values,
+	// such as the "list" class, or nil for None.
+	DefaultFactory interface{}
+}
+
+var _ DictSetter = &DefaultDict{}
@@ -0,0 +1,72 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import "fmt"
+
+// DequeClass represents Python "collections.deque" class.
+type DequeClass struct{}
+
+var _ Callable = &DequeClass{}
+
+// Call returns a new Deque, given the optional list or tuple of its
+// initial items and its maximum length, or None. Python pickles the items
+// separately, appending them to an empty Deque.
+func (*DequeClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) > 2 {
+		return nil, fmt.Errorf("DequeClass: invalid arguments: %#v", args)
+	}
+	d := &Deque{MaxLen: -1}
+	if len(args) == 2 && args[1] != nil {
+		maxLen, ok := intArg(args[1])
+		if !ok || maxLen < 0 {
+			return nil, fmt.Errorf("DequeClass: invalid maxlen: %#v", args[1])
+		}
+		d.MaxLen = maxLen
+	}
+	if len(args) > 0 {
+		var items []interface{}
+		switch v := args[0].(type) {
+		case *List:
+			items = *v
+		case *Tuple:
+			items = *v
+		default:
+			return nil, fmt.Errorf("DequeClass: invalid items: %#v", args[0])
+		}
+		for _, item := range items {
+			d.Append(item)
+		}
+	}
+	return d, nil
+}
+
+// Deque represents a Python "collections.deque" object, a list of items
+// which may have a maximum length.
+type Deque struct {
+	Items List
+	// MaxLen is the maximum length of the Deque, or -1 if it is unbounded.
+	MaxLen int
+}
+
+var _ ListAppender = &Deque{}
+
+// Append appends one element to the end of the Deque. If the Deque is
+// full, its first element is discarded, as in Python.
+func (d *Deque) Append(v interface{}) {
+	if d.MaxLen == 0 {
+		return
+	}
+	if d.MaxLen > 0 && len(d.Items) == d.MaxLen {
+		copy(d.Items, d.Items[1:])
+		d.Items = d.Items[:len(d.Items)-1]
+	}
+	d.Items = append(d.Items, v)
+}
+
+// Len returns the length of the Deque.
+func (d *Deque) Len() int {
+	return len(d.Items)
+}
@@ -6,6 +6,7 @@ package types
 
 import (
 	"fmt"
+	"math/big"
 	"reflect"
 )
 
@@ -17,9 +18,23 @@ type DictSetter interface {
 
 // Dict represents a Python "dict" (builtin type).
 //
-// It is implemented as a slice, instead of a map, because in Go not
-// all types can be map's keys (e.g. slices).
-type Dict []DictEntry
+// The entries are kept in insertion order, as in Python, and two keys are
+// the same if they are deeply equal (see reflect.DeepEqual). The hashable
+// keys are indexed, for constant-time lookups even in large dicts, such
+// as vocabularies: they are None, booleans, numbers, strings and Bytes,
+// *big.Int values and tuples of hashable values. Any other key, which Go
+// cannot hash consistently, such as a list or a pointer to a class, is
+// looked up scanning all such keys.
+//
+// The zero value is an empty Dict, ready to use.
+type Dict struct {
+	entries []DictEntry
+	// index holds the position in entries of each hashable key, by its
+	// hash key (see dictHashKey).
+	index map[interface{}]int
+	// unhashable holds the positions in entries of the other keys.
+	unhashable []int
+}
 
 type DictEntry struct {
 	Key   interface{}
@@ -30,13 +45,41 @@ var _ DictSetter = &Dict{}
 
 // NewDict makes and returns a new empty Dict.
 func NewDict() *Dict {
-	d := make(Dict, 0, 4)
-	return &d
+	return &Dict{}
 }
 
-// Set sets into the Dict the given key/value pair.
+// NewDictFromEntries makes and returns a new Dict with the given entries,
+// in order. As for Set, the value of a repeated key replaces the previous
+// one.
+func NewDictFromEntries(entries []DictEntry) *Dict {
+	d := &Dict{
+		entries: make([]DictEntry, 0, len(entries)),
+		index:   make(map[interface{}]int, len(entries)),
+	}
+	for _, entry := range entries {
+		d.Set(entry.Key, entry.Value)
+	}
+	return d
+}
+
+// Set sets into the Dict the given key/value pair. If the key does not
+// exist yet, the new pair is placed after all the others; otherwise the
+// existing value is replaced, keeping its position, as in Python.
 func (d *Dict) Set(key, value interface{}) {
-	*d = append(*d, DictEntry{
+	hashKey, hashable := dictHashKey(key)
+	if i, ok := d.find(key, hashKey, hashable); ok {
+		d.entries[i].Value = value
+		return
+	}
+	if hashable {
+		if d.index == nil {
+			d.index = make(map[interface{}]int)
+		}
+		d.index[hashKey] = len(d.entries)
+	} else {
+		d.unhashable = append(d.unhashable, len(d.entries))
+	}
+	d.entries = append(d.entries, DictEntry{
 		Key:   key,
 		Value: value,
 	})
@@ -45,14 +88,27 @@ func (d *Dict) Set(key, value interface{}) {
 // Get returns the value associated with the given key (if any), and whether
 // the key is present or not.
 func (d *Dict) Get(key interface{}) (interface{}, bool) {
-	for _, entry := range *d {
-		if reflect.DeepEqual(entry.Key, key) {
-			return entry.Value, true
-		}
+	hashKey, hashable := dictHashKey(key)
+	if i, ok := d.find(key, hashKey, hashable); ok {
+		return d.entries[i].Value, true
 	}
 	return nil, false
 }
 
+// find returns the position of a key in the entries.
+func (d *Dict) find(key, hashKey interface{}, hashable bool) (int, bool) {
+	if hashable {
+		i, ok := d.index[hashKey]
+		return i, ok
+	}
+	for _, i := range d.unhashable {
+		if reflect.DeepEqual(d.entries[i].Key, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
 // MustGet returns the value associated with the given key, if if it exists,
 // otherwise it panics.
 func (d *Dict) MustGet(key interface{}) interface{} {
@@ -66,5 +122,77 @@ func (d *Dict) MustGet(key interface{}) interface{} {
 // Len returns the length of the Dict, that is, the amount of key/value pairs
 // contained by the Dict.
 func (d *Dict) Len() int {
-	return len(*d)
+	return len(d.entries)
+}
+
+// Entries returns the key/value pairs of the Dict, in insertion order. The
+// returned slice is shared with the Dict, and must not be modified.
+func (d *Dict) Entries() []DictEntry {
+	return d.entries
+}
+
+// Keys returns the keys of the Dict, in insertion order.
+func (d *Dict) Keys() []interface{} {
+	keys := make([]interface{}, len(d.entries))
+	for i, entry := range d.entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+// Range calls f for each key/value pair of the Dict, in insertion order,
+// until f returns false.
+func (d *Dict) Range(f func(key, value interface{}) bool) {
+	for _, entry := range d.entries {
+		if !f(entry.Key, entry.Value) {
+			return
+		}
+	}
+}
+
+// bigIntKey is the hash key of a *big.Int.
+type bigIntKey string
+
+// tupleKey is the hash key of a *Tuple: an array of the hash keys of its
+// items.
+type tupleKey struct{ items interface{} }
+
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// dictHashKey returns a comparable value which is the same for the keys
+// which are deeply equal, if the key is hashable.
+func dictHashKey(key interface{}) (interface{}, bool) {
+	switch k := key.(type) {
+	case nil:
+		return nil, true
+	case *big.Int:
+		if k == nil {
+			return nil, false
+		}
+		return bigIntKey(k.String()), true
+	case *Tuple:
+		if k == nil {
+			return nil, false
+		}
+		items := reflect.New(reflect.ArrayOf(len(*k), emptyInterfaceType)).Elem()
+		for i, item := range *k {
+			itemKey, ok := dictHashKey(item)
+			if !ok {
+				return nil, false
+			}
+			if itemKey != nil {
+				items.Index(i).Set(reflect.ValueOf(itemKey))
+			}
+		}
+		return tupleKey{items: items.Interface()}, true
+	}
+	switch reflect.TypeOf(key).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return key, true
+	default:
+		return nil, false
+	}
 }
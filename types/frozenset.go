@@ -4,6 +4,8 @@
 
 package types
 
+import "fmt"
+
 // FrozenSet represents a Python "frozenset" (builtin type).
 //
 // It is implemented in Go as a map with empty struct values; the actual set
@@ -33,3 +35,27 @@ func (f *FrozenSet) Has(v interface{}) bool {
 	_, ok := (*f)[v]
 	return ok
 }
+
+// FrozenSetClass represents Python "frozenset" class (builtin type).
+// Pickle protocols up to 3 represent a frozenset as a call to the class,
+// with a list of items.
+type FrozenSetClass struct{}
+
+var _ Callable = &FrozenSetClass{}
+
+// Call returns a new FrozenSet, with the items of the given *List or
+// *Tuple, if any.
+func (*FrozenSetClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return NewFrozenSetFromSlice(nil), nil
+	}
+	if len(args) == 1 {
+		switch items := args[0].(type) {
+		case *List:
+			return NewFrozenSetFromSlice(*items), nil
+		case *Tuple:
+			return NewFrozenSetFromSlice(*items), nil
+		}
+	}
+	return nil, fmt.Errorf("FrozenSetClass.Call args not supported: %#v", args)
+}
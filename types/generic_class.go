@@ -10,12 +10,29 @@ type GenericClass struct {
 }
 
 var _ PyNewable = &GenericClass{}
+var _ Callable = &GenericClass{}
 
 type GenericObject struct {
 	Class           *GenericClass
 	ConstructorArgs []interface{}
+	// Dict holds the attributes of the object set by its pickled state,
+	// from its "__dict__" or its slots, if any. It is nil otherwise.
+	Dict *Dict
+	// State holds the pickled state of the object which is not made of
+	// its attributes, as that of the classes implementing "__setstate__"
+	// in Python, or nil.
+	State interface{}
+	// ListItems and DictItems hold the items appended or set by the pickle,
+	// as for the subclasses of "list" and "dict", or nil.
+	ListItems []interface{}
+	DictItems *Dict
 }
 
+var _ PyDictSettable = &GenericObject{}
+var _ PyAttrSettable = &GenericObject{}
+var _ ListAppender = &GenericObject{}
+var _ DictSetter = &GenericObject{}
+
 func NewGenericClass(module, name string) *GenericClass {
 	return &GenericClass{Module: module, Name: name}
 }
@@ -26,3 +43,37 @@ func (g *GenericClass) PyNew(args ...interface{}) (interface{}, error) {
 		ConstructorArgs: args,
 	}, nil
 }
+
+// Call returns a new GenericObject made with the given arguments, as for
+// the objects reduced to their class and its arguments, which REDUCE
+// calls.
+func (g *GenericClass) Call(args ...interface{}) (interface{}, error) {
+	return g.PyNew(args...)
+}
+
+// PyDictSet sets an attribute of the object, in its Dict.
+func (g *GenericObject) PyDictSet(key, value interface{}) error {
+	if g.Dict == nil {
+		g.Dict = NewDict()
+	}
+	g.Dict.Set(key, value)
+	return nil
+}
+
+// PySetAttr sets an attribute of the object from its slots, in its Dict.
+func (g *GenericObject) PySetAttr(key string, value interface{}) error {
+	return g.PyDictSet(key, value)
+}
+
+// Append appends an item of the object, in its ListItems.
+func (g *GenericObject) Append(v interface{}) {
+	g.ListItems = append(g.ListItems, v)
+}
+
+// Set sets an item of the object, in its DictItems.
+func (g *GenericObject) Set(key, value interface{}) {
+	if g.DictItems == nil {
+		g.DictItems = NewDict()
+	}
+	g.DictItems.Set(key, value)
+}
@@ -63,3 +63,31 @@ type PyAttrSettable interface {
 	// See: https://docs.python.org/3/library/functions.html#setattr
 	PySetAttr(key string, value interface{}) error
 }
+
+// PyReducible is implemented by any value that can be pickled by means of
+// a Python-like "__reduce__" method, that is, as a callable object and the
+// arguments to call it with in order to re-create the value.
+type PyReducible interface {
+	// PyReduce mimics Python invocation of the "__reduce__" method,
+	// returning a callable object (usually a *GenericClass) and the tuple
+	// of arguments to call it with.
+	//
+	// See: https://docs.python.org/3/library/pickle.html#object.__reduce__
+	PyReduce() (callable interface{}, args *Tuple, err error)
+}
+
+// PyFullyReducible is implemented by PyReducible values whose "__reduce__"
+// returns the full 5-tuple (callable, args, state, listitems, dictitems).
+//
+// Once the value is re-created calling the callable, the list items are
+// appended to it, and the dict items set into it: in order to be unpickled,
+// it must then implement ListAppender or DictSetter, respectively. Finally,
+// the state, if not nil, is set as for any other object (see
+// PyStateSettable).
+type PyFullyReducible interface {
+	PyReducible
+	// PyReduceItems returns the state, the list items and the dict items
+	// of the value, that is, the last three elements of the tuple returned
+	// by Python "__reduce__". Any of them may be nil.
+	PyReduceItems() (state interface{}, listItems []interface{}, dictItems []DictEntry, err error)
+}
@@ -126,3 +126,23 @@ func (o *OrderedDict) PyDictSet(key, value interface{}) error {
 	o.PyDict[sKey] = value
 	return nil
 }
+
+// Keys returns the keys of the OrderedDict, in insertion order.
+func (o *OrderedDict) Keys() []interface{} {
+	keys := make([]interface{}, 0, o.List.Len())
+	for e := o.List.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*OrderedDictEntry).Key)
+	}
+	return keys
+}
+
+// Range calls f for each key/value pair of the OrderedDict, in insertion
+// order, until f returns false.
+func (o *OrderedDict) Range(f func(key, value interface{}) bool) {
+	for e := o.List.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*OrderedDictEntry)
+		if !f(entry.Key, entry.Value) {
+			return
+		}
+	}
+}
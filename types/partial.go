@@ -0,0 +1,77 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import "fmt"
+
+// PartialClass represents Python "functools.partial" class.
+type PartialClass struct{}
+
+var _ Callable = &PartialClass{}
+
+// Call returns a new Partial application of the function given as first
+// argument to the remaining arguments.
+func (*PartialClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("PartialClass: missing function argument")
+	}
+	return &Partial{Func: args[0], Args: append([]interface{}(nil), args[1:]...)}, nil
+}
+
+// Partial represents a Python "functools.partial" object, that is a
+// function with some of its positional (and keyword) arguments already
+// set.
+//
+// A Partial is itself a Callable, so that it can be called by a subsequent
+// REDUCE, as long as its function is a Callable too.
+type Partial struct {
+	// Func is the function to call.
+	Func interface{}
+	// Args are the positional arguments, which precede those given to Call.
+	Args []interface{}
+	// Keywords are the keyword arguments, if any.
+	Keywords *Dict
+	// PyDict represents Python "object.__dict__" dictionary of attributes.
+	PyDict *Dict
+}
+
+var _ Callable = &Partial{}
+var _ PyStateSettable = &Partial{}
+
+// Call calls the function with the arguments of the Partial, followed by
+// args. Keyword arguments are not supported.
+func (p *Partial) Call(args ...interface{}) (interface{}, error) {
+	callable, ok := p.Func.(Callable)
+	if !ok {
+		return nil, fmt.Errorf("Partial: function is not Callable: %#v", p.Func)
+	}
+	if p.Keywords != nil && p.Keywords.Len() != 0 {
+		return nil, fmt.Errorf("Partial: keyword arguments not supported: %#v", p.Keywords)
+	}
+	allArgs := make([]interface{}, 0, len(p.Args)+len(args))
+	allArgs = append(allArgs, p.Args...)
+	allArgs = append(allArgs, args...)
+	return callable.Call(allArgs...)
+}
+
+// PySetState sets the state of the Partial from the tuple (func, args,
+// keywords, dict), as pickled by Python.
+func (p *Partial) PySetState(state interface{}) error {
+	t, ok := state.(*Tuple)
+	if !ok || t.Len() != 4 {
+		return fmt.Errorf("Partial: invalid state: %#v", state)
+	}
+	args, argsOk := t.Get(1).(*Tuple)
+	keywords, keywordsOk := t.Get(2).(*Dict)
+	dict, dictOk := t.Get(3).(*Dict)
+	if !argsOk || (!keywordsOk && t.Get(2) != nil) || (!dictOk && t.Get(3) != nil) {
+		return fmt.Errorf("Partial: invalid state: %#v", state)
+	}
+	p.Func = t.Get(0)
+	p.Args = append([]interface{}(nil), *args...)
+	p.Keywords = keywords
+	p.PyDict = dict
+	return nil
+}
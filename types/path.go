@@ -0,0 +1,47 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathClass represents the path classes of the Python "pathlib" module,
+// such as "pathlib.PosixPath" and "pathlib.PureWindowsPath". Calling it
+// returns the path as a string, with the separator of its flavour.
+type PathClass struct {
+	// Windows is true for the Windows paths, whose separator is a
+	// backslash rather than a slash.
+	Windows bool
+}
+
+var _ Callable = &PathClass{}
+
+// Call returns the path made of the given parts, as pickled by Python,
+// such as "/", "usr" and "lib" for "/usr/lib".
+func (c *PathClass) Call(args ...interface{}) (interface{}, error) {
+	sep := "/"
+	if c.Windows {
+		sep = `\`
+	}
+	var sb strings.Builder
+	for _, arg := range args {
+		part, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("PathClass: invalid arguments: %#v", args)
+		}
+		// the root part, such as "/" or `C:\`, already ends with the
+		// separator
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), sep) {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(part)
+	}
+	if sb.Len() == 0 {
+		return ".", nil
+	}
+	return sb.String(), nil
+}
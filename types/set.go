@@ -4,6 +4,8 @@
 
 package types
 
+import "fmt"
+
 // SetAdder is implemented by any value that exhibits a set-like behaviour,
 // allowing arbitrary values to be added.
 type SetAdder interface {
@@ -20,6 +22,29 @@ var _ SetAdder = &Set{}
 
 type setEmptyStruct struct{}
 
+// SetClass represents Python "set" class (builtin type). Pickle protocols
+// up to 3 represent a set as a call to the class, with a list of items.
+type SetClass struct{}
+
+var _ Callable = &SetClass{}
+
+// Call returns a new Set, with the items of the given *List or *Tuple, if
+// any.
+func (*SetClass) Call(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return NewSet(), nil
+	}
+	if len(args) == 1 {
+		switch items := args[0].(type) {
+		case *List:
+			return NewSetFromSlice(*items), nil
+		case *Tuple:
+			return NewSetFromSlice(*items), nil
+		}
+	}
+	return nil, fmt.Errorf("SetClass.Call args not supported: %#v", args)
+}
+
 // NewSet makes and returns a new empty Set.
 func NewSet() *Set {
 	s := make(Set, 4)
@@ -0,0 +1,64 @@
+// Copyright 2020 NLP Odyssey Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// UUIDClass represents Python "uuid.UUID" class.
+type UUIDClass struct{}
+
+var _ PyNewable = &UUIDClass{}
+
+// PyNew returns a new zero UUID, whose value is then set by its pickled
+// state (see UUID.PySetState).
+func (*UUIDClass) PyNew(args ...interface{}) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("UUIDClass: invalid arguments: %#v", args)
+	}
+	return &UUID{}, nil
+}
+
+// UUID represents a Python "uuid.UUID" value, by its 16 bytes, in
+// big-endian order.
+type UUID [16]byte
+
+var _ PyStateSettable = &UUID{}
+
+// PySetState sets the value of the UUID from its pickled state, that is a
+// dict holding its 128-bit integer value as "int", and possibly its
+// "is_safe" attribute, which is ignored.
+func (u *UUID) PySetState(state interface{}) error {
+	d, ok := state.(*Dict)
+	if !ok {
+		return fmt.Errorf("UUID: unexpected state: %#v", state)
+	}
+	value, _ := d.Get("int")
+	var i *big.Int
+	switch v := value.(type) {
+	case int:
+		i = big.NewInt(int64(v))
+	case int64:
+		i = big.NewInt(v)
+	case *big.Int:
+		i = v
+	}
+	if i == nil || i.Sign() < 0 || i.BitLen() > 128 {
+		return fmt.Errorf("UUID: invalid value: %#v", value)
+	}
+	*u = UUID{}
+	i.FillBytes(u[:])
+	return nil
+}
+
+// String returns the canonical representation of the UUID, such as
+// "12345678-1234-5678-1234-567812345678".
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}